@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/Func_Jobs/api/models"
+	"github.com/crowdstrike/gofalcon/falcon/client"
+)
+
+// ApproveJobHandler approves or rejects jobs pending approval.  Approved jobs have their workflows provisioned.
+type ApproveJobHandler struct {
+	conf *models.Config
+}
+
+// NewApproveJobHandler returns a new instance of ApproveJobHandler.
+func NewApproveJobHandler(conf *models.Config) *ApproveJobHandler {
+	return &ApproveJobHandler{
+		conf: conf,
+	}
+}
+
+func (h *ApproveJobHandler) Handle(ctx context.Context, request fdk.Request) fdk.Response {
+	response := fdk.Response{}
+
+	var req models.ApproveJobRequest
+	err := json.Unmarshal(request.Body, &req)
+	if err != nil {
+		response.Code = http.StatusBadRequest
+		response.Errors = append(response.Errors, models.NewAPIError(http.StatusBadRequest, fmt.Sprintf("Failed to unmarshal Request body err: %v.", err)))
+		return response
+	}
+	if strings.TrimSpace(req.ID) == "" {
+		response.Code = http.StatusBadRequest
+		response.Errors = append(response.Errors, models.NewAPIError(http.StatusBadRequest, "job id cannot be empty"))
+		return response
+	}
+
+	var caller models.Caller
+	if len(request.Context) > 0 {
+		_ = json.Unmarshal(request.Context, &caller)
+	}
+	if !h.isApprover(caller) {
+		response.Code = http.StatusForbidden
+		response.Errors = append(response.Errors, models.NewAPIError(http.StatusForbidden, "caller is not allowed to approve jobs"))
+		return response
+	}
+
+	fc, err := models.FalconClient(ctx, h.conf, request)
+	if err != nil {
+		response.Code = http.StatusInternalServerError
+		response.Errors = append(response.Errors, fdk.APIError{Code: http.StatusBadRequest, Message: "fail to initialize client"})
+		return response
+	}
+
+	result, code, errs := h.review(ctx, &req, caller, fc)
+	if len(errs) != 0 {
+		response.Code = code
+		response.Errors = errs
+		return response
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		response.Code = http.StatusInternalServerError
+		response.Errors = append(response.Errors, models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("failed to marshal the response body with err: %v", err)))
+		return response
+	}
+
+	response.Body = json.RawMessage(body)
+	response.Code = http.StatusOK
+	return response
+}
+
+// isApprover returns true if the caller holds one of the approver roles.
+func (h *ApproveJobHandler) isApprover(caller models.Caller) bool {
+	for _, role := range caller.Roles {
+		for _, approver := range h.conf.ApproverRoles {
+			if strings.EqualFold(role, approver) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// review records the decision on a job pending approval, provisioning its workflows if it is approved.  Users
+// cannot review the jobs they submitted.
+func (h *ApproveJobHandler) review(ctx context.Context, req *models.ApproveJobRequest, caller models.Caller, fc *client.CrowdStrikeAPISpecification) (*models.UpsertJobResponse, int, []fdk.APIError) {
+	job, errs := jobInfo(ctx, req.ID, h.conf, fc)
+	if len(errs) != 0 {
+		code := http.StatusInternalServerError
+		if strings.Contains(errs[0].Message, "not found") {
+			code = http.StatusNotFound
+		}
+		return nil, code, errs
+	}
+	if job.ApprovalStatus != models.ApprovalStatusPending {
+		return nil, http.StatusConflict, []fdk.APIError{models.NewAPIError(http.StatusConflict, fmt.Sprintf("job %s is not pending approval", job.ID))}
+	}
+	if caller.UserID != "" && caller.UserID == job.UserID {
+		return nil, http.StatusForbidden, []fdk.APIError{models.NewAPIError(http.StatusForbidden, "jobs cannot be approved by the user who submitted them")}
+	}
+
+	action := JobRejected
+	job.ApprovalStatus = models.ApprovalStatusRejected
+	if req.Approve {
+		if errs := provisionJob(ctx, job, h.conf, fc); len(errs) != 0 {
+			return nil, http.StatusInternalServerError, errs
+		}
+		action = JobApproved
+		job.ApprovalStatus = models.ApprovalStatusApproved
+		job.Draft = false
+	}
+
+	currTime := time.Now()
+	job.ReviewedBy = caller.UserName
+	job.ReviewedAt = &currTime
+	job.ReviewComment = req.Comment
+	job.UpdatedAt = &currTime
+	job.Version++
+
+	jobID, errs := putJob(ctx, job, h.conf, fc)
+	if len(errs) != 0 {
+		return nil, http.StatusInternalServerError, errs
+	}
+
+	errs = auditLogProducer(ctx, action, job, caller.UserName, h.conf, fc)
+	if len(errs) != 0 {
+		return nil, http.StatusInternalServerError, errs
+	}
+
+	return &models.UpsertJobResponse{Resource: jobID}, http.StatusOK, nil
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/Func_Jobs/api/models"
+)
+
+const queryNameParam = "name"
+
+// JobNameHandler checks whether a job name is available, i.e. no job has the same normalized name.
+type JobNameHandler struct {
+	conf *models.Config
+}
+
+// NewJobNameHandler returns an initialized version of JobNameHandler.
+func NewJobNameHandler(conf *models.Config) *JobNameHandler {
+	return &JobNameHandler{
+		conf: conf,
+	}
+}
+
+func (h *JobNameHandler) Handle(ctx context.Context, request fdk.Request) fdk.Response {
+	response := fdk.Response{}
+	name := models.NormalizeJobName(request.Params.Query.Get(queryNameParam))
+	if name == "" {
+		response.Code = http.StatusBadRequest
+		response.Errors = append(response.Errors, models.NewAPIError(http.StatusBadRequest, "job name cannot be empty"))
+		return response
+	}
+
+	fc, err := models.FalconClient(ctx, h.conf, request)
+	if err != nil {
+		response.Code = http.StatusInternalServerError
+		response.Errors = append(response.Errors, fdk.APIError{Code: http.StatusBadRequest, Message: "fail to initialize client"})
+		return response
+	}
+
+	jobID, errs := existingJobID(ctx, name, h.conf, fc)
+	if len(errs) != 0 {
+		response.Code = http.StatusInternalServerError
+		response.Errors = errs
+		return response
+	}
+
+	body, err := json.Marshal(models.JobNameResponse{Name: name, Available: jobID == "", JobID: jobID})
+	if err != nil {
+		response.Code = http.StatusInternalServerError
+		response.Errors = append(response.Errors, models.NewAPIError(http.StatusInternalServerError, "failed marshalling response body"))
+		return response
+	}
+
+	response.Body = json.RawMessage(body)
+	response.Code = http.StatusOK
+	return response
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/Func_Jobs/api/models"
+	"github.com/crowdstrike/gofalcon/falcon/client"
+	"github.com/crowdstrike/gofalcon/falcon/client/custom_storage"
+	"github.com/go-openapi/runtime"
+)
+
+// jobNameEntry is an object of the name index, which maps the names of jobs to their ID when jobs have UUID IDs.
+// Entries are keyed by the hash of the key of the name, see models.JobNameKey.
+type jobNameEntry struct {
+	JobID string `json:"job_id"`
+	Name  string `json:"name"`
+}
+
+// newJobID returns the ID of a new job named name, failing if the name is taken by another job.
+func newJobID(ctx context.Context, name string, conf *models.Config, fc *client.CrowdStrikeAPISpecification) (string, []fdk.APIError) {
+	existing, errs := existingJobID(ctx, name, conf, fc)
+	if len(errs) != 0 {
+		return "", errs
+	}
+	if existing != "" {
+		return "", []fdk.APIError{{Code: http.StatusBadRequest, Message: fmt.Sprintf("job with name:%s already exist", name)}}
+	}
+
+	var id string
+	var err error
+	if conf.JobIDStrategy == models.JobIDStrategyUUID {
+		id, err = models.NewUUID()
+	} else {
+		id, err = models.GenerateID(models.JobNameKey(name, conf.FoldJobNameCase))
+	}
+	if err != nil {
+		return "", []fdk.APIError{models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("failed to generate id for job: %s with err: %v", name, err))}
+	}
+	return id, nil
+}
+
+// existingJobID returns the ID of the job named name, or an empty string if there is none.  Jobs with hash IDs
+// are found whether or not they are indexed, including those created before names were normalized, whose ID is
+// the hash of their raw name.
+func existingJobID(ctx context.Context, name string, conf *models.Config, fc *client.CrowdStrikeAPISpecification) (string, []fdk.APIError) {
+	key := models.JobNameKey(name, conf.FoldJobNameCase)
+	candidates := []string{key}
+	if name != key {
+		candidates = append(candidates, name)
+	}
+	for _, c := range candidates {
+		hashID, err := models.GenerateID(c)
+		if err != nil {
+			return "", []fdk.APIError{models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("failed to generate id for job: %s with err: %v", name, err))}
+		}
+		job, errs := jobInfo(ctx, hashID, conf, fc)
+		if len(errs) != 0 && errs[0].Code != http.StatusNotFound {
+			return "", errs
+		}
+		if job != nil {
+			return job.ID, nil
+		}
+	}
+	if conf.JobIDStrategy != models.JobIDStrategyUUID {
+		return "", nil
+	}
+	return indexedJobID(ctx, name, conf, fc)
+}
+
+// indexedJobID returns the ID of the job indexed under name, or an empty string if the name is free.  The names
+// of deleted jobs are free.
+func indexedJobID(ctx context.Context, name string, conf *models.Config, fc *client.CrowdStrikeAPISpecification) (string, []fdk.APIError) {
+	key, err := jobNameEntryKey(name, conf)
+	if err != nil {
+		return "", []fdk.APIError{models.NewAPIError(http.StatusInternalServerError, err.Error())}
+	}
+
+	getRequest := custom_storage.NewGetObjectParamsWithContext(ctx)
+	getRequest.SetObjectKey(key)
+	getRequest.SetCollectionName(conf.JobNamesCollection)
+
+	buf := new(bytes.Buffer)
+	if _, err = fc.CustomStorage.GetObject(getRequest, buf); err != nil {
+		if runtimeErr, ok := err.(*runtime.APIError); ok && runtimeErr.Code == http.StatusNotFound {
+			return "", nil
+		}
+		return "", []fdk.APIError{models.NewAPIError(http.StatusInternalServerError, err.Error())}
+	}
+	rawResponse, err := io.ReadAll(buf)
+	if err != nil {
+		return "", []fdk.APIError{models.NewAPIError(http.StatusInternalServerError, err.Error())}
+	}
+	var entry jobNameEntry
+	if err = json.Unmarshal(rawResponse, &entry); err != nil {
+		return "", []fdk.APIError{models.NewAPIError(http.StatusInternalServerError, err.Error())}
+	}
+
+	job, errs := jobInfo(ctx, entry.JobID, conf, fc)
+	if len(errs) != 0 {
+		if errs[0].Code == http.StatusNotFound {
+			return "", nil
+		}
+		return "", errs
+	}
+	return job.ID, nil
+}
+
+// indexJobName records the ID of a job under its name in the name index.
+func indexJobName(ctx context.Context, name, id string, conf *models.Config, fc *client.CrowdStrikeAPISpecification) []fdk.APIError {
+	key, err := jobNameEntryKey(name, conf)
+	if err != nil {
+		return []fdk.APIError{models.NewAPIError(http.StatusInternalServerError, err.Error())}
+	}
+	rawObject, err := json.Marshal(jobNameEntry{JobID: id, Name: name})
+	if err != nil {
+		return []fdk.APIError{models.NewAPIError(http.StatusInternalServerError, err.Error())}
+	}
+
+	putRequest := custom_storage.NewPutObjectParamsWithContext(ctx)
+	putRequest.SetObjectKey(key)
+	putRequest.SetCollectionName(conf.JobNamesCollection)
+	putRequest.SetBody(io.NopCloser(bytes.NewReader(rawObject)))
+
+	response, err := fc.CustomStorage.PutObject(putRequest)
+	if err != nil {
+		return []fdk.APIError{models.NewAPIError(http.StatusInternalServerError, err.Error())}
+	}
+	if len(response.GetPayload().Errors) > 0 {
+		return convertMsaErrorsToAPIErrors(response.GetPayload().Errors)
+	}
+	return nil
+}
+
+// unindexJobName removes a name from the name index, e.g. the previous name of a renamed job.
+func unindexJobName(ctx context.Context, name string, conf *models.Config, fc *client.CrowdStrikeAPISpecification) []fdk.APIError {
+	key, err := jobNameEntryKey(name, conf)
+	if err != nil {
+		return []fdk.APIError{models.NewAPIError(http.StatusInternalServerError, err.Error())}
+	}
+
+	deleteRequest := custom_storage.NewDeleteObjectParamsWithContext(ctx)
+	deleteRequest.SetObjectKey(key)
+	deleteRequest.SetCollectionName(conf.JobNamesCollection)
+
+	if _, err = fc.CustomStorage.DeleteObject(deleteRequest); err != nil {
+		if runtimeErr, ok := err.(*runtime.APIError); ok && runtimeErr.Code == http.StatusNotFound {
+			return nil
+		}
+		return []fdk.APIError{models.NewAPIError(http.StatusInternalServerError, err.Error())}
+	}
+	return nil
+}
+
+func jobNameEntryKey(name string, conf *models.Config) (string, error) {
+	return models.GenerateID(models.JobNameKey(name, conf.FoldJobNameCase))
+}
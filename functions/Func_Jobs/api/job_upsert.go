@@ -76,9 +76,12 @@ func (h *UpsertJobHandler) Handle(ctx context.Context, request fdk.Request) fdk.
 // upsertJob saves a job to custom storage and may attempt to run or schedule the job if requested.
 func (h *UpsertJobHandler) upsertJob(ctx context.Context, isDraft bool, req *models.UpsertJobRequest, fc *client.CrowdStrikeAPISpecification) (*models.UpsertJobResponse, []fdk.APIError) {
 	var errs []fdk.APIError
-	var err error
 
-	validationErr := req.Validate()
+	// the names of existing jobs with hash IDs are left as they are, as their ID may be the hash of the raw name
+	if req.ID == "" || h.conf.JobIDStrategy == models.JobIDStrategyUUID {
+		req.Name = models.NormalizeJobName(req.Name)
+	}
+	validationErr := req.Validate(h.conf)
 	if len(validationErr) != 0 {
 		return nil, validationErr
 	}
@@ -87,28 +90,19 @@ func (h *UpsertJobHandler) upsertJob(ctx context.Context, isDraft bool, req *mod
 	start := time.Now()
 	startEndTOEnd := time.Now()
 
+	prevName := ""
 	if id == "" {
-		id, err = models.GenerateID(req.Name)
-		if err != nil {
-			validationErr = append(validationErr, models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("failed to generate id for job: %s with err: %v", req.Name, err)))
-			return nil, validationErr
-		}
-		prevJob, errs := jobInfo(ctx, id, h.conf, fc)
+		id, errs = newJobID(ctx, req.Name, h.conf, fc)
 		if len(errs) != 0 {
-			if errs[0].Code != http.StatusNotFound {
-				validationErr = append(validationErr, errs...)
-				return nil, errs
-			}
-		}
-		if prevJob != nil {
-			validationErr = append(validationErr, fdk.APIError{
-				Code:    http.StatusBadRequest,
-				Message: fmt.Sprintf("job with name:%s already exist", req.Name),
-			})
-			return nil, validationErr
+			return nil, errs
 		}
 		elapsed := time.Since(start).Seconds()
 		log.Println("time elasped get job id ", elapsed)
+	} else if h.conf.JobIDStrategy == models.JobIDStrategyUUID {
+		prevName, errs = h.checkRename(ctx, id, req.Name, fc)
+		if len(errs) != 0 {
+			return nil, errs
+		}
 	}
 
 	decorateErr := h.decorateRequest(ctx, isDraft, id, &req.Job, fc)
@@ -128,14 +122,29 @@ func (h *UpsertJobHandler) upsertJob(ctx context.Context, isDraft bool, req *mod
 
 	elapsed := time.Since(start).Seconds()
 	log.Println("time elasped upsert job id ", elapsed)
+
+	if h.conf.JobIDStrategy == models.JobIDStrategyUUID && prevName != req.Name {
+		if errs = indexJobName(ctx, req.Name, jobID, h.conf, fc); len(errs) != 0 {
+			return nil, errs
+		}
+		if prevName != "" && models.JobNameKey(prevName, h.conf.FoldJobNameCase) != models.JobNameKey(req.Name, h.conf.FoldJobNameCase) {
+			// a stale entry is harmless, the names of other jobs being looked up by their own hash
+			if errs = unindexJobName(ctx, prevName, h.conf, fc); len(errs) != 0 {
+				log.Printf("failed to remove the previous name %q of job %s from the name index: %v", prevName, jobID, errs)
+			}
+		}
+	}
 	start = time.Now()
 
 	action := JobEdited
 	if req.Version == 1 {
 		action = JobCreated
 	}
+	if req.ApprovalStatus == models.ApprovalStatusPending {
+		action = JobApprovalRequested
+	}
 
-	errs = auditLogProducer(ctx, action, &req.Job, h.conf, fc)
+	errs = auditLogProducer(ctx, action, &req.Job, req.UserName, h.conf, fc)
 	if len(errs) != 0 {
 		// we do not rollback transaction if auditlogger fails
 		validationErr = append(validationErr, errs...)
@@ -151,42 +160,39 @@ func (h *UpsertJobHandler) upsertJob(ctx context.Context, isDraft bool, req *mod
 	return &models.UpsertJobResponse{Resource: jobID}, nil
 }
 
-func (h *UpsertJobHandler) decorateRequest(ctx context.Context, isDraft bool, id string, req *models.Job, fc *client.CrowdStrikeAPISpecification) []fdk.APIError {
-	if !isDraft {
-		req.WSchedule = updateSchedule(req)
-
-		recurrences := 0
-		nextRun, errNxt := models.NextRun(req.Schedule, time.Now().UTC())
-		if errNxt != nil {
-			err := models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("failed to get the next run time err: %v", errNxt))
-			return []fdk.APIError{err}
-		}
-
-		if req.Schedule.End == "" {
-			recurrences = math.MaxInt
-		}
-
-		for {
-			if recurrences == math.MaxInt || !isNextRunValid(nextRun, req.Schedule.Start, req.Schedule.End) {
-				break
-			}
-			recurrences++
-			nextRun, errNxt = models.NextRun(req.Schedule, nextRun)
-		}
-
-		req.TotalRecurrences = recurrences
-		workflowId, errs := provisionWorkflowWithAct(ctx, req, h.conf, fc)
-		if len(errs) != 0 {
-			return errs
-		}
+// checkRename returns the current name of the job with the given ID, failing if the job is renamed to the name
+// of another job.
+func (h *UpsertJobHandler) checkRename(ctx context.Context, id, name string, fc *client.CrowdStrikeAPISpecification) (string, []fdk.APIError) {
+	prevJob, errs := jobInfo(ctx, id, h.conf, fc)
+	if len(errs) != 0 {
+		return "", errs
+	}
+	if models.JobNameKey(prevJob.Name, h.conf.FoldJobNameCase) == models.JobNameKey(name, h.conf.FoldJobNameCase) {
+		return prevJob.Name, nil
+	}
+	owner, errs := indexedJobID(ctx, name, h.conf, fc)
+	if len(errs) != 0 {
+		return "", errs
+	}
+	if owner != "" && owner != id {
+		return "", []fdk.APIError{{Code: http.StatusBadRequest, Message: fmt.Sprintf("job with name:%s already exist", name)}}
+	}
+	return prevJob.Name, nil
+}
 
-		executionWorkflowID, errs := provisionWorkflowForExec(ctx, req, h.conf, workflowId, fc)
-		if len(errs) != 0 {
+func (h *UpsertJobHandler) decorateRequest(ctx context.Context, isDraft bool, id string, req *models.Job, fc *client.CrowdStrikeAPISpecification) []fdk.APIError {
+	req.ScheduleType = models.ScheduleTypeOf(req)
+	// jobs awaiting approval are saved unprovisioned, like drafts, until the ApproveJobHandler provisions them
+	pending := !isDraft && h.conf.RequireApproval
+	req.ApprovalStatus = ""
+	req.ReviewedBy, req.ReviewedAt, req.ReviewComment = "", nil, ""
+	if pending {
+		req.ApprovalStatus = models.ApprovalStatusPending
+	}
+	if !isDraft && !pending {
+		if errs := provisionJob(ctx, req, h.conf, fc); len(errs) != 0 {
 			return errs
 		}
-
-		req.Workflows = &models.WorkflowsInfo{ScheduleWorkflow: workflowId, NotifierWorkflow: executionWorkflowID}
-		req.NextRun = &nextRun
 	}
 
 	currTime := time.Now()
@@ -197,7 +203,7 @@ func (h *UpsertJobHandler) decorateRequest(ctx context.Context, isDraft bool, id
 	req.ID = id
 	req.Version = version
 	req.UpdatedAt = &currTime
-	req.Draft = isDraft
+	req.Draft = isDraft || pending
 
 	var errs []fdk.APIError
 	req.HostCount = len(req.Target.Hosts)
@@ -212,6 +218,52 @@ func (h *UpsertJobHandler) decorateRequest(ctx context.Context, isDraft bool, id
 	return errs
 }
 
+// provisionJob computes the schedule of a job and provisions its workflows.
+func provisionJob(ctx context.Context, req *models.Job, conf *models.Config, fc *client.CrowdStrikeAPISpecification) []fdk.APIError {
+	req.WSchedule = updateSchedule(req)
+	req.JitterOffset = 0
+	if req.JitterMinutes > 0 && req.ScheduleType == models.ScheduleTypeRecurring {
+		req.WSchedule.TimeCycle, req.JitterOffset = models.Jitter(req.WSchedule.TimeCycle, req.JitterMinutes)
+	}
+	// the runs of the workflow are those of the schedule delayed by the jitter offset
+	jitter := time.Duration(req.JitterOffset) * time.Minute
+
+	recurrences := 0
+	nextRun, errNxt := models.NextRun(req.Schedule, time.Now().UTC().Add(-jitter))
+	if errNxt != nil {
+		err := models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("failed to get the next run time err: %v", errNxt))
+		return []fdk.APIError{err}
+	}
+
+	if req.Schedule.End == "" {
+		recurrences = math.MaxInt
+	}
+
+	for {
+		if recurrences == math.MaxInt || !isNextRunValid(nextRun, req.Schedule.Start, req.Schedule.End) {
+			break
+		}
+		recurrences++
+		nextRun, errNxt = models.NextRun(req.Schedule, nextRun)
+	}
+
+	req.TotalRecurrences = recurrences
+	workflowId, errs := provisionWorkflowWithAct(ctx, req, conf, fc)
+	if len(errs) != 0 {
+		return errs
+	}
+
+	executionWorkflowID, errs := provisionWorkflowForExec(ctx, req, conf, workflowId, fc)
+	if len(errs) != 0 {
+		return errs
+	}
+
+	req.Workflows = &models.WorkflowsInfo{ScheduleWorkflow: workflowId, NotifierWorkflow: executionWorkflowID}
+	nextRun = nextRun.Add(jitter)
+	req.NextRun = &nextRun
+	return nil
+}
+
 // isNextRunValid check to see if next run is valid.  It has to be previousRun< Nextrun also start_time<nextrun<endtime, if so insert the next run
 func isNextRunValid(nextTime time.Time, startTime, endTime string) bool {
 	start, _ := time.Parse(time.RFC3339, startTime)
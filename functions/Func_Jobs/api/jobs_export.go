@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/Func_Jobs/api/models"
+	"github.com/crowdstrike/gofalcon/falcon/client"
+)
+
+// exportPageSize is the number of jobs looked up per search when exporting jobs.
+const exportPageSize = 100
+
+// ExportJobsHandler exports the definitions of all jobs as one document, which the ImportJobsHandler of another
+// CID or environment imports.
+type ExportJobsHandler struct {
+	conf *models.Config
+}
+
+// NewExportJobsHandler returns a new instance of ExportJobsHandler.
+func NewExportJobsHandler(conf *models.Config) *ExportJobsHandler {
+	return &ExportJobsHandler{
+		conf: conf,
+	}
+}
+
+func (h *ExportJobsHandler) Handle(ctx context.Context, request fdk.Request) fdk.Response {
+	response := fdk.Response{}
+
+	fc, err := models.FalconClient(ctx, h.conf, request)
+	if err != nil {
+		response.Code = http.StatusInternalServerError
+		response.Errors = append(response.Errors, fdk.APIError{Code: http.StatusBadRequest, Message: "fail to initialize client"})
+		return response
+	}
+
+	export, errs := h.export(ctx, fc)
+	if len(errs) != 0 {
+		response.Code = http.StatusInternalServerError
+		response.Errors = errs
+		return response
+	}
+
+	body, err := json.Marshal(export)
+	if err != nil {
+		response.Code = http.StatusInternalServerError
+		response.Errors = append(response.Errors, models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("failed to marshal the response body with err: %v", err)))
+		return response
+	}
+
+	response.Body = json.RawMessage(body)
+	response.Code = http.StatusOK
+	return response
+}
+
+// export pages through the jobs collection, returning every job which is not deleted, oldest first.
+func (h *ExportJobsHandler) export(ctx context.Context, fc *client.CrowdStrikeAPISpecification) (*models.JobsExport, []fdk.APIError) {
+	fqlFilter, err := models.NewFQLQuery([]models.Filter{{Field: "created_at", Value: "0", Op: models.GTE}})
+	if err != nil {
+		return nil, []fdk.APIError{models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("error constructing FQL query: %v", err))}
+	}
+	fqlSort, err := models.NewFQLSort("created_at", models.Asc)
+	if err != nil {
+		return nil, []fdk.APIError{models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("error constructing FQL sort: %v", err))}
+	}
+
+	exportedAt := time.Now().UTC()
+	export := models.JobsExport{
+		Version:    models.JobsExportVersion,
+		ExportedAt: &exportedAt,
+		Jobs:       make([]models.Job, 0),
+	}
+	for offset := 0; ; {
+		searchResponse, errs := search(ctx, models.SearchObjectsRequest{
+			Collection: h.conf.JobsCollection,
+			Limit:      exportPageSize,
+			Offset:     offset,
+			Sort:       fqlSort,
+			Filter:     fqlFilter,
+		}, fc)
+		if len(errs) != 0 {
+			return nil, errs
+		}
+
+		for _, id := range searchResponse.ObjectKeys {
+			job, errs := jobInfo(ctx, id, h.conf, fc)
+			if len(errs) != 0 {
+				if errs[0].Code == http.StatusNotFound {
+					// deleted since the search
+					continue
+				}
+				return nil, errs
+			}
+			if job.DeletedAt != nil {
+				continue
+			}
+			export.Jobs = append(export.Jobs, *job)
+		}
+
+		offset += len(searchResponse.ObjectKeys)
+		if len(searchResponse.ObjectKeys) == 0 || offset >= searchResponse.Total {
+			break
+		}
+	}
+	return &export, nil
+}
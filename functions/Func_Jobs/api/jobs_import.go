@@ -0,0 +1,270 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/Func_Jobs/api/models"
+	"github.com/crowdstrike/gofalcon/falcon/client"
+	"github.com/crowdstrike/gofalcon/falcon/client/real_time_response_admin"
+)
+
+// JobImported is the audited action of jobs created or updated by an import.
+const JobImported ActionTaken = "Imported"
+
+// ImportJobsHandler creates or updates, by ID, the jobs of a document exported by the ExportJobsHandler.  Every job
+// is validated before any is saved, so an import with an invalid job saves none.
+//
+// Imported jobs are saved as drafts: their workflows, runs and reviews belong to the CID they were exported from,
+// so they are provisioned, or approved, once imported, e.g. by the upsert-job endpoint.
+type ImportJobsHandler struct {
+	conf *models.Config
+}
+
+// NewImportJobsHandler returns a new instance of ImportJobsHandler.
+func NewImportJobsHandler(conf *models.Config) *ImportJobsHandler {
+	return &ImportJobsHandler{
+		conf: conf,
+	}
+}
+
+// jobImport is a job of an import, and the job it replaces, if any.
+type jobImport struct {
+	job      models.Job
+	existing *models.Job
+}
+
+func (h *ImportJobsHandler) Handle(ctx context.Context, request fdk.Request) fdk.Response {
+	response := fdk.Response{}
+
+	var req models.JobsExport
+	err := json.Unmarshal(request.Body, &req)
+	if err != nil {
+		response.Code = http.StatusBadRequest
+		response.Errors = append(response.Errors, models.NewAPIError(http.StatusBadRequest, fmt.Sprintf("Failed to unmarshal Request body err: %v.", err)))
+		return response
+	}
+	if req.Version > models.JobsExportVersion {
+		response.Code = http.StatusBadRequest
+		response.Errors = append(response.Errors, models.NewAPIError(http.StatusBadRequest, fmt.Sprintf("unsupported export version %d, at most %d is supported", req.Version, models.JobsExportVersion)))
+		return response
+	}
+	if len(req.Jobs) == 0 {
+		response.Code = http.StatusBadRequest
+		response.Errors = append(response.Errors, models.NewAPIError(http.StatusBadRequest, "jobs cannot be empty"))
+		return response
+	}
+
+	var caller models.Caller
+	if len(request.Context) > 0 {
+		_ = json.Unmarshal(request.Context, &caller)
+	}
+
+	fc, err := models.FalconClient(ctx, h.conf, request)
+	if err != nil {
+		response.Code = http.StatusInternalServerError
+		response.Errors = append(response.Errors, fdk.APIError{Code: http.StatusBadRequest, Message: "fail to initialize client"})
+		return response
+	}
+
+	result, code := h.importJobs(ctx, req.Jobs, caller, fc)
+	body, err := json.Marshal(result)
+	if err != nil {
+		response.Code = http.StatusInternalServerError
+		response.Errors = append(response.Errors, models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("failed to marshal the response body with err: %v", err)))
+		return response
+	}
+
+	if code != http.StatusOK {
+		response.Errors = append(response.Errors, models.NewAPIError(code, "failed to import jobs, see the errors of each job"))
+	}
+	response.Body = json.RawMessage(body)
+	response.Code = code
+	return response
+}
+
+// importJobs validates then saves jobs, returning the outcome of each and the status code of the import.
+func (h *ImportJobsHandler) importJobs(ctx context.Context, jobs []models.Job, caller models.Caller, fc *client.CrowdStrikeAPISpecification) (*models.ImportJobsResponse, int) {
+	result := models.ImportJobsResponse{Resources: make([]models.ImportedJob, len(jobs))}
+	imports := make([]jobImport, len(jobs))
+	putFiles := make(map[string]bool)
+	names, ids := make(map[string]int), make(map[string]int)
+	valid := true
+	for i, j := range jobs {
+		imports[i], result.Resources[i].Errors = h.prepare(ctx, j, putFiles, fc)
+		result.Resources[i].ID, result.Resources[i].Name = imports[i].job.ID, imports[i].job.Name
+
+		key := models.JobNameKey(imports[i].job.Name, h.conf.FoldJobNameCase)
+		if k, ok := names[key]; ok {
+			result.Resources[i].Errors = append(result.Resources[i].Errors, models.NewAPIError(http.StatusBadRequest, fmt.Sprintf("job name:%s is also that of job %d of the import", j.Name, k+1)))
+		}
+		names[key] = i
+		if id := imports[i].job.ID; id != "" {
+			if k, ok := ids[id]; ok {
+				result.Resources[i].Errors = append(result.Resources[i].Errors, models.NewAPIError(http.StatusBadRequest, fmt.Sprintf("job id:%s is also that of job %d of the import", id, k+1)))
+			}
+			ids[id] = i
+		}
+		valid = valid && len(result.Resources[i].Errors) == 0
+	}
+	if !valid {
+		return &result, http.StatusBadRequest
+	}
+
+	code := http.StatusOK
+	for i := range imports {
+		action, errs := h.save(ctx, &imports[i], caller, fc)
+		result.Resources[i].ID, result.Resources[i].Action, result.Resources[i].Errors = imports[i].job.ID, action, errs
+		if len(errs) != 0 {
+			code = http.StatusInternalServerError
+		}
+	}
+	return &result, code
+}
+
+// prepare validates a job to import, resetting what belongs to the CID it was exported from, and looks up the job
+// it replaces.  putFiles caches whether the put files referenced by jobs exist.
+func (h *ImportJobsHandler) prepare(ctx context.Context, j models.Job, putFiles map[string]bool, fc *client.CrowdStrikeAPISpecification) (jobImport, []fdk.APIError) {
+	j.Draft = true
+	j.Workflows, j.WSchedule, j.NextRun, j.LastRun = nil, nil, nil, nil
+	j.TotalRecurrences, j.RunCount, j.JitterOffset = 0, 0, 0
+	j.ApprovalStatus, j.ReviewedBy, j.ReviewedAt, j.ReviewComment = "", "", nil, ""
+	j.BaselineExecutionID = ""
+	j.RunNow = false
+	j.DeletedAt = nil
+	// the names of jobs with hash IDs are left as they are, as their ID may be the hash of the raw name
+	if j.ID == "" || h.conf.JobIDStrategy == models.JobIDStrategyUUID {
+		j.Name = models.NormalizeJobName(j.Name)
+	}
+	j.ScheduleType = models.ScheduleTypeOf(&j)
+
+	ji := jobImport{job: j}
+	req := models.UpsertJobRequest{Job: j}
+	errs := req.Validate(h.conf)
+	errs = append(errs, h.checkPutFiles(ctx, &j, putFiles, fc)...)
+	if len(errs) != 0 {
+		return ji, errs
+	}
+
+	if j.ID == "" {
+		ji.job.ID, errs = newJobID(ctx, j.Name, h.conf, fc)
+		return ji, errs
+	}
+
+	existing, errs := jobInfo(ctx, j.ID, h.conf, fc)
+	if len(errs) != 0 && errs[0].Code != http.StatusNotFound {
+		return ji, errs
+	}
+	if existing != nil && existing.DeletedAt == nil {
+		if !existing.Draft && existing.Workflows != nil && existing.Workflows.ScheduleWorkflow != "" {
+			return ji, []fdk.APIError{models.NewValidationError(models.InvalidJobUpdateOperation, fmt.Sprintf("once job:%s id:%s schedule it cannot be updated", existing.Name, existing.ID))}
+		}
+		ji.existing = existing
+	}
+	if h.conf.JobIDStrategy == models.JobIDStrategyUUID {
+		owner, errs := indexedJobID(ctx, j.Name, h.conf, fc)
+		if len(errs) != 0 {
+			return ji, errs
+		}
+		if owner != "" && owner != j.ID {
+			return ji, []fdk.APIError{{Code: http.StatusBadRequest, Message: fmt.Sprintf("job with name:%s already exist", j.Name)}}
+		}
+	}
+	return ji, nil
+}
+
+// checkPutFiles returns an error for each put file installed by a job which is missing from the CID.
+func (h *ImportJobsHandler) checkPutFiles(ctx context.Context, j *models.Job, putFiles map[string]bool, fc *client.CrowdStrikeAPISpecification) []fdk.APIError {
+	actions := []*models.RTRAction{j.Action}
+	for _, s := range j.Steps {
+		actions = append(actions, s.Action)
+	}
+
+	var errs []fdk.APIError
+	for _, a := range actions {
+		if a == nil || a.Type != models.InstallSoftware || a.FileName == "" {
+			continue
+		}
+		exists, ok := putFiles[a.FileName]
+		if !ok {
+			var lookupErrs []fdk.APIError
+			if exists, lookupErrs = putFileExists(ctx, a.FileName, fc); len(lookupErrs) != 0 {
+				errs = append(errs, lookupErrs...)
+				continue
+			}
+			putFiles[a.FileName] = exists
+		}
+		if !exists {
+			errs = append(errs, models.NewValidationError(models.InvalidFileReference, fmt.Sprintf("put file %s does not exist, it must be uploaded before the job is imported", a.FileName)))
+		}
+	}
+	return errs
+}
+
+// putFileExists returns true if there is an RTR put file named name.
+func putFileExists(ctx context.Context, name string, fc *client.CrowdStrikeAPISpecification) (bool, []fdk.APIError) {
+	filter := fmt.Sprintf("name:'%s'", models.EscapeFQLValue(name))
+	params := real_time_response_admin.NewRTRListPutFilesParamsWithContext(ctx)
+	params.SetFilter(&filter)
+	resp, err := fc.RealTimeResponseAdmin.RTRListPutFiles(params)
+	if err != nil {
+		return false, []fdk.APIError{models.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("failed to query put file %s: %v", name, err))}
+	}
+	return len(resp.GetPayload().Resources) != 0, nil
+}
+
+// save creates or updates an imported job, returning the audited action.
+func (h *ImportJobsHandler) save(ctx context.Context, ji *jobImport, caller models.Caller, fc *client.CrowdStrikeAPISpecification) (string, []fdk.APIError) {
+	j := &ji.job
+	currTime := time.Now()
+	j.Version, j.CreatedAt, j.UpdatedAt = 1, &currTime, &currTime
+	prevName := ""
+	if ji.existing != nil {
+		j.Version = ji.existing.Version + 1
+		j.CreatedAt = ji.existing.CreatedAt
+		prevName = ji.existing.Name
+	}
+
+	var errs []fdk.APIError
+	j.HostCount = len(j.Target.Hosts)
+	if len(j.Target.HostGroups) != 0 {
+		j.HostCount, errs = getDeviceCountForHostGroup(ctx, j.Target.HostGroups, fc)
+		if len(errs) != 0 {
+			return "", errs
+		}
+	}
+
+	if _, errs = putJob(ctx, j, h.conf, fc); len(errs) != 0 {
+		return "", errs
+	}
+
+	if h.conf.JobIDStrategy == models.JobIDStrategyUUID && prevName != j.Name {
+		if errs = indexJobName(ctx, j.Name, j.ID, h.conf, fc); len(errs) != 0 {
+			return "", errs
+		}
+		if prevName != "" && models.JobNameKey(prevName, h.conf.FoldJobNameCase) != models.JobNameKey(j.Name, h.conf.FoldJobNameCase) {
+			// a stale entry is harmless, the names of other jobs being looked up by their own hash
+			if errs = unindexJobName(ctx, prevName, h.conf, fc); len(errs) != 0 {
+				log.Printf("failed to remove the previous name %q of job %s from the name index: %v", prevName, j.ID, errs)
+			}
+		}
+	}
+
+	actor := caller.UserName
+	if actor == "" {
+		actor = j.UserName
+	}
+	if errs = auditLogProducer(ctx, JobImported, j, actor, h.conf, fc); len(errs) != 0 {
+		return "", errs
+	}
+
+	if ji.existing != nil {
+		return string(JobEdited), nil
+	}
+	return string(JobCreated), nil
+}
@@ -9,16 +9,42 @@ import (
 	"github.com/crowdstrike/gofalcon/falcon/client"
 )
 
+// Job ID strategies, see Config.JobIDStrategy.
+const (
+	// JobIDStrategyHash derives the ID of jobs from the hash of their name, so jobs cannot be renamed.
+	JobIDStrategyHash = "hash"
+	// JobIDStrategyUUID gives jobs random IDs, which are indexed by name in the JobNamesCollection so that
+	// job_history can resolve the job of a workflow event.  Jobs can be renamed while they are drafts.
+	JobIDStrategyUUID = "uuid"
+)
+
 type Config struct {
 	Cloud                           falcon.CloudType
 	JobsCollection                  string
 	AuditLogsCollection             string
+	JobNamesCollection              string
 	RemoveSystemWorkflowTemplateID  string
 	RemoveConditionNodeID           string
 	InstallSystemWorkflowTemplateID string
 	InstallConditionNodeID          string
+	RunScriptWorkflowTemplateID     string
+	RunScriptConditionNodeID        string
 	BuildQSystemWorkflowTemplateID  string
 	ExecutionNotifierWorkflow       string
+	// CompositeWorkflowTemplateID is the template of the workflows of composite jobs, which run the steps of the
+	// job in order.  Composite jobs can only be saved as drafts without one.
+	CompositeWorkflowTemplateID string
+	CompositeConditionNodeID    string
+	// RequireApproval makes new and edited jobs wait for approval before their workflows are provisioned.
+	RequireApproval bool
+	// ApproverRoles are the roles allowed to approve or reject jobs.
+	ApproverRoles []string
+	// JobIDStrategy is how the IDs of new jobs are generated, one of the JobIDStrategy constants.  It must match
+	// the JOB_ID_STRATEGY of job_history.
+	JobIDStrategy string
+	// FoldJobNameCase makes job names which only differ by case the same name.  It must match the
+	// JOB_NAME_CASE_FOLDING of job_history.
+	FoldJobNameCase bool
 }
 
 // FalconClient returns a new instance of the GoFalcon client.
@@ -48,6 +48,11 @@ type Filter struct {
 	Op Operator
 }
 
+// EscapeFQLValue escapes the backslashes and single quotes of a value, so it can be quoted in an FQL filter.
+func EscapeFQLValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(value)
+}
+
 // NewFQLQuery constructs a new FQL query, and-ing all the filter arguments together.
 func NewFQLQuery(filters []Filter) (string, error) {
 	if len(filters) == 0 {
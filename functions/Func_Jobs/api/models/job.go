@@ -1,13 +1,18 @@
 package models
 
 import (
+	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"net/url"
+	"slices"
+	"strings"
 	"time"
 
 	fdk "github.com/CrowdStrike/foundry-fn-go"
-	"github.com/robfig/cron/v3"
 	"github.com/spaolacci/murmur3"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
 )
 
 const (
@@ -15,6 +20,34 @@ const (
 	DateFormat                        = "%02d-%02d-%d" // 8-28-2023
 	InstallSoftware        ActionType = "installSoftware"
 	RemoveFile             ActionType = "removeFile"
+	RunScript              ActionType = "runScript"
+	// Composite is the action type of composite jobs, which run the actions of their steps.
+	Composite ActionType = "composite"
+)
+
+const (
+	// ScheduleTypeNow is the schedule type of jobs which run immediately.
+	ScheduleTypeNow = "now"
+	// ScheduleTypeOnce is the schedule type of jobs which run once at their start date.
+	ScheduleTypeOnce = "once"
+	// ScheduleTypeRecurring is the schedule type of jobs which run according to a time cycle.
+	ScheduleTypeRecurring = "recurring"
+)
+
+const (
+	// ApprovalStatusPending is the approval status of jobs awaiting approval before their workflows are provisioned.
+	ApprovalStatusPending = "pending_approval"
+	// ApprovalStatusApproved is the approval status of approved jobs.
+	ApprovalStatusApproved = "approved"
+	// ApprovalStatusRejected is the approval status of rejected jobs, which are never provisioned.
+	ApprovalStatusRejected = "rejected"
+)
+
+const (
+	// OverlapPolicySkip records executions exceeding the maximum concurrent runs of a job as skipped.
+	OverlapPolicySkip = "skip"
+	// OverlapPolicyQueue queues executions exceeding the maximum concurrent runs of a job until a running one finishes.
+	OverlapPolicyQueue = "queue"
 )
 
 // ActionType determines the type of activity the job needs to do
@@ -72,30 +105,71 @@ type JobResponse struct {
 
 // Job holds the information regarding the job
 type Job struct {
-	UserID           string         `json:"user_id" description:"UserID is the ID of the user who submitted the request."`
-	UserName         string         `json:"user_name" description:"UserName is the username or email of the user who submitted the request."`
-	ID               string         `json:"id,omitempty" description:"ID identifies a job"`
-	Name             string         `json:"name" description:"Name is the name of the job."`
-	Description      string         `json:"description,omitempty" description:"Description is the description of the job."`
-	Version          int            `json:"version" description:"Version of the job"`
-	Draft            bool           `json:"draft" description:"Draft indicates if the the job provisioned or not."`
-	Notifications    []string       `json:"notifications" description:"Notifications is a list of email addresses to notify regarding this job."`
-	Tags             []string       `json:"tags" description:"Tags is a list of tags to assign to this job."`
-	HostCount        int            `json:"host_count" description:"HostCount gives estimates number of host targeted for this job."`
-	Action           *RTRAction     `json:"action" description:"Handle contains information about the RTR put file or command."`
-	Schedule         *Schedule      `json:"schedule" description:"Schedule defines when this job should execute."`
-	WSchedule        *Schedule      `json:"wschedule" description:"Schedule defines when this job should execute in workflow format.""`
-	Target           *TargetHost    `json:"target" description:"Target defines the systems against which the action should be performed."`
-	Workflows        *WorkflowsInfo `json:"workflows" description:"Workflows created for this job"`
-	RunNow           bool           `json:"run_now" description:"Indicates if we need to run the workflow now."`
-	TotalRecurrences int            `json:"total_recurrences" description:"TotalRecurrences is number of times job needs to be run."`
-	RunCount         int            `json:"run_count" description:"RunCount is number of time job has ran."`
-	NextRun          *time.Time     `json:"next_run,omitempty" description:"NextRun indicates the next time the job will run."`
-	LastRun          *time.Time     `json:"last_run,omitempty" description:"LastRun indicates the last time the job ran."`
-	OutputFormat     []string       `json:"output_format" description:"OutputFormat determines the user expecting the output format to be in."`
-	CreatedAt        *time.Time     `json:"created_at,omitempty" description:"CreatedAt indicates the time at which job was created."`
-	UpdatedAt        *time.Time     `json:"updated_at,omitempty" description:"UpdatedAt indicates the time at which jon was updated last."`
-	DeletedAt        *time.Time     `json:"deleted_at,omitempty" description:"DeletedAt indicates the time at which job was deleted"`
+	UserID              string               `json:"user_id" description:"UserID is the ID of the user who submitted the request."`
+	UserName            string               `json:"user_name" description:"UserName is the username or email of the user who submitted the request."`
+	ID                  string               `json:"id,omitempty" description:"ID identifies a job"`
+	Name                string               `json:"name" description:"Name is the name of the job."`
+	Aliases             []string             `json:"aliases,omitempty" description:"Aliases are the previous names of a job renamed by job_history, which its workflows may still report."`
+	BaselineExecutionID string               `json:"baseline_execution_id,omitempty" description:"BaselineExecutionID is the ID of the execution marked by job_history as the baseline which later executions of the job are checked against."`
+	Description         string               `json:"description,omitempty" description:"Description is the description of the job."`
+	Version             int                  `json:"version" description:"Version of the job"`
+	Draft               bool                 `json:"draft" description:"Draft indicates if the the job provisioned or not."`
+	ApprovalStatus      string               `json:"approval_status,omitempty" description:"ApprovalStatus is pending_approval, approved or rejected when jobs require approval before they are provisioned."`
+	ReviewedBy          string               `json:"reviewed_by,omitempty" description:"ReviewedBy is the username or email of the user who approved or rejected the job."`
+	ReviewedAt          *time.Time           `json:"reviewed_at,omitempty" description:"ReviewedAt indicates the time at which the job was approved or rejected."`
+	ReviewComment       string               `json:"review_comment,omitempty" description:"ReviewComment is the comment given when the job was approved or rejected."`
+	Notifications       []string             `json:"notifications" description:"Notifications is a list of email addresses to notify regarding this job."`
+	NotificationTargets []NotificationTarget `json:"notification_targets,omitempty" description:"NotificationTargets is a list of webhooks and workflows to notify when an execution of this job completes or fails."`
+	CallbackURL         string               `json:"callback_url,omitempty" description:"CallbackURL is the URL to which a signed summary is POSTed whenever an execution of this job changes status."`
+	Ticketing           *Ticketing           `json:"ticketing,omitempty" description:"Ticketing configures the ticket job_history opens in an ITSM system when an execution of this job fails."`
+	Tags                []string             `json:"tags" description:"Tags is a list of tags to assign to this job."`
+	HostCount           int                  `json:"host_count" description:"HostCount gives estimates number of host targeted for this job."`
+	Action              *RTRAction           `json:"action" description:"Handle contains information about the RTR put file or command."`
+	Steps               []JobStep            `json:"steps,omitempty" description:"Steps are the ordered actions of a composite job, which has no action of its own."`
+	Schedule            *Schedule            `json:"schedule" description:"Schedule defines when this job should execute."`
+	WSchedule           *Schedule            `json:"wschedule" description:"Schedule defines when this job should execute in workflow format.""`
+	Target              *TargetHost          `json:"target" description:"Target defines the systems against which the action should be performed."`
+	Workflows           *WorkflowsInfo       `json:"workflows" description:"Workflows created for this job"`
+	RunNow              bool                 `json:"run_now" description:"Indicates if we need to run the workflow now."`
+	ScheduleType        string               `json:"schedule_type,omitempty" description:"ScheduleType is derived from the schedule and is one of now, once or recurring."`
+	Paused              bool                 `json:"paused,omitempty" description:"Paused indicates that executions of the job are skipped until it is resumed."`
+	MaxConcurrentRuns   int                  `json:"max_concurrent_runs,omitempty" description:"MaxConcurrentRuns is the maximum number of executions of the job which may run at the same time, or 0 for no limit."`
+	OverlapPolicy       string               `json:"overlap_policy,omitempty" description:"OverlapPolicy determines whether executions exceeding MaxConcurrentRuns are skipped or queued."`
+	SLA                 *SLA                 `json:"sla,omitempty" description:"SLA defines the objectives which finished executions of the job are expected to meet."`
+	Rollout             *Rollout             `json:"rollout,omitempty" description:"Rollout configures the rollout of the job to its target hosts in waves, started with the rollouts endpoint of job_history."`
+	MaintenanceWindow   *MaintenanceWindow   `json:"maintenance_window,omitempty" description:"MaintenanceWindow restricts the executions of the job to the given days and hours, executions triggered outside it being deferred until it opens."`
+	JitterMinutes       int                  `json:"jitter_minutes,omitempty" description:"JitterMinutes is the window within which each run of a recurring job is delayed by a random number of minutes, so that jobs sharing a time cycle do not all start at once.  Runs stay in the hour they are scheduled in."`
+	JitterOffset        int                  `json:"jitter_offset_minutes,omitempty" description:"JitterOffset is the delay in minutes of the runs of the job, chosen within JitterMinutes when its workflow is provisioned."`
+	TotalRecurrences    int                  `json:"total_recurrences" description:"TotalRecurrences is number of times job needs to be run."`
+	RunCount            int                  `json:"run_count" description:"RunCount is number of time job has ran."`
+	NextRun             *time.Time           `json:"next_run,omitempty" description:"NextRun indicates the next time the job will run."`
+	LastRun             *time.Time           `json:"last_run,omitempty" description:"LastRun indicates the last time the job ran."`
+	OutputFormat        []string             `json:"output_format" description:"OutputFormat determines the user expecting the output format to be in."`
+	CreatedAt           *time.Time           `json:"created_at,omitempty" description:"CreatedAt indicates the time at which job was created."`
+	UpdatedAt           *time.Time           `json:"updated_at,omitempty" description:"UpdatedAt indicates the time at which jon was updated last."`
+	DeletedAt           *time.Time           `json:"deleted_at,omitempty" description:"DeletedAt indicates the time at which job was deleted"`
+}
+
+// ActionType returns the type of the action of the job, Composite if it has steps, or a blank type if it has no
+// action.
+func (j Job) ActionType() ActionType {
+	switch {
+	case len(j.Steps) > 0:
+		return Composite
+	case j.Action == nil:
+		return ""
+	}
+	return j.Action.Type
+}
+
+// MaxJobSteps is the maximum number of steps of a composite job.
+const MaxJobSteps = 10
+
+// JobStep is a step of a composite job.  The steps of a job run in order, each reporting its results to
+// job_history, which rolls them up into the execution of the job.
+type JobStep struct {
+	Name   string     `json:"name,omitempty" description:"Name describes the step, e.g. verify."`
+	Action *RTRAction `json:"action" description:"Action is the RTR action run by the step."`
 }
 
 // RTRAction indicates the RTR action the job needs to do.
@@ -103,6 +177,19 @@ type RTRAction struct {
 	Type ActionType `json:"type" description:"Type indicates the type of activity the job needs to run."`
 	InstallSoftwareAction
 	RemoveFileAction
+	RunScriptAction
+}
+
+func (action RTRAction) validate() []fdk.APIError {
+	switch action.Type.String() {
+	case InstallSoftware.String():
+		return action.InstallSoftwareAction.validate()
+	case RemoveFile.String():
+		return action.RemoveFileAction.validate()
+	case RunScript.String():
+		return action.RunScriptAction.validate()
+	}
+	return []fdk.APIError{NewValidationError(InvalidActionType, fmt.Sprintf("invalid action type: %s", action.Type.String()))}
 }
 
 // InstallSoftwareAction contains the file path to be install on a sensor.
@@ -139,19 +226,34 @@ func (action RemoveFileAction) validate() []fdk.APIError {
 	return errs
 }
 
+// RunScriptAction contains the custom RTR script to be run on the sensor.
+type RunScriptAction struct {
+	ScriptContent string `json:"script_content" description:"ScriptContent is the PowerShell script to be run on the sensor."`
+	ScriptArgs    string `json:"script_args" description:"ScriptArgs are the arguments passed to the script."`
+}
+
+func (action RunScriptAction) validate() []fdk.APIError {
+	var errs []fdk.APIError
+	if strings.TrimSpace(action.ScriptContent) == "" {
+		errs = append(errs, NewValidationError(InvalidActionConfig, "script content cannot be empty"))
+	}
+	return errs
+}
+
 // TargetHost is the list of hostgroups/host the job needs to run against.
 type TargetHost struct {
 	HostGroups      []string `json:"host_groups" description:"HostGroups indicates the list of host groups."`
 	Hosts           []string `json:"hosts" description:"Hosts indicates the list of host."`
 	OfflineQueueing bool     `json:"offline_queueing" description:"OfflineQueueing indicates if need to target host which are offline."`
+	Platforms       []string `json:"platforms,omitempty" description:"Platforms indicates the platforms of the hosts the job runs on (Windows, Linux or Mac). Hosts of other platforms are skipped."`
 }
 
 // Schedule contains the cron job expression along with start and end date for the job.
 type Schedule struct {
-	TimeCycle      string `json:"time_cycle" description:"A time cycle element specifies repeating intervals, and can be specified using using cron expressions."`
+	TimeCycle      string `json:"time_cycle" description:"A time cycle element specifies repeating intervals, and can be specified using cron expressions, optionally with a seconds field, or descriptors such as @hourly and @every 30m."`
 	Start          string `json:"start_date,omitempty" description:"Start date in mm-dd-yyyy format"`
 	End            string `json:"end_date,omitempty" description:"End date in mm-dd-yyyy format"`
-	Timezone       string `json:"-" description:"Timezone label from IANA timezone database, for example, America/Los_Angeles"`
+	Timezone       string `json:"timezone,omitempty" description:"Timezone label from IANA timezone database, for example, America/Los_Angeles. Defaults to UTC."`
 	SkipConcurrent bool   `json:"skip_concurrent" description:"Flag indicating if concurrent execution of scheduled workflow should be skipped or not"`
 }
 
@@ -161,11 +263,178 @@ type WorkflowsInfo struct {
 	NotifierWorkflow string `json:"notifier_workflow" description:"NotifierWorkflow is the main workflow which notifies when the schedule workflow has run on all sensor."`
 }
 
+// SLA holds the objectives which finished executions of a job are expected to meet.  Executions breaching them are
+// flagged by job_history.
+type SLA struct {
+	MaxDurationSeconds int     `json:"max_duration_seconds,omitempty" description:"MaxDurationSeconds is the maximum duration of an execution, or 0 for no limit."`
+	MinSuccessRate     float64 `json:"min_success_rate,omitempty" description:"MinSuccessRate is the minimum fraction, from 0 to 1, of the hosts with results on which an execution succeeded, or 0 for no minimum."`
+}
+
+// Rollout configures the rollout of a job to its target hosts in waves.  job_history halts the remaining waves
+// once the failure rate of the hosts exceeds the abort threshold.
+type Rollout struct {
+	BatchSize        int     `json:"batch_size" description:"BatchSize is the maximum number of hosts of each wave."`
+	WaitSeconds      int     `json:"wait_seconds,omitempty" description:"WaitSeconds is the time to wait between the end of a wave and the start of the next."`
+	AbortFailureRate float64 `json:"abort_failure_rate,omitempty" description:"AbortFailureRate is the fraction, from 0 to 1, of the hosts with results on which the rollout may fail before its remaining waves are halted, or 0 to never halt it."`
+}
+
+// MaintenanceWindow restricts the executions of a job to the given days and hours.  job_history records the
+// executions triggered outside the window as deferred and runs them once it opens.
+type MaintenanceWindow struct {
+	Days     []string `json:"days,omitempty" description:"Days are the days of the week on which the window opens, as mon, tue, wed, thu, fri, sat or sun.  The window opens every day if empty."`
+	Start    string   `json:"start" description:"Start is the time of day, as HH:MM, at which the window opens."`
+	End      string   `json:"end" description:"End is the time of day, as HH:MM, at which the window closes.  Windows ending at or before their start close on the following day."`
+	Timezone string   `json:"timezone,omitempty" description:"Timezone label from IANA timezone database, for example, America/Los_Angeles. Defaults to UTC."`
+}
+
+// weekdays are the names of the days of the week of maintenance windows.
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+func (w MaintenanceWindow) validate() []fdk.APIError {
+	var errs []fdk.APIError
+	for _, d := range w.Days {
+		if !slices.Contains(weekdays, d) {
+			errs = append(errs, NewValidationError(InvalidMaintenanceWindow, fmt.Sprintf("invalid maintenance window day %q, must be one of %s", d, strings.Join(weekdays, ", "))))
+		}
+	}
+	if _, err := time.Parse("15:04", w.Start); err != nil {
+		errs = append(errs, NewValidationError(InvalidMaintenanceWindow, fmt.Sprintf("invalid maintenance window start %q, must be HH:MM", w.Start)))
+	}
+	if _, err := time.Parse("15:04", w.End); err != nil {
+		errs = append(errs, NewValidationError(InvalidMaintenanceWindow, fmt.Sprintf("invalid maintenance window end %q, must be HH:MM", w.End)))
+	}
+	if w.Timezone != "" {
+		if _, err := time.LoadLocation(w.Timezone); err != nil {
+			errs = append(errs, NewValidationError(InvalidMaintenanceWindow, fmt.Sprintf("invalid maintenance window timezone %q: %v", w.Timezone, err)))
+		}
+	}
+	return errs
+}
+
+func (r Rollout) validate() []fdk.APIError {
+	var errs []fdk.APIError
+	if r.BatchSize < 1 {
+		errs = append(errs, NewValidationError(InvalidRollout, "rollout batch size must be at least 1"))
+	}
+	if r.WaitSeconds < 0 {
+		errs = append(errs, NewValidationError(InvalidRollout, "rollout wait seconds cannot be negative"))
+	}
+	if r.AbortFailureRate < 0 || r.AbortFailureRate > 1 {
+		errs = append(errs, NewValidationError(InvalidRollout, fmt.Sprintf("invalid rollout abort failure rate %v, must be between 0 and 1", r.AbortFailureRate)))
+	}
+	return errs
+}
+
+func (s SLA) validate() []fdk.APIError {
+	var errs []fdk.APIError
+	if s.MaxDurationSeconds < 0 {
+		errs = append(errs, NewValidationError(InvalidSLA, "sla max duration cannot be negative"))
+	}
+	if s.MinSuccessRate < 0 || s.MinSuccessRate > 1 {
+		errs = append(errs, NewValidationError(InvalidSLA, fmt.Sprintf("invalid sla min success rate %v, must be between 0 and 1", s.MinSuccessRate)))
+	}
+	return errs
+}
+
+// NotificationTarget is a webhook or workflow notified of the executions of a job.
+type NotificationTarget struct {
+	Type       string   `json:"type" description:"Type is either webhook or workflow."`
+	URL        string   `json:"url,omitempty" description:"URL is the URL to which a webhook target's payload is POSTed."`
+	WorkflowID string   `json:"workflow_id,omitempty" description:"WorkflowID is the definition ID of a workflow target."`
+	Statuses   []string `json:"statuses,omitempty" description:"Statuses are the execution statuses which trigger a notification. Defaults to Completed, CompletedWithErrors and Failed."`
+}
+
+func (t NotificationTarget) validate() []fdk.APIError {
+	var errs []fdk.APIError
+	switch t.Type {
+	case "webhook":
+		if !isHTTPURL(t.URL) {
+			errs = append(errs, NewValidationError(InvalidNotificationTarget, fmt.Sprintf("invalid webhook url: %s", t.URL)))
+		}
+	case "workflow":
+		if t.WorkflowID == "" {
+			errs = append(errs, NewValidationError(InvalidNotificationTarget, "workflow id cannot be empty"))
+		}
+	default:
+		errs = append(errs, NewValidationError(InvalidNotificationTarget, fmt.Sprintf("invalid notification target type: %s", t.Type)))
+	}
+	return errs
+}
+
+// Ticketing configures the REST endpoints through which job_history opens a ticket when an execution of a job
+// fails, and updates it while the job keeps failing and once it completes again.
+type Ticketing struct {
+	URL       string   `json:"url" description:"URL is the URL to which new tickets are POSTed."`
+	UpdateURL string   `json:"update_url,omitempty" description:"UpdateURL is the URL to which ticket updates are PATCHed, in which {id} is replaced with the ID of the ticket.  Defaults to URL followed by /{id}."`
+	Statuses  []string `json:"statuses,omitempty" description:"Statuses are the execution statuses for which a ticket is opened. Defaults to CompletedWithErrors, Failed and TimedOut."`
+}
+
+func (t Ticketing) validate() []fdk.APIError {
+	var errs []fdk.APIError
+	if !isHTTPURL(t.URL) {
+		errs = append(errs, NewValidationError(InvalidNotificationTarget, fmt.Sprintf("invalid ticketing url: %s", t.URL)))
+	}
+	if t.UpdateURL != "" && !isHTTPURL(strings.ReplaceAll(t.UpdateURL, "{id}", "id")) {
+		errs = append(errs, NewValidationError(InvalidNotificationTarget, fmt.Sprintf("invalid ticketing update url: %s", t.UpdateURL)))
+	}
+	return errs
+}
+
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != ""
+}
+
 // UpsertJobRequest holds info of the job.
 type UpsertJobRequest struct {
 	Job
 }
 
+// JobsExportVersion is the version of the format of exported jobs.
+const JobsExportVersion = 1
+
+// JobsExport is a document holding the definitions of jobs, exported from one CID or environment to be imported
+// into another.
+type JobsExport struct {
+	Version    int        `json:"version" description:"Version is the version of the format of the document."`
+	ExportedAt *time.Time `json:"exported_at,omitempty" description:"ExportedAt indicates the time at which the jobs were exported."`
+	Jobs       []Job      `json:"jobs" description:"Jobs is the list of exported jobs."`
+}
+
+// ImportJobsResponse holds the outcome of importing each job of an export document, in the order of the document.
+type ImportJobsResponse struct {
+	Resources []ImportedJob `json:"resources" description:"Resources is the outcome of importing each job."`
+}
+
+// ImportedJob is the outcome of importing a job.
+type ImportedJob struct {
+	ID     string         `json:"id,omitempty" description:"ID identifies the imported job."`
+	Name   string         `json:"name" description:"Name is the name of the job."`
+	Action string         `json:"action,omitempty" description:"Action indicates if the job was created or updated."`
+	Errors []fdk.APIError `json:"errors,omitempty" description:"Errors are the reasons the job could not be imported."`
+}
+
+// ApproveJobRequest holds the decision on a job pending approval.
+type ApproveJobRequest struct {
+	ID      string `json:"id" description:"ID identifies the job."`
+	Approve bool   `json:"approve" description:"Approve is true to approve and provision the job, false to reject it."`
+	Comment string `json:"comment,omitempty" description:"Comment explains the decision."`
+}
+
+// Caller is the identity of the user making a request, read from the request context.
+type Caller struct {
+	UserID   string   `json:"user_id"`
+	UserName string   `json:"user_name"`
+	Roles    []string `json:"roles"`
+}
+
+// JobNameResponse holds the response when checking whether a job name is available.
+type JobNameResponse struct {
+	Name      string `json:"name" description:"Name is the normalized name."`
+	Available bool   `json:"available" description:"Available is true if no job has the name."`
+	JobID     string `json:"job_id,omitempty" description:"JobID is the ID of the job which has the name."`
+}
+
 // UpsertJobResponse holds the response when querying a job.
 type UpsertJobResponse struct {
 	Resource string `json:"resource" description:""`
@@ -189,10 +458,19 @@ const (
 	InvalidJobTarget
 	InvalidActionType
 	InvalidActionConfig
+	InvalidNotificationTarget
+	InvalidConcurrencyLimit
+	InvalidSLA
+	InvalidJobSteps
+	InvalidRollout
+	InvalidMaintenanceWindow
+	InvalidJitter
+	InvalidFileReference
 )
 
-// Validate returns back any errors present in
-func (ujr *UpsertJobRequest) Validate() []fdk.APIError {
+// Validate returns back any errors present in the request.  Jobs can only be renamed with UUID IDs, see
+// JobIDStrategyUUID, or by the rename_job endpoint of job_history, which records their aliases.
+func (ujr *UpsertJobRequest) Validate(conf *Config) []fdk.APIError {
 	var errs []fdk.APIError
 
 	if ujr.Name == "" {
@@ -203,12 +481,58 @@ func (ujr *UpsertJobRequest) Validate() []fdk.APIError {
 		errs = append(errs, NewValidationError(NotificationEmailsRequired, "notication emails cannot be empty"))
 	}
 
-	if ujr.ID != "" {
-		id, err := GenerateID(ujr.Name)
+	for _, t := range ujr.NotificationTargets {
+		errs = append(errs, t.validate()...)
+	}
+
+	if ujr.CallbackURL != "" && !isHTTPURL(ujr.CallbackURL) {
+		errs = append(errs, NewValidationError(InvalidNotificationTarget, fmt.Sprintf("invalid callback url: %s", ujr.CallbackURL)))
+	}
+
+	if ujr.Ticketing != nil {
+		errs = append(errs, ujr.Ticketing.validate()...)
+	}
+
+	if ujr.MaxConcurrentRuns < 0 {
+		errs = append(errs, NewValidationError(InvalidConcurrencyLimit, "max concurrent runs cannot be negative"))
+	}
+
+	switch ujr.OverlapPolicy {
+	case "", OverlapPolicySkip, OverlapPolicyQueue:
+	default:
+		errs = append(errs, NewValidationError(InvalidConcurrencyLimit, fmt.Sprintf("invalid overlap policy %q, must be %q or %q", ujr.OverlapPolicy, OverlapPolicySkip, OverlapPolicyQueue)))
+	}
+
+	if ujr.SLA != nil {
+		errs = append(errs, ujr.SLA.validate()...)
+	}
+
+	if ujr.Rollout != nil {
+		errs = append(errs, ujr.Rollout.validate()...)
+	}
+
+	if ujr.MaintenanceWindow != nil {
+		errs = append(errs, ujr.MaintenanceWindow.validate()...)
+	}
+
+	if ujr.JitterMinutes < 0 || ujr.JitterMinutes > MaxJitterMinutes {
+		errs = append(errs, NewValidationError(InvalidJitter, fmt.Sprintf("invalid jitter minutes %d, must be between 0 and %d", ujr.JitterMinutes, MaxJitterMinutes)))
+	}
+
+	if ujr.ID != "" && conf.JobIDStrategy != JobIDStrategyUUID {
+		id, err := GenerateID(JobNameKey(ujr.Name, conf.FoldJobNameCase))
 		if err != nil {
 			errs = append(errs, NewValidationError(JobIDGenerationFailure, fmt.Sprintf("failed to generate id for job: %v", err)))
 		}
-		if id != ujr.ID {
+		// jobs created before names were normalized have the hash of their raw name as ID, and renamed jobs the
+		// hash of one of their aliases
+		valid := id == ujr.ID
+		for _, n := range append([]string{ujr.Name}, ujr.Aliases...) {
+			legacyID, _ := GenerateID(n)
+			aliasID, _ := GenerateID(JobNameKey(n, conf.FoldJobNameCase))
+			valid = valid || legacyID == ujr.ID || aliasID == ujr.ID
+		}
+		if !valid {
 			errs = append(errs, NewValidationError(JobNameChangedError, "job name cannot be changed"))
 		}
 	}
@@ -218,9 +542,16 @@ func (ujr *UpsertJobRequest) Validate() []fdk.APIError {
 	}
 
 	if ujr.Schedule != nil {
+		tzErr := false
+		if ujr.Schedule.Timezone != "" {
+			if _, err := time.LoadLocation(ujr.Schedule.Timezone); err != nil {
+				tzErr = true
+				errs = append(errs, NewValidationError(JobScheduleIsIncorrect, fmt.Sprintf("invalid schedule timezone %q: %v", ujr.Schedule.Timezone, err)))
+			}
+		}
 		// Time cycle is empty for schedule once
-		if ujr.Schedule.TimeCycle != "" {
-			_, err := cron.ParseStandard(ujr.Schedule.TimeCycle)
+		if ujr.Schedule.TimeCycle != "" && !tzErr {
+			_, err := ParseSchedule(ujr.Schedule)
 			if err != nil {
 				errs = append(errs, NewValidationError(JobScheduleIsIncorrect, fmt.Sprintf("invalid schedule cron expression: %v", err)))
 			}
@@ -255,23 +586,46 @@ func (ujr *UpsertJobRequest) Validate() []fdk.APIError {
 		if len(ujr.Target.Hosts) == 0 && len(ujr.Target.HostGroups) == 0 {
 			errs = append(errs, NewValidationError(InvalidJobTarget, "must have target host or groups"))
 		}
+		for _, pl := range ujr.Target.Platforms {
+			switch pl {
+			case "Windows", "Linux", "Mac":
+			default:
+				errs = append(errs, NewValidationError(InvalidJobTarget, fmt.Sprintf("invalid platform: %s", pl)))
+			}
+		}
 	}
 
-	if ujr.Action == nil {
+	switch {
+	case len(ujr.Steps) > 0:
+		errs = append(errs, ujr.validateSteps()...)
+	case ujr.Action == nil:
 		errs = append(errs, NewValidationError(InvalidActionType, "action cannot be empty"))
+	default:
+		errs = append(errs, ujr.Action.validate()...)
 	}
 
+	return errs
+}
+
+// validateSteps returns the errors of the steps of a composite job.
+func (ujr *UpsertJobRequest) validateSteps() []fdk.APIError {
+	var errs []fdk.APIError
 	if ujr.Action != nil {
-		switch ujr.Action.Type.String() {
-		case InstallSoftware.String():
-			errs = append(errs, ujr.Action.InstallSoftwareAction.validate()...)
-		case RemoveFile.String():
-			errs = append(errs, ujr.Action.RemoveFileAction.validate()...)
-		default:
-			errs = append(errs, NewValidationError(InvalidActionType, fmt.Sprintf("invalid action type: %s", ujr.Action.Type.String())))
+		errs = append(errs, NewValidationError(InvalidJobSteps, "composite jobs cannot have an action of their own"))
+	}
+	if len(ujr.Steps) > MaxJobSteps {
+		errs = append(errs, NewValidationError(InvalidJobSteps, fmt.Sprintf("composite jobs cannot have more than %d steps", MaxJobSteps)))
+	}
+	for i, st := range ujr.Steps {
+		if st.Action == nil {
+			errs = append(errs, NewValidationError(InvalidJobSteps, fmt.Sprintf("step %d: action cannot be empty", i+1)))
+			continue
+		}
+		for _, err := range st.Action.validate() {
+			err.Message = fmt.Sprintf("step %d: %s", i+1, err.Message)
+			errs = append(errs, err)
 		}
 	}
-
 	return errs
 }
 
@@ -297,8 +651,35 @@ func GenerateID(key string) (string, error) {
 	return hex.EncodeToString(b.Sum(nil)), nil
 }
 
+// NormalizeJobName returns the canonical form of a job name: trimmed and in Unicode normalization form C, so that
+// names which are typed differently but read the same are the same name.
+func NormalizeJobName(name string) string {
+	return norm.NFC.String(strings.TrimSpace(name))
+}
+
+// JobNameKey returns the key identifying a job name, from which the ID of the job is derived: the normalized
+// name, case folded if foldCase is true.  It must match the key computed by job_history.
+func JobNameKey(name string, foldCase bool) string {
+	key := NormalizeJobName(name)
+	if foldCase {
+		key = cases.Fold().String(key)
+	}
+	return key
+}
+
+// NewUUID returns a random (version 4) UUID.
+func NewUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
 func NextRun(schedule *Schedule, startTime time.Time) (time.Time, error) {
-	nxtSchedule, err := cron.ParseStandard(fmt.Sprintf("TZ=%s %s", schedule.Timezone, schedule.TimeCycle))
+	nxtSchedule, err := ParseSchedule(schedule)
 	if err != nil {
 		return time.Now(), err
 	}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// scheduleParser accepts standard 5-field cron expressions, 6-field expressions with a leading seconds field
+// and descriptors such as @hourly and @every 30m.
+var scheduleParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// descriptors maps the fixed cron descriptors to their standard cron expressions.
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// NormalizeTimeCycle converts a time cycle into the standard 5-field cron expression with which the schedule
+// workflow is provisioned.  Workflow schedules have minute resolution, so expressions with a seconds field are
+// only accepted if they fire on the minute, and @every intervals must divide an hour or a day evenly.
+func NormalizeTimeCycle(timeCycle string) (string, error) {
+	tc := strings.TrimSpace(timeCycle)
+	if _, err := scheduleParser.Parse(tc); err != nil {
+		return "", err
+	}
+
+	if expr, ok := descriptors[strings.ToLower(tc)]; ok {
+		return expr, nil
+	}
+	if strings.HasPrefix(strings.ToLower(tc), "@every ") {
+		return everyAsCron(strings.TrimSpace(tc[len("@every "):]))
+	}
+
+	fields := strings.Fields(tc)
+	if len(fields) == 6 {
+		if fields[0] != "0" {
+			return "", fmt.Errorf("schedules have minute resolution, seconds field must be 0: %s", tc)
+		}
+		fields = fields[1:]
+	}
+	return strings.Join(fields, " "), nil
+}
+
+func everyAsCron(interval string) (string, error) {
+	d, err := time.ParseDuration(interval)
+	if err != nil {
+		return "", fmt.Errorf("invalid @every interval: %v", err)
+	}
+	switch {
+	case d < time.Minute || d%time.Minute != 0:
+		return "", fmt.Errorf("@every interval must be a whole number of minutes: %s", interval)
+	case d < time.Hour && time.Hour%d == 0:
+		return fmt.Sprintf("*/%d * * * *", d/time.Minute), nil
+	case d == 24*time.Hour:
+		return descriptors["@daily"], nil
+	case d < 24*time.Hour && d%time.Hour == 0 && (24*time.Hour)%d == 0:
+		return fmt.Sprintf("0 */%d * * *", d/time.Hour), nil
+	}
+	return "", fmt.Errorf("@every interval must divide an hour or a day evenly: %s", interval)
+}
+
+// ParseSchedule parses the normalized time cycle of the schedule in its timezone, or UTC if it has none.
+func ParseSchedule(schedule *Schedule) (cron.Schedule, error) {
+	tc, err := NormalizeTimeCycle(schedule.TimeCycle)
+	if err != nil {
+		return nil, err
+	}
+	tz := schedule.Timezone
+	if tz == "" {
+		tz = time.UTC.String()
+	}
+	return scheduleParser.Parse(fmt.Sprintf("CRON_TZ=%s %s", tz, tc))
+}
+
+// MaxJitterMinutes is the largest jitter window of a job.  Runs are only delayed within the hour they are
+// scheduled in.
+const MaxJitterMinutes = 59
+
+// Jitter delays the runs of a normalized time cycle by a random number of minutes, at most window, by shifting its
+// minute field.  The delay is bounded so that runs stay in the hour they are scheduled in, and only minute fields
+// which are a number, a list of numbers or a step of every minute, e.g. */15, are shifted.  The shifted time cycle
+// and the delay in minutes are returned.
+func Jitter(timeCycle string, window int) (string, int) {
+	fields := strings.Fields(timeCycle)
+	if len(fields) != 5 || window <= 0 {
+		return timeCycle, 0
+	}
+
+	if step, ok := strings.CutPrefix(fields[0], "*/"); ok {
+		n, err := strconv.Atoi(step)
+		if err != nil || n < 2 {
+			return timeCycle, 0
+		}
+		delay := rand.Intn(min(window, n-1) + 1)
+		if delay > 0 {
+			fields[0] = fmt.Sprintf("%d-59/%d", delay, n)
+		}
+		return strings.Join(fields, " "), delay
+	}
+
+	minutes := strings.Split(fields[0], ",")
+	last := 0
+	for _, m := range minutes {
+		n, err := strconv.Atoi(m)
+		if err != nil {
+			return timeCycle, 0
+		}
+		last = max(last, n)
+	}
+	delay := rand.Intn(min(window, 59-last) + 1)
+	for i, m := range minutes {
+		n, _ := strconv.Atoi(m)
+		minutes[i] = strconv.Itoa(n + delay)
+	}
+	fields[0] = strings.Join(minutes, ",")
+	return strings.Join(fields, " "), delay
+}
+
+// ScheduleTypeOf returns the schedule type of the job.  It must be called before the schedule of a job which
+// runs now or once is given its time cycle.
+func ScheduleTypeOf(j *Job) string {
+	switch {
+	case j.RunNow:
+		return ScheduleTypeNow
+	case j.Schedule == nil || j.Schedule.TimeCycle == "":
+		return ScheduleTypeOnce
+	}
+	return ScheduleTypeRecurring
+}
@@ -21,8 +21,11 @@ import (
 )
 
 const (
-	JobCreated ActionTaken = "Created"
-	JobEdited  ActionTaken = "Updated"
+	JobCreated           ActionTaken = "Created"
+	JobEdited            ActionTaken = "Updated"
+	JobApprovalRequested ActionTaken = "Approval requested"
+	JobApproved          ActionTaken = "Approved"
+	JobRejected          ActionTaken = "Rejected"
 
 	deviceHostGroups = "groups"
 )
@@ -30,7 +33,8 @@ const (
 // ActionTaken enumerates the list of action taken on job
 type ActionTaken string
 
-func auditLogProducer(ctx context.Context, event ActionTaken, req *models.Job, conf *models.Config, fc *client.CrowdStrikeAPISpecification) []fdk.APIError {
+// auditLogProducer records an action taken on a job by the user named actor.
+func auditLogProducer(ctx context.Context, event ActionTaken, req *models.Job, actor string, conf *models.Config, fc *client.CrowdStrikeAPISpecification) []fdk.APIError {
 	var errs []fdk.APIError
 	logId := fmt.Sprintf("%d%s", time.Now().UnixNano(), req.ID)
 
@@ -42,7 +46,7 @@ func auditLogProducer(ctx context.Context, event ActionTaken, req *models.Job, c
 		JobName:    req.Name,
 		ModifiedAt: req.UpdatedAt,
 		Version:    req.Version,
-		ModifiedBy: req.UserName,
+		ModifiedBy: actor,
 		Action:     string(event),
 		JobID:      req.ID,
 		ID:         logId,
@@ -316,7 +320,31 @@ func provisionWorkflowWithAct(ctx context.Context, req *models.Job, conf *models
 		Fields: []*model.ParameterConditionFieldProvisionParameter{},
 	}
 
-	switch req.Action.Type {
+	switch req.ActionType() {
+	case models.Composite:
+		if conf.CompositeWorkflowTemplateID == "" {
+			return "", []fdk.APIError{models.NewValidationError(models.InvalidJobSteps, "no composite workflow template is configured, composite jobs can only be saved as drafts")}
+		}
+		steps, err := json.Marshal(req.Steps)
+		if err != nil {
+			return "", []fdk.APIError{{
+				Code:    http.StatusInternalServerError,
+				Message: fmt.Sprintf("failed to serialize job steps: %v", err),
+			}}
+		}
+		runStepsNodeID := "run_job_steps_9d41c2e6"
+		runSteps := model.ParameterActivityConfigProvisionParameter{
+			NodeID: &runStepsNodeID,
+			Properties: map[string]interface{}{
+				"steps": string(steps),
+			},
+		}
+
+		conditionForHostAndGroupsName.NodeID = &conf.CompositeConditionNodeID
+
+		reqBody.Parameters.Activities.Configuration = append(reqBody.Parameters.Activities.Configuration, &runSteps)
+		reqBody.TemplateName = &conf.CompositeWorkflowTemplateID
+
 	case models.RemoveFile:
 		removeNodeID := "remove_file_rtr_2_65337911"
 		removeFile := model.ParameterActivityConfigProvisionParameter{
@@ -355,10 +383,25 @@ func provisionWorkflowWithAct(ctx context.Context, req *models.Job, conf *models
 		reqBody.Parameters.Activities.Configuration = append(reqBody.Parameters.Activities.Configuration, &installSoft)
 		reqBody.TemplateName = &conf.InstallSystemWorkflowTemplateID
 
+	case models.RunScript:
+		runScriptNodeID := "run_script_rtr_2_3f6a9c41"
+		runScript := model.ParameterActivityConfigProvisionParameter{
+			NodeID: &runScriptNodeID,
+			Properties: map[string]interface{}{
+				"scriptContent": req.Action.RunScriptAction.ScriptContent,
+				"scriptArgs":    req.Action.RunScriptAction.ScriptArgs,
+			},
+		}
+
+		conditionForHostAndGroupsName.NodeID = &conf.RunScriptConditionNodeID
+
+		reqBody.Parameters.Activities.Configuration = append(reqBody.Parameters.Activities.Configuration, &runScript)
+		reqBody.TemplateName = &conf.RunScriptWorkflowTemplateID
+
 	default:
 		return "", []fdk.APIError{{
 			Code:    http.StatusInternalServerError,
-			Message: fmt.Sprintf("Handle type is incorrect %s", req.Action.Type.String()),
+			Message: fmt.Sprintf("Handle type is incorrect %s", req.ActionType().String()),
 		}}
 	}
 
@@ -499,7 +542,8 @@ func updateSchedule(req *models.Job) *models.Schedule {
 		schedule.End = fmt.Sprintf(models.DateFormat, endTime.Month(), endTime.Day(), endTime.Year())
 	}
 
-	schedule.TimeCycle = req.Schedule.TimeCycle
+	// The workflow schedule only understands standard cron, the time cycle has already been validated.
+	schedule.TimeCycle, _ = models.NormalizeTimeCycle(req.Schedule.TimeCycle)
 	schedule.Timezone = req.Schedule.Timezone
 	schedule.SkipConcurrent = false
 
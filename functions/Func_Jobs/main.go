@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"os"
+	"strings"
 
 	fdk "github.com/CrowdStrike/foundry-fn-go"
 	api2 "github.com/Crowdstrike/foundry-sample-rapid-response/functions/Func_Jobs/api"
@@ -16,11 +17,27 @@ const (
 	getJob          = "/job"
 	getListOfJob    = "/jobs"
 	getListOfAudits = "/audits"
+	approveJob      = "/approve-job"
+	checkJobName    = "/job-name"
+	exportJobs      = "/jobs/export"
+	importJobs      = "/jobs/import"
 )
 
 var (
 	logger      logrus.FieldLogger
 	falconCloud falcon.CloudType
+	// requireApproval and approverRoles are set with the REQUIRE_JOB_APPROVAL and comma-separated
+	// JOB_APPROVER_ROLES environment variables.
+	requireApproval bool
+	approverRoles   = []string{"approver"}
+	// jobIDStrategy is set with the JOB_ID_STRATEGY environment variable, which must match that of job_history.
+	jobIDStrategy = models.JobIDStrategyHash
+	// foldJobNameCase is set with the JOB_NAME_CASE_FOLDING environment variable, which must match that of
+	// job_history.
+	foldJobNameCase bool
+	// compositeWorkflowTemplate is set with the COMPOSITE_WORKFLOW_TEMPLATE environment variable, naming the
+	// workflow template which runs the steps of composite jobs.
+	compositeWorkflowTemplate string
 )
 
 func doInit(cloud string) {
@@ -29,6 +46,24 @@ func doInit(cloud string) {
 	logger = l
 
 	falconCloud = falcon.Cloud(cloud)
+
+	if os.Getenv("REQUIRE_JOB_APPROVAL") != "" {
+		requireApproval = true
+	}
+	if s := os.Getenv("JOB_APPROVER_ROLES"); s != "" {
+		approverRoles = strings.Split(s, ",")
+	}
+	compositeWorkflowTemplate = os.Getenv("COMPOSITE_WORKFLOW_TEMPLATE")
+	if os.Getenv("JOB_NAME_CASE_FOLDING") != "" {
+		foldJobNameCase = true
+	}
+	switch s := os.Getenv("JOB_ID_STRATEGY"); s {
+	case "":
+	case models.JobIDStrategyHash, models.JobIDStrategyUUID:
+		jobIDStrategy = s
+	default:
+		logger.Errorf("ignoring unknown JOB_ID_STRATEGY %q", s)
+	}
 }
 
 func handler(context.Context, fdk.SkipCfg) fdk.Handler {
@@ -36,23 +71,40 @@ func handler(context.Context, fdk.SkipCfg) fdk.Handler {
 		Cloud:                           falconCloud,
 		JobsCollection:                  "Jobs_Info",
 		AuditLogsCollection:             "Jobs_Audit_logger",
+		JobNamesCollection:              "Job_Names",
 		RemoveSystemWorkflowTemplateID:  "Remove file template",
 		ExecutionNotifierWorkflow:       "Notify job execution template",
 		InstallSystemWorkflowTemplateID: "Install software template",
 		RemoveConditionNodeID:           "platform_is_equal_to_windows_hostname_includes_to_parameterized_host_groups_includes_to_parameterize_831608b0",
 		InstallConditionNodeID:          "FROM_platform_is_equal_to_windows_hostname_includes_to_parameterized_host_groups_includes_to_parameterize_831608b0_TO_activity_check_file_exist_rtr_2_e7dcae9e",
+		RunScriptWorkflowTemplateID:     "Run script template",
+		RunScriptConditionNodeID:        "platform_is_equal_to_windows_hostname_includes_to_parameterized_host_groups_includes_to_parameterize_5e0c71d2",
+		CompositeWorkflowTemplateID:     compositeWorkflowTemplate,
+		CompositeConditionNodeID:        "hostname_includes_to_parameterized_host_groups_includes_to_parameterize_2c5e8a17",
+		RequireApproval:                 requireApproval,
+		ApproverRoles:                   approverRoles,
+		JobIDStrategy:                   jobIDStrategy,
+		FoldJobNameCase:                 foldJobNameCase,
 	}
 
 	upsertJobHandler := api2.NewUpsertJobHandler(&conf)
 	jobHandler := api2.NewJobHandler(&conf)
 	jobsHandler := api2.NewJobsHandler(&conf)
 	auditsHandler := api2.NewAuditsHandler(&conf)
+	approveJobHandler := api2.NewApproveJobHandler(&conf)
+	jobNameHandler := api2.NewJobNameHandler(&conf)
+	exportJobsHandler := api2.NewExportJobsHandler(&conf)
+	importJobsHandler := api2.NewImportJobsHandler(&conf)
 
 	mux := fdk.NewMux()
 	mux.Get(getJob, jobHandler)
 	mux.Get(getListOfAudits, auditsHandler)
 	mux.Get(getListOfJob, jobsHandler)
 	mux.Put(upsertJob, upsertJobHandler)
+	mux.Post(approveJob, approveJobHandler)
+	mux.Get(checkJobName, jobNameHandler)
+	mux.Get(exportJobs, exportJobsHandler)
+	mux.Post(importJobs, importJobsHandler)
 	return mux
 }
 
@@ -0,0 +1,58 @@
+package alertc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/workflowc"
+	"github.com/sirupsen/logrus"
+)
+
+// AlertC is a Falcon alerts client interface.
+type AlertC interface {
+	// Raise raises the alert in the Falcon console.
+	Raise(ctx context.Context, a Alert) error
+}
+
+// Client is the client.  The Falcon alerts API only queries and updates alerts, so alerts are raised by executing
+// a Fusion workflow with the alert as its payload, whose actions create the detection in the console queue.
+type Client struct {
+	definitionID string
+	logger       logrus.FieldLogger
+	wfc          workflowc.WorkflowC
+}
+
+var _ AlertC = (*Client)(nil)
+
+// NewClient returns a new alerts client raising alerts through the workflow definition with the given ID.
+func NewClient(wfc workflowc.WorkflowC, definitionID string, logger logrus.FieldLogger) *Client {
+	return &Client{
+		definitionID: definitionID,
+		logger:       logger,
+		wfc:          wfc,
+	}
+}
+
+func (c *Client) Raise(ctx context.Context, a Alert) error {
+	if c.definitionID == "" {
+		return errors.New("missing alerting workflow ID")
+	}
+	payload, err := json.Marshal(a)
+	if err != nil {
+		return fmt.Errorf("failed to serialize alert: %s", err)
+	}
+	resp, err := c.wfc.Execute(ctx, workflowc.ExecuteRequest{
+		DefinitionID: c.definitionID,
+		Payload:      payload,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to execute alerting workflow: %w", err)
+	}
+	c.logger.WithField("execution_id", a.ExecutionID).
+		WithField("alert_execution_id", resp.ExecutionID).
+		WithField("severity", a.Severity).
+		Info("alert raised")
+	return nil
+}
@@ -0,0 +1,41 @@
+package alertc
+
+// Severities of alerts, in the vocabulary of the Falcon console.
+const (
+	SeverityCritical = "critical"
+	SeverityHigh     = "high"
+)
+
+// Alert is an alert raised for a job execution which failed on too many hosts.
+type Alert struct {
+	// Description summarizes the failure for the analysts triaging the alert.
+	Description string `json:"description"`
+	// ExecutionID is the workflow execution ID of the failed execution.
+	ExecutionID string `json:"execution_id"`
+	// FailedHosts are the hosts on which the execution failed.
+	FailedHosts []FailedHost `json:"failed_hosts"`
+	// FailurePercent is the percentage of the targeted hosts on which the execution failed.
+	FailurePercent float64 `json:"failure_percent"`
+	// JobID is the ID of the job.
+	JobID string `json:"job_id"`
+	// JobName is the name of the job.
+	JobName string `json:"job_name"`
+	// Name is the name of the alert.
+	Name string `json:"name"`
+	// Severity is one of the Severity constants.
+	Severity string `json:"severity"`
+	// Status is the status of the execution.
+	Status string `json:"status"`
+	// TargetedHosts is the number of hosts the execution ran against.
+	TargetedHosts int `json:"targeted_hosts"`
+}
+
+// FailedHost is a host on which an execution failed.
+type FailedHost struct {
+	// DeviceID is the ID of the device.
+	DeviceID string `json:"device_id"`
+	// Error is a description of why execution failed on the host.
+	Error string `json:"error,omitempty"`
+	// HostName is the name of the device.
+	HostName string `json:"host_name"`
+}
@@ -0,0 +1,95 @@
+package auditc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+)
+
+// Collection is the default name of the collection holding the audit records.
+const Collection = "Audit_Trail"
+
+// AuditC is an audit trail writer interface.
+type AuditC interface {
+	// Write appends a record to the audit trail, returning it with its ID and timestamp set.
+	Write(ctx context.Context, r Record) (Record, error)
+}
+
+// Client is the client.
+type Client struct {
+	clock      pkg.Clock
+	collection string
+	strgc      storagec.StorageC
+}
+
+var _ AuditC = (*Client)(nil)
+
+// NewClient returns a new audit trail client writing to the given storage client.
+func NewClient(strgc storagec.StorageC, opts ...func(c *Client)) *Client {
+	c := &Client{
+		clock:      pkg.SystemClock,
+		collection: Collection,
+		strgc:      strgc,
+	}
+
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// WithCollection makes the Client write the audit records to the named collection instead of Collection.
+func WithCollection(name string) func(c *Client) {
+	return func(c *Client) {
+		if name != "" {
+			c.collection = name
+		}
+	}
+}
+
+func (c *Client) Write(ctx context.Context, r Record) (Record, error) {
+	now := c.clock.Now()
+	if r.Timestamp == "" {
+		r.Timestamp = now.Format(pkg.ISOTimeFormat)
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return Record{}, fmt.Errorf("failed to generate audit record ID: %s", err)
+	}
+	// records are never overwritten, so every record gets a new key
+	r.ID = fmt.Sprintf("%d_%s", now.UnixNano(), hex.EncodeToString(suffix))
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return Record{}, fmt.Errorf("failed to serialize audit record: %s", err)
+	}
+	_, err = c.strgc.PutObject(ctx, storagec.PutObjectRequest{
+		Collection: c.collection,
+		Data:       data,
+		ObjectKey:  r.ID,
+	})
+	if err != nil {
+		return Record{}, fmt.Errorf("failed to save audit record: %s", err)
+	}
+	return r, nil
+}
+
+type actorKey struct{}
+
+// WithActor returns a copy of ctx carrying the actor recorded by AuditedStorage.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor carried by ctx, or "system" if there is none.
+func ActorFromContext(ctx context.Context) string {
+	if a, ok := ctx.Value(actorKey{}).(string); ok && a != "" {
+		return a
+	}
+	return "system"
+}
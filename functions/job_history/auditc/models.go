@@ -0,0 +1,30 @@
+package auditc
+
+const (
+	// ActionCreate is the action of a record for an object which did not exist.
+	ActionCreate = "create"
+	// ActionDelete is the action of a record for a deleted object.
+	ActionDelete = "delete"
+	// ActionUpdate is the action of a record for an object which was overwritten.
+	ActionUpdate = "update"
+)
+
+// Record is an immutable record of a single mutation of a stored object.
+type Record struct {
+	// Action is one of ActionCreate, ActionDelete or ActionUpdate.
+	Action string `json:"action"`
+	// Actor is the user or system which caused the mutation.
+	Actor string `json:"actor"`
+	// AfterHash is the SHA-256 hash of the object after the mutation.  It is blank for deletions.
+	AfterHash string `json:"after_hash,omitempty"`
+	// BeforeHash is the SHA-256 hash of the object before the mutation.  It is blank for creations.
+	BeforeHash string `json:"before_hash,omitempty"`
+	// Collection is the name of the collection containing the object.
+	Collection string `json:"collection"`
+	// ID is the ID of the audit record.
+	ID string `json:"id"`
+	// ObjectKey is the key of the object.
+	ObjectKey string `json:"object_key"`
+	// Timestamp is the time at which the mutation took place.
+	Timestamp string `json:"timestamp"`
+}
@@ -0,0 +1,110 @@
+package auditc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/sirupsen/logrus"
+)
+
+// AuditedStorage is a StorageC which appends a record to the audit trail for every object it puts or deletes
+// in the audited collections.  Reads are passed through.
+type AuditedStorage struct {
+	storagec.StorageC
+	collections map[string]struct{}
+	logger      logrus.FieldLogger
+	w           AuditC
+}
+
+var _ storagec.StorageC = (*AuditedStorage)(nil)
+
+// NewAuditedStorage wraps strgc, auditing mutations of the given collections through w.
+func NewAuditedStorage(strgc storagec.StorageC, w AuditC, collections []string, logger logrus.FieldLogger) *AuditedStorage {
+	cs := make(map[string]struct{}, len(collections))
+	for _, c := range collections {
+		cs[c] = struct{}{}
+	}
+	return &AuditedStorage{
+		StorageC:    strgc,
+		collections: cs,
+		logger:      logger,
+		w:           w,
+	}
+}
+
+func (a *AuditedStorage) DeleteObject(ctx context.Context, req storagec.DeleteObjectRequest) error {
+	if !a.audited(req.Collection) {
+		return a.StorageC.DeleteObject(ctx, req)
+	}
+
+	before := a.currentVersion(ctx, req.Collection, req.ObjectKey)
+	if err := a.StorageC.DeleteObject(ctx, req); err != nil {
+		return err
+	}
+	a.write(ctx, Record{
+		Action:     ActionDelete,
+		BeforeHash: before,
+		Collection: req.Collection,
+		ObjectKey:  req.ObjectKey,
+	})
+	return nil
+}
+
+func (a *AuditedStorage) PutObject(ctx context.Context, req storagec.PutObjectRequest) (storagec.StoredObject, error) {
+	if !a.audited(req.Collection) {
+		return a.StorageC.PutObject(ctx, req)
+	}
+
+	before := req.IfVersion
+	if before == "" {
+		before = a.currentVersion(ctx, req.Collection, req.ObjectKey)
+	}
+	so, err := a.StorageC.PutObject(ctx, req)
+	if err != nil {
+		return so, err
+	}
+	action := ActionUpdate
+	if before == "" {
+		action = ActionCreate
+	}
+	a.write(ctx, Record{
+		Action:     action,
+		AfterHash:  so.Version,
+		BeforeHash: before,
+		Collection: req.Collection,
+		ObjectKey:  req.ObjectKey,
+	})
+	return so, nil
+}
+
+func (a *AuditedStorage) audited(collection string) bool {
+	_, ok := a.collections[collection]
+	return ok
+}
+
+// currentVersion returns the version of the stored object, or a blank string if it does not exist.
+func (a *AuditedStorage) currentVersion(ctx context.Context, collection, objectKey string) string {
+	cur, err := a.StorageC.FetchObject(ctx, storagec.FetchObjectRequest{
+		Collection: collection,
+		ObjectKey:  objectKey,
+	})
+	if err != nil && !errors.Is(err, storagec.NotFound) {
+		a.logger.WithField("object_key", objectKey).
+			WithField("collection", collection).
+			Errorf("failed to fetch object version for audit record: %s", err)
+	}
+	return cur.Version
+}
+
+// write appends the record to the audit trail.  Like the audit logs of jobs, a failure to write the audit
+// record is logged rather than rolling back the mutation.
+func (a *AuditedStorage) write(ctx context.Context, r Record) {
+	r.Actor = ActorFromContext(ctx)
+	if _, err := a.w.Write(ctx, r); err != nil {
+		a.logger.WithField("object_key", r.ObjectKey).
+			WithField("collection", r.Collection).
+			WithField("action", r.Action).
+			Error(err.Error())
+	}
+}
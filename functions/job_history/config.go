@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/processor"
+)
+
+// appConfig is the deployment configuration of the function, read from the JSON file named by the
+// CS_FN_CONFIG_PATH environment variable, like the configuration of other Foundry functions.  Its profiles let one
+// binary be promoted from dev to staging to production: the profile named by the APP_PROFILE environment variable
+// overrides the settings of the base configuration.  For example:
+//
+//	{
+//	  "collections": {"jobs": "Jobs_Info"},
+//	  "profiles": {
+//	    "staging": {
+//	      "collections": {"jobs": "Jobs_Info_Staging", "job_executions": "Job_Executions_Staging"},
+//	      "saved_searches": {"default": {"execution_results": ["Staging Query By WorkflowRootExecutionID"]}}
+//	    }
+//	  }
+//	}
+type appConfig struct {
+	envConfig
+	Profiles map[string]envConfig `json:"profiles,omitempty"`
+}
+
+// envConfig are the settings of an environment.  Blank collection names keep the default collection.
+type envConfig struct {
+	Collections   processor.Collections `json:"collections"`
+	SavedSearches json.RawMessage       `json:"saved_searches,omitempty"`
+}
+
+// loadConfig reads the configuration file at path, returning the settings of the named profile.  A missing file
+// or blank path is an empty configuration, so deployments without one keep the defaults.
+func loadConfig(path, profile string) (envConfig, error) {
+	var ac appConfig
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return envConfig{}, fmt.Errorf("failed to read config: %w", err)
+		}
+		if len(b) > 0 {
+			if err = json.Unmarshal(b, &ac); err != nil {
+				return envConfig{}, fmt.Errorf("failed to decode config: %w", err)
+			}
+		}
+	}
+	if profile == "" {
+		return ac.envConfig, nil
+	}
+
+	p, ok := ac.Profiles[profile]
+	if !ok {
+		names := make([]string, 0, len(ac.Profiles))
+		for n := range ac.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return envConfig{}, fmt.Errorf("unknown profile %q, expected one of %v", profile, names)
+	}
+	ec := envConfig{
+		Collections:   ac.Collections.Merge(p.Collections),
+		SavedSearches: ac.SavedSearches,
+	}
+	if len(p.SavedSearches) > 0 {
+		ec.SavedSearches = p.SavedSearches
+	}
+	return ec, nil
+}
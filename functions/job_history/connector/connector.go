@@ -0,0 +1,186 @@
+package connector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/eapache/go-resiliency/retrier"
+	"github.com/sirupsen/logrus"
+)
+
+// maxResponseSize bounds the response bodies read from the ticketing system.
+const maxResponseSize = 1 << 20
+
+// Connector opens and updates tickets in an ITSM system, e.g. ServiceNow or Jira.
+type Connector interface {
+	// CreateTicket opens a ticket, returning its reference.
+	CreateTicket(ctx context.Context, t Ticket) (TicketRef, error)
+	// UpdateTicket updates the ticket with the given reference.
+	UpdateTicket(ctx context.Context, ref TicketRef, t Ticket) error
+}
+
+// WebhookConnector is a Connector over generic REST webhooks: tickets are POSTed as JSON to create them and
+// PATCHed to update them.  The ID of a created ticket is read from the "id", "key", "sys_id" or "number" field of
+// the response, also looked up in its "result" object as returned by the ServiceNow table API, and its URL from
+// the "url" or "self" field.
+type WebhookConnector struct {
+	backoff []time.Duration
+	cfg     WebhookConfig
+	hc      *http.Client
+	logger  logrus.FieldLogger
+}
+
+var _ Connector = (*WebhookConnector)(nil)
+
+// NewWebhookConnector returns a new Connector requesting the endpoints of cfg with hc.
+func NewWebhookConnector(hc *http.Client, cfg WebhookConfig, logger logrus.FieldLogger) *WebhookConnector {
+	if cfg.UpdateURL == "" {
+		cfg.UpdateURL = strings.TrimSuffix(cfg.CreateURL, "/") + "/{id}"
+	}
+	return &WebhookConnector{
+		backoff: retrier.ExponentialBackoff(3, 500*time.Millisecond),
+		cfg:     cfg,
+		hc:      hc,
+		logger:  logger,
+	}
+}
+
+func (c *WebhookConnector) CreateTicket(ctx context.Context, t Ticket) (TicketRef, error) {
+	if c.cfg.CreateURL == "" {
+		return TicketRef{}, errors.New("missing ticket URL")
+	}
+	var ref TicketRef
+	// creations are only retried when the ticketing system throttled the request, so that tickets whose
+	// creation timed out are not opened twice
+	err := c.do(ctx, http.MethodPost, c.cfg.CreateURL, t, func(resp *http.Response) error {
+		var err error
+		ref, err = ticketRef(resp.Body)
+		return err
+	}, false)
+	if err != nil {
+		return TicketRef{}, err
+	}
+	c.logger.WithField("execution_id", t.ExecutionID).
+		WithField("ticket_id", ref.ID).
+		Info("ticket created")
+	return ref, nil
+}
+
+func (c *WebhookConnector) UpdateTicket(ctx context.Context, ref TicketRef, t Ticket) error {
+	if ref.ID == "" {
+		return errors.New("missing ticket ID")
+	}
+	u := strings.ReplaceAll(c.cfg.UpdateURL, "{id}", url.PathEscape(ref.ID))
+	err := c.do(ctx, http.MethodPatch, u, t, nil, true)
+	if err != nil {
+		return err
+	}
+	c.logger.WithField("execution_id", t.ExecutionID).
+		WithField("ticket_id", ref.ID).
+		Info("ticket updated")
+	return nil
+}
+
+// do sends t as JSON to u, passing successful responses to handle if it is not nil.  Throttled requests are
+// retried, and so are network errors and 5xx responses when idempotent is true.
+func (c *WebhookConnector) do(ctx context.Context, method, u string, t Ticket, handle func(resp *http.Response) error, idempotent bool) error {
+	payload, err := json.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("failed to serialize ticket: %s", err)
+	}
+	r := retrier.New(c.backoff, retryableClassifier{})
+	r.SetJitter(0.25)
+	return r.RunCtx(ctx, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(payload))
+		if err != nil {
+			return fmt.Errorf("failed to create ticket request: %s", err)
+		}
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Content-Type", "application/json")
+		if c.cfg.AuthHeader != "" {
+			req.Header.Set("Authorization", c.cfg.AuthHeader)
+		}
+
+		resp, err := c.hc.Do(req)
+		if err != nil {
+			err = fmt.Errorf("failed to issue HTTP request: %s", err)
+			if idempotent {
+				return retryableError{err}
+			}
+			return err
+		}
+		defer resp.Body.Close()
+
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests:
+			return retryableError{fmt.Errorf("ticketing system responded with status %d", resp.StatusCode)}
+		case resp.StatusCode >= http.StatusInternalServerError && idempotent:
+			return retryableError{fmt.Errorf("ticketing system responded with status %d", resp.StatusCode)}
+		case resp.StatusCode < 200 || resp.StatusCode > 299:
+			return fmt.Errorf("ticketing system responded with status %d", resp.StatusCode)
+		}
+		if handle == nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			return nil
+		}
+		resp.Body = io.NopCloser(io.LimitReader(resp.Body, maxResponseSize))
+		return handle(resp)
+	})
+}
+
+// ticketRef reads the reference of a created ticket from the response body.
+func ticketRef(body io.Reader) (TicketRef, error) {
+	var obj map[string]any
+	if err := json.NewDecoder(body).Decode(&obj); err != nil {
+		return TicketRef{}, fmt.Errorf("failed to deserialize ticket response: %s", err)
+	}
+	if result, ok := obj["result"].(map[string]any); ok {
+		obj = result
+	}
+	ref := TicketRef{ID: firstString(obj, "id", "key", "sys_id", "number"), URL: firstString(obj, "url", "self")}
+	if ref.ID == "" {
+		return TicketRef{}, errors.New("ticket response has no ticket ID")
+	}
+	return ref, nil
+}
+
+// firstString returns the first of the fields of obj holding a non-blank string or a number, formatted.
+func firstString(obj map[string]any, fields ...string) string {
+	for _, f := range fields {
+		switch v := obj[f].(type) {
+		case string:
+			if v != "" {
+				return v
+			}
+		case float64:
+			return fmt.Sprintf("%.0f", v)
+		}
+	}
+	return ""
+}
+
+// retryableError marks an error as worth retrying.
+type retryableError struct {
+	error
+}
+
+type retryableClassifier struct{}
+
+func (retryableClassifier) Classify(err error) retrier.Action {
+	if err == nil {
+		return retrier.Succeed
+	}
+	var re retryableError
+	if errors.As(err, &re) {
+		return retrier.Retry
+	}
+	return retrier.Fail
+}
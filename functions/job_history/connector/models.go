@@ -0,0 +1,51 @@
+package connector
+
+// Ticket is the content of a ticket opened for a failed job execution.
+type Ticket struct {
+	// Description details the failure for the team handling the ticket.
+	Description string `json:"description"`
+	// ExecutionID is the workflow execution ID of the execution the ticket is opened or updated for.
+	ExecutionID string `json:"execution_id"`
+	// FailedHosts are the hosts on which the execution failed.
+	FailedHosts []FailedHost `json:"failed_hosts"`
+	// JobID is the ID of the job.
+	JobID string `json:"job_id"`
+	// JobName is the name of the job.
+	JobName string `json:"job_name"`
+	// Resolved is true when a later execution of the job completed, so that the ticket can be closed.
+	Resolved bool `json:"resolved"`
+	// Status is the status of the execution.
+	Status string `json:"status"`
+	// Summary is the one line title of the ticket.
+	Summary string `json:"summary"`
+}
+
+// FailedHost is a host on which an execution failed.
+type FailedHost struct {
+	// DeviceID is the ID of the device.
+	DeviceID string `json:"device_id"`
+	// Error is a description of why execution failed on the host.
+	Error string `json:"error,omitempty"`
+	// HostName is the name of the device.
+	HostName string `json:"host_name"`
+}
+
+// TicketRef identifies a ticket in the ticketing system.
+type TicketRef struct {
+	// ID is the ID of the ticket, e.g. the sys_id of a ServiceNow incident or the key of a Jira issue.
+	ID string `json:"id"`
+	// URL is the URL of the ticket, if the ticketing system returned one.
+	URL string `json:"url,omitempty"`
+}
+
+// WebhookConfig configures the REST endpoints of a WebhookConnector.
+type WebhookConfig struct {
+	// AuthHeader is the value of the Authorization header of the requests, e.g. "Bearer <token>".  No
+	// Authorization header is sent when it is blank.
+	AuthHeader string
+	// CreateURL is the URL to which new tickets are POSTed.
+	CreateURL string
+	// UpdateURL is the URL to which ticket updates are PATCHed, in which "{id}" is replaced with the ID of the
+	// ticket.  It defaults to CreateURL followed by "/{id}".
+	UpdateURL string
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+)
+
+// etagged returns the ETag of the successful JSON responses of a read endpoint, a hash of their body, and
+// answers requests whose If-None-Match header matches the ETag of the current response with a 304 and no body,
+// sparing the UI polling the endpoint the transfer of unchanged responses.  The ETag is always computed from the
+// response of h, as the data may be changed by the workflows through any instance.  Streamed responses are
+// returned as they are.
+func etagged(h fdk.HandlerFn) fdk.HandlerFn {
+	return func(ctx context.Context, req fdk.Request) fdk.Response {
+		match := ifNoneMatch(req.Params.Header.Get("If-None-Match"))
+
+		resp := h(ctx, req)
+		raw, ok := resp.Body.(json.RawMessage)
+		if !ok || len(resp.Errors) > 0 || responseCode(resp) != http.StatusOK {
+			return resp
+		}
+		sum := sha256.Sum256(raw)
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		if match(etag) {
+			return notModified(etag)
+		}
+		if resp.Header == nil {
+			resp.Header = make(http.Header)
+		}
+		resp.Header.Set("ETag", etag)
+		return resp
+	}
+}
+
+// ifNoneMatch returns a function reporting whether an ETag matches the value of an If-None-Match header.  Weak
+// ETags match their strong counterparts, as responses are compared byte for byte.
+func ifNoneMatch(header string) func(etag string) bool {
+	header = strings.TrimSpace(header)
+	return func(etag string) bool {
+		if header == "" {
+			return false
+		}
+		for _, t := range strings.Split(header, ",") {
+			t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+			if t == "*" || t == etag {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func notModified(etag string) fdk.Response {
+	return fdk.Response{
+		Code:   http.StatusNotModified,
+		Header: http.Header{"ETag": []string{etag}},
+	}
+}
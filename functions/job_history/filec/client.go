@@ -0,0 +1,194 @@
+package filec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/crowdstrike/gofalcon/falcon/models"
+	"github.com/sirupsen/logrus"
+)
+
+// FileC is a Falcon RTR put files client interface.
+type FileC interface {
+	// Upload uploads a put file, returning it as stored by RTR.
+	Upload(ctx context.Context, req UploadRequest) (PutFile, error)
+	// Files returns the put files with the IDs, in no particular order.  Files which are not found are left out.
+	Files(ctx context.Context, ids []string) ([]PutFile, error)
+	// Delete deletes a put file, or returns an error wrapping NotFound if there is none with the ID.
+	Delete(ctx context.Context, id string) error
+}
+
+// NotFound is wrapped by the errors of requests for put files which do not exist.
+var NotFound = errors.New("put file not found")
+
+// Client is the client.  The Falcon API client does not support multipart uploads of put files, so the RTR admin
+// API is requested directly.
+type Client struct {
+	accessToken string
+	apiHost     string
+	hc          *http.Client
+	logger      logrus.FieldLogger
+}
+
+var _ FileC = (*Client)(nil)
+
+// NewClient returns a new put files client requesting the API at apiHost, e.g. api.crowdstrike.com, using hc and
+// the access token.
+func NewClient(hc *http.Client, apiHost, accessToken string, logger logrus.FieldLogger) *Client {
+	return &Client{
+		accessToken: accessToken,
+		apiHost:     apiHost,
+		hc:          hc,
+		logger:      logger,
+	}
+}
+
+func (f *Client) Upload(ctx context.Context, req UploadRequest) (PutFile, error) {
+	if req.Name == "" {
+		return PutFile{}, errors.New("missing put file name")
+	}
+	if req.Content == nil {
+		return PutFile{}, errors.New("missing put file content")
+	}
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for k, v := range map[string]string{
+		"name":                   req.Name,
+		"description":            req.Description,
+		"comments_for_audit_log": req.Comment,
+	} {
+		if err := w.WriteField(k, v); err != nil {
+			return PutFile{}, fmt.Errorf("failed to write %s field: %s", k, err)
+		}
+	}
+	fw, err := w.CreateFormFile("file", req.Name)
+	if err == nil {
+		_, err = io.Copy(fw, req.Content)
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		return PutFile{}, fmt.Errorf("failed to write put file content: %s", err)
+	}
+
+	f.logger.WithField("name", req.Name).Info("uploading put file")
+	if err = f.do(ctx, http.MethodPost, "/real-time-response/entities/put-files/v1", nil, &body, w.FormDataContentType(), nil); err != nil {
+		return PutFile{}, fmt.Errorf("failed to upload put file: %w", err)
+	}
+
+	// the upload response carries no resources, so the file is looked up by its unique name
+	q := url.Values{"filter": {fmt.Sprintf("name:'%s'", pkg.EscapeFQLValue(req.Name))}}
+	var qr queryResponse
+	if err = f.do(ctx, http.MethodGet, "/real-time-response/queries/put-files/v1", q, nil, "", &qr); err != nil {
+		return PutFile{}, fmt.Errorf("failed to query uploaded put file: %w", err)
+	}
+	files, err := f.Files(ctx, qr.Resources)
+	if err != nil {
+		return PutFile{}, err
+	}
+	for _, pf := range files {
+		if pf.Name == req.Name {
+			return pf, nil
+		}
+	}
+	return PutFile{}, fmt.Errorf("uploaded put file %s: %w", req.Name, NotFound)
+}
+
+func (f *Client) Files(ctx context.Context, ids []string) ([]PutFile, error) {
+	if len(ids) == 0 {
+		return make([]PutFile, 0), nil
+	}
+	var payload putFilesResponse
+	err := f.do(ctx, http.MethodGet, "/real-time-response/entities/put-files/v2", url.Values{"ids": ids}, nil, "", &payload)
+	if errors.Is(err, NotFound) {
+		return make([]PutFile, 0), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get put files: %w", err)
+	}
+	return payload.Resources, nil
+}
+
+func (f *Client) Delete(ctx context.Context, id string) error {
+	if id == "" {
+		return errors.New("missing put file ID")
+	}
+	f.logger.WithField("put_file_id", id).Info("deleting put file")
+	if err := f.do(ctx, http.MethodDelete, "/real-time-response/entities/put-files/v1", url.Values{"ids": {id}}, nil, "", nil); err != nil {
+		return fmt.Errorf("failed to delete put file: %w", err)
+	}
+	return nil
+}
+
+// do requests the RTR admin API, decoding the response into out unless it is nil.  A 404 response is returned as
+// NotFound.
+func (f *Client) do(ctx context.Context, method, path string, q url.Values, body io.Reader, contentType string, out any) error {
+	u := url.URL{
+		Scheme:   "https",
+		Host:     f.apiHost,
+		Path:     path,
+		RawQuery: q.Encode(),
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+f.accessToken)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := f.hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return NotFound
+	}
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		var payload errorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&payload); err == nil && len(payload.Errors) > 0 {
+			return joinMsaAPIErrors(payload.Errors)
+		}
+		return fmt.Errorf("status code %d", resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	if err = json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %s", err)
+	}
+	return nil
+}
+
+func joinMsaAPIErrors(errs []*models.MsaAPIError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	var sb strings.Builder
+	for i, err := range errs {
+		if i == 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(fmt.Sprintf("[%d] %s", err.Code, asString(err.Message)))
+	}
+	return errors.New(sb.String())
+}
+
+func asString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
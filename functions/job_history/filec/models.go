@@ -0,0 +1,54 @@
+package filec
+
+import (
+	"io"
+
+	"github.com/crowdstrike/gofalcon/falcon/models"
+)
+
+// UploadRequest is a request to upload an RTR put file.
+type UploadRequest struct {
+	// Comment is recorded in the RTR audit log.
+	Comment string
+	// Content is the content of the file.
+	Content io.Reader
+	// Description is the description of the file.
+	Description string
+	// Name is the name of the file, which RTR put commands refer to.  It must be unique.
+	Name string
+}
+
+// PutFile is an RTR put file.
+type PutFile struct {
+	// CreatedAt is the time the file was uploaded.
+	CreatedAt string `json:"created_timestamp"`
+	// CreatedBy is the user who uploaded the file.
+	CreatedBy string `json:"created_by"`
+	// Description is the description of the file.
+	Description string `json:"description"`
+	// ID is the ID of the file.
+	ID string `json:"id"`
+	// Name is the name of the file.
+	Name string `json:"name"`
+	// SHA256 is the hex encoded SHA-256 hash of the content of the file.
+	SHA256 string `json:"sha256"`
+	// Size is the size of the file in bytes.
+	Size int64 `json:"size"`
+}
+
+// putFilesResponse is the body of the response to a request for put files.
+type putFilesResponse struct {
+	Errors    []*models.MsaAPIError `json:"errors"`
+	Resources []PutFile             `json:"resources"`
+}
+
+// queryResponse is the body of the response to a put files query.
+type queryResponse struct {
+	Errors    []*models.MsaAPIError `json:"errors"`
+	Resources []string              `json:"resources"`
+}
+
+// errorResponse is the body of an error response.
+type errorResponse struct {
+	Errors []*models.MsaAPIError `json:"errors"`
+}
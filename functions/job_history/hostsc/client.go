@@ -0,0 +1,163 @@
+package hostsc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/crowdstrike/gofalcon/falcon/client/hosts"
+	"github.com/crowdstrike/gofalcon/falcon/models"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// pageSize is the maximum number of device IDs returned by a query and accepted by a details request.
+	pageSize = 5000
+	// maxMembers is the maximum offset the device query API pages through.
+	maxMembers = 10000
+)
+
+// HostC is a Falcon hosts client interface.
+type HostC interface {
+	// GroupMembers returns the hosts which are members of any of the host groups, sorted by host name.
+	GroupMembers(ctx context.Context, groupIDs []string) ([]Host, error)
+	// Details returns the hosts with the device IDs, in no particular order.  Devices which are not found are
+	// left out.
+	Details(ctx context.Context, deviceIDs []string) ([]Host, error)
+}
+
+// Client is the client.
+type Client struct {
+	c      hosts.ClientService
+	logger logrus.FieldLogger
+}
+
+var _ HostC = (*Client)(nil)
+
+// NewClient returns a new hosts client.
+func NewClient(c hosts.ClientService, logger logrus.FieldLogger) *Client {
+	return &Client{
+		c:      c,
+		logger: logger,
+	}
+}
+
+func (f *Client) GroupMembers(ctx context.Context, groupIDs []string) ([]Host, error) {
+	if len(groupIDs) == 0 {
+		return make([]Host, 0), nil
+	}
+	deviceIDs, err := f.queryGroupMembers(ctx, groupIDs)
+	if err != nil {
+		return nil, err
+	}
+	members, err := f.Details(ctx, deviceIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].HostName < members[j].HostName
+	})
+	return members, nil
+}
+
+func (f *Client) Details(ctx context.Context, deviceIDs []string) ([]Host, error) {
+	details := make([]Host, 0, len(deviceIDs))
+	for start := 0; start < len(deviceIDs); start += pageSize {
+		end := min(start+pageSize, len(deviceIDs))
+		params := hosts.NewPostDeviceDetailsV2ParamsWithContext(ctx)
+		params.Body = &models.MsaIdsRequest{Ids: deviceIDs[start:end]}
+		resp, err := f.c.PostDeviceDetailsV2(params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get device details: %s", err)
+		}
+		payload := resp.GetPayload()
+		if payload == nil {
+			return nil, errors.New("missing payload")
+		}
+		if len(payload.Errors) > 0 {
+			return nil, fmt.Errorf("errors returned from request: %s", joinMsaAPIErrors(payload.Errors))
+		}
+		for _, d := range payload.Resources {
+			if d == nil || d.DeviceID == nil {
+				continue
+			}
+			details = append(details, Host{
+				DeviceID: *d.DeviceID,
+				Groups:   d.Groups,
+				HostName: d.Hostname,
+				Platform: d.PlatformName,
+				SiteName: d.SiteName,
+			})
+		}
+	}
+	return details, nil
+}
+
+// queryGroupMembers returns the IDs of the devices which are members of any of the host groups.
+func (f *Client) queryGroupMembers(ctx context.Context, groupIDs []string) ([]string, error) {
+	b := &pkg.QueryBuilder{}
+	filter, err := b.WhereAny("groups", groupIDs...).Build()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build host group filter: %w", err)
+	}
+
+	f.logger.WithField("host_groups", groupIDs).Info("resolving host group members")
+	deviceIDs := make([]string, 0)
+	for offset := int64(0); offset < maxMembers; {
+		params := hosts.NewQueryDevicesByFilterParamsWithContext(ctx)
+		params.Filter = &filter
+		limit := int64(pageSize)
+		params.Limit = &limit
+		params.Offset = &offset
+		resp, err := f.c.QueryDevicesByFilter(params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query host group members: %s", err)
+		}
+		payload := resp.GetPayload()
+		if payload == nil {
+			return nil, errors.New("missing payload")
+		}
+		if len(payload.Errors) > 0 {
+			return nil, fmt.Errorf("errors returned from request: %s", joinMsaAPIErrors(payload.Errors))
+		}
+		deviceIDs = append(deviceIDs, payload.Resources...)
+		offset += int64(len(payload.Resources))
+
+		total := offset
+		if payload.Meta != nil && payload.Meta.Pagination != nil && payload.Meta.Pagination.Total != nil {
+			total = *payload.Meta.Pagination.Total
+		}
+		if len(payload.Resources) == 0 || offset >= total {
+			break
+		}
+	}
+	if len(deviceIDs) >= maxMembers {
+		f.logger.WithField("host_groups", groupIDs).Warnf("host groups have more than %d members - truncating", maxMembers)
+	}
+	return deviceIDs, nil
+}
+
+func joinMsaAPIErrors(errs []*models.MsaAPIError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	var sb strings.Builder
+	for i, err := range errs {
+		if i == 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(fmt.Sprintf("[%d] %s", err.Code, asString(err.Message)))
+	}
+	return errors.New(sb.String())
+}
+
+func asString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,15 @@
+package hostsc
+
+// Host is a Falcon host.
+type Host struct {
+	// DeviceID is the ID of the device.
+	DeviceID string
+	// Groups are the IDs of the host groups the device is a member of.
+	Groups []string
+	// HostName is the name of the device.
+	HostName string
+	// Platform is the platform of the device, e.g. Windows.
+	Platform string
+	// SiteName is the name of the Active Directory site of the device.
+	SiteName string
+}
@@ -0,0 +1,70 @@
+package limiter
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+)
+
+// Limiter bounds the rate and concurrency of requests with a token bucket and a number of slots.  Requests
+// exceeding either are rejected rather than queued, so that callers can back off.  It is safe for concurrent use.
+type Limiter struct {
+	mu       sync.Mutex
+	clock    pkg.Clock
+	rate     float64
+	burst    float64
+	tokens   float64
+	last     time.Time
+	inFlight int
+	maxSlots int
+}
+
+// New returns a Limiter admitting rate requests per second on average, bursts of up to burst requests, and at
+// most concurrency requests at a time.  A rate or concurrency of 0 or less disables the respective limit.
+func New(rate float64, burst, concurrency int, clock pkg.Clock) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		clock:    clock,
+		rate:     rate,
+		burst:    float64(burst),
+		tokens:   float64(burst),
+		last:     clock.Now(),
+		maxSlots: concurrency,
+	}
+}
+
+// Acquire admits a request if a token and a slot are available.  On success it returns a function releasing the
+// slot, which must be called once the request completes.  Otherwise it returns false and how long the caller
+// should wait before retrying.
+func (l *Limiter) Acquire() (func(), time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.maxSlots > 0 && l.inFlight >= l.maxSlots {
+		return nil, time.Second, false
+	}
+	if l.rate > 0 {
+		now := l.clock.Now()
+		l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+		l.last = now
+		if l.tokens < 1 {
+			wait := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+			return nil, wait, false
+		}
+		l.tokens--
+	}
+
+	l.inFlight++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			l.inFlight--
+			l.mu.Unlock()
+		})
+	}, 0, true
+}
@@ -4,24 +4,134 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/alertc"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/auditc"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/connector"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/filec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/hostsc"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/limiter"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/metrics"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/notifier"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
 	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/processor"
 	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/searchc"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/siem"
 	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/tracing"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/workflowc"
 	"github.com/crowdstrike/gofalcon/falcon"
 	"github.com/crowdstrike/gofalcon/falcon/client"
+	"github.com/eapache/go-resiliency/breaker"
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	// compressObjectsAbove is the size in bytes above which storage objects are compressed, e.g. the execution
+	// records of jobs targeting thousands of hosts.
+	compressObjectsAbove = 64 << 10
+	// maxStorageObjectSize is the size in bytes above which compressed storage objects are chained over several
+	// objects.
+	maxStorageObjectSize = 1 << 20
+	// hostsPerShard is the number of hosts stored in each part of the execution records of jobs targeting more
+	// hosts.
+	hostsPerShard = 2000
+	// cachedObjects is the number of storage objects cached across requests, and cachedObjectsTTL how long each is
+	// cached for, so that the execution events of a job arriving within seconds of each other do not each fetch
+	// the record of the job.
+	cachedObjects    = 1000
+	cachedObjectsTTL = 5 * time.Second
+	// defaultRequestRate is the number of requests per second admitted on average, defaultRequestBurst the
+	// number admitted at once after a quiet period, and defaultConcurrentRequests the number handled at a time,
+	// unless overridden with the RATE_LIMIT, RATE_LIMIT_BURST and MAX_CONCURRENT_REQUESTS environment variables.
+	defaultRequestRate        = 20
+	defaultRequestBurst       = 40
+	defaultConcurrentRequests = 10
+	// defaultFunctionStatsInterval is how often the counters of the function are saved to custom storage, unless
+	// overridden with the FUNCTION_STATS_INTERVAL environment variable.
+	defaultFunctionStatsInterval = 5 * time.Minute
+)
+
 var (
 	debug       bool
 	falconHost  string
 	logger      logrus.FieldLogger
 	falconCloud falcon.CloudType
+	// savedSearches maps the logical Logscale queries to saved searches, and can be overridden by the config of
+	// the function or the SAVED_SEARCHES environment variable.
+	savedSearches = searchc.DefaultSavedSearches()
+	// storageBreaker is shared by every storage client so that a storage brownout observed by one request
+	// fails the following requests fast.
+	storageBreaker = breaker.New(5, 1, 30*time.Second)
+	// storageCache is shared by every storage client so that repeated fetches of an object are served from memory.
+	storageCache = storagec.NewCache(cachedObjects, cachedObjectsTTL, pkg.ClockFunc(time.Now))
+	// disableExpiredWorkflows makes the upsert flow disable the schedule workflow of jobs whose schedule has
+	// ended, and is set with the DISABLE_EXPIRED_WORKFLOWS environment variable.
+	disableExpiredWorkflows bool
+	// requestLimiter throttles the requests of every handler so that a flood of workflow events does not exhaust
+	// the rate limits of storage and Logscale.
+	requestLimiter = limiter.New(defaultRequestRate, defaultRequestBurst, defaultConcurrentRequests, pkg.SystemClock)
+	// tracer traces the storage and Logscale calls of the clients.  Spans are exported into the logs of the
+	// function when the TRACING environment variable is set, and discarded otherwise.
+	tracer = tracing.Noop
+	// multiTenant isolates the job history of each CID making requests, e.g. the child CIDs of an MSSP, and is
+	// set with the MULTI_TENANT environment variable.
+	multiTenant bool
+	// redactedFields are the fields masked when request bodies are logged, and can be overridden with the
+	// comma-separated REDACTED_FIELDS environment variable.
+	redactedFields = processor.DefaultRedactedFields
+	// staleExecutionTimeout is how long an execution may stay in progress before it is reaped, and is set with
+	// the STALE_EXECUTION_TIMEOUT environment variable, e.g. 12h.  The reaper default applies when it is unset.
+	staleExecutionTimeout time.Duration
+	// jobIDStrategy is how the IDs of jobs are derived from the names in workflow events, and is set with the
+	// JOB_ID_STRATEGY environment variable, which must match that of Func_Jobs.
+	jobIDStrategy = processor.JobIDStrategyHash
+	// foldJobNameCase makes job names which only differ by case the same name, and is set with the
+	// JOB_NAME_CASE_FOLDING environment variable, which must match that of Func_Jobs.
+	foldJobNameCase bool
+	// outputPolicy bounds the RTR output of each host kept on execution records.  Its inline limit is set in KB
+	// with the OUTPUT_INLINE_KB environment variable.
+	outputPolicy = processor.DefaultOutputPolicy()
+	// strictDecoding makes the upsert flow reject workflow events and execution records with unknown fields,
+	// rather than reporting them as warnings, and is set with the STRICT_DECODING environment variable.
+	strictDecoding bool
+	// collections are the custom storage collections used by the function, which can be renamed by the config
+	// of the function, see appConfig.
+	collections = processor.DefaultCollections()
+	// storageFetchTimeout, storagePutTimeout and searchTimeout bound each call reading custom storage, writing to
+	// it and searching Logscale, and are set with the STORAGE_FETCH_TIMEOUT, STORAGE_PUT_TIMEOUT and SEARCH_TIMEOUT
+	// environment variables, e.g. 45s.  The defaults of the clients apply when they are unset.
+	storageFetchTimeout time.Duration
+	storagePutTimeout   time.Duration
+	searchTimeout       time.Duration
+	// functionStats saves the counters of the function to custom storage, for environments where /metrics cannot
+	// be scraped.  It is disabled for multi-tenant deployments, as the counters are not kept per tenant.
+	functionStats = processor.NewFunctionStatsRecorder(metrics.Default, defaultFunctionStatsInterval, pkg.SystemClock)
+	// workflowNamePrefix is the prefix of the names of the workflow definitions of the app, which reconciliation
+	// deprovisions when they have no job, and is set with the WORKFLOW_NAME_PREFIX environment variable.
+	workflowNamePrefix string
+	// rtrSessionCeiling is the number of RTR sessions the running executions may hold before new executions are
+	// queued, and is set with the RTR_SESSION_CEILING environment variable.  Executions are not queued when unset.
+	rtrSessionCeiling int
+	// alertWorkflowID is the Fusion workflow raising alerts for executions which failed on too many hosts, and
+	// alertFailurePercent the percentage of failed hosts above which they are raised.  They are set with the
+	// ALERT_WORKFLOW_ID and ALERT_FAILURE_PERCENT environment variables, and no alert is raised unless both are.
+	alertWorkflowID     string
+	alertFailurePercent float64
+	// siemCollector is the syslog or HTTP collector to which the summaries of finished executions are emitted in
+	// the siemFormat, cef or leef, and siemAuthHeader the Authorization header of HTTP collectors.  They are set
+	// with the SIEM_COLLECTOR, SIEM_FORMAT and SIEM_AUTH_HEADER environment variables.  No event is emitted when
+	// the collector is unset.
+	siemCollector  string
+	siemFormat     = siem.FormatCEF
+	siemAuthHeader string
 )
 
 func main() {
@@ -52,16 +162,210 @@ func doInit(cloud, useDebug string) {
 
 	l := logrus.New()
 	l.SetFormatter(&logrus.JSONFormatter{})
+	if debug {
+		l.SetLevel(logrus.DebugLevel)
+	}
 	logger = l
 
 	falconCloud = falcon.Cloud(cloud)
+
+	if s := os.Getenv("REDACTED_FIELDS"); s != "" {
+		redactedFields = strings.Split(s, ",")
+	}
+
+	if os.Getenv("MULTI_TENANT") != "" {
+		multiTenant = true
+	}
+
+	if os.Getenv("TRACING") != "" {
+		tracer = tracing.NewLogTracer(logger)
+	}
+
+	if os.Getenv("DISABLE_EXPIRED_WORKFLOWS") != "" {
+		disableExpiredWorkflows = true
+	}
+
+	if os.Getenv("JOB_NAME_CASE_FOLDING") != "" {
+		foldJobNameCase = true
+	}
+
+	workflowNamePrefix = os.Getenv("WORKFLOW_NAME_PREFIX")
+
+	if os.Getenv("STRICT_DECODING") != "" {
+		strictDecoding = true
+	}
+
+	switch s := os.Getenv("JOB_ID_STRATEGY"); s {
+	case "":
+	case processor.JobIDStrategyHash, processor.JobIDStrategyUUID:
+		jobIDStrategy = s
+	default:
+		logger.Errorf("ignoring unknown JOB_ID_STRATEGY %q", s)
+	}
+
+	if s := os.Getenv("OUTPUT_INLINE_KB"); s != "" {
+		kb, err := strconv.Atoi(s)
+		if err != nil || kb <= 0 {
+			logger.Errorf("ignoring OUTPUT_INLINE_KB %q: must be a positive integer", s)
+		} else {
+			outputPolicy.InlineLimit = kb << 10
+		}
+	}
+
+	if s := os.Getenv("RTR_SESSION_CEILING"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			logger.Errorf("ignoring RTR_SESSION_CEILING %q: must be a positive integer", s)
+		} else {
+			rtrSessionCeiling = n
+		}
+	}
+
+	alertWorkflowID = os.Getenv("ALERT_WORKFLOW_ID")
+	if s := os.Getenv("ALERT_FAILURE_PERCENT"); s != "" {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || v <= 0 || v >= 100 {
+			logger.Errorf("ignoring ALERT_FAILURE_PERCENT %q: must be a number between 0 and 100", s)
+		} else {
+			alertFailurePercent = v
+		}
+	}
+
+	if s := os.Getenv("SIEM_FORMAT"); s != "" {
+		siemFormat = strings.ToLower(s)
+	}
+	siemAuthHeader = os.Getenv("SIEM_AUTH_HEADER")
+	if s := os.Getenv("SIEM_COLLECTOR"); s != "" {
+		if _, err := siem.NewClient(s, siemFormat, nil, logger); err != nil {
+			logger.Errorf("ignoring SIEM_COLLECTOR %q: %s", s, err)
+		} else {
+			siemCollector = s
+		}
+	}
+
+	if s := os.Getenv("STALE_EXECUTION_TIMEOUT"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			logger.Errorf("ignoring STALE_EXECUTION_TIMEOUT: %s", err)
+		} else {
+			staleExecutionTimeout = d
+		}
+	}
+
+	for name, d := range map[string]*time.Duration{
+		"STORAGE_FETCH_TIMEOUT": &storageFetchTimeout,
+		"STORAGE_PUT_TIMEOUT":   &storagePutTimeout,
+		"SEARCH_TIMEOUT":        &searchTimeout,
+	} {
+		if s := os.Getenv(name); s != "" {
+			v, err := time.ParseDuration(s)
+			if err != nil || v <= 0 {
+				logger.Errorf("ignoring %s %q: must be a positive duration", name, s)
+			} else {
+				*d = v
+			}
+		}
+	}
+
+	if s := os.Getenv("FUNCTION_STATS_INTERVAL"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			logger.Errorf("ignoring FUNCTION_STATS_INTERVAL %q: must be a positive duration", s)
+		} else {
+			functionStats = processor.NewFunctionStatsRecorder(metrics.Default, d, pkg.SystemClock)
+		}
+	}
+
+	rate, burst, concurrency := float64(defaultRequestRate), defaultRequestBurst, defaultConcurrentRequests
+	if v, err := strconv.ParseFloat(os.Getenv("RATE_LIMIT"), 64); err == nil {
+		rate = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("RATE_LIMIT_BURST")); err == nil {
+		burst = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("MAX_CONCURRENT_REQUESTS")); err == nil {
+		concurrency = v
+	}
+	requestLimiter = limiter.New(rate, burst, concurrency, pkg.SystemClock)
+
+	cfg, err := loadConfig(os.Getenv("CS_FN_CONFIG_PATH"), os.Getenv("APP_PROFILE"))
+	if err != nil {
+		logger.Errorf("ignoring config: %s", err)
+	}
+	collections = processor.DefaultCollections().Merge(cfg.Collections)
+	processor.UseCollections(collections)
+	if len(cfg.SavedSearches) > 0 {
+		ss, err := searchc.ParseSavedSearches(string(cfg.SavedSearches))
+		if err != nil {
+			logger.Errorf("ignoring saved searches of config: %s", err)
+		} else {
+			savedSearches = ss
+		}
+	}
+
+	if s := os.Getenv("SAVED_SEARCHES"); s != "" {
+		ss, err := searchc.ParseSavedSearches(s)
+		if err != nil {
+			logger.Errorf("ignoring SAVED_SEARCHES: %s", err)
+		} else {
+			savedSearches = ss
+		}
+	}
 }
 
 func handler(context.Context, fdk.SkipCfg) fdk.Handler {
 	mux := fdk.NewMux()
-	mux.Get("/run-history", fdk.HandlerFn(runHistoryHandler))
-	mux.Put("/upsert", fdk.HandlerFn(upsertHandler))
-	return mux
+	mux.Get("/run-history", instrumented("GET /run-history", limited(authorized(processor.PermissionViewHistory, etagged(runHistoryHandler)))))
+	mux.Get("/executions", instrumented("GET /executions", limited(authorized(processor.PermissionViewHistory, etagged(queryExecutionsHandler)))))
+	mux.Get("/executions/changes", instrumented("GET /executions/changes", limited(authorized(processor.PermissionViewHistory, etagged(executionChangesHandler)))))
+	mux.Get("/executions/diff", instrumented("GET /executions/diff", limited(authorized(processor.PermissionViewHistory, etagged(executionDiffHandler)))))
+	mux.Get("/executions/baseline-check", instrumented("GET /executions/baseline-check", limited(authorized(processor.PermissionViewHistory, etagged(baselineCheckHandler)))))
+	mux.Get("/executions/host-summary", instrumented("GET /executions/host-summary", limited(authorized(processor.PermissionViewHistory, etagged(hostSummaryHandler)))))
+	mux.Get("/stats", instrumented("GET /stats", limited(authorized(processor.PermissionViewHistory, etagged(statsHandler)))))
+	mux.Get("/jobs", instrumented("GET /jobs", limited(authorized(processor.PermissionViewHistory, etagged(searchJobsHandler)))))
+	mux.Put("/upsert", instrumented("PUT /upsert", limited(audited(upsertHandler))))
+	mux.Put("/upsert-batch", instrumented("PUT /upsert-batch", limited(audited(upsertBatchHandler))))
+	mux.Post("/rerun", instrumented("POST /rerun", limited(audited(authorized(processor.PermissionManageJobs, rerunHandler)))))
+	mux.Post("/reprocess", instrumented("POST /reprocess", limited(audited(authorized(processor.PermissionManageJobs, reprocessHandler)))))
+	mux.Post("/retention", instrumented("POST /retention", limited(audited(retentionHandler))))
+	mux.Delete("/job", instrumented("DELETE /job", limited(audited(authorized(processor.PermissionDeleteJobs, deleteJobHandler)))))
+	mux.Get("/host-output", instrumented("GET /host-output", limited(authorized(processor.PermissionViewHistory, etagged(hostOutputHandler)))))
+	mux.Post("/evidence", instrumented("POST /evidence", limited(audited(attachEvidenceHandler))))
+	mux.Get("/evidence", instrumented("GET /evidence", limited(authorized(processor.PermissionViewHistory, etagged(evidenceHandler)))))
+	mux.Post("/put-files", instrumented("POST /put-files", limited(audited(authorized(processor.PermissionManageJobs, uploadPutFileHandler)))))
+	mux.Get("/put-files", instrumented("GET /put-files", limited(authorized(processor.PermissionViewHistory, etagged(putFilesHandler)))))
+	mux.Delete("/put-files", instrumented("DELETE /put-files", limited(audited(authorized(processor.PermissionDeleteJobs, deletePutFileHandler)))))
+	mux.Post("/rollouts", instrumented("POST /rollouts", limited(audited(authorized(processor.PermissionManageJobs, startRolloutHandler)))))
+	mux.Get("/rollouts", instrumented("GET /rollouts", limited(authorized(processor.PermissionViewHistory, etagged(rolloutsHandler)))))
+	mux.Post("/rollouts/advance", instrumented("POST /rollouts/advance", limited(audited(advanceRolloutsHandler))))
+	mux.Post("/deferred/release", instrumented("POST /deferred/release", limited(audited(releaseDeferredHandler))))
+	mux.Post("/annotate", instrumented("POST /annotate", limited(audited(authorized(processor.PermissionManageJobs, annotateExecutionHandler)))))
+	mux.Post("/executions/import", instrumented("POST /executions/import", limited(audited(authorized(processor.PermissionManageJobs, importExecutionHandler)))))
+	mux.Post("/rename-job", instrumented("POST /rename-job", limited(audited(authorized(processor.PermissionManageJobs, renameJobHandler)))))
+	mux.Post("/baseline", instrumented("POST /baseline", limited(audited(authorized(processor.PermissionManageJobs, baselineHandler)))))
+	mux.Post("/pause", instrumented("POST /pause", limited(audited(authorized(processor.PermissionManageJobs, pauseHandler(true))))))
+	mux.Post("/resume", instrumented("POST /resume", limited(audited(authorized(processor.PermissionManageJobs, pauseHandler(false))))))
+	mux.Post("/enrich", instrumented("POST /enrich", limited(audited(enrichmentHandler))))
+	mux.Post("/backfill", instrumented("POST /backfill", limited(audited(authorized(processor.PermissionManageJobs, backfillHandler)))))
+	mux.Post("/digest", instrumented("POST /digest", limited(audited(digestHandler))))
+	mux.Post("/missed-runs", instrumented("POST /missed-runs", limited(audited(missedRunsHandler))))
+	mux.Post("/reap", instrumented("POST /reap", limited(audited(reaperHandler))))
+	mux.Post("/reconcile-workflows", instrumented("POST /reconcile-workflows", limited(audited(reconcileWorkflowsHandler))))
+	mux.Post("/reconcile", instrumented("POST /reconcile", limited(audited(reconcileHandler))))
+	mux.Post("/sync-jobs", instrumented("POST /sync-jobs", limited(audited(authorized(processor.PermissionManageJobs, syncJobsHandler)))))
+	mux.Post("/migrate-job-ids", instrumented("POST /migrate-job-ids", limited(audited(authorized(processor.PermissionManageSettings, migrateJobIDsHandler)))))
+	mux.Get("/settings", instrumented("GET /settings", limited(authorized(processor.PermissionViewHistory, etagged(settingsHandler)))))
+	mux.Put("/settings", instrumented("PUT /settings", limited(audited(authorized(processor.PermissionManageSettings, updateSettingsHandler)))))
+	mux.Get("/metrics", fdk.HandlerFn(metricsHandler))
+	mux.Get("/function-stats", instrumented("GET /function-stats", limited(authorized(processor.PermissionViewHistory, etagged(functionStatsHandler)))))
+	mux.Get("/health", instrumented("GET /health", healthHandler))
+	mux.Post("/self-test", instrumented("POST /self-test", limited(audited(authorized(processor.PermissionManageSettings, selfTestHandler)))))
+	mux.Get("/audit-trail", instrumented("GET /audit-trail", limited(authorized(processor.PermissionViewHistory, etagged(auditTrailHandler)))))
+	mux.Post("/schedule-preview", instrumented("POST /schedule-preview", limited(schedulePreviewHandler)))
+	mux.Post("/validate-payload", instrumented("POST /validate-payload", limited(validatePayloadHandler)))
+	mux.Get("/calendar", instrumented("GET /calendar", limited(authorized(processor.PermissionViewHistory, etagged(calendarHandler)))))
+	mux.Get("/calendar.ics", instrumented("GET /calendar.ics", limited(authorized(processor.PermissionViewHistory, iCalendarHandler))))
+	return traced(tenanted(mux))
 }
 
 func runHistoryHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
@@ -79,19 +383,43 @@ func runHistoryHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response
 			Errors: []fdk.APIError{{Code: 500, Message: msg}},
 		}
 	}
-	resp := p.Process(ctx, req)
-	if len(resp.Errs) > 0 {
-		fResp = fdk.Response{
-			Code:   resp.Code,
-			Errors: resp.Errs,
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func queryExecutionsHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
 		}
-	} else {
-		fResp = fdk.Response{
-			Body: json.RawMessage(resp.Body),
-			Code: resp.Code,
+	}()
+
+	p, err := newQueryExecutionsProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize job execution query processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func executionChangesHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newChangesProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize job execution changes processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
 		}
 	}
-	return
+	return asFDKResponse(ctx, p.Process(ctx, req))
 }
 
 func upsertHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
@@ -110,88 +438,1681 @@ func upsertHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
 		}
 	}
 
-	resp := u.Process(ctx, req)
-	if len(resp.Errs) > 0 {
-		fResp = fdk.Response{
-			Code:   resp.Code,
-			Errors: resp.Errs,
+	return asFDKResponse(ctx, u.Process(ctx, req))
+}
+
+func upsertBatchHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
 		}
-	} else {
-		fResp = fdk.Response{
-			Body: json.RawMessage(resp.Body),
-			Code: resp.Code,
+	}()
+
+	u, err := newUpsertProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize job upsert processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
 		}
 	}
-	return
+
+	return asFDKResponse(ctx, u.ProcessBatch(ctx, req))
 }
 
-func ensurePanicLogged() *fdk.Response {
-	p := recover()
-	if p == nil {
-		return nil
-	}
+func rerunHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
 
-	msg := ""
-	if s, ok := p.(fmt.Stringer); ok {
-		msg = fmt.Sprintf("fatal error: %s", s)
-	} else if e, ok := p.(error); ok {
-		msg = fmt.Sprintf("fatal error: %s", e.Error())
-	} else {
-		msg = fmt.Sprintf("fatal error: %v", p)
+	p, err := newRerunProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize job rerun processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
 	}
-	logger.Error(msg)
-	return &fdk.Response{
-		Code: 500,
-		Errors: []fdk.APIError{
-			{Code: 500, Message: msg},
-		},
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func reprocessHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newReprocessProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize job reprocess processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
 	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
 }
 
-func newFalconClient(ctx context.Context, token string) (*client.CrowdStrikeAPISpecification, error) {
-	config := &falcon.ApiConfig{
-		AccessToken: token,
-		Cloud:       falconCloud,
-		Context:     ctx,
+func retentionHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newRetentionProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize retention processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
 	}
-	if debug {
-		config.Debug = debug
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func statsHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newStatsProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize stats processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
 	}
-	fc, err := falcon.NewClient(config)
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func executionDiffHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newExecutionDiffProcessor(ctx, req.AccessToken)
 	if err != nil {
-		err0 := fmt.Errorf("failed to create falcon client with error: %s", err)
-		logger.Error(err0)
-		return nil, err0
+		msg := fmt.Sprintf("failed to initialize execution diff processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
 	}
-	return fc, nil
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
 }
 
-func newSearchClient(fc *client.CrowdStrikeAPISpecification) searchc.SearchC {
-	return searchc.NewClient(fc.SavedSearches, logger)
+func baselineHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newBaselineProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize baseline processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
 }
 
-func newStorageClient(fc *client.CrowdStrikeAPISpecification, token string) storagec.StorageC {
-	hc := http.DefaultClient
-	hc.Timeout = 10 * time.Second
-	return storagec.NewClient(fc.CustomStorage, hc, token, logger)
+func baselineCheckHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newBaselineCheckProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize baseline check processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
 }
 
-func newExecutionsProcessor(ctx context.Context, token string) (*processor.ExecutionsProcessor, error) {
-	fc, err := newFalconClient(ctx, token)
+func hostSummaryHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newHostSummaryProcessor(ctx, req.AccessToken)
 	if err != nil {
-		return nil, err
+		msg := fmt.Sprintf("failed to initialize host summary processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
 	}
-	strg := newStorageClient(fc, token)
-	return processor.NewExecutionsProcessor(strg, logger), nil
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
 }
 
-func newUpsertProcessor(ctx context.Context, token string) (*processor.UpsertProcessor, error) {
-	fc, err := newFalconClient(ctx, token)
+func searchJobsHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newSearchJobsProcessor(ctx, req.AccessToken)
 	if err != nil {
-		return nil, err
+		msg := fmt.Sprintf("failed to initialize search jobs processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
 	}
-	srchc := newSearchClient(fc)
-	strgc := newStorageClient(fc, token)
 
-	return processor.NewUpsertProcessor(falconHost, srchc, strgc, logger), nil
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func deleteJobHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newDeleteJobProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize delete job processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func hostOutputHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newHostOutputProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize host output processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func attachEvidenceHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newAttachEvidenceProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize attach evidence processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func evidenceHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newEvidenceProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize evidence processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func uploadPutFileHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newUploadPutFileProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize upload put file processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func putFilesHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newPutFilesProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize put files processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func deletePutFileHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newDeletePutFileProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize delete put file processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func startRolloutHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newStartRolloutProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize start rollout processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func rolloutsHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newRolloutsProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize rollouts processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func advanceRolloutsHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newAdvanceRolloutsProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize advance rollouts processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func releaseDeferredHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newReleaseDeferredProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize release deferred processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func annotateExecutionHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newAnnotateExecutionProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize annotate execution processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func importExecutionHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newImportExecutionProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize import execution processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func renameJobHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newRenameJobProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize rename job processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+// pauseHandler returns the handler which pauses jobs if paused is true and resumes them otherwise.
+func pauseHandler(paused bool) fdk.HandlerFn {
+	return func(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+		defer func() {
+			if fr := ensurePanicLogged(); fr != nil {
+				fResp = *fr
+			}
+		}()
+
+		p, err := newPauseProcessor(ctx, req.AccessToken, paused)
+		if err != nil {
+			msg := fmt.Sprintf("failed to initialize pause processor: %s", err)
+			logger.Error(msg)
+			return fdk.Response{
+				Errors: []fdk.APIError{{Code: 500, Message: msg}},
+			}
+		}
+
+		return asFDKResponse(ctx, p.Process(ctx, req))
+	}
+}
+
+func enrichmentHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newEnrichmentProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize enrichment processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func backfillHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newBackfillProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize backfill processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func digestHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newDigestProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize digest processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func missedRunsHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newMissedRunsProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize missed runs processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func reaperHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newReaperProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize reaper processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func reconcileWorkflowsHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newReconcileWorkflowsProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize reconcile workflows processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func syncJobsHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newSyncProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize sync processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func reconcileHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newReconcileProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize reconcile processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func migrateJobIDsHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newMigrateJobIDsProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize job ID migration processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func auditTrailHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newQueryAuditProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize audit trail query processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func schedulePreviewHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	return asFDKResponse(ctx, processor.NewSchedulePreviewProcessor(requestLogger(ctx)).Process(ctx, req))
+}
+
+func validatePayloadHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newValidatePayloadProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize validate payload processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func calendarHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newCalendarProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize calendar processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func iCalendarHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newICalendarProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize icalendar processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func settingsHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newSettingsProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize settings processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func updateSettingsHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newSettingsProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize settings processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Update(ctx, req))
+}
+
+func healthHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newHealthProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize health processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func selfTestHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newSelfTestProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize self-test processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func functionStatsHandler(ctx context.Context, req fdk.Request) (fResp fdk.Response) {
+	defer func() {
+		if fr := ensurePanicLogged(); fr != nil {
+			fResp = *fr
+		}
+	}()
+
+	p, err := newFunctionStatsProcessor(ctx, req.AccessToken)
+	if err != nil {
+		msg := fmt.Sprintf("failed to initialize function stats processor: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+
+	return asFDKResponse(ctx, p.Process(ctx, req))
+}
+
+func metricsHandler(_ context.Context, _ fdk.Request) fdk.Response {
+	b, err := json.Marshal(metrics.Default.Snapshot())
+	if err != nil {
+		msg := fmt.Sprintf("failed to marshal metrics: %s", err)
+		logger.Error(msg)
+		return fdk.Response{
+			Errors: []fdk.APIError{{Code: 500, Message: msg}},
+		}
+	}
+	return fdk.Response{
+		Body: json.RawMessage(b),
+		Code: http.StatusOK,
+	}
+}
+
+// instrumented records the latency and status code of every request served by h.  Each request is also
+// logged as a structured event, so the same figures can be queried in LogScale, and the counters are saved to
+// custom storage once the function stats interval has elapsed.
+func instrumented(name string, h fdk.HandlerFn) fdk.HandlerFn {
+	return func(ctx context.Context, req fdk.Request) fdk.Response {
+		start := time.Now()
+		resp := h(ctx, req)
+		elapsed := time.Since(start)
+
+		code := responseCode(resp)
+		metrics.Default.Observe("request_duration_seconds", metrics.Labels{"handler": name}, elapsed)
+		metrics.Default.Inc("requests_total", metrics.Labels{"handler": name, "code": strconv.Itoa(code)})
+		requestLogger(ctx).WithField("event", "request_metrics").
+			WithField("handler", name).
+			WithField("code", code).
+			WithField("duration_ms", elapsed.Milliseconds()).
+			Info("request completed")
+		if !multiTenant {
+			functionStats.SaveIfDue(ctx, func() (storagec.StorageC, error) {
+				fc, err := newFalconClient(ctx, req.AccessToken)
+				if err != nil {
+					return nil, err
+				}
+				l := requestLogger(ctx)
+				return newStorageClient(fc, req.AccessToken, l), nil
+			}, requestLogger(ctx))
+		}
+		return resp
+	}
+}
+
+// traced carries the trace ID of the request on the context, so that the log lines of the request and of the
+// clients it uses can be correlated, and returns it in the X-CS-TRACEID header of the response.  Requests without a
+// trace ID are given a new one.  The context collects the warnings of the request too, see asFDKResponse.
+func traced(h fdk.Handler) fdk.HandlerFn {
+	return func(ctx context.Context, req fdk.Request) fdk.Response {
+		traceID := strings.TrimSpace(req.TraceID)
+		if traceID == "" {
+			traceID = strings.TrimSpace(req.Params.Header.Get("X-CS-TRACEID"))
+		}
+		if traceID == "" {
+			traceID = pkg.NewTraceID()
+		}
+		resp := h.Handle(processor.WithWarnings(pkg.WithTraceID(ctx, traceID)), req)
+		if resp.Header == nil {
+			resp.Header = make(http.Header)
+		}
+		resp.Header.Set("X-CS-TRACEID", traceID)
+		return resp
+	}
+}
+
+// tenanted carries the CID of the request on the context when multiTenant is set, so that the storage and search
+// clients only see the job history of that CID.  The CID is that of the workflow context of the request, or the
+// X-CS-CID header of requests made by users.
+func tenanted(h fdk.Handler) fdk.HandlerFn {
+	return func(ctx context.Context, req fdk.Request) fdk.Response {
+		if !multiTenant {
+			return h.Handle(ctx, req)
+		}
+		var wc fdk.WorkflowCtx
+		if len(req.Context) > 0 {
+			_ = json.Unmarshal(req.Context, &wc)
+		}
+		cid := strings.ToLower(strings.TrimSpace(wc.CID))
+		if cid == "" {
+			cid = strings.ToLower(strings.TrimSpace(req.Params.Header.Get("X-CS-CID")))
+		}
+		if cid == "" {
+			return fdk.Response{
+				Code:   http.StatusBadRequest,
+				Errors: []fdk.APIError{{Code: http.StatusBadRequest, Message: "request carries no CID"}},
+			}
+		}
+		return h.Handle(pkg.WithTenant(ctx, cid), req)
+	}
+}
+
+// requestLogger returns the logger of the request handled with ctx, which tags every line with its trace ID and
+// tenant.
+func requestLogger(ctx context.Context) logrus.FieldLogger {
+	l := logger
+	if traceID := pkg.TraceIDFromContext(ctx); traceID != "" {
+		l = l.WithField("trace_id", traceID)
+	}
+	if cid := pkg.TenantFromContext(ctx); cid != "" {
+		l = l.WithField("cid", cid)
+	}
+	return l
+}
+
+// limited rejects requests exceeding the rate or concurrency allowed by requestLimiter with a 429 response, whose
+// Retry-After header tells the workflow when to retry.
+func limited(h fdk.HandlerFn) fdk.HandlerFn {
+	return func(ctx context.Context, req fdk.Request) fdk.Response {
+		release, wait, ok := requestLimiter.Acquire()
+		if !ok {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			metrics.Default.Inc("requests_throttled_total", nil)
+			return fdk.Response{
+				Code:   http.StatusTooManyRequests,
+				Errors: []fdk.APIError{{Code: http.StatusTooManyRequests, Message: "too many requests"}},
+				Header: http.Header{"Retry-After": []string{strconv.Itoa(retryAfter)}},
+			}
+		}
+		defer release()
+		return h(ctx, req)
+	}
+}
+
+// authorized rejects the requests of callers lacking perm with a 403 response, see processor.Authorizer.  Only the
+// routes called by users alone are authorized; those with a workflow integration in the manifest, which
+// workflows call without a user, e.g. /retention and /evidence, are registered without it.
+func authorized(perm string, h fdk.HandlerFn) fdk.HandlerFn {
+	return func(ctx context.Context, req fdk.Request) fdk.Response {
+		fc, err := newFalconClient(ctx, req.AccessToken)
+		if err != nil {
+			msg := fmt.Sprintf("failed to initialize authorizer: %s", err)
+			logger.Error(msg)
+			return fdk.Response{
+				Errors: []fdk.APIError{{Code: 500, Message: msg}},
+			}
+		}
+		l := requestLogger(ctx)
+		a := processor.NewAuthorizer(newStorageClient(fc, req.AccessToken, l), l)
+		if resp, ok := a.Authorize(ctx, req, perm); !ok {
+			return asFDKResponse(ctx, resp)
+		}
+		return h(ctx, req)
+	}
+}
+
+// audited records the actor of the request on the context, to be saved in the audit records of any objects
+// h mutates.  Requests made on behalf of a user carry the user's name in the X-CS-USERNAME header; others
+// originate from workflows.
+func audited(h fdk.HandlerFn) fdk.HandlerFn {
+	return func(ctx context.Context, req fdk.Request) fdk.Response {
+		actor := "workflow"
+		if u := strings.TrimSpace(req.Params.Header.Get("X-CS-USERNAME")); u != "" {
+			actor = u
+		}
+		return h(auditc.WithActor(ctx, actor), req)
+	}
+}
+
+func responseCode(resp fdk.Response) int {
+	if resp.Code != 0 {
+		return resp.Code
+	}
+	if len(resp.Errors) > 0 {
+		return resp.Errors[0].Code
+	}
+	return http.StatusOK
+}
+
+// asFDKResponse converts the response of a processor, reporting the warnings of the request in its body.
+func asFDKResponse(ctx context.Context, resp processor.Response) fdk.Response {
+	if len(resp.Errs) > 0 {
+		return fdk.Response{
+			Code:   resp.Code,
+			Errors: resp.Errs,
+		}
+	}
+	if resp.Stream != nil {
+		contentType := resp.ContentType
+		if contentType == "" {
+			contentType = processor.NDJSONContentType
+		}
+		return fdk.Response{
+			Body:   resp.Stream,
+			Code:   resp.Code,
+			Header: http.Header{"Content-Type": []string{contentType}},
+		}
+	}
+	return fdk.Response{
+		Body: json.RawMessage(processor.WarningsBody(ctx, resp)),
+		Code: resp.Code,
+	}
+}
+
+func ensurePanicLogged() *fdk.Response {
+	p := recover()
+	if p == nil {
+		return nil
+	}
+
+	msg := ""
+	if s, ok := p.(fmt.Stringer); ok {
+		msg = fmt.Sprintf("fatal error: %s", s)
+	} else if e, ok := p.(error); ok {
+		msg = fmt.Sprintf("fatal error: %s", e.Error())
+	} else {
+		msg = fmt.Sprintf("fatal error: %v", p)
+	}
+	logger.Error(msg)
+	return &fdk.Response{
+		Code: 500,
+		Errors: []fdk.APIError{
+			{Code: 500, Message: msg},
+		},
+	}
+}
+
+func newFalconClient(ctx context.Context, token string) (*client.CrowdStrikeAPISpecification, error) {
+	config := &falcon.ApiConfig{
+		AccessToken: token,
+		Cloud:       falconCloud,
+		Context:     ctx,
+	}
+	if debug {
+		config.Debug = debug
+	}
+	fc, err := falcon.NewClient(config)
+	if err != nil {
+		err0 := fmt.Errorf("failed to create falcon client with error: %s", err)
+		logger.Error(err0)
+		return nil, err0
+	}
+	return fc, nil
+}
+
+func newSearchClient(fc *client.CrowdStrikeAPISpecification, l logrus.FieldLogger) searchc.SearchC {
+	return searchc.NewInstrumentedClient(searchc.NewClient(fc.SavedSearches, l, searchc.WithSearchTimeout(searchTimeout)), metrics.Default,
+		searchc.WithTracer(tracer))
+}
+
+func newStorageClient(fc *client.CrowdStrikeAPISpecification, token string, l logrus.FieldLogger) storagec.StorageC {
+	hc := http.DefaultClient
+	hc.Timeout = 10 * time.Second
+	strgc := storagec.NewInstrumentedClient(storagec.NewClient(fc.CustomStorage, hc, token, l,
+		storagec.WithCircuitBreaker(storageBreaker),
+		storagec.WithTimeouts(storageFetchTimeout, storagePutTimeout),
+		storagec.WithCompression(compressObjectsAbove, maxStorageObjectSize),
+		storagec.WithSharding(processor.ShardedFields, hostsPerShard)), metrics.Default,
+		storagec.WithTracer(tracer))
+	// objects are cached under the keys of their tenant, so the cache is shared by every tenant safely
+	cached := storagec.NewTenantClient(storagec.NewCachedClient(strgc, storageCache))
+	return auditc.NewAuditedStorage(storagec.NewSequencedClient(cached, collections.Counters, processor.SequencedCollections),
+		auditc.NewClient(storagec.NewTenantClient(strgc), auditc.WithCollection(collections.AuditTrail)),
+		processor.AuditedCollections, l)
+}
+
+func newWorkflowClient(fc *client.CrowdStrikeAPISpecification, l logrus.FieldLogger, opts ...func(c *workflowc.Client)) workflowc.WorkflowC {
+	return workflowc.NewClient(fc.Workflows, l, opts...)
+}
+
+// newDefinitionsClient returns a workflow client which can also manage workflow definitions, using the access token
+// of the request.
+func newDefinitionsClient(fc *client.CrowdStrikeAPISpecification, l logrus.FieldLogger, token string) workflowc.WorkflowC {
+	hc := &http.Client{Timeout: 10 * time.Second}
+	return newWorkflowClient(fc, l, workflowc.WithDefinitionActions(hc, falconCloud.Host(), token))
+}
+
+func newFileClient(l logrus.FieldLogger, token string) filec.FileC {
+	hc := &http.Client{Timeout: 30 * time.Second}
+	return filec.NewClient(hc, falconCloud.Host(), token, l)
+}
+
+func newHostClient(fc *client.CrowdStrikeAPISpecification, l logrus.FieldLogger) hostsc.HostC {
+	return hostsc.NewClient(fc.Hosts, l)
+}
+
+func newNotifier(fc *client.CrowdStrikeAPISpecification, l logrus.FieldLogger) notifier.Notifier {
+	hc := &http.Client{Timeout: 10 * time.Second}
+	return notifier.NewClient(newWorkflowClient(fc, l), hc, l)
+}
+
+// newConnector returns the factory of the webhook connectors opening the tickets of failing jobs.
+func newConnector(l logrus.FieldLogger) processor.ConnectorFactory {
+	hc := &http.Client{Timeout: 10 * time.Second}
+	return func(cfg connector.WebhookConfig) connector.Connector {
+		return connector.NewWebhookConnector(hc, cfg, l)
+	}
+}
+
+func newExecutionsProcessor(ctx context.Context, token string) (*processor.ExecutionsProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strg := newStorageClient(fc, token, l)
+	return processor.NewExecutionsProcessor(strg, l), nil
+}
+
+func newQueryExecutionsProcessor(ctx context.Context, token string) (*processor.QueryExecutionsProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strg := newStorageClient(fc, token, l)
+	return processor.NewQueryExecutionsProcessor(strg, l), nil
+}
+
+func newChangesProcessor(ctx context.Context, token string) (*processor.ChangesProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	return processor.NewChangesProcessor(newStorageClient(fc, token, l), l), nil
+}
+
+func newUpsertProcessor(ctx context.Context, token string) (*processor.UpsertProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	srchc := newSearchClient(fc, l)
+	strgc := newStorageClient(fc, token, l)
+	ntfr := newNotifier(fc, l)
+	wfc := newDefinitionsClient(fc, l, token)
+	hstc := newHostClient(fc, l)
+
+	opts := []func(p *processor.UpsertProcessor){
+		processor.WithNotifier(ntfr),
+		processor.WithWorkflowClient(wfc),
+		processor.WithHostClient(hstc),
+		processor.WithSavedSearches(savedSearches),
+		processor.WithSearchPolling(10*time.Second, time.Minute),
+		processor.WithLogRedaction(redactedFields),
+		processor.WithJobIDs(newJobIDs(strgc)),
+		processor.WithOutputPolicy(outputPolicy),
+		processor.WithSessionCeiling(rtrSessionCeiling),
+		processor.WithConnectors(newConnector(l)),
+	}
+	if alertWorkflowID != "" && alertFailurePercent > 0 {
+		opts = append(opts, processor.WithFailureAlerting(alertc.NewClient(wfc, alertWorkflowID, l), alertFailurePercent))
+	}
+	if siemCollector != "" {
+		e, err := siem.NewClient(siemCollector, siemFormat, &http.Client{Timeout: 10 * time.Second}, l,
+			siem.WithAuthHeader(siemAuthHeader))
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, processor.WithSIEMEmitter(e))
+	}
+	if debug {
+		opts = append(opts, processor.WithRawBodyLogging())
+	}
+	if strictDecoding {
+		opts = append(opts, processor.WithStrictDecoding())
+	}
+	if disableExpiredWorkflows {
+		opts = append(opts, processor.WithExpiredWorkflowDisabling())
+	}
+	return processor.NewUpsertProcessor(falconHost, srchc, strgc, l, opts...), nil
+}
+
+func newRerunProcessor(ctx context.Context, token string) (*processor.RerunProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	wfc := newWorkflowClient(fc, l)
+
+	return processor.NewRerunProcessor(strgc, wfc, l), nil
+}
+
+func newReprocessProcessor(ctx context.Context, token string) (*processor.ReprocessProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	srchc := newSearchClient(fc, l)
+	strgc := newStorageClient(fc, token, l)
+	return processor.NewReprocessProcessor(srchc, strgc, l,
+		processor.WithReprocessSavedSearches(savedSearches),
+		processor.WithReprocessOutputPolicy(outputPolicy),
+	), nil
+}
+
+func newRetentionProcessor(ctx context.Context, token string) (*processor.RetentionProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	return processor.NewRetentionProcessor(strgc, l), nil
+}
+
+func newStatsProcessor(ctx context.Context, token string) (*processor.StatsProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	return processor.NewStatsProcessor(strgc, l), nil
+}
+
+func newExecutionDiffProcessor(ctx context.Context, token string) (*processor.ExecutionDiffProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	return processor.NewExecutionDiffProcessor(strgc, l), nil
+}
+
+func newBaselineProcessor(ctx context.Context, token string) (*processor.BaselineProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	return processor.NewBaselineProcessor(strgc, l), nil
+}
+
+func newBaselineCheckProcessor(ctx context.Context, token string) (*processor.BaselineCheckProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	return processor.NewBaselineCheckProcessor(strgc, l), nil
+}
+
+func newHostSummaryProcessor(ctx context.Context, token string) (*processor.HostSummaryProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	return processor.NewHostSummaryProcessor(strgc, newHostClient(fc, l), l), nil
+}
+
+func newSearchJobsProcessor(ctx context.Context, token string) (*processor.SearchJobsProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	return processor.NewSearchJobsProcessor(strgc, l), nil
+}
+
+func newCalendarProcessor(ctx context.Context, token string) (*processor.CalendarProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	return processor.NewCalendarProcessor(strgc, l), nil
+}
+
+func newICalendarProcessor(ctx context.Context, token string) (*processor.ICalendarProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	return processor.NewICalendarProcessor(strgc, l), nil
+}
+
+func newDeleteJobProcessor(ctx context.Context, token string) (*processor.DeleteJobProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	wfc := newDefinitionsClient(fc, l, token)
+	opts := []func(p *processor.DeleteJobProcessor){processor.WithDeleteJobWorkflowClient(wfc)}
+	if foldJobNameCase {
+		opts = append(opts, processor.WithDeleteJobNameCaseFolding())
+	}
+	return processor.NewDeleteJobProcessor(strgc, l, opts...), nil
+}
+
+func newHostOutputProcessor(ctx context.Context, token string) (*processor.HostOutputProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	return processor.NewHostOutputProcessor(strgc, l), nil
+}
+
+func newAttachEvidenceProcessor(ctx context.Context, token string) (*processor.AttachEvidenceProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	return processor.NewAttachEvidenceProcessor(strgc, l), nil
+}
+
+func newEvidenceProcessor(ctx context.Context, token string) (*processor.EvidenceProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	return processor.NewEvidenceProcessor(strgc, l), nil
+}
+
+func newUploadPutFileProcessor(ctx context.Context, token string) (*processor.UploadPutFileProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	return processor.NewUploadPutFileProcessor(strgc, newFileClient(l, token), l), nil
+}
+
+func newPutFilesProcessor(ctx context.Context, token string) (*processor.PutFilesProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	return processor.NewPutFilesProcessor(strgc, l), nil
+}
+
+func newDeletePutFileProcessor(ctx context.Context, token string) (*processor.DeletePutFileProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	return processor.NewDeletePutFileProcessor(strgc, newFileClient(l, token), l), nil
+}
+
+func newStartRolloutProcessor(ctx context.Context, token string) (*processor.StartRolloutProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	return processor.NewStartRolloutProcessor(strgc, newWorkflowClient(fc, l), newHostClient(fc, l), l), nil
+}
+
+func newRolloutsProcessor(ctx context.Context, token string) (*processor.RolloutsProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	return processor.NewRolloutsProcessor(strgc, l), nil
+}
+
+func newAdvanceRolloutsProcessor(ctx context.Context, token string) (*processor.AdvanceRolloutsProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	return processor.NewAdvanceRolloutsProcessor(strgc, newWorkflowClient(fc, l), l), nil
+}
+
+func newReleaseDeferredProcessor(ctx context.Context, token string) (*processor.ReleaseDeferredProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	return processor.NewReleaseDeferredProcessor(strgc, newWorkflowClient(fc, l), l), nil
+}
+
+func newAnnotateExecutionProcessor(ctx context.Context, token string) (*processor.AnnotateExecutionProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	return processor.NewAnnotateExecutionProcessor(strgc, l), nil
+}
+
+func newImportExecutionProcessor(ctx context.Context, token string) (*processor.ImportExecutionProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	return processor.NewImportExecutionProcessor(strgc, l,
+		processor.WithImportJobIDs(newJobIDs(strgc)),
+		processor.WithImportOutputPolicy(outputPolicy),
+	), nil
+}
+
+func newRenameJobProcessor(ctx context.Context, token string) (*processor.RenameJobProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	opts := make([]func(p *processor.RenameJobProcessor), 0)
+	if foldJobNameCase {
+		opts = append(opts, processor.WithRenameJobNameCaseFolding())
+	}
+	return processor.NewRenameJobProcessor(strgc, l, opts...), nil
+}
+
+func newPauseProcessor(ctx context.Context, token string, paused bool) (*processor.PauseProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	wfc := newDefinitionsClient(fc, l, token)
+	return processor.NewPauseProcessor(paused, strgc, l, processor.WithPauseWorkflowClient(wfc)), nil
+}
+
+func newEnrichmentProcessor(ctx context.Context, token string) (*processor.EnrichmentProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	srchc := newSearchClient(fc, l)
+	strgc := newStorageClient(fc, token, l)
+	return processor.NewEnrichmentProcessor(srchc, strgc, l,
+		processor.WithEnrichmentSavedSearches(savedSearches),
+		processor.WithEnrichmentOutputPolicy(outputPolicy),
+	), nil
+}
+
+func newHealthProcessor(ctx context.Context, token string) (*processor.HealthProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	return processor.NewHealthProcessor(newSearchClient(fc, l), newStorageClient(fc, token, l), l), nil
+}
+
+func newSelfTestProcessor(ctx context.Context, token string) (*processor.SelfTestProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	srchc := newSearchClient(fc, l)
+	strgc := newStorageClient(fc, token, l)
+	// the synthetic job has no targets, notification targets or queued executions, so the upsert needs no other client
+	upsert := processor.NewUpsertProcessor(falconHost, srchc, strgc, l,
+		processor.WithSavedSearches(savedSearches),
+		processor.WithJobIDs(newJobIDs(strgc)),
+		processor.WithOutputPolicy(outputPolicy),
+	)
+	return processor.NewSelfTestProcessor(upsert, srchc, strgc, l), nil
+}
+
+func newBackfillProcessor(ctx context.Context, token string) (*processor.BackfillProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	srchc := newSearchClient(fc, l)
+	strgc := newStorageClient(fc, token, l)
+	return processor.NewBackfillProcessor(srchc, strgc, l,
+		processor.WithBackfillSavedSearches(savedSearches),
+		processor.WithBackfillJobIDs(newJobIDs(strgc)),
+		processor.WithBackfillOutputPolicy(outputPolicy),
+	), nil
+}
+
+func newDigestProcessor(ctx context.Context, token string) (*processor.DigestProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	ntfr := newNotifier(fc, l)
+	return processor.NewDigestProcessor(strgc, l, processor.WithDigestNotifier(ntfr)), nil
+}
+
+func newMissedRunsProcessor(ctx context.Context, token string) (*processor.MissedRunsProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	ntfr := newNotifier(fc, l)
+	return processor.NewMissedRunsProcessor(strgc, l, processor.WithMissedRunsNotifier(ntfr)), nil
+}
+
+func newReaperProcessor(ctx context.Context, token string) (*processor.ReaperProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	srchc := newSearchClient(fc, l)
+	strgc := newStorageClient(fc, token, l)
+	upsert, err := newUpsertProcessor(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return processor.NewReaperProcessor(srchc, strgc, l,
+		processor.WithReaperSavedSearches(savedSearches),
+		processor.WithReaperTimeout(staleExecutionTimeout),
+		processor.WithReaperHooks(upsert),
+		processor.WithReaperOutputPolicy(outputPolicy),
+	), nil
+}
+
+func newReconcileWorkflowsProcessor(ctx context.Context, token string) (*processor.ReconcileWorkflowsProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	return processor.NewReconcileWorkflowsProcessor(strgc, newDefinitionsClient(fc, l, token), l), nil
+}
+
+func newValidatePayloadProcessor(ctx context.Context, token string) (*processor.ValidatePayloadProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	var opts []func(p *processor.ValidatePayloadProcessor)
+	if strictDecoding {
+		opts = append(opts, processor.WithPayloadStrictDecoding())
+	}
+	return processor.NewValidatePayloadProcessor(newStorageClient(fc, token, l), l, opts...), nil
+}
+
+func newSyncProcessor(ctx context.Context, token string) (*processor.SyncProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	opts := []func(p *processor.SyncProcessor){processor.WithSyncJobIDs(newJobIDs(strgc))}
+	if foldJobNameCase {
+		opts = append(opts, processor.WithSyncJobNameCaseFolding())
+	}
+	return processor.NewSyncProcessor(strgc, newDefinitionsClient(fc, l, token), l, opts...), nil
+}
+
+func newReconcileProcessor(ctx context.Context, token string) (*processor.ReconcileProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	return processor.NewReconcileProcessor(strgc, newDefinitionsClient(fc, l, token), l,
+		processor.WithReconcileNamePrefix(workflowNamePrefix),
+	), nil
+}
+
+func newMigrateJobIDsProcessor(ctx context.Context, token string) (*processor.MigrateJobIDsProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	opts := make([]func(p *processor.MigrateJobIDsProcessor), 0)
+	if foldJobNameCase {
+		opts = append(opts, processor.WithMigrationJobNameCaseFolding())
+	}
+	return processor.NewMigrateJobIDsProcessor(strgc, l, opts...), nil
+}
+
+// newJobIDs returns the configured strategy resolving the IDs of jobs from their names.
+func newJobIDs(strgc storagec.StorageC) processor.JobIDs {
+	if jobIDStrategy == processor.JobIDStrategyUUID {
+		return processor.NewIndexedJobIDs(strgc, foldJobNameCase)
+	}
+	return processor.NewHashJobIDs(strgc, foldJobNameCase)
+}
+
+func newQueryAuditProcessor(ctx context.Context, token string) (*processor.QueryAuditProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	return processor.NewQueryAuditProcessor(strgc, l), nil
+}
+
+func newFunctionStatsProcessor(ctx context.Context, token string) (*processor.FunctionStatsProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	return processor.NewFunctionStatsProcessor(strgc, l), nil
+}
+
+func newSettingsProcessor(ctx context.Context, token string) (*processor.SettingsProcessor, error) {
+	fc, err := newFalconClient(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	l := requestLogger(ctx)
+	strgc := newStorageClient(fc, token, l)
+	return processor.NewSettingsProcessor(strgc, l), nil
 }
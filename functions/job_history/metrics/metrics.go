@@ -0,0 +1,183 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default is the registry shared by the clients and processors of the function.
+var Default = NewRegistry()
+
+// latencyBuckets are the upper bounds, in seconds, of the latency histogram buckets.
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// Labels qualify a metric, such as the operation or the outcome of a call.
+type Labels map[string]string
+
+// Registry is a collection of counters and latency histograms.  It is safe for concurrent use.
+type Registry struct {
+	mu         sync.Mutex
+	counters   map[string]*CounterValue
+	histograms map[string]*HistogramValue
+}
+
+// NewRegistry returns a new and empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		counters:   make(map[string]*CounterValue),
+		histograms: make(map[string]*HistogramValue),
+	}
+}
+
+// Inc increments the named counter by one.
+func (r *Registry) Inc(name string, labels Labels) {
+	r.Add(name, labels, 1)
+}
+
+// Add increments the named counter by n.
+func (r *Registry) Add(name string, labels Labels, n int64) {
+	k := key(name, labels)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.counters[k]
+	if !ok {
+		c = &CounterValue{Name: name, Labels: copyLabels(labels)}
+		r.counters[k] = c
+	}
+	c.Value += n
+}
+
+// Observe records a duration in the named latency histogram.
+func (r *Registry) Observe(name string, labels Labels, d time.Duration) {
+	k := key(name, labels)
+	secs := d.Seconds()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h, ok := r.histograms[k]
+	if !ok {
+		h = &HistogramValue{Name: name, Labels: copyLabels(labels), Buckets: make([]Bucket, len(latencyBuckets))}
+		for i, b := range latencyBuckets {
+			h.Buckets[i].UpperBound = b
+		}
+		r.histograms[k] = h
+	}
+	h.Count++
+	h.Sum += secs
+	for i := range h.Buckets {
+		if secs <= h.Buckets[i].UpperBound {
+			h.Buckets[i].Count++
+		}
+	}
+}
+
+// Since records the time elapsed since start in the named latency histogram.
+func (r *Registry) Since(name string, labels Labels, start time.Time) {
+	r.Observe(name, labels, time.Since(start))
+}
+
+// Snapshot returns a copy of the current value of every metric, ordered by name and labels.
+func (r *Registry) Snapshot() Snapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := Snapshot{
+		Counters:   make([]CounterValue, 0, len(r.counters)),
+		Histograms: make([]HistogramValue, 0, len(r.histograms)),
+	}
+	for _, k := range sortedKeys(r.counters) {
+		s.Counters = append(s.Counters, *r.counters[k])
+	}
+	for _, k := range sortedKeys(r.histograms) {
+		h := *r.histograms[k]
+		h.Buckets = append([]Bucket(nil), h.Buckets...)
+		s.Histograms = append(s.Histograms, h)
+	}
+	return s
+}
+
+// Snapshot is a point in time copy of the metrics of a Registry.
+type Snapshot struct {
+	// Counters are the counter values.
+	Counters []CounterValue `json:"counters"`
+	// Histograms are the latency histograms.
+	Histograms []HistogramValue `json:"histograms"`
+}
+
+// CounterValue is the value of a counter.
+type CounterValue struct {
+	// Name is the name of the counter.
+	Name string `json:"name"`
+	// Labels qualify the counter.
+	Labels Labels `json:"labels,omitempty"`
+	// Value is the current count.
+	Value int64 `json:"value"`
+}
+
+// Key identifies the counter by its name and labels, e.g. to compare it across snapshots.
+func (c CounterValue) Key() string {
+	return key(c.Name, c.Labels)
+}
+
+// HistogramValue is the value of a latency histogram.
+type HistogramValue struct {
+	// Name is the name of the histogram.
+	Name string `json:"name"`
+	// Labels qualify the histogram.
+	Labels Labels `json:"labels,omitempty"`
+	// Buckets are the cumulative counts of observations less than or equal to each upper bound.
+	Buckets []Bucket `json:"buckets"`
+	// Count is the number of observations.
+	Count int64 `json:"count"`
+	// Sum is the sum of all observations in seconds.
+	Sum float64 `json:"sum"`
+}
+
+// Bucket is a single histogram bucket.
+type Bucket struct {
+	// Count is the number of observations less than or equal to UpperBound.
+	Count int64 `json:"count"`
+	// UpperBound is the inclusive upper bound of the bucket in seconds.
+	UpperBound float64 `json:"le"`
+}
+
+// Outcome returns a label value describing the result of a call.
+func Outcome(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	return "error"
+}
+
+func key(name string, labels Labels) string {
+	var sb strings.Builder
+	sb.WriteString(name)
+	for _, k := range sortedKeys(labels) {
+		sb.WriteString("|")
+		sb.WriteString(k)
+		sb.WriteString("=")
+		sb.WriteString(labels[k])
+	}
+	return sb.String()
+}
+
+func copyLabels(labels Labels) Labels {
+	if len(labels) == 0 {
+		return nil
+	}
+	c := make(Labels, len(labels))
+	for k, v := range labels {
+		c[k] = v
+	}
+	return c
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
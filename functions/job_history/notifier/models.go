@@ -0,0 +1,107 @@
+package notifier
+
+import (
+	"strings"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+)
+
+const (
+	// TypeWebhook is a target to which the summary is POSTed as JSON.
+	TypeWebhook = "webhook"
+	// TypeWorkflow is a target Fusion workflow which is executed with the summary as its payload.
+	TypeWorkflow = "workflow"
+)
+
+// Target is a destination to which execution summaries are delivered.
+type Target struct {
+	// Statuses are the execution statuses which trigger a notification.  Defaults to Completed, CompletedWithErrors, Failed and TimedOut.
+	Statuses []string `json:"statuses,omitempty"`
+	// Type is either TypeWebhook or TypeWorkflow.
+	Type string `json:"type"`
+	// URL is the URL of a webhook target.
+	URL string `json:"url,omitempty"`
+	// WorkflowID is the definition ID of a workflow target.
+	WorkflowID string `json:"workflow_id,omitempty"`
+}
+
+// Subscribed reports whether the target is notified of executions with the given status.
+func (t Target) Subscribed(status string) bool {
+	statuses := t.Statuses
+	if len(statuses) == 0 {
+		statuses = []string{pkg.StatusCompleted, pkg.StatusCompletedWithErrors, pkg.StatusFailed, pkg.StatusTimedOut}
+	}
+	for _, s := range statuses {
+		if strings.EqualFold(s, status) {
+			return true
+		}
+	}
+	return false
+}
+
+// Summary is a summary of a job execution.
+type Summary struct {
+	// Duration is the number of hours, minutes, and seconds the job ran.
+	Duration string `json:"duration"`
+	// EndDate is the timestamp at which the job stopped executing.
+	EndDate string `json:"end_date"`
+	// ExecutionID is the workflow execution ID.
+	ExecutionID string `json:"execution_id"`
+	// FailedHosts is the number of hosts on which the job failed.
+	FailedHosts int `json:"failed_hosts"`
+	// Hosts are the per host results of the execution.
+	Hosts []HostResult `json:"hosts"`
+	// JobID is the ID of the job.
+	JobID string `json:"job_id"`
+	// JobName is the name of the job.
+	JobName string `json:"job_name"`
+	// NumHosts is the number of hosts the job ran against.
+	NumHosts int `json:"num_hosts"`
+	// RunDate is the timestamp at which the job began running.
+	RunDate string `json:"run_date"`
+	// Status is the status of the execution.
+	Status string `json:"status"`
+}
+
+// HostResult is the result of an execution on a single host.
+type HostResult struct {
+	// DeviceID is the ID of the device.
+	DeviceID string `json:"device_id,omitempty"`
+	// Error is a description of why execution failed on the host.
+	Error string `json:"error,omitempty"`
+	// HostName is the name of the host.
+	HostName string `json:"host_name"`
+	// Status is the status of the execution on the host.
+	Status string `json:"status"`
+}
+
+// NewSummary summarizes a job execution.
+func NewSummary(je pkg.JobExecution) Summary {
+	jobID := je.JobID
+	if jobID == "" {
+		jobID = je.ID
+	}
+	s := Summary{
+		Duration:    je.Duration,
+		EndDate:     je.EndDate,
+		ExecutionID: je.ExecutionID,
+		Hosts:       make([]HostResult, len(je.TargetedHosts)),
+		JobID:       jobID,
+		JobName:     je.JobName,
+		NumHosts:    je.NumHosts,
+		RunDate:     je.RunDate,
+		Status:      je.RunStatus,
+	}
+	for i, h := range je.TargetedHosts {
+		s.Hosts[i] = HostResult{
+			DeviceID: h.DeviceID,
+			Error:    h.Error,
+			HostName: h.HostName,
+			Status:   h.Status,
+		}
+		if h.Status == pkg.StatusFailed {
+			s.FailedHosts++
+		}
+	}
+	return s
+}
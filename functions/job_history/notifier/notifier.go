@@ -0,0 +1,193 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/workflowc"
+	"github.com/eapache/go-resiliency/retrier"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// SignatureHeader carries the HMAC-SHA256 signature of a callback, in the form "sha256=<hex>".
+	SignatureHeader = "X-Rapid-Response-Signature"
+	// TimestampHeader carries the unix time at which a callback was signed.
+	TimestampHeader = "X-Rapid-Response-Timestamp"
+)
+
+// Notifier delivers job execution summaries to notification targets.
+type Notifier interface {
+	// Callback POSTs the summary to a callback URL, signed with the given secret unless it is blank.
+	Callback(ctx context.Context, url, secret string, s Summary) error
+	// Notify delivers the summary to each of the targets subscribed to its status.
+	Notify(ctx context.Context, targets []Target, s Summary) error
+	// Post POSTs v as JSON to a webhook URL.
+	Post(ctx context.Context, url string, v any) error
+}
+
+// Client is the client.
+type Client struct {
+	backoff []time.Duration
+	clock   pkg.Clock
+	hc      *http.Client
+	logger  logrus.FieldLogger
+	wfc     workflowc.WorkflowC
+}
+
+var _ Notifier = (*Client)(nil)
+
+// NewClient returns a new notifier client.
+func NewClient(wfc workflowc.WorkflowC, hc *http.Client, logger logrus.FieldLogger, opts ...func(c *Client)) *Client {
+	c := &Client{
+		backoff: retrier.ExponentialBackoff(3, 500*time.Millisecond),
+		clock:   pkg.SystemClock,
+		hc:      hc,
+		logger:  logger,
+		wfc:     wfc,
+	}
+
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+func (c *Client) Callback(ctx context.Context, url, secret string, s Summary) error {
+	payload, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to serialize execution summary: %s", err)
+	}
+	if err = c.postWebhook(ctx, url, payload, secret); err != nil {
+		return err
+	}
+	c.logger.WithField("execution_id", s.ExecutionID).
+		WithField("status", s.Status).
+		Info("callback delivered")
+	return nil
+}
+
+func (c *Client) Notify(ctx context.Context, targets []Target, s Summary) error {
+	payload, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to serialize execution summary: %s", err)
+	}
+
+	errs := make([]error, 0)
+	for i, t := range targets {
+		if !t.Subscribed(s.Status) {
+			continue
+		}
+		switch t.Type {
+		case TypeWebhook:
+			err = c.postWebhook(ctx, t.URL, payload, "")
+		case TypeWorkflow:
+			err = c.executeWorkflow(ctx, t.WorkflowID, payload)
+		default:
+			err = fmt.Errorf("unsupported target type %q", t.Type)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("target at index %d: %s", i, err))
+			continue
+		}
+		c.logger.WithField("execution_id", s.ExecutionID).
+			WithField("target_type", t.Type).
+			Info("notification delivered")
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Client) Post(ctx context.Context, url string, v any) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to serialize payload: %s", err)
+	}
+	return c.postWebhook(ctx, url, payload, "")
+}
+
+func (c *Client) executeWorkflow(ctx context.Context, definitionID string, payload []byte) error {
+	_, err := c.wfc.Execute(ctx, workflowc.ExecuteRequest{
+		DefinitionID: definitionID,
+		Payload:      payload,
+	})
+	return err
+}
+
+// postWebhook POSTs the payload to url, retrying network errors and 429 and 5xx responses.
+func (c *Client) postWebhook(ctx context.Context, url string, payload []byte, secret string) error {
+	if url == "" {
+		return errors.New("missing webhook URL")
+	}
+	r := retrier.New(c.backoff, retryableClassifier{})
+	r.SetJitter(0.25)
+	return r.RunCtx(ctx, func(ctx context.Context) error {
+		return c.post(ctx, url, payload, secret)
+	})
+}
+
+func (c *Client) post(ctx context.Context, url string, payload []byte, secret string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		ts := strconv.FormatInt(c.clock.Now().Unix(), 10)
+		req.Header.Set(TimestampHeader, ts)
+		req.Header.Set(SignatureHeader, "sha256="+sign(secret, ts, payload))
+	}
+
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return retryableError{fmt.Errorf("failed to issue HTTP request: %s", err)}
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+		return retryableError{fmt.Errorf("webhook responded with status %d", resp.StatusCode)}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sign computes the hex encoded HMAC-SHA256 of "<timestamp>.<payload>".  Receivers verify the signature
+// and reject stale timestamps to guard against replayed callbacks.
+func sign(secret, ts string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// retryableError marks an error as worth retrying.
+type retryableError struct {
+	error
+}
+
+type retryableClassifier struct{}
+
+func (retryableClassifier) Classify(err error) retrier.Action {
+	if err == nil {
+		return retrier.Succeed
+	}
+	var re retryableError
+	if errors.As(err, &re) {
+		return retrier.Retry
+	}
+	return retrier.Fail
+}
@@ -0,0 +1,22 @@
+package pkg
+
+import "time"
+
+// Clock tells the current time.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+}
+
+// ClockFunc adapts a function returning the current time to a Clock.
+type ClockFunc func() time.Time
+
+// Now returns the result of calling f.
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// SystemClock is the Clock of the system, in UTC.
+var SystemClock Clock = ClockFunc(func() time.Time {
+	return time.Now().UTC()
+})
@@ -4,7 +4,11 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
 	"regexp"
+	"sort"
 	"strings"
 )
 
@@ -33,19 +37,77 @@ func DecodeBase64JSON(data []byte) ([]byte, error) {
 
 // NormalizeJobStatus converts a string containing a believed job status into a string expected by this app.
 func NormalizeJobStatus(status string) string {
-	status = strings.ToLower(strings.TrimSpace(status))
-	status = nonAlphaNumericRE.ReplaceAllString(status, "")
+	status = statusKey(status)
 	switch status {
 	case StatusCompleted, "succeeded":
 		return StatusCompleted
+	case "completedwitherrors":
+		return StatusCompletedWithErrors
 	case "inprogress", "progress":
 		return StatusInProgress
 	case "failed":
 		return StatusFailed
+	case "timedout":
+		return StatusTimedOut
+	case StatusSkipped, StatusQueued, StatusReleased, StatusDeferred:
+		return status
 	}
 	return ""
 }
 
+// StatusMapping maps the statuses emitted by customized workflows to statuses expected by this app, extending the
+// vocabulary of NormalizeJobStatus.  Statuses are looked up ignoring case and non-alphanumeric characters.
+type StatusMapping map[string]string
+
+// NewStatusMapping returns the mapping of the keys of m to the statuses they are mapped to.  Keys mapped to a
+// status which NormalizeJobStatus does not understand are dropped.
+func NewStatusMapping(m map[string]string) StatusMapping {
+	sm := make(StatusMapping, len(m))
+	for from, to := range m {
+		if to = NormalizeJobStatus(to); to != "" {
+			sm[statusKey(from)] = to
+		}
+	}
+	return sm
+}
+
+// Normalize converts a string containing a believed job status into a string expected by this app, falling back
+// to NormalizeJobStatus for the statuses which are not mapped.
+func (m StatusMapping) Normalize(status string) string {
+	if to, ok := m[statusKey(status)]; ok {
+		return to
+	}
+	return NormalizeJobStatus(status)
+}
+
+// statusKey returns the key by which a status is looked up, ignoring case and non-alphanumeric characters.
+func statusKey(status string) string {
+	return nonAlphaNumericRE.ReplaceAllString(strings.ToLower(strings.TrimSpace(status)), "")
+}
+
+// NormalizePlatform converts a string containing a believed platform name into the Falcon platform name, or
+// returns an empty string if it is not a known platform.
+func NormalizePlatform(platform string) string {
+	switch strings.ToLower(strings.TrimSpace(platform)) {
+	case "windows", "win":
+		return PlatformWindows
+	case "linux":
+		return PlatformLinux
+	case "mac", "macos", "osx":
+		return PlatformMac
+	}
+	return ""
+}
+
+// IsFinished returns true if the status is that of a job which has stopped executing.
+func IsFinished(status string) bool {
+	switch status {
+	case StatusCompleted, StatusCompletedWithErrors, StatusFailed, StatusTimedOut:
+		return true
+	}
+	return false
+}
+
 // DecodeJobExecution converts a byte slice into a JobExecution instance.
 func DecodeJobExecution(data []byte) (JobExecution, error) {
 	var j JobExecution
@@ -62,3 +124,111 @@ func DecodeJobExecution(data []byte) (JobExecution, error) {
 
 	return j, nil
 }
+
+// UnknownFields is a dedicated error indicating that strictly decoded data has fields its type has no field for.
+var UnknownFields = errors.New("unknown fields")
+
+// DecodeJSON decodes data into v, returning the paths of the fields of data which v has no field for, sorted,
+// e.g. "targeted_hosts[].vendor".  Those fields are ignored, unless strict is true: the decoding then fails on
+// them, as with json.Decoder.DisallowUnknownFields.
+func DecodeJSON(data []byte, v any, strict bool) ([]string, error) {
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	unknown := make(map[string]bool)
+	unknownFields("", raw, reflect.TypeOf(v), unknown)
+	paths := make([]string, 0, len(unknown))
+	for p := range unknown {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(v); err != nil {
+		if strict && len(paths) > 0 {
+			return paths, fmt.Errorf("%w: %s", UnknownFields, strings.Join(paths, ", "))
+		}
+		return paths, err
+	}
+	return paths, nil
+}
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// unknownFields records the paths of the object fields of raw which have no field of type t to be decoded into.
+// Values decoded by their own UnmarshalJSON, or into interfaces, accept any field.
+func unknownFields(path string, raw any, t reflect.Type, unknown map[string]bool) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Interface || reflect.PointerTo(t).Implements(unmarshalerType) {
+		return
+	}
+	switch val := raw.(type) {
+	case map[string]any:
+		switch t.Kind() {
+		case reflect.Struct:
+			fields := jsonFields(t, make(map[string]reflect.Type))
+			for k, v := range val {
+				ft, ok := fields[strings.ToLower(k)]
+				if !ok {
+					unknown[joinPath(path, k)] = true
+					continue
+				}
+				unknownFields(joinPath(path, k), v, ft, unknown)
+			}
+		case reflect.Map:
+			for k, v := range val {
+				unknownFields(joinPath(path, k), v, t.Elem(), unknown)
+			}
+		}
+	case []any:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for _, v := range val {
+				unknownFields(path+"[]", v, t.Elem(), unknown)
+			}
+		}
+	}
+}
+
+// jsonFields maps the lower-cased JSON names of the fields of a struct type to their types, including those of
+// embedded structs, as encoding/json matches names case-insensitively.
+func jsonFields(t reflect.Type, fields map[string]reflect.Type) map[string]reflect.Type {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		if f.Anonymous && name == "" {
+			for ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				jsonFields(ft, fields)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[strings.ToLower(name)] = ft
+	}
+	return fields
+}
+
+func joinPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
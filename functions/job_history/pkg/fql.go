@@ -48,6 +48,20 @@ type Filter struct {
 	Op Operator
 }
 
+// EscapeFQLValue escapes the backslashes and single quotes of a value, so it can be quoted in an FQL filter.
+func EscapeFQLValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(value)
+}
+
+// clause renders the filter as an FQL clause, with its value escaped.
+func (f Filter) clause() (string, error) {
+	field := strings.TrimSpace(f.Field)
+	if field == "" {
+		return "", errors.New("blank field")
+	}
+	return fmt.Sprintf("%s:%s'%s'", field, f.Op, EscapeFQLValue(strings.TrimSpace(f.Value))), nil
+}
+
 // NewFQLQuery constructs a new FQL query, and-ing all the filter arguments together.
 func NewFQLQuery(filters []Filter) (string, error) {
 	if len(filters) == 0 {
@@ -56,15 +70,11 @@ func NewFQLQuery(filters []Filter) (string, error) {
 	elems := make([]string, 0, len(filters))
 	errs := make([]error, 0, len(filters))
 	for i, f := range filters {
-		field := strings.TrimSpace(f.Field)
-		if field == "" {
-			err := fmt.Errorf("filter at index %d has blank field", i)
-			errs = append(errs, err)
+		elem, err := f.clause()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("filter at index %d has %w", i, err))
 			continue
 		}
-
-		value := strings.TrimSpace(f.Value)
-		elem := fmt.Sprintf("%s:%s'%s'", field, f.Op, value)
 		elems = append(elems, elem)
 	}
 
@@ -74,6 +84,69 @@ func NewFQLQuery(filters []Filter) (string, error) {
 	return strings.Join(elems, "+"), nil
 }
 
+// QueryBuilder builds an FQL query out of optional clauses, and-ed together.  Values are escaped when rendered.
+type QueryBuilder struct {
+	clauses []string
+	errs    []error
+}
+
+// add renders the filters as a clause, or-ing them together.
+func (b *QueryBuilder) add(filters ...Filter) *QueryBuilder {
+	elems := make([]string, 0, len(filters))
+	for _, f := range filters {
+		elem, err := f.clause()
+		if err != nil {
+			b.errs = append(b.errs, err)
+			return b
+		}
+		elems = append(elems, elem)
+	}
+	switch len(elems) {
+	case 0:
+	case 1:
+		b.clauses = append(b.clauses, elems[0])
+	default:
+		b.clauses = append(b.clauses, "("+strings.Join(elems, ",")+")")
+	}
+	return b
+}
+
+// Where adds a filter on the field, unless the value is blank.
+func (b *QueryBuilder) Where(field string, op Operator, value string) *QueryBuilder {
+	if strings.TrimSpace(value) == "" {
+		return b
+	}
+	return b.add(Filter{Field: field, Op: op, Value: value})
+}
+
+// WhereAny adds a filter matching any of the values of the field.  Blank values are skipped, and no filter is added
+// if all of them are blank.
+func (b *QueryBuilder) WhereAny(field string, values ...string) *QueryBuilder {
+	filters := make([]Filter, 0, len(values))
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			filters = append(filters, Filter{Field: field, Op: EQ, Value: v})
+		}
+	}
+	return b.add(filters...)
+}
+
+// Between adds an inclusive range filter on the field.  A blank bound leaves that side of the range open.
+func (b *QueryBuilder) Between(field, from, to string) *QueryBuilder {
+	return b.Where(field, GTE, from).Where(field, LTE, to)
+}
+
+// Build constructs the FQL query, and-ing all the clauses together.
+func (b *QueryBuilder) Build() (string, error) {
+	if len(b.errs) > 0 {
+		return "", errors.Join(b.errs...)
+	}
+	if len(b.clauses) == 0 {
+		return "", errors.New("empty filter list")
+	}
+	return strings.Join(b.clauses, "+"), nil
+}
+
 // NewFQLSort constructs a new FQL sort string.
 func NewFQLSort(field string, direction Direction) (string, error) {
 	field = strings.TrimSpace(field)
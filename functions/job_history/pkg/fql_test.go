@@ -0,0 +1,116 @@
+package pkg
+
+import "testing"
+
+func TestEscapeFQLValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{name: "plain", value: "job 1", want: "job 1"},
+		{name: "quote", value: "bob's job", want: `bob\'s job`},
+		{name: "backslash", value: `C:\temp`, want: `C:\\temp`},
+		{name: "escaped quote", value: `\'`, want: `\\\'`},
+		{name: "empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EscapeFQLValue(tt.value); got != tt.want {
+				t.Errorf("EscapeFQLValue(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewFQLQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters []Filter
+		want    string
+		wantErr bool
+	}{
+		{name: "no filters", wantErr: true},
+		{
+			name:    "and-ed filters",
+			filters: []Filter{{Field: "id", Op: EQ, Value: "1"}, {Field: "run_date", Op: LT, Value: " 2024-01-01T00:00:00Z "}},
+			want:    "id:'1'+run_date:<'2024-01-01T00:00:00Z'",
+		},
+		{name: "escaped value", filters: []Filter{{Field: "name", Op: EQ, Value: `a'b\c`}}, want: `name:'a\'b\\c'`},
+		{name: "blank field", filters: []Filter{{Field: " ", Value: "1"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewFQLQuery(tt.filters)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewFQLQuery() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NewFQLQuery() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryBuilder(t *testing.T) {
+	tests := []struct {
+		name    string
+		build   func(b *QueryBuilder) *QueryBuilder
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "no clauses",
+			build:   func(b *QueryBuilder) *QueryBuilder { return b.Where("id", EQ, " ") },
+			wantErr: true,
+		},
+		{
+			name: "blank values skipped",
+			build: func(b *QueryBuilder) *QueryBuilder {
+				return b.Where("id", EQ, "1").Where("name", EQ, "").WhereAny("status", "", " ")
+			},
+			want: "id:'1'",
+		},
+		{
+			name:  "any of the values",
+			build: func(b *QueryBuilder) *QueryBuilder { return b.WhereAny("status", "failed", "", "timed_out") },
+			want:  "(status:'failed',status:'timed_out')",
+		},
+		{
+			name:  "single value",
+			build: func(b *QueryBuilder) *QueryBuilder { return b.WhereAny("status", "failed") },
+			want:  "status:'failed'",
+		},
+		{
+			name:  "range",
+			build: func(b *QueryBuilder) *QueryBuilder { return b.Between("run_date", "2024-01-01", "2024-02-01") },
+			want:  "run_date:>='2024-01-01'+run_date:<='2024-02-01'",
+		},
+		{
+			name:  "open range",
+			build: func(b *QueryBuilder) *QueryBuilder { return b.Between("run_date", "", "2024-02-01") },
+			want:  "run_date:<='2024-02-01'",
+		},
+		{
+			name:  "escaped values",
+			build: func(b *QueryBuilder) *QueryBuilder { return b.Where("name", NEQ, "it's").WhereAny("user", `a\b`, "c") },
+			want:  `name:!'it\'s'+(user:'a\\b',user:'c')`,
+		},
+		{
+			name:    "blank field",
+			build:   func(b *QueryBuilder) *QueryBuilder { return b.Where("id", EQ, "1").Where("", EQ, "2") },
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.build(&QueryBuilder{}).Build()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Build() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Build() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package pkg
+
+import (
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// NormalizeJobName returns the canonical form of a job name: trimmed and in Unicode normalization form C, so that
+// names which are typed differently but read the same are the same name.
+func NormalizeJobName(name string) string {
+	return norm.NFC.String(strings.TrimSpace(name))
+}
+
+// JobNameKey returns the key identifying a job name, from which the ID of the job is derived: the normalized
+// name, case folded if foldCase is true.  It must match the key computed by Func_Jobs.
+func JobNameKey(name string, foldCase bool) string {
+	key := NormalizeJobName(name)
+	if foldCase {
+		key = cases.Fold().String(key)
+	}
+	return key
+}
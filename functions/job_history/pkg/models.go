@@ -7,50 +7,324 @@ const (
 const (
 	// StatusCompleted represents a job completed status.
 	StatusCompleted = "completed"
+	// StatusCompletedWithErrors represents a job which completed but failed on some of its hosts.
+	StatusCompletedWithErrors = "completed_with_errors"
 	// StatusInProgress represents a job in-progress status.
 	StatusInProgress = "in-progress"
 	// StatusFailed represents a job failed status.
 	StatusFailed = "failed"
+	// StatusSkipped represents a job execution which was not run, e.g. because the job was paused.
+	StatusSkipped = "skipped"
+	// StatusQueued represents a job execution waiting for a running execution of the same job to finish.
+	StatusQueued = "queued"
+	// StatusReleased represents a queued or deferred job execution which has since been run as a new execution.
+	StatusReleased = "released"
+	// StatusDeferred represents a job execution triggered outside the maintenance window of its job, which is run
+	// as a new execution once the window opens.
+	StatusDeferred = "deferred"
+	// StatusTimedOut represents a job execution which never reported its final state, see the reaper.
+	StatusTimedOut = "timed_out"
+)
+
+const (
+	// SkipReasonPaused is the skip reason of executions of a paused job.
+	SkipReasonPaused = "paused"
+	// SkipReasonOverlap is the skip reason of executions started while the job was already running its
+	// maximum number of concurrent executions.
+	SkipReasonOverlap = "overlap"
+	// SkipReasonPlatform is the skip reason of hosts whose platform is not one of those targeted by the job.
+	SkipReasonPlatform = "platform_mismatch"
+	// SkipReasonMissedRun is the skip reason of the marker executions recorded for scheduled runs of a job which
+	// never produced a workflow event, e.g. because its workflow was disabled.
+	SkipReasonMissedRun = "missed_run"
+	// SkipReasonBlackout is the skip reason of executions started during a period of the blackout calendar.
+	SkipReasonBlackout = "blackout"
+)
+
+// Queue reasons of queued job executions.
+const (
+	// QueueReasonOverlap is the queue reason of executions started while the job was already running its maximum
+	// number of concurrent executions.
+	QueueReasonOverlap = "overlap"
+	// QueueReasonSessionQuota is the queue reason of executions whose RTR sessions would have exceeded the ceiling
+	// of concurrent sessions, together with those of the running executions.
+	QueueReasonSessionQuota = "session_quota"
+)
+
+// SLA breaches of a job execution.
+const (
+	// SLABreachMaxDuration is the breach of executions which ran longer than the maximum duration of their job.
+	SLABreachMaxDuration = "max_duration"
+	// SLABreachMinSuccessRate is the breach of executions which succeeded on fewer hosts than the minimum success
+	// rate of their job.
+	SLABreachMinSuccessRate = "min_success_rate"
+)
+
+// Failure reasons of hosts on which a job failed, classified from the output of the RTR command.
+const (
+	// FailureReasonFileNotFound is the failure reason of hosts on which a file or path did not exist.
+	FailureReasonFileNotFound = "file_not_found"
+	// FailureReasonPermissionDenied is the failure reason of hosts on which the command was not allowed access.
+	FailureReasonPermissionDenied = "permission_denied"
+	// FailureReasonHostOffline is the failure reason of hosts which could not be reached.
+	FailureReasonHostOffline = "host_offline"
+	// FailureReasonSessionTimeout is the failure reason of hosts whose RTR session or command timed out.
+	FailureReasonSessionTimeout = "session_timeout"
+	// FailureReasonIntegrityCheck is the failure reason of hosts on which the hash of an installed file did not
+	// match the hash of the version of the file installed by the job.
+	FailureReasonIntegrityCheck = "integrity_check"
+	// FailureReasonUnknown is the failure reason of hosts whose failure could not be classified.
+	FailureReasonUnknown = "unknown"
+)
+
+const (
+	// PlatformWindows is the Falcon platform name of Windows hosts.
+	PlatformWindows = "Windows"
+	// PlatformLinux is the Falcon platform name of Linux hosts.
+	PlatformLinux = "Linux"
+	// PlatformMac is the Falcon platform name of macOS hosts.
+	PlatformMac = "Mac"
+)
+
+const (
+	// NoteSeverityInfo is the severity of notes recording context rather than an issue.
+	NoteSeverityInfo = "info"
+	// NoteSeverityLow is the severity of notes about minor issues.
+	NoteSeverityLow = "low"
+	// NoteSeverityMedium is the severity of notes about issues needing follow up.
+	NoteSeverityMedium = "medium"
+	// NoteSeverityHigh is the severity of notes about issues needing prompt follow up.
+	NoteSeverityHigh = "high"
+	// NoteSeverityCritical is the severity of notes about issues needing immediate follow up.
+	NoteSeverityCritical = "critical"
 )
 
 // JobExecution represents a job execution history record.
 type JobExecution struct {
+	// ChangeSeq is the change sequence number of the latest change of the record, see storagec.SequencedClient.
+	ChangeSeq int64 `json:"change_seq,omitempty"`
+	// CountedRun is true if the execution is included in the run count of its job.  Re-runs are not.
+	CountedRun bool `json:"counted_run,omitempty"`
 	// CSVOutput contains a link to the logscale output in CSV format.
 	CSVOutput string `json:"output_1"`
 	// Duration is the number of hours, minutes, and seconds the job ran/has run in string format.
 	Duration string `json:"duration"`
+	// DurationSeconds is Duration in seconds.
+	DurationSeconds int64 `json:"duration_seconds"`
 	// EndDate is the timestamp at which the job stopped executing.
 	EndDate string `json:"endDate"`
+	// EnrichmentAttempts is the number of times the enrichment processor has searched Logscale for the
+	// host results of the execution without finding any.
+	EnrichmentAttempts int `json:"enrichment_attempts,omitempty"`
+	// EstimatedSessions is the number of RTR sessions the execution was estimated to open when it started, one per
+	// targeted host.
+	EstimatedSessions int `json:"estimated_sessions,omitempty"`
 	// ExecutionID is the workflow execution ID.
 	ExecutionID string `json:"execution_id"`
+	// FailedHosts is the number of TargetedHosts on which the job failed.
+	FailedHosts int `json:"failed_hosts"`
+	// HostGroups are the IDs of the host groups targeted by the job when the execution started.
+	HostGroups []string `json:"host_groups,omitempty"`
 	// Hosts is a list of hostnames on which the job ran.
 	Hosts []string `json:"hosts"`
+	// HostsTruncated is true if Logscale returned the results of more hosts than are recorded on an execution,
+	// the results of the hosts beyond the cap having been dropped.
+	HostsTruncated bool `json:"hosts_truncated,omitempty"`
 	// ID is the ID of record.
 	ID string `json:"id"`
+	// ImportedFrom is the source of an execution run outside the workflows of the app and imported, e.g.
+	// rtr_session.  It is blank for the executions reported by the workflows.
+	ImportedFrom string `json:"imported_from,omitempty"`
 	// JobID is the ID of the RTR job.
 	JobID string `json:"job_id"`
 	// JobName is the name of the RTR job.
 	JobName string `json:"name"`
 	// LogscaleOutput is a link to the Logscale output.
 	LogscaleOutput string `json:"output_2"`
+	// Notes are the annotations of the execution.  They are stored in their own collection and only set on the
+	// executions returned by queries.
+	Notes []ExecutionNote `json:"notes,omitempty"`
 	// NumHosts is the length of the Hosts slice.
 	NumHosts int `json:"numHosts"`
+	// OwnerID is the ID of the user who created the job.
+	OwnerID string `json:"owner_id,omitempty"`
+	// OwnerName is the username or email of the user who created the job.
+	OwnerName string `json:"owner_name,omitempty"`
+	// PendingEnrichment is true while Logscale has returned no host results for the execution.
+	PendingEnrichment bool `json:"pending_enrichment,omitempty"`
+	// QueueReason is the reason the execution was queued, one of the QueueReason constants.
+	QueueReason string `json:"queue_reason,omitempty"`
+	// ReleasedAs is the workflow execution ID a queued or deferred execution was eventually run as.
+	ReleasedAs string `json:"released_as,omitempty"`
 	// ReceivedFiles is the number of systems which have received the files.
 	ReceivedFiles int `json:"receivedFiles"`
+	// ResolvedHosts are the members of HostGroups when the execution started.
+	ResolvedHosts []ResolvedHost `json:"resolved_hosts,omitempty"`
+	// RetryOf is the workflow execution ID of the execution this execution re-ran the failed hosts of.
+	RetryOf string `json:"retry_of,omitempty"`
+	// RolloutID is the ID of the rollout which ran the execution as one of its waves.
+	RolloutID string `json:"rollout_id,omitempty"`
+	// RolloutWave is the number of the wave of the rollout, starting from 1, which the execution ran.
+	RolloutWave int `json:"rollout_wave,omitempty"`
 	// RunDate is the timestamp at which the job began running.
 	RunDate string `json:"run_date"`
 	// RunStatus is the status of the job.
 	RunStatus string `json:"status"`
+	// SkipReason is the reason the execution was skipped if its status is skipped.
+	SkipReason string `json:"skip_reason,omitempty"`
+	// SLABreached is true if the execution breached the SLA of its job when it finished.
+	SLABreached bool `json:"sla_breached,omitempty"`
+	// SLABreaches are the SLABreach constants of the objectives the execution breached.
+	SLABreaches []string `json:"sla_breaches,omitempty"`
+	// StatusReason explains a status which was not reported by the workflow, e.g. why the execution timed out.
+	StatusReason string `json:"status_reason,omitempty"`
+	// Steps are the step executions of a composite job, ordered by step.  The hosts and status of the execution are
+	// rolled up from them.
+	Steps []ExecutionStep `json:"steps,omitempty"`
+	// SucceededHosts is the number of TargetedHosts on which the job completed.
+	SucceededHosts int `json:"succeeded_hosts"`
 	// TargetedHosts is a breakdown of which hosts the job ran against and the status of their execution.
 	TargetedHosts []TargetedHost `json:"targeted_hosts"`
+	// TargetedHostsPage describes the page of TargetedHosts returned by the API when the hosts are paginated.  It
+	// is never stored.
+	TargetedHostsPage *HostsPage `json:"targeted_hosts_page,omitempty"`
+	// Timeline lists, oldest first, when the function learned of each phase of the execution.  It is append-only.
+	Timeline []TimelineEvent `json:"timeline,omitempty"`
+}
+
+// HostsPage is a page of the targeted hosts of a job execution.
+type HostsPage struct {
+	// Page is the number of the page, starting from 1.
+	Page int `json:"page"`
+	// PageSize is the maximum number of hosts in the page.
+	PageSize int `json:"page_size"`
+	// Total is the number of targeted hosts of the execution.
+	Total int `json:"total"`
+}
+
+// Kinds of TimelineEvent.
+const (
+	// TimelineStatusChanged is the kind of the events recording a new status of the execution.
+	TimelineStatusChanged = "status_changed"
+	// TimelineEnriched is the kind of the events recording host results found after the execution was recorded.
+	TimelineEnriched = "enriched"
+	// TimelineStepReported is the kind of the events recording a new status of a step of a composite job.
+	TimelineStepReported = "step_reported"
+)
+
+// TimelineEvent is a single entry of the timeline of a job execution.
+type TimelineEvent struct {
+	// At is the timestamp at which the function recorded the event, not when the workflow reported it.
+	At string `json:"at"`
+	// Detail describes the circumstances of the event, e.g. the reaper if it was not reported by a workflow.
+	Detail string `json:"detail,omitempty"`
+	// Event is one of the Timeline constants.
+	Event string `json:"event"`
+	// Status is the status of the execution after the event.
+	Status string `json:"status,omitempty"`
+}
+
+// RecordStatus appends a TimelineStatusChanged event to the timeline if the status of the execution is no
+// longer prevStatus.
+func (je *JobExecution) RecordStatus(prevStatus, at, detail string) {
+	if je.RunStatus == "" || je.RunStatus == prevStatus {
+		return
+	}
+	je.Timeline = append(je.Timeline, TimelineEvent{At: at, Detail: detail, Event: TimelineStatusChanged, Status: je.RunStatus})
+}
+
+// RecordEvent appends an event of the given kind to the timeline.
+func (je *JobExecution) RecordEvent(event, at, detail string) {
+	je.Timeline = append(je.Timeline, TimelineEvent{At: at, Detail: detail, Event: event, Status: je.RunStatus})
+}
+
+// ExecutionNote is an annotation attached to a job execution by an analyst, e.g. while triaging its failures.
+type ExecutionNote struct {
+	// AuthorID is the ID of the user who wrote the note.
+	AuthorID string `json:"author_id,omitempty"`
+	// AuthorName is the username or email of the user who wrote the note.
+	AuthorName string `json:"author_name,omitempty"`
+	// CreatedAt is the timestamp at which the note was written.
+	CreatedAt string `json:"created_at"`
+	// ExecutionID is the workflow execution ID of the annotated execution.
+	ExecutionID string `json:"execution_id"`
+	// ID is the ID of the note.
+	ID string `json:"id"`
+	// JobID is the ID of the job of the annotated execution.
+	JobID string `json:"job_id"`
+	// Severity is one of the NoteSeverity constants, if set.
+	Severity string `json:"severity,omitempty"`
+	// Text is the free-text content of the note.
+	Text string `json:"text"`
+	// TicketURL is a link to a ticket tracking the follow up of the note.
+	TicketURL string `json:"ticket_url,omitempty"`
+}
+
+// ExecutionStep is the execution of a single step of a composite job, run as its own workflow execution.
+type ExecutionStep struct {
+	// ActionType is the type of the action of the step, e.g. install.
+	ActionType string `json:"action_type,omitempty"`
+	// EndDate is the timestamp at which the step finished.
+	EndDate string `json:"end_date,omitempty"`
+	// ExecutionID is the workflow execution ID of the step.
+	ExecutionID string `json:"execution_id"`
+	// FailedHosts is the number of hosts on which the step failed.
+	FailedHosts int `json:"failed_hosts"`
+	// Name is the name of the step.
+	Name string `json:"name,omitempty"`
+	// NumHosts is the number of hosts on which the step ran.
+	NumHosts int `json:"num_hosts"`
+	// RunDate is the timestamp at which the step began running.
+	RunDate string `json:"run_date"`
+	// RunStatus is the status of the step.
+	RunStatus string `json:"status"`
+	// Step is the number of the step in the job, starting from 1.
+	Step int `json:"step"`
+	// SucceededHosts is the number of hosts on which the step completed.
+	SucceededHosts int `json:"succeeded_hosts"`
+}
+
+// ResolvedHost is a member of a host group targeted by a job.
+type ResolvedHost struct {
+	// DeviceID is the ID of the device.
+	DeviceID string `json:"device_id"`
+	// HostName is the name of the device.
+	HostName string `json:"host_name"`
+	// Platform is the platform of the device, e.g. Windows.
+	Platform string `json:"platform,omitempty"`
 }
 
 // TargetedHost contains information about a host against which an RTR workflow ran.
 type TargetedHost struct {
 	// DeviceID is the ID of the device.
 	DeviceID string `json:"device_id"`
+	// EndTime is the timestamp of the last event reported for the host.
+	EndTime string `json:"end_time,omitempty"`
+	// Error is a description of why execution failed on the host.
+	Error string `json:"error,omitempty"`
+	// ExitCode is the exit code of the script run on the host, for script jobs.
+	ExitCode *int `json:"exit_code,omitempty"`
+	// FailureReason is the cause of the failure if the status is failed, one of the FailureReason constants.
+	FailureReason string `json:"failure_reason,omitempty"`
+	// FileHash is the SHA-256 hash of the installed file reported by the host, for install jobs.
+	FileHash string `json:"file_hash,omitempty"`
 	// HostName is the name of the device.
 	HostName string `json:"host_name"`
+	// OutputID is the ID of the full output of the host when Stdout or Stderr were truncated, see the host output
+	// endpoint.
+	OutputID string `json:"output_id,omitempty"`
+	// Platform is the platform of the device, e.g. Windows.
+	Platform string `json:"platform,omitempty"`
+	// SkipReason is the reason the host was skipped if its status is skipped.
+	SkipReason string `json:"skip_reason,omitempty"`
+	// StartTime is the timestamp of the first event reported for the host.
+	StartTime string `json:"start_time,omitempty"`
+	// Step is the last step of a composite job the host reached, i.e. the step whose result it reports.
+	Step int `json:"step,omitempty"`
 	// Status is the status of execution.
 	Status string `json:"status"`
+	// Stderr is the standard error output of the RTR command, truncated to the inline limit of the output policy.
+	Stderr string `json:"stderr,omitempty"`
+	// Stdout is the standard output of the RTR command, truncated to the inline limit of the output policy.
+	Stdout string `json:"stdout,omitempty"`
 }
@@ -0,0 +1,17 @@
+package pkg
+
+import "context"
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx carrying the CID of the tenant on whose behalf the request is handled, e.g. a
+// child CID of an MSSP.
+func WithTenant(ctx context.Context, cid string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, cid)
+}
+
+// TenantFromContext returns the CID of the tenant carried by ctx, or an empty string if it carries none.
+func TenantFromContext(ctx context.Context) string {
+	cid, _ := ctx.Value(tenantKey{}).(string)
+	return cid
+}
@@ -0,0 +1,80 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/alertc"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+)
+
+// criticalFailurePercent is the percentage of failed hosts from which alerts are raised as critical rather than
+// high.
+const criticalFailurePercent = 90
+
+// alert raises an alert for the execution if it just finished having failed on more than the alerting
+// percentage of its targeted hosts, see WithFailureAlerting.  Failures to raise the alert are logged rather than
+// failing the upsert, as the execution is recorded either way.
+func (p *UpsertProcessor) alert(ctx context.Context, j job, er executionRecord) {
+	if p.alerter == nil || er.record.RunStatus == er.prevStatus {
+		return
+	}
+	a, ok := failureAlert(er.record, j.Name, p.alertPercent)
+	if !ok {
+		return
+	}
+	logger := p.logger.WithField("execution_id", er.record.ExecutionID)
+	if err := p.alerter.Raise(ctx, a); err != nil {
+		logger.Errorf("failed to raise alert: %s", err)
+		addWarning(ctx, "alert for execution %s not raised: %s", er.record.ExecutionID, err)
+	}
+}
+
+// failureAlert returns the alert of a finished execution which failed on more than percent of its targeted hosts,
+// and false for other executions.
+func failureAlert(je pkg.JobExecution, jobName string, percent float64) (alertc.Alert, bool) {
+	switch je.RunStatus {
+	case pkg.StatusCompleted, pkg.StatusCompletedWithErrors, pkg.StatusFailed, pkg.StatusTimedOut:
+	default:
+		return alertc.Alert{}, false
+	}
+	if len(je.TargetedHosts) == 0 {
+		return alertc.Alert{}, false
+	}
+
+	failed := make([]alertc.FailedHost, 0)
+	for _, h := range je.TargetedHosts {
+		if h.Status == pkg.StatusFailed {
+			failed = append(failed, alertc.FailedHost{DeviceID: h.DeviceID, Error: h.Error, HostName: h.HostName})
+		}
+	}
+	failedPercent := float64(len(failed)) * 100 / float64(len(je.TargetedHosts))
+	if failedPercent <= percent {
+		return alertc.Alert{}, false
+	}
+
+	if jobName == "" {
+		jobName = je.JobName
+	}
+	jobID := je.JobID
+	if jobID == "" {
+		jobID = je.ID
+	}
+	severity := alertc.SeverityHigh
+	if failedPercent >= criticalFailurePercent {
+		severity = alertc.SeverityCritical
+	}
+	return alertc.Alert{
+		Description: fmt.Sprintf("Job %s failed on %d of %d hosts (%.0f%%), above the alerting threshold of %.0f%%.",
+			jobName, len(failed), len(je.TargetedHosts), failedPercent, percent),
+		ExecutionID:    je.ExecutionID,
+		FailedHosts:    failed,
+		FailurePercent: failedPercent,
+		JobID:          jobID,
+		JobName:        jobName,
+		Name:           fmt.Sprintf("Rapid Response job %s failed on %.0f%% of hosts", jobName, failedPercent),
+		Severity:       severity,
+		Status:         je.RunStatus,
+		TargetedHosts:  len(je.TargetedHosts),
+	}, true
+}
@@ -0,0 +1,131 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/validate"
+	"github.com/sirupsen/logrus"
+)
+
+// Permissions granted to roles by the rbac settings object.
+const (
+	// PermissionViewHistory allows reading jobs, their executions, statistics and audit trail.
+	PermissionViewHistory = "view_history"
+	// PermissionManageJobs allows running, pausing, resuming, reprocessing and backfilling jobs, and annotating their
+	// executions.
+	PermissionManageJobs = "manage_jobs"
+	// PermissionDeleteJobs allows deleting jobs and pruning their executions.
+	PermissionDeleteJobs = "delete_jobs"
+	// PermissionManageSettings allows updating the settings of the app.
+	PermissionManageSettings = "manage_settings"
+	// permissionAll grants every permission.
+	permissionAll = "*"
+)
+
+var knownPermissions = map[string]bool{
+	PermissionViewHistory:    true,
+	PermissionManageJobs:     true,
+	PermissionDeleteJobs:     true,
+	PermissionManageSettings: true,
+	permissionAll:            true,
+}
+
+// caller is the identity of the user making a request, read from the context of the fdk request.
+type caller struct {
+	ID    string   `json:"user_id"`
+	Name  string   `json:"user_name"`
+	Roles []string `json:"roles"`
+}
+
+// callerFromRequest returns the caller of a request, as populated by Falcon in the context of the fdk request.
+// Headers are never trusted for the identity of the caller, as clients set them.  Requests made by workflows carry
+// no user.
+func callerFromRequest(req fdk.Request) caller {
+	var c caller
+	if len(req.Context) > 0 {
+		_ = json.Unmarshal(req.Context, &c)
+	}
+	return c
+}
+
+func (c caller) anonymous() bool {
+	return c.ID == "" && c.Name == ""
+}
+
+// ownerFilter returns the ID of the user whose jobs a list query is restricted to: the caller's with mine=true,
+// otherwise the owner query parameter.
+func ownerFilter(req fdk.Request, q url.Values) (string, error) {
+	if strings.ToLower(queryParam(q, "mine")) != "true" {
+		return queryParam(q, "owner"), nil
+	}
+	c := callerFromRequest(req)
+	if c.ID == "" {
+		return "", validate.Errors{{Field: "mine", Message: "requires a user ID in the request context"}}
+	}
+	return c.ID, nil
+}
+
+// Authorizer enforces the permissions granted to the roles of callers by the rbac settings object.
+type Authorizer struct {
+	logger logrus.FieldLogger
+	strgc  storagec.StorageC
+}
+
+// NewAuthorizer returns a new Authorizer instance.
+func NewAuthorizer(strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(a *Authorizer)) *Authorizer {
+	a := &Authorizer{
+		logger: logger,
+		strgc:  strgc,
+	}
+	for _, o := range opts {
+		o(a)
+	}
+	return a
+}
+
+// Authorize returns whether the caller of req holds perm through one of its roles, and the 403 Response to return
+// in place of the request when it does not.  Every request is authorized while the rbac settings object is unset
+// or disabled.  Otherwise requests without a user are denied: the routes called by workflows, which carry no user,
+// are not authorized at all rather than exempted here.
+func (a *Authorizer) Authorize(ctx context.Context, req fdk.Request, perm string) (Response, bool) {
+	c := callerFromRequest(req)
+
+	var rs rbacSettings
+	err := fetchSettings(ctx, a.strgc, rbacSettingsName, &rs)
+	if errors.Is(err, storagec.NotFound) {
+		return Response{}, true
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to fetch %s settings: %w", rbacSettingsName, err)
+		a.logger.Error(err)
+		return errorResponse(err, a.logger), false
+	}
+	if !rs.Enabled {
+		return Response{}, true
+	}
+	if c.anonymous() {
+		a.logger.WithField("permission", perm).Warn("request without a user denied")
+		return errorResponse(newError(ErrForbidden, "the %s permission requires a user", perm), a.logger), false
+	}
+
+	for _, role := range c.Roles {
+		for _, p := range rs.Roles[role] {
+			if p == perm || p == permissionAll {
+				return Response{}, true
+			}
+		}
+	}
+	who := c.Name
+	if who == "" {
+		who = c.ID
+	}
+	a.logger.WithField("user", who).WithField("permission", perm).Warn("request denied")
+	return errorResponse(newError(ErrForbidden, "user %s lacks the %s permission", who, perm), a.logger), false
+}
@@ -0,0 +1,118 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/robfig/cron/v3"
+	"github.com/sirupsen/logrus"
+)
+
+// maxBlackoutSkips bounds the number of blackouts skipped while looking for the first run of a schedule outside
+// them.  Each skip passes a whole blackout, so it is only reached by calendars of many adjoining blackouts.
+const maxBlackoutSkips = 1000
+
+// blackoutSettings is the app-level blackout calendar, e.g. the change freezes during which no job may run.  The
+// runs of every job which fall in one of its periods are skipped.
+type blackoutSettings struct {
+	Periods []blackoutPeriod `json:"periods"`
+}
+
+// blackoutPeriod is a period of the blackout calendar.  Runs at or after Start and before End fall in it.
+type blackoutPeriod struct {
+	End   string `json:"end"`
+	Name  string `json:"name"`
+	Start string `json:"start"`
+}
+
+// validate checks that the period starts before it ends.
+func (b blackoutPeriod) validate() error {
+	start, err := time.Parse(pkg.ISOTimeFormat, b.Start)
+	if err != nil {
+		return fmt.Errorf("blackout %q: start must be formatted as %s", b.Name, pkg.ISOTimeFormat)
+	}
+	end, err := time.Parse(pkg.ISOTimeFormat, b.End)
+	if err != nil {
+		return fmt.Errorf("blackout %q: end must be formatted as %s", b.Name, pkg.ISOTimeFormat)
+	}
+	if !end.After(start) {
+		return fmt.Errorf("blackout %q: end must be after start", b.Name)
+	}
+	return nil
+}
+
+// blackoutCalendar is the parsed blackout calendar.  The zero value has no blackouts.
+type blackoutCalendar struct {
+	periods []blackout
+}
+
+type blackout struct {
+	end   time.Time
+	name  string
+	start time.Time
+}
+
+// fetchBlackouts loads the blackout calendar.  An empty calendar is returned if it has not been set, and periods
+// which cannot be parsed are ignored, as the settings API rejects them.
+func fetchBlackouts(ctx context.Context, strgc storagec.StorageC) (blackoutCalendar, error) {
+	var bs blackoutSettings
+	err := fetchSettings(ctx, strgc, blackoutSettingsName, &bs)
+	if errors.Is(err, storagec.NotFound) {
+		return blackoutCalendar{}, nil
+	}
+	if err != nil {
+		return blackoutCalendar{}, fmt.Errorf("failed to fetch %s settings: %w", blackoutSettingsName, err)
+	}
+	var c blackoutCalendar
+	for _, p := range bs.Periods {
+		start, serr := time.Parse(pkg.ISOTimeFormat, p.Start)
+		end, eerr := time.Parse(pkg.ISOTimeFormat, p.End)
+		if serr != nil || eerr != nil {
+			continue
+		}
+		c.periods = append(c.periods, blackout{end: end, name: p.Name, start: start})
+	}
+	return c, nil
+}
+
+// loadBlackouts is fetchBlackouts for callers which proceed without the calendar if it cannot be loaded, logging
+// the failure instead.
+func loadBlackouts(ctx context.Context, strgc storagec.StorageC, logger logrus.FieldLogger) blackoutCalendar {
+	c, err := fetchBlackouts(ctx, strgc)
+	if err != nil {
+		logger.Warnf("not enforcing blackouts: %s", err)
+		addWarning(ctx, "blackouts not enforced: %s", err)
+	}
+	return c
+}
+
+// covering returns the period of the calendar which t falls in, ending last if several do.
+func (c blackoutCalendar) covering(t time.Time) (blackout, bool) {
+	var found blackout
+	ok := false
+	for _, b := range c.periods {
+		if !t.Before(b.start) && t.Before(b.end) && (!ok || b.end.After(found.end)) {
+			found, ok = b, true
+		}
+	}
+	return found, ok
+}
+
+// next returns the first run of the schedule after t which falls in no blackout, or the zero time if the schedule
+// never runs again.  The run reached after maxBlackoutSkips skips is returned even if it falls in a blackout.
+func (c blackoutCalendar) next(s cron.Schedule, t time.Time) time.Time {
+	next := s.Next(t)
+	for i := 0; i < maxBlackoutSkips && !next.IsZero(); i++ {
+		b, ok := c.covering(next)
+		if !ok {
+			return next
+		}
+		// schedules have minute resolution, so a run at the very end of the blackout is kept
+		next = s.Next(b.end.Add(-time.Second))
+	}
+	return next
+}
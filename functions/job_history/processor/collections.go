@@ -0,0 +1,107 @@
+package processor
+
+import "github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/auditc"
+
+// Collections are the names of the custom storage collections of the app.  The dev and staging deployments of
+// the app can name their collections differently, so that one function binary is promoted across environments.
+// Jobs and JobNames are shared with Func_Jobs, which must be configured with the same names.
+type Collections struct {
+	AuditTrail     string `json:"audit_trail,omitempty"`
+	Counters       string `json:"counters,omitempty"`
+	DigestReports  string `json:"digest_reports,omitempty"`
+	Evidence       string `json:"execution_evidence,omitempty"`
+	ExecutionNotes string `json:"execution_notes,omitempty"`
+	HostOutputs    string `json:"host_outputs,omitempty"`
+	JobExecutions  string `json:"job_executions,omitempty"`
+	JobNames       string `json:"job_names,omitempty"`
+	JobStats       string `json:"job_stats,omitempty"`
+	JobTickets     string `json:"job_tickets,omitempty"`
+	Jobs           string `json:"jobs,omitempty"`
+	Locks          string `json:"locks,omitempty"`
+	PutFiles       string `json:"put_files,omitempty"`
+	Quarantine     string `json:"quarantine,omitempty"`
+	Rollouts       string `json:"rollouts,omitempty"`
+	Settings       string `json:"settings,omitempty"`
+	WorkQueue      string `json:"work_queue,omitempty"`
+}
+
+// DefaultCollections returns the collections declared in the manifest of the app.
+func DefaultCollections() Collections {
+	return Collections{
+		AuditTrail:     auditc.Collection,
+		Counters:       "Counters",
+		DigestReports:  "Digest_Reports",
+		Evidence:       "Execution_Evidence",
+		ExecutionNotes: "Execution_Notes",
+		HostOutputs:    "Host_Outputs",
+		JobExecutions:  "Job_Executions",
+		JobNames:       "Job_Names",
+		JobStats:       "Job_Stats",
+		JobTickets:     "Job_Tickets",
+		Jobs:           "Jobs_Info",
+		Locks:          "Locks",
+		PutFiles:       "Put_Files",
+		Quarantine:     "Quarantine",
+		Rollouts:       "Rollouts",
+		Settings:       "App_Settings",
+		WorkQueue:      "Work_Queue",
+	}
+}
+
+// Merge returns c with the non-blank names of o in place of its own.
+func (c Collections) Merge(o Collections) Collections {
+	for _, f := range []struct {
+		dst *string
+		src string
+	}{
+		{&c.AuditTrail, o.AuditTrail},
+		{&c.Counters, o.Counters},
+		{&c.DigestReports, o.DigestReports},
+		{&c.Evidence, o.Evidence},
+		{&c.ExecutionNotes, o.ExecutionNotes},
+		{&c.HostOutputs, o.HostOutputs},
+		{&c.JobExecutions, o.JobExecutions},
+		{&c.JobNames, o.JobNames},
+		{&c.JobStats, o.JobStats},
+		{&c.JobTickets, o.JobTickets},
+		{&c.Jobs, o.Jobs},
+		{&c.Locks, o.Locks},
+		{&c.PutFiles, o.PutFiles},
+		{&c.Quarantine, o.Quarantine},
+		{&c.Rollouts, o.Rollouts},
+		{&c.Settings, o.Settings},
+		{&c.WorkQueue, o.WorkQueue},
+	} {
+		if f.src != "" {
+			*f.dst = f.src
+		}
+	}
+	return c
+}
+
+// UseCollections makes every processor use the given collections, blank names leaving the default collection
+// in use.  AuditedCollections, SequencedCollections and ShardedFields are updated to match.  It must be called before any request is
+// handled, as the collections are not guarded against concurrent use.
+func UseCollections(c Collections) {
+	c = DefaultCollections().Merge(c)
+	jobCollection = c.Jobs
+	jobExecutionCollection = c.JobExecutions
+	jobStatsCollection = c.JobStats
+	jobNameCollection = c.JobNames
+	executionNoteCollection = c.ExecutionNotes
+	evidenceCollection = c.Evidence
+	hostOutputCollection = c.HostOutputs
+	settingsCollection = c.Settings
+	quarantineCollection = c.Quarantine
+	auditCollection = c.AuditTrail
+	digestReportCollection = c.DigestReports
+	putFileCollection = c.PutFiles
+	rolloutCollection = c.Rollouts
+	workQueueCollection = c.WorkQueue
+	lockCollection = c.Locks
+	jobTicketCollection = c.JobTickets
+
+	AuditedCollections = []string{jobCollection, jobExecutionCollection}
+	SequencedCollections = []string{jobExecutionCollection}
+	ShardedFields = map[string]string{jobExecutionCollection: "targeted_hosts"}
+}
@@ -0,0 +1,189 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/workflowc"
+	"github.com/sirupsen/logrus"
+)
+
+// executionRan returns false if the execution was skipped, queued or deferred rather than run.
+func executionRan(execRecord pkg.JobExecution) bool {
+	switch execRecord.RunStatus {
+	case pkg.StatusSkipped, pkg.StatusQueued, pkg.StatusReleased, pkg.StatusDeferred:
+		return false
+	}
+	return true
+}
+
+// notRunMessage describes why the execution of the job was not run.
+func notRunMessage(jobName string, execRecord pkg.JobExecution) string {
+	switch {
+	case execRecord.RunStatus == pkg.StatusQueued && execRecord.QueueReason == pkg.QueueReasonSessionQuota:
+		return fmt.Sprintf("running executions hold the maximum number of concurrent RTR sessions - execution %s of job %s queued", execRecord.ExecutionID, jobName)
+	case execRecord.RunStatus == pkg.StatusQueued:
+		return fmt.Sprintf("job %s is running its maximum number of concurrent executions - execution %s queued", jobName, execRecord.ExecutionID)
+	case execRecord.RunStatus == pkg.StatusDeferred:
+		return fmt.Sprintf("job %s is outside its maintenance window - execution %s deferred", jobName, execRecord.ExecutionID)
+	case execRecord.RunStatus == pkg.StatusReleased:
+		return fmt.Sprintf("queued or deferred execution %s of job %s was run as execution %s", execRecord.ExecutionID, jobName, execRecord.ReleasedAs)
+	case execRecord.SkipReason == pkg.SkipReasonOverlap:
+		return fmt.Sprintf("job %s is running its maximum number of concurrent executions - execution %s skipped", jobName, execRecord.ExecutionID)
+	}
+	return fmt.Sprintf("job %s is paused - execution %s skipped", jobName, execRecord.ExecutionID)
+}
+
+// skipExecution marks the execution record as skipped for the given reason, unless it already has one.
+func (p *UpsertProcessor) skipExecution(execRecord pkg.JobExecution, reason string) pkg.JobExecution {
+	execRecord.RunStatus = pkg.StatusSkipped
+	if execRecord.SkipReason == "" {
+		execRecord.SkipReason = reason
+	}
+	if execRecord.EndDate == "" {
+		execRecord.EndDate = p.now()
+	}
+	if execRecord.TargetedHosts == nil {
+		execRecord.TargetedHosts = make([]pkg.TargetedHost, 0)
+	}
+	execRecord.PendingEnrichment = false
+	return execRecord
+}
+
+// queueExecution marks the execution record as queued for the given reason until a running execution finishes.
+func (p *UpsertProcessor) queueExecution(execRecord pkg.JobExecution, reason string) pkg.JobExecution {
+	execRecord.RunStatus = pkg.StatusQueued
+	execRecord.QueueReason = reason
+	if execRecord.TargetedHosts == nil {
+		execRecord.TargetedHosts = make([]pkg.TargetedHost, 0)
+	}
+	execRecord.PendingEnrichment = false
+	return execRecord
+}
+
+// overlapsRunning returns true if the job of the execution is already running at least maxRuns other executions.
+func (p *UpsertProcessor) overlapsRunning(ctx context.Context, execRecord pkg.JobExecution, maxRuns int) (bool, error) {
+	filter, err := pkg.NewFQLQuery([]pkg.Filter{
+		{Field: "id", Op: pkg.EQ, Value: execRecord.ID},
+		{Field: "status", Op: pkg.EQ, Value: pkg.StatusInProgress},
+		{Field: "execution_id", Op: pkg.NEQ, Value: execRecord.ExecutionID},
+	})
+	if err != nil {
+		return false, fmt.Errorf("error constructing FQL query: %s", err)
+	}
+	n, err := p.strgc.Count(ctx, storagec.SearchObjectsRequest{
+		Collection: jobExecutionCollection,
+		Filter:     filter,
+	})
+	if err != nil {
+		return false, err
+	}
+	return n >= maxRuns, nil
+}
+
+// releaseQueued runs the oldest queued execution of the job as a new execution of its workflow once the given
+// execution finishes.  The queued record is marked as released and linked to the new execution.  Failures are
+// logged rather than failing the upsert, leaving the execution queued for the next execution to finish.
+func (p *UpsertProcessor) releaseQueued(ctx context.Context, jobID string, j job, er executionRecord) {
+	if p.wfc == nil || !pkg.IsFinished(er.record.RunStatus) || er.prevStatus == er.record.RunStatus ||
+		j.OverlapPolicy != overlapPolicyQueue || j.Paused ||
+		j.Workflows == nil || j.Workflows.ScheduleWorkflow == "" {
+		return
+	}
+	logger := p.logger.WithField("job_id", jobID)
+
+	// executions queued for the session ceiling are released by releaseSessionQueued once enough sessions are free
+	key, err := p.oldestQueued(ctx, []pkg.Filter{
+		{Field: "id", Op: pkg.EQ, Value: jobID},
+		{Field: "queue_reason", Op: pkg.NEQ, Value: pkg.QueueReasonSessionQuota},
+	})
+	if err != nil {
+		logger.Errorf("failed to look up queued executions: %s", err)
+		return
+	}
+	if key == "" {
+		return
+	}
+	p.runQueued(ctx, key, j, logger)
+}
+
+// runQueued runs the queued execution stored under key as a new execution of the schedule workflow of its job,
+// marking the queued record as released and linking it to the new execution.  The record is marked first, so
+// that concurrent upserts cannot release it twice, and queued again if the workflow fails to run.
+func (p *UpsertProcessor) runQueued(ctx context.Context, key string, j job, logger logrus.FieldLogger) {
+	queuedMap, version, err := p.fetchObject(ctx, jobExecutionCollection, key)
+	if err != nil {
+		logger.Errorf("failed to fetch queued execution %s: %s", key, err)
+		return
+	}
+	queued, err := mapToJobExecution(queuedMap)
+	if err != nil {
+		logger.Errorf("failed to deserialize queued execution %s: %s", key, err)
+		return
+	}
+	if queued.RunStatus != pkg.StatusQueued {
+		return
+	}
+
+	// mark the record first, so that concurrent upserts cannot release it twice
+	queued.RunStatus = pkg.StatusReleased
+	queued.EndDate = p.now()
+	queued.RecordStatus(pkg.StatusQueued, queued.EndDate, "")
+	err = p.putExecutionRecordObject(ctx, jobExecutionCollection, key, queued, version)
+	if errors.Is(err, storagec.VersionConflict) {
+		return
+	}
+	if err != nil {
+		logger.Errorf("failed to release queued execution %s: %s", queued.ExecutionID, err)
+		return
+	}
+
+	resp, err := p.wfc.Execute(ctx, workflowc.ExecuteRequest{
+		DefinitionID: j.Workflows.ScheduleWorkflow,
+		Payload:      json.RawMessage("{}"),
+	})
+	if err == nil && resp.ExecutionID == "" {
+		err = errors.New("workflow execution ID missing from response")
+	}
+	if err != nil {
+		logger.Errorf("failed to run queued execution %s - requeueing: %s", queued.ExecutionID, err)
+		queued.RunStatus = pkg.StatusQueued
+		queued.EndDate = ""
+		queued.RecordStatus(pkg.StatusReleased, p.now(), "requeued after failing to run the workflow")
+	} else {
+		queued.ReleasedAs = resp.ExecutionID
+		logger.WithField("execution_id", resp.ExecutionID).
+			Infof("released queued execution %s", queued.ExecutionID)
+	}
+
+	if err = p.putExecutionRecordObject(ctx, jobExecutionCollection, key, queued, ""); err != nil {
+		logger.Errorf("failed to save released execution %s: %s", queued.ExecutionID, err)
+	}
+}
+
+// oldestQueued returns the object key of the oldest queued execution matching the filters, or a blank string if
+// there is none.
+func (p *UpsertProcessor) oldestQueued(ctx context.Context, filters []pkg.Filter) (string, error) {
+	filter, err := pkg.NewFQLQuery(append(filters, pkg.Filter{Field: "status", Op: pkg.EQ, Value: pkg.StatusQueued}))
+	if err != nil {
+		return "", fmt.Errorf("error constructing FQL query: %s", err)
+	}
+	sort, err := pkg.NewFQLSort("run_date", pkg.Asc)
+	if err != nil {
+		return "", fmt.Errorf("error constructing FQL sort: %s", err)
+	}
+	sr, err := p.strgc.Search(ctx, storagec.SearchObjectsRequest{
+		Collection: jobExecutionCollection,
+		Filter:     filter,
+		Limit:      1,
+		Sort:       sort,
+	})
+	if err != nil || len(sr.ObjectKeys) == 0 {
+		return "", err
+	}
+	return sr.ObjectKeys[0], nil
+}
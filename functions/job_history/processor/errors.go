@@ -0,0 +1,140 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/metrics"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/searchc"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/validate"
+)
+
+// Kinds of errors a processor fails with.  An error is classified by the kind it wraps, see newError, and
+// errors of the storage and search clients are classified by their own dedicated errors.
+var (
+	// ErrBadRequest is the kind of errors caused by an invalid request.
+	ErrBadRequest = errors.New("bad request")
+	// ErrNotFound is the kind of errors caused by a missing object.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is the kind of errors caused by a conflicting state or a concurrent modification.
+	ErrConflict = errors.New("conflict")
+	// ErrForbidden is the kind of errors caused by a caller lacking the permission to make a request.
+	ErrForbidden = errors.New("forbidden")
+	// ErrStorageUnavailable is the kind of errors caused by custom storage being unavailable.
+	ErrStorageUnavailable = errors.New("storage unavailable")
+	// ErrSearchTimeout is the kind of errors caused by a Logscale search not completing in time.
+	ErrSearchTimeout = errors.New("search timeout")
+)
+
+// ErrorCode is the machine-readable code of an error, returned as the code of its fdk.APIError.
+type ErrorCode int
+
+// Error codes
+const (
+	// ErrorCodeInternal is the error code of unclassified errors.
+	ErrorCodeInternal ErrorCode = iota + 2001
+	// ErrorCodeBadRequest is the error code of ErrBadRequest.
+	ErrorCodeBadRequest
+	// ErrorCodeNotFound is the error code of ErrNotFound and storagec.NotFound.
+	ErrorCodeNotFound
+	// ErrorCodeConflict is the error code of ErrConflict and storagec.VersionConflict.
+	ErrorCodeConflict
+	// ErrorCodeStorageUnavailable is the error code of ErrStorageUnavailable and storagec.Unavailable.
+	ErrorCodeStorageUnavailable
+	// ErrorCodeSearchTimeout is the error code of ErrSearchTimeout, searchc.Incomplete and exceeded deadlines.
+	ErrorCodeSearchTimeout
+	// ErrorCodeForbidden is the error code of ErrForbidden.
+	ErrorCodeForbidden
+)
+
+// errorCodeNames name the error codes in the errors_total metric.
+var errorCodeNames = map[ErrorCode]string{
+	ErrorCodeInternal:           "internal",
+	ErrorCodeBadRequest:         "bad_request",
+	ErrorCodeNotFound:           "not_found",
+	ErrorCodeConflict:           "conflict",
+	ErrorCodeStorageUnavailable: "storage_unavailable",
+	ErrorCodeSearchTimeout:      "search_timeout",
+	ErrorCodeForbidden:          "forbidden",
+}
+
+type errorClass struct {
+	code   ErrorCode
+	kinds  []error
+	status int
+}
+
+// errorClasses are matched in order, an error belongs to the first class with a kind it wraps.
+var errorClasses = []errorClass{
+	{code: ErrorCodeBadRequest, kinds: []error{ErrBadRequest}, status: http.StatusBadRequest},
+	{code: ErrorCodeForbidden, kinds: []error{ErrForbidden}, status: http.StatusForbidden},
+	{code: ErrorCodeNotFound, kinds: []error{ErrNotFound, storagec.NotFound}, status: http.StatusNotFound},
+	{code: ErrorCodeConflict, kinds: []error{ErrConflict, storagec.VersionConflict}, status: http.StatusConflict},
+	{code: ErrorCodeStorageUnavailable, kinds: []error{ErrStorageUnavailable, storagec.Unavailable}, status: http.StatusServiceUnavailable},
+	{code: ErrorCodeSearchTimeout, kinds: []error{ErrSearchTimeout, searchc.Incomplete, context.DeadlineExceeded}, status: http.StatusGatewayTimeout},
+}
+
+// kindError is an error of a given kind.  Its message is that of the underlying error alone.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// newError returns an error of the given kind formatted like fmt.Errorf.
+func newError(kind error, format string, args ...any) error {
+	return &kindError{kind: kind, err: fmt.Errorf(format, args...)}
+}
+
+// classifyError returns the HTTP status and error code of the error.  Validation errors are bad requests.
+func classifyError(err error) (int, ErrorCode) {
+	var ve validate.Errors
+	if errors.As(err, &ve) {
+		return http.StatusBadRequest, ErrorCodeBadRequest
+	}
+	for _, c := range errorClasses {
+		for _, k := range c.kinds {
+			if errors.Is(err, k) {
+				return c.status, c.code
+			}
+		}
+	}
+	return http.StatusInternalServerError, ErrorCodeInternal
+}
+
+// apiError converts the error into an fdk.APIError carrying its error code.
+func apiError(err error) fdk.APIError {
+	_, code := classifyError(err)
+	return fdk.APIError{Code: int(code), Message: err.Error()}
+}
+
+// newErrorResponse builds the failed Response of the error, with a body serialized by respJSON.  Validation
+// errors are returned as an error per invalid field.  Failed responses are counted by error class.
+func newErrorResponse(err error, respJSON func(errs []fdk.APIError) []byte) Response {
+	status, code := classifyError(err)
+	metrics.Default.Inc("errors_total", metrics.Labels{"class": errorCodeNames[code]})
+	errs := []fdk.APIError{apiError(err)}
+	var ve validate.Errors
+	if errors.As(err, &ve) {
+		errs = make([]fdk.APIError, len(ve))
+		for i, fe := range ve {
+			errs[i] = apiError(fe)
+		}
+	}
+	return Response{
+		Body: respJSON(errs),
+		Code: status,
+		Errs: errs,
+	}
+}
@@ -0,0 +1,449 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/searchc"
+	"github.com/sirupsen/logrus"
+)
+
+// Job action types, as set by the Func_Jobs function.
+const (
+	actionInstallSoftware = "installSoftware"
+	actionRemoveFile      = "removeFile"
+	actionRunScript       = "runScript"
+)
+
+// Names of the fields extracted from Logscale events.
+const (
+	fieldDeviceID       = "device_id"
+	fieldExitCode       = "exit_code"
+	fieldFileExists     = "file_exists"
+	fieldFileHash       = "file_hash"
+	fieldHostName       = "host_name"
+	fieldPlatform       = "platform"
+	fieldRemoved        = "removed"
+	fieldRemoveResponse = "remove_response"
+	fieldStderr         = "stderr"
+	fieldStdout         = "stdout"
+)
+
+// extractionRule extracts the result of a job on a host from the fields of a Logscale event.
+type extractionRule struct {
+	// JobType is the action type of the jobs whose events the rule applies to.
+	JobType string
+	// Fields maps the lower case suffixes of event keys to the names of the fields their values are extracted into.
+	// The device ID and host name are always extracted.
+	Fields map[string]string
+	// Parsers convert the values of the fields they are keyed by before they are extracted.  Blank results are
+	// ignored.
+	Parsers map[string]func(s string) (string, error)
+	// Result builds the record of the host from the extracted fields, returning false if the event does not
+	// hold the result of the job.
+	Result func(f map[string]string) (logscaleRecord, bool)
+}
+
+// hostFields are the event fields extracted by every rule.
+var hostFields = map[string]string{
+	"device.getdetails.device_id": fieldDeviceID,
+	"device.getdetails.hostname":  fieldHostName,
+	"device.getdetails.platform":  fieldPlatform,
+}
+
+// extractionRules are the rules extracting host results from the Logscale events of each job type.  New job
+// types contribute their extraction logic by adding a rule here.
+var extractionRules = []extractionRule{
+	{
+		JobType: actionInstallSoftware,
+		Fields: map[string]string{
+			"rtr.putandrun.file_hash": fieldFileHash,
+			"rtr.putandrun.stderr":    fieldStderr,
+			"rtr.putandrun.stdout":    fieldStdout,
+		},
+		Parsers: map[string]func(s string) (string, error){
+			fieldFileHash: parseFileHash,
+		},
+		Result: func(f map[string]string) (logscaleRecord, bool) {
+			lr := logscaleRecord{FileHash: f[fieldFileHash], Stderr: f[fieldStderr], Stdout: f[fieldStdout]}
+			if lr.Stderr != "" {
+				lr.Success = "false"
+				lr.Error = excerpt(firstLine(lr.Stderr))
+				return lr, true
+			}
+			lr.Success = "true"
+			return lr, lr.Stdout != "" || lr.FileHash != ""
+		},
+	},
+	{
+		JobType: actionRemoveFile,
+		Fields: map[string]string{
+			"rtr.app_check_file_exist_rtr_2.file_exists": fieldFileExists,
+			"rtr.app_remove_file_rtr_2.file_exists":      fieldRemoved,
+			"rtr.app_remove_file_rtr_2.response":         fieldRemoveResponse,
+		},
+		Parsers: map[string]func(s string) (string, error){
+			fieldRemoveResponse: isRemoveSuccessful,
+		},
+		Result: func(f map[string]string) (logscaleRecord, bool) {
+			success := f[fieldFileExists]
+			lr := logscaleRecord{}
+			if success == "false" {
+				lr.FailureReason = pkg.FailureReasonFileNotFound
+			}
+			for _, name := range []string{fieldRemoved, fieldRemoveResponse} {
+				if removed := f[name]; removed != "" {
+					success = removed
+					lr.FailureReason = ""
+				}
+			}
+			lr.Success = success
+			return lr, success == "true" || success == "false"
+		},
+	},
+	{
+		JobType: actionRunScript,
+		Fields: map[string]string{
+			"rtr.app_run_script.exit_code": fieldExitCode,
+			"rtr.app_run_script.stderr":    fieldStderr,
+			"rtr.app_run_script.stdout":    fieldStdout,
+		},
+		Parsers: map[string]func(s string) (string, error){
+			fieldExitCode: parseExitCode,
+		},
+		Result: func(f map[string]string) (logscaleRecord, bool) {
+			s, ok := f[fieldExitCode]
+			if !ok {
+				return logscaleRecord{}, false
+			}
+			code, _ := strconv.Atoi(s)
+			lr := logscaleRecord{ExitCode: &code, Stderr: f[fieldStderr], Stdout: f[fieldStdout], Success: "true"}
+			if code != 0 {
+				lr.Success = "false"
+				lr.Error = fmt.Sprintf("script exited with code %d", code)
+				if lr.Stderr != "" {
+					lr.Error = excerpt(firstLine(lr.Stderr))
+				}
+			}
+			return lr, true
+		},
+	},
+}
+
+// failureClasses map the failure reasons of hosts to lower case excerpts of the RTR errors they are classified
+// from, in the order they are tried.
+var failureClasses = []struct {
+	reason   string
+	excerpts []string
+}{
+	{
+		reason: pkg.FailureReasonSessionTimeout,
+		excerpts: []string{
+			"timed out", "timeout", "session expired", "session has expired",
+		},
+	},
+	{
+		reason: pkg.FailureReasonHostOffline,
+		excerpts: []string{
+			"offline", "not connected", "unreachable", "could not connect", "unable to connect",
+		},
+	},
+	{
+		reason: pkg.FailureReasonPermissionDenied,
+		excerpts: []string{
+			"access is denied", "access denied", "permission denied", "unauthorizedaccess", "operation not permitted",
+			"requires elevation", "not authorized",
+		},
+	},
+	{
+		reason: pkg.FailureReasonFileNotFound,
+		excerpts: []string{
+			"cannot find path", "cannot find the file", "cannot find the path", "could not find file",
+			"no such file", "file not found", "path not found", "does not exist",
+		},
+	},
+}
+
+// classifyFailure returns the reason a job failed on a host from the error output of the RTR command, or
+// pkg.FailureReasonUnknown if it is not one of the common failures.
+func classifyFailure(outputs ...string) string {
+	for _, o := range outputs {
+		o = strings.ToLower(o)
+		if o == "" {
+			continue
+		}
+		for _, c := range failureClasses {
+			for _, e := range c.excerpts {
+				if strings.Contains(o, e) {
+					return c.reason
+				}
+			}
+		}
+	}
+	return pkg.FailureReasonUnknown
+}
+
+// rulesFor returns the extraction rules of the job type, or every rule if there are none, e.g. because the type
+// of the job is not known.
+func rulesFor(jobType string) []extractionRule {
+	rules := make([]extractionRule, 0, 1)
+	for _, r := range extractionRules {
+		if r.JobType == jobType {
+			rules = append(rules, r)
+		}
+	}
+	if len(rules) == 0 {
+		return extractionRules
+	}
+	return rules
+}
+
+// extract applies the rule to an event, returning false if the event does not hold a host result.
+func (r extractionRule) extract(e map[string]any, l logrus.FieldLogger) (logscaleRecord, bool) {
+	f := make(map[string]string)
+	for k, v := range e {
+		s, ok := v.(string)
+		if !ok || strings.TrimSpace(s) == "" {
+			continue
+		}
+		name, ok := r.field(strings.ToLower(k))
+		if !ok {
+			continue
+		}
+		s = strings.TrimSpace(s)
+		if parse := r.Parsers[name]; parse != nil {
+			var err error
+			if s, err = parse(s); err != nil {
+				l.WithField("key", k).Error(err)
+				return logscaleRecord{}, false
+			}
+			if s == "" {
+				continue
+			}
+		}
+		f[name] = s
+	}
+
+	if f[fieldHostName] == "" {
+		return logscaleRecord{}, false
+	}
+	lr, ok := r.Result(f)
+	lr.DeviceID, lr.HostName, lr.Platform = f[fieldDeviceID], f[fieldHostName], pkg.NormalizePlatform(f[fieldPlatform])
+	return lr, ok
+}
+
+// field returns the name of the field the value of the event key is extracted into.
+func (r extractionRule) field(key string) (string, bool) {
+	for _, fields := range []map[string]string{hostFields, r.Fields} {
+		for suffix, name := range fields {
+			if strings.HasSuffix(key, suffix) {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// hostExtraction holds the per host results extracted from the Logscale events of an execution.
+type hostExtraction struct {
+	// Hosts are the results of each host, ordered by host name.
+	Hosts []pkg.TargetedHost
+	// MatchedType is the job type of the extraction rule which last matched an event, e.g. to tell the type of a
+	// job which is not known.
+	MatchedType string
+	// Truncated is true if the events held the results of more than maxExtractedHosts hosts, the results of the
+	// hosts beyond the cap having been dropped.
+	Truncated bool
+}
+
+// extractHosts extracts the per host results of a job of the given type from every page of Logscale events.
+// Pages are processed as they are fetched and only the results of each host are held, never the events, so memory
+// grows with the number of hosts rather than events.  Hosts are capped at maxExtractedHosts: events of further
+// hosts are dropped, while those of the hosts already held are still merged into their results.  The output of
+// the hosts is returned in full, to be bounded by an OutputPolicy before it is stored.
+func extractHosts(pages *searchc.Pages, jobType string, l logrus.FieldLogger) (hostExtraction, error) {
+	rules := rulesFor(jobType)
+	devSet := make(map[string]logscaleRecord)
+	var x hostExtraction
+	for pages.Next() {
+		for _, e := range pages.Page().Events {
+			var lr logscaleRecord
+			lrOk := false
+			for _, r := range rules {
+				if lr, lrOk = r.extract(e, l); lrOk {
+					x.MatchedType = r.JobType
+					break
+				}
+			}
+			if !lrOk {
+				continue
+			}
+			lr.Start, lr.End = eventTimestamp(e), eventTimestamp(e)
+			prev, ok := devSet[lr.HostName]
+			if ok {
+				lr = mergeLogscaleRecords(prev, lr)
+			} else if len(devSet) >= maxExtractedHosts {
+				x.Truncated = true
+				continue
+			}
+			devSet[lr.HostName] = lr
+		}
+	}
+	if err := pages.Err(); err != nil {
+		return hostExtraction{}, err
+	}
+	if x.Truncated {
+		l.WithField("max_hosts", maxExtractedHosts).Warn("dropped the results of hosts beyond the cap")
+	}
+
+	x.Hosts = make([]pkg.TargetedHost, 0, len(devSet))
+	for k, d := range devSet {
+		status, reason := pkg.StatusFailed, d.FailureReason
+		if d.Success == "true" {
+			status, reason = pkg.StatusCompleted, ""
+		} else if reason == "" {
+			reason = classifyFailure(d.Stderr, d.Error)
+		}
+		x.Hosts = append(x.Hosts, pkg.TargetedHost{
+			DeviceID:      d.DeviceID,
+			EndTime:       formatEventTime(d.End),
+			Error:         d.Error,
+			ExitCode:      d.ExitCode,
+			FailureReason: reason,
+			FileHash:      d.FileHash,
+			HostName:      d.HostName,
+			Platform:      d.Platform,
+			StartTime:     formatEventTime(d.Start),
+			Status:        status,
+			Stderr:        d.Stderr,
+			Stdout:        d.Stdout,
+		})
+		// the outputs are not held twice
+		delete(devSet, k)
+	}
+
+	sort.Slice(x.Hosts, func(i, j int) bool {
+		return x.Hosts[i].HostName <= x.Hosts[j].HostName
+	})
+	return x, nil
+}
+
+// mergeLogscaleRecords combines two records of the same host, with the later record taking precedence.
+func mergeLogscaleRecords(prev, next logscaleRecord) logscaleRecord {
+	if next.DeviceID == "" {
+		next.DeviceID = prev.DeviceID
+	}
+	if next.Platform == "" {
+		next.Platform = prev.Platform
+	}
+	if next.ExitCode == nil {
+		next.ExitCode = prev.ExitCode
+	}
+	if next.FileHash == "" {
+		next.FileHash = prev.FileHash
+	}
+	if next.Stdout == "" {
+		next.Stdout = prev.Stdout
+	}
+	if next.Stderr == "" {
+		next.Stderr = prev.Stderr
+	}
+	if next.Error == "" && next.Success != "true" {
+		next.Error = prev.Error
+	}
+	if next.FailureReason == "" && next.Success != "true" {
+		next.FailureReason = prev.FailureReason
+	}
+	if next.Start.IsZero() || (!prev.Start.IsZero() && prev.Start.Before(next.Start)) {
+		next.Start = prev.Start
+	}
+	if next.End.IsZero() || (!prev.End.IsZero() && prev.End.After(next.End)) {
+		next.End = prev.End
+	}
+	return next
+}
+
+// eventTimestamp returns the time at which Logscale ingested the event, or the zero time if it is not present.
+func eventTimestamp(e map[string]any) time.Time {
+	return eventTime(e, "@timestamp")
+}
+
+// eventTime returns the time held by a field of an event in milliseconds since the epoch, or the zero time if it
+// holds none.
+func eventTime(e map[string]any, key string) time.Time {
+	switch ts := e[key].(type) {
+	case float64:
+		return time.UnixMilli(int64(ts)).UTC()
+	case string:
+		ms, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return time.Time{}
+		}
+		return time.UnixMilli(ms).UTC()
+	}
+	return time.Time{}
+}
+
+func formatEventTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(pkg.ISOTimeFormat)
+}
+
+// excerpt returns the first maxOutputExcerpt bytes of s, without splitting a UTF-8 character, see truncateOutput.
+func excerpt(s string) string {
+	return truncateOutput(s, maxOutputExcerpt)
+}
+
+func firstLine(s string) string {
+	if idx := strings.IndexAny(s, "\r\n"); idx >= 0 {
+		return s[:idx]
+	}
+	return s
+}
+
+func isRemoveSuccessful(s string) (string, error) {
+	var m map[string]any
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		return "", err
+	}
+
+	existsA, ok := m["file_exists"]
+	if !ok {
+		return "", nil
+	}
+
+	if existsS, ok := existsA.(string); ok {
+		if existsS == "true" || existsS == "false" {
+			return existsS, nil
+		}
+		return "", fmt.Errorf("unknown truth value: %q", existsS)
+	}
+	if existsB, ok := existsA.(bool); ok {
+		if existsB {
+			return "true", nil
+		}
+		return "false", nil
+	}
+
+	return "", fmt.Errorf("unknown truth value: %v", existsA)
+}
+
+// parseFileHash normalizes a hex encoded file hash, which RTR scripts may report in upper case.
+func parseFileHash(s string) (string, error) {
+	return strings.ToLower(s), nil
+}
+
+func parseExitCode(s string) (string, error) {
+	code, err := strconv.Atoi(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid exit code: %q", s)
+	}
+	return strconv.Itoa(code), nil
+}
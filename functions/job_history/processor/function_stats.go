@@ -0,0 +1,189 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/metrics"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// functionStatsName is the object key of the stats snapshot in the settings collection.
+	functionStatsName = "function_stats"
+	// maxFunctionStatsAttempts is the number of times merging counters into the stats snapshot is attempted
+	// when instances of the function save it concurrently.
+	maxFunctionStatsAttempts = 3
+)
+
+// functionStats is a snapshot of the counters of every instance of the function, kept in custom storage for
+// environments where metrics cannot be exported.  Counters are cumulative since the snapshot was first saved.
+type functionStats struct {
+	Counters                []metrics.CounterValue `json:"counters"`
+	ErrorsByClass           map[string]int64       `json:"errors_by_class"`
+	LogscaleEmptyResultRate float64                `json:"logscale_empty_result_rate"`
+	LogscaleSearches        int64                  `json:"logscale_searches"`
+	SavedAt                 string                 `json:"saved_at"`
+	Since                   string                 `json:"since"`
+	UpsertsProcessed        int64                  `json:"upserts_processed"`
+}
+
+// summarize derives the headline figures of the snapshot from its counters.
+func (s *functionStats) summarize() {
+	s.ErrorsByClass = make(map[string]int64)
+	s.LogscaleEmptyResultRate, s.LogscaleSearches, s.UpsertsProcessed = 0, 0, 0
+	var empty int64
+	for _, c := range s.Counters {
+		switch c.Name {
+		case "errors_total":
+			s.ErrorsByClass[c.Labels["class"]] += c.Value
+		case "logscale_search_empty_results_total":
+			empty += c.Value
+		case "logscale_search_requests_total":
+			if c.Labels["outcome"] == metrics.Outcome(nil) {
+				s.LogscaleSearches += c.Value
+			}
+		case "upserts_total":
+			s.UpsertsProcessed += c.Value
+		}
+	}
+	if s.LogscaleSearches > 0 {
+		s.LogscaleEmptyResultRate = float64(empty) / float64(s.LogscaleSearches)
+	}
+}
+
+// FunctionStatsRecorder merges the counters of a metrics registry into the stats snapshot in custom storage at
+// most once per interval.  Only the increments since its last save are merged, so the snapshot adds up the
+// counters of every instance of the function.  It is safe for concurrent use.
+type FunctionStatsRecorder struct {
+	clock    pkg.Clock
+	interval time.Duration
+	registry *metrics.Registry
+
+	mu      sync.Mutex
+	saving  bool
+	savedAt time.Time
+	// saved are the values of the counters when they were last merged, keyed by metrics.CounterValue.Key.
+	saved map[string]int64
+}
+
+// NewFunctionStatsRecorder returns a FunctionStatsRecorder saving the counters of the registry every interval.
+func NewFunctionStatsRecorder(registry *metrics.Registry, interval time.Duration, clock pkg.Clock) *FunctionStatsRecorder {
+	return &FunctionStatsRecorder{
+		clock:    clock,
+		interval: interval,
+		registry: registry,
+		savedAt:  clock.Now(),
+		saved:    make(map[string]int64),
+	}
+}
+
+// SaveIfDue saves the counters if they have not been saved for an interval and no other request is saving them.
+// The storage client is only built when they are saved.
+func (r *FunctionStatsRecorder) SaveIfDue(ctx context.Context, strgc func() (storagec.StorageC, error), logger logrus.FieldLogger) {
+	r.mu.Lock()
+	if r.saving || r.clock.Now().Sub(r.savedAt) < r.interval {
+		r.mu.Unlock()
+		return
+	}
+	r.saving = true
+	r.mu.Unlock()
+
+	err := r.save(ctx, strgc)
+	r.mu.Lock()
+	r.saving = false
+	if err == nil {
+		r.savedAt = r.clock.Now()
+	}
+	r.mu.Unlock()
+	if err != nil {
+		logger.Errorf("failed to save function stats: %s", err)
+	}
+}
+
+// save merges the increments of the counters since the last save into the stored snapshot.
+func (r *FunctionStatsRecorder) save(ctx context.Context, newStrgc func() (storagec.StorageC, error)) error {
+	strgc, err := newStrgc()
+	if err != nil {
+		return err
+	}
+	current := r.registry.Snapshot().Counters
+	for attempt := 1; ; attempt++ {
+		err = r.merge(ctx, strgc, current)
+		if !errors.Is(err, storagec.VersionConflict) || attempt == maxFunctionStatsAttempts {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	for _, c := range current {
+		r.saved[c.Key()] = c.Value
+	}
+	r.mu.Unlock()
+	return nil
+}
+
+// merge performs a single fetch-modify-put cycle of the stored snapshot.
+func (r *FunctionStatsRecorder) merge(ctx context.Context, strgc storagec.StorageC, current []metrics.CounterValue) error {
+	var stats functionStats
+	m, version, err := fetchObject(ctx, strgc, settingsCollection, functionStatsName)
+	switch {
+	case errors.Is(err, storagec.NotFound):
+		version = ""
+	case err != nil:
+		return fmt.Errorf("failed to fetch function stats: %w", err)
+	default:
+		b, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		if err = json.Unmarshal(b, &stats); err != nil {
+			return fmt.Errorf("failed to parse function stats: %s", err)
+		}
+	}
+
+	now := r.clock.Now().UTC().Format(pkg.ISOTimeFormat)
+	if stats.Since == "" {
+		stats.Since = now
+	}
+	stored := make(map[string]int, len(stats.Counters))
+	for i, c := range stats.Counters {
+		stored[c.Key()] = i
+	}
+	r.mu.Lock()
+	for _, c := range current {
+		delta := c.Value - r.saved[c.Key()]
+		if delta == 0 {
+			continue
+		}
+		if i, ok := stored[c.Key()]; ok {
+			stats.Counters[i].Value += delta
+			continue
+		}
+		c.Value = delta
+		stored[c.Key()] = len(stats.Counters)
+		stats.Counters = append(stats.Counters, c)
+	}
+	r.mu.Unlock()
+	sort.Slice(stats.Counters, func(i, j int) bool {
+		return stats.Counters[i].Key() < stats.Counters[j].Key()
+	})
+	stats.SavedAt = now
+	stats.summarize()
+
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return fmt.Errorf("failed to serialize function stats: %s", err)
+	}
+	return putObject(ctx, strgc, settingsCollection, functionStatsName, data, version)
+}
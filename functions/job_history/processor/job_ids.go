@@ -0,0 +1,157 @@
+package processor
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/spaolacci/murmur3"
+)
+
+// Job ID strategies, which must match the JOB_ID_STRATEGY of Func_Jobs.
+const (
+	// JobIDStrategyHash derives the ID of jobs from their name, so jobs cannot be renamed.
+	JobIDStrategyHash = "hash"
+	// JobIDStrategyUUID gives jobs random IDs, which are looked up by name in the name index.
+	JobIDStrategyUUID = "uuid"
+)
+
+// JobIDs resolves the ID of a job from its name, workflow events only carrying the name of their job.
+type JobIDs interface {
+	JobID(ctx context.Context, name string) (string, error)
+}
+
+// HashJobIDs derives the ID of jobs from the murmur3 hash of the key of their name, see pkg.JobNameKey.
+type HashJobIDs struct {
+	foldCase bool
+	strgc    storagec.StorageC
+}
+
+// NewHashJobIDs returns a new HashJobIDs instance, which folds the case of names if foldCase is true.
+func NewHashJobIDs(strgc storagec.StorageC, foldCase bool) *HashJobIDs {
+	return &HashJobIDs{foldCase: foldCase, strgc: strgc}
+}
+
+// JobID returns the hash ID of the job named name.  The jobs created before names were normalized have the hash
+// of their raw name as ID, which is returned while no job has the hash of the key as ID.
+func (x *HashJobIDs) JobID(ctx context.Context, name string) (string, error) {
+	key := pkg.JobNameKey(name, x.foldCase)
+	id, err := generateJobID(key)
+	if err != nil || key == name {
+		return id, err
+	}
+	for _, candidate := range []string{key, name} {
+		cid, err := generateJobID(candidate)
+		if err != nil {
+			return "", err
+		}
+		_, err = x.strgc.FetchObject(ctx, storagec.FetchObjectRequest{Collection: jobCollection, ObjectKey: cid})
+		if err == nil {
+			return cid, nil
+		}
+		if !errors.Is(err, storagec.NotFound) {
+			return "", fmt.Errorf("failed to look up job: %w", err)
+		}
+	}
+	return id, nil
+}
+
+// IndexedJobIDs looks up the ID of jobs in the name index maintained by Func_Jobs.  Names missing from the index
+// resolve to their hash ID, so that the jobs created before the index keep their history until they are indexed
+// by the MigrateJobIDsProcessor.
+type IndexedJobIDs struct {
+	hash *HashJobIDs
+}
+
+// NewIndexedJobIDs returns a new IndexedJobIDs instance, which folds the case of names if foldCase is true.
+func NewIndexedJobIDs(strgc storagec.StorageC, foldCase bool) *IndexedJobIDs {
+	return &IndexedJobIDs{hash: NewHashJobIDs(strgc, foldCase)}
+}
+
+func (x *IndexedJobIDs) JobID(ctx context.Context, name string) (string, error) {
+	e, err := fetchJobName(ctx, x.hash.strgc, name, x.hash.foldCase)
+	if errors.Is(err, storagec.NotFound) {
+		return x.hash.JobID(ctx, name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up job name: %w", err)
+	}
+	return e.JobID, nil
+}
+
+// jobNameEntry is an object of the name index, keyed by the hash of the key of the name.
+type jobNameEntry struct {
+	JobID string `json:"job_id"`
+	Name  string `json:"name"`
+}
+
+func jobNameKey(name string, foldCase bool) (string, error) {
+	return generateJobID(pkg.JobNameKey(name, foldCase))
+}
+
+func fetchJobName(ctx context.Context, strgc storagec.StorageC, name string, foldCase bool) (jobNameEntry, error) {
+	key, err := jobNameKey(name, foldCase)
+	if err != nil {
+		return jobNameEntry{}, err
+	}
+	resp, err := strgc.FetchObject(ctx, storagec.FetchObjectRequest{
+		Collection: jobNameCollection,
+		ObjectKey:  key,
+	})
+	if err != nil {
+		return jobNameEntry{}, err
+	}
+	var e jobNameEntry
+	if err = json.Unmarshal(resp.Data, &e); err != nil {
+		return jobNameEntry{}, fmt.Errorf("failed to deserialize job name entry: %s", err)
+	}
+	return e, nil
+}
+
+func putJobName(ctx context.Context, strgc storagec.StorageC, e jobNameEntry, foldCase bool) error {
+	key, err := jobNameKey(e.Name, foldCase)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to serialize job name entry: %s", err)
+	}
+	return putObject(ctx, strgc, jobNameCollection, key, data, "")
+}
+
+// deleteJobName removes the name of a job from the name index, unless the name now belongs to another job.
+func deleteJobName(ctx context.Context, strgc storagec.StorageC, name, jobID string, foldCase bool) error {
+	e, err := fetchJobName(ctx, strgc, name, foldCase)
+	if errors.Is(err, storagec.NotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if e.JobID != jobID {
+		return nil
+	}
+	key, err := jobNameKey(name, foldCase)
+	if err != nil {
+		return err
+	}
+	err = strgc.DeleteObject(ctx, storagec.DeleteObjectRequest{Collection: jobNameCollection, ObjectKey: key})
+	if errors.Is(err, storagec.NotFound) {
+		return nil
+	}
+	return err
+}
+
+func generateJobID(key string) (string, error) {
+	b := murmur3.New128()
+	_, err := b.Write([]byte(key))
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b.Sum(nil)), nil
+}
@@ -0,0 +1,43 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/sirupsen/logrus"
+)
+
+// Names of the locks of the scheduled maintenance tasks, which only one invocation may perform at a time when
+// the workflows triggering them overlap.
+const (
+	reaperLock             = "reaper"
+	reconcileLock          = "reconcile"
+	reconcileWorkflowsLock = "reconcile_workflows"
+	retentionLock          = "retention"
+	syncLock               = "sync"
+)
+
+// maintenanceLockTTL is how long the lock of a maintenance task is held at most, should the invocation performing
+// it die before unlocking it.
+const maintenanceLockTTL = 15 * time.Minute
+
+// lockTask takes the named lock of a maintenance task, returning the function unlocking it once the task is done.
+// Tasks whose lock is held by another invocation fail with ErrConflict.
+func lockTask(ctx context.Context, strgc storagec.StorageC, clock pkg.Clock, logger logrus.FieldLogger, name string) (func(), error) {
+	locker := storagec.NewLocker(strgc, lockCollection, storagec.WithLockClock(clock))
+	lease, err := locker.Lock(ctx, name, pkg.NewTraceID(), maintenanceLockTTL)
+	if errors.Is(err, storagec.Locked) {
+		return nil, newError(ErrConflict, "another invocation is running the %s task", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		if err := locker.Unlock(context.WithoutCancel(ctx), lease); err != nil {
+			logger.WithField("lock", name).Errorf("failed to unlock: %s", err)
+		}
+	}, nil
+}
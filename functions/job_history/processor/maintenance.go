@@ -0,0 +1,348 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/workflowc"
+	"github.com/sirupsen/logrus"
+)
+
+// open reports whether the maintenance window is open at t.  Jobs without a maintenance window are always open.
+func (w *jobWindow) open(t time.Time) (bool, error) {
+	if w == nil {
+		return true, nil
+	}
+	loc, err := time.LoadLocation(w.Timezone)
+	if err != nil {
+		return false, fmt.Errorf("invalid maintenance window timezone %q: %s", w.Timezone, err)
+	}
+	start, err := minuteOfDay(w.Start)
+	if err != nil {
+		return false, fmt.Errorf("invalid maintenance window start: %s", err)
+	}
+	end, err := minuteOfDay(w.End)
+	if err != nil {
+		return false, fmt.Errorf("invalid maintenance window end: %s", err)
+	}
+
+	t = t.In(loc)
+	m := t.Hour()*60 + t.Minute()
+	if start < end {
+		return w.opensOn(t) && m >= start && m < end, nil
+	}
+	// the window spans midnight, opening on one of its days and closing on the next
+	return (w.opensOn(t) && m >= start) || (w.opensOn(t.AddDate(0, 0, -1)) && m < end), nil
+}
+
+// opensOn reports whether the window opens on the day of t.
+func (w *jobWindow) opensOn(t time.Time) bool {
+	return len(w.Days) == 0 || slices.Contains(w.Days, strings.ToLower(t.Weekday().String()[:3]))
+}
+
+// minuteOfDay returns the number of minutes since midnight of a time of day formatted as HH:MM.
+func minuteOfDay(hhmm string) (int, error) {
+	t, err := time.Parse("15:04", hhmm)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not formatted as HH:MM", hhmm)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// outsideWindow reports whether the clock is outside the maintenance window of the job.  Windows which cannot be
+// evaluated are logged and not enforced, rather than deferring every execution of the job.
+func (p *UpsertProcessor) outsideWindow(j job) bool {
+	open, err := j.MaintenanceWindow.open(p.clock.Now())
+	if err != nil {
+		p.logger.WithField("job_name", j.Name).Warnf("not enforcing the maintenance window of the job: %s", err)
+		return false
+	}
+	return !open
+}
+
+// deferExecution marks the execution record as deferred until the maintenance window of its job opens.
+func (p *UpsertProcessor) deferExecution(execRecord pkg.JobExecution) pkg.JobExecution {
+	execRecord.RunStatus = pkg.StatusDeferred
+	if execRecord.TargetedHosts == nil {
+		execRecord.TargetedHosts = make([]pkg.TargetedHost, 0)
+	}
+	execRecord.PendingEnrichment = false
+	return execRecord
+}
+
+// releaseDeferredWork is the kind of the work items releasing the deferred executions of a job, keyed by the ID of
+// the job.
+const releaseDeferredWork = "release_deferred"
+
+const (
+	// releaseDeferredLease is how long a release of deferred executions may take before another invocation may
+	// claim it.
+	releaseDeferredLease = 5 * time.Minute
+	// windowRecheckInterval is how long the release of the deferred executions of a job whose maintenance window
+	// is closed waits before it is claimed again.
+	windowRecheckInterval = 15 * time.Minute
+	// maxReleasesPerRun is the maximum number of jobs whose deferred executions are released by a run of the
+	// ReleaseDeferredProcessor.
+	maxReleasesPerRun = 100
+)
+
+// enqueueRelease enqueues the release of the deferred executions of the job once an execution is deferred.
+// Failures are logged rather than failing the upsert, as the ReleaseDeferredProcessor enqueues the releases of the
+// deferred executions it finds without one.
+func (p *UpsertProcessor) enqueueRelease(ctx context.Context, jobID string, er executionRecord) {
+	if er.record.RunStatus != pkg.StatusDeferred || er.prevStatus == pkg.StatusDeferred {
+		return
+	}
+	q := storagec.NewWorkQueue(p.strgc, workQueueCollection, storagec.WithQueueClock(p.clock))
+	if err := q.Enqueue(ctx, releaseDeferredWork, jobID, nil, p.clock.Now()); err != nil {
+		p.logger.WithField("job_id", jobID).Errorf("failed to enqueue the release of deferred executions: %s", err)
+	}
+}
+
+// ReleaseDeferredProcessor runs the deferred executions of the jobs whose maintenance window is open.  It is meant
+// to be invoked on a schedule by a workflow.
+type ReleaseDeferredProcessor struct {
+	clock  pkg.Clock
+	logger logrus.FieldLogger
+	strgc  storagec.StorageC
+	wfc    workflowc.WorkflowC
+}
+
+// NewReleaseDeferredProcessor returns a new ReleaseDeferredProcessor instance.
+func NewReleaseDeferredProcessor(strgc storagec.StorageC, wfc workflowc.WorkflowC, logger logrus.FieldLogger, opts ...func(p *ReleaseDeferredProcessor)) *ReleaseDeferredProcessor {
+	p := &ReleaseDeferredProcessor{
+		clock:  pkg.SystemClock,
+		logger: logger,
+		strgc:  strgc,
+		wfc:    wfc,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// Process releases the deferred executions of every job whose maintenance window is open.  The releases are work
+// items of the work queue, enqueued when executions are deferred, which the invocations of the processor claim,
+// so that overlapping runs do not release the same job and a release interrupted by a cold start is retried by a
+// later run.  Deferred executions without a release, e.g. deferred before the work queue existed, are enqueued
+// first.  The deferred executions of a job are run together as a single new execution of its workflow, so that a
+// job triggered many times while its window was closed runs once when it opens.  Deferred executions of paused
+// jobs wait for the job to be resumed.
+func (p *ReleaseDeferredProcessor) Process(ctx context.Context, _ fdk.Request) Response {
+	q := storagec.NewWorkQueue(p.strgc, workQueueCollection, storagec.WithQueueClock(p.clock))
+	deferred, err := p.deferredByJob(ctx)
+	if err != nil {
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+	for jobID := range deferred {
+		if err := q.Enqueue(ctx, releaseDeferredWork, jobID, nil, p.clock.Now()); err != nil {
+			p.logger.WithField("job_id", jobID).Errorf("failed to enqueue the release of deferred executions: %s", err)
+		}
+	}
+
+	items, err := q.Claim(ctx, releaseDeferredWork, pkg.NewTraceID(), releaseDeferredLease, maxReleasesPerRun)
+	if err != nil && len(items) == 0 {
+		err = fmt.Errorf("failed to claim the releases of deferred executions: %w", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+
+	result := releaseDeferredResult{Executions: make([]string, 0)}
+	errs := make([]fdk.APIError, 0)
+	if err != nil {
+		p.logger.Errorf("failed to claim every release of deferred executions: %s", err)
+		errs = append(errs, apiError(err))
+	}
+	for _, item := range items {
+		jobID := item.Key
+		keys := deferred[jobID]
+		result.Checked += len(keys)
+		execID, n, err := p.release(ctx, jobID, keys)
+		switch {
+		case errors.Is(err, storagec.NotFound):
+			// the job was deleted; its executions are left to the reconciliation of orphaned records
+			err = q.Complete(ctx, item)
+		case err != nil:
+			err = fmt.Errorf("failed to release the deferred executions of job %s: %w", jobID, err)
+			p.logger.Error(err)
+			errs = append(errs, apiError(err))
+			err = q.Fail(ctx, item, err)
+		case execID != "" || len(keys) == 0:
+			result.Released += n
+			if execID != "" {
+				result.Executions = append(result.Executions, execID)
+			}
+			err = q.Complete(ctx, item)
+		default:
+			// the window of the job is closed, or the job is paused
+			err = q.Release(ctx, item, windowRecheckInterval)
+		}
+		if err != nil {
+			p.logger.WithField("job_id", jobID).Errorf("failed to update the release of deferred executions: %s", err)
+		}
+	}
+	p.logger.WithField("checked", result.Checked).
+		WithField("released", result.Released).
+		Info("released deferred executions")
+
+	code := http.StatusOK
+	if len(errs) > 0 {
+		code = http.StatusMultiStatus
+	}
+	return Response{
+		Body: p.releaseDeferredRespJSON([]releaseDeferredResult{result}, errs),
+		Code: code,
+	}
+}
+
+// deferredByJob returns the object keys of the deferred executions, by the ID of their job.
+func (p *ReleaseDeferredProcessor) deferredByJob(ctx context.Context) (map[string][]string, error) {
+	filter, err := pkg.NewFQLQuery([]pkg.Filter{{Field: "status", Op: pkg.EQ, Value: pkg.StatusDeferred}})
+	if err != nil {
+		return nil, fmt.Errorf("error constructing FQL query: %s", err)
+	}
+	sr, err := p.strgc.SearchAll(ctx, storagec.SearchObjectsRequest{
+		Collection: jobExecutionCollection,
+		Filter:     filter,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search deferred executions: %w", err)
+	}
+	deferred := make(map[string][]string)
+	for _, key := range sr.ObjectKeys {
+		m, _, err := fetchObject(ctx, p.strgc, jobExecutionCollection, key)
+		if errors.Is(err, storagec.NotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch deferred execution %s: %w", key, err)
+		}
+		id, _ := m["id"].(string)
+		deferred[id] = append(deferred[id], key)
+	}
+	return deferred, nil
+}
+
+// release runs the deferred executions of the job as a new execution of its workflow if its maintenance window is
+// open, returning the ID of the new execution and the number of executions it released.  The deferred records are
+// marked as released before the workflow is run, so that concurrent runs cannot release them twice, and are
+// deferred again if it fails to run.
+func (p *ReleaseDeferredProcessor) release(ctx context.Context, jobID string, keys []string) (string, int, error) {
+	jobMap, _, err := fetchObject(ctx, p.strgc, jobCollection, jobID)
+	if err != nil {
+		return "", 0, fmt.Errorf("could not fetch job record: %w", err)
+	}
+	j, err := distillJob(jobMap)
+	if err != nil {
+		return "", 0, fmt.Errorf("could not distill job record from dictionary: %s", err)
+	}
+	now := p.clock.Now()
+	open, err := j.MaintenanceWindow.open(now)
+	if err != nil {
+		return "", 0, err
+	}
+	if !open || j.Paused {
+		return "", 0, nil
+	}
+	if j.Workflows == nil || j.Workflows.ScheduleWorkflow == "" {
+		return "", 0, errors.New("job has no workflow to execute")
+	}
+
+	at := now.Format(pkg.ISOTimeFormat)
+	released := make(map[string]pkg.JobExecution, len(keys))
+	for _, key := range keys {
+		m, version, err := fetchObject(ctx, p.strgc, jobExecutionCollection, key)
+		if errors.Is(err, storagec.NotFound) {
+			continue
+		}
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to fetch deferred execution %s: %w", key, err)
+		}
+		je, err := mapToJobExecution(m)
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to deserialize deferred execution %s: %s", key, err)
+		}
+		if je.RunStatus != pkg.StatusDeferred {
+			continue
+		}
+		je.RunStatus = pkg.StatusReleased
+		je.EndDate = at
+		je.RecordStatus(pkg.StatusDeferred, at, "maintenance window opened")
+		err = p.putExecutionRecord(ctx, key, je, version)
+		if errors.Is(err, storagec.VersionConflict) {
+			continue
+		}
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to release deferred execution %s: %w", je.ExecutionID, err)
+		}
+		released[key] = je
+	}
+	if len(released) == 0 {
+		return "", 0, nil
+	}
+
+	resp, err := p.wfc.Execute(ctx, workflowc.ExecuteRequest{
+		DefinitionID: j.Workflows.ScheduleWorkflow,
+		Payload:      json.RawMessage("{}"),
+	})
+	if err == nil && resp.ExecutionID == "" {
+		err = errors.New("workflow execution ID missing from response")
+	}
+	for key, je := range released {
+		if err != nil {
+			je.RunStatus = pkg.StatusDeferred
+			je.EndDate = ""
+			je.RecordStatus(pkg.StatusReleased, p.clock.Now().Format(pkg.ISOTimeFormat), "deferred again after failing to run the workflow")
+		} else {
+			je.ReleasedAs = resp.ExecutionID
+		}
+		if perr := p.putExecutionRecord(ctx, key, je, ""); perr != nil {
+			p.logger.WithField("job_id", jobID).Errorf("failed to save released execution %s: %s", je.ExecutionID, perr)
+		}
+	}
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to run the workflow of the job: %w", err)
+	}
+	p.logger.WithField("job_id", jobID).
+		WithField("execution_id", resp.ExecutionID).
+		Infof("released %d deferred executions", len(released))
+	return resp.ExecutionID, len(released), nil
+}
+
+func (p *ReleaseDeferredProcessor) putExecutionRecord(ctx context.Context, key string, je pkg.JobExecution, version string) error {
+	data, err := json.Marshal(je)
+	if err != nil {
+		return fmt.Errorf("failed to serialize job execution record: %s", err)
+	}
+	return putObject(ctx, p.strgc, jobExecutionCollection, key, data, version)
+}
+
+func (p *ReleaseDeferredProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return p.releaseDeferredRespJSON(nil, errs)
+	})
+}
+
+func (p *ReleaseDeferredProcessor) releaseDeferredRespJSON(r []releaseDeferredResult, e []fdk.APIError) []byte {
+	if r == nil {
+		r = make([]releaseDeferredResult, 0)
+	}
+	resp := releaseDeferredResponse{Errs: e, Resources: r}
+	rJSON, err := json.Marshal(resp)
+	if err != nil {
+		p.logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
@@ -1,17 +1,164 @@
 package processor
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
 
 	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/auditc"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/notifier"
 	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
 )
 
+// The collections used by the processors, see UseCollections.
+var (
+	jobCollection           = DefaultCollections().Jobs
+	jobExecutionCollection  = DefaultCollections().JobExecutions
+	jobStatsCollection      = DefaultCollections().JobStats
+	jobNameCollection       = DefaultCollections().JobNames
+	executionNoteCollection = DefaultCollections().ExecutionNotes
+	evidenceCollection      = DefaultCollections().Evidence
+	hostOutputCollection    = DefaultCollections().HostOutputs
+	settingsCollection      = DefaultCollections().Settings
+	quarantineCollection    = DefaultCollections().Quarantine
+	auditCollection         = DefaultCollections().AuditTrail
+	digestReportCollection  = DefaultCollections().DigestReports
+	putFileCollection       = DefaultCollections().PutFiles
+	rolloutCollection       = DefaultCollections().Rollouts
+	workQueueCollection     = DefaultCollections().WorkQueue
+	lockCollection          = DefaultCollections().Locks
+	jobTicketCollection     = DefaultCollections().JobTickets
+)
+
+// AuditedCollections are the collections whose mutations are recorded in the audit trail.
+var AuditedCollections = []string{jobCollection, jobExecutionCollection}
+
+// SequencedCollections are the collections whose objects record the change sequence number of their latest put,
+// see storagec.SequencedClient.
+var SequencedCollections = []string{jobExecutionCollection}
+
+// ShardedFields are the array fields of the objects of each collection which are split over several objects
+// when they are large, see storagec.WithSharding.
+var ShardedFields = map[string]string{jobExecutionCollection: "targeted_hosts"}
+
+const (
+	blackoutSettingsName      = "blackouts"
+	callbackSettingsName      = "callbacks"
+	rbacSettingsName          = "rbac"
+	retentionSettingsName     = "retention"
+	statusMappingSettingsName = "status_mapping"
+	ticketSettingsName        = "ticketing"
+)
+
+const (
+	// maxEnrichmentAttempts is the number of enrichment runs after which an execution stops being enriched.
+	maxEnrichmentAttempts = 12
+	// maxEnrichmentsPerRun caps the number of Logscale searches issued by a single enrichment run.
+	maxEnrichmentsPerRun = 10
+)
+
+const (
+	// defaultStaleExecutionTimeout is how long an execution may stay in progress before it is reaped.  It is
+	// generous, as executions of jobs queued for offline hosts legitimately run for hours.
+	defaultStaleExecutionTimeout = 24 * time.Hour
+	// maxReapsPerRun caps the number of job executions reaped by a single run, each of which issues a Logscale
+	// search.
+	maxReapsPerRun = 10
+)
+
+const (
+	// maxBackfillsPerRun caps the number of job executions restored by a single backfill run, each of which
+	// issues a Logscale search.  Running the backfill again over the same range resumes where it stopped.
+	maxBackfillsPerRun = 25
+	// maxBackfillRange is the longest date range a single backfill run scans.
+	maxBackfillRange = 90 * 24 * time.Hour
+)
+
+const (
+	// defaultStatsRuns is the number of most recent runs aggregated when the runs query parameter is not set.
+	defaultStatsRuns = 20
+	// maxStatsRuns is the number of most recent finished runs of a job cached for computing its statistics.
+	maxStatsRuns = 100
+	// topFailingHosts is the number of most frequently failing hosts returned in job statistics.
+	topFailingHosts = 5
+)
+
+const (
+	// defaultHostsPageSize is the number of targeted hosts per page when hosts_page is set without hosts_page_size.
+	defaultHostsPageSize = 100
+	// maxHostsPageSize is the largest page of targeted hosts returned.
+	maxHostsPageSize = 1000
+)
+
+const (
+	// upsertFetchTimeout bounds each of the fetches an upsert runs concurrently before applying a workflow event.
+	upsertFetchTimeout = 30 * time.Second
+	// upsertPrefetchPages is the number of pages of host results an upsert fetches while fetching the records.
+	upsertPrefetchPages = 2
+	// maxExtractedHosts caps the number of hosts whose results are extracted from the Logscale events of an
+	// execution, bounding the memory used by the executions of jobs targeting the largest fleets.
+	maxExtractedHosts = 100000
+)
+
+const (
+	// deleteChunkSize is the number of job execution records deleted concurrently when deleting a job.
+	deleteChunkSize = 20
+	// renameChunkSize is the number of job execution records renamed concurrently when renaming a job.
+	renameChunkSize = 20
+)
+
 const (
-	jobCollection          = "Jobs_Info"
-	jobExecutionCollection = "Job_Executions"
+	// maxNoteLength is the maximum number of characters in the text of an execution note.
+	maxNoteLength = 4000
+	// maxNotedExecutionsPerSearch is the number of executions whose notes are searched for at once.
+	maxNotedExecutionsPerSearch = 50
+)
+
+const (
+	// maxEvidenceSize is the maximum size in bytes of the decoded content of an evidence file.
+	maxEvidenceSize = 4 << 20
+	// maxEvidencePerExecution is the maximum number of evidence files attached to a single execution.
+	maxEvidencePerExecution = 100
+	// defaultEvidenceContentType is the content type of evidence files attached without one.
+	defaultEvidenceContentType = "application/octet-stream"
+)
+
+// maxPutFileSize is the maximum size in bytes of the decoded content of an uploaded put file.
+const maxPutFileSize = 4 << 20
+
+const (
+	// defaultPreviewRuns is the number of projected runs returned by a schedule preview when none is requested.
+	defaultPreviewRuns = 5
+	// maxPreviewRuns caps the number of projected runs returned by a schedule preview.
+	maxPreviewRuns = 100
+)
+
+const (
+	// missedRunGrace is how long after its next run a job must have started an execution before the run is
+	// considered missed.
+	missedRunGrace = 15 * time.Minute
+)
+
+const (
+	// maxCalendarRange is the longest window of a calendar, long enough for the six weeks of a month view.
+	maxCalendarRange = 42 * 24 * time.Hour
+	// maxCalendarRunsPerJob caps the number of projected runs of a single job in a calendar, e.g. for jobs
+	// running every minute.
+	maxCalendarRunsPerJob = 500
+	// defaultICalendarDays is the number of days of runs in the iCalendar feed when the days query parameter is
+	// not set.
+	defaultICalendarDays = 14
+)
+
+const (
+	// overlapPolicySkip records executions exceeding the maximum concurrent runs of a job as skipped.
+	overlapPolicySkip = "skip"
+	// overlapPolicyQueue queues executions exceeding the maximum concurrent runs of a job until a running
+	// execution finishes.
+	overlapPolicyQueue = "queue"
 )
 
 const (
@@ -19,6 +166,17 @@ const (
 	prevPage = -1
 )
 
+// maxOutputExcerpt is the maximum number of bytes of the error of each host, the first line of its stderr.
+const maxOutputExcerpt = 1024
+
+const (
+	// defaultOutputInlineLimit is the number of bytes of the stdout and stderr of each host kept on execution
+	// records by default, see OutputPolicy.
+	defaultOutputInlineLimit = 1024
+	// maxSpilledOutputSize is the number of bytes of the stdout and stderr of each host kept in total.
+	maxSpilledOutputSize = 4 << 20
+)
+
 // Response is the response from the call.
 type Response struct {
 	// Body is the payload of the response.
@@ -27,6 +185,13 @@ type Response struct {
 	Code int
 	// Errs are any errors to return.
 	Errs []fdk.APIError
+	// Stream is the payload of streamed responses, serialized when the response is written, in place of Body.
+	Stream json.Marshaler
+	// ContentType is the content type of Stream, NDJSONContentType if it is blank.
+	ContentType string
+	// Warnings are the non-fatal anomalies met while processing the request, reported in the warnings field of
+	// the body together with those recorded on the context of the request, see WarningsBody.
+	Warnings []string
 }
 
 type paging struct {
@@ -41,6 +206,7 @@ type jobExecutionResponse struct {
 	Errs      []fdk.APIError     `json:"errors,omitempty"`
 	Meta      paging             `json:"meta"`
 	Resources []pkg.JobExecution `json:"resources"`
+	Warnings  []string           `json:"warnings,omitempty"`
 }
 
 type generateOutputResponseResource struct {
@@ -61,9 +227,407 @@ type filterJobExecsRequest struct {
 	Offset          offsetMeta
 }
 
+type executionRecord struct {
+	key     string
+	newExec bool
+	// prevStatus is the status of the execution when the record was fetched.
+	prevStatus string
+	record     pkg.JobExecution
+	version    string
+	// warnings report the fields of the stored record which were ignored.
+	warnings []string
+}
+
+type queryExecsRequest struct {
+	Cursor      queryCursor
+	Direction   pkg.Direction
+	Format      string
+	HostName    string
+	JobID       string
+	Limit       int
+	Owner       string
+	RunDateFrom string
+	RunDateTo   string
+	SLABreached string
+	SortField   string
+	Status      string
+}
+
+// queryCursor is the position in the storage search results from which the next page starts.
+type queryCursor struct {
+	Offset int `json:"offset"`
+}
+
+type callbackSettings struct {
+	// SigningSecret is the key with which callbacks are signed.
+	SigningSecret string `json:"signing_secret"`
+}
+
+type ticketSettings struct {
+	// AuthHeader is the value of the Authorization header of the requests of the ticketing connectors, e.g.
+	// "Basic <credentials>".
+	AuthHeader string `json:"auth_header"`
+}
+
+type queryAuditRequest struct {
+	Action     string
+	Actor      string
+	Collection string
+	Cursor     queryCursor
+	From       string
+	Limit      int
+	ObjectKey  string
+	To         string
+}
+
+type auditResponse struct {
+	Errs      []fdk.APIError  `json:"errors,omitempty"`
+	Meta      paging          `json:"meta"`
+	Resources []auditc.Record `json:"resources"`
+}
+
+type rbacSettings struct {
+	// Enabled turns on the enforcement of permissions.  Every caller is allowed everything when it is off.
+	Enabled bool `json:"enabled"`
+	// Roles maps each role to the permissions it grants.
+	Roles map[string][]string `json:"roles"`
+}
+
+type retentionSettings struct {
+	// KeepLast is the number of most recent executions to keep per job.  Zero disables the limit.
+	KeepLast int `json:"keep_last"`
+	// MaxAgeDays is the age in days after which executions are pruned.  Zero disables the limit.
+	MaxAgeDays int `json:"max_age_days"`
+}
+
+type retentionRequest struct {
+	DryRun bool `json:"dry_run"`
+}
+
+type retentionResult struct {
+	Deleted    int      `json:"deleted"`
+	DryRun     bool     `json:"dry_run"`
+	Failed     int      `json:"failed"`
+	ObjectKeys []string `json:"object_keys"`
+}
+
+type retentionResponse struct {
+	Errs      []fdk.APIError    `json:"errors,omitempty"`
+	Resources []retentionResult `json:"resources"`
+}
+
+type deleteJobResult struct {
+	DeletedExecutions int    `json:"deleted_executions"`
+	FailedExecutions  int    `json:"failed_executions"`
+	ID                string `json:"id"`
+	JobDeleted        bool   `json:"job_deleted"`
+}
+
+type backfillRequest struct {
+	DryRun bool   `json:"dry_run,omitempty"`
+	End    string `json:"end"`
+	Start  string `json:"start"`
+}
+
+type backfillResult struct {
+	DryRun             bool     `json:"dry_run,omitempty"`
+	Existing           int      `json:"existing"`
+	RestoredExecutions []string `json:"restored_executions"`
+	RestoredJobs       []string `json:"restored_jobs"`
+	Scanned            int      `json:"scanned"`
+	Skipped            int      `json:"skipped"`
+	Truncated          bool     `json:"truncated"`
+}
+
+type backfillResponse struct {
+	Errs      []fdk.APIError   `json:"errors,omitempty"`
+	Resources []backfillResult `json:"resources"`
+}
+
+type importExecutionRequest struct {
+	EndDate     string `json:"end_date,omitempty"`
+	ExecutionID string `json:"execution_id,omitempty"`
+	// Hosts are the results of the hosts the execution ran against, e.g. transcribed from an RTR session.
+	Hosts   []importedHost `json:"hosts,omitempty"`
+	JobName string         `json:"job_name"`
+	RunDate string         `json:"run_date"`
+	// Source describes where the execution was run, e.g. rtr_session.  Defaults to manual.
+	Source       string `json:"source,omitempty"`
+	Status       string `json:"status,omitempty"`
+	StatusReason string `json:"status_reason,omitempty"`
+}
+
+// importedHost is the result of a host of an imported execution.
+type importedHost struct {
+	DeviceID   string `json:"device_id,omitempty"`
+	EndTime    string `json:"end_time,omitempty"`
+	Error      string `json:"error,omitempty"`
+	ExitCode   *int   `json:"exit_code,omitempty"`
+	HostName   string `json:"host_name"`
+	Platform   string `json:"platform,omitempty"`
+	SkipReason string `json:"skip_reason,omitempty"`
+	StartTime  string `json:"start_time,omitempty"`
+	Status     string `json:"status"`
+	Stderr     string `json:"stderr,omitempty"`
+	Stdout     string `json:"stdout,omitempty"`
+}
+
+type renameJobRequest struct {
+	JobID string `json:"job_id"`
+	Name  string `json:"name"`
+}
+
+type renameJobResult struct {
+	Aliases           []string `json:"aliases,omitempty"`
+	FailedExecutions  int      `json:"failed_executions"`
+	ID                string   `json:"id"`
+	Name              string   `json:"name"`
+	RenamedExecutions int      `json:"renamed_executions"`
+}
+
+type renameJobResponse struct {
+	Errs      []fdk.APIError    `json:"errors,omitempty"`
+	Resources []renameJobResult `json:"resources"`
+}
+
+type annotateRequest struct {
+	ExecutionID string `json:"execution_id"`
+	Severity    string `json:"severity,omitempty"`
+	Text        string `json:"text"`
+	TicketURL   string `json:"ticket_url,omitempty"`
+}
+
+type annotateResponse struct {
+	Errs      []fdk.APIError      `json:"errors,omitempty"`
+	Resources []pkg.ExecutionNote `json:"resources"`
+}
+
+type attachEvidenceRequest struct {
+	// Content is the base64 encoded content of the file.
+	Content     string `json:"content"`
+	ContentType string `json:"content_type,omitempty"`
+	DeviceID    string `json:"device_id,omitempty"`
+	ExecutionID string `json:"execution_id"`
+	Name        string `json:"name"`
+}
+
+// evidenceMeta describes an evidence file attached to a job execution.
+type evidenceMeta struct {
+	ContentType string `json:"content_type"`
+	CreatedAt   string `json:"created_at"`
+	DeviceID    string `json:"device_id,omitempty"`
+	ExecutionID string `json:"execution_id"`
+	ID          string `json:"id"`
+	JobID       string `json:"job_id"`
+	Name        string `json:"name"`
+	SHA256      string `json:"sha256"`
+	Size        int    `json:"size"`
+	UploadedBy  string `json:"uploaded_by,omitempty"`
+}
+
+// evidence is the stored evidence file, whose content is base64 encoded.
+type evidence struct {
+	evidenceMeta
+	Content string `json:"content"`
+}
+
+type evidenceResponse struct {
+	Errs      []fdk.APIError `json:"errors,omitempty"`
+	Resources []evidenceMeta `json:"resources"`
+}
+
+// hostOutput is the full RTR output of a host of a job execution, spilled from the execution record.
+type hostOutput struct {
+	DeviceID    string `json:"device_id,omitempty"`
+	ExecutionID string `json:"execution_id"`
+	HostName    string `json:"host_name"`
+	ID          string `json:"id"`
+	JobID       string `json:"job_id"`
+	Stderr      string `json:"stderr"`
+	StderrSize  int    `json:"stderr_size"`
+	Stdout      string `json:"stdout"`
+	StdoutSize  int    `json:"stdout_size"`
+	// Truncated is true if either output exceeded the maximum size of spilled output.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+type hostOutputResponse struct {
+	Errs      []fdk.APIError `json:"errors,omitempty"`
+	Resources []hostOutput   `json:"resources"`
+}
+
+type deleteJobResponse struct {
+	Errs      []fdk.APIError    `json:"errors,omitempty"`
+	Resources []deleteJobResult `json:"resources"`
+}
+
+type missedRunsResult struct {
+	Checked int      `json:"checked"`
+	Missed  []string `json:"missed"`
+}
+
+type missedRunsResponse struct {
+	Errs      []fdk.APIError     `json:"errors,omitempty"`
+	Resources []missedRunsResult `json:"resources"`
+}
+
+type releaseDeferredResult struct {
+	Checked int `json:"checked"`
+	// Executions are the IDs of the new executions which ran the released executions.
+	Executions []string `json:"executions"`
+	Released   int      `json:"released"`
+}
+
+type releaseDeferredResponse struct {
+	Errs      []fdk.APIError          `json:"errors,omitempty"`
+	Resources []releaseDeferredResult `json:"resources"`
+}
+
+type enrichmentResult struct {
+	Abandoned int `json:"abandoned"`
+	Attempted int `json:"attempted"`
+	Enriched  int `json:"enriched"`
+}
+
+type enrichmentResponse struct {
+	Errs      []fdk.APIError     `json:"errors,omitempty"`
+	Resources []enrichmentResult `json:"resources"`
+}
+
+type migrateJobIDsResult struct {
+	Checked   int      `json:"checked"`
+	Conflicts []string `json:"conflicts"`
+	Indexed   int      `json:"indexed"`
+}
+
+type migrateJobIDsResponse struct {
+	Errs      []fdk.APIError        `json:"errors,omitempty"`
+	Resources []migrateJobIDsResult `json:"resources"`
+}
+
+type reaperResult struct {
+	Checked   int `json:"checked"`
+	Recovered int `json:"recovered"`
+	TimedOut  int `json:"timed_out"`
+}
+
+type reaperResponse struct {
+	Errs      []fdk.APIError `json:"errors,omitempty"`
+	Resources []reaperResult `json:"resources"`
+}
+
+type calendarRun struct {
+	// Blackout is the name of the blackout the run falls in, which skips it.
+	Blackout     string    `json:"blackout,omitempty"`
+	JobID        string    `json:"job_id"`
+	Name         string    `json:"name"`
+	RunAt        time.Time `json:"run_at"`
+	ScheduleType string    `json:"schedule_type,omitempty"`
+}
+
+type calendarMeta struct {
+	End           time.Time `json:"end"`
+	Start         time.Time `json:"start"`
+	TruncatedJobs []string  `json:"truncated_jobs,omitempty"`
+}
+
+type calendarResponse struct {
+	Errs      []fdk.APIError `json:"errors,omitempty"`
+	Meta      calendarMeta   `json:"meta"`
+	Resources []calendarRun  `json:"resources"`
+}
+
+type schedulePreviewRequest struct {
+	Count    int          `json:"count,omitempty"`
+	Schedule *jobSchedule `json:"schedule"`
+}
+
+type schedulePreview struct {
+	NextRuns         []time.Time `json:"next_runs"`
+	TotalRecurrences int64       `json:"total_recurrences"`
+}
+
+type schedulePreviewResponse struct {
+	Errs      []fdk.APIError    `json:"errors,omitempty"`
+	Resources []schedulePreview `json:"resources"`
+}
+
+// payloadIssue is a problem with a field of a workflow event, see ValidatePayloadProcessor.  Problems with the
+// event as a whole have a blank field.
+type payloadIssue struct {
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// payloadValidation is the outcome of validating a workflow event.
+type payloadValidation struct {
+	Errors []payloadIssue `json:"errors"`
+	// Event is the event as normalized by the upsert flow, set when it is valid.
+	Event    *workflowMeta `json:"event,omitempty"`
+	JobName  string        `json:"job_name,omitempty"`
+	Valid    bool          `json:"valid"`
+	Warnings []string      `json:"warnings"`
+}
+
+type validatePayloadResponse struct {
+	Errs      []fdk.APIError      `json:"errors,omitempty"`
+	Resources []payloadValidation `json:"resources"`
+}
+
+type settingsRequest struct {
+	Name  string          `json:"name"`
+	Value json.RawMessage `json:"value"`
+}
+
+type settingsResponse struct {
+	Errs      []fdk.APIError    `json:"errors,omitempty"`
+	Resources []settingsRequest `json:"resources"`
+}
+
+type componentHealth struct {
+	Error         string `json:"error,omitempty"`
+	LatencyMillis int64  `json:"latency_ms"`
+	Name          string `json:"name"`
+	Status        string `json:"status"`
+}
+
+type healthResponse struct {
+	Errs      []fdk.APIError    `json:"errors,omitempty"`
+	Resources []componentHealth `json:"resources"`
+	Status    string            `json:"status"`
+}
+
+type selfTestStep struct {
+	DurationMillis int64  `json:"duration_ms"`
+	Error          string `json:"error,omitempty"`
+	Name           string `json:"name"`
+	Status         string `json:"status"`
+}
+
+type selfTestResponse struct {
+	Errs      []fdk.APIError `json:"errors,omitempty"`
+	Resources []selfTestStep `json:"resources"`
+	Status    string         `json:"status"`
+}
+
+type functionStatsResponse struct {
+	Errs      []fdk.APIError  `json:"errors,omitempty"`
+	Resources []functionStats `json:"resources"`
+}
+
 type logscaleRecord struct {
-	Success  string
-	HostName string
+	DeviceID      string
+	End           time.Time
+	Error         string
+	ExitCode      *int
+	FailureReason string
+	FileHash      string
+	HostName      string
+	Platform      string
+	Start         time.Time
+	Stderr        string
+	Stdout        string
+	Success       string
 }
 
 type offsetMeta struct {
@@ -76,7 +640,11 @@ type workflowMeta struct {
 	ExecutionID        string `json:"execution_id,omitempty"`
 	ExecutionTimestamp string `json:"execution_timestamp,omitempty"`
 	DefinitionName     string `json:"definition_name,omitempty"`
-	Status             string `json:"status,omitempty"`
+	// ParentExecutionID is the workflow execution ID of the composite job execution the event reports a step of.
+	ParentExecutionID string `json:"parent_execution_id,omitempty"`
+	Status            string `json:"status,omitempty"`
+	// Step is the number of the step, starting from 1, of the events of step executions.
+	Step int `json:"step,omitempty"`
 }
 
 func (w workflowMeta) jobName() (string, error) {
@@ -91,12 +659,530 @@ func (w workflowMeta) jobName() (string, error) {
 }
 
 type job struct {
-	LastRun          time.Time    `json:"last_run"`
-	NextRun          time.Time    `json:"next_run"`
-	RunCount         int64        `json:"run_count"`
-	RunNow           bool         `json:"run_now"`
-	Schedule         *jobSchedule `json:"schedule,omitempty"`
-	TotalRecurrences int64        `json:"total_recurrences"`
+	Action              *jobAction        `json:"action,omitempty"`
+	Aliases             []string          `json:"aliases,omitempty"`
+	BaselineExecutionID string            `json:"baseline_execution_id,omitempty"`
+	CallbackURL         string            `json:"callback_url,omitempty"`
+	Draft               bool              `json:"draft,omitempty"`
+	Expired             bool              `json:"expired,omitempty"`
+	HostCount           int               `json:"host_count,omitempty"`
+	JitterOffset        int               `json:"jitter_offset_minutes,omitempty"`
+	LastExecutionID     string            `json:"last_execution_id,omitempty"`
+	LastRun             time.Time         `json:"last_run"`
+	LastRunStatus       string            `json:"last_run_status,omitempty"`
+	MaintenanceWindow   *jobWindow        `json:"maintenance_window,omitempty"`
+	MaxConcurrentRuns   int               `json:"max_concurrent_runs,omitempty"`
+	Name                string            `json:"name,omitempty"`
+	NextRun             time.Time         `json:"next_run"`
+	NotificationTargets []notifier.Target `json:"notification_targets,omitempty"`
+	OverlapPolicy       string            `json:"overlap_policy,omitempty"`
+	Paused              bool              `json:"paused,omitempty"`
+	Rollout             *jobRollout       `json:"rollout,omitempty"`
+	RunCount            int64             `json:"run_count"`
+	RunNow              bool              `json:"run_now"`
+	SLA                 *jobSLA           `json:"sla,omitempty"`
+	Schedule            *jobSchedule      `json:"schedule,omitempty"`
+	Steps               []jobStep         `json:"steps,omitempty"`
+	Target              *jobTarget        `json:"target,omitempty"`
+	Ticketing           *jobTicketing     `json:"ticketing,omitempty"`
+	TotalRecurrences    int64             `json:"total_recurrences"`
+	UserID              string            `json:"user_id,omitempty"`
+	UserName            string            `json:"user_name,omitempty"`
+	Workflows           *jobWorkflows     `json:"workflows,omitempty"`
+}
+
+// jobSLA are the objectives which finished executions of a job are expected to meet.  Zero values are not
+// enforced.
+type jobSLA struct {
+	MaxDurationSeconds int64 `json:"max_duration_seconds,omitempty"`
+	// MinSuccessRate is the minimum fraction, from 0 to 1, of the hosts with results on which the job succeeded.
+	MinSuccessRate float64 `json:"min_success_rate,omitempty"`
+}
+
+// jobTicketing configures the ticket opened in an ITSM system when an execution of a job fails, see
+// WithConnectors.
+type jobTicketing struct {
+	// Statuses are the execution statuses for which a ticket is opened.  Defaults to CompletedWithErrors, Failed
+	// and TimedOut.
+	Statuses  []string `json:"statuses,omitempty"`
+	UpdateURL string   `json:"update_url,omitempty"`
+	URL       string   `json:"url"`
+}
+
+// jobRollout configures the rollout of a job to its target hosts in waves, see StartRolloutProcessor.
+type jobRollout struct {
+	// AbortFailureRate is the fraction, from 0 to 1, of the hosts with results on which the rollout may fail
+	// before its remaining waves are halted, or 0 to never halt it.
+	AbortFailureRate float64 `json:"abort_failure_rate,omitempty"`
+	BatchSize        int     `json:"batch_size"`
+	// WaitSeconds is the time to wait between the end of a wave and the start of the next.
+	WaitSeconds int64 `json:"wait_seconds,omitempty"`
+}
+
+// jobWindow is the maintenance window of a job, outside of which the executions triggered by its workflow are
+// deferred, see deferExecution.  Executions started by the app itself, i.e. reruns and rollout waves, record
+// themselves before their workflow reports them and are not deferred.
+type jobWindow struct {
+	// Days are the days of the week, as mon to sun, on which the window opens, or every day if empty.
+	Days []string `json:"days,omitempty"`
+	// End is the time of day, as HH:MM, at which the window closes.  Windows ending at or before their start
+	// close on the following day.
+	End   string `json:"end"`
+	Start string `json:"start"`
+	// Timezone is the IANA name of the timezone of Start and End, UTC if blank.
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// scheduled reports whether the schedule workflow of the job is expected to be enabled, i.e. the job is neither
+// a draft, paused, expired nor finished.
+func (j job) scheduled() bool {
+	finished := j.TotalRecurrences > 0 && j.RunCount >= j.TotalRecurrences
+	return !(j.Draft || j.Paused || j.Expired || finished)
+}
+
+type jobAction struct {
+	// FileName is the put file installed by install jobs.
+	FileName string `json:"file_name,omitempty"`
+	Type     string `json:"type"`
+}
+
+// jobStep is a step of a composite job.  The steps of a job are run in order, each by its own workflow execution.
+type jobStep struct {
+	Action *jobAction `json:"action,omitempty"`
+	Name   string     `json:"name,omitempty"`
+}
+
+// step returns the job as run by its nth step, starting from 1: the job with the action of the step.
+func (j job) step(n int) (job, error) {
+	if n < 1 || n > len(j.Steps) {
+		return job{}, fmt.Errorf("job %s has no step %d", j.Name, n)
+	}
+	s := j
+	s.Action = j.Steps[n-1].Action
+	s.Steps = nil
+	return s, nil
+}
+
+// actionType returns the action type of the job, or a blank string if it has none.
+func (j job) actionType() string {
+	if j.Action == nil {
+		return ""
+	}
+	return j.Action.Type
+}
+
+// targetPlatforms returns the Falcon names of the platforms targeted by the job, or nil if the job targets every
+// platform.
+func (j job) targetPlatforms() []string {
+	if j.Target == nil {
+		return nil
+	}
+	var platforms []string
+	for _, pl := range j.Target.Platforms {
+		if pl = pkg.NormalizePlatform(pl); pl != "" {
+			platforms = append(platforms, pl)
+		}
+	}
+	return platforms
+}
+
+type jobTarget struct {
+	HostGroups []string `json:"host_groups"`
+	Hosts      []string `json:"hosts"`
+	Platforms  []string `json:"platforms,omitempty"`
+}
+
+type jobWorkflows struct {
+	NotifierWorkflow string `json:"notifier_workflow,omitempty"`
+	ScheduleWorkflow string `json:"scheduled_workflow,omitempty"`
+}
+
+type pauseRequest struct {
+	JobID string `json:"job_id"`
+}
+
+type jobState struct {
+	ID      string    `json:"id"`
+	NextRun time.Time `json:"next_run"`
+	Paused  bool      `json:"paused"`
+}
+
+type jobStateResponse struct {
+	Errs      []fdk.APIError `json:"errors,omitempty"`
+	Resources []jobState     `json:"resources"`
+}
+
+type searchJobsRequest struct {
+	Cursor        queryCursor
+	HostGroup     string
+	LastRunStatus string
+	Limit         int
+	Name          string
+	Owner         string
+	ScheduleType  string
+	Tag           string
+}
+
+type searchJobsResponse struct {
+	Errs      []fdk.APIError   `json:"errors,omitempty"`
+	Meta      paging           `json:"meta"`
+	Resources []map[string]any `json:"resources"`
+}
+
+type executionDiff struct {
+	Added             []pkg.TargetedHost `json:"added"`
+	BaseExecutionID   string             `json:"base_execution_id"`
+	JobID             string             `json:"job_id"`
+	NewlyFailed       []pkg.TargetedHost `json:"newly_failed"`
+	NewlySucceeded    []pkg.TargetedHost `json:"newly_succeeded"`
+	Removed           []pkg.TargetedHost `json:"removed"`
+	TargetExecutionID string             `json:"target_execution_id"`
+}
+
+type executionDiffResponse struct {
+	Errs      []fdk.APIError  `json:"errors,omitempty"`
+	Resources []executionDiff `json:"resources"`
+}
+
+type baselineRequest struct {
+	ExecutionID string `json:"execution_id"`
+}
+
+type jobBaseline struct {
+	BaselineExecutionID string `json:"baseline_execution_id"`
+	JobID               string `json:"job_id"`
+}
+
+type jobBaselineResponse struct {
+	Errs      []fdk.APIError `json:"errors,omitempty"`
+	Resources []jobBaseline  `json:"resources"`
+}
+
+type baselineCheck struct {
+	BaselineExecutionID string `json:"baseline_execution_id"`
+	// DurationDrift is the percentage by which the execution ran longer than the baseline, negative if it ran
+	// shorter.
+	DurationDrift    *float64           `json:"duration_drift,omitempty"`
+	DurationExceeded bool               `json:"duration_exceeded"`
+	ExecutionID      string             `json:"execution_id"`
+	JobID            string             `json:"job_id"`
+	MaxDurationDrift int                `json:"max_duration_drift"`
+	RegressedHosts   []pkg.TargetedHost `json:"regressed_hosts"`
+	Verdict          string             `json:"verdict"`
+}
+
+type baselineCheckResponse struct {
+	Errs      []fdk.APIError  `json:"errors,omitempty"`
+	Resources []baselineCheck `json:"resources"`
+}
+
+type digestRequest struct {
+	Logscale   bool   `json:"logscale"`
+	Period     string `json:"period"`
+	WebhookURL string `json:"webhook_url"`
+}
+
+// digestReport is a rollup of the finished runs of every job over a period.
+type digestReport struct {
+	CompletedWithErrors int            `json:"completed_with_errors"`
+	Failed              int            `json:"failed"`
+	From                string         `json:"from"`
+	GeneratedAt         string         `json:"generated_at"`
+	ID                  string         `json:"id"`
+	Jobs                []digestJob    `json:"jobs"`
+	Period              string         `json:"period"`
+	Runs                int            `json:"runs"`
+	Succeeded           int            `json:"succeeded"`
+	To                  string         `json:"to"`
+	TopFailingHosts     []hostFailures `json:"top_failing_hosts"`
+	Truncated           bool           `json:"truncated,omitempty"`
+}
+
+type digestJob struct {
+	CompletedWithErrors int    `json:"completed_with_errors"`
+	Failed              int    `json:"failed"`
+	JobID               string `json:"job_id"`
+	JobName             string `json:"job_name"`
+	Runs                int    `json:"runs"`
+	Succeeded           int    `json:"succeeded"`
+}
+
+type digestResponse struct {
+	Errs      []fdk.APIError `json:"errors,omitempty"`
+	Resources []digestReport `json:"resources"`
+}
+
+type reconcileWorkflowsRequest struct {
+	DryRun bool `json:"dry_run"`
+}
+
+// workflowDrift is a difference between a job and one of its workflow definitions.
+type workflowDrift struct {
+	DefinitionID string `json:"definition_id"`
+	Error        string `json:"error,omitempty"`
+	Fixed        bool   `json:"fixed"`
+	Issue        string `json:"issue"`
+	JobID        string `json:"job_id"`
+}
+
+type reconcileWorkflowsResult struct {
+	Checked int             `json:"checked"`
+	Drifts  []workflowDrift `json:"drifts"`
+	DryRun  bool            `json:"dry_run"`
+}
+
+type reconcileWorkflowsResponse struct {
+	Errs      []fdk.APIError             `json:"errors,omitempty"`
+	Resources []reconcileWorkflowsResult `json:"resources"`
+}
+
+// syncRequest is a request to reconcile the stored jobs with a manifest, see SyncProcessor.
+type syncRequest struct {
+	DryRun bool `json:"dry_run"`
+	// Manifest is the manifest of the desired jobs, either as a JSON object or as a string holding a YAML or JSON
+	// document.
+	Manifest json.RawMessage `json:"manifest"`
+}
+
+// jobManifest declares the jobs which should exist.  Jobs are kept as they are given, as they are created from
+// every field of their manifest entry.
+type jobManifest struct {
+	Jobs []map[string]any `json:"jobs"`
+}
+
+// manifestJob are the fields of a job of a manifest which are reconciled with the stored job.
+type manifestJob struct {
+	Name   string `json:"name"`
+	Paused bool   `json:"paused,omitempty"`
+	// Schedule is left as it is on the stored job when it is nil.
+	Schedule *jobSchedule `json:"schedule,omitempty"`
+}
+
+// syncChange is a change of the plan of a sync.
+type syncChange struct {
+	Action  string `json:"action"`
+	Applied bool   `json:"applied"`
+	// Changes are the names of the fields changed by updates.
+	Changes []string `json:"changes,omitempty"`
+	Error   string   `json:"error,omitempty"`
+	JobID   string   `json:"job_id"`
+	JobName string   `json:"job_name"`
+	// Reprovision is true for jobs whose workflows are deprovisioned by the change, which are saved as drafts to
+	// be provisioned again by Func_Jobs.
+	Reprovision bool `json:"reprovision,omitempty"`
+}
+
+type syncResult struct {
+	DryRun    bool         `json:"dry_run"`
+	Plan      []syncChange `json:"plan"`
+	Unchanged int          `json:"unchanged"`
+}
+
+type syncResponse struct {
+	Errs      []fdk.APIError `json:"errors,omitempty"`
+	Resources []syncResult   `json:"resources"`
+}
+
+type reconcileRequest struct {
+	DryRun bool `json:"dry_run"`
+}
+
+// orphanJob is a job without a workflow.
+type orphanJob struct {
+	DefinitionID string `json:"definition_id,omitempty"`
+	Error        string `json:"error,omitempty"`
+	Issue        string `json:"issue"`
+	JobID        string `json:"job_id"`
+	JobName      string `json:"job_name"`
+	Repaired     bool   `json:"repaired"`
+}
+
+// orphanWorkflow is a workflow definition of the app without a job.
+type orphanWorkflow struct {
+	DefinitionID string `json:"definition_id"`
+	Error        string `json:"error,omitempty"`
+	Name         string `json:"name"`
+	Repaired     bool   `json:"repaired"`
+}
+
+type reconcileResult struct {
+	Checked         int              `json:"checked"`
+	Definitions     int              `json:"definitions"`
+	DryRun          bool             `json:"dry_run"`
+	OrphanJobs      []orphanJob      `json:"orphan_jobs"`
+	OrphanWorkflows []orphanWorkflow `json:"orphan_workflows"`
+}
+
+type reconcileResponse struct {
+	Errs      []fdk.APIError    `json:"errors,omitempty"`
+	Resources []reconcileResult `json:"resources"`
+}
+
+type uploadPutFileRequest struct {
+	Content     string `json:"content"`
+	Description string `json:"description"`
+	Name        string `json:"name"`
+	Notes       string `json:"notes"`
+}
+
+// putFile is the record of an RTR put file and its versions.
+type putFile struct {
+	CreatedAt     string           `json:"created_at"`
+	Description   string           `json:"description,omitempty"`
+	LatestVersion int              `json:"latest_version"`
+	Name          string           `json:"name"`
+	UpdatedAt     string           `json:"updated_at"`
+	Versions      []putFileVersion `json:"versions"`
+}
+
+// latest returns the latest remaining version of the file, or nil if it has none.
+func (pf putFile) latest() *putFileVersion {
+	if len(pf.Versions) == 0 {
+		return nil
+	}
+	return &pf.Versions[len(pf.Versions)-1]
+}
+
+// putFileVersion is a version of a put file.  Jobs install it by its file name.
+type putFileVersion struct {
+	FileID     string `json:"file_id"`
+	FileName   string `json:"file_name"`
+	Notes      string `json:"notes,omitempty"`
+	SHA256     string `json:"sha256"`
+	Size       int    `json:"size"`
+	UploadedAt string `json:"uploaded_at"`
+	UploadedBy string `json:"uploaded_by,omitempty"`
+	Version    int    `json:"version"`
+}
+
+// rollout is the record of the rollout of a job to its target hosts in waves.
+type rollout struct {
+	AbortFailureRate float64 `json:"abort_failure_rate,omitempty"`
+	// AbortReason explains why the remaining waves were halted if the status is aborted.
+	AbortReason    string        `json:"abort_reason,omitempty"`
+	EndedAt        string        `json:"ended_at,omitempty"`
+	FailedHosts    int           `json:"failed_hosts"`
+	ID             string        `json:"id"`
+	JobID          string        `json:"job_id"`
+	JobName        string        `json:"job_name"`
+	StartedAt      string        `json:"started_at"`
+	StartedBy      string        `json:"started_by,omitempty"`
+	Status         string        `json:"status"`
+	SucceededHosts int           `json:"succeeded_hosts"`
+	WaitSeconds    int64         `json:"wait_seconds,omitempty"`
+	Waves          []rolloutWave `json:"waves"`
+}
+
+// rolloutWave is a wave of a rollout, run as its own workflow execution scoped to the hosts of the wave.
+type rolloutWave struct {
+	EndedAt        string             `json:"ended_at,omitempty"`
+	ExecutionID    string             `json:"execution_id,omitempty"`
+	FailedHosts    int                `json:"failed_hosts"`
+	Hosts          []pkg.ResolvedHost `json:"hosts"`
+	StartedAt      string             `json:"started_at,omitempty"`
+	Status         string             `json:"status"`
+	SucceededHosts int                `json:"succeeded_hosts"`
+	Wave           int                `json:"wave"`
+}
+
+type startRolloutRequest struct {
+	JobID string `json:"job_id"`
+}
+
+type rolloutResponse struct {
+	Errs      []fdk.APIError `json:"errors,omitempty"`
+	Resources []rollout      `json:"resources"`
+}
+
+// advanceRolloutsResult summarizes a run of the AdvanceRolloutsProcessor.
+type advanceRolloutsResult struct {
+	Aborted   int `json:"aborted"`
+	Checked   int `json:"checked"`
+	Completed int `json:"completed"`
+	// WavesStarted is the number of waves started by the run.
+	WavesStarted int `json:"waves_started"`
+}
+
+type advanceRolloutsResponse struct {
+	Errs      []fdk.APIError          `json:"errors,omitempty"`
+	Resources []advanceRolloutsResult `json:"resources"`
+}
+
+type putFileResponse struct {
+	Errs      []fdk.APIError `json:"errors,omitempty"`
+	Resources []putFile      `json:"resources"`
+}
+
+type hostSummary struct {
+	ExecutionID string             `json:"execution_id"`
+	GroupBy     string             `json:"group_by"`
+	Groups      []hostGroupSummary `json:"groups"`
+	Hosts       int                `json:"hosts"`
+	JobID       string             `json:"job_id"`
+}
+
+type hostGroupSummary struct {
+	Group    string         `json:"group"`
+	Hosts    int            `json:"hosts"`
+	Statuses map[string]int `json:"statuses"`
+}
+
+type hostSummaryResponse struct {
+	Errs      []fdk.APIError `json:"errors,omitempty"`
+	Resources []hostSummary  `json:"resources"`
+}
+
+// statsCache is the cached history of the finished runs of a job from which its statistics are computed.
+type statsCache struct {
+	LastFailure string     `json:"last_failure,omitempty"`
+	Runs        []statsRun `json:"runs"`
+	Through     string     `json:"through,omitempty"`
+}
+
+type statsRun struct {
+	Duration       *float64       `json:"duration_seconds,omitempty"`
+	ExecutionID    string         `json:"execution_id"`
+	FailedHosts    []string       `json:"failed_hosts,omitempty"`
+	FailureReasons map[string]int `json:"failure_reasons,omitempty"`
+	RunDate        string         `json:"run_date"`
+	Status         string         `json:"status"`
+}
+
+type jobStats struct {
+	AvgDuration         float64        `json:"avg_duration_seconds"`
+	CompletedWithErrors int            `json:"completed_with_errors"`
+	Failed              int            `json:"failed"`
+	FailureReasons      map[string]int `json:"failure_reasons"`
+	JobID               string         `json:"job_id"`
+	LastFailure         string         `json:"last_failure,omitempty"`
+	P95Duration         float64        `json:"p95_duration_seconds"`
+	Runs                int            `json:"runs"`
+	Succeeded           int            `json:"succeeded"`
+	SuccessRate         float64        `json:"success_rate"`
+	TopFailingHosts     []hostFailures `json:"top_failing_hosts"`
+}
+
+type hostFailures struct {
+	Failures int    `json:"failures"`
+	HostName string `json:"host_name"`
+}
+
+type jobStatsResponse struct {
+	Errs      []fdk.APIError `json:"errors,omitempty"`
+	Resources []jobStats     `json:"resources"`
+}
+
+type rerunRequest struct {
+	ExecutionID string `json:"execution_id"`
+}
+
+type reprocessRequest struct {
+	ExecutionID string `json:"execution_id"`
+}
+
+type rerunTargets struct {
+	DeviceIDs []string `json:"device_ids"`
+	HostNames []string `json:"host_names"`
 }
 
 type jobSchedule struct {
@@ -104,4 +1190,5 @@ type jobSchedule struct {
 	SkipConcurrent bool   `json:"skip_concurrent,omitempty"`
 	Start          string `json:"start_date,omitempty"`
 	TimeCycle      string `json:"time_cycle,omitempty"`
+	Timezone       string `json:"timezone,omitempty"`
 }
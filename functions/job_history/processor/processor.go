@@ -1,11 +1,15 @@
 package processor
 
 import (
+	"context"
 	"encoding/json"
-	"time"
+	"errors"
+	"fmt"
+	"sort"
 
 	fdk "github.com/CrowdStrike/foundry-fn-go"
 	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
 	"github.com/sirupsen/logrus"
 )
 
@@ -25,6 +29,118 @@ func jobExecRespJSON(page *paging, j []pkg.JobExecution, e []fdk.APIError, logge
 	return rJSON
 }
 
-func nowT() time.Time {
-	return time.Now().UTC()
+// paginateHosts returns the executions with only the requested page of their targeted hosts, ordered by host
+// name and device ID so that pages are stable across requests.  The page is recorded on each execution with the
+// total number of its hosts.
+func paginateHosts(execs []pkg.JobExecution, hp pkg.HostsPage) []pkg.JobExecution {
+	for i := range execs {
+		hosts := sortedHosts(execs[i].TargetedHosts)
+		page := hp
+		page.Total = len(hosts)
+		start := min((hp.Page-1)*hp.PageSize, len(hosts))
+		end := min(start+hp.PageSize, len(hosts))
+		execs[i].TargetedHosts = hosts[start:end]
+		execs[i].TargetedHostsPage = &page
+	}
+	return execs
+}
+
+// sortedHosts returns a copy of the hosts ordered by host name and device ID.
+func sortedHosts(hosts []pkg.TargetedHost) []pkg.TargetedHost {
+	sorted := append(make([]pkg.TargetedHost, 0, len(hosts)), hosts...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].HostName != sorted[j].HostName {
+			return sorted[i].HostName < sorted[j].HostName
+		}
+		return sorted[i].DeviceID < sorted[j].DeviceID
+	})
+	return sorted
+}
+
+// errorResponse builds the failed Response of the error, see newErrorResponse.
+func errorResponse(err error, logger logrus.FieldLogger) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return jobExecRespJSON(nil, nil, errs, logger)
+	})
+}
+
+// fetchObject fetches an object from custom storage and deserializes it into a map, also returning its version.
+func fetchObject(ctx context.Context, strgc storagec.StorageC, collection, objectKey string) (map[string]any, string, error) {
+	req := storagec.FetchObjectRequest{
+		Collection: collection,
+		ObjectKey:  objectKey,
+	}
+	resp, err := strgc.FetchObject(ctx, req)
+	if errors.Is(err, storagec.NotFound) {
+		return nil, "", err
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to fetch record: %w", err)
+	}
+	if len(resp.Data) == 0 {
+		return nil, "", storagec.NotFound
+	}
+
+	data, err := pkg.DecodeBase64JSON(resp.Data)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to deserialize record: %w: %s", errMalformedRecord, err)
+	}
+
+	var obj map[string]any
+	if err = json.Unmarshal(data, &obj); err != nil {
+		return nil, "", fmt.Errorf("failed to deserialize record: %w: %s", errMalformedRecord, err)
+	}
+	return obj, resp.Version, nil
+}
+
+// putObject uploads an object to custom storage.  If version is not blank, the write only succeeds
+// if the stored object is still at that version.
+func putObject(ctx context.Context, strgc storagec.StorageC, collection, object string, data []byte, version string) error {
+	req := storagec.PutObjectRequest{
+		Collection: collection,
+		Data:       data,
+		IfVersion:  version,
+		ObjectKey:  object,
+	}
+	_, err := strgc.PutObject(ctx, req)
+	return err
+}
+
+// fetchJobExecution returns the job execution record of the given workflow execution, or a not found error if
+// there isn't one.
+func fetchJobExecution(ctx context.Context, strgc storagec.StorageC, execID string) (pkg.JobExecution, error) {
+	execKey, err := locateJobExecution(ctx, strgc, execID)
+	if err != nil {
+		return pkg.JobExecution{}, fmt.Errorf("failed to locate job execution record: %w", err)
+	}
+	if execKey == "" {
+		return pkg.JobExecution{}, newError(ErrNotFound, "job execution %s not found", execID)
+	}
+	execMap, _, err := fetchObject(ctx, strgc, jobExecutionCollection, execKey)
+	if err != nil {
+		return pkg.JobExecution{}, err
+	}
+	je, err := mapToJobExecution(execMap)
+	if err != nil {
+		return pkg.JobExecution{}, fmt.Errorf("failed to deserialize job execution record: %s", err)
+	}
+	return je, nil
+}
+
+// locateJobExecution returns the object key of the job execution record of the given workflow execution,
+// or a blank string if there isn't one.
+func locateJobExecution(ctx context.Context, strgc storagec.StorageC, execID string) (string, error) {
+	filter, err := pkg.NewFQLQuery([]pkg.Filter{{Field: "execution_id", Value: execID}})
+	if err != nil {
+		return "", err
+	}
+	sr, err := strgc.SearchAll(ctx, storagec.SearchObjectsRequest{
+		Collection: jobExecutionCollection,
+		Filter:     filter,
+	})
+	if len(sr.ObjectKeys) == 0 {
+		return "", err
+	}
+	// there can only be one
+	return sr.ObjectKeys[0], err
 }
@@ -0,0 +1,204 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/validate"
+	"github.com/sirupsen/logrus"
+)
+
+// AnnotateExecutionProcessor attaches notes written by analysts to job executions, so that the context of their
+// triage lives next to the run history.  Notes are stored in their own collection, keyed by the execution ID and
+// the time they were written, and are returned with the executions by the QueryExecutionsProcessor.
+type AnnotateExecutionProcessor struct {
+	logger logrus.FieldLogger
+	strgc  storagec.StorageC
+	clock  pkg.Clock
+}
+
+// NewAnnotateExecutionProcessor returns a new AnnotateExecutionProcessor instance.
+func NewAnnotateExecutionProcessor(strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *AnnotateExecutionProcessor)) *AnnotateExecutionProcessor {
+	p := &AnnotateExecutionProcessor{
+		logger: logger,
+		strgc:  strgc,
+		clock:  pkg.SystemClock,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// Process adds the note in the request body to the execution identified by its execution_id.  The text of the
+// note is required, while its severity and ticket_url are optional.  The caller is recorded as the author.
+func (p *AnnotateExecutionProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	var ar annotateRequest
+	if err := json.Unmarshal(req.Body, &ar); err != nil {
+		return p.errResp(newError(ErrBadRequest, "failed to parse request body: %s", err))
+	}
+	ar.ExecutionID = strings.TrimSpace(ar.ExecutionID)
+	ar.Text = strings.TrimSpace(ar.Text)
+	ar.Severity = strings.ToLower(strings.TrimSpace(ar.Severity))
+	ar.TicketURL = strings.TrimSpace(ar.TicketURL)
+	err := validate.Fields(
+		validate.Field{Name: "execution_id", Value: ar.ExecutionID, Rules: []validate.Rule{validate.Required()}},
+		validate.Field{Name: "text", Value: ar.Text, Rules: []validate.Rule{validate.Required(), noteTextRule}},
+		validate.Field{Name: "severity", Value: ar.Severity, Rules: []validate.Rule{noteSeverityRule}},
+		validate.Field{Name: "ticket_url", Value: ar.TicketURL, Rules: []validate.Rule{httpURLRule}},
+	)
+	if err != nil {
+		return p.errResp(err)
+	}
+	logger := p.logger.WithField("execution_id", ar.ExecutionID)
+
+	key, err := locateJobExecution(ctx, p.strgc, ar.ExecutionID)
+	if err != nil {
+		err = fmt.Errorf("failed to search for job execution: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	if key == "" {
+		return p.errResp(newError(ErrNotFound, "not found"))
+	}
+	execMap, _, err := fetchObject(ctx, p.strgc, jobExecutionCollection, key)
+	if errors.Is(err, storagec.NotFound) {
+		return p.errResp(newError(ErrNotFound, "not found"))
+	}
+	if err != nil {
+		err = fmt.Errorf("could not fetch job execution record: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	jobID, _ := execMap["job_id"].(string)
+
+	now := p.clock.Now().UTC()
+	c := callerFromRequest(req)
+	note := pkg.ExecutionNote{
+		AuthorID:    c.ID,
+		AuthorName:  c.Name,
+		CreatedAt:   now.Format(pkg.ISOTimeFormat),
+		ExecutionID: ar.ExecutionID,
+		ID:          fmt.Sprintf("%s_%d", ar.ExecutionID, now.UnixNano()),
+		JobID:       jobID,
+		Severity:    ar.Severity,
+		Text:        ar.Text,
+		TicketURL:   ar.TicketURL,
+	}
+	data, err := json.Marshal(note)
+	if err != nil {
+		err = fmt.Errorf("failed to serialize execution note: %s", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	if err = putObject(ctx, p.strgc, executionNoteCollection, note.ID, data, ""); err != nil {
+		err = fmt.Errorf("failed to save execution note: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	logger.WithField("note_id", note.ID).Info("annotated job execution")
+
+	return Response{
+		Body: p.annotateRespJSON([]pkg.ExecutionNote{note}, nil),
+		Code: http.StatusCreated,
+	}
+}
+
+func (p *AnnotateExecutionProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return p.annotateRespJSON(nil, errs)
+	})
+}
+
+func (p *AnnotateExecutionProcessor) annotateRespJSON(r []pkg.ExecutionNote, e []fdk.APIError) []byte {
+	if r == nil {
+		r = make([]pkg.ExecutionNote, 0)
+	}
+	resp := annotateResponse{Errs: e, Resources: r}
+	rJSON, err := json.Marshal(resp)
+	if err != nil {
+		p.logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
+
+// attachNotes sets the notes of the given job executions, oldest first.  The notes of up to
+// maxNotedExecutionsPerSearch executions are searched at a time.
+func attachNotes(ctx context.Context, strgc storagec.StorageC, execs []pkg.JobExecution) ([]pkg.JobExecution, error) {
+	byExec := make(map[string][]pkg.ExecutionNote)
+	for start := 0; start < len(execs); start += maxNotedExecutionsPerSearch {
+		end := min(start+maxNotedExecutionsPerSearch, len(execs))
+		ids := make([]string, 0, end-start)
+		for _, je := range execs[start:end] {
+			ids = append(ids, je.ExecutionID)
+		}
+		b := &pkg.QueryBuilder{}
+		filter, err := b.WhereAny("execution_id", ids...).Build()
+		if err != nil {
+			return execs, fmt.Errorf("failed to build execution notes filter: %w", err)
+		}
+		sr, err := strgc.SearchAll(ctx, storagec.SearchObjectsRequest{
+			Collection: executionNoteCollection,
+			Filter:     filter,
+		})
+		if err != nil {
+			return execs, fmt.Errorf("failed to search for execution notes: %w", err)
+		}
+		if len(sr.ObjectKeys) == 0 {
+			continue
+		}
+		resp := strgc.BulkFetch(ctx, storagec.BulkFetchObjectsRequest{
+			Collection: executionNoteCollection,
+			ObjectKeys: sr.ObjectKeys,
+		})
+		for k, err := range resp.Errs {
+			if !errors.Is(err, storagec.NotFound) {
+				return execs, fmt.Errorf("failed to fetch execution note %s: %w", k, err)
+			}
+		}
+		for k, data := range resp.Objects {
+			var n pkg.ExecutionNote
+			if err = json.Unmarshal(data, &n); err != nil {
+				return execs, fmt.Errorf("failed to deserialize execution note %s: %s", k, err)
+			}
+			byExec[n.ExecutionID] = append(byExec[n.ExecutionID], n)
+		}
+	}
+
+	for i, je := range execs {
+		notes := byExec[je.ExecutionID]
+		sort.Slice(notes, func(a, b int) bool {
+			return notes[a].ID < notes[b].ID
+		})
+		execs[i].Notes = notes
+	}
+	return execs, nil
+}
+
+// noteTextRule rejects note texts longer than maxNoteLength characters.
+var noteTextRule validate.Rule = func(v string) string {
+	if utf8.RuneCountInString(v) > maxNoteLength {
+		return fmt.Sprintf("must be at most %d characters", maxNoteLength)
+	}
+	return ""
+}
+
+// noteSeverityRule rejects unknown note severities.
+var noteSeverityRule = validate.Enum(pkg.NoteSeverityInfo, pkg.NoteSeverityLow, pkg.NoteSeverityMedium, pkg.NoteSeverityHigh, pkg.NoteSeverityCritical)
+
+// httpURLRule rejects values which are not absolute http or https URLs.
+var httpURLRule = validate.Check(func(v string) bool {
+	u, err := url.Parse(v)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}, "must be an http or https URL")
@@ -0,0 +1,454 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/auditc"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/searchc"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/validate"
+	"github.com/sirupsen/logrus"
+)
+
+// Suffixes of the lower case keys of the events returned by the workflow executions query.
+const (
+	eventDefinitionName = "workflow.definition.name"
+	eventExecutionID    = "workflowrootexecutionid"
+	eventFirstSeen      = "first_seen"
+	eventLastSeen       = "last_seen"
+)
+
+// BackfillProcessor rebuilds the job execution and job records missing from storage from the events the workflows
+// of the app wrote to Logscale, e.g. after the collections were wiped or the app was reinstalled.
+//
+// Restored executions are recorded as completed, with the host results found in Logscale.  Restored jobs are
+// drafts holding only the name, action type and run statistics of the job, as the rest of its definition is not
+// written to Logscale.
+type BackfillProcessor struct {
+	jobIDs        JobIDs
+	logger        logrus.FieldLogger
+	outputPolicy  OutputPolicy
+	savedSearches searchc.SavedSearches
+	srchc         searchc.SearchC
+	strgc         storagec.StorageC
+	clock         pkg.Clock
+}
+
+// NewBackfillProcessor returns a new BackfillProcessor instance.
+func NewBackfillProcessor(srchc searchc.SearchC, strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *BackfillProcessor)) *BackfillProcessor {
+	p := &BackfillProcessor{
+		jobIDs:        NewHashJobIDs(strgc, false),
+		logger:        logger,
+		outputPolicy:  DefaultOutputPolicy(),
+		savedSearches: searchc.DefaultSavedSearches(),
+		srchc:         srchc,
+		strgc:         strgc,
+		clock:         pkg.SystemClock,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// WithBackfillSavedSearches sets the saved searches run for the logical queries of the BackfillProcessor.
+func WithBackfillSavedSearches(ss searchc.SavedSearches) func(p *BackfillProcessor) {
+	return func(p *BackfillProcessor) {
+		p.savedSearches = ss
+	}
+}
+
+// WithBackfillOutputPolicy sets the policy bounding the output of hosts stored on the execution records of the BackfillProcessor.  Policies
+// without a positive inline limit are ignored.
+func WithBackfillOutputPolicy(op OutputPolicy) func(p *BackfillProcessor) {
+	return func(p *BackfillProcessor) {
+		if op.InlineLimit > 0 {
+			p.outputPolicy = op
+		}
+	}
+}
+
+// WithBackfillJobIDs sets the strategy resolving the IDs of the jobs of restored executions.
+func WithBackfillJobIDs(ids JobIDs) func(p *BackfillProcessor) {
+	return func(p *BackfillProcessor) {
+		p.jobIDs = ids
+	}
+}
+
+// workflowExecution is a workflow execution found in Logscale.
+type workflowExecution struct {
+	definitionName string
+	end            time.Time
+	executionID    string
+	start          time.Time
+}
+
+// restoredJob accumulates the executions restored for a job whose record is missing.
+type restoredJob struct {
+	actionType string
+	last       pkg.JobExecution
+	name       string
+	runs       int64
+	first      time.Time
+}
+
+// Process scans Logscale for the workflow executions between the start and end times of the request, and restores
+// the records of those missing from storage, oldest first.  At most maxBackfillsPerRun executions are restored, in
+// which case the result is truncated and the request can be repeated to restore the rest.  Dry runs report what
+// would be restored without searching for host results or saving anything.
+func (p *BackfillProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	var br backfillRequest
+	if err := json.Unmarshal(req.Body, &br); err != nil {
+		return p.errResp(newError(ErrBadRequest, "failed to parse request body: %s", err))
+	}
+	start, end, err := validateBackfillRange(br)
+	if err != nil {
+		return p.errResp(err)
+	}
+	logger := p.logger.WithField("start", br.Start).WithField("end", br.End)
+
+	execs, err := p.workflowExecutions(ctx, start, end)
+	if err != nil {
+		err = fmt.Errorf("failed to search for workflow executions: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+
+	result := backfillResult{
+		DryRun:             br.DryRun,
+		RestoredExecutions: make([]string, 0),
+		RestoredJobs:       make([]string, 0),
+		Scanned:            len(execs),
+	}
+	errs := make([]fdk.APIError, 0)
+	jobs := make(map[string]*job)
+	missingJobs := make(map[string]*restoredJob)
+	for _, we := range execs {
+		if len(result.RestoredExecutions) >= maxBackfillsPerRun {
+			result.Truncated = true
+			break
+		}
+		elog := logger.WithField("execution_id", we.executionID)
+		jobName, err := workflowMeta{DefinitionName: we.definitionName}.jobName()
+		if err != nil {
+			elog.WithField("definition_name", we.definitionName).Warnf("skipping workflow execution: %s", err)
+			result.Skipped++
+			continue
+		}
+		jobID, err := p.jobIDs.JobID(ctx, jobName)
+		if err != nil {
+			elog.Errorf("job ID could not be determined: %s", err)
+			result.Skipped++
+			continue
+		}
+
+		key, err := locateJobExecution(ctx, p.strgc, we.executionID)
+		if err != nil {
+			err = fmt.Errorf("failed to locate job execution record %s: %w", we.executionID, err)
+			elog.Error(err)
+			errs = append(errs, apiError(err))
+			continue
+		}
+		if key != "" {
+			result.Existing++
+			continue
+		}
+
+		j, ok := jobs[jobID]
+		if !ok {
+			if j, err = p.fetchJob(ctx, jobID); err != nil {
+				err = fmt.Errorf("failed to fetch job record %s: %w", jobID, err)
+				elog.Error(err)
+				errs = append(errs, apiError(err))
+				continue
+			}
+			jobs[jobID] = j
+		}
+		if br.DryRun {
+			result.RestoredExecutions = append(result.RestoredExecutions, we.executionID)
+			if j == nil && missingJobs[jobID] == nil {
+				missingJobs[jobID] = &restoredJob{name: jobName}
+			}
+			continue
+		}
+
+		je, actionType, err := p.restoreExecution(ctx, we, jobID, jobName, j)
+		if err != nil {
+			err = fmt.Errorf("failed to restore job execution %s: %w", we.executionID, err)
+			elog.Error(err)
+			errs = append(errs, apiError(err))
+			continue
+		}
+		result.RestoredExecutions = append(result.RestoredExecutions, we.executionID)
+		if j == nil {
+			rj := missingJobs[jobID]
+			if rj == nil {
+				rj = &restoredJob{name: jobName, first: we.start}
+				missingJobs[jobID] = rj
+			}
+			if rj.actionType == "" {
+				rj.actionType = actionType
+			}
+			rj.last = je
+			rj.runs++
+		}
+	}
+
+	for jobID, rj := range missingJobs {
+		if !br.DryRun {
+			if err := p.restoreJob(ctx, jobID, rj); err != nil {
+				err = fmt.Errorf("failed to restore job %s: %w", jobID, err)
+				logger.WithField("job_id", jobID).Error(err)
+				errs = append(errs, apiError(err))
+				continue
+			}
+		}
+		result.RestoredJobs = append(result.RestoredJobs, jobID)
+	}
+	sort.Strings(result.RestoredJobs)
+
+	logger.WithField("scanned", result.Scanned).
+		WithField("existing", result.Existing).
+		WithField("restored_executions", len(result.RestoredExecutions)).
+		WithField("restored_jobs", len(result.RestoredJobs)).
+		WithField("dry_run", result.DryRun).
+		Info("backfilled job history")
+
+	code := http.StatusOK
+	if len(errs) > 0 {
+		code = http.StatusMultiStatus
+	}
+	return Response{
+		Body: p.backfillRespJSON([]backfillResult{result}, errs),
+		Code: code,
+	}
+}
+
+// validateBackfillRange returns the start and end times of a backfill request.
+func validateBackfillRange(br backfillRequest) (time.Time, time.Time, error) {
+	if err := validate.Fields(
+		validate.Field{Name: "start", Value: br.Start, Rules: []validate.Rule{validate.Required(), isoTimeRule}},
+		validate.Field{Name: "end", Value: br.End, Rules: []validate.Rule{validate.Required(), isoTimeRule}},
+	); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	start, _ := time.Parse(pkg.ISOTimeFormat, strings.TrimSpace(br.Start))
+	end, _ := time.Parse(pkg.ISOTimeFormat, strings.TrimSpace(br.End))
+	if !end.After(start) {
+		return time.Time{}, time.Time{}, validate.Errors{{Field: "end", Message: "must be after start"}}
+	}
+	if end.Sub(start) > maxBackfillRange {
+		return time.Time{}, time.Time{}, validate.Errors{{Field: "end", Message: fmt.Sprintf("must be within %d days of start", maxBackfillRange/(24*time.Hour))}}
+	}
+	return start, end, nil
+}
+
+// workflowExecutions returns the workflow executions which wrote to Logscale between start and end, oldest first.
+func (p *BackfillProcessor) workflowExecutions(ctx context.Context, start, end time.Time) ([]workflowExecution, error) {
+	pages := searchc.NewPages(ctx, p.srchc, p.savedSearches.Requests(searchc.QueryWorkflowExecutions, "", map[string]string{
+		"start": strconv.FormatInt(start.UnixMilli(), 10),
+		"end":   strconv.FormatInt(end.UnixMilli(), 10),
+	})...)
+	byID := make(map[string]*workflowExecution)
+	for pages.Next() {
+		for _, e := range pages.Page().Events {
+			we := parseWorkflowExecution(e)
+			if we.executionID == "" {
+				continue
+			}
+			prev, ok := byID[we.executionID]
+			if !ok {
+				byID[we.executionID] = &we
+				continue
+			}
+			// the same execution may be returned by several saved searches
+			if prev.definitionName == "" {
+				prev.definitionName = we.definitionName
+			}
+			if !we.start.IsZero() && (prev.start.IsZero() || we.start.Before(prev.start)) {
+				prev.start = we.start
+			}
+			if we.end.After(prev.end) {
+				prev.end = we.end
+			}
+		}
+	}
+	if err := pages.Err(); err != nil {
+		return nil, err
+	}
+
+	execs := make([]workflowExecution, 0, len(byID))
+	for _, we := range byID {
+		execs = append(execs, *we)
+	}
+	sort.Slice(execs, func(i, j int) bool {
+		if execs[i].start.Equal(execs[j].start) {
+			return execs[i].executionID < execs[j].executionID
+		}
+		return execs[i].start.Before(execs[j].start)
+	})
+	return execs, nil
+}
+
+// parseWorkflowExecution extracts a workflow execution from an event returned by the workflow executions query.
+func parseWorkflowExecution(e map[string]any) workflowExecution {
+	var we workflowExecution
+	for k, v := range e {
+		key := strings.ToLower(k)
+		switch {
+		case strings.HasSuffix(key, eventExecutionID):
+			we.executionID, _ = v.(string)
+		case strings.HasSuffix(key, eventDefinitionName):
+			we.definitionName, _ = v.(string)
+		case key == eventFirstSeen:
+			we.start = eventTime(e, k)
+		case key == eventLastSeen:
+			we.end = eventTime(e, k)
+		}
+	}
+	we.executionID = strings.TrimSpace(we.executionID)
+	if we.start.IsZero() {
+		we.start = eventTimestamp(e)
+	}
+	if we.end.IsZero() {
+		we.end = we.start
+	}
+	return we
+}
+
+// fetchJob returns the job record of the given ID, or nil if there is none.
+func (p *BackfillProcessor) fetchJob(ctx context.Context, jobID string) (*job, error) {
+	jobMap, _, err := fetchObject(ctx, p.strgc, jobCollection, jobID)
+	if errors.Is(err, storagec.NotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	j, err := distillJob(jobMap)
+	if err != nil {
+		return nil, fmt.Errorf("could not distill job record from dictionary: %s", err)
+	}
+	return &j, nil
+}
+
+// restoreExecution saves a new record of a workflow execution with its host results, returning it and the action
+// type of the job as told by its events.  j is nil if the job of the execution has no record.
+func (p *BackfillProcessor) restoreExecution(ctx context.Context, we workflowExecution, jobID, jobName string, j *job) (pkg.JobExecution, string, error) {
+	var jobInstance job
+	if j != nil {
+		jobInstance = *j
+	}
+	pages := searchc.NewPages(ctx, p.srchc, p.savedSearches.Requests(searchc.QueryExecutionResults, jobInstance.actionType(), map[string]string{
+		"execution_id": we.executionID,
+	})...)
+	x, err := extractHosts(pages, jobInstance.actionType(), p.logger)
+	if err != nil {
+		return pkg.JobExecution{}, "", fmt.Errorf("failed to execute logscale search: %w", err)
+	}
+	hosts := p.outputPolicy.apply(ctx, p.strgc, jobID, we.executionID, x.Hosts, p.logger)
+
+	je := pkg.JobExecution{
+		CountedRun:     true,
+		EndDate:        we.end.Format(pkg.ISOTimeFormat),
+		ExecutionID:    we.executionID,
+		HostsTruncated: x.Truncated,
+		ID:             jobID,
+		JobID:          jobID,
+		JobName:        jobName,
+		LogscaleOutput: pages.Response().JobURL,
+		NumHosts:       len(hosts),
+		RunDate:        we.start.Format(pkg.ISOTimeFormat),
+		RunStatus:      pkg.StatusCompleted,
+		TargetedHosts:  hosts,
+	}
+	je = flagPlatformMismatches(je, jobInstance.targetPlatforms())
+	hash, err := expectedFileHash(ctx, p.strgc, jobInstance)
+	if err != nil {
+		p.logger.WithField("job_id", jobID).Warnf("not verifying the integrity of the installed file: %s", err)
+	}
+	je = verifyFileIntegrity(je, hash)
+	je = applyHostResults(je)
+	d, secs, err := computeJobDuration(je.RunDate, je.EndDate, je.RunStatus, p.clock.Now())
+	if err != nil {
+		return pkg.JobExecution{}, "", fmt.Errorf("failed to compute job duration: %s", err)
+	}
+	je.Duration, je.DurationSeconds = d, secs
+
+	data, err := json.Marshal(je)
+	if err != nil {
+		return pkg.JobExecution{}, "", fmt.Errorf("failed to serialize job execution record: %s", err)
+	}
+	key := fmt.Sprintf("%d_%s", we.start.UnixNano(), we.executionID)
+	if err = putObject(ctx, p.strgc, jobExecutionCollection, key, data, ""); err != nil {
+		return pkg.JobExecution{}, "", err
+	}
+	return je, x.MatchedType, nil
+}
+
+// restoreJob saves a draft record of a job whose executions were restored.  The record is not overwritten if the
+// job was recreated meanwhile.
+func (p *BackfillProcessor) restoreJob(ctx context.Context, jobID string, rj *restoredJob) error {
+	if _, _, err := fetchObject(ctx, p.strgc, jobCollection, jobID); !errors.Is(err, storagec.NotFound) {
+		return err
+	}
+	actor := auditc.ActorFromContext(ctx)
+	now := p.now()
+	jobMap := map[string]any{
+		"action":            map[string]any{"type": rj.actionType},
+		"created_at":        rj.first.Format(pkg.ISOTimeFormat),
+		"description":       "Restored from the execution history in Logscale",
+		"draft":             true,
+		"host_count":        0,
+		"id":                jobID,
+		"last_execution_id": rj.last.ExecutionID,
+		"last_run":          rj.last.RunDate,
+		"last_run_status":   rj.last.RunStatus,
+		"name":              rj.name,
+		"notifications":     []string{},
+		"run_count":         rj.runs,
+		"target":            map[string]any{},
+		"updated_at":        now,
+		"user_id":           actor,
+		"user_name":         actor,
+		"version":           1,
+	}
+	data, err := json.Marshal(jobMap)
+	if err != nil {
+		return fmt.Errorf("failed to serialize job record: %s", err)
+	}
+	return putObject(ctx, p.strgc, jobCollection, jobID, data, "")
+}
+
+func (p *BackfillProcessor) now() string {
+	return p.clock.Now().Format(pkg.ISOTimeFormat)
+}
+
+func (p *BackfillProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return p.backfillRespJSON(nil, errs)
+	})
+}
+
+func (p *BackfillProcessor) backfillRespJSON(r []backfillResult, e []fdk.APIError) []byte {
+	if r == nil {
+		r = make([]backfillResult, 0)
+	}
+	resp := backfillResponse{Errs: e, Resources: r}
+	rJSON, err := json.Marshal(resp)
+	if err != nil {
+		p.logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
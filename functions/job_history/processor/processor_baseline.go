@@ -0,0 +1,250 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/validate"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultMaxDurationDrift is the percentage by which the duration of an execution may exceed the duration of the
+// baseline of its job before the execution fails the baseline check.
+const defaultMaxDurationDrift = 50
+
+// Verdicts of a baseline check.
+const (
+	verdictFail = "fail"
+	verdictPass = "pass"
+)
+
+// BaselineProcessor marks an execution as the baseline of its job, the "golden run" which later executions of
+// the job are checked against by the BaselineCheckProcessor.
+type BaselineProcessor struct {
+	logger logrus.FieldLogger
+	strgc  storagec.StorageC
+}
+
+// NewBaselineProcessor returns a new BaselineProcessor instance.
+func NewBaselineProcessor(strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *BaselineProcessor)) *BaselineProcessor {
+	p := &BaselineProcessor{
+		logger: logger,
+		strgc:  strgc,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// Process sets the baseline of the job of the requested execution, which must have finished.
+func (p *BaselineProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	var br baselineRequest
+	if err := json.Unmarshal(req.Body, &br); err != nil {
+		return p.errResp(newError(ErrBadRequest, "failed to parse request body: %s", err))
+	}
+	if err := validate.Fields(validate.Field{Name: "execution_id", Value: br.ExecutionID, Rules: []validate.Rule{validate.Required()}}); err != nil {
+		return p.errResp(err)
+	}
+	execID := strings.TrimSpace(br.ExecutionID)
+	logger := p.logger.WithField("execution_id", execID)
+
+	je, err := fetchJobExecution(ctx, p.strgc, execID)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch job execution: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	if !pkg.IsFinished(je.RunStatus) {
+		return p.errResp(newError(ErrBadRequest, "job execution %s has not finished", execID))
+	}
+	jobID := executionJobID(je)
+	logger = logger.WithField("job_id", jobID)
+
+	jobMap, version, err := fetchObject(ctx, p.strgc, jobCollection, jobID)
+	if errors.Is(err, storagec.NotFound) {
+		return p.errResp(newError(ErrNotFound, "job %s not found", jobID))
+	}
+	if err != nil {
+		err = fmt.Errorf("could not fetch job record: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	jobMap["baseline_execution_id"] = execID
+	b, err := json.Marshal(jobMap)
+	if err == nil {
+		err = putObject(ctx, p.strgc, jobCollection, jobID, b, version)
+	}
+	if errors.Is(err, storagec.VersionConflict) {
+		return p.errResp(newError(ErrConflict, "job was modified concurrently, please retry"))
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to save job record: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	logger.Info("updated job baseline")
+
+	return Response{
+		Body: p.baselineRespJSON([]jobBaseline{{BaselineExecutionID: execID, JobID: jobID}}, nil),
+		Code: http.StatusOK,
+	}
+}
+
+func (p *BaselineProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return p.baselineRespJSON(nil, errs)
+	})
+}
+
+func (p *BaselineProcessor) baselineRespJSON(r []jobBaseline, e []fdk.APIError) []byte {
+	if r == nil {
+		r = make([]jobBaseline, 0)
+	}
+	resp := jobBaselineResponse{Errs: e, Resources: r}
+	rJSON, err := json.Marshal(resp)
+	if err != nil {
+		p.logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
+
+// BaselineCheckProcessor evaluates an execution against the baseline of its job.
+type BaselineCheckProcessor struct {
+	logger logrus.FieldLogger
+	strgc  storagec.StorageC
+}
+
+// NewBaselineCheckProcessor returns a new BaselineCheckProcessor instance.
+func NewBaselineCheckProcessor(strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *BaselineCheckProcessor)) *BaselineCheckProcessor {
+	p := &BaselineCheckProcessor{
+		logger: logger,
+		strgc:  strgc,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// Process checks the execution identified by the execution_id query parameter against the baseline of its job.
+// The execution fails the check if any host which did not fail in the baseline failed in it, or if it ran longer
+// than the baseline by more than the max_duration_drift query parameter, a percentage defaulting to
+// defaultMaxDurationDrift.  The verdict is pass or fail, so that workflows can branch on it.
+func (p *BaselineCheckProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	q := req.Params.Query
+	execID := queryParam(q, "execution_id")
+	err := validate.Fields(
+		validate.Field{Name: "execution_id", Value: execID, Rules: []validate.Rule{validate.Required()}},
+		validate.Field{Name: "max_duration_drift", Value: queryParam(q, "max_duration_drift"), Rules: []validate.Rule{validate.Int(), validate.AtLeast(0)}},
+	)
+	if err != nil {
+		return p.errResp(err)
+	}
+	maxDrift := defaultMaxDurationDrift
+	if v := queryParam(q, "max_duration_drift"); v != "" {
+		maxDrift, _ = strconv.Atoi(v)
+	}
+	logger := p.logger.WithField("execution_id", execID)
+
+	je, err := fetchJobExecution(ctx, p.strgc, execID)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch job execution: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	if !pkg.IsFinished(je.RunStatus) {
+		return p.errResp(newError(ErrBadRequest, "job execution %s has not finished", execID))
+	}
+	jobID := executionJobID(je)
+	logger = logger.WithField("job_id", jobID)
+
+	jobMap, _, err := fetchObject(ctx, p.strgc, jobCollection, jobID)
+	if errors.Is(err, storagec.NotFound) {
+		return p.errResp(newError(ErrNotFound, "job %s not found", jobID))
+	}
+	if err != nil {
+		err = fmt.Errorf("could not fetch job record: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	j, err := distillJob(jobMap)
+	if err != nil {
+		err = fmt.Errorf("could not distill job record from dictionary: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	if j.BaselineExecutionID == "" {
+		return p.errResp(newError(ErrNotFound, "job %s has no baseline", jobID))
+	}
+
+	baseline, err := fetchJobExecution(ctx, p.strgc, j.BaselineExecutionID)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch baseline job execution: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+
+	resp := p.baselineCheckRespJSON([]baselineCheck{checkBaseline(baseline, je, maxDrift)}, nil)
+	if resp == nil {
+		err = errors.New("failed to serialize baseline check response")
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	return Response{
+		Body: resp,
+		Code: http.StatusOK,
+	}
+}
+
+// checkBaseline evaluates an execution against the baseline execution of its job.  The duration drift is not
+// known if the baseline has no duration, in which case it does not fail the check.
+func checkBaseline(baseline, je pkg.JobExecution, maxDrift int) baselineCheck {
+	c := baselineCheck{
+		BaselineExecutionID: baseline.ExecutionID,
+		ExecutionID:         je.ExecutionID,
+		JobID:               executionJobID(je),
+		MaxDurationDrift:    maxDrift,
+		RegressedHosts:      diffExecutions(baseline, je).NewlyFailed,
+		Verdict:             verdictPass,
+	}
+	if baseline.DurationSeconds > 0 {
+		drift := 100 * float64(je.DurationSeconds-baseline.DurationSeconds) / float64(baseline.DurationSeconds)
+		drift = math.Round(drift*100) / 100
+		c.DurationDrift = &drift
+		c.DurationExceeded = drift > float64(maxDrift)
+	}
+	if len(c.RegressedHosts) > 0 || c.DurationExceeded {
+		c.Verdict = verdictFail
+	}
+	return c
+}
+
+func (p *BaselineCheckProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return p.baselineCheckRespJSON(nil, errs)
+	})
+}
+
+func (p *BaselineCheckProcessor) baselineCheckRespJSON(r []baselineCheck, e []fdk.APIError) []byte {
+	if r == nil {
+		r = make([]baselineCheck, 0)
+	}
+	resp := baselineCheckResponse{Errs: e, Resources: r}
+	rJSON, err := json.Marshal(resp)
+	if err != nil {
+		p.logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
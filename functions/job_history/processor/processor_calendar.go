@@ -0,0 +1,201 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/validate"
+	"github.com/sirupsen/logrus"
+)
+
+// CalendarProcessor projects the upcoming runs of every job over a window of time, e.g. a week or a month, so
+// that they can be shown on a calendar.
+type CalendarProcessor struct {
+	logger logrus.FieldLogger
+	strgc  storagec.StorageC
+	clock  pkg.Clock
+}
+
+// NewCalendarProcessor returns a new CalendarProcessor instance.
+func NewCalendarProcessor(strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *CalendarProcessor)) *CalendarProcessor {
+	p := &CalendarProcessor{
+		logger: logger,
+		strgc:  strgc,
+		clock:  pkg.SystemClock,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// Process returns the runs of every job between the start and end query parameters, earliest first.  Recurring
+// jobs are projected from their schedule the same way as by a schedule preview, and jobs scheduled once from
+// their next run.  Runs before the current time, and those of paused, draft, expired or finished jobs, are not
+// returned.  Runs falling in a blackout are returned with the name of the blackout, as they will be skipped.
+// Jobs with more than maxCalendarRunsPerJob runs in the window are listed in meta.truncated_jobs.
+func (p *CalendarProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	q := req.Params.Query
+	if len(q) == 0 {
+		q = make(url.Values)
+	}
+	start, end, err := calendarWindow(q)
+	if err != nil {
+		return p.errResp(err)
+	}
+
+	meta := calendarMeta{End: end, Start: start}
+	if now := p.clock.Now().UTC(); now.After(start) {
+		start = now
+	}
+
+	runs, truncated, err := projectRuns(ctx, p.strgc, start, end, p.logger)
+	if err != nil {
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+	meta.TruncatedJobs = truncated
+	return Response{
+		Body: p.calendarRespJSON(meta, runs, nil),
+		Code: http.StatusOK,
+	}
+}
+
+// calendarWindow returns the start and end times of a calendar query.
+func calendarWindow(q url.Values) (time.Time, time.Time, error) {
+	if err := validate.Fields(
+		validate.Field{Name: "start", Value: queryParam(q, "start"), Rules: []validate.Rule{validate.Required(), isoTimeRule}},
+		validate.Field{Name: "end", Value: queryParam(q, "end"), Rules: []validate.Rule{validate.Required(), isoTimeRule}},
+	); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	start, _ := time.Parse(pkg.ISOTimeFormat, queryParam(q, "start"))
+	end, _ := time.Parse(pkg.ISOTimeFormat, queryParam(q, "end"))
+	if !end.After(start) {
+		return time.Time{}, time.Time{}, validate.Errors{{Field: "end", Message: "must be after start"}}
+	}
+	if end.Sub(start) > maxCalendarRange {
+		return time.Time{}, time.Time{}, validate.Errors{{Field: "end", Message: fmt.Sprintf("must be within %d days of start", maxCalendarRange/(24*time.Hour))}}
+	}
+	return start, end, nil
+}
+
+// projectRuns returns the runs of every job between start and end, earliest first, see CalendarProcessor.Process,
+// and the IDs of the jobs whose runs were truncated.
+func projectRuns(ctx context.Context, strgc storagec.StorageC, start, end time.Time, logger logrus.FieldLogger) ([]calendarRun, []string, error) {
+	filter, err := pkg.NewFQLQuery([]pkg.Filter{{Field: "created_at", Op: pkg.GTE, Value: "0"}})
+	if err != nil {
+		return nil, nil, fmt.Errorf("error constructing FQL query: %s", err)
+	}
+	blackouts := loadBlackouts(ctx, strgc, logger)
+	runs := make([]calendarRun, 0)
+	var truncatedJobs []string
+	for offset := 0; ; {
+		sr, err := strgc.SearchAndFetch(ctx, storagec.SearchObjectsRequest{
+			Collection: jobCollection,
+			Filter:     filter,
+			Limit:      maxQueryLimit,
+			Offset:     offset,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to search jobs: %w", err)
+		}
+		for _, o := range sr.Objects {
+			jobRuns, truncated, err := projectJobRuns(o, start, end, blackouts)
+			if err != nil {
+				// a single job with an invalid schedule does not hide the runs of the others
+				logger.WithField("job_id", o.Key).Warnf("skipping job: %s", err)
+				addWarning(ctx, "skipped job %s: %s", o.Key, err)
+				continue
+			}
+			if truncated {
+				truncatedJobs = append(truncatedJobs, o.Key)
+			}
+			runs = append(runs, jobRuns...)
+		}
+		offset += len(sr.Objects)
+		if len(sr.Objects) == 0 || offset >= sr.Total {
+			break
+		}
+	}
+
+	sort.SliceStable(runs, func(i, j int) bool {
+		if runs[i].RunAt.Equal(runs[j].RunAt) {
+			return runs[i].Name < runs[j].Name
+		}
+		return runs[i].RunAt.Before(runs[j].RunAt)
+	})
+	return runs, truncatedJobs, nil
+}
+
+// projectJobRuns returns the runs of a job between start and end, and true if there were more than
+// maxCalendarRunsPerJob.
+func projectJobRuns(o storagec.SearchAndFetchRecord, start, end time.Time, blackouts blackoutCalendar) ([]calendarRun, bool, error) {
+	var jobMap map[string]any
+	if err := json.Unmarshal(o.Data, &jobMap); err != nil {
+		return nil, false, fmt.Errorf("failed to decode job: %s", err)
+	}
+	j, err := distillJob(jobMap)
+	if err != nil {
+		return nil, false, err
+	}
+	draft, _ := jobMap["draft"].(bool)
+	finished := j.TotalRecurrences > 0 && j.RunCount >= j.TotalRecurrences
+	if j.Paused || j.Expired || draft || finished {
+		return nil, false, nil
+	}
+	name, _ := jobMap["name"].(string)
+	scheduleType, _ := jobMap["schedule_type"].(string)
+	run := func(t time.Time) calendarRun {
+		r := calendarRun{JobID: o.Key, Name: name, RunAt: t, ScheduleType: scheduleType}
+		if b, ok := blackouts.covering(t); ok {
+			r.Blackout = b.name
+		}
+		return r
+	}
+
+	if j.Schedule == nil || j.Schedule.TimeCycle == "" {
+		if j.NextRun.IsZero() || j.NextRun.Before(start) || j.NextRun.After(end) {
+			return nil, false, nil
+		}
+		return []calendarRun{run(j.NextRun.UTC())}, false, nil
+	}
+
+	// a run at the very start of the window is included, as schedules have minute resolution
+	times, truncated, err := scheduledRuns(j, start.Add(-time.Second), end, maxCalendarRunsPerJob)
+	if err != nil {
+		return nil, false, err
+	}
+	runs := make([]calendarRun, len(times))
+	for i, t := range times {
+		runs[i] = run(t)
+	}
+	return runs, truncated, nil
+}
+
+func (p *CalendarProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return p.calendarRespJSON(calendarMeta{}, nil, errs)
+	})
+}
+
+func (p *CalendarProcessor) calendarRespJSON(m calendarMeta, r []calendarRun, e []fdk.APIError) []byte {
+	if r == nil {
+		r = make([]calendarRun, 0)
+	}
+	resp := calendarResponse{Errs: e, Meta: m, Resources: r}
+	rJSON, err := json.Marshal(resp)
+	if err != nil {
+		p.logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
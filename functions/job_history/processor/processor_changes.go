@@ -0,0 +1,125 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/validate"
+	"github.com/sirupsen/logrus"
+)
+
+// ChangesProcessor lists the job executions changed since a cursor, so that the UI can poll for the changes of
+// the job history rather than listing it again.  The cursor is the change sequence number of the last change the
+// caller saw, see storagec.SequencedClient.
+type ChangesProcessor struct {
+	clock  pkg.Clock
+	logger logrus.FieldLogger
+	strgc  storagec.StorageC
+}
+
+// NewChangesProcessor returns a new ChangesProcessor instance.
+func NewChangesProcessor(strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *ChangesProcessor)) *ChangesProcessor {
+	p := &ChangesProcessor{
+		clock:  pkg.SystemClock,
+		logger: logger,
+		strgc:  strgc,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// Process returns up to limit job executions changed after the change sequence number of the cursor query
+// parameter, oldest change first, and the cursor to poll with next in meta.next.  Executions changed several
+// times since the cursor are returned once, in their latest state.  A missing cursor lists every execution
+// recorded with a change sequence number.  The cursor is returned unchanged when nothing changed.
+func (p *ChangesProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	q := req.Params.Query
+	err := validate.Fields(
+		validate.Field{Name: "cursor", Value: queryParam(q, "cursor"), Rules: []validate.Rule{validate.Int(), validate.AtLeast(0)}},
+		validate.Field{Name: "limit", Value: queryParam(q, "limit"), Rules: []validate.Rule{validate.Int(), validate.AtLeast(1)}},
+	)
+	if err != nil {
+		return errorResponse(newError(ErrBadRequest, "bad arguments in param.query: %w", err), p.logger)
+	}
+	cursor, _ := strconv.ParseInt(queryParam(q, "cursor"), 10, 64)
+	limit := defaultQueryLimit
+	if l, err := strconv.Atoi(queryParam(q, "limit")); err == nil {
+		limit = min(l, maxQueryLimit)
+	}
+
+	execs, next, err := p.changes(ctx, cursor, limit)
+	if err != nil {
+		err = fmt.Errorf("failed to list changed job executions: %w", err)
+		p.logger.Error(err)
+		return errorResponse(err, p.logger)
+	}
+	execs, err = computeDurations(execs, p.clock.Now())
+	if err != nil {
+		p.logger.Errorf("failed to compute duration for job executions: %s", err)
+	}
+
+	resp := jobExecRespJSON(
+		&paging{
+			Count: len(execs),
+			Limit: limit,
+			Next:  strconv.FormatInt(next, 10),
+		},
+		execs,
+		nil,
+		p.logger,
+	)
+	if resp == nil {
+		err = errors.New("failed to serialize job execution response")
+		p.logger.Errorln(err)
+		return errorResponse(err, p.logger)
+	}
+	return Response{
+		Body: resp,
+		Code: http.StatusOK,
+	}
+}
+
+// changes returns the job executions changed after the cursor, and the change sequence number of the latest of
+// them, or the cursor if none changed.
+func (p *ChangesProcessor) changes(ctx context.Context, cursor int64, limit int) ([]pkg.JobExecution, int64, error) {
+	filter, err := pkg.NewFQLQuery([]pkg.Filter{{Field: storagec.SequenceField, Op: pkg.GT, Value: strconv.FormatInt(cursor, 10)}})
+	if err != nil {
+		return nil, 0, fmt.Errorf("error constructing FQL query: %s", err)
+	}
+	sort, err := pkg.NewFQLSort(storagec.SequenceField, pkg.Asc)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error constructing FQL sort: %s", err)
+	}
+	sr, err := p.strgc.SearchAndFetch(ctx, storagec.SearchObjectsRequest{
+		Collection: jobExecutionCollection,
+		Filter:     filter,
+		Limit:      limit,
+		Sort:       sort,
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search job executions: %w", err)
+	}
+
+	execs := make([]pkg.JobExecution, 0, len(sr.Objects))
+	next := cursor
+	for _, o := range sr.Objects {
+		je, err := decodeStoredJobExecution(o.Data)
+		if err != nil {
+			// the record is skipped rather than failing the poll, which would never get past it
+			p.logger.WithField("object_key", o.Key).Warnf("skipping job execution: %s", err)
+			addWarning(ctx, "skipped job execution %s: %s", o.Key, err)
+			continue
+		}
+		next = max(next, je.ChangeSeq)
+		execs = append(execs, je)
+	}
+	return execs, next, nil
+}
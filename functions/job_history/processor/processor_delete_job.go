@@ -0,0 +1,248 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/validate"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/workflowc"
+	"github.com/sirupsen/logrus"
+)
+
+// DeleteJobProcessor deletes a job along with all of its job execution records.
+type DeleteJobProcessor struct {
+	foldCase  bool
+	chunkSize int
+	logger    logrus.FieldLogger
+	strgc     storagec.StorageC
+	wfc       workflowc.WorkflowC
+}
+
+// NewDeleteJobProcessor returns a new DeleteJobProcessor instance.
+func NewDeleteJobProcessor(strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *DeleteJobProcessor)) *DeleteJobProcessor {
+	p := &DeleteJobProcessor{
+		chunkSize: deleteChunkSize,
+		logger:    logger,
+		strgc:     strgc,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// WithDeleteJobNameCaseFolding makes job names which only differ by case the same name, see pkg.JobNameKey.
+func WithDeleteJobNameCaseFolding() func(p *DeleteJobProcessor) {
+	return func(p *DeleteJobProcessor) {
+		p.foldCase = true
+	}
+}
+
+// WithDeleteJobWorkflowClient deprovisions the workflows of deleted jobs.
+func WithDeleteJobWorkflowClient(wfc workflowc.WorkflowC) func(p *DeleteJobProcessor) {
+	return func(p *DeleteJobProcessor) {
+		p.wfc = wfc
+	}
+}
+
+// Process deletes the job identified by the id query parameter and its job execution records.  The execution
+// records are deleted in chunks of concurrent deletes, and the job record is only deleted once all of them
+// are, so that a partially failed deletion can be retried.  The name and aliases of the job are removed from the
+// name index.  The workflows of the job are only deprovisioned if the processor was configured
+// WithDeleteJobWorkflowClient.
+func (p *DeleteJobProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	jobID := queryParam(req.Params.Query, "id")
+	if err := validate.Fields(validate.Field{Name: "id", Value: jobID, Rules: []validate.Rule{validate.Required()}}); err != nil {
+		return p.errResp(err)
+	}
+	logger := p.logger.WithField("job_id", jobID)
+
+	filter, err := pkg.NewFQLQuery([]pkg.Filter{{Field: "id", Op: pkg.EQ, Value: jobID}})
+	if err != nil {
+		err = fmt.Errorf("error constructing FQL query: %s", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	sr, err := p.strgc.SearchAll(ctx, storagec.SearchObjectsRequest{
+		Collection: jobExecutionCollection,
+		Filter:     filter,
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to search for job executions: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+
+	result := deleteJobResult{ID: jobID}
+	errs := p.deleteExecutions(ctx, sr.ObjectKeys, &result)
+	var jobNames []string
+	var workflows *jobWorkflows
+	if len(errs) == 0 {
+		if jobMap, _, err := fetchObject(ctx, p.strgc, jobCollection, jobID); err == nil {
+			if j, err := distillJob(jobMap); err == nil {
+				jobNames = append(j.Aliases, j.Name)
+				workflows = j.Workflows
+			}
+		}
+		err = p.strgc.DeleteObject(ctx, storagec.DeleteObjectRequest{
+			Collection: jobCollection,
+			ObjectKey:  jobID,
+		})
+		switch {
+		case errors.Is(err, storagec.NotFound) && len(sr.ObjectKeys) == 0:
+			return p.errResp(newError(ErrNotFound, "not found"))
+		case err != nil && !errors.Is(err, storagec.NotFound):
+			err = fmt.Errorf("failed to delete job record: %w", err)
+			logger.Error(err)
+			errs = append(errs, apiError(err))
+		default:
+			result.JobDeleted = true
+		}
+	}
+	if result.JobDeleted {
+		err = p.strgc.DeleteObject(ctx, storagec.DeleteObjectRequest{
+			Collection: jobStatsCollection,
+			ObjectKey:  jobID,
+		})
+		if err != nil && !errors.Is(err, storagec.NotFound) {
+			// the statistics of a deleted job are never read again
+			logger.Warnf("failed to delete job statistics: %s", err)
+			addWarning(ctx, "statistics of the job not deleted: %s", err)
+		}
+		for _, c := range []string{executionNoteCollection, evidenceCollection, hostOutputCollection} {
+			if err = deleteJobObjects(ctx, p.strgc, c, jobID); err != nil {
+				// the notes, evidence and output of a deleted job are never read again
+				logger.Warnf("failed to delete the %s of the job: %s", c, err)
+				addWarning(ctx, "%s of the job not deleted: %s", c, err)
+			}
+		}
+		for _, n := range jobNames {
+			if n == "" {
+				continue
+			}
+			if err = deleteJobName(ctx, p.strgc, n, jobID, p.foldCase); err != nil {
+				// the name is freed again when another job is created with it
+				logger.Warnf("failed to delete job name index entry: %s", err)
+				addWarning(ctx, "name %q of the job not freed: %s", n, err)
+			}
+		}
+		p.deprovisionWorkflows(ctx, workflows, logger)
+	}
+	logger.WithField("deleted_executions", result.DeletedExecutions).
+		WithField("failed_executions", result.FailedExecutions).
+		WithField("job_deleted", result.JobDeleted).
+		Info("deleted job")
+
+	code := http.StatusOK
+	if len(errs) > 0 {
+		code = http.StatusMultiStatus
+	}
+	return Response{
+		Body: p.deleteJobRespJSON([]deleteJobResult{result}, errs),
+		Code: code,
+	}
+}
+
+// deprovisionWorkflows deprovisions the workflows of a deleted job.  Failures are logged rather than failing the
+// request, as the job is deleted and its workflows can still be deleted in Falcon Fusion.
+func (p *DeleteJobProcessor) deprovisionWorkflows(ctx context.Context, workflows *jobWorkflows, logger logrus.FieldLogger) {
+	if p.wfc == nil || workflows == nil {
+		return
+	}
+	for _, id := range []string{workflows.ScheduleWorkflow, workflows.NotifierWorkflow} {
+		if id == "" {
+			continue
+		}
+		if err := p.wfc.Deprovision(ctx, id); err != nil && !errors.Is(err, workflowc.NotFound) {
+			logger.WithField("definition_id", id).Warnf("failed to deprovision the workflow of the job: %s", err)
+		}
+	}
+}
+
+// deleteExecutions deletes the job execution records with the given keys, p.chunkSize at a time, counting the
+// deleted and failed records in the result.  Records which no longer exist count as deleted.
+func (p *DeleteJobProcessor) deleteExecutions(ctx context.Context, keys []string, result *deleteJobResult) []fdk.APIError {
+	errs := make([]fdk.APIError, 0)
+	var mu sync.Mutex
+	for start := 0; start < len(keys); start += p.chunkSize {
+		end := min(start+p.chunkSize, len(keys))
+
+		var wg sync.WaitGroup
+		for _, k := range keys[start:end] {
+			wg.Add(1)
+			go func(k string) {
+				defer wg.Done()
+				err := p.strgc.DeleteObject(ctx, storagec.DeleteObjectRequest{
+					Collection: jobExecutionCollection,
+					ObjectKey:  k,
+				})
+				if errors.Is(err, storagec.NotFound) {
+					err = nil
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					err = fmt.Errorf("failed to delete job execution %s: %w", k, err)
+					p.logger.Error(err)
+					errs = append(errs, apiError(err))
+					result.FailedExecutions++
+					return
+				}
+				result.DeletedExecutions++
+			}(k)
+		}
+		wg.Wait()
+	}
+	return errs
+}
+
+// deleteJobObjects deletes the objects of a collection whose job_id is jobID, e.g. the notes of the executions of
+// a job.
+func deleteJobObjects(ctx context.Context, strgc storagec.StorageC, collection, jobID string) error {
+	filter, err := pkg.NewFQLQuery([]pkg.Filter{{Field: "job_id", Op: pkg.EQ, Value: jobID}})
+	if err != nil {
+		return fmt.Errorf("error constructing FQL query: %s", err)
+	}
+	sr, err := strgc.SearchAll(ctx, storagec.SearchObjectsRequest{
+		Collection: collection,
+		Filter:     filter,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to search for objects: %w", err)
+	}
+	errs := make([]error, 0)
+	for _, k := range sr.ObjectKeys {
+		err = strgc.DeleteObject(ctx, storagec.DeleteObjectRequest{Collection: collection, ObjectKey: k})
+		if err != nil && !errors.Is(err, storagec.NotFound) {
+			errs = append(errs, fmt.Errorf("failed to delete object %s: %w", k, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (p *DeleteJobProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return p.deleteJobRespJSON(nil, errs)
+	})
+}
+
+func (p *DeleteJobProcessor) deleteJobRespJSON(r []deleteJobResult, e []fdk.APIError) []byte {
+	if r == nil {
+		r = make([]deleteJobResult, 0)
+	}
+	resp := deleteJobResponse{Errs: e, Resources: r}
+	rJSON, err := json.Marshal(resp)
+	if err != nil {
+		p.logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
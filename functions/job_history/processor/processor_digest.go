@@ -0,0 +1,251 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/notifier"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/validate"
+	"github.com/sirupsen/logrus"
+)
+
+// Periods covered by a digest report.
+const (
+	digestPeriodDaily  = "daily"
+	digestPeriodWeekly = "weekly"
+)
+
+const (
+	// maxDigestExecutions bounds the number of job executions compiled into a single digest report.
+	maxDigestExecutions = 20000
+	// digestTopFailingHosts is the number of most frequently failing hosts listed in a digest report.
+	digestTopFailingHosts = 10
+)
+
+// DigestProcessor compiles a digest report of the runs of every job over the last day or week, which is stored
+// and optionally posted to a webhook and logged to Logscale.  It is meant to be invoked on a schedule by a
+// workflow.
+type DigestProcessor struct {
+	logger   logrus.FieldLogger
+	notifier notifier.Notifier
+	strgc    storagec.StorageC
+	clock    pkg.Clock
+}
+
+// NewDigestProcessor returns a new DigestProcessor instance.
+func NewDigestProcessor(strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *DigestProcessor)) *DigestProcessor {
+	p := &DigestProcessor{
+		logger: logger,
+		strgc:  strgc,
+		clock:  pkg.SystemClock,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// WithDigestNotifier posts digest reports to the webhook URL of the request, if it has one.
+func WithDigestNotifier(n notifier.Notifier) func(p *DigestProcessor) {
+	return func(p *DigestProcessor) {
+		p.notifier = n
+	}
+}
+
+// Process compiles the report of the period of the request, daily by default, ending at the current time.  The
+// report is saved under its period and end date, so that compiling it again on the same day replaces it.  With
+// logscale set, the report is also written to the logs of the function, which are ingested into Logscale.  A
+// failure to post the report is returned as an error alongside the saved report.
+func (p *DigestProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	dr := digestRequest{Period: digestPeriodDaily}
+	if len(req.Body) > 0 {
+		if err := json.Unmarshal(req.Body, &dr); err != nil {
+			return p.errResp(newError(ErrBadRequest, "failed to parse request body: %s", err))
+		}
+	}
+	err := validate.Fields(validate.Field{Name: "period", Value: dr.Period, Rules: []validate.Rule{validate.Enum(digestPeriodDaily, digestPeriodWeekly)}})
+	if err != nil {
+		return p.errResp(err)
+	}
+	if dr.Period == "" {
+		dr.Period = digestPeriodDaily
+	}
+
+	to := p.clock.Now().UTC()
+	from := to.Add(-24 * time.Hour)
+	if dr.Period == digestPeriodWeekly {
+		from = to.Add(-7 * 24 * time.Hour)
+	}
+	report, err := p.compile(ctx, dr.Period, from, to)
+	if err != nil {
+		err = fmt.Errorf("failed to compile digest report: %w", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+	logger := p.logger.WithField("report_id", report.ID)
+
+	data, err := json.Marshal(report)
+	if err == nil {
+		err = putObject(ctx, p.strgc, digestReportCollection, report.ID, data, "")
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to save digest report: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	logger.WithField("runs", report.Runs).Info("saved digest report")
+
+	if dr.Logscale {
+		logger.WithField("digest_report", report).Info("digest report")
+	}
+	errs := make([]fdk.APIError, 0)
+	if dr.WebhookURL != "" {
+		if p.notifier == nil {
+			err = newError(ErrBadRequest, "digest reports cannot be posted to webhooks")
+		} else {
+			err = p.notifier.Post(ctx, dr.WebhookURL, report)
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to post digest report: %w", err)
+			logger.Error(err)
+			errs = append(errs, apiError(err))
+		}
+	}
+
+	code := http.StatusOK
+	if len(errs) > 0 {
+		code = http.StatusMultiStatus
+	}
+	return Response{
+		Body: p.digestRespJSON([]digestReport{report}, errs),
+		Code: code,
+	}
+}
+
+// compile aggregates the finished executions run between from and to per job, most failed runs first.  Only the
+// first maxDigestExecutions executions are compiled, in which case the report is marked truncated.
+func (p *DigestProcessor) compile(ctx context.Context, period string, from, to time.Time) (digestReport, error) {
+	report := digestReport{
+		From:            from.Format(pkg.ISOTimeFormat),
+		GeneratedAt:     to.Format(pkg.ISOTimeFormat),
+		ID:              fmt.Sprintf("%s-%s", period, to.Format(time.DateOnly)),
+		Jobs:            make([]digestJob, 0),
+		Period:          period,
+		To:              to.Format(pkg.ISOTimeFormat),
+		TopFailingHosts: make([]hostFailures, 0),
+	}
+	b := &pkg.QueryBuilder{}
+	filter, err := b.Between("run_date", report.From, report.To).Build()
+	if err != nil {
+		return report, fmt.Errorf("error constructing FQL query: %s", err)
+	}
+
+	jobs := make(map[string]*digestJob)
+	failures := make(map[string]int)
+	scanned := 0
+	for offset := 0; ; {
+		sr, err := p.strgc.SearchAndFetch(ctx, storagec.SearchObjectsRequest{
+			Collection: jobExecutionCollection,
+			Filter:     filter,
+			Limit:      maxQueryLimit,
+			Offset:     offset,
+		})
+		if err != nil {
+			return report, fmt.Errorf("failed to search job executions: %w", err)
+		}
+		for _, o := range sr.Objects {
+			je, err := decodeStoredJobExecution(o.Data)
+			if err != nil {
+				p.logger.WithField("object_key", o.Key).Warnf("skipping job execution: %s", err)
+				addWarning(ctx, "skipped job execution %s: %s", o.Key, err)
+				continue
+			}
+			scanned++
+			if !pkg.IsFinished(je.RunStatus) {
+				continue
+			}
+			jobID := executionJobID(je)
+			j, ok := jobs[jobID]
+			if !ok {
+				j = &digestJob{JobID: jobID, JobName: je.JobName}
+				jobs[jobID] = j
+			}
+			j.Runs++
+			switch je.RunStatus {
+			case pkg.StatusFailed, pkg.StatusTimedOut:
+				j.Failed++
+			case pkg.StatusCompletedWithErrors:
+				j.CompletedWithErrors++
+			default:
+				j.Succeeded++
+			}
+			for _, h := range failedHosts(je.TargetedHosts) {
+				failures[h.HostName]++
+			}
+		}
+		offset += len(sr.Objects)
+		if len(sr.Objects) == 0 || offset >= sr.Total {
+			break
+		}
+		if scanned >= maxDigestExecutions {
+			report.Truncated = true
+			break
+		}
+	}
+
+	for _, j := range jobs {
+		report.Runs += j.Runs
+		report.Failed += j.Failed
+		report.CompletedWithErrors += j.CompletedWithErrors
+		report.Succeeded += j.Succeeded
+		report.Jobs = append(report.Jobs, *j)
+	}
+	sort.Slice(report.Jobs, func(i, j int) bool {
+		a, b := report.Jobs[i], report.Jobs[j]
+		if a.Failed != b.Failed {
+			return a.Failed > b.Failed
+		}
+		return a.JobName < b.JobName
+	})
+
+	for h, n := range failures {
+		report.TopFailingHosts = append(report.TopFailingHosts, hostFailures{Failures: n, HostName: h})
+	}
+	sort.Slice(report.TopFailingHosts, func(i, j int) bool {
+		a, b := report.TopFailingHosts[i], report.TopFailingHosts[j]
+		if a.Failures != b.Failures {
+			return a.Failures > b.Failures
+		}
+		return a.HostName < b.HostName
+	})
+	if len(report.TopFailingHosts) > digestTopFailingHosts {
+		report.TopFailingHosts = report.TopFailingHosts[:digestTopFailingHosts]
+	}
+	return report, nil
+}
+
+func (p *DigestProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return p.digestRespJSON(nil, errs)
+	})
+}
+
+func (p *DigestProcessor) digestRespJSON(r []digestReport, e []fdk.APIError) []byte {
+	if r == nil {
+		r = make([]digestReport, 0)
+	}
+	resp := digestResponse{Errs: e, Resources: r}
+	rJSON, err := json.Marshal(resp)
+	if err != nil {
+		p.logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
@@ -0,0 +1,188 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/searchc"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/sirupsen/logrus"
+)
+
+// EnrichmentProcessor backfills the targeted hosts of job executions for which Logscale returned no results
+// when they were upserted.  It is meant to be invoked on a schedule by a workflow.
+type EnrichmentProcessor struct {
+	logger        logrus.FieldLogger
+	outputPolicy  OutputPolicy
+	savedSearches searchc.SavedSearches
+	srchc         searchc.SearchC
+	strgc         storagec.StorageC
+	clock         pkg.Clock
+}
+
+// NewEnrichmentProcessor returns a new EnrichmentProcessor instance.
+func NewEnrichmentProcessor(srchc searchc.SearchC, strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *EnrichmentProcessor)) *EnrichmentProcessor {
+	p := &EnrichmentProcessor{
+		logger:        logger,
+		outputPolicy:  DefaultOutputPolicy(),
+		savedSearches: searchc.DefaultSavedSearches(),
+		srchc:         srchc,
+		strgc:         strgc,
+		clock:         pkg.SystemClock,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// WithEnrichmentSavedSearches sets the saved searches run for the logical queries of the EnrichmentProcessor.
+func WithEnrichmentSavedSearches(ss searchc.SavedSearches) func(p *EnrichmentProcessor) {
+	return func(p *EnrichmentProcessor) {
+		p.savedSearches = ss
+	}
+}
+
+// WithEnrichmentOutputPolicy sets the policy bounding the output of hosts stored on the execution records of the EnrichmentProcessor.  Policies
+// without a positive inline limit are ignored.
+func WithEnrichmentOutputPolicy(op OutputPolicy) func(p *EnrichmentProcessor) {
+	return func(p *EnrichmentProcessor) {
+		if op.InlineLimit > 0 {
+			p.outputPolicy = op
+		}
+	}
+}
+
+// Process searches Logscale again for the host results of the job executions pending enrichment.  Executions
+// which are still missing results after maxEnrichmentAttempts runs are no longer considered pending.
+func (p *EnrichmentProcessor) Process(ctx context.Context, _ fdk.Request) Response {
+	filter, err := pkg.NewFQLQuery([]pkg.Filter{{Field: "pending_enrichment", Op: pkg.EQ, Value: "true"}})
+	if err != nil {
+		err = fmt.Errorf("error constructing FQL query: %s", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+	sr, err := p.strgc.Search(ctx, storagec.SearchObjectsRequest{
+		Collection: jobExecutionCollection,
+		Filter:     filter,
+		Limit:      maxEnrichmentsPerRun,
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to search for job executions pending enrichment: %w", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+
+	result := enrichmentResult{}
+	errs := make([]fdk.APIError, 0)
+	for _, k := range sr.ObjectKeys {
+		result.Attempted++
+		je, err := p.enrich(ctx, k)
+		if errors.Is(err, storagec.VersionConflict) {
+			// the execution was upserted concurrently; the next run picks it up again if necessary
+			continue
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to enrich job execution %s: %w", k, err)
+			p.logger.Error(err)
+			errs = append(errs, apiError(err))
+			continue
+		}
+		switch {
+		case len(je.TargetedHosts) > 0:
+			result.Enriched++
+		case !je.PendingEnrichment:
+			p.logger.WithField("execution_id", je.ExecutionID).
+				Warnf("no host results found in logscale after %d attempts - giving up", je.EnrichmentAttempts)
+			addWarning(ctx, "logscale returned no host results for execution %s after %d attempts - enrichment abandoned", je.ExecutionID, je.EnrichmentAttempts)
+			result.Abandoned++
+		}
+	}
+	p.logger.WithField("attempted", result.Attempted).
+		WithField("enriched", result.Enriched).
+		WithField("abandoned", result.Abandoned).
+		Info("enriched job executions")
+
+	code := http.StatusOK
+	if len(errs) > 0 {
+		code = http.StatusMultiStatus
+	}
+	return Response{
+		Body: p.enrichmentRespJSON([]enrichmentResult{result}, errs),
+		Code: code,
+	}
+}
+
+// enrich searches Logscale for the host results of a single job execution and saves them if any are found.
+// Otherwise, the number of enrichment attempts is incremented.  The updated record is returned.
+func (p *EnrichmentProcessor) enrich(ctx context.Context, key string) (pkg.JobExecution, error) {
+	execMap, version, err := fetchObject(ctx, p.strgc, jobExecutionCollection, key)
+	if err != nil {
+		return pkg.JobExecution{}, fmt.Errorf("failed to fetch job execution record: %w", err)
+	}
+	je, err := mapToJobExecution(execMap)
+	if err != nil {
+		return pkg.JobExecution{}, fmt.Errorf("failed to deserialize job execution record: %s", err)
+	}
+
+	// the job type is not recorded on executions, so the default saved searches are run and every extraction
+	// rule is tried
+	pages := searchc.NewPages(ctx, p.srchc, p.savedSearches.Requests(searchc.QueryExecutionResults, "", map[string]string{
+		"execution_id": je.ExecutionID,
+	})...)
+	x, err := extractHosts(pages, "", p.logger)
+	if err != nil {
+		return pkg.JobExecution{}, fmt.Errorf("failed to execute logscale search: %w", err)
+	}
+	hosts := p.outputPolicy.apply(ctx, p.strgc, je.ID, je.ExecutionID, x.Hosts, p.logger)
+	lsResp := pages.Response()
+	if len(hosts) > 0 {
+		prevStatus := je.RunStatus
+		je.TargetedHosts = hosts
+		je.NumHosts = len(hosts)
+		je.HostsTruncated = x.Truncated
+		je = applyHostResults(je)
+		je.LogscaleOutput = lsResp.JobURL
+		je.PendingEnrichment = false
+		je.EnrichmentAttempts = 0
+		at := p.clock.Now().Format(pkg.ISOTimeFormat)
+		je.RecordEvent(pkg.TimelineEnriched, at, fmt.Sprintf("%d host results found in logscale", len(hosts)))
+		je.RecordStatus(prevStatus, at, "enrichment")
+	} else {
+		je.EnrichmentAttempts++
+		je.PendingEnrichment = je.EnrichmentAttempts < maxEnrichmentAttempts
+	}
+
+	data, err := json.Marshal(je)
+	if err != nil {
+		return pkg.JobExecution{}, fmt.Errorf("failed to serialize job execution record: %s", err)
+	}
+	if err = putObject(ctx, p.strgc, jobExecutionCollection, key, data, version); err != nil {
+		return pkg.JobExecution{}, err
+	}
+	return je, nil
+}
+
+func (p *EnrichmentProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return p.enrichmentRespJSON(nil, errs)
+	})
+}
+
+func (p *EnrichmentProcessor) enrichmentRespJSON(r []enrichmentResult, e []fdk.APIError) []byte {
+	if r == nil {
+		r = make([]enrichmentResult, 0)
+	}
+	resp := enrichmentResponse{Errs: e, Resources: r}
+	rJSON, err := json.Marshal(resp)
+	if err != nil {
+		p.logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
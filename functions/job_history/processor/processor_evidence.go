@@ -0,0 +1,312 @@
+package processor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/validate"
+	"github.com/sirupsen/logrus"
+)
+
+// AttachEvidenceProcessor stores evidence files collected by the hosts of a job execution, e.g. file hashes or
+// the output files of a script, so that they outlive the retention of the Logscale results of the execution.
+// Evidence files are stored in their own collection, keyed by the execution ID and the time they were attached.
+type AttachEvidenceProcessor struct {
+	logger logrus.FieldLogger
+	strgc  storagec.StorageC
+	clock  pkg.Clock
+}
+
+// NewAttachEvidenceProcessor returns a new AttachEvidenceProcessor instance.
+func NewAttachEvidenceProcessor(strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *AttachEvidenceProcessor)) *AttachEvidenceProcessor {
+	p := &AttachEvidenceProcessor{
+		logger: logger,
+		strgc:  strgc,
+		clock:  pkg.SystemClock,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// Process attaches the base64 encoded content of the request body to the execution identified by its
+// execution_id, under its name and content_type, and optionally the device_id of the host it was collected from.
+// Files larger than maxEvidenceSize, and files beyond the maxEvidencePerExecution of an execution, are rejected.
+func (p *AttachEvidenceProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	var ar attachEvidenceRequest
+	if err := json.Unmarshal(req.Body, &ar); err != nil {
+		return p.errResp(newError(ErrBadRequest, "failed to parse request body: %s", err))
+	}
+	ar.ExecutionID = strings.TrimSpace(ar.ExecutionID)
+	ar.Name = strings.TrimSpace(ar.Name)
+	ar.DeviceID = strings.TrimSpace(ar.DeviceID)
+	ar.ContentType = strings.TrimSpace(ar.ContentType)
+	if ar.ContentType == "" {
+		ar.ContentType = defaultEvidenceContentType
+	}
+	err := validate.Fields(
+		validate.Field{Name: "execution_id", Value: ar.ExecutionID, Rules: []validate.Rule{validate.Required()}},
+		validate.Field{Name: "name", Value: ar.Name, Rules: []validate.Rule{validate.Required()}},
+		validate.Field{Name: "content_type", Value: ar.ContentType, Rules: []validate.Rule{contentTypeRule}},
+		validate.Field{Name: "content", Value: ar.Content, Rules: []validate.Rule{validate.Required(), evidenceContentRule}},
+	)
+	if err != nil {
+		return p.errResp(err)
+	}
+	content, _ := base64.StdEncoding.DecodeString(ar.Content)
+	logger := p.logger.WithField("execution_id", ar.ExecutionID)
+
+	key, err := locateJobExecution(ctx, p.strgc, ar.ExecutionID)
+	if err != nil {
+		err = fmt.Errorf("failed to search for job execution: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	if key == "" {
+		return p.errResp(newError(ErrNotFound, "not found"))
+	}
+	execMap, _, err := fetchObject(ctx, p.strgc, jobExecutionCollection, key)
+	if errors.Is(err, storagec.NotFound) {
+		return p.errResp(newError(ErrNotFound, "not found"))
+	}
+	if err != nil {
+		err = fmt.Errorf("could not fetch job execution record: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+
+	filter, err := pkg.NewFQLQuery([]pkg.Filter{{Field: "execution_id", Op: pkg.EQ, Value: ar.ExecutionID}})
+	if err != nil {
+		err = fmt.Errorf("error constructing FQL query: %s", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	n, err := p.strgc.Count(ctx, storagec.SearchObjectsRequest{Collection: evidenceCollection, Filter: filter})
+	if err != nil {
+		err = fmt.Errorf("failed to count the evidence of the job execution: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	if n >= maxEvidencePerExecution {
+		return p.errResp(newError(ErrConflict, "job execution already has %d evidence files", n))
+	}
+
+	now := p.clock.Now().UTC()
+	sum := sha256.Sum256(content)
+	jobID, _ := execMap["job_id"].(string)
+	e := evidence{
+		evidenceMeta: evidenceMeta{
+			ContentType: ar.ContentType,
+			CreatedAt:   now.Format(pkg.ISOTimeFormat),
+			DeviceID:    ar.DeviceID,
+			ExecutionID: ar.ExecutionID,
+			ID:          fmt.Sprintf("%s_%d", ar.ExecutionID, now.UnixNano()),
+			JobID:       jobID,
+			Name:        ar.Name,
+			SHA256:      hex.EncodeToString(sum[:]),
+			Size:        len(content),
+			UploadedBy:  callerFromRequest(req).Name,
+		},
+		Content: ar.Content,
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		err = fmt.Errorf("failed to serialize evidence: %s", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	if err = putObject(ctx, p.strgc, evidenceCollection, e.ID, data, ""); err != nil {
+		err = fmt.Errorf("failed to save evidence: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	logger.WithField("evidence_id", e.ID).WithField("size", e.Size).Info("attached evidence to job execution")
+
+	return Response{
+		Body: evidenceRespJSON([]evidenceMeta{e.evidenceMeta}, nil, p.logger),
+		Code: http.StatusCreated,
+	}
+}
+
+func (p *AttachEvidenceProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return evidenceRespJSON(nil, errs, p.logger)
+	})
+}
+
+// EvidenceProcessor returns the evidence files attached to job executions.
+type EvidenceProcessor struct {
+	logger logrus.FieldLogger
+	strgc  storagec.StorageC
+}
+
+// NewEvidenceProcessor returns a new EvidenceProcessor instance.
+func NewEvidenceProcessor(strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *EvidenceProcessor)) *EvidenceProcessor {
+	p := &EvidenceProcessor{
+		logger: logger,
+		strgc:  strgc,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// Process streams the content of the evidence file identified by the id query parameter, with its content type.
+// Without an id, the descriptions of the evidence files attached to the execution identified by the
+// execution_id query parameter are returned instead, oldest first.
+func (p *EvidenceProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	id := queryParam(req.Params.Query, "id")
+	execID := queryParam(req.Params.Query, "execution_id")
+	if id == "" {
+		err := validate.Fields(validate.Field{Name: "execution_id", Value: execID, Rules: []validate.Rule{validate.Required()}})
+		if err != nil {
+			return p.errResp(err)
+		}
+		return p.list(ctx, execID)
+	}
+
+	obj, err := p.strgc.FetchObject(ctx, storagec.FetchObjectRequest{Collection: evidenceCollection, ObjectKey: id})
+	if errors.Is(err, storagec.NotFound) {
+		return p.errResp(newError(ErrNotFound, "not found"))
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to fetch evidence: %w", err)
+		p.logger.WithField("evidence_id", id).Error(err)
+		return p.errResp(err)
+	}
+	var e evidence
+	if err = json.Unmarshal(obj.Data, &e); err != nil {
+		err = fmt.Errorf("failed to deserialize evidence: %s", err)
+		p.logger.WithField("evidence_id", id).Error(err)
+		return p.errResp(err)
+	}
+	return Response{
+		Code:        http.StatusOK,
+		ContentType: e.ContentType,
+		Stream:      &blobStream{content: e.Content},
+	}
+}
+
+func (p *EvidenceProcessor) list(ctx context.Context, execID string) Response {
+	filter, err := pkg.NewFQLQuery([]pkg.Filter{{Field: "execution_id", Op: pkg.EQ, Value: execID}})
+	if err != nil {
+		err = fmt.Errorf("error constructing FQL query: %s", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+	sr, err := p.strgc.SearchAll(ctx, storagec.SearchObjectsRequest{Collection: evidenceCollection, Filter: filter})
+	if err != nil {
+		err = fmt.Errorf("failed to search for evidence: %w", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+	resp := p.strgc.BulkFetch(ctx, storagec.BulkFetchObjectsRequest{
+		Collection: evidenceCollection,
+		ObjectKeys: sr.ObjectKeys,
+	})
+	errs := make([]fdk.APIError, 0)
+	for k, err := range resp.Errs {
+		if errors.Is(err, storagec.NotFound) {
+			continue
+		}
+		err = fmt.Errorf("failed to fetch evidence %s: %w", k, err)
+		p.logger.Error(err)
+		errs = append(errs, apiError(err))
+	}
+	metas := make([]evidenceMeta, 0, len(resp.Objects))
+	for k, data := range resp.Objects {
+		var e evidence
+		if err = json.Unmarshal(data, &e); err != nil {
+			err = fmt.Errorf("failed to deserialize evidence %s: %s", k, err)
+			p.logger.Error(err)
+			errs = append(errs, apiError(err))
+			continue
+		}
+		metas = append(metas, e.evidenceMeta)
+	}
+	sort.Slice(metas, func(i, j int) bool {
+		return metas[i].ID < metas[j].ID
+	})
+
+	code := http.StatusOK
+	if len(errs) > 0 {
+		code = http.StatusMultiStatus
+	}
+	return Response{
+		Body: evidenceRespJSON(metas, errs, p.logger),
+		Code: code,
+	}
+}
+
+func (p *EvidenceProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return evidenceRespJSON(nil, errs, p.logger)
+	})
+}
+
+func evidenceRespJSON(r []evidenceMeta, e []fdk.APIError, logger logrus.FieldLogger) []byte {
+	if r == nil {
+		r = make([]evidenceMeta, 0)
+	}
+	resp := evidenceResponse{Errs: e, Resources: r}
+	rJSON, err := json.Marshal(resp)
+	if err != nil {
+		logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
+
+// blobStream is a response body which decodes base64 encoded content as it is written.
+type blobStream struct {
+	content string
+}
+
+var _ io.WriterTo = (*blobStream)(nil)
+
+// WriteTo writes the decoded content to w.
+func (s *blobStream) WriteTo(w io.Writer) (int64, error) {
+	return io.Copy(w, base64.NewDecoder(base64.StdEncoding, strings.NewReader(s.content)))
+}
+
+// MarshalJSON returns the decoded content, as the function runtime serializes response bodies through
+// json.Marshaler.
+func (s *blobStream) MarshalJSON() ([]byte, error) {
+	return base64.StdEncoding.DecodeString(s.content)
+}
+
+// contentTypeRule rejects values which are not media types, e.g. text/plain.
+var contentTypeRule = validate.Check(func(v string) bool {
+	_, _, err := mime.ParseMediaType(v)
+	return err == nil && strings.Contains(v, "/")
+}, "must be a media type")
+
+// evidenceContentRule rejects content which is not base64 encoded, or larger than maxEvidenceSize once decoded.
+var evidenceContentRule validate.Rule = func(v string) string {
+	if base64.StdEncoding.DecodedLen(len(v)) > maxEvidenceSize+2 {
+		return fmt.Sprintf("must be at most %d bytes", maxEvidenceSize)
+	}
+	b, err := base64.StdEncoding.DecodeString(v)
+	if err != nil {
+		return "must be base64 encoded"
+	}
+	if len(b) > maxEvidenceSize {
+		return fmt.Sprintf("must be at most %d bytes", maxEvidenceSize)
+	}
+	return ""
+}
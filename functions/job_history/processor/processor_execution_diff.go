@@ -0,0 +1,173 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/validate"
+	"github.com/sirupsen/logrus"
+)
+
+// ExecutionDiffProcessor compares the host results of two executions of the same job.
+type ExecutionDiffProcessor struct {
+	logger logrus.FieldLogger
+	strgc  storagec.StorageC
+}
+
+// NewExecutionDiffProcessor returns a new ExecutionDiffProcessor instance.
+func NewExecutionDiffProcessor(strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *ExecutionDiffProcessor)) *ExecutionDiffProcessor {
+	p := &ExecutionDiffProcessor{
+		logger: logger,
+		strgc:  strgc,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// Process compares the execution identified by the target query parameter against the one identified by the base
+// query parameter.  It returns the hosts which failed in target but not in base, those which failed in base but
+// completed in target, and those which were targeted by only one of them.
+func (p *ExecutionDiffProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	baseID := queryParam(req.Params.Query, "base")
+	targetID := queryParam(req.Params.Query, "target")
+	err := validate.Fields(
+		validate.Field{Name: "base", Value: baseID, Rules: []validate.Rule{validate.Required()}},
+		validate.Field{Name: "target", Value: targetID, Rules: []validate.Rule{validate.Required()}},
+	)
+	if err != nil {
+		return p.errResp(err)
+	}
+	logger := p.logger.WithField("base_execution_id", baseID).WithField("target_execution_id", targetID)
+
+	base, err := fetchJobExecution(ctx, p.strgc, baseID)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch base job execution: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	target, err := fetchJobExecution(ctx, p.strgc, targetID)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch target job execution: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	if executionJobID(base) != executionJobID(target) {
+		return p.errResp(newError(ErrBadRequest, "executions %s and %s belong to different jobs", baseID, targetID))
+	}
+
+	resp := p.executionDiffRespJSON([]executionDiff{diffExecutions(base, target)}, nil)
+	if resp == nil {
+		err = errors.New("failed to serialize execution diff response")
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	return Response{
+		Body: resp,
+		Code: http.StatusOK,
+	}
+}
+
+// executionJobID returns the ID of the job of an execution, which older records only store in their id field.
+func executionJobID(je pkg.JobExecution) string {
+	if je.JobID != "" {
+		return je.JobID
+	}
+	return je.ID
+}
+
+// diffExecutions compares the targeted hosts of two executions.  Hosts are matched by device ID, falling back to
+// their host name, which Logscale results may be missing device IDs for.  The entries of target are returned for hosts found in target.
+func diffExecutions(base, target pkg.JobExecution) executionDiff {
+	d := executionDiff{
+		Added:             make([]pkg.TargetedHost, 0),
+		BaseExecutionID:   base.ExecutionID,
+		JobID:             executionJobID(target),
+		NewlyFailed:       make([]pkg.TargetedHost, 0),
+		NewlySucceeded:    make([]pkg.TargetedHost, 0),
+		Removed:           make([]pkg.TargetedHost, 0),
+		TargetExecutionID: target.ExecutionID,
+	}
+
+	baseHosts := make(map[string]pkg.TargetedHost, 2*len(base.TargetedHosts))
+	for _, h := range base.TargetedHosts {
+		for _, k := range hostKeys(h) {
+			baseHosts[k] = h
+		}
+	}
+	matched := make(map[string]bool, len(base.TargetedHosts))
+	for _, h := range target.TargetedHosts {
+		b, ok := lookupHost(baseHosts, h)
+		if !ok {
+			d.Added = append(d.Added, h)
+			continue
+		}
+		for _, k := range hostKeys(b) {
+			matched[k] = true
+		}
+		switch {
+		case h.Status == pkg.StatusFailed && b.Status != pkg.StatusFailed:
+			d.NewlyFailed = append(d.NewlyFailed, h)
+		case h.Status == pkg.StatusCompleted && b.Status == pkg.StatusFailed:
+			d.NewlySucceeded = append(d.NewlySucceeded, h)
+		}
+	}
+	for _, h := range base.TargetedHosts {
+		if !matched[hostKeys(h)[0]] {
+			d.Removed = append(d.Removed, h)
+		}
+	}
+
+	for _, hosts := range [][]pkg.TargetedHost{d.Added, d.NewlyFailed, d.NewlySucceeded, d.Removed} {
+		sort.Slice(hosts, func(i, j int) bool {
+			return hosts[i].HostName < hosts[j].HostName
+		})
+	}
+	return d
+}
+
+// hostKeys returns the keys under which a host is matched, its device ID first.
+func hostKeys(h pkg.TargetedHost) []string {
+	keys := make([]string, 0, 2)
+	if h.DeviceID != "" {
+		keys = append(keys, "device:"+h.DeviceID)
+	}
+	return append(keys, "host:"+strings.ToLower(h.HostName))
+}
+
+func lookupHost(hosts map[string]pkg.TargetedHost, h pkg.TargetedHost) (pkg.TargetedHost, bool) {
+	for _, k := range hostKeys(h) {
+		if b, ok := hosts[k]; ok {
+			return b, true
+		}
+	}
+	return pkg.TargetedHost{}, false
+}
+
+func (p *ExecutionDiffProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return p.executionDiffRespJSON(nil, errs)
+	})
+}
+
+func (p *ExecutionDiffProcessor) executionDiffRespJSON(r []executionDiff, e []fdk.APIError) []byte {
+	if r == nil {
+		r = make([]executionDiff, 0)
+	}
+	resp := executionDiffResponse{Errs: e, Resources: r}
+	rJSON, err := json.Marshal(resp)
+	if err != nil {
+		p.logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
@@ -14,22 +14,23 @@ import (
 	fdk "github.com/CrowdStrike/foundry-fn-go"
 	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
 	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/validate"
 	"github.com/sirupsen/logrus"
 )
 
 // ExecutionsProcessor returns the job execution history.
 type ExecutionsProcessor struct {
-	logger      logrus.FieldLogger
-	strgc       storagec.StorageC
-	nowProvider func() time.Time
+	logger logrus.FieldLogger
+	strgc  storagec.StorageC
+	clock  pkg.Clock
 }
 
 // NewExecutionsProcessor returns a new ExecutionsProcessor instance.
 func NewExecutionsProcessor(strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *ExecutionsProcessor)) *ExecutionsProcessor {
 	p := &ExecutionsProcessor{
-		logger:      logger,
-		strgc:       strgc,
-		nowProvider: nowT,
+		logger: logger,
+		strgc:  strgc,
+		clock:  pkg.SystemClock,
 	}
 	for _, o := range opts {
 		o(p)
@@ -37,44 +38,38 @@ func NewExecutionsProcessor(strgc storagec.StorageC, logger logrus.FieldLogger,
 	return p
 }
 
-// Process returns any job execution histories that match the provided request parameters.
+// Process returns any job execution histories that match the provided request parameters.  The targeted hosts of
+// each execution are paginated by the hosts_page and hosts_page_size query parameters if either is set.
 func (p *ExecutionsProcessor) Process(ctx context.Context, req fdk.Request) Response {
 	queryParams := req.Params.Query
 	if len(queryParams) == 0 {
 		queryParams = make(url.Values)
 	}
-	filterReq, err := buildFilterJobExecsRequest(queryParams)
+	filterReq, err := buildFilterJobExecsRequest(queryParams, p.clock.Now())
+	if err == nil {
+		err = validate.Fields(hostPagingFields(queryParams)...)
+	}
 	if err != nil {
-		msg := fmt.Sprintf("bad arguments in param.query: %s", err)
-		return Response{
-			Body: jobExecRespJSON(nil, nil, []fdk.APIError{{Code: http.StatusBadRequest, Message: msg}}, p.logger),
-			Code: http.StatusBadRequest,
-			Errs: []fdk.APIError{{Code: http.StatusBadRequest, Message: msg}},
-		}
+		return errorResponse(newError(ErrBadRequest, "bad arguments in param.query: %w", err), p.logger)
 	}
 
 	jobExecs, offset, total, err := p.searchExecutions(ctx, filterReq, p.now())
+	if errors.Is(err, storagec.NotFound) {
+		return errorResponse(newError(ErrNotFound, "not found"), p.logger)
+	}
 	if err != nil {
-		if errors.Is(err, storagec.NotFound) {
-			return Response{
-				Body: jobExecRespJSON(nil, nil, []fdk.APIError{{Code: http.StatusNotFound, Message: "not found"}}, p.logger),
-				Code: http.StatusNotFound,
-				Errs: []fdk.APIError{{Code: http.StatusInternalServerError, Message: "not found"}},
-			}
-		}
-		msg := fmt.Sprintf("failed to fetch all objects: %s", err)
-		p.logger.Errorln(msg)
-		return Response{
-			Body: jobExecRespJSON(nil, nil, []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}}, p.logger),
-			Code: http.StatusInternalServerError,
-			Errs: []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}},
-		}
+		err = fmt.Errorf("failed to fetch all objects: %w", err)
+		p.logger.Errorln(err)
+		return errorResponse(err, p.logger)
 	}
 
 	jobExecs, err = p.computeDurations(jobExecs)
 	if err != nil {
 		p.logger.Errorf("failed to compute duration for job executions: %s", err)
 	}
+	if hp, ok := parseHostPaging(queryParams); ok {
+		jobExecs = paginateHosts(jobExecs, hp)
+	}
 
 	nextPrevOffset, nextNextOffset := p.pagination(filterReq.Offset.Direction, filterReq.Offset.Page, filterReq.Offset.Offset, filterReq.Limit, offset, total)
 	resp := jobExecRespJSON(
@@ -90,13 +85,9 @@ func (p *ExecutionsProcessor) Process(ctx context.Context, req fdk.Request) Resp
 		p.logger,
 	)
 	if resp == nil {
-		msg := "failed to serialize job execution response"
-		p.logger.Errorln(msg)
-		return Response{
-			Body: jobExecRespJSON(nil, nil, []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}}, p.logger),
-			Code: http.StatusInternalServerError,
-			Errs: []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}},
-		}
+		err = errors.New("failed to serialize job execution response")
+		p.logger.Errorln(err)
+		return errorResponse(err, p.logger)
 	}
 	return Response{
 		Body: resp,
@@ -105,32 +96,11 @@ func (p *ExecutionsProcessor) Process(ctx context.Context, req fdk.Request) Resp
 }
 
 func (p *ExecutionsProcessor) searchExecutions(ctx context.Context, filterReq filterJobExecsRequest, now string) ([]pkg.JobExecution, int, int, error) {
-	filters := make([]pkg.Filter, 0, 2)
-	filters = append(filters, pkg.Filter{
-		Field: "run_date",
-		Op:    pkg.GTE,
-		Value: filterReq.EarliestRunDate,
-	})
-	filters = append(filters, pkg.Filter{
-		Field: "run_date",
-		Op:    pkg.LTE,
-		Value: now,
-	})
-	if filterReq.JobID != "" {
-		filters = append(filters, pkg.Filter{
-			Field: "id",
-			Op:    pkg.EQ,
-			Value: filterReq.JobID,
-		})
-	}
-	if filterReq.JobName != "" {
-		filters = append(filters, pkg.Filter{
-			Field: "name",
-			Op:    pkg.MATCH,
-			Value: filterReq.JobName,
-		})
-	}
-	fqlFilter, err := pkg.NewFQLQuery(filters)
+	b := &pkg.QueryBuilder{}
+	b.Between("run_date", filterReq.EarliestRunDate, now).
+		Where("id", pkg.EQ, filterReq.JobID).
+		Where("name", pkg.MATCH, filterReq.JobName)
+	fqlFilter, err := b.Build()
 	if err != nil {
 		err = fmt.Errorf("error constructing FQL query: %s", err.Error())
 		return nil, 0, 0, err
@@ -140,55 +110,94 @@ func (p *ExecutionsProcessor) searchExecutions(ctx context.Context, filterReq fi
 		err = fmt.Errorf("error constructing FQL sort: %s", err.Error())
 		return nil, 0, 0, err
 	}
-	searchReq := storagec.SearchObjectsRequest{
+	// the page requested may be larger than the pages of the custom storage API
+	searchResp, err := p.strgc.SearchAll(ctx, storagec.SearchObjectsRequest{
 		Collection: jobExecutionCollection,
 		Filter:     fqlFilter,
-		Limit:      filterReq.Limit,
+		MaxResults: filterReq.Limit,
 		Offset:     filterReq.Offset.Offset,
 		Sort:       fqlSort,
-	}
-	searchResp, err := p.strgc.SearchAndFetch(ctx, searchReq)
+	})
 	if err != nil {
-		err = fmt.Errorf("error retrieving records: %s", err.Error())
+		err = fmt.Errorf("error retrieving records: %w", err)
 		return nil, 0, 0, err
 	}
-	jobExecs := make([]pkg.JobExecution, len(searchResp.Objects))
-	for i, b := range searchResp.Objects {
-		je, err := pkg.DecodeJobExecution(b.Data)
-		if err != nil {
-			return nil, 0, 0, fmt.Errorf("error decoding job execution record: %s", err.Error())
-		}
-		if je.JobID == "" {
-			je.JobID = je.ID
-		} else if je.ID == "" {
-			je.ID = je.JobID
+	offset := 0
+	if searchResp.NextToken != "" {
+		offset = filterReq.Offset.Offset + len(searchResp.ObjectKeys)
+	}
+	if len(searchResp.ObjectKeys) == 0 {
+		return []pkg.JobExecution{}, offset, searchResp.Total, nil
+	}
+
+	bulkResp := p.strgc.BulkFetch(ctx, storagec.BulkFetchObjectsRequest{
+		Collection: jobExecutionCollection,
+		ObjectKeys: searchResp.ObjectKeys,
+	})
+	jobExecs := make([]pkg.JobExecution, 0, len(searchResp.ObjectKeys))
+	for _, k := range searchResp.ObjectKeys {
+		if err := bulkResp.Errs[k]; err != nil && !errors.Is(err, storagec.NotFound) {
+			return nil, 0, 0, fmt.Errorf("error retrieving record %s: %w", k, err)
 		}
-		if je.TargetedHosts == nil {
-			je.TargetedHosts = make([]pkg.TargetedHost, 0)
+		data, ok := bulkResp.Objects[k]
+		if !ok {
+			// deleted since the search
+			continue
 		}
-		je.Hosts = make([]string, len(je.TargetedHosts))
-		for ti, h := range je.TargetedHosts {
-			je.Hosts[ti] = h.HostName
+		je, err := decodeStoredJobExecution(data)
+		if err != nil {
+			return nil, 0, 0, err
 		}
-		jobExecs[i] = je
+		jobExecs = append(jobExecs, je)
 	}
-	return jobExecs, searchResp.Offset, searchResp.Total, nil
+	return jobExecs, offset, searchResp.Total, nil
+}
+
+// decodeStoredJobExecution decodes a job execution record as stored in custom storage,
+// filling in the fields which are derived rather than stored.
+func decodeStoredJobExecution(data []byte) (pkg.JobExecution, error) {
+	je, err := pkg.DecodeJobExecution(data)
+	if err != nil {
+		return pkg.JobExecution{}, fmt.Errorf("error decoding job execution record: %s", err.Error())
+	}
+	if je.JobID == "" {
+		je.JobID = je.ID
+	} else if je.ID == "" {
+		je.ID = je.JobID
+	}
+	if je.TargetedHosts == nil {
+		je.TargetedHosts = make([]pkg.TargetedHost, 0)
+	}
+	je.Hosts = make([]string, len(je.TargetedHosts))
+	for ti, h := range je.TargetedHosts {
+		je.Hosts[ti] = h.HostName
+	}
+	return je, nil
 }
 
 func (p *ExecutionsProcessor) now() string {
-	return p.nowProvider().Format(pkg.ISOTimeFormat)
+	return p.clock.Now().Format(pkg.ISOTimeFormat)
 }
 
 func (p *ExecutionsProcessor) computeDurations(execs []pkg.JobExecution) ([]pkg.JobExecution, error) {
+	return computeDurations(execs, p.clock.Now())
+}
+
+// computeDurations refreshes the duration of in-progress executions relative to now.
+func computeDurations(execs []pkg.JobExecution, now time.Time) ([]pkg.JobExecution, error) {
 	for i, e := range execs {
 		endDate := e.EndDate
 		if endDate == "" {
-			endDate = p.now()
+			endDate = now.Format(pkg.ISOTimeFormat)
 		}
-		d, err := computeJobDuration(e.RunDate, endDate, e.RunStatus)
+		d, secs, err := computeJobDuration(e.RunDate, endDate, e.RunStatus, now)
 		if err != nil {
 			return nil, nil
 		}
+		if e.RunStatus == pkg.StatusInProgress || (d != "" && e.DurationSeconds == 0) {
+			// records which predate duration_seconds only have the formatted duration
+			e.DurationSeconds = secs
+		}
 		if e.RunStatus == pkg.StatusInProgress {
 			e.Duration = d
 		}
@@ -197,11 +206,11 @@ func (p *ExecutionsProcessor) computeDurations(execs []pkg.JobExecution) ([]pkg.
 	return execs, nil
 }
 
-func buildFilterJobExecsRequest(q url.Values) (filterJobExecsRequest, error) {
+func buildFilterJobExecsRequest(q url.Values, now time.Time) (filterJobExecsRequest, error) {
 	jobID := ""
 	jobName := ""
 	limit := 10
-	oneWeekAgo := time.Now().UTC().Add(-7 * (24 * time.Hour))
+	oneWeekAgo := now.Add(-7 * (24 * time.Hour))
 	runDate := oneWeekAgo.Format(pkg.ISOTimeFormat)
 
 	filterParam := q.Get("filter")
@@ -225,14 +234,11 @@ func buildFilterJobExecsRequest(q url.Values) (filterJobExecsRequest, error) {
 			}
 		}
 	}
-	if s := strings.TrimSpace(q.Get("limit")); s != "" {
-		l, err := strconv.Atoi(s)
-		if err != nil {
-			return filterJobExecsRequest{}, fmt.Errorf("failed to convert limit to integer: %s", err)
-		}
-		if l > 0 {
-			limit = l
-		}
+	if err := validate.Fields(validate.Field{Name: "limit", Value: queryParam(q, "limit"), Rules: []validate.Rule{validate.Int()}}); err != nil {
+		return filterJobExecsRequest{}, err
+	}
+	if l, err := strconv.Atoi(queryParam(q, "limit")); err == nil && l > 0 {
+		limit = l
 	}
 
 	next, prev := q.Get("next"), q.Get("prev")
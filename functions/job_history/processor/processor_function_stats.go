@@ -0,0 +1,78 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/sirupsen/logrus"
+)
+
+// FunctionStatsProcessor returns the stats snapshot saved by the FunctionStatsRecorder.
+type FunctionStatsProcessor struct {
+	logger logrus.FieldLogger
+	strgc  storagec.StorageC
+}
+
+// NewFunctionStatsProcessor returns a new FunctionStatsProcessor instance.
+func NewFunctionStatsProcessor(strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *FunctionStatsProcessor)) *FunctionStatsProcessor {
+	p := &FunctionStatsProcessor{
+		logger: logger,
+		strgc:  strgc,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// Process returns the stats snapshot, which is not found until the function has run for a save interval.
+func (p *FunctionStatsProcessor) Process(ctx context.Context, _ fdk.Request) Response {
+	m, _, err := fetchObject(ctx, p.strgc, settingsCollection, functionStatsName)
+	if errors.Is(err, storagec.NotFound) {
+		return p.errResp(newError(ErrNotFound, "function stats have not been saved yet"))
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to fetch function stats: %w", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+
+	var stats functionStats
+	b, err := json.Marshal(m)
+	if err == nil {
+		err = json.Unmarshal(b, &stats)
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to parse function stats: %s", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+	return Response{
+		Body: p.functionStatsRespJSON([]functionStats{stats}, nil),
+		Code: http.StatusOK,
+	}
+}
+
+func (p *FunctionStatsProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return p.functionStatsRespJSON(nil, errs)
+	})
+}
+
+func (p *FunctionStatsProcessor) functionStatsRespJSON(s []functionStats, e []fdk.APIError) []byte {
+	if s == nil {
+		s = make([]functionStats, 0)
+	}
+	r := functionStatsResponse{Errs: e, Resources: s}
+	rJSON, err := json.Marshal(r)
+	if err != nil {
+		p.logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
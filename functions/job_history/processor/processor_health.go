@@ -0,0 +1,138 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/searchc"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// HealthOK is the status of a component which responded to its probe.
+	HealthOK = "ok"
+	// HealthUnavailable is the status of a component whose probe failed or timed out.
+	HealthUnavailable = "unavailable"
+
+	// defaultProbeTimeout is how long a component has to respond to its probe.
+	defaultProbeTimeout = 5 * time.Second
+)
+
+// HealthProcessor probes the services the function depends on.  Probes are shallow: they read at most one
+// object key or saved search, so checking health is cheap enough to be polled by an external monitor.
+type HealthProcessor struct {
+	logger  logrus.FieldLogger
+	srchc   searchc.SearchC
+	strgc   storagec.StorageC
+	timeout time.Duration
+}
+
+// NewHealthProcessor returns a new HealthProcessor instance.
+func NewHealthProcessor(srchc searchc.SearchC, strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *HealthProcessor)) *HealthProcessor {
+	p := &HealthProcessor{
+		logger:  logger,
+		srchc:   srchc,
+		strgc:   strgc,
+		timeout: defaultProbeTimeout,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// WithProbeTimeout sets how long each component has to respond to its probe.
+func WithProbeTimeout(d time.Duration) func(p *HealthProcessor) {
+	return func(p *HealthProcessor) {
+		if d > 0 {
+			p.timeout = d
+		}
+	}
+}
+
+// Process probes every component concurrently, returning their statuses.  The response code is 503 if
+// any component is unavailable, so monitors can rely on the code alone.
+func (p *HealthProcessor) Process(ctx context.Context, _ fdk.Request) Response {
+	probes := map[string]func(ctx context.Context) error{
+		"custom_storage": p.probeStorage,
+		"logscale":       p.srchc.Ping,
+	}
+
+	components := make([]componentHealth, 0, len(probes))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, probe := range probes {
+		wg.Add(1)
+		go func(name string, probe func(ctx context.Context) error) {
+			defer wg.Done()
+			c := p.probe(ctx, name, probe)
+			mu.Lock()
+			components = append(components, c)
+			mu.Unlock()
+		}(name, probe)
+	}
+	wg.Wait()
+
+	status, code := HealthOK, http.StatusOK
+	for _, c := range components {
+		if c.Status != HealthOK {
+			status, code = HealthUnavailable, http.StatusServiceUnavailable
+		}
+	}
+	return Response{
+		Body: p.healthRespJSON(status, components),
+		Code: code,
+	}
+}
+
+// probe runs a single probe, bounded by the probe timeout.
+func (p *HealthProcessor) probe(ctx context.Context, name string, probe func(ctx context.Context) error) componentHealth {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := probe(ctx)
+	c := componentHealth{
+		LatencyMillis: time.Since(start).Milliseconds(),
+		Name:          name,
+		Status:        HealthOK,
+	}
+	if err != nil {
+		p.logger.WithField("component", name).Warnf("health probe failed: %s", err)
+		c.Error = err.Error()
+		c.Status = HealthUnavailable
+	}
+	return c
+}
+
+// probeStorage reads at most one key of the jobs collection.
+func (p *HealthProcessor) probeStorage(ctx context.Context) error {
+	_, err := p.strgc.FetchKeys(ctx, storagec.FetchKeysRequest{Collection: jobCollection, Limit: 1})
+	if err != nil {
+		return fmt.Errorf("failed to list job keys: %w", err)
+	}
+	return nil
+}
+
+func (p *HealthProcessor) healthRespJSON(status string, c []componentHealth) []byte {
+	if c == nil {
+		c = make([]componentHealth, 0)
+	}
+	sort.Slice(c, func(i, j int) bool {
+		return c[i].Name < c[j].Name
+	})
+	r := healthResponse{Resources: c, Status: status}
+	rJSON, err := json.Marshal(r)
+	if err != nil {
+		p.logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
@@ -0,0 +1,173 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"unicode/utf8"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/validate"
+	"github.com/sirupsen/logrus"
+)
+
+// OutputPolicy bounds the RTR output of each host kept on execution records.  The first InlineLimit bytes of the
+// stdout and stderr of a host are kept inline, and when either is longer the full output, up to MaxSize bytes of
+// each, is spilled to the host output collection, where the OutputID of the host points to.
+type OutputPolicy struct {
+	// InlineLimit is the number of bytes of each output kept on the execution record.
+	InlineLimit int
+	// MaxSize is the number of bytes of each output spilled to the host output collection.
+	MaxSize int
+}
+
+// DefaultOutputPolicy returns the output policy applied unless configured otherwise.
+func DefaultOutputPolicy() OutputPolicy {
+	return OutputPolicy{InlineLimit: defaultOutputInlineLimit, MaxSize: maxSpilledOutputSize}
+}
+
+// apply truncates the output of the hosts of an execution to the inline limit, spilling the full output of hosts
+// exceeding it.  The output of hosts which could not be spilled is truncated all the same, and the failure logged,
+// as the results of the hosts matter more than their output.
+func (op OutputPolicy) apply(ctx context.Context, strgc storagec.StorageC, jobID, execID string, hosts []pkg.TargetedHost, l logrus.FieldLogger) []pkg.TargetedHost {
+	maxSize := max(op.MaxSize, op.InlineLimit)
+	for i, h := range hosts {
+		h.OutputID = ""
+		if len(h.Stdout) <= op.InlineLimit && len(h.Stderr) <= op.InlineLimit {
+			hosts[i] = h
+			continue
+		}
+
+		ho := hostOutput{
+			DeviceID:    h.DeviceID,
+			ExecutionID: execID,
+			HostName:    h.HostName,
+			ID:          hostOutputID(execID, h),
+			JobID:       jobID,
+			Stderr:      truncateOutput(h.Stderr, maxSize),
+			StderrSize:  len(h.Stderr),
+			Stdout:      truncateOutput(h.Stdout, maxSize),
+			StdoutSize:  len(h.Stdout),
+		}
+		ho.Truncated = len(ho.Stdout) < ho.StdoutSize || len(ho.Stderr) < ho.StderrSize
+		data, err := json.Marshal(ho)
+		if err == nil {
+			err = putObject(ctx, strgc, hostOutputCollection, ho.ID, data, "")
+		}
+		if err != nil {
+			l.WithField("execution_id", execID).
+				WithField("host_name", h.HostName).
+				Errorf("failed to spill host output - keeping the truncated output only: %s", err)
+		} else {
+			h.OutputID = ho.ID
+		}
+		h.Stdout = truncateOutput(h.Stdout, op.InlineLimit)
+		h.Stderr = truncateOutput(h.Stderr, op.InlineLimit)
+		hosts[i] = h
+	}
+	return hosts
+}
+
+// hostOutputID returns the ID of the spilled output of a host of an execution, which is stable so that the
+// output is replaced when the results of the execution are extracted again.
+func hostOutputID(execID string, h pkg.TargetedHost) string {
+	hostKey := h.DeviceID
+	if hostKey == "" {
+		// host names are not restricted to the characters allowed in object keys
+		hostKey, _ = generateJobID(h.HostName)
+	}
+	return fmt.Sprintf("%s_%s", execID, hostKey)
+}
+
+// truncateOutput returns the first n bytes of s, less any trailing partial UTF-8 character.
+func truncateOutput(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// HostOutputProcessor returns the full RTR output of a host of a job execution, as spilled by the OutputPolicy.
+type HostOutputProcessor struct {
+	logger logrus.FieldLogger
+	strgc  storagec.StorageC
+}
+
+// NewHostOutputProcessor returns a new HostOutputProcessor instance.
+func NewHostOutputProcessor(strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *HostOutputProcessor)) *HostOutputProcessor {
+	p := &HostOutputProcessor{
+		logger: logger,
+		strgc:  strgc,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// Process returns the output identified by the id query parameter, the output_id of a targeted host.  With
+// stream=stdout or stream=stderr, that output alone is returned as plain text.
+func (p *HostOutputProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	id := queryParam(req.Params.Query, "id")
+	stream := queryParam(req.Params.Query, "stream")
+	err := validate.Fields(
+		validate.Field{Name: "id", Value: id, Rules: []validate.Rule{validate.Required()}},
+		validate.Field{Name: "stream", Value: stream, Rules: []validate.Rule{validate.Enum(fieldStdout, fieldStderr)}},
+	)
+	if err != nil {
+		return p.errResp(err)
+	}
+
+	obj, err := p.strgc.FetchObject(ctx, storagec.FetchObjectRequest{Collection: hostOutputCollection, ObjectKey: id})
+	if errors.Is(err, storagec.NotFound) {
+		return p.errResp(newError(ErrNotFound, "not found"))
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to fetch host output: %w", err)
+		p.logger.WithField("output_id", id).Error(err)
+		return p.errResp(err)
+	}
+	var ho hostOutput
+	if err = json.Unmarshal(obj.Data, &ho); err != nil {
+		err = fmt.Errorf("failed to deserialize host output: %s", err)
+		p.logger.WithField("output_id", id).Error(err)
+		return p.errResp(err)
+	}
+
+	switch stream {
+	case fieldStdout:
+		return Response{Code: http.StatusOK, ContentType: textContentType, Stream: &rawStream{data: []byte(ho.Stdout)}}
+	case fieldStderr:
+		return Response{Code: http.StatusOK, ContentType: textContentType, Stream: &rawStream{data: []byte(ho.Stderr)}}
+	}
+	return Response{
+		Body: p.hostOutputRespJSON([]hostOutput{ho}, nil),
+		Code: http.StatusOK,
+	}
+}
+
+func (p *HostOutputProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return p.hostOutputRespJSON(nil, errs)
+	})
+}
+
+func (p *HostOutputProcessor) hostOutputRespJSON(r []hostOutput, e []fdk.APIError) []byte {
+	if r == nil {
+		r = make([]hostOutput, 0)
+	}
+	resp := hostOutputResponse{Errs: e, Resources: r}
+	rJSON, err := json.Marshal(resp)
+	if err != nil {
+		p.logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
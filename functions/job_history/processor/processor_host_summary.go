@@ -0,0 +1,189 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/hostsc"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/validate"
+	"github.com/sirupsen/logrus"
+)
+
+// Attributes the host results of an execution can be grouped by.
+const (
+	groupByHostGroup = "host_group"
+	groupByPlatform  = "platform"
+	groupBySite      = "site"
+)
+
+// unresolvedGroup is the group of the hosts whose attribute is unknown, because they are missing a device ID,
+// are no longer known to the Hosts API or have no value for it.
+const unresolvedGroup = "unknown"
+
+// HostSummaryProcessor summarizes the host results of an execution by host group, platform or site.
+type HostSummaryProcessor struct {
+	hstc   hostsc.HostC
+	logger logrus.FieldLogger
+	strgc  storagec.StorageC
+}
+
+// NewHostSummaryProcessor returns a new HostSummaryProcessor instance.
+func NewHostSummaryProcessor(strgc storagec.StorageC, hstc hostsc.HostC, logger logrus.FieldLogger, opts ...func(p *HostSummaryProcessor)) *HostSummaryProcessor {
+	p := &HostSummaryProcessor{
+		hstc:   hstc,
+		logger: logger,
+		strgc:  strgc,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// Process counts the targeted hosts of the execution identified by the execution_id query parameter per status,
+// grouping them by the group_by query parameter: host_group, platform or site.  The attributes of the hosts are
+// resolved through the Hosts API, except for platforms already recorded with their results.  A host counts
+// towards each of its host groups.
+func (p *HostSummaryProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	execID := queryParam(req.Params.Query, "execution_id")
+	groupBy := queryParam(req.Params.Query, "group_by")
+	err := validate.Fields(
+		validate.Field{Name: "execution_id", Value: execID, Rules: []validate.Rule{validate.Required()}},
+		validate.Field{Name: "group_by", Value: groupBy, Rules: []validate.Rule{validate.Required(), validate.Enum(groupByHostGroup, groupByPlatform, groupBySite)}},
+	)
+	if err != nil {
+		return p.errResp(err)
+	}
+	logger := p.logger.WithField("execution_id", execID)
+
+	je, err := fetchJobExecution(ctx, p.strgc, execID)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch job execution: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+
+	groups, err := p.hostGroups(ctx, je.TargetedHosts, groupBy)
+	if err != nil {
+		err = fmt.Errorf("failed to resolve hosts: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+
+	resp := p.hostSummaryRespJSON([]hostSummary{summarizeHosts(je, groupBy, groups)}, nil)
+	if resp == nil {
+		err = errors.New("failed to serialize host summary response")
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	return Response{
+		Body: resp,
+		Code: http.StatusOK,
+	}
+}
+
+// hostGroups returns the groups of each host, keyed by device ID.  Hosts without a device ID are left out.
+func (p *HostSummaryProcessor) hostGroups(ctx context.Context, hosts []pkg.TargetedHost, groupBy string) (map[string][]string, error) {
+	groups := make(map[string][]string, len(hosts))
+	lookup := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		if h.DeviceID == "" {
+			continue
+		}
+		if groupBy == groupByPlatform && h.Platform != "" {
+			groups[h.DeviceID] = []string{h.Platform}
+			continue
+		}
+		if _, ok := groups[h.DeviceID]; !ok {
+			groups[h.DeviceID] = nil
+			lookup = append(lookup, h.DeviceID)
+		}
+	}
+	if len(lookup) == 0 {
+		return groups, nil
+	}
+
+	details, err := p.hstc.Details(ctx, lookup)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range details {
+		switch groupBy {
+		case groupByHostGroup:
+			groups[d.DeviceID] = d.Groups
+		case groupByPlatform:
+			if pl := pkg.NormalizePlatform(d.Platform); pl != "" {
+				groups[d.DeviceID] = []string{pl}
+			}
+		case groupBySite:
+			if d.SiteName != "" {
+				groups[d.DeviceID] = []string{d.SiteName}
+			}
+		}
+	}
+	return groups, nil
+}
+
+// summarizeHosts counts the targeted hosts of the execution per group and status, ordering the groups by name.
+func summarizeHosts(je pkg.JobExecution, groupBy string, groups map[string][]string) hostSummary {
+	byGroup := make(map[string]*hostGroupSummary)
+	count := func(group, status string) {
+		g, ok := byGroup[group]
+		if !ok {
+			g = &hostGroupSummary{Group: group, Statuses: make(map[string]int)}
+			byGroup[group] = g
+		}
+		g.Hosts++
+		g.Statuses[status]++
+	}
+	for _, h := range je.TargetedHosts {
+		hostGroups := groups[h.DeviceID]
+		if len(hostGroups) == 0 {
+			hostGroups = []string{unresolvedGroup}
+		}
+		for _, g := range hostGroups {
+			count(g, h.Status)
+		}
+	}
+
+	s := hostSummary{
+		ExecutionID: je.ExecutionID,
+		GroupBy:     groupBy,
+		Groups:      make([]hostGroupSummary, 0, len(byGroup)),
+		Hosts:       len(je.TargetedHosts),
+		JobID:       executionJobID(je),
+	}
+	for _, g := range byGroup {
+		s.Groups = append(s.Groups, *g)
+	}
+	sort.Slice(s.Groups, func(i, j int) bool {
+		return s.Groups[i].Group < s.Groups[j].Group
+	})
+	return s
+}
+
+func (p *HostSummaryProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return p.hostSummaryRespJSON(nil, errs)
+	})
+}
+
+func (p *HostSummaryProcessor) hostSummaryRespJSON(s []hostSummary, e []fdk.APIError) []byte {
+	if s == nil {
+		s = make([]hostSummary, 0)
+	}
+	r := hostSummaryResponse{Errs: e, Resources: s}
+	rJSON, err := json.Marshal(r)
+	if err != nil {
+		p.logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
@@ -0,0 +1,164 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/validate"
+	"github.com/sirupsen/logrus"
+)
+
+// iCalendarContentType is the content type of iCalendar feeds.
+const iCalendarContentType = "text/calendar; charset=utf-8"
+
+// iCalendarTimeFormat is the format of the UTC date-times of iCalendar feeds.
+const iCalendarTimeFormat = "20060102T150405Z"
+
+// maxICalendarLineLength is the length in octets after which the content lines of an iCalendar feed are folded.
+const maxICalendarLineLength = 75
+
+// ICalendarProcessor renders the upcoming runs of every job as an iCalendar feed, so that they can be subscribed
+// to from a calendar application.
+type ICalendarProcessor struct {
+	logger logrus.FieldLogger
+	strgc  storagec.StorageC
+	clock  pkg.Clock
+}
+
+// NewICalendarProcessor returns a new ICalendarProcessor instance.
+func NewICalendarProcessor(strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *ICalendarProcessor)) *ICalendarProcessor {
+	p := &ICalendarProcessor{
+		logger: logger,
+		strgc:  strgc,
+		clock:  pkg.SystemClock,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// Process returns an event for each run of every job over the number of days given by the days query parameter,
+// defaultICalendarDays by default, projected from the current time in the same way as by the calendar.  Jobs with
+// more than maxCalendarRunsPerJob runs over those days only have their first runs in the feed.  Runs falling in a
+// blackout are cancelled events.
+func (p *ICalendarProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	q := req.Params.Query
+	if len(q) == 0 {
+		q = make(url.Values)
+	}
+	days, err := iCalendarDays(q)
+	if err != nil {
+		return p.errResp(err)
+	}
+
+	now := p.clock.Now().UTC()
+	runs, truncated, err := projectRuns(ctx, p.strgc, now, now.Add(time.Duration(days)*24*time.Hour), p.logger)
+	if err != nil {
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+	if len(truncated) > 0 {
+		p.logger.WithField("truncated_jobs", truncated).Warn("runs of jobs truncated from the calendar feed")
+		addWarning(ctx, "runs of %d jobs truncated from the calendar feed", len(truncated))
+	}
+	return Response{
+		Code:        http.StatusOK,
+		ContentType: iCalendarContentType,
+		Stream:      &rawStream{data: renderICalendar(runs, now)},
+	}
+}
+
+// iCalendarDays returns the number of days of runs in the feed, capped to the longest window of a calendar.
+func iCalendarDays(q url.Values) (int, error) {
+	if err := validate.Fields(
+		validate.Field{Name: "days", Value: queryParam(q, "days"), Rules: []validate.Rule{validate.Int(), validate.AtLeast(1)}},
+	); err != nil {
+		return 0, err
+	}
+	days := defaultICalendarDays
+	if n, err := strconv.Atoi(queryParam(q, "days")); err == nil {
+		days = n
+	}
+	return min(days, int(maxCalendarRange/(24*time.Hour))), nil
+}
+
+// renderICalendar renders the runs as the events of an iCalendar feed.  The UID of each event is derived from its
+// job and time, so that calendar applications refreshing the feed update the events rather than duplicating them.
+func renderICalendar(runs []calendarRun, now time.Time) []byte {
+	var b strings.Builder
+	line := func(name, value string) {
+		writeICalendarLine(&b, name+":"+value)
+	}
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//CrowdStrike//Rapid Response job_history//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+	line("X-WR-CALNAME", "Rapid Response jobs")
+	for _, r := range runs {
+		line("BEGIN", "VEVENT")
+		line("UID", fmt.Sprintf("%s-%d@rapid-response", r.JobID, r.RunAt.Unix()))
+		line("DTSTAMP", now.Format(iCalendarTimeFormat))
+		line("DTSTART", r.RunAt.UTC().Format(iCalendarTimeFormat))
+		line("SUMMARY", escapeICalendarText(r.Name))
+		description := fmt.Sprintf("Scheduled run of job %s", r.Name)
+		if r.ScheduleType != "" {
+			description += fmt.Sprintf(" (%s)", r.ScheduleType)
+		}
+		if r.Blackout != "" {
+			description += fmt.Sprintf(", skipped by blackout %s", r.Blackout)
+			line("STATUS", "CANCELLED")
+		}
+		line("DESCRIPTION", escapeICalendarText(description))
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return []byte(b.String())
+}
+
+// escapeICalendarText escapes a TEXT property value.
+func escapeICalendarText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// writeICalendarLine writes a content line terminated by CRLF, folding it into lines of at most
+// maxICalendarLineLength octets without splitting UTF-8 sequences.
+func writeICalendarLine(b *strings.Builder, l string) {
+	limit := maxICalendarLineLength
+	for len(l) > limit {
+		i := limit
+		for i > 0 && !utf8.RuneStart(l[i]) {
+			i--
+		}
+		b.WriteString(l[:i])
+		b.WriteString("\r\n ")
+		l = l[i:]
+		// continuation lines start with the space folding them
+		limit = maxICalendarLineLength - 1
+	}
+	b.WriteString(l)
+	b.WriteString("\r\n")
+}
+
+func (p *ICalendarProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		resp := calendarResponse{Errs: errs, Resources: make([]calendarRun, 0)}
+		rJSON, err := json.Marshal(resp)
+		if err != nil {
+			p.logger.Errorf("failed to serialize response: %s", err)
+			return nil
+		}
+		return rJSON
+	})
+}
@@ -0,0 +1,277 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/validate"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultImportSource is the source of imported executions which do not name theirs.
+const defaultImportSource = "manual"
+
+// ImportExecutionProcessor records job executions run outside the workflows of the app, e.g. a remediation done in
+// a manual RTR session, so that the job history is complete even for ad-hoc remediations.
+//
+// Imported executions are validated and normalized like those reported by the workflows, and flagged with the
+// source they were imported from.  They are not counted as runs of their job.
+type ImportExecutionProcessor struct {
+	clock        pkg.Clock
+	jobIDs       JobIDs
+	logger       logrus.FieldLogger
+	outputPolicy OutputPolicy
+	strgc        storagec.StorageC
+}
+
+// NewImportExecutionProcessor returns a new ImportExecutionProcessor instance.
+func NewImportExecutionProcessor(strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *ImportExecutionProcessor)) *ImportExecutionProcessor {
+	p := &ImportExecutionProcessor{
+		clock:        pkg.SystemClock,
+		jobIDs:       NewHashJobIDs(strgc, false),
+		logger:       logger,
+		outputPolicy: DefaultOutputPolicy(),
+		strgc:        strgc,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// WithImportJobIDs sets the strategy resolving the IDs of the jobs of imported executions.
+func WithImportJobIDs(ids JobIDs) func(p *ImportExecutionProcessor) {
+	return func(p *ImportExecutionProcessor) {
+		p.jobIDs = ids
+	}
+}
+
+// WithImportOutputPolicy sets the policy bounding the output of hosts stored on the execution records of the
+// ImportExecutionProcessor.  Policies without a positive inline limit are ignored.
+func WithImportOutputPolicy(op OutputPolicy) func(p *ImportExecutionProcessor) {
+	return func(p *ImportExecutionProcessor) {
+		if op.InlineLimit > 0 {
+			p.outputPolicy = op
+		}
+	}
+}
+
+// Process records the execution in the request body.  The name of its job and its run_date are required, and its
+// status must be that of a finished execution; it defaults to completed, and is derived from the results of its
+// hosts like those of the workflows.  An execution_id is generated when none is given, and executions whose ID is
+// already recorded are rejected with a conflict.
+func (p *ImportExecutionProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	var ir importExecutionRequest
+	if err := json.Unmarshal(req.Body, &ir); err != nil {
+		return p.errResp(newError(ErrBadRequest, "failed to parse request body: %s", err))
+	}
+	ir = ir.normalize()
+	if err := ir.validate(); err != nil {
+		return p.errResp(err)
+	}
+	now := p.clock.Now().UTC()
+	if ir.ExecutionID == "" {
+		ir.ExecutionID = fmt.Sprintf("imported_%d", now.UnixNano())
+	}
+	logger := p.logger.WithField("execution_id", ir.ExecutionID).WithField("source", ir.Source)
+
+	key, err := locateJobExecution(ctx, p.strgc, ir.ExecutionID)
+	if err != nil {
+		err = fmt.Errorf("failed to search for job execution: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	if key != "" {
+		return p.errResp(newError(ErrConflict, "job execution %s is already recorded", ir.ExecutionID))
+	}
+
+	jobName := ir.JobName
+	jobID, err := p.jobIDs.JobID(ctx, jobName)
+	if err != nil {
+		err = fmt.Errorf("job ID could not be determined: %s", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	var j job
+	jobMap, _, err := fetchObject(ctx, p.strgc, jobCollection, jobID)
+	switch {
+	case errors.Is(err, storagec.NotFound):
+		addWarning(ctx, "job %s has no record; the execution is recorded without one", jobName)
+	case err != nil:
+		err = fmt.Errorf("failed to fetch job record: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	default:
+		if j, err = distillJob(jobMap); err != nil {
+			err = fmt.Errorf("could not distill job record from dictionary: %s", err)
+			logger.Error(err)
+			return p.errResp(err)
+		}
+		if j.Name != "" {
+			jobName = j.Name
+		}
+	}
+
+	je, err := p.record(ctx, ir, jobID, jobName, j, now, callerFromRequest(req))
+	if err != nil {
+		err = fmt.Errorf("failed to import job execution: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	logger.WithField("job_id", jobID).WithField("status", je.RunStatus).Info("imported job execution")
+
+	return Response{
+		Body: jobExecRespJSON(nil, []pkg.JobExecution{je}, nil, p.logger),
+		Code: http.StatusCreated,
+	}
+}
+
+// record saves the execution record of the import request.
+func (p *ImportExecutionProcessor) record(ctx context.Context, ir importExecutionRequest, jobID, jobName string, j job, now time.Time, c caller) (pkg.JobExecution, error) {
+	start, _ := time.Parse(pkg.ISOTimeFormat, ir.RunDate)
+	hosts := make([]pkg.TargetedHost, len(ir.Hosts))
+	for i, h := range ir.Hosts {
+		hosts[i] = h.targetedHost(ir.EndDate)
+	}
+	hosts = p.outputPolicy.apply(ctx, p.strgc, jobID, ir.ExecutionID, sortedHosts(hosts), p.logger)
+
+	je := pkg.JobExecution{
+		EndDate:       ir.EndDate,
+		ExecutionID:   ir.ExecutionID,
+		ID:            jobID,
+		ImportedFrom:  ir.Source,
+		JobID:         jobID,
+		JobName:       jobName,
+		NumHosts:      len(hosts),
+		OwnerID:       j.UserID,
+		OwnerName:     j.UserName,
+		RunDate:       ir.RunDate,
+		RunStatus:     ir.Status,
+		StatusReason:  ir.StatusReason,
+		TargetedHosts: hosts,
+	}
+	je = flagPlatformMismatches(je, j.targetPlatforms())
+	je = applyHostResults(je)
+	d, secs, err := computeJobDuration(je.RunDate, je.EndDate, je.RunStatus, now)
+	if err != nil {
+		return pkg.JobExecution{}, fmt.Errorf("failed to compute job duration: %s", err)
+	}
+	je.Duration, je.DurationSeconds = d, secs
+	je = evaluateSLA(je, j.SLA)
+	importer := c.Name
+	if importer == "" {
+		importer = c.ID
+	}
+	detail := fmt.Sprintf("imported from %s", ir.Source)
+	if importer != "" {
+		detail += " by " + importer
+	}
+	je.RecordStatus("", now.Format(pkg.ISOTimeFormat), detail)
+
+	data, err := json.Marshal(je)
+	if err != nil {
+		return pkg.JobExecution{}, fmt.Errorf("failed to serialize job execution record: %s", err)
+	}
+	key := fmt.Sprintf("%d_%s", start.UnixNano(), ir.ExecutionID)
+	if err = putObject(ctx, p.strgc, jobExecutionCollection, key, data, ""); err != nil {
+		return pkg.JobExecution{}, err
+	}
+	return je, nil
+}
+
+func (p *ImportExecutionProcessor) errResp(err error) Response {
+	return errorResponse(err, p.logger)
+}
+
+// normalize trims the fields of the request and normalizes its statuses, platforms and defaults.
+func (ir importExecutionRequest) normalize() importExecutionRequest {
+	ir.EndDate = strings.TrimSpace(ir.EndDate)
+	ir.ExecutionID = strings.TrimSpace(ir.ExecutionID)
+	ir.JobName = strings.TrimSpace(ir.JobName)
+	ir.RunDate = strings.TrimSpace(ir.RunDate)
+	ir.Source = strings.TrimSpace(ir.Source)
+	ir.StatusReason = strings.TrimSpace(ir.StatusReason)
+	if ir.Source == "" {
+		ir.Source = defaultImportSource
+	}
+	if ir.EndDate == "" {
+		ir.EndDate = ir.RunDate
+	}
+	if s := strings.TrimSpace(ir.Status); s == "" {
+		ir.Status = pkg.StatusCompleted
+	} else if n := pkg.NormalizeJobStatus(s); n != "" {
+		ir.Status = n
+	}
+	for i, h := range ir.Hosts {
+		h.DeviceID = strings.TrimSpace(h.DeviceID)
+		h.HostName = strings.TrimSpace(h.HostName)
+		if n := pkg.NormalizeJobStatus(h.Status); n != "" {
+			h.Status = n
+		}
+		if n := pkg.NormalizePlatform(h.Platform); n != "" {
+			h.Platform = n
+		}
+		ir.Hosts[i] = h
+	}
+	return ir
+}
+
+// validate checks the normalized request.
+func (ir importExecutionRequest) validate() error {
+	finished := validate.Check(pkg.IsFinished, "must be the status of a finished execution")
+	errs := []error{validate.Fields(
+		validate.Field{Name: "job_name", Value: ir.JobName, Rules: []validate.Rule{validate.Required()}},
+		validate.Field{Name: "run_date", Value: ir.RunDate, Rules: []validate.Rule{validate.Required(), isoTimeRule}},
+		validate.Field{Name: "end_date", Value: ir.EndDate, Rules: []validate.Rule{isoTimeRule}},
+		validate.Field{Name: "status", Value: ir.Status, Rules: []validate.Rule{finished}},
+	)}
+	if ir.EndDate < ir.RunDate {
+		errs = append(errs, validate.Errors{{Field: "end_date", Message: "must not be before run_date"}})
+	}
+	if len(ir.Hosts) > maxExtractedHosts {
+		errs = append(errs, validate.Errors{{Field: "hosts", Message: fmt.Sprintf("must have at most %d hosts", maxExtractedHosts)}})
+	}
+	hostStatus := validate.Enum(pkg.StatusCompleted, pkg.StatusFailed, pkg.StatusSkipped)
+	for i, h := range ir.Hosts {
+		err := validate.Fields(
+			validate.Field{Name: "host_name", Value: h.HostName, Rules: []validate.Rule{validate.Required()}},
+			validate.Field{Name: "status", Value: h.Status, Rules: []validate.Rule{validate.Required(), hostStatus}},
+			validate.Field{Name: "start_time", Value: h.StartTime, Rules: []validate.Rule{isoTimeRule}},
+			validate.Field{Name: "end_time", Value: h.EndTime, Rules: []validate.Rule{isoTimeRule}},
+		)
+		errs = append(errs, validate.Nest(fmt.Sprintf("hosts[%d]", i), err))
+	}
+	return validate.Join(errs...)
+}
+
+// targetedHost returns the result of the imported host, ending at end unless it has an end time of its own.
+func (h importedHost) targetedHost(end string) pkg.TargetedHost {
+	th := pkg.TargetedHost{
+		DeviceID:   h.DeviceID,
+		EndTime:    h.EndTime,
+		Error:      h.Error,
+		ExitCode:   h.ExitCode,
+		HostName:   h.HostName,
+		Platform:   h.Platform,
+		SkipReason: h.SkipReason,
+		StartTime:  h.StartTime,
+		Status:     h.Status,
+		Stderr:     h.Stderr,
+		Stdout:     h.Stdout,
+	}
+	if th.EndTime == "" {
+		th.EndTime = end
+	}
+	if th.Status == pkg.StatusFailed {
+		th.FailureReason = classifyFailure(h.Stderr, h.Error)
+	}
+	return th
+}
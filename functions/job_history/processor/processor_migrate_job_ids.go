@@ -0,0 +1,140 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/sirupsen/logrus"
+)
+
+// MigrateJobIDsProcessor adds the jobs created with hash IDs to the name index, so that they can be renamed once
+// Func_Jobs gives new jobs UUID IDs.  The jobs keep their hash ID, and with it their history.
+type MigrateJobIDsProcessor struct {
+	foldCase bool
+	logger   logrus.FieldLogger
+	strgc    storagec.StorageC
+}
+
+// NewMigrateJobIDsProcessor returns a new MigrateJobIDsProcessor instance.
+func NewMigrateJobIDsProcessor(strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *MigrateJobIDsProcessor)) *MigrateJobIDsProcessor {
+	p := &MigrateJobIDsProcessor{
+		logger: logger,
+		strgc:  strgc,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// WithMigrationJobNameCaseFolding makes job names which only differ by case the same name, see pkg.JobNameKey.
+func WithMigrationJobNameCaseFolding() func(p *MigrateJobIDsProcessor) {
+	return func(p *MigrateJobIDsProcessor) {
+		p.foldCase = true
+	}
+}
+
+// Process indexes every job missing from the name index under its current name.  Jobs whose name is indexed for
+// another job are reported as conflicts and left unindexed.  Running the migration again is harmless.
+func (p *MigrateJobIDsProcessor) Process(ctx context.Context, _ fdk.Request) Response {
+	filter, err := pkg.NewFQLQuery([]pkg.Filter{{Field: "created_at", Op: pkg.GTE, Value: "0"}})
+	if err != nil {
+		err = fmt.Errorf("error constructing FQL query: %s", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+	sr, err := p.strgc.SearchAll(ctx, storagec.SearchObjectsRequest{
+		Collection: jobCollection,
+		Filter:     filter,
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to search jobs: %w", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+
+	result := migrateJobIDsResult{Conflicts: make([]string, 0)}
+	errs := make([]fdk.APIError, 0)
+	for _, jobID := range sr.ObjectKeys {
+		result.Checked++
+		indexed, err := p.index(ctx, jobID)
+		switch {
+		case errors.Is(err, storagec.NotFound):
+			// the job was deleted concurrently
+		case errors.Is(err, ErrConflict):
+			p.logger.WithField("job_id", jobID).Warn(err)
+			result.Conflicts = append(result.Conflicts, jobID)
+		case err != nil:
+			err = fmt.Errorf("failed to index job %s: %w", jobID, err)
+			p.logger.Error(err)
+			errs = append(errs, apiError(err))
+		case indexed:
+			result.Indexed++
+		}
+	}
+	p.logger.WithField("checked", result.Checked).
+		WithField("indexed", result.Indexed).
+		WithField("conflicts", len(result.Conflicts)).
+		Info("migrated job IDs")
+
+	code := http.StatusOK
+	if len(errs) > 0 {
+		code = http.StatusMultiStatus
+	}
+	return Response{
+		Body: p.migrateJobIDsRespJSON([]migrateJobIDsResult{result}, errs),
+		Code: code,
+	}
+}
+
+// index adds a job to the name index, returning true if it was missing from it.
+func (p *MigrateJobIDsProcessor) index(ctx context.Context, jobID string) (bool, error) {
+	jobMap, _, err := fetchObject(ctx, p.strgc, jobCollection, jobID)
+	if err != nil {
+		return false, fmt.Errorf("could not fetch job record: %w", err)
+	}
+	name, _ := jobMap["name"].(string)
+	if name == "" {
+		return false, errors.New("job record has no name")
+	}
+
+	e, err := fetchJobName(ctx, p.strgc, name, p.foldCase)
+	switch {
+	case err == nil && e.JobID == jobID:
+		return false, nil
+	case err == nil:
+		return false, newError(ErrConflict, "job name %q is indexed for job %s", name, e.JobID)
+	case !errors.Is(err, storagec.NotFound):
+		return false, fmt.Errorf("failed to look up job name: %w", err)
+	}
+
+	if err = putJobName(ctx, p.strgc, jobNameEntry{JobID: jobID, Name: name}, p.foldCase); err != nil {
+		return false, fmt.Errorf("failed to save job name entry: %w", err)
+	}
+	return true, nil
+}
+
+func (p *MigrateJobIDsProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return p.migrateJobIDsRespJSON(nil, errs)
+	})
+}
+
+func (p *MigrateJobIDsProcessor) migrateJobIDsRespJSON(r []migrateJobIDsResult, e []fdk.APIError) []byte {
+	if r == nil {
+		r = make([]migrateJobIDsResult, 0)
+	}
+	resp := migrateJobIDsResponse{Errs: e, Resources: r}
+	rJSON, err := json.Marshal(resp)
+	if err != nil {
+		p.logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
@@ -0,0 +1,246 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/notifier"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/sirupsen/logrus"
+)
+
+// MissedRunsProcessor detects the scheduled runs of jobs which never produced a workflow event, e.g. because the
+// workflow of the job was disabled.  It is meant to be invoked on a schedule by a workflow.
+type MissedRunsProcessor struct {
+	logger   logrus.FieldLogger
+	notifier notifier.Notifier
+	strgc    storagec.StorageC
+	clock    pkg.Clock
+}
+
+// NewMissedRunsProcessor returns a new MissedRunsProcessor instance.
+func NewMissedRunsProcessor(strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *MissedRunsProcessor)) *MissedRunsProcessor {
+	p := &MissedRunsProcessor{
+		logger: logger,
+		strgc:  strgc,
+		clock:  pkg.SystemClock,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// WithMissedRunsNotifier notifies the notification targets of a job of its missed runs.  Only the targets
+// subscribed to skipped executions are notified.
+func WithMissedRunsNotifier(n notifier.Notifier) func(p *MissedRunsProcessor) {
+	return func(p *MissedRunsProcessor) {
+		p.notifier = n
+	}
+}
+
+// Process checks every active job whose next run is more than missedRunGrace in the past for an execution
+// started since.  For each job without one, a skipped execution with the missed_run skip reason is recorded in
+// place of the missed run and the next run of the job is advanced, so that each missed run is recorded once.  Runs
+// due during a blackout are not missed, only advanced past the blackout.
+func (p *MissedRunsProcessor) Process(ctx context.Context, _ fdk.Request) Response {
+	filter, err := pkg.NewFQLQuery([]pkg.Filter{{Field: "created_at", Op: pkg.GTE, Value: "0"}})
+	if err != nil {
+		err = fmt.Errorf("error constructing FQL query: %s", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+	sr, err := p.strgc.SearchAll(ctx, storagec.SearchObjectsRequest{
+		Collection: jobCollection,
+		Filter:     filter,
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to search jobs: %w", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+
+	result := missedRunsResult{Missed: make([]string, 0)}
+	errs := make([]fdk.APIError, 0)
+	for _, jobID := range sr.ObjectKeys {
+		result.Checked++
+		missed, err := p.check(ctx, jobID)
+		if errors.Is(err, storagec.VersionConflict) || errors.Is(err, storagec.NotFound) {
+			// the job was modified or deleted concurrently; the next run checks it again if necessary
+			continue
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to check job %s for missed runs: %w", jobID, err)
+			p.logger.Error(err)
+			errs = append(errs, apiError(err))
+			continue
+		}
+		if missed {
+			result.Missed = append(result.Missed, jobID)
+		}
+	}
+	p.logger.WithField("checked", result.Checked).
+		WithField("missed", len(result.Missed)).
+		Info("checked jobs for missed runs")
+
+	code := http.StatusOK
+	if len(errs) > 0 {
+		code = http.StatusMultiStatus
+	}
+	return Response{
+		Body: p.missedRunsRespJSON([]missedRunsResult{result}, errs),
+		Code: code,
+	}
+}
+
+// check records the missed run of a job if it has one, returning true if it did.
+func (p *MissedRunsProcessor) check(ctx context.Context, jobID string) (bool, error) {
+	jobMap, version, err := fetchObject(ctx, p.strgc, jobCollection, jobID)
+	if err != nil {
+		return false, fmt.Errorf("could not fetch job record: %w", err)
+	}
+	j, err := distillJob(jobMap)
+	if err != nil {
+		return false, fmt.Errorf("could not distill job record from dictionary: %s", err)
+	}
+	draft, _ := jobMap["draft"].(bool)
+	finished := j.TotalRecurrences > 0 && j.RunCount >= j.TotalRecurrences
+	now := p.clock.Now().UTC()
+	if j.Paused || j.Expired || draft || finished || j.NextRun.IsZero() || j.NextRun.Add(missedRunGrace).After(now) {
+		return false, nil
+	}
+
+	ran, err := p.ranSince(ctx, jobID, j.NextRun)
+	if err != nil {
+		return false, err
+	}
+	if ran {
+		return false, nil
+	}
+
+	blackouts := loadBlackouts(ctx, p.strgc, p.logger)
+	if _, ok := blackouts.covering(j.NextRun); ok {
+		// the run was not missed but skipped, the blackout having been added after the next run was computed
+		return false, p.advanceNextRun(ctx, jobID, j, jobMap, version, blackouts, now)
+	}
+
+	name, _ := jobMap["name"].(string)
+	marker, err := p.recordMissedRun(ctx, jobID, name, j)
+	if err != nil {
+		return false, err
+	}
+	p.logger.WithField("job_id", jobID).
+		WithField("next_run", j.NextRun).
+		Warn("scheduled run of job produced no workflow event - recorded as missed")
+
+	if err = p.advanceNextRun(ctx, jobID, j, jobMap, version, blackouts, now); err != nil {
+		return true, err
+	}
+
+	if p.notifier != nil && len(j.NotificationTargets) > 0 {
+		if err := p.notifier.Notify(ctx, j.NotificationTargets, notifier.NewSummary(marker)); err != nil {
+			p.logger.WithField("job_id", jobID).Errorf("failed to deliver notifications: %s", err)
+		}
+	}
+	return true, nil
+}
+
+// advanceNextRun saves the first run of a recurring job after now which falls in no blackout as its next run.
+func (p *MissedRunsProcessor) advanceNextRun(ctx context.Context, jobID string, j job, jobMap map[string]any, version string, blackouts blackoutCalendar, now time.Time) error {
+	if j.Schedule == nil || j.Schedule.TimeCycle == "" {
+		return nil
+	}
+	s, err := j.schedule()
+	if err != nil {
+		return fmt.Errorf("failed to parse job cron expression: %s", err)
+	}
+	jobMap["next_run"] = blackouts.next(s, now).UTC()
+	b, err := json.Marshal(jobMap)
+	if err != nil {
+		return fmt.Errorf("failed to serialize job record: %s", err)
+	}
+	if err = putObject(ctx, p.strgc, jobCollection, jobID, b, version); err != nil {
+		return fmt.Errorf("failed to save job record: %w", err)
+	}
+	return nil
+}
+
+// ranSince returns true if the job has an execution which started at most missedRunGrace before t.
+func (p *MissedRunsProcessor) ranSince(ctx context.Context, jobID string, t time.Time) (bool, error) {
+	filter, err := pkg.NewFQLQuery([]pkg.Filter{
+		{Field: "id", Op: pkg.EQ, Value: jobID},
+		{Field: "run_date", Op: pkg.GTE, Value: t.Add(-missedRunGrace).Format(pkg.ISOTimeFormat)},
+	})
+	if err != nil {
+		return false, fmt.Errorf("error constructing FQL query: %s", err)
+	}
+	n, err := p.strgc.Count(ctx, storagec.SearchObjectsRequest{
+		Collection: jobExecutionCollection,
+		Filter:     filter,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to count job executions: %w", err)
+	}
+	return n > 0, nil
+}
+
+// recordMissedRun saves the skipped execution marking the missed next run of a job, unless it was already
+// recorded, and returns it.
+func (p *MissedRunsProcessor) recordMissedRun(ctx context.Context, jobID, jobName string, j job) (pkg.JobExecution, error) {
+	runDate := j.NextRun.UTC().Format(pkg.ISOTimeFormat)
+	marker := pkg.JobExecution{
+		EndDate:       runDate,
+		ExecutionID:   fmt.Sprintf("missed_%s_%d", jobID, j.NextRun.Unix()),
+		ID:            jobID,
+		JobID:         jobID,
+		JobName:       jobName,
+		OwnerID:       j.UserID,
+		OwnerName:     j.UserName,
+		RunDate:       runDate,
+		RunStatus:     pkg.StatusSkipped,
+		SkipReason:    pkg.SkipReasonMissedRun,
+		TargetedHosts: make([]pkg.TargetedHost, 0),
+	}
+	key, err := locateJobExecution(ctx, p.strgc, marker.ExecutionID)
+	if err != nil {
+		return pkg.JobExecution{}, fmt.Errorf("failed to locate job execution record: %w", err)
+	}
+	if key != "" {
+		return marker, nil
+	}
+
+	data, err := json.Marshal(marker)
+	if err != nil {
+		return pkg.JobExecution{}, fmt.Errorf("failed to serialize job execution record: %s", err)
+	}
+	key = fmt.Sprintf("%d_%s", j.NextRun.UnixNano(), marker.ExecutionID)
+	if err = putObject(ctx, p.strgc, jobExecutionCollection, key, data, ""); err != nil {
+		return pkg.JobExecution{}, fmt.Errorf("failed to save job execution record: %w", err)
+	}
+	return marker, nil
+}
+
+func (p *MissedRunsProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return p.missedRunsRespJSON(nil, errs)
+	})
+}
+
+func (p *MissedRunsProcessor) missedRunsRespJSON(r []missedRunsResult, e []fdk.APIError) []byte {
+	if r == nil {
+		r = make([]missedRunsResult, 0)
+	}
+	resp := missedRunsResponse{Errs: e, Resources: r}
+	rJSON, err := json.Marshal(resp)
+	if err != nil {
+		p.logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
@@ -0,0 +1,156 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/validate"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/workflowc"
+	"github.com/sirupsen/logrus"
+)
+
+// PauseProcessor pauses or resumes a job.  While a job is paused its executions are recorded as skipped and
+// its run statistics are not advanced.
+type PauseProcessor struct {
+	logger logrus.FieldLogger
+	paused bool
+	strgc  storagec.StorageC
+	wfc    workflowc.WorkflowC
+	clock  pkg.Clock
+}
+
+// NewPauseProcessor returns a new PauseProcessor instance which pauses jobs if paused is true and resumes
+// them otherwise.
+func NewPauseProcessor(paused bool, strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *PauseProcessor)) *PauseProcessor {
+	p := &PauseProcessor{
+		logger: logger,
+		paused: paused,
+		strgc:  strgc,
+		clock:  pkg.SystemClock,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// WithPauseWorkflowClient disables the schedule workflow of paused jobs, and enables it again when they are
+// resumed.
+func WithPauseWorkflowClient(wfc workflowc.WorkflowC) func(p *PauseProcessor) {
+	return func(p *PauseProcessor) {
+		p.wfc = wfc
+	}
+}
+
+// Process sets the paused state of the requested job.  Resuming a job recomputes its next run from the
+// current time, as it was not advanced while the job was paused.
+func (p *PauseProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	var pr pauseRequest
+	if err := json.Unmarshal(req.Body, &pr); err != nil {
+		return p.errResp(newError(ErrBadRequest, "failed to parse request body: %s", err))
+	}
+	if err := validate.Fields(validate.Field{Name: "job_id", Value: pr.JobID, Rules: []validate.Rule{validate.Required()}}); err != nil {
+		return p.errResp(err)
+	}
+	jobID := strings.TrimSpace(pr.JobID)
+	logger := p.logger.WithField("job_id", jobID)
+
+	jobMap, version, err := fetchObject(ctx, p.strgc, jobCollection, jobID)
+	if errors.Is(err, storagec.NotFound) {
+		return p.errResp(newError(ErrNotFound, "not found"))
+	}
+	if err != nil {
+		err = fmt.Errorf("could not fetch job record: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	j, err := distillJob(jobMap)
+	if err != nil {
+		err = fmt.Errorf("could not distill job record from dictionary: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+
+	if j.Paused != p.paused {
+		j, err = p.setPaused(ctx, jobID, j, jobMap, version)
+		if errors.Is(err, storagec.VersionConflict) {
+			return p.errResp(newError(ErrConflict, "job was modified concurrently, please retry"))
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to save job record: %w", err)
+			logger.Error(err)
+			return p.errResp(err)
+		}
+		logger.WithField("paused", p.paused).Info("updated job paused state")
+		p.toggleWorkflow(ctx, j, logger)
+	}
+
+	return Response{
+		Body: p.jobStateRespJSON([]jobState{{ID: jobID, NextRun: j.NextRun, Paused: j.Paused}}, nil),
+		Code: http.StatusOK,
+	}
+}
+
+// toggleWorkflow enables or disables the schedule workflow of the job to match its state.  Failures are logged
+// rather than failing the request, as executions of paused jobs are skipped regardless, and the drift is fixed by
+// the ReconcileWorkflowsProcessor.
+func (p *PauseProcessor) toggleWorkflow(ctx context.Context, j job, logger logrus.FieldLogger) {
+	if p.wfc == nil || j.Workflows == nil || j.Workflows.ScheduleWorkflow == "" {
+		return
+	}
+	var err error
+	if j.scheduled() {
+		err = p.wfc.Enable(ctx, j.Workflows.ScheduleWorkflow)
+	} else {
+		err = p.wfc.Disable(ctx, j.Workflows.ScheduleWorkflow)
+	}
+	if err != nil {
+		logger.Errorf("failed to update the schedule workflow of the job: %s", err)
+	}
+}
+
+func (p *PauseProcessor) setPaused(ctx context.Context, jobID string, j job, jobMap map[string]any, version string) (job, error) {
+	j.Paused = p.paused
+	jobMap["paused"] = p.paused
+
+	if !p.paused && j.Schedule != nil && j.Schedule.TimeCycle != "" {
+		s, err := j.schedule()
+		if err != nil {
+			return j, fmt.Errorf("failed to parse job cron expression: %s", err)
+		}
+		j.NextRun = loadBlackouts(ctx, p.strgc, p.logger).next(s, p.clock.Now()).UTC()
+		jobMap["next_run"] = j.NextRun
+	}
+
+	b, err := json.Marshal(jobMap)
+	if err != nil {
+		return j, fmt.Errorf("failed to serialize job record: %s", err)
+	}
+	return j, putObject(ctx, p.strgc, jobCollection, jobID, b, version)
+}
+
+func (p *PauseProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return p.jobStateRespJSON(nil, errs)
+	})
+}
+
+func (p *PauseProcessor) jobStateRespJSON(r []jobState, e []fdk.APIError) []byte {
+	if r == nil {
+		r = make([]jobState, 0)
+	}
+	resp := jobStateResponse{Errs: e, Resources: r}
+	rJSON, err := json.Marshal(resp)
+	if err != nil {
+		p.logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
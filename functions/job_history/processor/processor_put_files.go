@@ -0,0 +1,451 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/filec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/validate"
+	"github.com/sirupsen/logrus"
+)
+
+// putFileNameRe matches the names of put files, which are also their object keys.
+var putFileNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,99}$`)
+
+// versionedFileNameRe matches the names RTR stores the versions of put files under, see versionedFileName.
+var versionedFileNameRe = regexp.MustCompile(`^(.+)_v([0-9]+)(\.[^.]*)?$`)
+
+// UploadPutFileProcessor uploads the RTR put files used by install jobs.  Each upload of a file is a new version,
+// stored by RTR under a versioned name, so that a job keeps installing the version it was defined with.  The
+// versions of a file are described by a record in their own collection, keyed by the name of the file.
+type UploadPutFileProcessor struct {
+	filec  filec.FileC
+	logger logrus.FieldLogger
+	strgc  storagec.StorageC
+	clock  pkg.Clock
+}
+
+// NewUploadPutFileProcessor returns a new UploadPutFileProcessor instance.
+func NewUploadPutFileProcessor(strgc storagec.StorageC, fc filec.FileC, logger logrus.FieldLogger, opts ...func(p *UploadPutFileProcessor)) *UploadPutFileProcessor {
+	p := &UploadPutFileProcessor{
+		filec:  fc,
+		logger: logger,
+		strgc:  strgc,
+		clock:  pkg.SystemClock,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// Process uploads the base64 encoded content of the request body as the next version of the put file with its
+// name, along with its description and notes.  Content identical to the latest version is rejected.  Files
+// larger than maxPutFileSize are rejected.
+func (p *UploadPutFileProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	var ur uploadPutFileRequest
+	if err := json.Unmarshal(req.Body, &ur); err != nil {
+		return p.errResp(newError(ErrBadRequest, "failed to parse request body: %s", err))
+	}
+	ur.Name = strings.TrimSpace(ur.Name)
+	err := validate.Fields(
+		validate.Field{Name: "name", Value: ur.Name, Rules: []validate.Rule{validate.Required(), validate.Format(putFileNameRe, "a file name of letters, digits, dots, dashes and underscores")}},
+		validate.Field{Name: "content", Value: ur.Content, Rules: []validate.Rule{validate.Required(), putFileContentRule}},
+	)
+	if err != nil {
+		return p.errResp(err)
+	}
+	content, _ := base64.StdEncoding.DecodeString(ur.Content)
+	logger := p.logger.WithField("put_file", ur.Name)
+
+	pf, version, err := fetchPutFile(ctx, p.strgc, ur.Name)
+	if errors.Is(err, storagec.NotFound) {
+		pf, err = putFile{Name: ur.Name, Versions: make([]putFileVersion, 0)}, nil
+	}
+	if err != nil {
+		err = fmt.Errorf("could not fetch put file record: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+	if latest := pf.latest(); latest != nil && latest.SHA256 == hash {
+		return p.errResp(newError(ErrConflict, "content is identical to version %d", latest.Version))
+	}
+
+	now := p.clock.Now().UTC().Format(pkg.ISOTimeFormat)
+	v := putFileVersion{
+		FileName:   versionedFileName(ur.Name, pf.LatestVersion+1),
+		Notes:      ur.Notes,
+		SHA256:     hash,
+		Size:       len(content),
+		UploadedAt: now,
+		UploadedBy: callerFromRequest(req).Name,
+		Version:    pf.LatestVersion + 1,
+	}
+	uploaded, err := p.filec.Upload(ctx, filec.UploadRequest{
+		Comment:     ur.Notes,
+		Content:     bytes.NewReader(content),
+		Description: ur.Description,
+		Name:        v.FileName,
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to upload put file: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	v.FileID = uploaded.ID
+
+	if pf.CreatedAt == "" {
+		pf.CreatedAt = now
+	}
+	pf.Description = ur.Description
+	pf.LatestVersion = v.Version
+	pf.UpdatedAt = now
+	pf.Versions = append(pf.Versions, v)
+	data, err := json.Marshal(pf)
+	if err == nil {
+		err = putObject(ctx, p.strgc, putFileCollection, pf.Name, data, version)
+	}
+	if err != nil {
+		// the uploaded version is not recorded, so it is removed to free its name
+		if derr := p.filec.Delete(ctx, v.FileID); derr != nil {
+			logger.Warnf("failed to delete unrecorded put file %s: %s", v.FileName, derr)
+		}
+	}
+	if errors.Is(err, storagec.VersionConflict) {
+		return p.errResp(newError(ErrConflict, "put file was modified concurrently, please retry"))
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to save put file record: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	logger.WithField("version", v.Version).WithField("size", v.Size).Info("uploaded put file")
+
+	return Response{
+		Body: putFileRespJSON([]putFile{pf}, nil, p.logger),
+		Code: http.StatusCreated,
+	}
+}
+
+func (p *UploadPutFileProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return putFileRespJSON(nil, errs, p.logger)
+	})
+}
+
+// PutFilesProcessor returns the records of put files and their versions.
+type PutFilesProcessor struct {
+	logger logrus.FieldLogger
+	strgc  storagec.StorageC
+}
+
+// NewPutFilesProcessor returns a new PutFilesProcessor instance.
+func NewPutFilesProcessor(strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *PutFilesProcessor)) *PutFilesProcessor {
+	p := &PutFilesProcessor{
+		logger: logger,
+		strgc:  strgc,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// Process returns the record of the put file identified by the name query parameter.  Without a name, the
+// records of every put file are returned instead, ordered by name.
+func (p *PutFilesProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	if name := queryParam(req.Params.Query, "name"); name != "" {
+		pf, _, err := fetchPutFile(ctx, p.strgc, name)
+		if errors.Is(err, storagec.NotFound) {
+			return p.errResp(newError(ErrNotFound, "not found"))
+		}
+		if err != nil {
+			err = fmt.Errorf("could not fetch put file record: %w", err)
+			p.logger.WithField("put_file", name).Error(err)
+			return p.errResp(err)
+		}
+		return Response{
+			Body: putFileRespJSON([]putFile{pf}, nil, p.logger),
+			Code: http.StatusOK,
+		}
+	}
+
+	filter, err := pkg.NewFQLQuery([]pkg.Filter{{Field: "created_at", Op: pkg.GTE, Value: "0"}})
+	if err != nil {
+		err = fmt.Errorf("error constructing FQL query: %s", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+	sr, err := p.strgc.SearchAll(ctx, storagec.SearchObjectsRequest{Collection: putFileCollection, Filter: filter})
+	if err != nil {
+		err = fmt.Errorf("failed to search for put files: %w", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+	resp := p.strgc.BulkFetch(ctx, storagec.BulkFetchObjectsRequest{
+		Collection: putFileCollection,
+		ObjectKeys: sr.ObjectKeys,
+	})
+	errs := make([]fdk.APIError, 0)
+	for k, err := range resp.Errs {
+		if errors.Is(err, storagec.NotFound) {
+			continue
+		}
+		err = fmt.Errorf("failed to fetch put file %s: %w", k, err)
+		p.logger.Error(err)
+		errs = append(errs, apiError(err))
+	}
+	files := make([]putFile, 0, len(resp.Objects))
+	for k, data := range resp.Objects {
+		var pf putFile
+		if err = json.Unmarshal(data, &pf); err != nil {
+			err = fmt.Errorf("failed to deserialize put file %s: %s", k, err)
+			p.logger.Error(err)
+			errs = append(errs, apiError(err))
+			continue
+		}
+		files = append(files, pf)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+
+	code := http.StatusOK
+	if len(errs) > 0 {
+		code = http.StatusMultiStatus
+	}
+	return Response{
+		Body: putFileRespJSON(files, errs, p.logger),
+		Code: code,
+	}
+}
+
+func (p *PutFilesProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return putFileRespJSON(nil, errs, p.logger)
+	})
+}
+
+// DeletePutFileProcessor deletes versions of put files from RTR and from their record.
+type DeletePutFileProcessor struct {
+	filec  filec.FileC
+	logger logrus.FieldLogger
+	strgc  storagec.StorageC
+}
+
+// NewDeletePutFileProcessor returns a new DeletePutFileProcessor instance.
+func NewDeletePutFileProcessor(strgc storagec.StorageC, fc filec.FileC, logger logrus.FieldLogger, opts ...func(p *DeletePutFileProcessor)) *DeletePutFileProcessor {
+	p := &DeletePutFileProcessor{
+		filec:  fc,
+		logger: logger,
+		strgc:  strgc,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// Process deletes the version query parameter of the put file identified by the name query parameter, or every
+// version of it without a version.  Versions which jobs still install are not deleted.  The record of the file is
+// deleted along with its last version.
+func (p *DeletePutFileProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	q := req.Params.Query
+	name := queryParam(q, "name")
+	err := validate.Fields(
+		validate.Field{Name: "name", Value: name, Rules: []validate.Rule{validate.Required()}},
+		validate.Field{Name: "version", Value: queryParam(q, "version"), Rules: []validate.Rule{validate.Int(), validate.AtLeast(1)}},
+	)
+	if err != nil {
+		return p.errResp(err)
+	}
+	logger := p.logger.WithField("put_file", name)
+
+	pf, version, err := fetchPutFile(ctx, p.strgc, name)
+	if errors.Is(err, storagec.NotFound) {
+		return p.errResp(newError(ErrNotFound, "not found"))
+	}
+	if err != nil {
+		err = fmt.Errorf("could not fetch put file record: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	deleted := pf.Versions
+	if s := queryParam(q, "version"); s != "" {
+		n, _ := strconv.Atoi(s)
+		deleted = nil
+		for _, v := range pf.Versions {
+			if v.Version == n {
+				deleted = append(deleted, v)
+			}
+		}
+		if len(deleted) == 0 {
+			return p.errResp(newError(ErrNotFound, "put file %s has no version %d", name, n))
+		}
+	}
+
+	for _, v := range deleted {
+		filter, err := pkg.NewFQLQuery([]pkg.Filter{{Field: "file_name", Op: pkg.EQ, Value: v.FileName}})
+		if err != nil {
+			err = fmt.Errorf("error constructing FQL query: %s", err)
+			logger.Error(err)
+			return p.errResp(err)
+		}
+		n, err := p.strgc.Count(ctx, storagec.SearchObjectsRequest{Collection: jobCollection, Filter: filter})
+		if err != nil {
+			err = fmt.Errorf("failed to count the jobs installing the put file: %w", err)
+			logger.Error(err)
+			return p.errResp(err)
+		}
+		if n > 0 {
+			return p.errResp(newError(ErrConflict, "version %d of put file %s is installed by %d jobs", v.Version, name, n))
+		}
+	}
+
+	errs := make([]fdk.APIError, 0)
+	removed := make(map[int]bool, len(deleted))
+	for _, v := range deleted {
+		if err = p.filec.Delete(ctx, v.FileID); err != nil && !errors.Is(err, filec.NotFound) {
+			err = fmt.Errorf("failed to delete version %d of put file: %w", v.Version, err)
+			logger.Error(err)
+			errs = append(errs, apiError(err))
+			continue
+		}
+		removed[v.Version] = true
+	}
+	kept := make([]putFileVersion, 0, len(pf.Versions))
+	for _, v := range pf.Versions {
+		if !removed[v.Version] {
+			kept = append(kept, v)
+		}
+	}
+	pf.Versions = kept
+
+	if len(pf.Versions) == 0 {
+		err = p.strgc.DeleteObject(ctx, storagec.DeleteObjectRequest{Collection: putFileCollection, ObjectKey: name})
+		if errors.Is(err, storagec.NotFound) {
+			err = nil
+		}
+	} else {
+		var data []byte
+		data, err = json.Marshal(pf)
+		if err == nil {
+			err = putObject(ctx, p.strgc, putFileCollection, name, data, version)
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to save put file record: %w", err)
+		logger.Error(err)
+		errs = append(errs, apiError(err))
+	}
+	logger.WithField("versions", len(removed)).Info("deleted put file versions")
+
+	code := http.StatusOK
+	if len(errs) > 0 {
+		code = http.StatusMultiStatus
+	}
+	return Response{
+		Body: putFileRespJSON([]putFile{pf}, errs, p.logger),
+		Code: code,
+	}
+}
+
+func (p *DeletePutFileProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return putFileRespJSON(nil, errs, p.logger)
+	})
+}
+
+// fetchPutFile returns the record of the put file with the name, along with its version.
+func fetchPutFile(ctx context.Context, strgc storagec.StorageC, name string) (putFile, string, error) {
+	m, version, err := fetchObject(ctx, strgc, putFileCollection, name)
+	if err != nil {
+		return putFile{}, "", err
+	}
+	var pf putFile
+	b, err := json.Marshal(m)
+	if err == nil {
+		err = json.Unmarshal(b, &pf)
+	}
+	if err != nil {
+		return putFile{}, "", fmt.Errorf("failed to deserialize put file record: %w: %s", errMalformedRecord, err)
+	}
+	return pf, version, nil
+}
+
+// versionedFileName returns the name RTR stores a version of a put file under, e.g. setup_v2.msi, keeping the
+// extension of the file so that it can still be run once put on hosts.
+func versionedFileName(name string, version int) string {
+	ext := path.Ext(name)
+	return fmt.Sprintf("%s_v%d%s", strings.TrimSuffix(name, ext), version, ext)
+}
+
+// expectedFileHash returns the SHA-256 hash of the version of the put file installed by the job, or a blank string
+// if the job installs no file or a file which was not uploaded as a version of a put file.
+func expectedFileHash(ctx context.Context, strgc storagec.StorageC, j job) (string, error) {
+	if j.actionType() != actionInstallSoftware || j.Action.FileName == "" {
+		return "", nil
+	}
+	m := versionedFileNameRe.FindStringSubmatch(j.Action.FileName)
+	if m == nil {
+		return "", nil
+	}
+	pf, _, err := fetchPutFile(ctx, strgc, m[1]+m[3])
+	if errors.Is(err, storagec.NotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not fetch put file record: %w", err)
+	}
+	for _, v := range pf.Versions {
+		if v.FileName == j.Action.FileName {
+			return v.SHA256, nil
+		}
+	}
+	return "", nil
+}
+
+func putFileRespJSON(r []putFile, e []fdk.APIError, logger logrus.FieldLogger) []byte {
+	if r == nil {
+		r = make([]putFile, 0)
+	}
+	resp := putFileResponse{Errs: e, Resources: r}
+	rJSON, err := json.Marshal(resp)
+	if err != nil {
+		logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
+
+// putFileContentRule rejects content which is not base64 encoded, or larger than maxPutFileSize once decoded.
+var putFileContentRule validate.Rule = func(v string) string {
+	if base64.StdEncoding.DecodedLen(len(v)) > maxPutFileSize+2 {
+		return fmt.Sprintf("must be at most %d bytes", maxPutFileSize)
+	}
+	b, err := base64.StdEncoding.DecodeString(v)
+	if err != nil {
+		return "must be base64 encoded"
+	}
+	if len(b) > maxPutFileSize {
+		return fmt.Sprintf("must be at most %d bytes", maxPutFileSize)
+	}
+	return ""
+}
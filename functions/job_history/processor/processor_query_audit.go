@@ -0,0 +1,169 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/auditc"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/validate"
+	"github.com/sirupsen/logrus"
+)
+
+// QueryAuditProcessor pages through the audit trail, most recent records first.
+type QueryAuditProcessor struct {
+	logger logrus.FieldLogger
+	strgc  storagec.StorageC
+	clock  pkg.Clock
+}
+
+// NewQueryAuditProcessor returns a new QueryAuditProcessor instance.
+func NewQueryAuditProcessor(strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *QueryAuditProcessor)) *QueryAuditProcessor {
+	p := &QueryAuditProcessor{
+		logger: logger,
+		strgc:  strgc,
+		clock:  pkg.SystemClock,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// Process returns a page of audit records matching the filters in the query parameters.
+//
+// Supported query parameters are collection, object_key, actor, action, from, to, limit and cursor.
+// The next cursor is returned in meta.next.
+func (p *QueryAuditProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	queryParams := req.Params.Query
+	if len(queryParams) == 0 {
+		queryParams = make(url.Values)
+	}
+	qr, err := buildQueryAuditRequest(queryParams)
+	if err != nil {
+		return p.errResp(newError(ErrBadRequest, "bad arguments in param.query: %w", err))
+	}
+
+	filter, err := queryAuditFilter(qr)
+	if err != nil {
+		err = fmt.Errorf("error constructing FQL query: %w", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+	sortBy, err := pkg.NewFQLSort("timestamp", pkg.Desc)
+	if err != nil {
+		err = fmt.Errorf("error constructing FQL sort: %w", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+
+	searchResp, err := p.strgc.SearchAndFetch(ctx, storagec.SearchObjectsRequest{
+		Collection: auditCollection,
+		Filter:     filter,
+		Limit:      qr.Limit,
+		Offset:     qr.Cursor.Offset,
+		Sort:       sortBy,
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to query audit trail: %w", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+
+	records := make([]auditc.Record, 0, len(searchResp.Objects))
+	for _, o := range searchResp.Objects {
+		var r auditc.Record
+		if err = json.Unmarshal(o.Data, &r); err != nil {
+			err = fmt.Errorf("failed to decode audit record %s: %w", o.Key, err)
+			p.logger.Error(err)
+			return p.errResp(err)
+		}
+		records = append(records, r)
+	}
+
+	next := ""
+	if pos := qr.Cursor.Offset + len(records); len(records) > 0 && pos < searchResp.Total {
+		next = encodeQueryCursor(queryCursor{Offset: pos})
+	}
+	return Response{
+		Body: p.auditRespJSON(paging{
+			Count: len(records),
+			Limit: qr.Limit,
+			Next:  next,
+			Total: searchResp.Total,
+		}, records, nil),
+		Code: http.StatusOK,
+	}
+}
+
+func buildQueryAuditRequest(q url.Values) (queryAuditRequest, error) {
+	err := validate.Fields(append([]validate.Field{
+		{Name: "action", Value: strings.ToLower(queryParam(q, "action")), Rules: []validate.Rule{validate.Enum(auditc.ActionCreate, auditc.ActionDelete, auditc.ActionUpdate)}},
+		{Name: "from", Value: queryParam(q, "from"), Rules: []validate.Rule{isoTimeRule}},
+		{Name: "to", Value: queryParam(q, "to"), Rules: []validate.Rule{isoTimeRule}},
+	}, pagingFields(q)...)...)
+	if err != nil {
+		return queryAuditRequest{}, err
+	}
+
+	qr := queryAuditRequest{
+		Action:     strings.ToLower(queryParam(q, "action")),
+		Actor:      queryParam(q, "actor"),
+		Collection: queryParam(q, "collection"),
+		From:       time.Unix(0, 0).UTC().Format(pkg.ISOTimeFormat),
+		ObjectKey:  queryParam(q, "object_key"),
+		To:         queryParam(q, "to"),
+	}
+	if s := queryParam(q, "from"); s != "" {
+		qr.From = s
+	}
+	qr.Limit, qr.Cursor = parsePaging(q, defaultQueryLimit, maxQueryLimit)
+	return qr, nil
+}
+
+func queryAuditFilter(qr queryAuditRequest) (string, error) {
+	filters := []pkg.Filter{{Field: "timestamp", Op: pkg.GTE, Value: qr.From}}
+	if qr.To != "" {
+		filters = append(filters, pkg.Filter{Field: "timestamp", Op: pkg.LTE, Value: qr.To})
+	}
+	for _, f := range []struct {
+		field string
+		value string
+	}{
+		{"action", qr.Action},
+		{"actor", qr.Actor},
+		{"collection", qr.Collection},
+		{"object_key", qr.ObjectKey},
+	} {
+		if f.value != "" {
+			filters = append(filters, pkg.Filter{Field: f.field, Op: pkg.EQ, Value: f.value})
+		}
+	}
+	return pkg.NewFQLQuery(filters)
+}
+
+func (p *QueryAuditProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return p.auditRespJSON(paging{}, nil, errs)
+	})
+}
+
+func (p *QueryAuditProcessor) auditRespJSON(page paging, r []auditc.Record, e []fdk.APIError) []byte {
+	if r == nil {
+		r = make([]auditc.Record, 0)
+	}
+	resp := auditResponse{Errs: e, Meta: page, Resources: r}
+	rJSON, err := json.Marshal(resp)
+	if err != nil {
+		p.logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
@@ -0,0 +1,325 @@
+package processor
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/validate"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultQueryLimit = 20
+	maxQueryLimit     = 500
+	// maxQueryScanPages bounds the number of storage pages scanned for a single page of host-filtered results.
+	maxQueryScanPages = 10
+	// maxStreamRecords is the maximum number of job executions streamed by a single request.
+	maxStreamRecords = 10000
+	// maxStreamScanPages bounds the number of storage pages scanned for a single streamed response.
+	maxStreamScanPages = 50
+)
+
+const (
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+)
+
+// QueryExecutionsProcessor searches the job execution history with filtering, sorting and cursor pagination.
+type QueryExecutionsProcessor struct {
+	logger logrus.FieldLogger
+	strgc  storagec.StorageC
+	clock  pkg.Clock
+}
+
+// NewQueryExecutionsProcessor returns a new QueryExecutionsProcessor instance.
+func NewQueryExecutionsProcessor(strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *QueryExecutionsProcessor)) *QueryExecutionsProcessor {
+	p := &QueryExecutionsProcessor{
+		logger: logger,
+		strgc:  strgc,
+		clock:  pkg.SystemClock,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// Process returns a page of job executions matching the filters in the query parameters.
+//
+// Supported query parameters are job_id, status, run_date_from, run_date_to, host, owner (the ID of the user who
+// created the job), mine (true for the executions of the jobs of the caller), sla_breached (true for the
+// executions which breached the SLA of their job), sort (run_date, duration or
+// duration_seconds), direction (asc or desc), limit, cursor and format.  The next cursor is returned in meta.next.
+// The targeted hosts of each execution are paginated by hosts_page and hosts_page_size if either is set, see
+// paginateHosts.
+//
+// The notes attached to the executions by analysts are returned with them, see AnnotateExecutionProcessor.
+//
+// With format=ndjson, up to limit matching job executions, by default and at most maxStreamRecords, are streamed
+// as newline delimited JSON instead, one record per line, without paging metadata or notes.
+func (p *QueryExecutionsProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	queryParams := req.Params.Query
+	if len(queryParams) == 0 {
+		queryParams = make(url.Values)
+	}
+	qr, err := buildQueryExecsRequest(queryParams)
+	if err != nil {
+		return errorResponse(newError(ErrBadRequest, "bad arguments in param.query: %w", err), p.logger)
+	}
+	if qr.Owner, err = ownerFilter(req, queryParams); err != nil {
+		return errorResponse(newError(ErrBadRequest, "bad arguments in param.query: %w", err), p.logger)
+	}
+	if qr.Format == formatNDJSON {
+		return p.stream(ctx, qr)
+	}
+
+	execs, next, total, err := p.query(ctx, qr)
+	if err != nil {
+		err = fmt.Errorf("failed to query job executions: %w", err)
+		p.logger.Error(err)
+		return errorResponse(err, p.logger)
+	}
+
+	execs, err = computeDurations(execs, p.clock.Now())
+	if err != nil {
+		p.logger.Errorf("failed to compute duration for job executions: %s", err)
+	}
+	execs, err = attachNotes(ctx, p.strgc, execs)
+	if err != nil {
+		// the executions are still worth returning without their notes
+		p.logger.Errorf("failed to attach notes to job executions: %s", err)
+	}
+	if hp, ok := parseHostPaging(queryParams); ok {
+		execs = paginateHosts(execs, hp)
+	}
+
+	resp := jobExecRespJSON(
+		&paging{
+			Count: len(execs),
+			Limit: qr.Limit,
+			Next:  next,
+			Total: total,
+		},
+		execs,
+		nil,
+		p.logger,
+	)
+	if resp == nil {
+		err = errors.New("failed to serialize job execution response")
+		p.logger.Errorln(err)
+		return errorResponse(err, p.logger)
+	}
+	return Response{
+		Body: resp,
+		Code: http.StatusOK,
+	}
+}
+
+// stream returns a response streaming the matching job executions as newline delimited JSON.  The job executions
+// are searched and encoded one storage page at a time when the response is serialized.
+func (p *QueryExecutionsProcessor) stream(ctx context.Context, qr queryExecsRequest) Response {
+	now := p.clock.Now()
+	s := &recordStream{
+		produce: func(emit func(v any) error) error {
+			n := 0
+			var emitErr error
+			_, _, _, err := p.scan(ctx, qr, maxQueryLimit, maxStreamScanPages, func(je pkg.JobExecution) bool {
+				if execs, err := computeDurations([]pkg.JobExecution{je}, now); err == nil && len(execs) == 1 {
+					je = execs[0]
+				}
+				if emitErr = emit(je); emitErr != nil {
+					return false
+				}
+				n++
+				return n < qr.Limit
+			})
+			if err == nil {
+				err = emitErr
+			}
+			if err != nil {
+				err = fmt.Errorf("failed to stream job executions: %w", err)
+				p.logger.Error(err)
+			}
+			return err
+		},
+	}
+	return Response{
+		Code:   http.StatusOK,
+		Stream: s,
+	}
+}
+
+// query returns the matching job executions, the cursor of the next page and, when known, the total number of matches.
+func (p *QueryExecutionsProcessor) query(ctx context.Context, qr queryExecsRequest) ([]pkg.JobExecution, string, int, error) {
+	execs := make([]pkg.JobExecution, 0, qr.Limit)
+	offset, more, total, err := p.scan(ctx, qr, qr.Limit, maxQueryScanPages, func(je pkg.JobExecution) bool {
+		execs = append(execs, je)
+		return len(execs) < qr.Limit
+	})
+	if err != nil {
+		return nil, "", 0, err
+	}
+	next := ""
+	if more {
+		next = encodeQueryCursor(queryCursor{Offset: offset})
+	}
+	return execs, next, queryTotal(qr, total), nil
+}
+
+// scan visits the matching job executions in order, starting at the cursor, reading up to maxPages storage pages
+// of pageSize records.  It stops once visit returns false, and returns the offset of the first match which was not
+// visited, whether there are more matches from that offset, and the total number of matches before host filtering.
+func (p *QueryExecutionsProcessor) scan(ctx context.Context, qr queryExecsRequest, pageSize, maxPages int, visit func(je pkg.JobExecution) bool) (int, bool, int, error) {
+	fqlFilter, err := queryExecsFilter(qr)
+	if err != nil {
+		return 0, false, 0, fmt.Errorf("error constructing FQL query: %s", err)
+	}
+	fqlSort, err := pkg.NewFQLSort(qr.SortField, qr.Direction)
+	if err != nil {
+		return 0, false, 0, fmt.Errorf("error constructing FQL sort: %s", err)
+	}
+
+	offset := qr.Cursor.Offset
+	total := 0
+	for page := 0; page < maxPages; page++ {
+		searchResp, err := p.strgc.SearchAndFetch(ctx, storagec.SearchObjectsRequest{
+			Collection: jobExecutionCollection,
+			Filter:     fqlFilter,
+			Limit:      pageSize,
+			Offset:     offset,
+			Sort:       fqlSort,
+		})
+		if err != nil {
+			return 0, false, 0, fmt.Errorf("error retrieving records: %w", err)
+		}
+		total = searchResp.Total
+
+		for i, o := range searchResp.Objects {
+			je, err := decodeStoredJobExecution(o.Data)
+			if err != nil {
+				return 0, false, 0, err
+			}
+			if !targetsHost(je, qr.HostName) {
+				continue
+			}
+			if !visit(je) {
+				pos := offset + i + 1
+				return pos, pos < total, total, nil
+			}
+		}
+
+		// the API reports an offset of zero once there are no more pages
+		if searchResp.Offset <= offset || len(searchResp.Objects) == 0 {
+			return offset, false, total, nil
+		}
+		offset = searchResp.Offset
+	}
+	return offset, true, total, nil
+}
+
+// queryTotal returns the total number of matches, which is unknown when results are filtered by host.
+func queryTotal(qr queryExecsRequest, total int) int {
+	if qr.HostName != "" {
+		return 0
+	}
+	return total
+}
+
+func queryExecsFilter(qr queryExecsRequest) (string, error) {
+	b := &pkg.QueryBuilder{}
+	return b.
+		Between("run_date", qr.RunDateFrom, qr.RunDateTo).
+		Where("id", pkg.EQ, qr.JobID).
+		Where("status", pkg.EQ, qr.Status).
+		Where("owner_id", pkg.EQ, qr.Owner).
+		Where("sla_breached", pkg.EQ, qr.SLABreached).
+		Build()
+}
+
+func targetsHost(je pkg.JobExecution, hostName string) bool {
+	if hostName == "" {
+		return true
+	}
+	for _, h := range je.TargetedHosts {
+		if strings.EqualFold(h.HostName, hostName) || h.DeviceID == hostName {
+			return true
+		}
+	}
+	return false
+}
+
+func buildQueryExecsRequest(q url.Values) (queryExecsRequest, error) {
+	err := validate.Fields(append([]validate.Field{
+		{Name: "status", Value: queryParam(q, "status"), Rules: []validate.Rule{jobStatusRule}},
+		{Name: "run_date_from", Value: queryParam(q, "run_date_from"), Rules: []validate.Rule{isoTimeRule}},
+		{Name: "run_date_to", Value: queryParam(q, "run_date_to"), Rules: []validate.Rule{isoTimeRule}},
+		{Name: "sort", Value: queryParam(q, "sort"), Rules: []validate.Rule{validate.Enum("run_date", "duration", "duration_seconds")}},
+		{Name: "direction", Value: strings.ToLower(queryParam(q, "direction")), Rules: []validate.Rule{validate.Enum("asc", "desc")}},
+		{Name: "format", Value: strings.ToLower(queryParam(q, "format")), Rules: []validate.Rule{validate.Enum(formatJSON, formatNDJSON)}},
+		{Name: "mine", Value: strings.ToLower(queryParam(q, "mine")), Rules: []validate.Rule{validate.Enum("true", "false")}},
+		// executions recorded before SLAs were evaluated have no sla_breached field to match false against
+		{Name: "sla_breached", Value: strings.ToLower(queryParam(q, "sla_breached")), Rules: []validate.Rule{validate.Enum("true")}},
+	}, append(pagingFields(q), hostPagingFields(q)...)...)...)
+	if err != nil {
+		return queryExecsRequest{}, err
+	}
+
+	qr := queryExecsRequest{
+		Direction:   pkg.Desc,
+		Format:      formatJSON,
+		HostName:    queryParam(q, "host"),
+		JobID:       queryParam(q, "job_id"),
+		RunDateFrom: time.Unix(0, 0).UTC().Format(pkg.ISOTimeFormat),
+		RunDateTo:   queryParam(q, "run_date_to"),
+		SLABreached: strings.ToLower(queryParam(q, "sla_breached")),
+		SortField:   "run_date",
+		Status:      pkg.NormalizeJobStatus(queryParam(q, "status")),
+	}
+	if s := queryParam(q, "run_date_from"); s != "" {
+		qr.RunDateFrom = s
+	}
+	if s := queryParam(q, "sort"); s != "" {
+		qr.SortField = s
+	}
+	if strings.ToLower(queryParam(q, "direction")) == "asc" {
+		qr.Direction = pkg.Asc
+	}
+
+	defaultLimit, maxLimit := defaultQueryLimit, maxQueryLimit
+	if s := strings.ToLower(queryParam(q, "format")); s == formatNDJSON {
+		qr.Format = s
+		defaultLimit, maxLimit = maxStreamRecords, maxStreamRecords
+	}
+	qr.Limit, qr.Cursor = parsePaging(q, defaultLimit, maxLimit)
+	return qr, nil
+}
+
+func encodeQueryCursor(c queryCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeQueryCursor(s string) (queryCursor, error) {
+	var c queryCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	if err = json.Unmarshal(b, &c); err != nil {
+		return c, err
+	}
+	if c.Offset < 0 {
+		return queryCursor{}, fmt.Errorf("negative offset: %d", c.Offset)
+	}
+	return c, nil
+}
@@ -0,0 +1,312 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/searchc"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/sirupsen/logrus"
+)
+
+// ReaperProcessor finalizes the job executions which have been in progress for longer than a timeout, e.g.
+// because the workflow event reporting their final state was lost.  It is meant to be invoked on a schedule by
+// a workflow.
+type ReaperProcessor struct {
+	hooks         *UpsertProcessor
+	logger        logrus.FieldLogger
+	outputPolicy  OutputPolicy
+	savedSearches searchc.SavedSearches
+	srchc         searchc.SearchC
+	strgc         storagec.StorageC
+	timeout       time.Duration
+	clock         pkg.Clock
+}
+
+// NewReaperProcessor returns a new ReaperProcessor instance.
+func NewReaperProcessor(srchc searchc.SearchC, strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *ReaperProcessor)) *ReaperProcessor {
+	p := &ReaperProcessor{
+		logger:        logger,
+		outputPolicy:  DefaultOutputPolicy(),
+		savedSearches: searchc.DefaultSavedSearches(),
+		srchc:         srchc,
+		strgc:         strgc,
+		timeout:       defaultStaleExecutionTimeout,
+		clock:         pkg.SystemClock,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// WithReaperSavedSearches sets the saved searches run for the logical queries of the ReaperProcessor.
+func WithReaperSavedSearches(ss searchc.SavedSearches) func(p *ReaperProcessor) {
+	return func(p *ReaperProcessor) {
+		p.savedSearches = ss
+	}
+}
+
+// WithReaperOutputPolicy sets the policy bounding the output of hosts stored on the execution records of the ReaperProcessor.  Policies
+// without a positive inline limit are ignored.
+func WithReaperOutputPolicy(op OutputPolicy) func(p *ReaperProcessor) {
+	return func(p *ReaperProcessor) {
+		if op.InlineLimit > 0 {
+			p.outputPolicy = op
+		}
+	}
+}
+
+// WithReaperTimeout sets how long an execution may stay in progress before it is reaped.  Non-positive
+// timeouts are ignored.
+func WithReaperTimeout(d time.Duration) func(p *ReaperProcessor) {
+	return func(p *ReaperProcessor) {
+		if d > 0 {
+			p.timeout = d
+		}
+	}
+}
+
+// WithReaperHooks runs the hooks of the given UpsertProcessor which follow a change of status, e.g. notifications,
+// alerts, tickets, SIEM events and the release of queued executions, on the reaped executions as if their final
+// workflow event had been received.  The run count of their job is reconciled with the upsert's too.
+func WithReaperHooks(u *UpsertProcessor) func(p *ReaperProcessor) {
+	return func(p *ReaperProcessor) {
+		p.hooks = u
+	}
+}
+
+// Process reaps the job executions which started more than the timeout ago and are still in progress.  Logscale
+// is searched again for the host results of each of them: executions with results are finalized from them, the
+// others are marked as timed out.  Either way the reason is recorded in the status_reason of the execution.
+// Overlapping runs fail with a conflict.
+func (p *ReaperProcessor) Process(ctx context.Context, _ fdk.Request) Response {
+	unlock, err := lockTask(ctx, p.strgc, p.clock, p.logger, reaperLock)
+	if err != nil {
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+	defer unlock()
+
+	cutoff := p.clock.Now().UTC().Add(-p.timeout)
+	filter, err := pkg.NewFQLQuery([]pkg.Filter{
+		{Field: "status", Op: pkg.EQ, Value: pkg.StatusInProgress},
+		{Field: "run_date", Op: pkg.LT, Value: cutoff.Format(pkg.ISOTimeFormat)},
+	})
+	if err != nil {
+		err = fmt.Errorf("error constructing FQL query: %s", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+	sr, err := p.strgc.Search(ctx, storagec.SearchObjectsRequest{
+		Collection: jobExecutionCollection,
+		Filter:     filter,
+		Limit:      maxReapsPerRun,
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to search for stale job executions: %w", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+
+	result := reaperResult{}
+	errs := make([]fdk.APIError, 0)
+	for _, k := range sr.ObjectKeys {
+		result.Checked++
+		je, reaped, err := p.reap(ctx, k, cutoff)
+		if errors.Is(err, storagec.VersionConflict) {
+			// the execution was upserted concurrently, most likely with its final state
+			continue
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to reap job execution %s: %w", k, err)
+			p.logger.Error(err)
+			errs = append(errs, apiError(err))
+			continue
+		}
+		if !reaped {
+			continue
+		}
+		p.logger.WithField("execution_id", je.ExecutionID).
+			WithField("status", je.RunStatus).
+			Warnf("reaped stale job execution: %s", je.StatusReason)
+		if je.RunStatus == pkg.StatusTimedOut {
+			result.TimedOut++
+		} else {
+			result.Recovered++
+		}
+		p.updateJob(ctx, k, je)
+	}
+	p.logger.WithField("checked", result.Checked).
+		WithField("recovered", result.Recovered).
+		WithField("timed_out", result.TimedOut).
+		Info("reaped stale job executions")
+
+	code := http.StatusOK
+	if len(errs) > 0 {
+		code = http.StatusMultiStatus
+	}
+	return Response{
+		Body: p.reaperRespJSON([]reaperResult{result}, errs),
+		Code: code,
+	}
+}
+
+// reap finalizes a single stale job execution, returning the updated record and true unless the execution is no
+// longer stale.
+func (p *ReaperProcessor) reap(ctx context.Context, key string, cutoff time.Time) (pkg.JobExecution, bool, error) {
+	execMap, version, err := fetchObject(ctx, p.strgc, jobExecutionCollection, key)
+	if err != nil {
+		return pkg.JobExecution{}, false, fmt.Errorf("failed to fetch job execution record: %w", err)
+	}
+	je, err := mapToJobExecution(execMap)
+	if err != nil {
+		return pkg.JobExecution{}, false, fmt.Errorf("failed to deserialize job execution record: %s", err)
+	}
+	if je.RunStatus != pkg.StatusInProgress || je.RunDate >= cutoff.Format(pkg.ISOTimeFormat) {
+		// the search index lags behind the records
+		return je, false, nil
+	}
+
+	// the job type is not recorded on executions, so the default saved searches are run and every extraction
+	// rule is tried
+	pages := searchc.NewPages(ctx, p.srchc, p.savedSearches.Requests(searchc.QueryExecutionResults, "", map[string]string{
+		"execution_id": je.ExecutionID,
+	})...)
+	x, err := extractHosts(pages, "", p.logger)
+	if err != nil {
+		return pkg.JobExecution{}, false, fmt.Errorf("failed to execute logscale search: %w", err)
+	}
+	hosts := p.outputPolicy.apply(ctx, p.strgc, je.ID, je.ExecutionID, x.Hosts, p.logger)
+
+	prevStatus := je.RunStatus
+	if len(hosts) > 0 {
+		je.TargetedHosts = hosts
+		je.NumHosts = len(hosts)
+		je.HostsTruncated = x.Truncated
+		je.LogscaleOutput = pages.Response().JobURL
+		je.PendingEnrichment = false
+		je.RunStatus = pkg.StatusCompleted
+		je = applyHostResults(je)
+		if je.SucceededHosts == 0 {
+			je.RunStatus = pkg.StatusFailed
+		}
+		je.StatusReason = fmt.Sprintf("no final workflow event received within %s - status recovered from the %d host results found in logscale", p.timeout, len(hosts))
+	} else {
+		je.RunStatus = pkg.StatusTimedOut
+		je.StatusReason = fmt.Sprintf("no final workflow event or host results received within %s", p.timeout)
+	}
+	je.EndDate = reapedEndDate(je, p.timeout)
+	je.RecordStatus(prevStatus, p.clock.Now().Format(pkg.ISOTimeFormat), "reaper")
+
+	d, secs, err := computeJobDuration(je.RunDate, je.EndDate, je.RunStatus, p.clock.Now())
+	if err != nil {
+		return pkg.JobExecution{}, false, fmt.Errorf("failed to compute job duration: %s", err)
+	}
+	je.Duration, je.DurationSeconds = d, secs
+
+	data, err := json.Marshal(je)
+	if err != nil {
+		return pkg.JobExecution{}, false, fmt.Errorf("failed to serialize job execution record: %s", err)
+	}
+	if err = putObject(ctx, p.strgc, jobExecutionCollection, key, data, version); err != nil {
+		return pkg.JobExecution{}, false, err
+	}
+	return je, true, nil
+}
+
+// reapedEndDate returns the end date of a reaped execution: the time of the last event reported by its hosts, or
+// the time the timeout elapsed if none did, so that its duration is not inflated by the delay before reaping.
+func reapedEndDate(je pkg.JobExecution, timeout time.Duration) string {
+	end := ""
+	for _, h := range je.TargetedHosts {
+		if h.EndTime > end {
+			end = h.EndTime
+		}
+	}
+	if end != "" {
+		return end
+	}
+	start, err := time.Parse(pkg.ISOTimeFormat, je.RunDate)
+	if err != nil {
+		return ""
+	}
+	return start.Add(timeout).Format(pkg.ISOTimeFormat)
+}
+
+// updateJob records the final status of a reaped execution on its job if it is the last execution of the job,
+// then runs the hooks which follow a change of status on the execution.  Failures are logged, the execution itself
+// being reaped.
+func (p *ReaperProcessor) updateJob(ctx context.Context, key string, je pkg.JobExecution) {
+	l := p.logger.WithField("job_id", je.ID).WithField("execution_id", je.ExecutionID)
+	jobMap, version, err := fetchObject(ctx, p.strgc, jobCollection, je.ID)
+	if errors.Is(err, storagec.NotFound) {
+		return
+	}
+	if err != nil {
+		l.Errorf("failed to fetch job record: %s", err)
+		return
+	}
+	j, err := distillJob(jobMap)
+	if err != nil {
+		l.Errorf("could not distill job record from dictionary: %s", err)
+		return
+	}
+
+	if p.hooks != nil {
+		j = p.hooks.reconcileRunCount(ctx, je.ID, j, je)
+	}
+	if j.LastExecutionID == je.ExecutionID {
+		j.LastRunStatus = je.RunStatus
+	}
+	jobMap, err = updateJobMap(j, jobMap)
+	if err != nil {
+		l.Errorf("failed to map job instance to job map: %s", err)
+		return
+	}
+	b, err := json.Marshal(jobMap)
+	if err != nil {
+		l.Errorf("failed to serialize job record: %s", err)
+		return
+	}
+	if err = putObject(ctx, p.strgc, jobCollection, je.ID, b, version); err != nil {
+		l.Errorf("failed to save job record: %s", err)
+	}
+
+	if p.hooks == nil {
+		return
+	}
+	// the hooks run even if the job record was not saved, as the reaped execution has been saved
+	er := executionRecord{key: key, prevStatus: pkg.StatusInProgress, record: je}
+	p.hooks.notify(ctx, j, er)
+	p.hooks.alert(ctx, j, er)
+	p.hooks.ticket(ctx, je.ID, j, er)
+	p.hooks.emit(ctx, er)
+	p.hooks.releaseQueued(ctx, je.ID, j, er)
+	p.hooks.releaseSessionQueued(ctx, er)
+}
+
+func (p *ReaperProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return p.reaperRespJSON(nil, errs)
+	})
+}
+
+func (p *ReaperProcessor) reaperRespJSON(r []reaperResult, e []fdk.APIError) []byte {
+	if r == nil {
+		r = make([]reaperResult, 0)
+	}
+	resp := reaperResponse{Errs: e, Resources: r}
+	rJSON, err := json.Marshal(resp)
+	if err != nil {
+		p.logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
@@ -0,0 +1,46 @@
+package processor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+)
+
+func TestReapedEndDate(t *testing.T) {
+	tests := []struct {
+		name    string
+		je      pkg.JobExecution
+		timeout time.Duration
+		want    string
+	}{
+		{
+			name: "last host event",
+			je: pkg.JobExecution{RunDate: "2024-01-01T00:00:00Z", TargetedHosts: []pkg.TargetedHost{
+				{EndTime: "2024-01-01T00:05:00Z"},
+				{},
+				{EndTime: "2024-01-01T00:07:00Z"},
+			}},
+			timeout: time.Hour,
+			want:    "2024-01-01T00:07:00Z",
+		},
+		{
+			name:    "no host events",
+			je:      pkg.JobExecution{RunDate: "2024-01-01T00:00:00Z", TargetedHosts: []pkg.TargetedHost{{}}},
+			timeout: time.Hour,
+			want:    "2024-01-01T01:00:00Z",
+		},
+		{
+			name:    "invalid run date",
+			je:      pkg.JobExecution{RunDate: "yesterday"},
+			timeout: time.Hour,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reapedEndDate(tt.je, tt.timeout); got != tt.want {
+				t.Errorf("reapedEndDate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,252 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/workflowc"
+	"github.com/sirupsen/logrus"
+)
+
+// Kinds of orphaned jobs.
+const (
+	// orphanNoWorkflow is the issue of jobs which were provisioned but have no schedule workflow.
+	orphanNoWorkflow = "no_workflow"
+	// orphanWorkflowMissing is the issue of jobs referencing a workflow definition which no longer exists.
+	orphanWorkflowMissing = "workflow_missing"
+)
+
+// ReconcileProcessor finds the orphans between the job records in storage and the workflow definitions of the
+// app: jobs without workflows, and workflows without jobs.  The workflow definitions of the app are those whose
+// name starts with the configured prefix.
+type ReconcileProcessor struct {
+	logger     logrus.FieldLogger
+	namePrefix string
+	strgc      storagec.StorageC
+	wfc        workflowc.WorkflowC
+}
+
+// NewReconcileProcessor returns a new ReconcileProcessor instance.
+func NewReconcileProcessor(strgc storagec.StorageC, wfc workflowc.WorkflowC, logger logrus.FieldLogger, opts ...func(p *ReconcileProcessor)) *ReconcileProcessor {
+	p := &ReconcileProcessor{
+		logger: logger,
+		strgc:  strgc,
+		wfc:    wfc,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// WithReconcileNamePrefix sets the prefix of the names of the workflow definitions of the app.  Reconciliation
+// is refused without one, as every workflow definition of the CID would be considered an orphan.
+func WithReconcileNamePrefix(prefix string) func(p *ReconcileProcessor) {
+	return func(p *ReconcileProcessor) {
+		p.namePrefix = prefix
+	}
+}
+
+// Process reports the orphans and, unless the request sets dry_run, repairs them.  Orphaned jobs are turned back
+// into drafts without workflows, so that saving them again provisions new workflows, and orphaned workflows are
+// deprovisioned.  Orphaned workflows are only repaired if every job could be checked, so that a workflow whose
+// job could not be read is never deprovisioned.  Repairs overlapping another repairing run fail with a conflict.
+func (p *ReconcileProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	var rr reconcileRequest
+	if len(req.Body) > 0 {
+		if err := json.Unmarshal(req.Body, &rr); err != nil {
+			return p.errResp(newError(ErrBadRequest, "failed to parse request body: %s", err))
+		}
+	}
+	if p.namePrefix == "" {
+		return p.errResp(newError(ErrBadRequest, "no workflow name prefix is configured"))
+	}
+
+	if !rr.DryRun {
+		unlock, err := lockTask(ctx, p.strgc, pkg.SystemClock, p.logger, reconcileLock)
+		if err != nil {
+			p.logger.Error(err)
+			return p.errResp(err)
+		}
+		defer unlock()
+	}
+
+	defs, err := p.wfc.Definitions(ctx, p.namePrefix)
+	if err != nil {
+		err = fmt.Errorf("failed to list workflow definitions: %w", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+
+	filter, err := pkg.NewFQLQuery([]pkg.Filter{{Field: "created_at", Op: pkg.GTE, Value: "0"}})
+	if err != nil {
+		err = fmt.Errorf("error constructing FQL query: %s", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+	sr, err := p.strgc.SearchAll(ctx, storagec.SearchObjectsRequest{
+		Collection: jobCollection,
+		Filter:     filter,
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to search jobs: %w", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+
+	listed := make(map[string]bool, len(defs))
+	for _, d := range defs {
+		listed[d.ID] = true
+	}
+	result := reconcileResult{
+		Definitions:     len(defs),
+		DryRun:          rr.DryRun,
+		OrphanJobs:      make([]orphanJob, 0),
+		OrphanWorkflows: make([]orphanWorkflow, 0),
+	}
+	referenced := make(map[string]bool)
+	errs := make([]fdk.APIError, 0)
+	for _, jobID := range sr.ObjectKeys {
+		orphan, refs, err := p.checkJob(ctx, jobID, listed, rr.DryRun)
+		if errors.Is(err, storagec.NotFound) {
+			// the job was deleted concurrently
+			continue
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to check job %s: %w", jobID, err)
+			p.logger.Error(err)
+			errs = append(errs, apiError(err))
+			continue
+		}
+		result.Checked++
+		for _, id := range refs {
+			referenced[id] = true
+		}
+		if orphan != nil {
+			result.OrphanJobs = append(result.OrphanJobs, *orphan)
+		}
+	}
+
+	repairWorkflows := !rr.DryRun && len(errs) == 0
+	for _, d := range defs {
+		if referenced[d.ID] {
+			continue
+		}
+		o := orphanWorkflow{DefinitionID: d.ID, Name: d.Name}
+		if repairWorkflows {
+			if err := p.wfc.Deprovision(ctx, d.ID); err != nil && !errors.Is(err, workflowc.NotFound) {
+				o.Error = err.Error()
+			} else {
+				o.Repaired = true
+			}
+		}
+		result.OrphanWorkflows = append(result.OrphanWorkflows, o)
+	}
+	sort.Slice(result.OrphanWorkflows, func(i, j int) bool {
+		return result.OrphanWorkflows[i].Name < result.OrphanWorkflows[j].Name
+	})
+	p.logger.WithField("checked", result.Checked).
+		WithField("orphan_jobs", len(result.OrphanJobs)).
+		WithField("orphan_workflows", len(result.OrphanWorkflows)).
+		WithField("dry_run", rr.DryRun).
+		Info("reconciled jobs and workflow definitions")
+
+	code := http.StatusOK
+	if len(errs) > 0 {
+		code = http.StatusMultiStatus
+	}
+	return Response{
+		Body: p.reconcileRespJSON([]reconcileResult{result}, errs),
+		Code: code,
+	}
+}
+
+// checkJob returns the IDs of the workflow definitions referenced by a job, and the job as an orphan if it is
+// missing its schedule workflow or references a definition which does not exist.  Referenced definitions which
+// were not listed, e.g. because the job was renamed, are looked up individually.  The orphan is repaired unless
+// dryRun is true.
+func (p *ReconcileProcessor) checkJob(ctx context.Context, jobID string, listed map[string]bool, dryRun bool) (*orphanJob, []string, error) {
+	jobMap, version, err := fetchObject(ctx, p.strgc, jobCollection, jobID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not fetch job record: %w", err)
+	}
+	j, err := distillJob(jobMap)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not distill job record from dictionary: %s", err)
+	}
+	var refs []string
+	if j.Workflows != nil {
+		for _, id := range []string{j.Workflows.ScheduleWorkflow, j.Workflows.NotifierWorkflow} {
+			if id != "" {
+				refs = append(refs, id)
+			}
+		}
+	}
+	if j.Draft {
+		// drafts have not been provisioned, yet may keep the workflows of an earlier version
+		return nil, refs, nil
+	}
+	orphan := &orphanJob{JobID: jobID, JobName: j.Name}
+	if j.Workflows == nil || j.Workflows.ScheduleWorkflow == "" {
+		orphan.Issue = orphanNoWorkflow
+	}
+	for _, id := range refs {
+		if orphan.Issue != "" || listed[id] {
+			continue
+		}
+		if _, err = p.wfc.Definition(ctx, id); errors.Is(err, workflowc.NotFound) {
+			orphan.DefinitionID, orphan.Issue = id, orphanWorkflowMissing
+		} else if err != nil {
+			return nil, nil, err
+		}
+	}
+	if orphan.Issue == "" {
+		return nil, refs, nil
+	}
+	if dryRun {
+		return orphan, refs, nil
+	}
+
+	// the workflows of the job which still exist are no longer referenced, and are deprovisioned as orphans
+	jobMap["draft"] = true
+	delete(jobMap, "workflows")
+	b, err := json.Marshal(jobMap)
+	if err == nil {
+		err = putObject(ctx, p.strgc, jobCollection, jobID, b, version)
+	}
+	if errors.Is(err, storagec.VersionConflict) {
+		err = errors.New("job was modified concurrently")
+	}
+	if err != nil {
+		orphan.Error = fmt.Sprintf("failed to save job record: %s", err)
+		return orphan, refs, nil
+	}
+	orphan.Repaired = true
+	return orphan, nil, nil
+}
+
+func (p *ReconcileProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return p.reconcileRespJSON(nil, errs)
+	})
+}
+
+func (p *ReconcileProcessor) reconcileRespJSON(r []reconcileResult, e []fdk.APIError) []byte {
+	if r == nil {
+		r = make([]reconcileResult, 0)
+	}
+	resp := reconcileResponse{Errs: e, Resources: r}
+	rJSON, err := json.Marshal(resp)
+	if err != nil {
+		p.logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
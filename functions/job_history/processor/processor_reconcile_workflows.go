@@ -0,0 +1,193 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/workflowc"
+	"github.com/sirupsen/logrus"
+)
+
+// Kinds of drift between a job and its workflows.
+const (
+	// driftMissing is the drift of workflows which no longer exist.  The job must be saved again to provision
+	// them.
+	driftMissing = "missing"
+	// driftShouldBeEnabled is the drift of disabled schedule workflows of active jobs.
+	driftShouldBeEnabled = "should_be_enabled"
+	// driftShouldBeDisabled is the drift of enabled schedule workflows of draft, paused, expired or finished jobs.
+	driftShouldBeDisabled = "should_be_disabled"
+	// driftName is the drift of schedule workflows named differently from their job, e.g. because the job was
+	// renamed.  The job must be saved again to provision renamed workflows.
+	driftName = "name_mismatch"
+)
+
+// ReconcileWorkflowsProcessor detects drift between the stored jobs and their workflow definitions, enabling or
+// disabling the schedule workflows of jobs to match their state.  It is meant to be invoked on a schedule by a
+// workflow.
+type ReconcileWorkflowsProcessor struct {
+	logger logrus.FieldLogger
+	strgc  storagec.StorageC
+	wfc    workflowc.WorkflowC
+}
+
+// NewReconcileWorkflowsProcessor returns a new ReconcileWorkflowsProcessor instance.
+func NewReconcileWorkflowsProcessor(strgc storagec.StorageC, wfc workflowc.WorkflowC, logger logrus.FieldLogger, opts ...func(p *ReconcileWorkflowsProcessor)) *ReconcileWorkflowsProcessor {
+	p := &ReconcileWorkflowsProcessor{
+		logger: logger,
+		strgc:  strgc,
+		wfc:    wfc,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// Process checks the workflows of every job.  Missing and misnamed workflows are reported, as provisioning them
+// requires the templates configured for Func_Jobs, and the schedule workflows enabled or disabled in error are
+// fixed unless the request sets dry_run.  Fixes overlapping another fixing run fail with a conflict.
+func (p *ReconcileWorkflowsProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	var rr reconcileWorkflowsRequest
+	if len(req.Body) > 0 {
+		if err := json.Unmarshal(req.Body, &rr); err != nil {
+			return p.errResp(newError(ErrBadRequest, "failed to parse request body: %s", err))
+		}
+	}
+	if !rr.DryRun {
+		unlock, err := lockTask(ctx, p.strgc, pkg.SystemClock, p.logger, reconcileWorkflowsLock)
+		if err != nil {
+			p.logger.Error(err)
+			return p.errResp(err)
+		}
+		defer unlock()
+	}
+
+	filter, err := pkg.NewFQLQuery([]pkg.Filter{{Field: "created_at", Op: pkg.GTE, Value: "0"}})
+	if err != nil {
+		err = fmt.Errorf("error constructing FQL query: %s", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+	sr, err := p.strgc.SearchAll(ctx, storagec.SearchObjectsRequest{
+		Collection: jobCollection,
+		Filter:     filter,
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to search jobs: %w", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+
+	result := reconcileWorkflowsResult{DryRun: rr.DryRun, Drifts: make([]workflowDrift, 0)}
+	errs := make([]fdk.APIError, 0)
+	for _, jobID := range sr.ObjectKeys {
+		drifts, err := p.reconcile(ctx, jobID, rr.DryRun)
+		if errors.Is(err, storagec.NotFound) {
+			// the job was deleted concurrently
+			continue
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to reconcile the workflows of job %s: %w", jobID, err)
+			p.logger.Error(err)
+			errs = append(errs, apiError(err))
+			continue
+		}
+		result.Checked++
+		result.Drifts = append(result.Drifts, drifts...)
+	}
+	p.logger.WithField("checked", result.Checked).
+		WithField("drifts", len(result.Drifts)).
+		WithField("dry_run", rr.DryRun).
+		Info("reconciled job workflows")
+
+	code := http.StatusOK
+	if len(errs) > 0 {
+		code = http.StatusMultiStatus
+	}
+	return Response{
+		Body: p.reconcileWorkflowsRespJSON([]reconcileWorkflowsResult{result}, errs),
+		Code: code,
+	}
+}
+
+// reconcile returns the drift between a job and its workflows, fixing what it can unless dryRun is true.
+func (p *ReconcileWorkflowsProcessor) reconcile(ctx context.Context, jobID string, dryRun bool) ([]workflowDrift, error) {
+	jobMap, _, err := fetchObject(ctx, p.strgc, jobCollection, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch job record: %w", err)
+	}
+	j, err := distillJob(jobMap)
+	if err != nil {
+		return nil, fmt.Errorf("could not distill job record from dictionary: %s", err)
+	}
+	if j.Workflows == nil {
+		return nil, nil
+	}
+
+	drifts := make([]workflowDrift, 0)
+	if id := j.Workflows.NotifierWorkflow; id != "" {
+		if _, err = p.wfc.Definition(ctx, id); errors.Is(err, workflowc.NotFound) {
+			drifts = append(drifts, workflowDrift{DefinitionID: id, Issue: driftMissing, JobID: jobID})
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	id := j.Workflows.ScheduleWorkflow
+	if id == "" {
+		return drifts, nil
+	}
+	def, err := p.wfc.Definition(ctx, id)
+	if errors.Is(err, workflowc.NotFound) {
+		return append(drifts, workflowDrift{DefinitionID: id, Issue: driftMissing, JobID: jobID}), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if j.Name != "" && def.Name != j.Name {
+		drifts = append(drifts, workflowDrift{DefinitionID: id, Issue: driftName, JobID: jobID})
+	}
+	if def.Enabled == j.scheduled() {
+		return drifts, nil
+	}
+
+	d := workflowDrift{DefinitionID: id, Issue: driftShouldBeDisabled, JobID: jobID}
+	toggle := p.wfc.Disable
+	if j.scheduled() {
+		d.Issue, toggle = driftShouldBeEnabled, p.wfc.Enable
+	}
+	if !dryRun {
+		if err = toggle(ctx, id); err != nil {
+			d.Error = err.Error()
+		} else {
+			d.Fixed = true
+		}
+	}
+	return append(drifts, d), nil
+}
+
+func (p *ReconcileWorkflowsProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return p.reconcileWorkflowsRespJSON(nil, errs)
+	})
+}
+
+func (p *ReconcileWorkflowsProcessor) reconcileWorkflowsRespJSON(r []reconcileWorkflowsResult, e []fdk.APIError) []byte {
+	if r == nil {
+		r = make([]reconcileWorkflowsResult, 0)
+	}
+	resp := reconcileWorkflowsResponse{Errs: e, Resources: r}
+	rJSON, err := json.Marshal(resp)
+	if err != nil {
+		p.logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
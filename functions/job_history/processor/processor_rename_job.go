@@ -0,0 +1,274 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/validate"
+	"github.com/sirupsen/logrus"
+)
+
+// RenameJobProcessor renames a job while keeping its ID, and with it its history.  The workflows of the job keep
+// reporting the name the job was provisioned with, so previous names are kept as aliases of the job and stay
+// indexed for it in the name index.
+type RenameJobProcessor struct {
+	chunkSize int
+	foldCase  bool
+	logger    logrus.FieldLogger
+	strgc     storagec.StorageC
+}
+
+// NewRenameJobProcessor returns a new RenameJobProcessor instance.
+func NewRenameJobProcessor(strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *RenameJobProcessor)) *RenameJobProcessor {
+	p := &RenameJobProcessor{
+		chunkSize: renameChunkSize,
+		logger:    logger,
+		strgc:     strgc,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// WithRenameJobNameCaseFolding makes job names which only differ by case the same name, see pkg.JobNameKey.
+func WithRenameJobNameCaseFolding() func(p *RenameJobProcessor) {
+	return func(p *RenameJobProcessor) {
+		p.foldCase = true
+	}
+}
+
+// Process renames the job identified by the job_id of the request body to its name.  Names taken by another
+// job are rejected.  The name is then rewritten on the execution records of the job; executions which could not
+// be rewritten are reported and keep their previous name, and renaming the job again to the same name retries
+// them.
+func (p *RenameJobProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	var rr renameJobRequest
+	if err := json.Unmarshal(req.Body, &rr); err != nil {
+		return p.errResp(newError(ErrBadRequest, "failed to parse request body: %s", err))
+	}
+	err := validate.Fields(
+		validate.Field{Name: "job_id", Value: rr.JobID, Rules: []validate.Rule{validate.Required()}},
+		validate.Field{Name: "name", Value: rr.Name, Rules: []validate.Rule{validate.Required()}},
+	)
+	if err != nil {
+		return p.errResp(err)
+	}
+	jobID := strings.TrimSpace(rr.JobID)
+	name := pkg.NormalizeJobName(rr.Name)
+	logger := p.logger.WithField("job_id", jobID)
+
+	jobMap, version, err := fetchObject(ctx, p.strgc, jobCollection, jobID)
+	if errors.Is(err, storagec.NotFound) {
+		return p.errResp(newError(ErrNotFound, "not found"))
+	}
+	if err != nil {
+		err = fmt.Errorf("could not fetch job record: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	j, err := distillJob(jobMap)
+	if err != nil {
+		err = fmt.Errorf("could not distill job record from dictionary: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+
+	prevName := j.Name
+	renamed := pkg.JobNameKey(prevName, p.foldCase) != pkg.JobNameKey(name, p.foldCase)
+	if renamed {
+		if err = p.checkName(ctx, jobID, name); err != nil {
+			logger.Error(err)
+			return p.errResp(err)
+		}
+	}
+
+	if prevName != name {
+		j.Aliases = p.aliases(j, name)
+		jobMap["name"] = name
+		jobMap["aliases"] = j.Aliases
+		err = p.putJob(ctx, jobID, jobMap, version)
+		if errors.Is(err, storagec.VersionConflict) {
+			return p.errResp(newError(ErrConflict, "job was modified concurrently, please retry"))
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to save job record: %w", err)
+			logger.Error(err)
+			return p.errResp(err)
+		}
+	}
+
+	result := renameJobResult{ID: jobID, Name: name, Aliases: j.Aliases}
+	errs := make([]fdk.APIError, 0)
+	if renamed {
+		// the previous name is indexed too, as the workflows of the job still report it
+		for _, n := range []string{name, prevName} {
+			if n == "" {
+				continue
+			}
+			if err = putJobName(ctx, p.strgc, jobNameEntry{JobID: jobID, Name: n}, p.foldCase); err != nil {
+				err = fmt.Errorf("failed to save job name entry for %q: %w", n, err)
+				logger.Error(err)
+				errs = append(errs, apiError(err))
+			}
+		}
+	}
+
+	errs = append(errs, p.renameExecutions(ctx, jobID, name, &result)...)
+	logger.WithField("name", name).
+		WithField("previous_name", prevName).
+		WithField("renamed_executions", result.RenamedExecutions).
+		WithField("failed_executions", result.FailedExecutions).
+		Info("renamed job")
+
+	code := http.StatusOK
+	if len(errs) > 0 {
+		code = http.StatusMultiStatus
+	}
+	return Response{
+		Body: p.renameJobRespJSON([]renameJobResult{result}, errs),
+		Code: code,
+	}
+}
+
+// checkName fails with ErrConflict if name belongs to a job other than the job with ID jobID.
+func (p *RenameJobProcessor) checkName(ctx context.Context, jobID, name string) error {
+	ownerID, err := NewIndexedJobIDs(p.strgc, p.foldCase).JobID(ctx, name)
+	if err != nil {
+		return err
+	}
+	if ownerID == jobID {
+		return nil
+	}
+	_, _, err = fetchObject(ctx, p.strgc, jobCollection, ownerID)
+	if errors.Is(err, storagec.NotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not fetch job record: %w", err)
+	}
+	return newError(ErrConflict, "job name %q is taken by job %s", name, ownerID)
+}
+
+// aliases returns the aliases of a job renamed to name: its previous aliases and name, without those with the
+// same key as name.
+func (p *RenameJobProcessor) aliases(j job, name string) []string {
+	key := pkg.JobNameKey(name, p.foldCase)
+	seen := map[string]bool{key: true}
+	aliases := make([]string, 0, len(j.Aliases)+1)
+	for _, a := range append(j.Aliases, j.Name) {
+		k := pkg.JobNameKey(a, p.foldCase)
+		if a == "" || seen[k] {
+			continue
+		}
+		seen[k] = true
+		aliases = append(aliases, a)
+	}
+	return aliases
+}
+
+func (p *RenameJobProcessor) putJob(ctx context.Context, jobID string, jobMap map[string]any, version string) error {
+	b, err := json.Marshal(jobMap)
+	if err != nil {
+		return fmt.Errorf("failed to serialize job record: %s", err)
+	}
+	return putObject(ctx, p.strgc, jobCollection, jobID, b, version)
+}
+
+// renameExecutions sets the name of the execution records of a job, p.chunkSize at a time, counting the renamed
+// and failed records in the result.  Records which already have the name are left as they are.
+func (p *RenameJobProcessor) renameExecutions(ctx context.Context, jobID, name string, result *renameJobResult) []fdk.APIError {
+	filter, err := pkg.NewFQLQuery([]pkg.Filter{{Field: "id", Op: pkg.EQ, Value: jobID}})
+	if err != nil {
+		err = fmt.Errorf("error constructing FQL query: %s", err)
+		p.logger.Error(err)
+		return []fdk.APIError{apiError(err)}
+	}
+	sr, err := p.strgc.SearchAll(ctx, storagec.SearchObjectsRequest{
+		Collection: jobExecutionCollection,
+		Filter:     filter,
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to search for job executions: %w", err)
+		p.logger.Error(err)
+		return []fdk.APIError{apiError(err)}
+	}
+
+	errs := make([]fdk.APIError, 0)
+	var mu sync.Mutex
+	keys := sr.ObjectKeys
+	for start := 0; start < len(keys); start += p.chunkSize {
+		end := min(start+p.chunkSize, len(keys))
+
+		var wg sync.WaitGroup
+		for _, k := range keys[start:end] {
+			wg.Add(1)
+			go func(k string) {
+				defer wg.Done()
+				renamed, err := p.renameExecution(ctx, k, name)
+				if errors.Is(err, storagec.NotFound) {
+					err = nil
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					err = fmt.Errorf("failed to rename job execution %s: %w", k, err)
+					p.logger.Error(err)
+					errs = append(errs, apiError(err))
+					result.FailedExecutions++
+					return
+				}
+				if renamed {
+					result.RenamedExecutions++
+				}
+			}(k)
+		}
+		wg.Wait()
+	}
+	return errs
+}
+
+// renameExecution sets the name of a single execution record, returning true if it had another name.
+func (p *RenameJobProcessor) renameExecution(ctx context.Context, key, name string) (bool, error) {
+	execMap, version, err := fetchObject(ctx, p.strgc, jobExecutionCollection, key)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := execMap["name"].(string); n == name {
+		return false, nil
+	}
+	execMap["name"] = name
+	b, err := json.Marshal(execMap)
+	if err != nil {
+		return false, fmt.Errorf("failed to serialize job execution record: %s", err)
+	}
+	return true, putObject(ctx, p.strgc, jobExecutionCollection, key, b, version)
+}
+
+func (p *RenameJobProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return p.renameJobRespJSON(nil, errs)
+	})
+}
+
+func (p *RenameJobProcessor) renameJobRespJSON(r []renameJobResult, e []fdk.APIError) []byte {
+	if r == nil {
+		r = make([]renameJobResult, 0)
+	}
+	resp := renameJobResponse{Errs: e, Resources: r}
+	rJSON, err := json.Marshal(resp)
+	if err != nil {
+		p.logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
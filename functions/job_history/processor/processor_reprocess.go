@@ -0,0 +1,182 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/searchc"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/validate"
+	"github.com/sirupsen/logrus"
+)
+
+// ReprocessProcessor rebuilds the host results of a job execution from Logscale, for executions whose record was
+// upserted before all of their host events landed.
+type ReprocessProcessor struct {
+	logger        logrus.FieldLogger
+	outputPolicy  OutputPolicy
+	savedSearches searchc.SavedSearches
+	srchc         searchc.SearchC
+	strgc         storagec.StorageC
+	clock         pkg.Clock
+}
+
+// NewReprocessProcessor returns a new ReprocessProcessor instance.
+func NewReprocessProcessor(srchc searchc.SearchC, strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *ReprocessProcessor)) *ReprocessProcessor {
+	p := &ReprocessProcessor{
+		logger:        logger,
+		outputPolicy:  DefaultOutputPolicy(),
+		savedSearches: searchc.DefaultSavedSearches(),
+		srchc:         srchc,
+		strgc:         strgc,
+		clock:         pkg.SystemClock,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// WithReprocessSavedSearches sets the saved searches run for the logical queries of the ReprocessProcessor.
+func WithReprocessSavedSearches(ss searchc.SavedSearches) func(p *ReprocessProcessor) {
+	return func(p *ReprocessProcessor) {
+		p.savedSearches = ss
+	}
+}
+
+// WithReprocessOutputPolicy sets the policy bounding the output of hosts stored on the execution records of the ReprocessProcessor.  Policies
+// without a positive inline limit are ignored.
+func WithReprocessOutputPolicy(op OutputPolicy) func(p *ReprocessProcessor) {
+	return func(p *ReprocessProcessor) {
+		if op.InlineLimit > 0 {
+			p.outputPolicy = op
+		}
+	}
+}
+
+// Process runs the execution results search again for the requested execution, and overwrites the targeted hosts,
+// host counts, status and duration of its record with the recomputed ones.  Records are left unchanged when
+// Logscale has no results for the execution.
+func (p *ReprocessProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	var rr reprocessRequest
+	if err := json.Unmarshal(req.Body, &rr); err != nil {
+		return errorResponse(newError(ErrBadRequest, "failed to parse request body: %s", err), p.logger)
+	}
+	if err := validate.Fields(validate.Field{Name: "execution_id", Value: rr.ExecutionID, Rules: []validate.Rule{validate.Required()}}); err != nil {
+		return errorResponse(err, p.logger)
+	}
+	execID := strings.TrimSpace(rr.ExecutionID)
+	logger := p.logger.WithField("execution_id", execID)
+
+	execKey, err := locateJobExecution(ctx, p.strgc, execID)
+	if err != nil {
+		err = fmt.Errorf("failed to locate job execution record: %w", err)
+		logger.Error(err)
+		return errorResponse(err, p.logger)
+	}
+	if execKey == "" {
+		return errorResponse(newError(ErrNotFound, "not found"), p.logger)
+	}
+
+	je, err := p.reprocess(ctx, execKey, logger)
+	if err != nil {
+		err = fmt.Errorf("failed to reprocess job execution: %w", err)
+		logger.Error(err)
+		return errorResponse(err, p.logger)
+	}
+	logger.WithField("num_hosts", je.NumHosts).Info("reprocessed job execution")
+
+	return Response{
+		Body: jobExecRespJSON(nil, []pkg.JobExecution{je}, nil, p.logger),
+		Code: http.StatusOK,
+	}
+}
+
+// reprocess rebuilds the record of the job execution stored under key and saves it, returning the updated record.
+func (p *ReprocessProcessor) reprocess(ctx context.Context, key string, logger logrus.FieldLogger) (pkg.JobExecution, error) {
+	execMap, version, err := fetchObject(ctx, p.strgc, jobExecutionCollection, key)
+	if err != nil {
+		return pkg.JobExecution{}, fmt.Errorf("failed to fetch job execution record: %w", err)
+	}
+	je, err := mapToJobExecution(execMap)
+	if err != nil {
+		return pkg.JobExecution{}, fmt.Errorf("failed to deserialize job execution record: %s", err)
+	}
+
+	// the job determines the saved searches and extraction rules to use, and the platforms it targets; without it
+	// the default saved searches are run and every extraction rule is tried, as by the EnrichmentProcessor
+	var j job
+	jobID := je.JobID
+	if jobID == "" {
+		jobID = je.ID
+	}
+	jobMap, _, err := fetchObject(ctx, p.strgc, jobCollection, jobID)
+	switch {
+	case errors.Is(err, storagec.NotFound):
+		logger.WithField("job_id", jobID).Warn("job record not found - reprocessing without its action type")
+		addWarning(ctx, "job %s not found - execution reprocessed without its action type", jobID)
+	case err != nil:
+		return pkg.JobExecution{}, fmt.Errorf("failed to fetch job record: %w", err)
+	default:
+		if j, err = distillJob(jobMap); err != nil {
+			return pkg.JobExecution{}, fmt.Errorf("could not distill job record from dictionary: %s", err)
+		}
+	}
+	if len(j.Steps) > 0 || len(je.Steps) > 0 {
+		return pkg.JobExecution{}, newError(ErrBadRequest, "the hosts of composite job executions are rolled up from their steps and cannot be reprocessed")
+	}
+
+	pages := searchc.NewPages(ctx, p.srchc, p.savedSearches.Requests(searchc.QueryExecutionResults, j.actionType(), map[string]string{
+		"execution_id": je.ExecutionID,
+	})...)
+	x, err := extractHosts(pages, j.actionType(), p.logger)
+	if err != nil {
+		return pkg.JobExecution{}, fmt.Errorf("failed to execute logscale search: %w", err)
+	}
+	if len(x.Hosts) == 0 {
+		return pkg.JobExecution{}, newError(ErrNotFound, "no host results found in logscale")
+	}
+	hosts := p.outputPolicy.apply(ctx, p.strgc, je.ID, je.ExecutionID, x.Hosts, p.logger)
+
+	prevStatus := je.RunStatus
+	je.TargetedHosts = hosts
+	je.NumHosts = len(hosts)
+	je.HostsTruncated = x.Truncated
+	je = flagPlatformMismatches(je, j.targetPlatforms())
+	hash, err := expectedFileHash(ctx, p.strgc, j)
+	if err != nil {
+		logger.Warnf("not verifying the integrity of the installed file: %s", err)
+	}
+	je = verifyFileIntegrity(je, hash)
+	je = applyHostResults(je)
+	je.RecordStatus(prevStatus, p.clock.Now().Format(pkg.ISOTimeFormat), "reprocess")
+	je.LogscaleOutput = pages.Response().JobURL
+	je.PendingEnrichment = false
+	je.EnrichmentAttempts = 0
+
+	if je.EndDate != "" || je.RunStatus == pkg.StatusInProgress {
+		d, secs, err := computeJobDuration(je.RunDate, je.EndDate, je.RunStatus, p.clock.Now())
+		if err != nil {
+			return pkg.JobExecution{}, fmt.Errorf("failed to compute job duration: %s", err)
+		}
+		if d != "" {
+			je.Duration = d
+			je.DurationSeconds = secs
+		}
+	}
+
+	data, err := json.Marshal(je)
+	if err != nil {
+		return pkg.JobExecution{}, fmt.Errorf("failed to serialize job execution record: %s", err)
+	}
+	if err = putObject(ctx, p.strgc, jobExecutionCollection, key, data, version); err != nil {
+		return pkg.JobExecution{}, err
+	}
+	return je, nil
+}
@@ -0,0 +1,192 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/validate"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/workflowc"
+	"github.com/sirupsen/logrus"
+)
+
+// RerunProcessor re-runs a job execution against only the hosts on which it failed.
+type RerunProcessor struct {
+	logger logrus.FieldLogger
+	strgc  storagec.StorageC
+	wfc    workflowc.WorkflowC
+	clock  pkg.Clock
+}
+
+// NewRerunProcessor returns a new RerunProcessor instance.
+func NewRerunProcessor(strgc storagec.StorageC, wfc workflowc.WorkflowC, logger logrus.FieldLogger, opts ...func(p *RerunProcessor)) *RerunProcessor {
+	p := &RerunProcessor{
+		logger: logger,
+		strgc:  strgc,
+		wfc:    wfc,
+		clock:  pkg.SystemClock,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// Process triggers a new execution of the job's workflow scoped to the failed hosts of the requested execution.
+// The new job execution record is linked to the original one through its retry_of field.
+func (p *RerunProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	var rr rerunRequest
+	if err := json.Unmarshal(req.Body, &rr); err != nil {
+		return errorResponse(newError(ErrBadRequest, "failed to parse request body: %s", err), p.logger)
+	}
+	if err := validate.Fields(validate.Field{Name: "execution_id", Value: rr.ExecutionID, Rules: []validate.Rule{validate.Required()}}); err != nil {
+		return errorResponse(err, p.logger)
+	}
+	execID := strings.TrimSpace(rr.ExecutionID)
+	logger := p.logger.WithField("execution_id", execID)
+
+	execKey, err := locateJobExecution(ctx, p.strgc, execID)
+	if err != nil {
+		err = fmt.Errorf("failed to locate job execution record: %w", err)
+		logger.Error(err)
+		return errorResponse(err, p.logger)
+	}
+	if execKey == "" {
+		return errorResponse(newError(ErrNotFound, "not found"), p.logger)
+	}
+	execMap, _, err := fetchObject(ctx, p.strgc, jobExecutionCollection, execKey)
+	if err != nil {
+		err = fmt.Errorf("failed to fetch job execution record: %w", err)
+		logger.Error(err)
+		return errorResponse(err, p.logger)
+	}
+	orig, err := mapToJobExecution(execMap)
+	if err != nil {
+		err = fmt.Errorf("failed to deserialize job execution record: %s", err)
+		logger.Error(err)
+		return errorResponse(err, p.logger)
+	}
+
+	failed := failedHosts(orig.TargetedHosts)
+	if len(failed) == 0 {
+		return errorResponse(newError(ErrBadRequest, "job execution has no failed hosts to re-run"), p.logger)
+	}
+
+	jobID := orig.JobID
+	if jobID == "" {
+		jobID = orig.ID
+	}
+	logger = logger.WithField("job_id", jobID)
+	jobMap, _, err := fetchObject(ctx, p.strgc, jobCollection, jobID)
+	if err != nil {
+		err = fmt.Errorf("could not fetch job record: %w", err)
+		logger.Error(err)
+		return errorResponse(err, p.logger)
+	}
+	j, err := distillJob(jobMap)
+	if err != nil {
+		err = fmt.Errorf("could not distill job record from dictionary: %s", err)
+		logger.Error(err)
+		return errorResponse(err, p.logger)
+	}
+	if j.Paused {
+		return errorResponse(newError(ErrConflict, "job is paused"), p.logger)
+	}
+	if j.Workflows == nil || j.Workflows.ScheduleWorkflow == "" {
+		return errorResponse(newError(ErrConflict, "job has no workflow to execute"), p.logger)
+	}
+
+	newExec, err := p.rerun(ctx, j.Workflows.ScheduleWorkflow, orig, failed)
+	if err != nil {
+		err = fmt.Errorf("failed to re-run job execution: %w", err)
+		logger.Error(err)
+		return errorResponse(err, p.logger)
+	}
+
+	return Response{
+		Body: jobExecRespJSON(nil, []pkg.JobExecution{newExec}, nil, p.logger),
+		Code: http.StatusOK,
+	}
+}
+
+func (p *RerunProcessor) rerun(ctx context.Context, definitionID string, orig pkg.JobExecution, hosts []pkg.TargetedHost) (pkg.JobExecution, error) {
+	return executeForHosts(ctx, p.strgc, p.wfc, p.clock.Now(), definitionID, pkg.JobExecution{
+		ID:        orig.ID,
+		JobID:     orig.JobID,
+		JobName:   orig.JobName,
+		OwnerID:   orig.OwnerID,
+		OwnerName: orig.OwnerName,
+		RetryOf:   orig.ExecutionID,
+	}, hosts)
+}
+
+// executeForHosts triggers an execution of the workflow definition scoped to the hosts, and saves its record,
+// made from base, as in progress on the hosts.
+func executeForHosts(ctx context.Context, strgc storagec.StorageC, wfc workflowc.WorkflowC, now time.Time, definitionID string, base pkg.JobExecution, hosts []pkg.TargetedHost) (pkg.JobExecution, error) {
+	targets := rerunTargets{
+		DeviceIDs: make([]string, 0, len(hosts)),
+		HostNames: make([]string, 0, len(hosts)),
+	}
+	for _, h := range hosts {
+		if h.DeviceID != "" {
+			targets.DeviceIDs = append(targets.DeviceIDs, h.DeviceID)
+		}
+		targets.HostNames = append(targets.HostNames, h.HostName)
+	}
+	payload, err := json.Marshal(targets)
+	if err != nil {
+		return pkg.JobExecution{}, fmt.Errorf("failed to serialize workflow payload: %s", err)
+	}
+
+	resp, err := wfc.Execute(ctx, workflowc.ExecuteRequest{
+		DefinitionID: definitionID,
+		Payload:      payload,
+	})
+	if err != nil {
+		return pkg.JobExecution{}, err
+	}
+	if resp.ExecutionID == "" {
+		return pkg.JobExecution{}, errors.New("workflow execution ID missing from response")
+	}
+
+	execHosts := make([]pkg.TargetedHost, len(hosts))
+	for i, h := range hosts {
+		execHosts[i] = pkg.TargetedHost{
+			DeviceID: h.DeviceID,
+			HostName: h.HostName,
+			Status:   pkg.StatusInProgress,
+		}
+	}
+	newExec := base
+	newExec.ExecutionID = resp.ExecutionID
+	newExec.NumHosts = len(execHosts)
+	newExec.RunDate = now.Format(pkg.ISOTimeFormat)
+	newExec.RunStatus = pkg.StatusInProgress
+	newExec.TargetedHosts = execHosts
+	data, err := json.Marshal(newExec)
+	if err != nil {
+		return pkg.JobExecution{}, fmt.Errorf("failed to serialize job execution record: %s", err)
+	}
+	key := fmt.Sprintf("%d_%s", now.UnixNano(), resp.ExecutionID)
+	if err = putObject(ctx, strgc, jobExecutionCollection, key, data, ""); err != nil {
+		return pkg.JobExecution{}, fmt.Errorf("workflow execution %s started but its record could not be saved: %w", resp.ExecutionID, err)
+	}
+	return newExec, nil
+}
+
+func failedHosts(hosts []pkg.TargetedHost) []pkg.TargetedHost {
+	failed := make([]pkg.TargetedHost, 0)
+	for _, h := range hosts {
+		if h.Status == pkg.StatusFailed {
+			failed = append(failed, h)
+		}
+	}
+	return failed
+}
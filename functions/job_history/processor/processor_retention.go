@@ -0,0 +1,214 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/sirupsen/logrus"
+)
+
+// RetentionProcessor prunes job execution records according to the retention settings.
+// It is meant to be invoked on a schedule by a workflow.
+type RetentionProcessor struct {
+	logger logrus.FieldLogger
+	strgc  storagec.StorageC
+	clock  pkg.Clock
+}
+
+// NewRetentionProcessor returns a new RetentionProcessor instance.
+func NewRetentionProcessor(strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *RetentionProcessor)) *RetentionProcessor {
+	p := &RetentionProcessor{
+		logger: logger,
+		strgc:  strgc,
+		clock:  pkg.SystemClock,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// Process deletes the job executions which are older than the configured maximum age and those which exceed
+// the configured number of executions to keep per job.  Nothing is deleted if the request asks for a dry run.
+// Runs overlapping a run which is deleting executions fail with a conflict.
+func (p *RetentionProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	var rr retentionRequest
+	if len(req.Body) > 0 {
+		if err := json.Unmarshal(req.Body, &rr); err != nil {
+			return p.errResp(newError(ErrBadRequest, "failed to parse request body: %s", err))
+		}
+	}
+
+	var settings retentionSettings
+	err := fetchSettings(ctx, p.strgc, retentionSettingsName, &settings)
+	if errors.Is(err, storagec.NotFound) {
+		p.logger.Info("no retention settings configured - nothing to prune")
+		return Response{
+			Body: p.retentionRespJSON([]retentionResult{{DryRun: rr.DryRun, ObjectKeys: make([]string, 0)}}, nil),
+			Code: http.StatusOK,
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to fetch retention settings: %w", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+
+	keys, err := p.expiredExecutions(ctx, settings)
+	if err != nil {
+		err = fmt.Errorf("failed to determine expired job executions: %w", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+
+	result := retentionResult{DryRun: rr.DryRun, ObjectKeys: keys}
+	if rr.DryRun {
+		return Response{
+			Body: p.retentionRespJSON([]retentionResult{result}, nil),
+			Code: http.StatusOK,
+		}
+	}
+
+	unlock, err := lockTask(ctx, p.strgc, p.clock, p.logger, retentionLock)
+	if err != nil {
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+	defer unlock()
+
+	errs := make([]fdk.APIError, 0)
+	for _, k := range keys {
+		err = p.strgc.DeleteObject(ctx, storagec.DeleteObjectRequest{
+			Collection: jobExecutionCollection,
+			ObjectKey:  k,
+		})
+		if err != nil && !errors.Is(err, storagec.NotFound) {
+			err = fmt.Errorf("failed to delete job execution %s: %w", k, err)
+			p.logger.Error(err)
+			errs = append(errs, apiError(err))
+			result.Failed++
+			continue
+		}
+		result.Deleted++
+	}
+	p.logger.WithField("deleted", result.Deleted).
+		WithField("failed", result.Failed).
+		Info("pruned job executions")
+
+	code := http.StatusOK
+	if len(errs) > 0 {
+		code = http.StatusMultiStatus
+	}
+	return Response{
+		Body: p.retentionRespJSON([]retentionResult{result}, errs),
+		Code: code,
+	}
+}
+
+// expiredExecutions returns the keys of the job executions which fall outside the retention limits.
+func (p *RetentionProcessor) expiredExecutions(ctx context.Context, settings retentionSettings) ([]string, error) {
+	expired := make(map[string]struct{})
+
+	if settings.MaxAgeDays > 0 {
+		cutoff := p.clock.Now().Add(-time.Duration(settings.MaxAgeDays) * 24 * time.Hour)
+		filter, err := pkg.NewFQLQuery([]pkg.Filter{{
+			Field: "run_date",
+			Op:    pkg.LT,
+			Value: cutoff.Format(pkg.ISOTimeFormat),
+		}})
+		if err != nil {
+			return nil, fmt.Errorf("error constructing FQL query: %s", err)
+		}
+		sr, err := p.strgc.SearchAll(ctx, storagec.SearchObjectsRequest{
+			Collection: jobExecutionCollection,
+			Filter:     filter,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error retrieving records: %s", err)
+		}
+		for _, k := range sr.ObjectKeys {
+			expired[k] = struct{}{}
+		}
+	}
+
+	if settings.KeepLast > 0 {
+		jobIDs, err := p.jobIDs(ctx)
+		if err != nil {
+			return nil, err
+		}
+		sortBy, err := pkg.NewFQLSort("run_date", pkg.Desc)
+		if err != nil {
+			return nil, fmt.Errorf("error constructing FQL sort: %s", err)
+		}
+		for _, id := range jobIDs {
+			filter, err := pkg.NewFQLQuery([]pkg.Filter{{Field: "id", Op: pkg.EQ, Value: id}})
+			if err != nil {
+				return nil, fmt.Errorf("error constructing FQL query: %s", err)
+			}
+			sr, err := p.strgc.SearchAll(ctx, storagec.SearchObjectsRequest{
+				Collection: jobExecutionCollection,
+				Filter:     filter,
+				Sort:       sortBy,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("error retrieving records of job %s: %s", id, err)
+			}
+			if len(sr.ObjectKeys) <= settings.KeepLast {
+				continue
+			}
+			for _, k := range sr.ObjectKeys[settings.KeepLast:] {
+				expired[k] = struct{}{}
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(expired))
+	for k := range expired {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// jobIDs returns the IDs of all the jobs.
+func (p *RetentionProcessor) jobIDs(ctx context.Context) ([]string, error) {
+	filter, err := pkg.NewFQLQuery([]pkg.Filter{{Field: "created_at", Op: pkg.GTE, Value: "0"}})
+	if err != nil {
+		return nil, fmt.Errorf("error constructing FQL query: %s", err)
+	}
+	sr, err := p.strgc.SearchAll(ctx, storagec.SearchObjectsRequest{
+		Collection: jobCollection,
+		Filter:     filter,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving jobs: %s", err)
+	}
+	return sr.ObjectKeys, nil
+}
+
+func (p *RetentionProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return p.retentionRespJSON(nil, errs)
+	})
+}
+
+func (p *RetentionProcessor) retentionRespJSON(r []retentionResult, e []fdk.APIError) []byte {
+	if r == nil {
+		r = make([]retentionResult, 0)
+	}
+	resp := retentionResponse{Errs: e, Resources: r}
+	rJSON, err := json.Marshal(resp)
+	if err != nil {
+		p.logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
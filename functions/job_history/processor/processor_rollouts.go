@@ -0,0 +1,607 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/hostsc"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/validate"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/workflowc"
+	"github.com/sirupsen/logrus"
+)
+
+// Statuses of rollouts.
+const (
+	// rolloutRunning is the status of rollouts with waves left to run.
+	rolloutRunning = "running"
+	// rolloutCompleted is the status of rollouts which ran every wave.
+	rolloutCompleted = "completed"
+	// rolloutAborted is the status of rollouts whose remaining waves were halted, see jobRollout.AbortFailureRate.
+	rolloutAborted = "aborted"
+)
+
+// Statuses of rollout waves.
+const (
+	wavePending  = "pending"
+	waveRunning  = "running"
+	waveFinished = "finished"
+	// waveHalted is the status of the waves which never ran because their rollout was aborted.
+	waveHalted = "halted"
+)
+
+// StartRolloutProcessor starts the rollout of a job to its target hosts in waves of the batch size configured by
+// the rollout of the job.  The first wave is started immediately, the following ones by the
+// AdvanceRolloutsProcessor.
+type StartRolloutProcessor struct {
+	clock  pkg.Clock
+	hstc   hostsc.HostC
+	logger logrus.FieldLogger
+	strgc  storagec.StorageC
+	wfc    workflowc.WorkflowC
+}
+
+// NewStartRolloutProcessor returns a new StartRolloutProcessor instance.
+func NewStartRolloutProcessor(strgc storagec.StorageC, wfc workflowc.WorkflowC, hstc hostsc.HostC, logger logrus.FieldLogger, opts ...func(p *StartRolloutProcessor)) *StartRolloutProcessor {
+	p := &StartRolloutProcessor{
+		clock:  pkg.SystemClock,
+		hstc:   hstc,
+		logger: logger,
+		strgc:  strgc,
+		wfc:    wfc,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// Process partitions the target hosts of the job into waves and starts the first one.  A job has at most one
+// running rollout.
+func (p *StartRolloutProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	var sr startRolloutRequest
+	if err := json.Unmarshal(req.Body, &sr); err != nil {
+		return p.errResp(newError(ErrBadRequest, "failed to parse request body: %s", err))
+	}
+	if err := validate.Fields(validate.Field{Name: "job_id", Value: sr.JobID, Rules: []validate.Rule{validate.Required()}}); err != nil {
+		return p.errResp(err)
+	}
+	jobID := strings.TrimSpace(sr.JobID)
+	logger := p.logger.WithField("job_id", jobID)
+
+	jobMap, _, err := fetchObject(ctx, p.strgc, jobCollection, jobID)
+	if errors.Is(err, storagec.NotFound) {
+		return p.errResp(newError(ErrNotFound, "not found"))
+	}
+	if err != nil {
+		err = fmt.Errorf("could not fetch job record: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	j, err := distillJob(jobMap)
+	if err != nil {
+		err = fmt.Errorf("could not distill job record from dictionary: %s", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	switch {
+	case j.Rollout == nil || j.Rollout.BatchSize < 1:
+		return p.errResp(newError(ErrBadRequest, "job has no rollout configured"))
+	case j.Paused:
+		return p.errResp(newError(ErrConflict, "job is paused"))
+	case j.Workflows == nil || j.Workflows.ScheduleWorkflow == "":
+		return p.errResp(newError(ErrConflict, "job has no workflow to execute"))
+	}
+	open, err := j.MaintenanceWindow.open(p.clock.Now())
+	if err != nil {
+		return p.errResp(newError(ErrConflict, "%s", err))
+	}
+	if !open {
+		return p.errResp(newError(ErrConflict, "job is outside its maintenance window"))
+	}
+
+	running, err := runningRollouts(ctx, p.strgc, jobID)
+	if err != nil {
+		err = fmt.Errorf("failed to search for running rollouts: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	if len(running) > 0 {
+		return p.errResp(newError(ErrConflict, "job already has a running rollout %s", running[0]))
+	}
+
+	hosts, err := p.targetHosts(ctx, j)
+	if err != nil {
+		err = fmt.Errorf("failed to resolve the target hosts of the job: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	if len(hosts) == 0 {
+		return p.errResp(newError(ErrConflict, "job targets no hosts"))
+	}
+
+	now := p.clock.Now()
+	r := rollout{
+		AbortFailureRate: j.Rollout.AbortFailureRate,
+		ID:               fmt.Sprintf("%s_%d", jobID, now.UnixNano()),
+		JobID:            jobID,
+		JobName:          j.Name,
+		StartedAt:        now.Format(pkg.ISOTimeFormat),
+		StartedBy:        callerFromRequest(req).Name,
+		Status:           rolloutRunning,
+		WaitSeconds:      j.Rollout.WaitSeconds,
+		Waves:            partitionWaves(hosts, j.Rollout.BatchSize),
+	}
+	if err = startWave(ctx, p.strgc, p.wfc, now, j, &r, 0); err != nil {
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	if err = putRollout(ctx, p.strgc, r, ""); err != nil {
+		err = fmt.Errorf("wave 1 of rollout %s started but the rollout could not be saved: %w", r.ID, err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	logger.WithField("rollout_id", r.ID).
+		WithField("hosts", len(hosts)).
+		WithField("waves", len(r.Waves)).
+		Info("started rollout")
+
+	return Response{
+		Body: rolloutRespJSON([]rollout{r}, nil, p.logger),
+		Code: http.StatusOK,
+	}
+}
+
+// targetHosts returns the hosts targeted by the job, with the members of its host groups, leaving out those of
+// platforms the job does not target.
+func (p *StartRolloutProcessor) targetHosts(ctx context.Context, j job) ([]pkg.ResolvedHost, error) {
+	if j.Target == nil {
+		return nil, nil
+	}
+	var found []hostsc.Host
+	if len(j.Target.Hosts) > 0 {
+		details, err := p.hstc.Details(ctx, j.Target.Hosts)
+		if err != nil {
+			return nil, err
+		}
+		// the details are in no particular order
+		sort.Slice(details, func(i, k int) bool {
+			return details[i].HostName < details[k].HostName
+		})
+		found = append(found, details...)
+	}
+	if len(j.Target.HostGroups) > 0 {
+		members, err := p.hstc.GroupMembers(ctx, j.Target.HostGroups)
+		if err != nil {
+			return nil, err
+		}
+		found = append(found, members...)
+	}
+
+	platforms := make(map[string]bool)
+	for _, pl := range j.targetPlatforms() {
+		platforms[pl] = true
+	}
+	seen := make(map[string]bool, len(found))
+	hosts := make([]pkg.ResolvedHost, 0, len(found))
+	for _, h := range found {
+		if seen[h.DeviceID] || (len(platforms) > 0 && h.Platform != "" && !platforms[h.Platform]) {
+			continue
+		}
+		seen[h.DeviceID] = true
+		hosts = append(hosts, pkg.ResolvedHost{DeviceID: h.DeviceID, HostName: h.HostName, Platform: h.Platform})
+	}
+	return hosts, nil
+}
+
+func (p *StartRolloutProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return rolloutRespJSON(nil, errs, p.logger)
+	})
+}
+
+// RolloutsProcessor lists the rollouts of a job, or of every job, latest first.
+type RolloutsProcessor struct {
+	logger logrus.FieldLogger
+	strgc  storagec.StorageC
+}
+
+// NewRolloutsProcessor returns a new RolloutsProcessor instance.
+func NewRolloutsProcessor(strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *RolloutsProcessor)) *RolloutsProcessor {
+	p := &RolloutsProcessor{
+		logger: logger,
+		strgc:  strgc,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// Process handles a request.  The job_id and status query parameters filter the rollouts.
+func (p *RolloutsProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	filters := []pkg.Filter{{Field: "started_at", Op: pkg.GTE, Value: "0"}}
+	if jobID := queryParam(req.Params.Query, "job_id"); jobID != "" {
+		filters = append(filters, pkg.Filter{Field: "job_id", Op: pkg.EQ, Value: jobID})
+	}
+	if status := queryParam(req.Params.Query, "status"); status != "" {
+		filters = append(filters, pkg.Filter{Field: "status", Op: pkg.EQ, Value: status})
+	}
+	filter, err := pkg.NewFQLQuery(filters)
+	if err != nil {
+		return p.errResp(newError(ErrBadRequest, "invalid filter: %s", err))
+	}
+	sr, err := p.strgc.SearchAll(ctx, storagec.SearchObjectsRequest{Collection: rolloutCollection, Filter: filter})
+	if err != nil {
+		err = fmt.Errorf("failed to search for rollouts: %w", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+	resp := p.strgc.BulkFetch(ctx, storagec.BulkFetchObjectsRequest{
+		Collection: rolloutCollection,
+		ObjectKeys: sr.ObjectKeys,
+	})
+	errs := make([]fdk.APIError, 0)
+	for k, err := range resp.Errs {
+		if errors.Is(err, storagec.NotFound) {
+			continue
+		}
+		err = fmt.Errorf("failed to fetch rollout %s: %w", k, err)
+		p.logger.Error(err)
+		errs = append(errs, apiError(err))
+	}
+	rollouts := make([]rollout, 0, len(resp.Objects))
+	for k, data := range resp.Objects {
+		var r rollout
+		if err = json.Unmarshal(data, &r); err != nil {
+			err = fmt.Errorf("failed to deserialize rollout %s: %s", k, err)
+			p.logger.Error(err)
+			errs = append(errs, apiError(err))
+			continue
+		}
+		rollouts = append(rollouts, r)
+	}
+	sort.Slice(rollouts, func(i, j int) bool {
+		return rollouts[i].StartedAt > rollouts[j].StartedAt
+	})
+
+	code := http.StatusOK
+	if len(errs) > 0 {
+		code = http.StatusMultiStatus
+	}
+	return Response{
+		Body: rolloutRespJSON(rollouts, errs, p.logger),
+		Code: code,
+	}
+}
+
+func (p *RolloutsProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return rolloutRespJSON(nil, errs, p.logger)
+	})
+}
+
+// AdvanceRolloutsProcessor advances the running rollouts: it records the results of the waves whose executions
+// finished, halts the remaining waves of the rollouts whose failure rate exceeds their abort threshold, and starts
+// the next wave of the others once the wait between waves has passed.  It is meant to be invoked on a schedule by
+// a workflow.
+type AdvanceRolloutsProcessor struct {
+	clock  pkg.Clock
+	logger logrus.FieldLogger
+	strgc  storagec.StorageC
+	wfc    workflowc.WorkflowC
+}
+
+// NewAdvanceRolloutsProcessor returns a new AdvanceRolloutsProcessor instance.
+func NewAdvanceRolloutsProcessor(strgc storagec.StorageC, wfc workflowc.WorkflowC, logger logrus.FieldLogger, opts ...func(p *AdvanceRolloutsProcessor)) *AdvanceRolloutsProcessor {
+	p := &AdvanceRolloutsProcessor{
+		clock:  pkg.SystemClock,
+		logger: logger,
+		strgc:  strgc,
+		wfc:    wfc,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// Process handles a request.
+func (p *AdvanceRolloutsProcessor) Process(ctx context.Context, _ fdk.Request) Response {
+	keys, err := runningRollouts(ctx, p.strgc, "")
+	if err != nil {
+		err = fmt.Errorf("failed to search for running rollouts: %w", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+
+	var result advanceRolloutsResult
+	errs := make([]fdk.APIError, 0)
+	for _, key := range keys {
+		r, err := p.advance(ctx, key)
+		if errors.Is(err, storagec.NotFound) {
+			continue
+		}
+		if errors.Is(err, storagec.VersionConflict) {
+			// the rollout is being advanced concurrently, and is left to the next run
+			continue
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to advance rollout %s: %w", key, err)
+			p.logger.Error(err)
+			errs = append(errs, apiError(err))
+			continue
+		}
+		result.Checked++
+		switch r.status {
+		case rolloutAborted:
+			result.Aborted++
+		case rolloutCompleted:
+			result.Completed++
+		}
+		if r.started {
+			result.WavesStarted++
+		}
+	}
+	p.logger.WithField("checked", result.Checked).
+		WithField("aborted", result.Aborted).
+		WithField("completed", result.Completed).
+		WithField("waves_started", result.WavesStarted).
+		Info("advanced rollouts")
+
+	code := http.StatusOK
+	if len(errs) > 0 {
+		code = http.StatusMultiStatus
+	}
+	return Response{
+		Body: p.advanceRolloutsRespJSON([]advanceRolloutsResult{result}, errs),
+		Code: code,
+	}
+}
+
+// advanced is the outcome of advancing a rollout.
+type advanced struct {
+	// started is true if a wave was started.
+	started bool
+	// status is the status of the rollout if it changed.
+	status string
+}
+
+// advance advances the rollout stored under key, saving it if it changed.
+func (p *AdvanceRolloutsProcessor) advance(ctx context.Context, key string) (advanced, error) {
+	m, version, err := fetchObject(ctx, p.strgc, rolloutCollection, key)
+	if err != nil {
+		return advanced{}, err
+	}
+	var r rollout
+	b, err := json.Marshal(m)
+	if err == nil {
+		err = json.Unmarshal(b, &r)
+	}
+	if err != nil {
+		return advanced{}, fmt.Errorf("failed to deserialize rollout record: %s", err)
+	}
+	if r.Status != rolloutRunning {
+		return advanced{}, nil
+	}
+	now := p.clock.Now()
+
+	next := -1
+	for i, w := range r.Waves {
+		if w.Status == waveRunning {
+			done, err := p.finishWave(ctx, &r.Waves[i], now)
+			if err != nil || !done {
+				return advanced{}, err
+			}
+			r.SucceededHosts += r.Waves[i].SucceededHosts
+			r.FailedHosts += r.Waves[i].FailedHosts
+		}
+		if r.Waves[i].Status == wavePending && next < 0 {
+			next = i
+		}
+	}
+
+	var out advanced
+	reported := r.SucceededHosts + r.FailedHosts
+	switch {
+	case r.AbortFailureRate > 0 && reported > 0 && float64(r.FailedHosts)/float64(reported) > r.AbortFailureRate:
+		r.Status, out.status = rolloutAborted, rolloutAborted
+		r.AbortReason = fmt.Sprintf("%d of %d hosts failed, exceeding the abort failure rate of %v", r.FailedHosts, reported, r.AbortFailureRate)
+		r.EndedAt = now.Format(pkg.ISOTimeFormat)
+		for i := range r.Waves {
+			if r.Waves[i].Status == wavePending {
+				r.Waves[i].Status = waveHalted
+			}
+		}
+	case next < 0:
+		r.Status, out.status = rolloutCompleted, rolloutCompleted
+		r.EndedAt = now.Format(pkg.ISOTimeFormat)
+	case next > 0 && !waitedFor(r.Waves[next-1].EndedAt, r.WaitSeconds, now):
+	default:
+		j, err := p.fetchJob(ctx, r.JobID)
+		if err != nil {
+			return advanced{}, err
+		}
+		if j.Paused {
+			// the rollout resumes with the job
+			break
+		}
+		open, err := j.MaintenanceWindow.open(now)
+		if err != nil {
+			return advanced{}, err
+		}
+		if !open {
+			// the next wave starts once the maintenance window of the job opens
+			break
+		}
+		if j.Workflows == nil || j.Workflows.ScheduleWorkflow == "" {
+			return advanced{}, errors.New("job has no workflow to execute")
+		}
+		if err = startWave(ctx, p.strgc, p.wfc, now, j, &r, next); err != nil {
+			return advanced{}, err
+		}
+		out.started = true
+	}
+
+	err = putRollout(ctx, p.strgc, r, version)
+	if err != nil && out.started {
+		err = fmt.Errorf("wave %d started but the rollout could not be saved: %w", r.Waves[next].Wave, err)
+	}
+	return out, err
+}
+
+// finishWave records the results of a running wave if its execution finished, reporting whether it did.
+func (p *AdvanceRolloutsProcessor) finishWave(ctx context.Context, w *rolloutWave, now time.Time) (bool, error) {
+	key, err := locateJobExecution(ctx, p.strgc, w.ExecutionID)
+	if err != nil {
+		return false, fmt.Errorf("failed to locate the execution of wave %d: %w", w.Wave, err)
+	}
+	if key == "" {
+		return false, fmt.Errorf("execution %s of wave %d not found", w.ExecutionID, w.Wave)
+	}
+	execMap, _, err := fetchObject(ctx, p.strgc, jobExecutionCollection, key)
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch the execution of wave %d: %w", w.Wave, err)
+	}
+	je, err := mapToJobExecution(execMap)
+	if err != nil {
+		return false, fmt.Errorf("failed to deserialize the execution of wave %d: %s", w.Wave, err)
+	}
+	switch je.RunStatus {
+	case pkg.StatusCompleted, pkg.StatusCompletedWithErrors, pkg.StatusFailed, pkg.StatusTimedOut:
+	default:
+		return false, nil
+	}
+	w.Status = waveFinished
+	w.SucceededHosts, w.FailedHosts = je.SucceededHosts, je.FailedHosts
+	w.EndedAt = je.EndDate
+	if w.EndedAt == "" {
+		w.EndedAt = now.Format(pkg.ISOTimeFormat)
+	}
+	return true, nil
+}
+
+func (p *AdvanceRolloutsProcessor) fetchJob(ctx context.Context, jobID string) (job, error) {
+	jobMap, _, err := fetchObject(ctx, p.strgc, jobCollection, jobID)
+	if err != nil {
+		return job{}, fmt.Errorf("could not fetch job record: %w", err)
+	}
+	j, err := distillJob(jobMap)
+	if err != nil {
+		return job{}, fmt.Errorf("could not distill job record from dictionary: %s", err)
+	}
+	return j, nil
+}
+
+func (p *AdvanceRolloutsProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return p.advanceRolloutsRespJSON(nil, errs)
+	})
+}
+
+func (p *AdvanceRolloutsProcessor) advanceRolloutsRespJSON(r []advanceRolloutsResult, e []fdk.APIError) []byte {
+	if r == nil {
+		r = make([]advanceRolloutsResult, 0)
+	}
+	resp := advanceRolloutsResponse{Errs: e, Resources: r}
+	rJSON, err := json.Marshal(resp)
+	if err != nil {
+		p.logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
+
+// partitionWaves splits the hosts into waves of at most batchSize hosts, in order.
+func partitionWaves(hosts []pkg.ResolvedHost, batchSize int) []rolloutWave {
+	waves := make([]rolloutWave, 0, (len(hosts)+batchSize-1)/batchSize)
+	for i := 0; i < len(hosts); i += batchSize {
+		end := min(i+batchSize, len(hosts))
+		waves = append(waves, rolloutWave{
+			Hosts:  hosts[i:end],
+			Status: wavePending,
+			Wave:   len(waves) + 1,
+		})
+	}
+	return waves
+}
+
+// startWave starts the ith wave of the rollout of job j, triggering an execution of the workflow of the job scoped
+// to the hosts of the wave.
+func startWave(ctx context.Context, strgc storagec.StorageC, wfc workflowc.WorkflowC, now time.Time, j job, r *rollout, i int) error {
+	w := &r.Waves[i]
+	hosts := make([]pkg.TargetedHost, len(w.Hosts))
+	for k, h := range w.Hosts {
+		hosts[k] = pkg.TargetedHost{DeviceID: h.DeviceID, HostName: h.HostName, Platform: h.Platform}
+	}
+	je, err := executeForHosts(ctx, strgc, wfc, now, j.Workflows.ScheduleWorkflow, pkg.JobExecution{
+		ID:          r.JobID,
+		JobID:       r.JobID,
+		JobName:     r.JobName,
+		OwnerID:     j.UserID,
+		OwnerName:   j.UserName,
+		RolloutID:   r.ID,
+		RolloutWave: w.Wave,
+	}, hosts)
+	if err != nil {
+		return fmt.Errorf("failed to start wave %d: %w", w.Wave, err)
+	}
+	w.ExecutionID, w.StartedAt, w.Status = je.ExecutionID, je.RunDate, waveRunning
+	return nil
+}
+
+// waitedFor reports whether waitSeconds have passed since the timestamp at.  Timestamps which cannot be parsed
+// are considered to have been waited for.
+func waitedFor(at string, waitSeconds int64, now time.Time) bool {
+	t, err := time.Parse(pkg.ISOTimeFormat, at)
+	if err != nil {
+		return true
+	}
+	return !now.Before(t.Add(time.Duration(waitSeconds) * time.Second))
+}
+
+// runningRollouts returns the keys of the running rollouts of the job, or of every job if jobID is blank.
+func runningRollouts(ctx context.Context, strgc storagec.StorageC, jobID string) ([]string, error) {
+	filters := []pkg.Filter{{Field: "status", Op: pkg.EQ, Value: rolloutRunning}}
+	if jobID != "" {
+		filters = append(filters, pkg.Filter{Field: "job_id", Op: pkg.EQ, Value: jobID})
+	}
+	filter, err := pkg.NewFQLQuery(filters)
+	if err != nil {
+		return nil, fmt.Errorf("error constructing FQL query: %s", err)
+	}
+	sr, err := strgc.SearchAll(ctx, storagec.SearchObjectsRequest{Collection: rolloutCollection, Filter: filter})
+	if err != nil {
+		return nil, err
+	}
+	return sr.ObjectKeys, nil
+}
+
+func putRollout(ctx context.Context, strgc storagec.StorageC, r rollout, version string) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to serialize rollout record: %s", err)
+	}
+	return putObject(ctx, strgc, rolloutCollection, r.ID, b, version)
+}
+
+func rolloutRespJSON(r []rollout, e []fdk.APIError, logger logrus.FieldLogger) []byte {
+	if r == nil {
+		r = make([]rollout, 0)
+	}
+	resp := rolloutResponse{Errs: e, Resources: r}
+	rJSON, err := json.Marshal(resp)
+	if err != nil {
+		logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
@@ -0,0 +1,123 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/sirupsen/logrus"
+)
+
+// SchedulePreviewProcessor projects the runs of a job schedule without creating the job.
+type SchedulePreviewProcessor struct {
+	logger logrus.FieldLogger
+	clock  pkg.Clock
+}
+
+// NewSchedulePreviewProcessor returns a new SchedulePreviewProcessor instance.
+func NewSchedulePreviewProcessor(logger logrus.FieldLogger, opts ...func(p *SchedulePreviewProcessor)) *SchedulePreviewProcessor {
+	p := &SchedulePreviewProcessor{
+		logger: logger,
+		clock:  pkg.SystemClock,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// Process returns the next projected run times of the schedule in the request along with the total number of
+// recurrences, computed the same way as when the job is upserted.  The total is 0 if the schedule has no end.
+func (p *SchedulePreviewProcessor) Process(_ context.Context, req fdk.Request) Response {
+	var pr schedulePreviewRequest
+	if err := json.Unmarshal(req.Body, &pr); err != nil {
+		return p.errResp(newError(ErrBadRequest, "failed to parse request body: %s", err))
+	}
+	if pr.Schedule == nil || pr.Schedule.TimeCycle == "" {
+		return p.errResp(newError(ErrBadRequest, "missing schedule time_cycle"))
+	}
+
+	count := pr.Count
+	switch {
+	case count <= 0:
+		count = defaultPreviewRuns
+	case count > maxPreviewRuns:
+		count = maxPreviewRuns
+	}
+
+	preview, err := p.preview(pr.Schedule, count)
+	if err != nil {
+		return p.errResp(newError(ErrBadRequest, "%s", err))
+	}
+	return Response{
+		Body: p.schedulePreviewRespJSON([]schedulePreview{preview}, nil),
+		Code: http.StatusOK,
+	}
+}
+
+func (p *SchedulePreviewProcessor) preview(js *jobSchedule, count int) (schedulePreview, error) {
+	preview := schedulePreview{NextRuns: make([]time.Time, 0, count)}
+
+	s, err := parseJobSchedule(js)
+	if err != nil {
+		return preview, fmt.Errorf("failed to parse schedule cron expression: %s", err)
+	}
+
+	from := p.clock.Now()
+	if js.Start != "" {
+		start, err := time.Parse(pkg.ISOTimeFormat, js.Start)
+		if err != nil {
+			return preview, fmt.Errorf("failed to parse schedule start time: %s", err)
+		}
+		if start.After(from) {
+			from = start
+		}
+	}
+
+	var end time.Time
+	if js.End != "" {
+		end, err = time.Parse(pkg.ISOTimeFormat, js.End)
+		if err != nil {
+			return preview, fmt.Errorf("failed to parse schedule end time: %s", err)
+		}
+	}
+
+	t := s.Next(from)
+	for !t.IsZero() && (end.IsZero() || !t.After(end)) {
+		if len(preview.NextRuns) < count {
+			preview.NextRuns = append(preview.NextRuns, t.UTC())
+		} else if end.IsZero() {
+			// unlimited number of executions - doesn't make sense to report the number total
+			break
+		}
+		preview.TotalRecurrences++
+		t = s.Next(t)
+	}
+	if end.IsZero() {
+		preview.TotalRecurrences = 0
+	}
+	return preview, nil
+}
+
+func (p *SchedulePreviewProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return p.schedulePreviewRespJSON(nil, errs)
+	})
+}
+
+func (p *SchedulePreviewProcessor) schedulePreviewRespJSON(r []schedulePreview, e []fdk.APIError) []byte {
+	if r == nil {
+		r = make([]schedulePreview, 0)
+	}
+	resp := schedulePreviewResponse{Errs: e, Resources: r}
+	rJSON, err := json.Marshal(resp)
+	if err != nil {
+		p.logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
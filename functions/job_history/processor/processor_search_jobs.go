@@ -0,0 +1,164 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/validate"
+	"github.com/sirupsen/logrus"
+)
+
+// SearchJobsProcessor searches the jobs with filtering and cursor pagination.
+type SearchJobsProcessor struct {
+	logger logrus.FieldLogger
+	strgc  storagec.StorageC
+}
+
+// NewSearchJobsProcessor returns a new SearchJobsProcessor instance.
+func NewSearchJobsProcessor(strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *SearchJobsProcessor)) *SearchJobsProcessor {
+	p := &SearchJobsProcessor{
+		logger: logger,
+		strgc:  strgc,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// Process returns a page of jobs matching the filters in the query parameters, newest first.
+//
+// Supported query parameters are name (substring match), tag, host_group, last_run_status, schedule_type
+// (now, once or recurring), owner (the ID of the user who created the job), mine (true for the jobs of the caller),
+// limit and cursor.  The next cursor is returned in meta.next.
+func (p *SearchJobsProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	queryParams := req.Params.Query
+	if len(queryParams) == 0 {
+		queryParams = make(url.Values)
+	}
+	sr, err := buildSearchJobsRequest(queryParams)
+	if err != nil {
+		return p.errResp(newError(ErrBadRequest, "bad arguments in param.query: %w", err))
+	}
+	if sr.Owner, err = ownerFilter(req, queryParams); err != nil {
+		return p.errResp(newError(ErrBadRequest, "bad arguments in param.query: %w", err))
+	}
+
+	fqlFilter, err := searchJobsFilter(sr)
+	if err != nil {
+		err = fmt.Errorf("error constructing FQL query: %s", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+	fqlSort, err := pkg.NewFQLSort("created_at", pkg.Desc)
+	if err != nil {
+		err = fmt.Errorf("error constructing FQL sort: %s", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+
+	searchResp, err := p.strgc.SearchAndFetch(ctx, storagec.SearchObjectsRequest{
+		Collection: jobCollection,
+		Filter:     fqlFilter,
+		Limit:      sr.Limit,
+		Offset:     sr.Cursor.Offset,
+		Sort:       fqlSort,
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to search jobs: %w", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+
+	jobs := make([]map[string]any, 0, len(searchResp.Objects))
+	for _, o := range searchResp.Objects {
+		var j map[string]any
+		if err := json.Unmarshal(o.Data, &j); err != nil {
+			err = fmt.Errorf("failed to decode job %s: %s", o.Key, err)
+			p.logger.Error(err)
+			return p.errResp(err)
+		}
+		jobs = append(jobs, j)
+	}
+
+	next := ""
+	if pos := sr.Cursor.Offset + len(jobs); len(jobs) > 0 && pos < searchResp.Total {
+		next = encodeQueryCursor(queryCursor{Offset: pos})
+	}
+	resp := p.searchJobsRespJSON(&paging{
+		Count: len(jobs),
+		Limit: sr.Limit,
+		Next:  next,
+		Total: searchResp.Total,
+	}, jobs, nil)
+	if resp == nil {
+		err = errors.New("failed to serialize job search response")
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+	return Response{
+		Body: resp,
+		Code: http.StatusOK,
+	}
+}
+
+func searchJobsFilter(sr searchJobsRequest) (string, error) {
+	b := &pkg.QueryBuilder{}
+	return b.
+		Where("created_at", pkg.GTE, "0").
+		Where("name", pkg.MATCH, sr.Name).
+		Where("tags", pkg.EQ, sr.Tag).
+		Where("host_groups", pkg.EQ, sr.HostGroup).
+		Where("last_run_status", pkg.EQ, sr.LastRunStatus).
+		Where("schedule_type", pkg.EQ, sr.ScheduleType).
+		Where("user_id", pkg.EQ, sr.Owner).
+		Build()
+}
+
+func buildSearchJobsRequest(q url.Values) (searchJobsRequest, error) {
+	err := validate.Fields(append([]validate.Field{
+		{Name: "last_run_status", Value: queryParam(q, "last_run_status"), Rules: []validate.Rule{jobStatusRule}},
+		{Name: "schedule_type", Value: strings.ToLower(queryParam(q, "schedule_type")), Rules: []validate.Rule{validate.Enum("now", "once", "recurring")}},
+		{Name: "mine", Value: strings.ToLower(queryParam(q, "mine")), Rules: []validate.Rule{validate.Enum("true", "false")}},
+	}, pagingFields(q)...)...)
+	if err != nil {
+		return searchJobsRequest{}, err
+	}
+
+	sr := searchJobsRequest{
+		HostGroup:     queryParam(q, "host_group"),
+		LastRunStatus: pkg.NormalizeJobStatus(queryParam(q, "last_run_status")),
+		Name:          queryParam(q, "name"),
+		ScheduleType:  strings.ToLower(queryParam(q, "schedule_type")),
+		Tag:           queryParam(q, "tag"),
+	}
+	sr.Limit, sr.Cursor = parsePaging(q, defaultQueryLimit, maxQueryLimit)
+	return sr, nil
+}
+
+func (p *SearchJobsProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return p.searchJobsRespJSON(&paging{}, nil, errs)
+	})
+}
+
+func (p *SearchJobsProcessor) searchJobsRespJSON(pg *paging, r []map[string]any, e []fdk.APIError) []byte {
+	if r == nil {
+		r = make([]map[string]any, 0)
+	}
+	resp := searchJobsResponse{Errs: e, Meta: *pg, Resources: r}
+	rJSON, err := json.Marshal(resp)
+	if err != nil {
+		p.logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
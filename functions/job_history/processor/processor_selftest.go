@@ -0,0 +1,265 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/searchc"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// SelfTestPassed is the status of a self-test step which succeeded.
+	SelfTestPassed = "passed"
+	// SelfTestFailed is the status of a self-test step which failed.
+	SelfTestFailed = "failed"
+	// SelfTestSkipped is the status of a self-test step which was not run, as an earlier step failed.
+	SelfTestSkipped = "skipped"
+
+	// selfTestJobPrefix prefixes the names of the jobs created by self-tests, so leftovers are easy to spot.
+	selfTestJobPrefix = "Rapid Response Self Test"
+)
+
+// SelfTestProcessor smoke-tests a deployment end to end.  It creates a draft job, runs the execution results
+// saved search, feeds a synthetic workflow metadata event to the UpsertProcessor as the workflows of the job
+// would, checks the execution record it saved, then deletes the records it created.
+type SelfTestProcessor struct {
+	clock  pkg.Clock
+	logger logrus.FieldLogger
+	srchc  searchc.SearchC
+	strgc  storagec.StorageC
+	upsert *UpsertProcessor
+}
+
+// NewSelfTestProcessor returns a new SelfTestProcessor instance, which runs the synthetic event through upsert.
+func NewSelfTestProcessor(upsert *UpsertProcessor, srchc searchc.SearchC, strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *SelfTestProcessor)) *SelfTestProcessor {
+	p := &SelfTestProcessor{
+		clock:  pkg.SystemClock,
+		logger: logger,
+		srchc:  srchc,
+		strgc:  strgc,
+		upsert: upsert,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// selfTest is the state of a single self-test run.
+type selfTest struct {
+	execID  string
+	execKey string
+	jobID   string
+	jobName string
+	now     time.Time
+	owner   caller
+}
+
+// Process runs the steps of the self-test in order, skipping the remaining steps once one fails.  The clean up
+// step always runs.  The response code is 500 if any step failed.
+func (p *SelfTestProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	now := p.clock.Now().UTC()
+	st := &selfTest{
+		execID:  fmt.Sprintf("selftest-%d", now.UnixNano()),
+		jobName: fmt.Sprintf("%s %d", selfTestJobPrefix, now.UnixNano()),
+		now:     now,
+		owner:   callerFromRequest(req),
+	}
+	logger := p.logger.WithField("execution_id", st.execID)
+	logger.Info("running self-test")
+
+	steps := []struct {
+		name string
+		run  func(ctx context.Context, st *selfTest) error
+	}{
+		{"create_job", p.createJob},
+		{"logscale_search", p.search},
+		{"upsert_event", p.upsertEvent},
+		{"verify_execution", p.verifyExecution},
+	}
+	results := make([]selfTestStep, 0, len(steps)+1)
+	failed := false
+	for _, s := range steps {
+		if failed {
+			results = append(results, selfTestStep{Name: s.name, Status: SelfTestSkipped})
+			continue
+		}
+		r := p.runStep(ctx, s.name, st, s.run, logger)
+		failed = r.Status == SelfTestFailed
+		results = append(results, r)
+	}
+	cleanup := p.runStep(ctx, "clean_up", st, p.cleanUp, logger)
+	results = append(results, cleanup)
+
+	status, code := SelfTestPassed, http.StatusOK
+	if failed || cleanup.Status == SelfTestFailed {
+		status, code = SelfTestFailed, http.StatusInternalServerError
+	}
+	logger.WithField("status", status).Info("self-test finished")
+	return Response{
+		Body: p.selfTestRespJSON(status, results, nil),
+		Code: code,
+	}
+}
+
+func (p *SelfTestProcessor) runStep(ctx context.Context, name string, st *selfTest, run func(ctx context.Context, st *selfTest) error, logger logrus.FieldLogger) selfTestStep {
+	start := time.Now()
+	err := run(ctx, st)
+	r := selfTestStep{
+		DurationMillis: time.Since(start).Milliseconds(),
+		Name:           name,
+		Status:         SelfTestPassed,
+	}
+	if err != nil {
+		logger.WithField("step", name).Errorf("self-test step failed: %s", err)
+		r.Error = err.Error()
+		r.Status = SelfTestFailed
+	}
+	return r
+}
+
+// createJob saves a draft job under the ID the UpsertProcessor resolves its name to, and reads it back.
+func (p *SelfTestProcessor) createJob(ctx context.Context, st *selfTest) error {
+	jobID, err := p.upsert.jobIDs.JobID(ctx, st.jobName)
+	if err != nil {
+		return fmt.Errorf("failed to determine job ID: %w", err)
+	}
+	data, err := json.Marshal(placeholderJobMap(jobID, st.jobName, st.owner, st.now))
+	if err != nil {
+		return fmt.Errorf("failed to serialize job: %s", err)
+	}
+	if err = putObject(ctx, p.strgc, jobCollection, jobID, data, ""); err != nil {
+		return fmt.Errorf("failed to save job: %w", err)
+	}
+	st.jobID = jobID
+
+	jobMap, _, err := fetchObject(ctx, p.strgc, jobCollection, jobID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch job: %w", err)
+	}
+	j, err := distillJob(jobMap)
+	if err != nil {
+		return err
+	}
+	if j.Name != st.jobName {
+		return fmt.Errorf("job read back with name %q, expected %q", j.Name, st.jobName)
+	}
+	return nil
+}
+
+// search runs the saved searches of the execution results of the synthetic execution, which has no events.
+// Only errors fail the step: they mean the saved searches are missing or LogScale is unreachable.
+func (p *SelfTestProcessor) search(ctx context.Context, st *selfTest) error {
+	reqs := p.upsert.savedSearches.Requests(searchc.QueryExecutionResults, "", map[string]string{
+		"execution_id": st.execID,
+	})
+	for _, r := range reqs {
+		if _, err := p.srchc.Search(ctx, r); err != nil && !errors.Is(err, searchc.Incomplete) {
+			return fmt.Errorf("failed to run saved search %q: %w", r.SearchName, err)
+		}
+	}
+	return nil
+}
+
+// upsertEvent feeds the UpsertProcessor the event a workflow of the job reports when it starts.
+func (p *SelfTestProcessor) upsertEvent(ctx context.Context, st *selfTest) error {
+	body, err := json.Marshal(workflowMeta{
+		DefinitionName:     "Rapid Response - " + st.jobName,
+		ExecutionID:        st.execID,
+		ExecutionTimestamp: st.now.Format(pkg.ISOTimeFormat),
+		Status:             pkg.StatusInProgress,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to serialize workflow metadata: %s", err)
+	}
+	resp := p.upsert.Process(ctx, fdk.Request{Body: body})
+	if resp.Code != http.StatusOK {
+		return fmt.Errorf("upsert failed with status %d: %s", resp.Code, resp.Body)
+	}
+	return nil
+}
+
+// verifyExecution checks the execution record saved by the UpsertProcessor, and that the run of the job was
+// counted.
+func (p *SelfTestProcessor) verifyExecution(ctx context.Context, st *selfTest) error {
+	key, err := locateJobExecution(ctx, p.strgc, st.execID)
+	if err != nil {
+		return fmt.Errorf("failed to search for execution record: %w", err)
+	}
+	if key == "" {
+		return errors.New("execution record not found")
+	}
+	st.execKey = key
+
+	execMap, _, err := fetchObject(ctx, p.strgc, jobExecutionCollection, key)
+	if err != nil {
+		return fmt.Errorf("failed to fetch execution record: %w", err)
+	}
+	je, err := mapToJobExecution(execMap)
+	if err != nil {
+		return fmt.Errorf("failed to deserialize execution record: %s", err)
+	}
+	if je.ID != st.jobID || je.RunStatus != pkg.StatusInProgress {
+		return fmt.Errorf("execution record has job ID %q and status %q, expected %q and %q", je.ID, je.RunStatus, st.jobID, pkg.StatusInProgress)
+	}
+
+	jobMap, _, err := fetchObject(ctx, p.strgc, jobCollection, st.jobID)
+	if err != nil {
+		return fmt.Errorf("failed to fetch job: %w", err)
+	}
+	j, err := distillJob(jobMap)
+	if err != nil {
+		return err
+	}
+	if j.RunCount != 1 || j.LastExecutionID != st.execID {
+		return fmt.Errorf("job has run count %d and last execution %q, expected 1 and %q", j.RunCount, j.LastExecutionID, st.execID)
+	}
+	return nil
+}
+
+// cleanUp deletes the execution and job records created by the self-test.  The execution record is looked up
+// again if the run failed before it was verified, as the upsert may have saved it anyway.
+func (p *SelfTestProcessor) cleanUp(ctx context.Context, st *selfTest) error {
+	if st.jobID == "" {
+		return nil
+	}
+	if st.execKey == "" {
+		key, err := locateJobExecution(ctx, p.strgc, st.execID)
+		if err != nil {
+			return fmt.Errorf("failed to search for execution record: %w", err)
+		}
+		st.execKey = key
+	}
+	if st.execKey != "" {
+		err := p.strgc.DeleteObject(ctx, storagec.DeleteObjectRequest{Collection: jobExecutionCollection, ObjectKey: st.execKey})
+		if err != nil && !errors.Is(err, storagec.NotFound) {
+			return fmt.Errorf("failed to delete execution record %s: %w", st.execKey, err)
+		}
+	}
+	err := p.strgc.DeleteObject(ctx, storagec.DeleteObjectRequest{Collection: jobCollection, ObjectKey: st.jobID})
+	if err != nil && !errors.Is(err, storagec.NotFound) {
+		return fmt.Errorf("failed to delete job %s: %w", st.jobID, err)
+	}
+	return nil
+}
+
+func (p *SelfTestProcessor) selfTestRespJSON(status string, s []selfTestStep, e []fdk.APIError) []byte {
+	if s == nil {
+		s = make([]selfTestStep, 0)
+	}
+	r := selfTestResponse{Errs: e, Resources: s, Status: status}
+	rJSON, err := json.Marshal(r)
+	if err != nil {
+		p.logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
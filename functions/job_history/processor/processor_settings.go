@@ -0,0 +1,114 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/sirupsen/logrus"
+)
+
+// SettingsProcessor reads and updates the app's settings objects.
+type SettingsProcessor struct {
+	logger logrus.FieldLogger
+	strgc  storagec.StorageC
+}
+
+// NewSettingsProcessor returns a new SettingsProcessor instance.
+func NewSettingsProcessor(strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *SettingsProcessor)) *SettingsProcessor {
+	p := &SettingsProcessor{
+		logger: logger,
+		strgc:  strgc,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// Process returns the settings object named by the name query parameter.
+func (p *SettingsProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	name := strings.TrimSpace(req.Params.Query.Get("name"))
+	if _, ok := settingsValidators[name]; !ok {
+		return p.errResp(newError(ErrBadRequest, "unknown settings name: %q", name))
+	}
+
+	var v map[string]any
+	err := fetchSettings(ctx, p.strgc, name, &v)
+	if errors.Is(err, storagec.NotFound) {
+		return p.errResp(newError(ErrNotFound, "not found"))
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to fetch %s settings: %w", name, err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+	for _, f := range settingsSecrets[name] {
+		if _, ok := v[f]; ok {
+			v[f] = "********"
+		}
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		err = fmt.Errorf("failed to serialize %s settings: %w", name, err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+	return Response{
+		Body: p.settingsRespJSON([]settingsRequest{{Name: name, Value: b}}, nil),
+		Code: http.StatusOK,
+	}
+}
+
+// Update validates and saves the settings object contained in the request body.
+func (p *SettingsProcessor) Update(ctx context.Context, req fdk.Request) Response {
+	var sr settingsRequest
+	if err := json.Unmarshal(req.Body, &sr); err != nil {
+		return p.errResp(newError(ErrBadRequest, "failed to parse request body: %s", err))
+	}
+	sr.Name = strings.TrimSpace(sr.Name)
+	validate, ok := settingsValidators[sr.Name]
+	if !ok {
+		return p.errResp(newError(ErrBadRequest, "unknown settings name: %q", sr.Name))
+	}
+	if len(sr.Value) == 0 {
+		return p.errResp(newError(ErrBadRequest, "missing settings value"))
+	}
+	if err := validate(sr.Value); err != nil {
+		return p.errResp(newError(ErrBadRequest, "invalid %s settings: %s", sr.Name, err))
+	}
+
+	if err := putSettings(ctx, p.strgc, sr.Name, sr.Value); err != nil {
+		err = fmt.Errorf("failed to save %s settings: %w", sr.Name, err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+	return Response{
+		Body: p.settingsRespJSON([]settingsRequest{sr}, nil),
+		Code: http.StatusOK,
+	}
+}
+
+func (p *SettingsProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return p.settingsRespJSON(nil, errs)
+	})
+}
+
+func (p *SettingsProcessor) settingsRespJSON(s []settingsRequest, e []fdk.APIError) []byte {
+	if s == nil {
+		s = make([]settingsRequest, 0)
+	}
+	r := settingsResponse{Errs: e, Resources: s}
+	rJSON, err := json.Marshal(r)
+	if err != nil {
+		p.logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
@@ -0,0 +1,308 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/validate"
+	"github.com/sirupsen/logrus"
+)
+
+// StatsProcessor returns aggregate statistics of the executions of a job.
+type StatsProcessor struct {
+	logger logrus.FieldLogger
+	strgc  storagec.StorageC
+}
+
+// NewStatsProcessor returns a new StatsProcessor instance.
+func NewStatsProcessor(strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *StatsProcessor)) *StatsProcessor {
+	p := &StatsProcessor{
+		logger: logger,
+		strgc:  strgc,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// Process returns the statistics of the job identified by the job_id query parameter over its most recent
+// finished runs, the number of which is set by the runs query parameter.
+//
+// The finished runs of each job are cached, so that only the executions which started since the oldest
+// execution that was still running when the statistics were last computed are searched.
+func (p *StatsProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	jobID := queryParam(req.Params.Query, "job_id")
+	err := validate.Fields(
+		validate.Field{Name: "job_id", Value: jobID, Rules: []validate.Rule{validate.Required()}},
+		validate.Field{Name: "runs", Value: queryParam(req.Params.Query, "runs"), Rules: []validate.Rule{validate.Int(), validate.AtLeast(1)}},
+	)
+	if err != nil {
+		return p.errResp(err)
+	}
+	runs := defaultStatsRuns
+	if n, err := strconv.Atoi(queryParam(req.Params.Query, "runs")); err == nil {
+		runs = min(n, maxStatsRuns)
+	}
+	logger := p.logger.WithField("job_id", jobID)
+
+	var cache statsCache
+	cacheMap, version, err := fetchObject(ctx, p.strgc, jobStatsCollection, jobID)
+	switch {
+	case errors.Is(err, storagec.NotFound):
+	case err != nil:
+		err = fmt.Errorf("failed to fetch job statistics: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	default:
+		if cache, err = decodeStatsCache(cacheMap); err != nil {
+			// the cache is rebuilt from scratch
+			cache = statsCache{}
+			logger.Warnf("failed to decode cached job statistics: %s", err)
+		}
+	}
+
+	cache, changed, err := p.refresh(ctx, jobID, cache)
+	if err != nil {
+		err = fmt.Errorf("failed to refresh job statistics: %w", err)
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	if changed {
+		// failing to cache the statistics only makes the next request slower
+		if data, err := json.Marshal(cache); err != nil {
+			logger.Errorf("failed to serialize job statistics: %s", err)
+		} else if err = putObject(ctx, p.strgc, jobStatsCollection, jobID, data, version); err != nil {
+			logger.Warnf("failed to cache job statistics: %s", err)
+		}
+	}
+
+	resp := p.statsRespJSON([]jobStats{computeJobStats(jobID, cache, runs)}, nil)
+	if resp == nil {
+		err = errors.New("failed to serialize job statistics response")
+		logger.Error(err)
+		return p.errResp(err)
+	}
+	return Response{
+		Body: resp,
+		Code: http.StatusOK,
+	}
+}
+
+// refresh adds the runs which finished since the cache was last refreshed to it, returning true if it changed.
+func (p *StatsProcessor) refresh(ctx context.Context, jobID string, cache statsCache) (statsCache, bool, error) {
+	from := cache.Through
+	if from == "" {
+		from = time.Unix(0, 0).UTC().Format(pkg.ISOTimeFormat)
+	}
+	filter, err := pkg.NewFQLQuery([]pkg.Filter{
+		{Field: "id", Op: pkg.EQ, Value: jobID},
+		{Field: "run_date", Op: pkg.GTE, Value: from},
+	})
+	if err != nil {
+		return cache, false, fmt.Errorf("error constructing FQL query: %s", err)
+	}
+	fqlSort, err := pkg.NewFQLSort("run_date", pkg.Desc)
+	if err != nil {
+		return cache, false, fmt.Errorf("error constructing FQL sort: %s", err)
+	}
+
+	known := make(map[string]bool, len(cache.Runs))
+	for _, r := range cache.Runs {
+		known[r.ExecutionID] = true
+	}
+	fresh := make([]statsRun, 0)
+	newest, oldestUnfinished := "", ""
+	offset := 0
+	for page := 0; page < maxQueryScanPages && len(fresh) < maxStatsRuns; page++ {
+		sr, err := p.strgc.SearchAndFetch(ctx, storagec.SearchObjectsRequest{
+			Collection: jobExecutionCollection,
+			Filter:     filter,
+			Limit:      maxStatsRuns,
+			Offset:     offset,
+			Sort:       fqlSort,
+		})
+		if err != nil {
+			return cache, false, fmt.Errorf("error retrieving records: %w", err)
+		}
+		for _, o := range sr.Objects {
+			je, err := decodeStoredJobExecution(o.Data)
+			if err != nil {
+				return cache, false, err
+			}
+			if newest == "" {
+				newest = je.RunDate
+			}
+			switch je.RunStatus {
+			case pkg.StatusCompleted, pkg.StatusCompletedWithErrors, pkg.StatusFailed, pkg.StatusTimedOut:
+				if !known[je.ExecutionID] {
+					fresh = append(fresh, newStatsRun(je))
+					known[je.ExecutionID] = true
+				}
+			case pkg.StatusInProgress, pkg.StatusQueued, pkg.StatusDeferred:
+				oldestUnfinished = je.RunDate
+			}
+		}
+		// the API reports an offset of zero once there are no more pages
+		if sr.Offset <= offset || len(sr.Objects) == 0 {
+			break
+		}
+		offset = sr.Offset
+	}
+
+	through := cache.Through
+	switch {
+	case oldestUnfinished != "":
+		through = oldestUnfinished
+	case newest != "":
+		through = newest
+	}
+	if len(fresh) == 0 && through == cache.Through {
+		return cache, false, nil
+	}
+
+	cache.Through = through
+	cache.Runs = append(fresh, cache.Runs...)
+	sort.SliceStable(cache.Runs, func(i, j int) bool {
+		return cache.Runs[i].RunDate > cache.Runs[j].RunDate
+	})
+	if len(cache.Runs) > maxStatsRuns {
+		cache.Runs = cache.Runs[:maxStatsRuns]
+	}
+	for _, r := range fresh {
+		if r.Status == pkg.StatusFailed && r.RunDate > cache.LastFailure {
+			cache.LastFailure = r.RunDate
+		}
+	}
+	return cache, true, nil
+}
+
+func newStatsRun(je pkg.JobExecution) statsRun {
+	r := statsRun{
+		ExecutionID: je.ExecutionID,
+		RunDate:     je.RunDate,
+		Status:      je.RunStatus,
+	}
+	start, errStart := time.Parse(pkg.ISOTimeFormat, je.RunDate)
+	end, errEnd := time.Parse(pkg.ISOTimeFormat, je.EndDate)
+	if errStart == nil && errEnd == nil && !end.Before(start) {
+		d := end.Sub(start).Seconds()
+		r.Duration = &d
+	}
+	for _, h := range failedHosts(je.TargetedHosts) {
+		r.FailedHosts = append(r.FailedHosts, h.HostName)
+		if h.FailureReason != "" {
+			if r.FailureReasons == nil {
+				r.FailureReasons = make(map[string]int)
+			}
+			r.FailureReasons[h.FailureReason]++
+		}
+	}
+	return r
+}
+
+// computeJobStats aggregates the most recent runs of the cached runs of a job.
+func computeJobStats(jobID string, cache statsCache, runs int) jobStats {
+	s := jobStats{
+		JobID:           jobID,
+		FailureReasons:  make(map[string]int),
+		LastFailure:     cache.LastFailure,
+		TopFailingHosts: make([]hostFailures, 0),
+	}
+	recent := cache.Runs
+	if len(recent) > runs {
+		recent = recent[:runs]
+	}
+	s.Runs = len(recent)
+	if s.Runs == 0 {
+		return s
+	}
+
+	durations := make([]float64, 0, len(recent))
+	failures := make(map[string]int)
+	for _, r := range recent {
+		switch r.Status {
+		case pkg.StatusFailed, pkg.StatusTimedOut:
+			s.Failed++
+		case pkg.StatusCompletedWithErrors:
+			s.CompletedWithErrors++
+		default:
+			s.Succeeded++
+		}
+		if r.Duration != nil {
+			durations = append(durations, *r.Duration)
+		}
+		for _, h := range r.FailedHosts {
+			failures[h]++
+		}
+		for reason, n := range r.FailureReasons {
+			s.FailureReasons[reason] += n
+		}
+	}
+	s.SuccessRate = float64(s.Succeeded) / float64(s.Runs)
+
+	if len(durations) > 0 {
+		sort.Float64s(durations)
+		total := 0.0
+		for _, d := range durations {
+			total += d
+		}
+		s.AvgDuration = total / float64(len(durations))
+		// nearest-rank percentile
+		s.P95Duration = durations[int(math.Ceil(0.95*float64(len(durations))))-1]
+	}
+
+	for h, n := range failures {
+		s.TopFailingHosts = append(s.TopFailingHosts, hostFailures{Failures: n, HostName: h})
+	}
+	sort.Slice(s.TopFailingHosts, func(i, j int) bool {
+		a, b := s.TopFailingHosts[i], s.TopFailingHosts[j]
+		if a.Failures != b.Failures {
+			return a.Failures > b.Failures
+		}
+		return a.HostName < b.HostName
+	})
+	if len(s.TopFailingHosts) > topFailingHosts {
+		s.TopFailingHosts = s.TopFailingHosts[:topFailingHosts]
+	}
+	return s
+}
+
+func decodeStatsCache(m map[string]any) (statsCache, error) {
+	var c statsCache
+	b, err := json.Marshal(m)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(b, &c)
+	return c, err
+}
+
+func (p *StatsProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return p.statsRespJSON(nil, errs)
+	})
+}
+
+func (p *StatsProcessor) statsRespJSON(r []jobStats, e []fdk.APIError) []byte {
+	if r == nil {
+		r = make([]jobStats, 0)
+	}
+	resp := jobStatsResponse{Errs: e, Resources: r}
+	rJSON, err := json.Marshal(resp)
+	if err != nil {
+		p.logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
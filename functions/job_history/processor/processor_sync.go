@@ -0,0 +1,473 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/validate"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/workflowc"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// Actions of the plan of a sync.
+const (
+	// syncCreate creates a job of the manifest which is not stored, as a draft to be provisioned by Func_Jobs.
+	syncCreate = "create"
+	// syncDisable pauses a stored job missing from the manifest.
+	syncDisable = "disable"
+	// syncUpdate changes the schedule or the paused state of a stored job to that of the manifest.
+	syncUpdate = "update"
+)
+
+// syncRuntimeFields are the fields of the manifest entries of jobs which are dropped when jobs are created, as
+// they are set by Func_Jobs when the jobs are provisioned, or by their executions.
+var syncRuntimeFields = []string{
+	"approval_status", "deleted_at", "expired", "jitter_offset_minutes", "last_execution_id", "last_run",
+	"last_run_status", "next_run", "reviewed_at", "reviewed_by", "run_count", "total_recurrences", "workflows",
+	"wschedule",
+}
+
+// SyncProcessor reconciles the stored jobs with a declarative manifest of the jobs which should exist, e.g. kept
+// under version control.  Jobs of the manifest which are not stored are created, stored jobs whose schedule or
+// paused state differ from the manifest are updated, and stored jobs missing from the manifest are paused.  Jobs
+// of the manifest are resumed unless they set paused.
+//
+// Jobs are matched by name.  Created jobs are saved as drafts, as provisioning their workflows requires the
+// templates configured for Func_Jobs, and so are provisioned jobs whose schedule changes: their workflows, which
+// run on the previous schedule, are deprovisioned.
+type SyncProcessor struct {
+	clock    pkg.Clock
+	foldCase bool
+	jobIDs   JobIDs
+	logger   logrus.FieldLogger
+	strgc    storagec.StorageC
+	wfc      workflowc.WorkflowC
+}
+
+// NewSyncProcessor returns a new SyncProcessor instance.
+func NewSyncProcessor(strgc storagec.StorageC, wfc workflowc.WorkflowC, logger logrus.FieldLogger, opts ...func(p *SyncProcessor)) *SyncProcessor {
+	p := &SyncProcessor{
+		clock:  pkg.SystemClock,
+		jobIDs: NewHashJobIDs(strgc, false),
+		logger: logger,
+		strgc:  strgc,
+		wfc:    wfc,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// WithSyncJobIDs sets the strategy giving created jobs their ID.
+func WithSyncJobIDs(ids JobIDs) func(p *SyncProcessor) {
+	return func(p *SyncProcessor) {
+		p.jobIDs = ids
+	}
+}
+
+// WithSyncJobNameCaseFolding makes job names which only differ by case the same name, see pkg.JobNameKey.
+func WithSyncJobNameCaseFolding() func(p *SyncProcessor) {
+	return func(p *SyncProcessor) {
+		p.foldCase = true
+	}
+}
+
+// syncOp are the jobs a change of the plan of a sync applies to: the index of the job in the manifest, or -1 for
+// jobs to disable, and the stored job, or nil for jobs to create.
+type syncOp struct {
+	desired int
+	stored  *syncedJob
+}
+
+// syncedJob is a stored job being reconciled.
+type syncedJob struct {
+	id      string
+	j       job
+	jobMap  map[string]any
+	matched bool
+	version string
+}
+
+// Process plans the changes reconciling the stored jobs with the manifest of the request body, and applies them
+// unless the request sets dry_run.  The whole manifest is validated before any change is planned.  Changes which
+// fail are reported with their error, and the sync can be run again to retry them.
+func (p *SyncProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	var sr syncRequest
+	if err := json.Unmarshal(req.Body, &sr); err != nil {
+		return p.errResp(newError(ErrBadRequest, "failed to parse request body: %s", err))
+	}
+	if len(sr.Manifest) == 0 {
+		return p.errResp(validate.Errors{{Field: "manifest", Message: "is required"}})
+	}
+	m, err := parseJobManifest(sr.Manifest)
+	if err != nil {
+		return p.errResp(newError(ErrBadRequest, "failed to parse manifest: %s", err))
+	}
+	desired, err := p.desiredJobs(m)
+	if err != nil {
+		return p.errResp(err)
+	}
+
+	if !sr.DryRun {
+		unlock, err := lockTask(ctx, p.strgc, p.clock, p.logger, syncLock)
+		if err != nil {
+			p.logger.Error(err)
+			return p.errResp(err)
+		}
+		defer unlock()
+	}
+
+	stored, err := p.storedJobs(ctx)
+	if err != nil {
+		err = fmt.Errorf("failed to load jobs: %w", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+
+	result, ops, err := p.plan(ctx, desired, stored)
+	if err != nil {
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+	result.DryRun = sr.DryRun
+
+	code := http.StatusOK
+	if !sr.DryRun {
+		c := callerFromRequest(req)
+		for i := range result.Plan {
+			ch := &result.Plan[i]
+			if err = p.apply(ctx, ch, ops[i], m, desired, c); err != nil {
+				err = fmt.Errorf("failed to %s job %s: %w", ch.Action, ch.JobID, err)
+				p.logger.Error(err)
+				ch.Error = err.Error()
+				code = http.StatusMultiStatus
+				continue
+			}
+			ch.Applied = true
+		}
+	}
+	p.logger.WithField("changes", len(result.Plan)).
+		WithField("unchanged", result.Unchanged).
+		WithField("dry_run", sr.DryRun).
+		Info("synced jobs")
+
+	return Response{
+		Body: p.syncRespJSON([]syncResult{result}, nil),
+		Code: code,
+	}
+}
+
+// parseJobManifest parses a manifest given as a JSON object, or as a string holding a YAML or JSON document.
+func parseJobManifest(raw json.RawMessage) (jobManifest, error) {
+	var doc string
+	if err := json.Unmarshal(raw, &doc); err == nil {
+		var v any
+		if err = yaml.Unmarshal([]byte(doc), &v); err != nil {
+			return jobManifest{}, err
+		}
+		if raw, err = json.Marshal(v); err != nil {
+			return jobManifest{}, err
+		}
+	}
+	var m jobManifest
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return jobManifest{}, err
+	}
+	return m, nil
+}
+
+// desiredJobs returns the reconciled fields of the jobs of the manifest, whose names are normalized.
+func (p *SyncProcessor) desiredJobs(m jobManifest) ([]manifestJob, error) {
+	desired := make([]manifestJob, len(m.Jobs))
+	names := make(map[string]int)
+	var errs []error
+	for i, entry := range m.Jobs {
+		path := fmt.Sprintf("manifest.jobs[%d]", i)
+		if entry == nil {
+			errs = append(errs, validate.Errors{{Field: path, Message: "must be an object"}})
+			continue
+		}
+		b, err := json.Marshal(entry)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(b, &desired[i]); err != nil {
+			errs = append(errs, validate.Errors{{Field: path, Message: fmt.Sprintf("is not a valid job: %s", err)}})
+			continue
+		}
+		mj := &desired[i]
+		mj.Name = pkg.NormalizeJobName(mj.Name)
+		entry["name"] = mj.Name
+
+		fields := []validate.Field{{Name: "name", Value: mj.Name, Rules: []validate.Rule{validate.Required()}}}
+		if s := mj.Schedule; s != nil {
+			fields = append(fields,
+				validate.Field{Name: "schedule.start_date", Value: s.Start, Rules: []validate.Rule{isoTimeRule}},
+				validate.Field{Name: "schedule.end_date", Value: s.End, Rules: []validate.Rule{isoTimeRule}},
+			)
+		}
+		errs = append(errs, validate.Nest(path, validate.Fields(fields...)))
+		if s := mj.Schedule; s != nil && s.TimeCycle != "" {
+			if _, err = parseJobSchedule(s); err != nil {
+				errs = append(errs, validate.Errors{{Field: path + ".schedule.time_cycle", Message: err.Error()}})
+			}
+		}
+
+		if mj.Name == "" {
+			continue
+		}
+		key := pkg.JobNameKey(mj.Name, p.foldCase)
+		if k, ok := names[key]; ok {
+			errs = append(errs, validate.Errors{{Field: path + ".name", Message: fmt.Sprintf("is also the name of manifest.jobs[%d]", k)}})
+		}
+		names[key] = i
+	}
+	return desired, validate.Join(errs...)
+}
+
+// storedJobs returns the stored jobs which are not deleted.
+func (p *SyncProcessor) storedJobs(ctx context.Context) ([]*syncedJob, error) {
+	filter, err := pkg.NewFQLQuery([]pkg.Filter{{Field: "created_at", Op: pkg.GTE, Value: "0"}})
+	if err != nil {
+		return nil, fmt.Errorf("error constructing FQL query: %s", err)
+	}
+	sr, err := p.strgc.SearchAll(ctx, storagec.SearchObjectsRequest{
+		Collection: jobCollection,
+		Filter:     filter,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search jobs: %w", err)
+	}
+
+	stored := make([]*syncedJob, 0, len(sr.ObjectKeys))
+	for _, jobID := range sr.ObjectKeys {
+		jobMap, version, err := fetchObject(ctx, p.strgc, jobCollection, jobID)
+		if errors.Is(err, storagec.NotFound) {
+			// the job was deleted concurrently
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not fetch job record %s: %w", jobID, err)
+		}
+		if jobMap["deleted_at"] != nil {
+			continue
+		}
+		j, err := distillJob(jobMap)
+		if err != nil {
+			return nil, fmt.Errorf("could not distill job record %s from dictionary: %s", jobID, err)
+		}
+		stored = append(stored, &syncedJob{id: jobID, j: j, jobMap: jobMap, version: version})
+	}
+	return stored, nil
+}
+
+// plan returns the changes reconciling the stored jobs with the desired ones, in the order of the manifest
+// followed by the jobs to disable, along with the jobs each change applies to.  Stored jobs are matched by their
+// name or one of their aliases.
+func (p *SyncProcessor) plan(ctx context.Context, desired []manifestJob, stored []*syncedJob) (syncResult, []syncOp, error) {
+	byName := make(map[string]*syncedJob)
+	for _, s := range stored {
+		for _, n := range append([]string{s.j.Name}, s.j.Aliases...) {
+			if n != "" {
+				byName[pkg.JobNameKey(n, p.foldCase)] = s
+			}
+		}
+	}
+
+	result := syncResult{Plan: make([]syncChange, 0)}
+	var ops []syncOp
+	for i, mj := range desired {
+		s, ok := byName[pkg.JobNameKey(mj.Name, p.foldCase)]
+		if !ok {
+			id, err := p.jobIDs.JobID(ctx, mj.Name)
+			if err != nil {
+				return result, nil, fmt.Errorf("failed to resolve the ID of job %s: %w", mj.Name, err)
+			}
+			result.Plan = append(result.Plan, syncChange{Action: syncCreate, JobID: id, JobName: mj.Name})
+			ops = append(ops, syncOp{desired: i})
+			continue
+		}
+		s.matched = true
+
+		ch := syncChange{Action: syncUpdate, JobID: s.id, JobName: s.j.Name}
+		if mj.Schedule != nil && (s.j.Schedule == nil || *s.j.Schedule != *mj.Schedule) {
+			ch.Changes = append(ch.Changes, "schedule")
+			ch.Reprovision = provisioned(s.j)
+		}
+		if mj.Paused != s.j.Paused {
+			ch.Changes = append(ch.Changes, "paused")
+		}
+		if len(ch.Changes) == 0 {
+			result.Unchanged++
+			continue
+		}
+		result.Plan = append(result.Plan, ch)
+		ops = append(ops, syncOp{desired: i, stored: s})
+	}
+
+	for _, s := range stored {
+		if s.matched {
+			continue
+		}
+		if s.j.Paused {
+			result.Unchanged++
+			continue
+		}
+		result.Plan = append(result.Plan, syncChange{Action: syncDisable, JobID: s.id, JobName: s.j.Name})
+		ops = append(ops, syncOp{desired: -1, stored: s})
+	}
+	return result, ops, nil
+}
+
+// apply applies a change of the plan.
+func (p *SyncProcessor) apply(ctx context.Context, ch *syncChange, op syncOp, m jobManifest, desired []manifestJob, c caller) error {
+	switch ch.Action {
+	case syncCreate:
+		return p.create(ctx, ch.JobID, m.Jobs[op.desired], desired[op.desired], c)
+	case syncDisable:
+		return p.update(ctx, op.stored, nil, true, false)
+	}
+	mj := desired[op.desired]
+	var schedule *jobSchedule
+	if slices.Contains(ch.Changes, "schedule") {
+		schedule = mj.Schedule
+	}
+	return p.update(ctx, op.stored, schedule, mj.Paused, ch.Reprovision)
+}
+
+// create saves a job of the manifest as a draft.
+func (p *SyncProcessor) create(ctx context.Context, jobID string, entry map[string]any, mj manifestJob, c caller) error {
+	jobMap := make(map[string]any, len(entry)+8)
+	for k, v := range entry {
+		if !slices.Contains(syncRuntimeFields, k) {
+			jobMap[k] = v
+		}
+	}
+	now := p.clock.Now().UTC()
+	jobMap["id"] = jobID
+	jobMap["draft"] = true
+	jobMap["version"] = 1
+	jobMap["created_at"] = now
+	jobMap["updated_at"] = now
+	jobMap["schedule_type"] = syncScheduleType(mj.Schedule, jobMap["run_now"] == true)
+	if _, ok := jobMap["user_name"]; !ok && c.Name != "" {
+		jobMap["user_id"], jobMap["user_name"] = c.ID, c.Name
+	}
+
+	b, err := json.Marshal(jobMap)
+	if err != nil {
+		return fmt.Errorf("failed to serialize job record: %s", err)
+	}
+	return putObject(ctx, p.strgc, jobCollection, jobID, b, "")
+}
+
+// update saves the schedule, unless it is nil, and the paused state of a stored job.  The schedule workflow of the
+// job is disabled or enabled to match its state, and its workflows are deprovisioned if reprovision is true.
+func (p *SyncProcessor) update(ctx context.Context, s *syncedJob, schedule *jobSchedule, paused, reprovision bool) error {
+	j, jobMap := s.j, s.jobMap
+	wf := j.Workflows
+	if reprovision {
+		// the schedule workflow is disabled first so that it no longer runs on the previous schedule even if
+		// deprovisioning it fails
+		if err := p.wfc.Disable(ctx, wf.ScheduleWorkflow); err != nil && !errors.Is(err, workflowc.NotFound) {
+			return fmt.Errorf("failed to disable the schedule workflow: %w", err)
+		}
+		j.Draft, j.Workflows = true, nil
+		jobMap["draft"], jobMap["workflows"], jobMap["next_run"] = true, nil, nil
+	}
+	if schedule != nil {
+		j.Schedule = schedule
+		jobMap["schedule"] = schedule
+		jobMap["schedule_type"] = syncScheduleType(schedule, j.RunNow)
+	}
+	j.Paused = paused
+	jobMap["paused"] = paused
+	if j.scheduled() && j.Schedule != nil && j.Schedule.TimeCycle != "" {
+		cs, err := j.schedule()
+		if err != nil {
+			return fmt.Errorf("failed to parse job cron expression: %s", err)
+		}
+		jobMap["next_run"] = loadBlackouts(ctx, p.strgc, p.logger).next(cs, p.clock.Now()).UTC()
+	}
+	jobMap["updated_at"] = p.clock.Now().UTC()
+
+	b, err := json.Marshal(jobMap)
+	if err != nil {
+		return fmt.Errorf("failed to serialize job record: %s", err)
+	}
+	if err = putObject(ctx, p.strgc, jobCollection, s.id, b, s.version); err != nil {
+		if errors.Is(err, storagec.VersionConflict) {
+			return newError(ErrConflict, "job was modified concurrently, please retry")
+		}
+		return fmt.Errorf("failed to save job record: %w", err)
+	}
+
+	if reprovision {
+		var errs []error
+		for _, id := range []string{wf.ScheduleWorkflow, wf.NotifierWorkflow} {
+			if id == "" {
+				continue
+			}
+			if err = p.wfc.Deprovision(ctx, id); err != nil && !errors.Is(err, workflowc.NotFound) {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+	if wf == nil || wf.ScheduleWorkflow == "" {
+		return nil
+	}
+	if j.scheduled() {
+		err = p.wfc.Enable(ctx, wf.ScheduleWorkflow)
+	} else {
+		err = p.wfc.Disable(ctx, wf.ScheduleWorkflow)
+	}
+	if err != nil {
+		return fmt.Errorf("saved the job but failed to update its schedule workflow: %w", err)
+	}
+	return nil
+}
+
+// provisioned reports whether the workflows of the job have been provisioned.
+func provisioned(j job) bool {
+	return !j.Draft && j.Workflows != nil && j.Workflows.ScheduleWorkflow != ""
+}
+
+// syncScheduleType returns the schedule type of a job, as computed by Func_Jobs.
+func syncScheduleType(s *jobSchedule, runNow bool) string {
+	switch {
+	case runNow:
+		return "now"
+	case s == nil || s.TimeCycle == "":
+		return "once"
+	}
+	return "recurring"
+}
+
+func (p *SyncProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return p.syncRespJSON(nil, errs)
+	})
+}
+
+func (p *SyncProcessor) syncRespJSON(r []syncResult, e []fdk.APIError) []byte {
+	if r == nil {
+		r = make([]syncResult, 0)
+	}
+	resp := syncResponse{Errs: e, Resources: r}
+	rJSON, err := json.Marshal(resp)
+	if err != nil {
+		p.logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
@@ -2,41 +2,72 @@ package processor
 
 import (
 	"context"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/robfig/cron/v3"
 	"net/http"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/alertc"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/hostsc"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/metrics"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/notifier"
 	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
 	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/searchc"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/siem"
 	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/validate"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/workflowc"
+	"github.com/eapache/go-resiliency/retrier"
 	"github.com/sirupsen/logrus"
-	"github.com/spaolacci/murmur3"
 )
 
 // UpsertProcessor upserts a job execution.
 type UpsertProcessor struct {
-	falconHost  string
-	logger      logrus.FieldLogger
-	srchc       searchc.SearchC
-	strgc       storagec.StorageC
-	nowProvider func() time.Time
+	alertPercent    float64
+	alerter         alertc.AlertC
+	conflictBackoff []time.Duration
+	connectors      ConnectorFactory
+	disableExpired  bool
+	emitter         siem.Emitter
+	falconHost      string
+	hstc            hostsc.HostC
+	jobIDs          JobIDs
+	logger          logrus.FieldLogger
+	metrics         *metrics.Registry
+	notifier        notifier.Notifier
+	outputPolicy    OutputPolicy
+	rawBodyLogging  bool
+	redactor        redactor
+	savedSearches   searchc.SavedSearches
+	searchMaxWait   time.Duration
+	searchPollEvery time.Duration
+	sessionCeiling  int
+	srchc           searchc.SearchC
+	strgc           storagec.StorageC
+	strictDecoding  bool
+	wfc             workflowc.WorkflowC
+	clock           pkg.Clock
 }
 
 // NewUpsertProcessor creates a new initialized UpsertProcessor instance.
 func NewUpsertProcessor(host string, srchc searchc.SearchC, strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *UpsertProcessor)) *UpsertProcessor {
 	p := &UpsertProcessor{
-		falconHost:  host,
-		logger:      logger,
-		srchc:       srchc,
-		strgc:       strgc,
-		nowProvider: nowT,
+		conflictBackoff: retrier.ExponentialBackoff(5, 100*time.Millisecond),
+		falconHost:      host,
+		jobIDs:          NewHashJobIDs(strgc, false),
+		logger:          logger,
+		metrics:         metrics.Default,
+		outputPolicy:    DefaultOutputPolicy(),
+		redactor:        newRedactor(DefaultRedactedFields),
+		savedSearches:   searchc.DefaultSavedSearches(),
+		srchc:           srchc,
+		strgc:           strgc,
+		clock:           pkg.SystemClock,
 	}
 
 	for _, o := range opts {
@@ -45,18 +76,121 @@ func NewUpsertProcessor(host string, srchc searchc.SearchC, strgc storagec.Stora
 	return p
 }
 
+// WithNotifier makes the UpsertProcessor notify the notification targets of a job whenever one of its
+// executions changes status.
+func WithNotifier(n notifier.Notifier) func(p *UpsertProcessor) {
+	return func(p *UpsertProcessor) {
+		p.notifier = n
+	}
+}
+
+// WithFailureAlerting makes the UpsertProcessor raise an alert through the given client whenever an execution
+// finishes having failed on more than percent of its targeted hosts, so that failed remediations surface in the
+// queue analysts monitor.  Percentages outside (0, 100) are ignored.
+func WithFailureAlerting(a alertc.AlertC, percent float64) func(p *UpsertProcessor) {
+	return func(p *UpsertProcessor) {
+		if percent > 0 && percent < 100 {
+			p.alerter = a
+			p.alertPercent = percent
+		}
+	}
+}
+
+// WithWorkflowClient makes the UpsertProcessor run the oldest queued execution of a job through the given
+// client whenever one of its executions finishes.  Queued executions are never run without one.
+func WithWorkflowClient(wfc workflowc.WorkflowC) func(p *UpsertProcessor) {
+	return func(p *UpsertProcessor) {
+		p.wfc = wfc
+	}
+}
+
+// WithExpiredWorkflowDisabling makes the UpsertProcessor disable the schedule workflow of a job through the
+// workflow client once the job expires, i.e. its schedule has ended.  Workflows are left enabled without it.
+func WithExpiredWorkflowDisabling() func(p *UpsertProcessor) {
+	return func(p *UpsertProcessor) {
+		p.disableExpired = true
+	}
+}
+
+// WithHostClient makes the UpsertProcessor resolve the members of the host groups targeted by a job through the
+// given client when one of its executions starts.  Host groups are not resolved without one.
+func WithHostClient(hstc hostsc.HostC) func(p *UpsertProcessor) {
+	return func(p *UpsertProcessor) {
+		p.hstc = hstc
+	}
+}
+
+// WithSearchPolling makes the UpsertProcessor wait up to maxWait, searching every interval, for Logscale to
+// return host results for executions which have finished, rather than persisting incomplete results.
+func WithSearchPolling(interval, maxWait time.Duration) func(p *UpsertProcessor) {
+	return func(p *UpsertProcessor) {
+		p.searchPollEvery = interval
+		p.searchMaxWait = maxWait
+	}
+}
+
+// WithLogRedaction sets the fields whose values are masked when the UpsertProcessor logs request bodies, in
+// place of DefaultRedactedFields.
+func WithLogRedaction(fields []string) func(p *UpsertProcessor) {
+	return func(p *UpsertProcessor) {
+		p.redactor = newRedactor(fields)
+	}
+}
+
+// WithRawBodyLogging makes the UpsertProcessor log request bodies without redaction.  It is meant for debugging
+// only, as the bodies can hold the file paths and script arguments of jobs.
+func WithRawBodyLogging() func(p *UpsertProcessor) {
+	return func(p *UpsertProcessor) {
+		p.rawBodyLogging = true
+	}
+}
+
+// WithStrictDecoding makes the UpsertProcessor reject the workflow events and execution records with fields it has
+// no field for, rather than ignoring the fields and reporting them in the warnings of its responses, so that drift
+// between the workflow templates and the function fails loudly.  Job records are not checked, as the processor
+// only decodes the fields of jobs it updates.
+func WithStrictDecoding() func(p *UpsertProcessor) {
+	return func(p *UpsertProcessor) {
+		p.strictDecoding = true
+	}
+}
+
+// WithJobIDs sets the strategy resolving the ID of the job of a workflow event from the job name.
+func WithJobIDs(ids JobIDs) func(p *UpsertProcessor) {
+	return func(p *UpsertProcessor) {
+		p.jobIDs = ids
+	}
+}
+
+// WithSavedSearches sets the saved searches run for the logical queries of the processor.
+func WithSavedSearches(ss searchc.SavedSearches) func(p *UpsertProcessor) {
+	return func(p *UpsertProcessor) {
+		p.savedSearches = ss
+	}
+}
+
+// WithOutputPolicy sets the policy bounding the output of hosts stored on the execution records of the UpsertProcessor.  Policies
+// without a positive inline limit are ignored.
+func WithOutputPolicy(op OutputPolicy) func(p *UpsertProcessor) {
+	return func(p *UpsertProcessor) {
+		if op.InlineLimit > 0 {
+			p.outputPolicy = op
+		}
+	}
+}
+
 // Process handles a request.
 func (p *UpsertProcessor) Process(ctx context.Context, req fdk.Request) Response {
-	p.logger.Infof("received upsert request: %s", string(req.Body))
-	wfMeta, err := wfMetaFromRequest(req)
+	if p.rawBodyLogging {
+		p.logger.Debugf("received upsert request: %s", string(req.Body))
+	} else {
+		p.logger.Infof("received upsert request: %s", p.redactor.redact(req.Body))
+	}
+	wfMeta, ignored, err := wfMetaFromRequest(req, p.strictDecoding, loadStatusMapping(ctx, p.strgc, p.logger))
 	if err != nil {
-		msg := fmt.Sprintf("failed to extract job information from request: %s", err)
-		p.logger.Error(msg)
-		return Response{
-			Body: p.genOutRespJSON(nil, []fdk.APIError{{Code: http.StatusBadRequest, Message: msg}}),
-			Code: http.StatusBadRequest,
-			Errs: []fdk.APIError{{Code: http.StatusBadRequest, Message: msg}},
-		}
+		err = newError(ErrBadRequest, "failed to extract job information from request: %w", err)
+		p.logger.Error(err)
+		return p.errResp(err)
 	}
 
 	if wfMeta.Status == "" {
@@ -71,344 +205,692 @@ func (p *UpsertProcessor) Process(ctx context.Context, req fdk.Request) Response
 	jobName, err := wfMeta.jobName()
 	p.logger.Infof("received upsert request for job ID: %s", jobName)
 	if err != nil {
-		msg := fmt.Sprintf("bad job name provided: %s", err)
-		p.logger.WithField("workflow_meta", wfMeta).Error(msg)
-		return Response{
-			Body: p.genOutRespJSON(nil, []fdk.APIError{{Code: http.StatusBadRequest, Message: msg}}),
-			Code: http.StatusBadRequest,
-			Errs: []fdk.APIError{{Code: http.StatusBadRequest, Message: msg}},
-		}
+		err = newError(ErrBadRequest, "bad job name provided: %s", err)
+		p.logger.WithField("workflow_meta", wfMeta).Error(err)
+		return p.errResp(err)
 	}
-	jobID, err := generateJobID(jobName)
+	jobID, err := p.jobIDs.JobID(ctx, jobName)
 	if err != nil {
-		msg := fmt.Sprintf("job ID could not be determined: %s", err)
-		p.logger.WithField("job_name", jobName).Error(msg)
-		return Response{
-			Body: p.genOutRespJSON(nil, []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}}),
-			Code: http.StatusInternalServerError,
-			Errs: []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}},
+		err = fmt.Errorf("job ID could not be determined: %s", err)
+		p.logger.WithField("job_name", jobName).Error(err)
+		return p.errResp(err)
+	}
+
+	warnings := p.ignoredFieldWarnings("workflow event", ignored)
+	var execRecord pkg.JobExecution
+	var recordWarnings []string
+	t := make(transitions)
+	upsert := func() (pkg.JobExecution, []string, error) {
+		return p.upsert(ctx, jobID, jobName, wfMeta, t)
+	}
+	if wfMeta.ParentExecutionID != "" {
+		upsert = func() (pkg.JobExecution, []string, error) {
+			return p.upsertStep(ctx, jobID, jobName, wfMeta)
 		}
 	}
-	jobMap, err := p.fetchObject(ctx, jobCollection, jobID)
+	err = p.retryOnConflict(func() error {
+		var err0 error
+		execRecord, recordWarnings, err0 = upsert()
+		return err0
+	})
+	warnings = append(warnings, recordWarnings...)
+	p.recordUpsert(wfMeta.Status, err)
 	if err != nil {
-		msg := fmt.Sprintf("could not fetch job record: %s", err)
 		p.logger.WithField("job_name", jobName).
-			WithField("job_id", jobID).Error(msg)
-		return Response{
-			Body: p.genOutRespJSON(nil, []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}}),
-			Code: http.StatusInternalServerError,
-			Errs: []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}},
-		}
+			WithField("job_id", jobID).Error(err)
+		return p.errResp(err)
+	}
+
+	if !executionRan(execRecord) {
+		// failing the workflow action stops the workflow before it runs against any host
+		err = newError(ErrConflict, "%s", notRunMessage(jobName, execRecord))
+		p.logger.WithField("job_id", jobID).Warn(err)
+		return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+			return p.upsertRespJSON([]pkg.JobExecution{execRecord}, errs, warnings)
+		})
 	}
-	jobInstance, err := distillJob(jobMap)
+
+	return Response{
+		Body: p.upsertRespJSON([]pkg.JobExecution{execRecord}, nil, warnings),
+		Code: http.StatusOK,
+	}
+}
+
+// ignoredFieldWarnings reports the fields ignored when decoding the source, logging them too.
+func (p *UpsertProcessor) ignoredFieldWarnings(source string, fields []string) []string {
+	if len(fields) == 0 {
+		return nil
+	}
+	p.logger.WithField("source", source).
+		WithField("fields", fields).
+		Warn("ignored unknown fields")
+	warnings := make([]string, len(fields))
+	for i, f := range fields {
+		warnings[i] = fmt.Sprintf("ignored unknown field %q of the %s", f, source)
+	}
+	return warnings
+}
+
+// upsertRespJSON serializes the execution records saved by an upsert, with its warnings.
+func (p *UpsertProcessor) upsertRespJSON(j []pkg.JobExecution, e []fdk.APIError, warnings []string) []byte {
+	if j == nil {
+		j = make([]pkg.JobExecution, 0)
+	}
+	r := jobExecutionResponse{Errs: e, Resources: j, Warnings: warnings}
+	rJSON, err := json.Marshal(r)
 	if err != nil {
-		msg := fmt.Sprintf("could not distill job record from dictionary: %s", err)
-		p.logger.WithField("job_name", jobName).
-			WithField("job_id", jobID).Error(msg)
-		return Response{
-			Body: p.genOutRespJSON(nil, []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}}),
-			Code: http.StatusInternalServerError,
-			Errs: []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}},
+		p.logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
+
+// recordUpsert counts an upserted workflow event by its status and outcome.
+func (p *UpsertProcessor) recordUpsert(status string, err error) {
+	p.metrics.Inc("upserts_total", metrics.Labels{"status": strings.ToLower(status), "outcome": metrics.Outcome(err)})
+}
+
+// upsert performs a single fetch-modify-put cycle of the job and job execution records, also returning the
+// warnings of the execution record.  VersionConflict is returned if either record was modified concurrently.  t
+// carries the status of the execution before the upsert across the retries of the cycle.
+func (p *UpsertProcessor) upsert(ctx context.Context, jobID, jobName string, wfMeta workflowMeta, t transitions) (pkg.JobExecution, []string, error) {
+	f, err := p.fetchConcurrently(ctx, jobID, jobName, wfMeta)
+	if err != nil {
+		return pkg.JobExecution{}, nil, err
+	}
+	jobInstance, jobMap, jobVersion, er := f.job, f.jobMap, f.jobVersion, f.exec
+	// the workflows of a renamed job still report its previous name
+	if er.newExec && jobInstance.Name != "" {
+		er.record.JobName = jobInstance.Name
+	}
+
+	er.record, jobInstance, err = p.applyWorkflowMeta(ctx, er.record, er.newExec, jobInstance, wfMeta, f.pages)
+	if err != nil {
+		return pkg.JobExecution{}, nil, err
+	}
+	er.record.RecordStatus(er.prevStatus, p.now(), "")
+	// the timeline of a record saved by an earlier attempt already has the change of status
+	t.restore(&er)
+	if er.record.OwnerID == "" {
+		er.record.OwnerID = jobInstance.UserID
+		er.record.OwnerName = jobInstance.UserName
+	}
+
+	err = p.putExecutionRecordObject(ctx, jobExecutionCollection, er.key, er.record, er.version)
+	if err != nil {
+		return pkg.JobExecution{}, nil, fmt.Errorf("failed to save execution record: %w", err)
+	}
+	t.saved(er)
+
+	jobInstance = p.reconcileRunCount(ctx, jobID, jobInstance, er.record)
+	expiring := !jobInstance.Expired && scheduleEnded(jobInstance, p.clock.Now())
+	if expiring {
+		jobInstance.Expired = true
+		jobInstance.NextRun = time.Time{}
+	}
+	jobMap, err = updateJobMap(jobInstance, jobMap)
+	if err != nil {
+		return pkg.JobExecution{}, nil, fmt.Errorf("failed to map job instance to job map: %s", err)
+	}
+
+	err = p.putJobMap(ctx, jobCollection, jobID, jobMap, jobVersion)
+	if err != nil {
+		return pkg.JobExecution{}, nil, fmt.Errorf("failed to save job record: %w", err)
+	}
+
+	p.notify(ctx, jobInstance, er)
+	p.alert(ctx, jobInstance, er)
+	p.ticket(ctx, jobID, jobInstance, er)
+	p.emit(ctx, er)
+	p.releaseQueued(ctx, jobID, jobInstance, er)
+	p.releaseSessionQueued(ctx, er)
+	p.enqueueRelease(ctx, jobID, er)
+	if expiring {
+		p.expire(ctx, jobID, jobInstance)
+	}
+	return er.record, er.warnings, nil
+}
+
+// transitions holds the statuses of executions before an upsert, by the key of their record, across the retries
+// of the upsert.  A retry following a conflict on the job record re-reads the execution records saved by the
+// attempts before it, so their status no longer tells whether the upsert changed it, which the hooks run once the
+// job record is saved depend on.
+type transitions map[string]string
+
+// restore sets the status of an execution before the upsert to the one of the first attempt which saved it.
+func (t transitions) restore(er *executionRecord) {
+	if prev, ok := t[er.key]; ok {
+		er.prevStatus = prev
+	}
+}
+
+// saved records the status of an execution before the upsert once its record is saved.
+func (t transitions) saved(er executionRecord) {
+	if _, ok := t[er.key]; !ok {
+		t[er.key] = er.prevStatus
+	}
+}
+
+// upsertFetch holds the records and search results fetched by an upsert before the workflow event is applied.
+type upsertFetch struct {
+	exec       executionRecord
+	job        job
+	jobMap     map[string]any
+	jobVersion string
+	// pages are the prefetched host results of the execution, or nil if they depend on the type of the job.
+	pages *searchc.Pages
+}
+
+// fetchConcurrently fetches the job record and the execution record concurrently, each bounded by
+// upsertFetchTimeout.  The host results of the execution are searched for at the same time unless the saved
+// searches depend on the type of the job, which is only known once its record is fetched.  Only the first
+// upsertPrefetchPages pages of results are fetched up front; the following pages are fetched as they are read,
+// with the context of the upsert.  The first failed fetch of a record cancels the other.
+func (p *UpsertProcessor) fetchConcurrently(ctx context.Context, jobID, jobName string, wfMeta workflowMeta) (upsertFetch, error) {
+	searchCtx := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var f upsertFetch
+	var jobErr, execErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		fctx, fcancel := context.WithTimeout(ctx, upsertFetchTimeout)
+		defer fcancel()
+		if f.job, f.jobMap, f.jobVersion, jobErr = p.fetchJob(fctx, jobID, jobName); jobErr != nil {
+			cancel()
 		}
+	}()
+	go func() {
+		defer wg.Done()
+		fctx, fcancel := context.WithTimeout(ctx, upsertFetchTimeout)
+		defer fcancel()
+		if f.exec, execErr = p.jobExecutionRecord(fctx, jobID, jobName, wfMeta); execErr != nil {
+			execErr = fmt.Errorf("failed to fetch job execution record: %w", execErr)
+			cancel()
+		}
+	}()
+	if len(p.savedSearches.JobTypes) == 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// the search client bounds each search, so the pages outlive the fetches
+			f.pages = p.execLSResults(searchCtx, wfMeta.ExecutionID, "", executionFinished(wfMeta.Status))
+			f.pages.Prefetch(upsertPrefetchPages)
+		}()
+	}
+	wg.Wait()
+
+	// the error of the fetch which failed first, rather than those canceled by it
+	for _, err := range []error{jobErr, execErr} {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return upsertFetch{}, err
+		}
+	}
+	if err := errors.Join(jobErr, execErr); err != nil {
+		return upsertFetch{}, err
+	}
+	return f, nil
+}
+
+// expire disables the schedule workflow of a job which has just expired, if the processor was configured
+// WithExpiredWorkflowDisabling.  Failures are logged rather than failing the upsert, as the records have been
+// saved.
+func (p *UpsertProcessor) expire(ctx context.Context, jobID string, j job) {
+	logger := p.logger.WithField("job_id", jobID)
+	logger.Info("job schedule has ended - job expired")
+	if !p.disableExpired || p.wfc == nil || j.Workflows == nil || j.Workflows.ScheduleWorkflow == "" {
+		return
+	}
+	if err := p.wfc.Disable(ctx, j.Workflows.ScheduleWorkflow); err != nil {
+		logger.Errorf("failed to disable the workflow of the expired job: %s", err)
+	}
+}
+
+// notify delivers a summary of the execution to the notification targets and callback URL of the job if the
+// execution changed status.  Delivery failures are logged rather than failing the upsert, as the records have
+// been saved.
+func (p *UpsertProcessor) notify(ctx context.Context, j job, er executionRecord) {
+	if p.notifier == nil || er.record.RunStatus == er.prevStatus {
+		return
 	}
+	logger := p.logger.WithField("execution_id", er.record.ExecutionID)
+	s := notifier.NewSummary(er.record)
 
-	jobExecutionKey, execRecord, newExec, err := p.jobExecutionRecord(ctx, jobID, jobName, wfMeta)
+	if len(j.NotificationTargets) > 0 {
+		if err := p.notifier.Notify(ctx, j.NotificationTargets, s); err != nil {
+			logger.Errorf("failed to deliver notifications: %s", err)
+		}
+	}
+
+	if j.CallbackURL != "" {
+		var cs callbackSettings
+		err := fetchSettings(ctx, p.strgc, callbackSettingsName, &cs)
+		if err != nil && !errors.Is(err, storagec.NotFound) {
+			logger.Errorf("failed to fetch callback settings - not calling back: %s", err)
+			return
+		}
+		if cs.SigningSecret == "" {
+			logger.Warn("no callback signing secret configured - callback will be unsigned")
+		}
+		if err = p.notifier.Callback(ctx, j.CallbackURL, cs.SigningSecret, s); err != nil {
+			logger.Errorf("failed to deliver callback: %s", err)
+		}
+	}
+}
+
+// resolveHostGroups records the host groups targeted by the job and their members at the time the execution
+// starts, as group membership may change before or during the execution.  Resolution failures are logged rather
+// than failing the upsert, as they must not stop the execution.
+func (p *UpsertProcessor) resolveHostGroups(ctx context.Context, execRecord pkg.JobExecution, j job) pkg.JobExecution {
+	if p.hstc == nil || j.Target == nil || len(j.Target.HostGroups) == 0 {
+		return execRecord
+	}
+	execRecord.HostGroups = j.Target.HostGroups
+
+	members, err := p.hstc.GroupMembers(ctx, j.Target.HostGroups)
 	if err != nil {
-		msg := fmt.Sprintf("failed to fetch job execution record: %s", err)
-		p.logger.Error(msg)
-		return Response{
-			Body: p.genOutRespJSON(nil, []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}}),
-			Code: http.StatusInternalServerError,
-			Errs: []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}},
+		p.logger.WithField("execution_id", execRecord.ExecutionID).
+			Errorf("failed to resolve host group members: %s", err)
+		return execRecord
+	}
+	execRecord.ResolvedHosts = make([]pkg.ResolvedHost, len(members))
+	for i, m := range members {
+		execRecord.ResolvedHosts[i] = pkg.ResolvedHost{DeviceID: m.DeviceID, HostName: m.HostName, Platform: m.Platform}
+	}
+	return execRecord
+}
+
+// expectedFileHash returns the hash of the put file installed by the job, see expectedFileHash.  Failures are
+// logged rather than failing the upsert, leaving the integrity of the file unverified.
+func (p *UpsertProcessor) expectedFileHash(ctx context.Context, j job) string {
+	hash, err := expectedFileHash(ctx, p.strgc, j)
+	if err != nil {
+		p.logger.WithField("job_name", j.Name).Warnf("not verifying the integrity of the installed file: %s", err)
+		addWarning(ctx, "integrity of the file installed by job %s not verified: %s", j.Name, err)
+	}
+	return hash
+}
+
+// retryOnConflict runs work, retrying it with exponential backoff for as long as it returns VersionConflict.
+func (p *UpsertProcessor) retryOnConflict(work func() error) error {
+	r := retrier.New(p.conflictBackoff, retrier.WhitelistClassifier{storagec.VersionConflict})
+	r.SetJitter(0.25)
+	attempt := 0
+	return r.Run(func() error {
+		attempt++
+		if attempt > 1 {
+			p.logger.WithField("attempt", attempt).Info("retrying upsert after version conflict")
+		}
+		return work()
+	})
+}
+
+// applyWorkflowMeta applies a single workflow metadata event to a job execution record and
+// advances the run statistics of the job it belongs to.  New executions of a paused job, those started during a
+// blackout, those triggered outside its maintenance window, and those exceeding the maximum concurrent runs of
+// the job, are recorded as skipped, deferred or queued without advancing the run statistics, and the record is
+// left unchanged by any later event.
+func (p *UpsertProcessor) applyWorkflowMeta(ctx context.Context, execRecord pkg.JobExecution, newExec bool, jobInstance job, wfMeta workflowMeta, pages *searchc.Pages) (pkg.JobExecution, job, error) {
+	var blackouts blackoutCalendar
+	if newExec && executionRan(execRecord) {
+		blackouts = loadBlackouts(ctx, p.strgc, p.logger)
+	}
+	b, blackedOut := blackouts.covering(p.clock.Now())
+	switch {
+	case !executionRan(execRecord):
+		return execRecord, jobInstance, nil
+	case newExec && jobInstance.Paused:
+		return p.skipExecution(execRecord, pkg.SkipReasonPaused), jobInstance, nil
+	case newExec && wfMeta.Status == pkg.StatusInProgress && blackedOut:
+		execRecord = p.skipExecution(execRecord, pkg.SkipReasonBlackout)
+		execRecord.StatusReason = fmt.Sprintf("started during blackout %s", b.name)
+		return execRecord, p.skipBlackout(jobInstance, blackouts), nil
+	case newExec && wfMeta.Status == pkg.StatusInProgress && p.outsideWindow(jobInstance):
+		return p.deferExecution(execRecord), jobInstance, nil
+	case newExec && wfMeta.Status == pkg.StatusInProgress && jobInstance.MaxConcurrentRuns > 0:
+		overlaps, err := p.overlapsRunning(ctx, execRecord, jobInstance.MaxConcurrentRuns)
+		if err != nil {
+			return execRecord, jobInstance, fmt.Errorf("failed to count running executions: %w", err)
 		}
+		if overlaps && jobInstance.OverlapPolicy == overlapPolicyQueue {
+			return p.queueExecution(execRecord, pkg.QueueReasonOverlap), jobInstance, nil
+		}
+		if overlaps {
+			return p.skipExecution(execRecord, pkg.SkipReasonOverlap), jobInstance, nil
+		}
+	}
+	if newExec {
+		execRecord = p.resolveHostGroups(ctx, execRecord, jobInstance)
+		execRecord.EstimatedSessions = estimateSessions(execRecord, jobInstance)
 	}
+	if newExec && wfMeta.Status == pkg.StatusInProgress && p.sessionCeiling > 0 {
+		exceeds, err := p.exceedsSessionCeiling(ctx, execRecord)
+		if err != nil {
+			return execRecord, jobInstance, fmt.Errorf("failed to count the sessions of running executions: %w", err)
+		}
+		if exceeds {
+			return p.queueExecution(execRecord, pkg.QueueReasonSessionQuota), jobInstance, nil
+		}
+	}
+
 	endDate := execRecord.EndDate
 	if endDate == "" {
 		endDate = p.now()
 		if wfMeta.Status == pkg.StatusCompleted || wfMeta.Status == pkg.StatusFailed {
 			execRecord.EndDate = endDate
+			addWarning(ctx, "no end time recorded for execution %s - duration computed up to the event", execRecord.ExecutionID)
 		}
 	}
-	d, err := computeJobDuration(execRecord.RunDate, endDate, wfMeta.Status)
+	d, secs, err := computeJobDuration(execRecord.RunDate, endDate, wfMeta.Status, p.clock.Now())
 	if err != nil {
-		msg := fmt.Sprintf("failed to compute job duration execution: %s", err)
-		p.logger.Error(msg)
-		return Response{
-			Body: p.genOutRespJSON(nil, []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}}),
-			Code: http.StatusInternalServerError,
-			Errs: []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}},
-		}
+		return execRecord, jobInstance, fmt.Errorf("failed to compute job duration execution: %s", err)
 	}
 	if d != "" {
 		execRecord.Duration = d
+		execRecord.DurationSeconds = secs
 	}
 
 	if wfMeta.Status != "" {
 		execRecord.RunStatus = wfMeta.Status
 	}
 
-	lsResp, err := p.execLSResults(ctx, wfMeta.ExecutionID)
-	if err != nil {
-		msg := fmt.Sprintf("failed to execute logscale search: %s", err)
-		p.logger.Error(msg)
-		return Response{
-			Body: p.genOutRespJSON(nil, []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}}),
-			Code: http.StatusInternalServerError,
-			Errs: []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}},
-		}
+	if len(jobInstance.Steps) > 0 {
+		// the workflow of a composite job runs no action of its own, its hosts being rolled up from the events of
+		// its steps, see upsertStep
+		execRecord = keepStepHosts(execRecord)
+	} else if execRecord, err = p.applyHostsMeta(ctx, execRecord, newExec, jobInstance, wfMeta, pages); err != nil {
+		return execRecord, jobInstance, err
 	}
-
-	hosts := extractHostsFromLogscale(lsResp, p.logger)
-	execRecord.TargetedHosts = hosts
-	execRecord.NumHosts = len(hosts)
-	if !newExec {
-		execRecord.LogscaleOutput = lsResp.JobURL
+	if executionFinished(wfMeta.Status) {
+		execRecord = evaluateSLA(execRecord, jobInstance.SLA)
+	}
+	if !execRecord.PendingEnrichment {
+		execRecord.EnrichmentAttempts = 0
 	}
 
-	jobInstance, err = p.updateJobRunStats(jobInstance, execRecord.RunStatus)
-	if err != nil {
-		msg := fmt.Sprintf("failed to update job record: %s", err)
-		p.logger.Error(msg)
-		return Response{
-			Body: p.genOutRespJSON(nil, []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}}),
-			Code: http.StatusInternalServerError,
-			Errs: []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}},
+	if execRecord.RunStatus == pkg.StatusInProgress && newExec {
+		jobInstance, err = p.updateJobRunStats(jobInstance, blackouts)
+		if err != nil {
+			return execRecord, jobInstance, fmt.Errorf("failed to update job record: %s", err)
 		}
+		execRecord.CountedRun = true
+		jobInstance.LastExecutionID = execRecord.ExecutionID
+	}
+	if execRecord.ExecutionID == jobInstance.LastExecutionID {
+		jobInstance.LastRunStatus = execRecord.RunStatus
 	}
+	return execRecord, jobInstance, nil
+}
 
-	jobMap, err = updateJobMap(jobInstance, jobMap)
+// applyHostsMeta searches Logscale for the host results of the execution reported by a workflow event and
+// applies them to its record.
+func (p *UpsertProcessor) applyHostsMeta(ctx context.Context, execRecord pkg.JobExecution, newExec bool, jobInstance job, wfMeta workflowMeta, pages *searchc.Pages) (pkg.JobExecution, error) {
+	if pages == nil {
+		pages = p.execLSResults(ctx, wfMeta.ExecutionID, jobInstance.actionType(), executionFinished(wfMeta.Status))
+	}
+	x, err := extractHosts(pages, jobInstance.actionType(), p.logger.WithField("execution_id", wfMeta.ExecutionID))
 	if err != nil {
-		msg := fmt.Sprintf("failed to map job instance to job map: %s", err)
-		p.logger.Error(msg)
-		return Response{
-			Body: p.genOutRespJSON(nil, []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}}),
-			Code: http.StatusInternalServerError,
-			Errs: []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}},
-		}
+		return execRecord, fmt.Errorf("failed to execute logscale search: %w", err)
+	}
+	hosts := p.outputPolicy.apply(ctx, p.strgc, execRecord.ID, wfMeta.ExecutionID, x.Hosts, p.logger)
+	lsResp := pages.Response()
+	if lsResp.Partial && len(hosts) < len(execRecord.TargetedHosts) {
+		// keep what an earlier event recorded rather than replacing it with results which are known to be incomplete
+		p.logger.WithField("execution_id", wfMeta.ExecutionID).
+			Warnf("logscale returned %d of %d previously recorded hosts - keeping existing hosts", len(hosts), len(execRecord.TargetedHosts))
+		addWarning(ctx, "logscale returned partial results for execution %s - kept the %d hosts recorded earlier", wfMeta.ExecutionID, len(execRecord.TargetedHosts))
+	} else {
+		execRecord.TargetedHosts = hosts
+		execRecord.NumHosts = len(hosts)
+		execRecord.HostsTruncated = x.Truncated
 	}
+	if x.Truncated {
+		addWarning(ctx, "results of execution %s truncated to %d hosts", wfMeta.ExecutionID, maxExtractedHosts)
+	}
+	// hosts missing from Logscale are backfilled later by the EnrichmentProcessor
+	execRecord.PendingEnrichment = len(execRecord.TargetedHosts) == 0
+	if execRecord.PendingEnrichment {
+		addWarning(ctx, "logscale returned no host results for execution %s - pending enrichment", wfMeta.ExecutionID)
+	}
+	execRecord = flagPlatformMismatches(execRecord, jobInstance.targetPlatforms())
+	execRecord = verifyFileIntegrity(execRecord, p.expectedFileHash(ctx, jobInstance))
+	execRecord = applyHostResults(execRecord)
+	if !newExec {
+		execRecord.LogscaleOutput = lsResp.JobURL
+	}
+	return execRecord, nil
+}
 
-	err = p.putExecutionRecordObject(ctx, jobExecutionCollection, jobExecutionKey, execRecord)
-	if err != nil {
-		msg := fmt.Sprintf("failed to save execution record: %s", err)
-		p.logger.Error(msg)
-		return Response{
-			Body: p.genOutRespJSON(nil, []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}}),
-			Code: http.StatusInternalServerError,
-			Errs: []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}},
-		}
+// keepStepHosts counts the hosts rolled up from the steps of a composite job on its execution.
+func keepStepHosts(execRecord pkg.JobExecution) pkg.JobExecution {
+	if execRecord.TargetedHosts == nil {
+		execRecord.TargetedHosts = make([]pkg.TargetedHost, 0)
 	}
+	execRecord.NumHosts = len(execRecord.TargetedHosts)
+	execRecord.PendingEnrichment = false
+	return applyHostResults(execRecord)
+}
 
-	err = p.putJobMap(ctx, jobCollection, jobID, jobMap)
-	if err != nil {
-		msg := fmt.Sprintf("failed to save job record: %s", err)
-		p.logger.Error(msg)
-		return Response{
-			Body: p.genOutRespJSON(nil, []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}}),
-			Code: http.StatusInternalServerError,
-			Errs: []fdk.APIError{{Code: http.StatusInternalServerError, Message: msg}},
+// fetchJob fetches and distills the record of a job, also returning it as a map and its version.  A malformed
+// record is quarantined and replaced by a placeholder draft job, so that the executions of the job are still
+// recorded and its owner can save it again.
+func (p *UpsertProcessor) fetchJob(ctx context.Context, jobID, jobName string) (job, map[string]any, string, error) {
+	jobMap, version, err := p.fetchObject(ctx, jobCollection, jobID)
+	if err == nil {
+		var j job
+		if j, err = distillJob(jobMap); err == nil {
+			return j, jobMap, version, nil
 		}
+		err = fmt.Errorf("could not distill job record from dictionary: %w: %s", errMalformedRecord, err)
+	}
+	if !errors.Is(err, errMalformedRecord) {
+		return job{}, nil, "", fmt.Errorf("could not fetch job record: %w", err)
+	}
+	if err = p.quarantine(ctx, jobCollection, jobID, err); err != nil {
+		return job{}, nil, "", err
 	}
 
-	return Response{
-		Body: jobExecRespJSON(nil, []pkg.JobExecution{execRecord}, nil, p.logger),
-		Code: http.StatusOK,
+	jobMap = placeholderJobMap(jobID, jobName, caller{}, p.clock.Now())
+	j, err := distillJob(jobMap)
+	if err != nil {
+		return job{}, nil, "", fmt.Errorf("could not distill placeholder job record: %s", err)
 	}
+	return j, jobMap, "", nil
 }
 
-func (p *UpsertProcessor) jobExecutionRecord(ctx context.Context, jobID, jobName string, wfMeta workflowMeta) (string, pkg.JobExecution, bool, error) {
+func (p *UpsertProcessor) jobExecutionRecord(ctx context.Context, jobID, jobName string, wfMeta workflowMeta) (executionRecord, error) {
 	tsNano, err := time.Parse(pkg.ISOTimeFormat, wfMeta.ExecutionTimestamp)
 	if err != nil {
-		return "", pkg.JobExecution{}, false, fmt.Errorf("failed to parse execution timestamp: %s", err)
+		return executionRecord{}, fmt.Errorf("failed to parse execution timestamp: %s", err)
 	}
 	var execRecordMap map[string]any
+	version := ""
 	jobExecutionKey, err := p.locateJobExecution(ctx, wfMeta.ExecutionID)
 	if jobExecutionKey == "" {
 		jobExecutionKey = fmt.Sprintf("%d_%s", tsNano.UnixNano(), wfMeta.ExecutionID)
 		err = storagec.NotFound
 	} else {
-		execRecordMap, err = p.fetchObject(ctx, jobExecutionCollection, jobExecutionKey)
+		execRecordMap, version, err = p.fetchObject(ctx, jobExecutionCollection, jobExecutionKey)
 	}
 	newExec := false
 	if err != nil {
+		if errors.Is(err, errMalformedRecord) {
+			if err = p.quarantine(ctx, jobExecutionCollection, jobExecutionKey, err); err != nil {
+				return executionRecord{}, err
+			}
+			// the fresh record replaces the malformed one under the same key
+			err, version = storagec.NotFound, ""
+		}
 		if !errors.Is(err, storagec.NotFound) {
-			return "", pkg.JobExecution{}, false, err
+			return executionRecord{}, err
 		}
 		newExec = true
 		p.logger.WithField("object_key", jobExecutionKey).
 			WithField("execution_id", wfMeta.ExecutionID).
 			Error("job execution not found, creating")
-		execRecordMap = map[string]any{
-			"execution_id": wfMeta.ExecutionID,
-			"id":           jobID,
-			"job_id":       jobID,
-			"name":         jobName,
-			"run_date":     wfMeta.ExecutionTimestamp,
-		}
+		execRecordMap = newExecRecordMap(jobID, jobName, wfMeta)
 	}
 
-	execRecord, err := mapToJobExecution(execRecordMap)
+	execRecord, ignored, err := p.decodeExecRecord(execRecordMap)
+	if errors.Is(err, pkg.UnknownFields) {
+		return executionRecord{}, fmt.Errorf("failed to decode job execution record: %w", err)
+	}
+	if err != nil && !newExec {
+		err = fmt.Errorf("failed to deserialize job execution record: %w: %s", errMalformedRecord, err)
+		if err = p.quarantine(ctx, jobExecutionCollection, jobExecutionKey, err); err != nil {
+			return executionRecord{}, err
+		}
+		newExec, version = true, ""
+		execRecord, err = mapToJobExecution(newExecRecordMap(jobID, jobName, wfMeta))
+	}
 	if err != nil {
-		return jobExecutionKey, pkg.JobExecution{}, false, fmt.Errorf("failed to deserialize job execution record: %s", err)
+		return executionRecord{}, fmt.Errorf("failed to deserialize job execution record: %s", err)
 	}
 
-	return jobExecutionKey, execRecord, newExec, nil
+	return executionRecord{
+		key:        jobExecutionKey,
+		newExec:    newExec,
+		prevStatus: execRecord.RunStatus,
+		record:     execRecord,
+		version:    version,
+		warnings:   p.ignoredFieldWarnings("execution record "+jobExecutionKey, ignored),
+	}, nil
 }
 
-func (p *UpsertProcessor) locateJobExecution(ctx context.Context, execID string) (string, error) {
-	sr, err := p.strgc.Search(ctx, storagec.SearchObjectsRequest{
-		Collection: jobExecutionCollection,
-		Filter:     fmt.Sprintf("execution_id:'%s'", execID),
-	})
-	if len(sr.ObjectKeys) == 0 {
-		return "", err
-	}
-	// there can only be one
-	return sr.ObjectKeys[0], err
-}
-
-func extractHostsFromLogscale(sr searchc.SearchResponse, l logrus.FieldLogger) []pkg.TargetedHost {
-	events := sr.Events
-	if len(events) == 0 {
-		return make([]pkg.TargetedHost, 0)
-	}
-
-	devSet := make(map[string]logscaleRecord)
-	for _, e := range events {
-		lr, lrOk := extractLogscaleInstall(e)
-		if !lrOk {
-			lr, lrOk = extractLogscaleRemove(e, l)
-		}
-		if lrOk {
-			devSet[lr.HostName] = lr
+// decodeExecRecord decodes a stored execution record, returning the fields it has no field for.  The fields the
+// storage client adds to the objects it stores are not reported.
+func (p *UpsertProcessor) decodeExecRecord(m map[string]any) (pkg.JobExecution, []string, error) {
+	fields := make(map[string]any, len(m))
+	for k, v := range m {
+		if k != storagec.TenantField && !strings.HasPrefix(k, "_") {
+			fields[k] = v
 		}
 	}
-
-	devs, i := make([]pkg.TargetedHost, len(devSet)), 0
-	for _, d := range devSet {
-		status := pkg.StatusFailed
-		if d.Success == "true" {
-			status = pkg.StatusCompleted
-		}
-		devs[i] = pkg.TargetedHost{
-			DeviceID: "",
-			HostName: d.HostName,
-			Status:   status,
-		}
-		i++
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return pkg.JobExecution{}, nil, err
 	}
+	var je pkg.JobExecution
+	ignored, err := pkg.DecodeJSON(b, &je, p.strictDecoding)
+	return je, ignored, err
+}
 
-	sort.Slice(devs, func(i, j int) bool {
-		return devs[i].HostName <= devs[j].HostName
-	})
-
-	return devs
+// newExecRecordMap returns the record of an execution first reported by the workflow event.
+func newExecRecordMap(jobID, jobName string, wfMeta workflowMeta) map[string]any {
+	return map[string]any{
+		"execution_id": wfMeta.ExecutionID,
+		"id":           jobID,
+		"job_id":       jobID,
+		"name":         jobName,
+		"run_date":     wfMeta.ExecutionTimestamp,
+	}
 }
 
-func extractLogscaleInstall(e map[string]any) (logscaleRecord, bool) {
-	hostName := ""
-	ok := false
-	s := ""
-	stderr := ""
-	stdout := ""
+func (p *UpsertProcessor) locateJobExecution(ctx context.Context, execID string) (string, error) {
+	return locateJobExecution(ctx, p.strgc, execID)
+}
 
-	for k, v := range e {
-		k = strings.ToLower(k)
-		switch {
-		case strings.HasSuffix(k, "device.getdetails.hostname"):
-			if s, ok = v.(string); ok && strings.TrimSpace(s) != "" {
-				hostName = strings.TrimSpace(s)
-			}
-		case strings.HasSuffix(k, "rtr.putandrun.stderr"):
-			if s, ok = v.(string); ok && strings.TrimSpace(s) != "" {
-				stderr = strings.TrimSpace(s)
-			}
-		case strings.HasSuffix(k, "rtr.putandrun.stdout"):
-			if s, ok = v.(string); ok && strings.TrimSpace(s) != "" {
-				stdout = strings.TrimSpace(s)
-			}
+// applyHostResults counts the hosts on which the execution succeeded and failed, and derives the status of a
+// completed execution from them, so that executions which failed on some hosts are completed with errors.
+func applyHostResults(je pkg.JobExecution) pkg.JobExecution {
+	je.SucceededHosts, je.FailedHosts = 0, 0
+	for _, h := range je.TargetedHosts {
+		switch h.Status {
+		case pkg.StatusCompleted:
+			je.SucceededHosts++
+		case pkg.StatusFailed:
+			je.FailedHosts++
 		}
 	}
-
-	if hostName == "" {
-		return logscaleRecord{}, false
-	}
-	if stderr != "" {
-		return logscaleRecord{HostName: hostName, Success: "false"}, true
+	switch {
+	case je.RunStatus == pkg.StatusCompleted && je.FailedHosts > 0:
+		je.RunStatus = pkg.StatusCompletedWithErrors
+	case je.RunStatus == pkg.StatusCompletedWithErrors && je.FailedHosts == 0:
+		je.RunStatus = pkg.StatusCompleted
 	}
-	return logscaleRecord{HostName: hostName, Success: "true"}, stdout != ""
+	return je
 }
 
-func extractLogscaleRemove(e map[string]any, l logrus.FieldLogger) (logscaleRecord, bool) {
-	hostName := ""
-	ok := false
-	s := ""
-	checkSuccessful := ""
-	removeSuccessful := ""
-
-	for k, v := range e {
-		k = strings.ToLower(k)
-		switch {
-		case strings.HasSuffix(k, "device.getdetails.hostname"):
-			if s, ok = v.(string); ok && strings.TrimSpace(s) != "" {
-				hostName = strings.TrimSpace(s)
-			}
-		case strings.HasSuffix(k, "rtr.app_check_file_exist_rtr_2.file_exists"):
-			if s, ok = v.(string); ok && strings.TrimSpace(s) != "" {
-				checkSuccessful = strings.TrimSpace(s)
-			}
-		case strings.HasSuffix(k, "rtr.app_remove_file_rtr_2.file_exists"):
-			if s, ok = v.(string); ok && strings.TrimSpace(s) != "" {
-				removeSuccessful = strings.TrimSpace(s)
-			}
-		case strings.HasSuffix(k, "rtr.app_remove_file_rtr_2.response"):
-			if s, ok = v.(string); ok && strings.TrimSpace(s) != "" {
-				rs, err := isRemoveSuccessful(s)
-				if err != nil {
-					l.WithField("key", k).Error(err)
-					return logscaleRecord{}, false
-				}
-				if rs != "" {
-					removeSuccessful = rs
-				}
-			}
-		}
+// evaluateSLA records which objectives of the SLA of its job a finished execution breached.  The success rate is
+// not evaluated until hosts have reported results.
+func evaluateSLA(je pkg.JobExecution, sla *jobSLA) pkg.JobExecution {
+	je.SLABreached, je.SLABreaches = false, nil
+	if sla == nil {
+		return je
 	}
-
-	if hostName == "" {
-		return logscaleRecord{}, false
+	if sla.MaxDurationSeconds > 0 && je.DurationSeconds > sla.MaxDurationSeconds {
+		je.SLABreaches = append(je.SLABreaches, pkg.SLABreachMaxDuration)
 	}
-	if removeSuccessful != "" {
-		checkSuccessful = removeSuccessful
+	if reported := je.SucceededHosts + je.FailedHosts; sla.MinSuccessRate > 0 && reported > 0 {
+		if float64(je.SucceededHosts)/float64(reported) < sla.MinSuccessRate {
+			je.SLABreaches = append(je.SLABreaches, pkg.SLABreachMinSuccessRate)
+		}
 	}
-	return logscaleRecord{HostName: hostName, Success: checkSuccessful},
-		checkSuccessful == "true" || checkSuccessful == "false"
+	je.SLABreached = len(je.SLABreaches) > 0
+	return je
 }
 
-func isRemoveSuccessful(s string) (string, error) {
-	var m map[string]any
-	if err := json.Unmarshal([]byte(s), &m); err != nil {
-		return "", err
+// verifyFileIntegrity marks the hosts which reported a hash of the installed file other than the expected hash as
+// failed.  Hosts which reported no hash, or had already failed, are left as they are, as is every host if the
+// expected hash is not known.
+func verifyFileIntegrity(je pkg.JobExecution, expected string) pkg.JobExecution {
+	if expected == "" {
+		return je
 	}
-
-	existsA, ok := m["file_exists"]
-	if !ok {
-		return "", nil
+	for i, h := range je.TargetedHosts {
+		if h.FileHash == "" || h.FileHash == expected || h.Status != pkg.StatusCompleted {
+			continue
+		}
+		h.Status = pkg.StatusFailed
+		h.FailureReason = pkg.FailureReasonIntegrityCheck
+		h.Error = fmt.Sprintf("file hash %s does not match the expected hash %s", h.FileHash, expected)
+		je.TargetedHosts[i] = h
 	}
+	return je
+}
 
-	if existsS, ok := existsA.(string); ok {
-		if existsS == "true" || existsS == "false" {
-			return existsS, nil
+// flagPlatformMismatches marks the hosts whose platform is not one of the platforms targeted by the job as
+// skipped, including resolved host group members which reported no results because the workflow skipped them.
+// Hosts of unknown platform are left as they are.
+func flagPlatformMismatches(je pkg.JobExecution, platforms []string) pkg.JobExecution {
+	if len(platforms) == 0 {
+		return je
+	}
+	targeted := make(map[string]bool, len(platforms))
+	for _, pl := range platforms {
+		targeted[pl] = true
+	}
+	skip := func(h pkg.TargetedHost) pkg.TargetedHost {
+		h.Status = pkg.StatusSkipped
+		h.SkipReason = pkg.SkipReasonPlatform
+		h.Error = fmt.Sprintf("platform %s is not targeted by the job", h.Platform)
+		return h
+	}
+
+	seen := make(map[string]bool, len(je.TargetedHosts))
+	hosts := make([]pkg.TargetedHost, 0, len(je.TargetedHosts))
+	for _, h := range je.TargetedHosts {
+		seen[h.DeviceID] = true
+		if h.Platform != "" && !targeted[h.Platform] {
+			h = skip(h)
 		}
-		return "", fmt.Errorf("unknown truth value: %q", existsS)
+		hosts = append(hosts, h)
 	}
-	if existsB, ok := existsA.(bool); ok {
-		if existsB {
-			return "true", nil
+	for _, r := range je.ResolvedHosts {
+		if seen[r.DeviceID] || r.Platform == "" || targeted[r.Platform] {
+			continue
 		}
-		return "false", nil
+		hosts = append(hosts, skip(pkg.TargetedHost{DeviceID: r.DeviceID, HostName: r.HostName, Platform: r.Platform}))
 	}
-
-	return "", fmt.Errorf("unknown truth value: %v", existsA)
+	sort.SliceStable(hosts, func(i, j int) bool {
+		return hosts[i].HostName < hosts[j].HostName
+	})
+	je.TargetedHosts = hosts
+	je.NumHosts = len(hosts)
+	return je
 }
 
 func mapToJobExecution(m map[string]any) (pkg.JobExecution, error) {
@@ -421,28 +903,31 @@ func mapToJobExecution(m map[string]any) (pkg.JobExecution, error) {
 	return j, err
 }
 
-func computeJobDuration(start, end, status string) (string, error) {
+// computeJobDuration formats the time elapsed between start and end, or between start and now if an execution in
+// progress has no end, and returns it in whole seconds too.
+func computeJobDuration(start, end, status string, now time.Time) (string, int64, error) {
 	if start == "" {
-		return "", nil
+		return "", 0, nil
 	}
-	if !(status == pkg.StatusFailed || status == pkg.StatusInProgress || status == pkg.StatusCompleted) {
-		return "", nil
+	if !(pkg.IsFinished(status) || status == pkg.StatusInProgress) {
+		return "", 0, nil
 	}
 	if status == pkg.StatusInProgress && end == "" {
-		end = time.Now().UTC().Format(pkg.ISOTimeFormat)
+		end = now.Format(pkg.ISOTimeFormat)
 	}
 
 	startT, err := time.Parse(pkg.ISOTimeFormat, start)
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 	endT, err := time.Parse(pkg.ISOTimeFormat, end)
 	if err != nil {
-		return "", err
+		return "", 0, err
 	}
 
 	days, hours, minutes, seconds := int64(0), int64(0), int64(0), int64(0)
 	delta := endT.UnixNano() - startT.UnixNano()
+	total := max(delta/int64(time.Second), 0)
 	days = delta / int64(time.Hour*24)
 	delta -= int64(time.Hour*24) * days
 	if delta > 0 {
@@ -460,57 +945,65 @@ func computeJobDuration(start, end, status string) (string, error) {
 	if days > 0 {
 		hours += 24 * days
 	}
-	return fmt.Sprintf("%02d:%02d:%02d", hours, minutes, seconds), nil
+	return fmt.Sprintf("%02d:%02d:%02d", hours, minutes, seconds), total, nil
 }
 
-func wfMetaFromRequest(req fdk.Request) (workflowMeta, error) {
+// wfMetaFromRequest decodes the workflow event of a request, also returning the fields it has no field for, which
+// fail the decoding if strict is true.  Its status is normalized by statuses.
+func wfMetaFromRequest(req fdk.Request, strict bool, statuses pkg.StatusMapping) (workflowMeta, []string, error) {
 	var wfMeta workflowMeta
 
 	if len(req.Body) == 0 {
-		return wfMeta, errors.New("empty request body")
+		return wfMeta, nil, errors.New("empty request body")
 	}
-	if err := json.Unmarshal(req.Body, &wfMeta); err != nil {
-		return wfMeta, err
+	ignored, err := pkg.DecodeJSON(req.Body, &wfMeta, strict)
+	if err != nil {
+		return wfMeta, ignored, err
 	}
+	wfMeta, err = validateWFMeta(wfMeta, statuses)
+	return wfMeta, ignored, err
+}
 
-	if wfMeta.ExecutionID == "" {
-		return wfMeta, errors.New("missing execution ID")
-	}
-	if wfMeta.DefinitionName == "" {
-		return wfMeta, errors.New("missing definition name")
-	}
-	if strings.Index(wfMeta.DefinitionName, "-") < 0 {
-		return wfMeta, errors.New("definition name does not contain job name")
+func validateWFMeta(wfMeta workflowMeta, statuses pkg.StatusMapping) (workflowMeta, error) {
+	err := validate.Fields(
+		validate.Field{Name: "execution_id", Value: wfMeta.ExecutionID, Rules: []validate.Rule{validate.Required()}},
+		validate.Field{Name: "definition_name", Value: wfMeta.DefinitionName, Rules: []validate.Rule{
+			validate.Required(),
+			validate.Check(func(v string) bool { return strings.Contains(v, "-") }, "does not contain job name"),
+		}},
+	)
+	if err != nil {
+		return wfMeta, err
 	}
-	wfMeta.Status = pkg.NormalizeJobStatus(wfMeta.Status)
+	wfMeta.Status = statuses.Normalize(wfMeta.Status)
 
 	return wfMeta, nil
 }
 
-func (p *UpsertProcessor) putExecutionRecordObject(ctx context.Context, collection, object string, execRecord pkg.JobExecution) error {
+func (p *UpsertProcessor) putExecutionRecordObject(ctx context.Context, collection, object string, execRecord pkg.JobExecution, version string) error {
 	execRecordB, err := json.Marshal(execRecord)
 	if err != nil {
 		return err
 	}
-	return p.putObject(ctx, collection, object, execRecordB)
+	return p.putObject(ctx, collection, object, execRecordB, version)
 }
 
-func (p *UpsertProcessor) putJobMap(ctx context.Context, collection, object string, jobMap map[string]any) error {
+func (p *UpsertProcessor) putJobMap(ctx context.Context, collection, object string, jobMap map[string]any, version string) error {
 	jobB, err := json.Marshal(jobMap)
 	if err != nil {
 		return err
 	}
-	return p.putObject(ctx, collection, object, jobB)
+	return p.putObject(ctx, collection, object, jobB, version)
 }
 
-func (p *UpsertProcessor) putObject(ctx context.Context, collection, object string, data []byte) error {
-	req := storagec.PutObjectRequest{
-		Collection: collection,
-		Data:       data,
-		ObjectKey:  object,
-	}
-	_, err := p.strgc.PutObject(ctx, req)
-	return err
+func (p *UpsertProcessor) putObject(ctx context.Context, collection, object string, data []byte, version string) error {
+	return putObject(ctx, p.strgc, collection, object, data, version)
+}
+
+func (p *UpsertProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return p.genOutRespJSON(nil, errs)
+	})
 }
 
 func (p *UpsertProcessor) genOutRespJSON(g []generateOutputResponseResource, e []fdk.APIError) []byte {
@@ -523,55 +1016,33 @@ func (p *UpsertProcessor) genOutRespJSON(g []generateOutputResponseResource, e [
 	return rJSON
 }
 
-func (p *UpsertProcessor) execLSResults(ctx context.Context, execID string) (searchc.SearchResponse, error) {
-	req := searchc.SearchRequest{
-		SearchName: "Query By WorkflowRootExecutionID",
-		SearchParams: map[string]string{
-			"execution_id": execID,
-		},
+// execLSResults returns an iterator over the pages of Logscale events holding the host results of an execution
+// of a job of the given action type.  When poll is true and the processor was configured WithSearchPolling, the
+// searches are repeated until results are available.
+func (p *UpsertProcessor) execLSResults(ctx context.Context, execID, jobType string, poll bool) *searchc.Pages {
+	reqs := p.savedSearches.Requests(searchc.QueryExecutionResults, jobType, map[string]string{
+		"execution_id": execID,
+	})
+	if poll {
+		for i := range reqs {
+			reqs[i].MaxWait = p.searchMaxWait
+			reqs[i].PollInterval = p.searchPollEvery
+		}
 	}
-	return p.srchc.Search(ctx, req)
+	return searchc.NewPages(ctx, p.srchc, reqs...)
 }
 
-func (p *UpsertProcessor) fetchObject(ctx context.Context, collection, objectKey string) (map[string]any, error) {
-	req := storagec.FetchObjectRequest{
-		Collection: collection,
-		ObjectKey:  objectKey,
-	}
-	resp, err := p.strgc.FetchObject(ctx, req)
-	if errors.Is(err, storagec.NotFound) {
-		return nil, err
-	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch record: %s", err)
-	}
-	if len(resp.Data) == 0 {
-		return nil, storagec.NotFound
-	}
-
-	data, err := pkg.DecodeBase64JSON(resp.Data)
-	if err != nil {
-		return nil, fmt.Errorf("failed to deserialize record: %s", err)
-	}
-
-	var obj map[string]any
-	if err = json.Unmarshal(data, &obj); err != nil {
-		return nil, fmt.Errorf("failed to deserialize record: %s", err)
-	}
-	return obj, nil
+func (p *UpsertProcessor) fetchObject(ctx context.Context, collection, objectKey string) (map[string]any, string, error) {
+	return fetchObject(ctx, p.strgc, collection, objectKey)
 }
 
-func (p *UpsertProcessor) now() string {
-	return p.nowProvider().Format(pkg.ISOTimeFormat)
+// executionFinished reports whether a workflow event with the given status is the last event of its execution.
+func executionFinished(status string) bool {
+	return status == pkg.StatusCompleted || status == pkg.StatusFailed
 }
 
-func generateJobID(key string) (string, error) {
-	b := murmur3.New128()
-	_, err := b.Write([]byte(key))
-	if err != nil {
-		return "", err
-	}
-	return hex.EncodeToString(b.Sum(nil)), nil
+func (p *UpsertProcessor) now() string {
+	return p.clock.Now().Format(pkg.ISOTimeFormat)
 }
 
 func distillJob(jobMap map[string]any) (job, error) {
@@ -591,7 +1062,15 @@ func distillJob(jobMap map[string]any) (job, error) {
 
 func updateJobMap(j job, jobMap map[string]any) (map[string]any, error) {
 	jobMap["last_run"] = j.LastRun
+	if j.LastExecutionID != "" {
+		jobMap["last_execution_id"] = j.LastExecutionID
+		jobMap["last_run_status"] = j.LastRunStatus
+	}
 	jobMap["next_run"] = j.NextRun
+	if j.Expired {
+		jobMap["expired"] = true
+		jobMap["next_run"] = nil
+	}
 	jobMap["run_count"] = j.RunCount
 	jobMap["total_recurrences"] = j.TotalRecurrences
 	if j.Schedule == nil {
@@ -616,12 +1095,26 @@ func updateJobMap(j job, jobMap map[string]any) (map[string]any, error) {
 	return jobMap, nil
 }
 
-func (p *UpsertProcessor) updateJobRunStats(j job, status string) (job, error) {
-	if status != pkg.StatusInProgress {
-		return j, nil
+// skipBlackout advances the next run of a recurring job past the blackouts, as the run which was due during one
+// of them was skipped.  Schedules which cannot be parsed are logged, leaving the next run as is.
+func (p *UpsertProcessor) skipBlackout(j job, blackouts blackoutCalendar) job {
+	if j.Schedule == nil || j.Schedule.TimeCycle == "" {
+		return j
+	}
+	s, err := j.schedule()
+	if err != nil {
+		p.logger.WithField("job_name", j.Name).Warnf("failed to advance the next run of the job past the blackout: %s", err)
+		return j
 	}
+	j.NextRun = blackouts.next(s, p.clock.Now()).UTC()
+	return j
+}
 
-	now := p.nowProvider()
+// updateJobRunStats counts a new execution of the job and computes its next run, past any blackout it falls in.
+// It is only called for the first event of an execution, so that repeated in progress events do not inflate the
+// run count.
+func (p *UpsertProcessor) updateJobRunStats(j job, blackouts blackoutCalendar) (job, error) {
+	now := p.clock.Now()
 	if j.RunCount > 0 {
 		if j.Schedule == nil {
 			return j, nil
@@ -637,18 +1130,85 @@ func (p *UpsertProcessor) updateJobRunStats(j job, status string) (job, error) {
 			return j, nil
 		}
 
-		s, err := cron.ParseStandard(j.Schedule.TimeCycle)
+		s, err := j.schedule()
 		if err != nil {
 			return j, fmt.Errorf("failed to parse job cron expression: %s", err)
 		}
-		j.NextRun = s.Next(now)
+		j.NextRun = blackouts.next(s, now).UTC()
 		return j, nil
 	}
 
-	return initialJobRecurrenceInfo(j, now)
+	return initialJobRecurrenceInfo(j, now, blackouts)
+}
+
+// scheduleEnded returns true if a job has no more runs to make, because it ran as many times as its schedule
+// recurs or the end date of its schedule has passed.
+func scheduleEnded(j job, now time.Time) bool {
+	if j.TotalRecurrences > 0 && j.RunCount >= j.TotalRecurrences {
+		return true
+	}
+	if j.Schedule == nil || j.Schedule.End == "" {
+		return false
+	}
+	end, err := time.Parse(pkg.ISOTimeFormat, j.Schedule.End)
+	return err == nil && (end.Before(now) || j.NextRun.After(end))
+}
+
+// reconcileRunCount raises the run count of the job to the number of its execution records which were counted
+// as runs.  Executions which start concurrently each read the same run count before incrementing it, but as each
+// execution record is saved before the count is taken, the last of them to save the job record accounts for all
+// of them.  Writes of the job record based on a stale count are rejected with a VersionConflict and retried.
+//
+// As the execution record is saved before the job record, the retry of an upsert whose job record was rejected
+// finds its execution already counted, and does not count it again.  The run statistics of the job are advanced
+// here instead whenever it accounts for fewer runs than were counted, and the latest of execs counted as a run
+// becomes its last execution.  If the executions cannot be counted, the job is left as is.
+func (p *UpsertProcessor) reconcileRunCount(ctx context.Context, jobID string, j job, execs ...pkg.JobExecution) job {
+	logger := p.logger.WithField("job_id", jobID)
+	filter, err := pkg.NewFQLQuery([]pkg.Filter{
+		{Field: "id", Op: pkg.EQ, Value: jobID},
+		{Field: "counted_run", Op: pkg.EQ, Value: "true"},
+	})
+	if err != nil {
+		logger.Errorf("error constructing FQL query: %s", err)
+		return j
+	}
+	n, err := p.strgc.Count(ctx, storagec.SearchObjectsRequest{
+		Collection: jobExecutionCollection,
+		Filter:     filter,
+	})
+	if err != nil {
+		logger.Errorf("failed to count job executions - run count not reconciled: %s", err)
+		return j
+	}
+	if int64(n) <= j.RunCount {
+		return j
+	}
+	logger.WithField("run_count", j.RunCount).
+		WithField("executions", n).
+		Info("reconciling job run count with its executions")
+	// the next run is computed from now, so advancing the statistics once accounts for every missed run
+	advanced, err := p.updateJobRunStats(j, loadBlackouts(ctx, p.strgc, p.logger))
+	if err != nil {
+		logger.Errorf("failed to advance the run statistics of the job: %s", err)
+	} else {
+		j = advanced
+	}
+	j.RunCount = int64(n)
+
+	var last *pkg.JobExecution
+	for i, e := range execs {
+		if e.CountedRun && (last == nil || e.RunDate > last.RunDate) {
+			last = &execs[i]
+		}
+	}
+	if last != nil {
+		j.LastExecutionID, j.LastRunStatus = last.ExecutionID, last.RunStatus
+	}
+	return j
 }
 
-func initialJobRecurrenceInfo(j job, now time.Time) (job, error) {
+func initialJobRecurrenceInfo(j job, now time.Time, blackouts blackoutCalendar) (job, error) {
 	var err error
 
 	j.RunCount = 1
@@ -675,11 +1235,11 @@ func initialJobRecurrenceInfo(j job, now time.Time) (job, error) {
 		return j, nil
 	}
 
-	s, err := cron.ParseStandard(j.Schedule.TimeCycle)
+	s, err := j.schedule()
 	if err != nil {
 		return j, fmt.Errorf("failed to parse job cron expression: %s", err)
 	}
-	j.NextRun = s.Next(now)
+	j.NextRun = blackouts.next(s, now).UTC()
 
 	if j.Schedule.End == "" {
 		// unlimited number of executions - doesn't make sense to report the number total
@@ -0,0 +1,256 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/validate"
+)
+
+type batchJob struct {
+	id     string
+	name   string
+	events []workflowMeta
+	// warnings report the fields ignored in the saved execution records of the job.
+	warnings []string
+	// transitions carries the statuses of the executions before the batch across its retries.
+	transitions transitions
+}
+
+// ProcessBatch handles a request containing an array of workflow metadata events.
+// Events are grouped by job so that each job record is fetched and saved only once, and
+// each job execution record is saved once regardless of how many events reference it.
+func (p *UpsertProcessor) ProcessBatch(ctx context.Context, req fdk.Request) Response {
+	wfMetas, ignored, err := wfMetasFromRequest(req, p.strictDecoding, loadStatusMapping(ctx, p.strgc, p.logger))
+	if err != nil {
+		err = newError(ErrBadRequest, "failed to extract job information from request: %w", err)
+		p.logger.Error(err)
+		return p.errResp(err)
+	}
+	p.logger.Infof("received batch upsert request with %d events", len(wfMetas))
+	warnings := p.ignoredFieldWarnings("workflow events", ignored)
+
+	jobs, errs := p.groupByJob(ctx, wfMetas)
+	execs := make([]pkg.JobExecution, 0, len(wfMetas))
+	for _, j := range jobs {
+		var e []pkg.JobExecution
+		var jobErrs []fdk.APIError
+		err = p.retryOnConflict(func() error {
+			var err0 error
+			e, jobErrs, err0 = p.upsertJobBatch(ctx, j)
+			return err0
+		})
+		for _, m := range j.events {
+			p.recordUpsert(m.Status, err)
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to save records for job %s: %w", j.id, err)
+			p.logger.WithField("job_name", j.name).WithField("job_id", j.id).Error(err)
+			jobErrs = append(jobErrs, apiError(err))
+		}
+		execs = append(execs, e...)
+		errs = append(errs, jobErrs...)
+		warnings = append(warnings, j.warnings...)
+	}
+
+	if len(errs) > 0 && len(execs) == 0 {
+		return Response{
+			Body: p.upsertRespJSON(nil, errs, warnings),
+			Code: http.StatusInternalServerError,
+			Errs: errs,
+		}
+	}
+
+	code := http.StatusOK
+	if len(errs) > 0 {
+		code = http.StatusMultiStatus
+	}
+	return Response{
+		Body: p.upsertRespJSON(execs, errs, warnings),
+		Code: code,
+	}
+}
+
+// groupByJob buckets the events by the job they belong to, ordering each bucket by execution timestamp.
+// Events with a blank status are ignored, as they are in Process.
+func (p *UpsertProcessor) groupByJob(ctx context.Context, wfMetas []workflowMeta) ([]*batchJob, []fdk.APIError) {
+	errs := make([]fdk.APIError, 0)
+	jobs := make([]*batchJob, 0)
+	byID := make(map[string]*batchJob)
+	for _, wfMeta := range wfMetas {
+		if wfMeta.Status == "" {
+			p.logger.WithField("execution_id", wfMeta.ExecutionID).
+				Info("received workflow metadata event with blank status - ignoring")
+			continue
+		}
+
+		jobName, err := wfMeta.jobName()
+		if err != nil {
+			err = newError(ErrBadRequest, "bad job name provided for execution %s: %s", wfMeta.ExecutionID, err)
+			p.logger.WithField("workflow_meta", wfMeta).Error(err)
+			errs = append(errs, apiError(err))
+			continue
+		}
+		jobID, err := p.jobIDs.JobID(ctx, jobName)
+		if err != nil {
+			err = fmt.Errorf("job ID could not be determined for execution %s: %s", wfMeta.ExecutionID, err)
+			p.logger.WithField("job_name", jobName).Error(err)
+			errs = append(errs, apiError(err))
+			continue
+		}
+
+		j, ok := byID[jobID]
+		if !ok {
+			j = &batchJob{id: jobID, name: jobName, transitions: make(transitions)}
+			byID[jobID] = j
+			jobs = append(jobs, j)
+		}
+		j.events = append(j.events, wfMeta)
+	}
+
+	for _, j := range jobs {
+		sort.SliceStable(j.events, func(a, b int) bool {
+			return j.events[a].ExecutionTimestamp < j.events[b].ExecutionTimestamp
+		})
+	}
+	return jobs, errs
+}
+
+// upsertJobBatch applies all the events of a single job.  Failures affecting individual events are returned
+// as API errors, while a VersionConflict on any of the puts is returned as an error so the batch can be retried.
+func (p *UpsertProcessor) upsertJobBatch(ctx context.Context, j *batchJob) ([]pkg.JobExecution, []fdk.APIError, error) {
+	logger := p.logger.WithField("job_name", j.name).WithField("job_id", j.id)
+	j.warnings = nil
+	jobErr := func(err error) []fdk.APIError {
+		logger.Error(err)
+		return []fdk.APIError{apiError(err)}
+	}
+
+	jobInstance, jobMap, jobVersion, err := p.fetchJob(ctx, j.id, j.name)
+	if err != nil {
+		return nil, jobErr(fmt.Errorf("failed to fetch job %s: %w", j.id, err)), nil
+	}
+	// the workflows of a renamed job still report its previous name
+	jobName := j.name
+	if jobInstance.Name != "" {
+		jobName = jobInstance.Name
+	}
+
+	errs := make([]fdk.APIError, 0)
+	order := make([]string, 0, len(j.events))
+	execRecords := make(map[string]*executionRecord)
+	for _, wfMeta := range j.events {
+		er, ok := execRecords[wfMeta.ExecutionID]
+		if !ok {
+			fetched, err := p.jobExecutionRecord(ctx, j.id, jobName, wfMeta)
+			if err != nil {
+				err = fmt.Errorf("failed to fetch job execution record for execution %s: %w", wfMeta.ExecutionID, err)
+				logger.Error(err)
+				errs = append(errs, apiError(err))
+				continue
+			}
+			er = &fetched
+		}
+
+		rec, updatedJob, err := p.applyWorkflowMeta(ctx, er.record, er.newExec, jobInstance, wfMeta, nil)
+		if err != nil {
+			err = fmt.Errorf("execution %s: %w", wfMeta.ExecutionID, err)
+			logger.Error(err)
+			errs = append(errs, apiError(err))
+			continue
+		}
+		rec.RecordStatus(er.record.RunStatus, p.now(), "")
+		jobInstance = updatedJob
+		er.record = rec
+		er.newExec = false
+		if !ok {
+			execRecords[wfMeta.ExecutionID] = er
+			order = append(order, wfMeta.ExecutionID)
+		}
+	}
+
+	if len(order) == 0 {
+		return nil, errs, nil
+	}
+
+	execs := make([]pkg.JobExecution, 0, len(order))
+	saved := make([]*executionRecord, 0, len(order))
+	for _, execID := range order {
+		er := execRecords[execID]
+		err = p.putExecutionRecordObject(ctx, jobExecutionCollection, er.key, er.record, er.version)
+		if errors.Is(err, storagec.VersionConflict) {
+			return nil, nil, err
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to save execution record for execution %s: %w", execID, err)
+			logger.Error(err)
+			errs = append(errs, apiError(err))
+			continue
+		}
+		j.transitions.saved(*er)
+		j.transitions.restore(er)
+		execs = append(execs, er.record)
+		saved = append(saved, er)
+		j.warnings = append(j.warnings, er.warnings...)
+	}
+
+	jobInstance = p.reconcileRunCount(ctx, j.id, jobInstance, execs...)
+	jobMap, err = updateJobMap(jobInstance, jobMap)
+	if err != nil {
+		return nil, append(errs, jobErr(fmt.Errorf("failed to map job instance to job map for job %s: %w", j.id, err))...), nil
+	}
+
+	err = p.putJobMap(ctx, jobCollection, j.id, jobMap, jobVersion)
+	if errors.Is(err, storagec.VersionConflict) {
+		return nil, nil, err
+	}
+	if err != nil {
+		errs = append(errs, jobErr(fmt.Errorf("failed to save job record for job %s: %w", j.id, err))...)
+	}
+
+	for _, er := range saved {
+		p.notify(ctx, jobInstance, *er)
+		p.alert(ctx, jobInstance, *er)
+		p.ticket(ctx, j.id, jobInstance, *er)
+		p.emit(ctx, *er)
+		p.releaseQueued(ctx, j.id, jobInstance, *er)
+	}
+	return execs, errs, nil
+}
+
+// wfMetasFromRequest decodes the workflow events of a batch request, also returning the fields they have no field
+// for, which fail the decoding if strict is true.  Their statuses are normalized by statuses.
+func wfMetasFromRequest(req fdk.Request, strict bool, statuses pkg.StatusMapping) ([]workflowMeta, []string, error) {
+	var wfMetas []workflowMeta
+
+	if len(req.Body) == 0 {
+		return nil, nil, errors.New("empty request body")
+	}
+	ignored, err := pkg.DecodeJSON(req.Body, &wfMetas, strict)
+	if err != nil {
+		return nil, ignored, err
+	}
+	if len(wfMetas) == 0 {
+		return nil, ignored, errors.New("no workflow metadata events provided")
+	}
+
+	errs := make([]error, 0)
+	for i, w := range wfMetas {
+		w, err := validateWFMeta(w, statuses)
+		if err != nil {
+			errs = append(errs, validate.Nest(fmt.Sprintf("[%d]", i), err))
+			continue
+		}
+		wfMetas[i] = w
+	}
+	if err := validate.Join(errs...); err != nil {
+		return nil, ignored, err
+	}
+	return wfMetas, ignored, nil
+}
@@ -0,0 +1,177 @@
+package processor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+)
+
+func TestComputeJobDuration(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 30, 0, time.UTC)
+	tests := []struct {
+		name         string
+		start, end   string
+		status       string
+		wantDuration string
+		wantSeconds  int64
+		wantErr      bool
+	}{
+		{name: "no start", status: pkg.StatusCompleted},
+		{name: "not started", start: "2024-01-01T00:00:00Z", status: pkg.StatusQueued},
+		{
+			name:         "completed",
+			start:        "2024-01-01T00:00:00Z",
+			end:          "2024-01-01T01:02:03Z",
+			status:       pkg.StatusCompleted,
+			wantDuration: "01:02:03",
+			wantSeconds:  3723,
+		},
+		{
+			name:         "longer than a day",
+			start:        "2024-01-01T00:00:00Z",
+			end:          "2024-01-02T02:00:05Z",
+			status:       pkg.StatusFailed,
+			wantDuration: "26:00:05",
+			wantSeconds:  93605,
+		},
+		{
+			name:         "in progress",
+			start:        "2024-01-01T00:00:00Z",
+			status:       pkg.StatusInProgress,
+			wantDuration: "00:00:30",
+			wantSeconds:  30,
+		},
+		{
+			name:         "ends before it starts",
+			start:        "2024-01-01T00:00:10Z",
+			end:          "2024-01-01T00:00:00Z",
+			status:       pkg.StatusTimedOut,
+			wantDuration: "00:00:00",
+		},
+		{name: "invalid start", start: "yesterday", end: "2024-01-01T00:00:00Z", status: pkg.StatusCompleted, wantErr: true},
+		{name: "invalid end", start: "2024-01-01T00:00:00Z", end: "today", status: pkg.StatusCompleted, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, secs, err := computeJobDuration(tt.start, tt.end, tt.status, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("computeJobDuration() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if d != tt.wantDuration || secs != tt.wantSeconds {
+				t.Errorf("computeJobDuration() = %q, %d, want %q, %d", d, secs, tt.wantDuration, tt.wantSeconds)
+			}
+		})
+	}
+}
+
+func TestApplyHostResults(t *testing.T) {
+	hosts := func(statuses ...string) []pkg.TargetedHost {
+		hs := make([]pkg.TargetedHost, 0, len(statuses))
+		for _, s := range statuses {
+			hs = append(hs, pkg.TargetedHost{Status: s})
+		}
+		return hs
+	}
+	tests := []struct {
+		name          string
+		je            pkg.JobExecution
+		wantStatus    string
+		wantSucceeded int
+		wantFailed    int
+	}{
+		{
+			name:          "all hosts completed",
+			je:            pkg.JobExecution{RunStatus: pkg.StatusCompleted, TargetedHosts: hosts(pkg.StatusCompleted, pkg.StatusCompleted)},
+			wantStatus:    pkg.StatusCompleted,
+			wantSucceeded: 2,
+		},
+		{
+			name:          "a host failed",
+			je:            pkg.JobExecution{RunStatus: pkg.StatusCompleted, TargetedHosts: hosts(pkg.StatusCompleted, pkg.StatusFailed)},
+			wantStatus:    pkg.StatusCompletedWithErrors,
+			wantSucceeded: 1,
+			wantFailed:    1,
+		},
+		{
+			name:          "failed host recovered",
+			je:            pkg.JobExecution{RunStatus: pkg.StatusCompletedWithErrors, TargetedHosts: hosts(pkg.StatusCompleted)},
+			wantStatus:    pkg.StatusCompleted,
+			wantSucceeded: 1,
+		},
+		{
+			name:       "failed execution",
+			je:         pkg.JobExecution{RunStatus: pkg.StatusFailed, TargetedHosts: hosts(pkg.StatusFailed, pkg.StatusInProgress)},
+			wantStatus: pkg.StatusFailed,
+			wantFailed: 1,
+		},
+		{
+			name:       "stale counts",
+			je:         pkg.JobExecution{RunStatus: pkg.StatusInProgress, SucceededHosts: 3, FailedHosts: 2},
+			wantStatus: pkg.StatusInProgress,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := applyHostResults(tt.je)
+			if got.RunStatus != tt.wantStatus || got.SucceededHosts != tt.wantSucceeded || got.FailedHosts != tt.wantFailed {
+				t.Errorf("applyHostResults() = %s, %d succeeded, %d failed, want %s, %d succeeded, %d failed",
+					got.RunStatus, got.SucceededHosts, got.FailedHosts, tt.wantStatus, tt.wantSucceeded, tt.wantFailed)
+			}
+		})
+	}
+}
+
+func TestEvaluateSLA(t *testing.T) {
+	tests := []struct {
+		name string
+		je   pkg.JobExecution
+		sla  *jobSLA
+		want []string
+	}{
+		{
+			name: "no SLA",
+			je:   pkg.JobExecution{DurationSeconds: 100, SLABreached: true, SLABreaches: []string{pkg.SLABreachMaxDuration}},
+		},
+		{
+			name: "within objectives",
+			je:   pkg.JobExecution{DurationSeconds: 60, SucceededHosts: 9, FailedHosts: 1},
+			sla:  &jobSLA{MaxDurationSeconds: 60, MinSuccessRate: 0.9},
+		},
+		{
+			name: "too long",
+			je:   pkg.JobExecution{DurationSeconds: 61},
+			sla:  &jobSLA{MaxDurationSeconds: 60},
+			want: []string{pkg.SLABreachMaxDuration},
+		},
+		{
+			name: "too many failures",
+			je:   pkg.JobExecution{SucceededHosts: 8, FailedHosts: 2},
+			sla:  &jobSLA{MinSuccessRate: 0.9},
+			want: []string{pkg.SLABreachMinSuccessRate},
+		},
+		{
+			name: "no host results",
+			je:   pkg.JobExecution{DurationSeconds: 10},
+			sla:  &jobSLA{MaxDurationSeconds: 60, MinSuccessRate: 1},
+		},
+		{
+			name: "every objective breached",
+			je:   pkg.JobExecution{DurationSeconds: 120, FailedHosts: 1},
+			sla:  &jobSLA{MaxDurationSeconds: 60, MinSuccessRate: 0.5},
+			want: []string{pkg.SLABreachMaxDuration, pkg.SLABreachMinSuccessRate},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := evaluateSLA(tt.je, tt.sla)
+			if !reflect.DeepEqual(got.SLABreaches, tt.want) {
+				t.Errorf("evaluateSLA() breaches = %v, want %v", got.SLABreaches, tt.want)
+			}
+			if got.SLABreached != (len(tt.want) > 0) {
+				t.Errorf("evaluateSLA() breached = %t, want %t", got.SLABreached, len(tt.want) > 0)
+			}
+		})
+	}
+}
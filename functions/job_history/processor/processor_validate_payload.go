@@ -0,0 +1,156 @@
+package processor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	fdk "github.com/CrowdStrike/foundry-fn-go"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/validate"
+	"github.com/sirupsen/logrus"
+)
+
+// ValidatePayloadProcessor validates candidate workflow events against the checks of the upsert flow without
+// recording them, to help customizing the workflow templates which report the executions of jobs.
+type ValidatePayloadProcessor struct {
+	logger logrus.FieldLogger
+	strgc  storagec.StorageC
+	strict bool
+}
+
+// NewValidatePayloadProcessor returns a new ValidatePayloadProcessor instance.
+func NewValidatePayloadProcessor(strgc storagec.StorageC, logger logrus.FieldLogger, opts ...func(p *ValidatePayloadProcessor)) *ValidatePayloadProcessor {
+	p := &ValidatePayloadProcessor{
+		logger: logger,
+		strgc:  strgc,
+	}
+	for _, o := range opts {
+		o(p)
+	}
+	return p
+}
+
+// WithPayloadStrictDecoding reports the unknown fields of events as errors rather than warnings, matching an
+// upsert flow configured WithStrictDecoding.
+func WithPayloadStrictDecoding() func(p *ValidatePayloadProcessor) {
+	return func(p *ValidatePayloadProcessor) {
+		p.strict = true
+	}
+}
+
+// Process validates the workflow event of the request body, or each event of an array of events as sent to the
+// batch upsert endpoint, returning the outcome of each in order.  Every problem of an event is reported, rather
+// than only the first, and events are valid when they would be recorded by the upsert flow.
+func (p *ValidatePayloadProcessor) Process(ctx context.Context, req fdk.Request) Response {
+	body := bytes.TrimSpace(req.Body)
+	if len(body) == 0 {
+		return p.errResp(newError(ErrBadRequest, "empty request body"))
+	}
+	events := []json.RawMessage{body}
+	if body[0] == '[' {
+		if err := json.Unmarshal(body, &events); err != nil {
+			return p.errResp(newError(ErrBadRequest, "failed to parse request body: %s", err))
+		}
+		if len(events) == 0 {
+			return p.errResp(newError(ErrBadRequest, "no workflow metadata events provided"))
+		}
+	}
+
+	statuses := loadStatusMapping(ctx, p.strgc, p.logger)
+	results := make([]payloadValidation, len(events))
+	for i, e := range events {
+		results[i] = p.validateEvent(e, statuses)
+	}
+	return Response{
+		Body: p.validatePayloadRespJSON(results, nil),
+		Code: http.StatusOK,
+	}
+}
+
+// validateEvent validates a workflow event.  Events with a blank status are valid but reported with a warning, as
+// the upsert flow ignores them.  Statuses are normalized by statuses, as by the upsert flow.
+func (p *ValidatePayloadProcessor) validateEvent(raw json.RawMessage, statuses pkg.StatusMapping) payloadValidation {
+	v := payloadValidation{Errors: make([]payloadIssue, 0), Warnings: make([]string, 0)}
+	var w workflowMeta
+	unknown, err := pkg.DecodeJSON(raw, &w, false)
+	if err != nil {
+		v.Errors = append(v.Errors, payloadIssue{Message: fmt.Sprintf("is not a valid workflow event: %s", err)})
+		return v
+	}
+	for _, f := range unknown {
+		if p.strict {
+			v.Errors = append(v.Errors, payloadIssue{Field: f, Message: "is not a field of workflow events"})
+			continue
+		}
+		v.Warnings = append(v.Warnings, fmt.Sprintf("ignored unknown field %q of the workflow event", f))
+	}
+
+	err = validate.Fields(
+		validate.Field{Name: "execution_id", Value: w.ExecutionID, Rules: []validate.Rule{validate.Required()}},
+		validate.Field{Name: "execution_timestamp", Value: w.ExecutionTimestamp, Rules: []validate.Rule{validate.Required(), isoTimeRule}},
+		validate.Field{Name: "definition_name", Value: w.DefinitionName, Rules: []validate.Rule{validate.Required()}},
+	)
+	var fes validate.Errors
+	if errors.As(err, &fes) {
+		for _, fe := range fes {
+			v.Errors = append(v.Errors, payloadIssue{Field: fe.Field, Message: fe.Message})
+		}
+	}
+	if w.DefinitionName != "" {
+		if v.JobName, err = w.jobName(); err != nil {
+			v.Errors = append(v.Errors, payloadIssue{Field: "definition_name", Message: `must end with "- " followed by the job name`})
+		}
+	}
+
+	status := statuses.Normalize(w.Status)
+	switch {
+	case strings.TrimSpace(w.Status) == "":
+		v.Warnings = append(v.Warnings, "blank status, the event would be ignored")
+	case status == "":
+		v.Errors = append(v.Errors, payloadIssue{Field: "status", Message: fmt.Sprintf("unknown status %q, must be one of %s or be mapped by the %s settings", w.Status, strings.Join(knownEventStatuses, ", "), statusMappingSettingsName)})
+	}
+
+	switch {
+	case w.ParentExecutionID != "" && w.Step < 1:
+		v.Errors = append(v.Errors, payloadIssue{Field: "step", Message: "must be at least 1 for the events of step executions"})
+	case w.ParentExecutionID == "" && w.Step != 0:
+		v.Errors = append(v.Errors, payloadIssue{Field: "parent_execution_id", Message: "is required for the events of step executions"})
+	}
+
+	if len(v.Errors) == 0 {
+		w.Status = status
+		v.Event, v.Valid = &w, true
+	}
+	return v
+}
+
+// knownEventStatuses are the statuses of workflow events understood by pkg.NormalizeJobStatus.
+var knownEventStatuses = []string{
+	pkg.StatusCompleted, pkg.StatusCompletedWithErrors, pkg.StatusDeferred, pkg.StatusFailed, pkg.StatusInProgress,
+	pkg.StatusQueued, pkg.StatusReleased, pkg.StatusSkipped, pkg.StatusTimedOut,
+}
+
+func (p *ValidatePayloadProcessor) errResp(err error) Response {
+	return newErrorResponse(err, func(errs []fdk.APIError) []byte {
+		return p.validatePayloadRespJSON(nil, errs)
+	})
+}
+
+func (p *ValidatePayloadProcessor) validatePayloadRespJSON(r []payloadValidation, e []fdk.APIError) []byte {
+	if r == nil {
+		r = make([]payloadValidation, 0)
+	}
+	resp := validatePayloadResponse{Errs: e, Resources: r}
+	rJSON, err := json.Marshal(resp)
+	if err != nil {
+		p.logger.Errorf("failed to serialize response: %s", err)
+		return nil
+	}
+	return rJSON
+}
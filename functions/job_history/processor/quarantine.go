@@ -0,0 +1,81 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/metrics"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+)
+
+// errMalformedRecord is wrapped by the errors of stored objects which cannot be deserialized.
+var errMalformedRecord = errors.New("malformed record")
+
+// quarantinedObject is a copy of a malformed stored object, kept for inspection once the object is replaced.
+type quarantinedObject struct {
+	Collection    string `json:"collection"`
+	Data          []byte `json:"data"`
+	Error         string `json:"error"`
+	ObjectKey     string `json:"object_key"`
+	QuarantinedAt string `json:"quarantined_at"`
+	Version       string `json:"version,omitempty"`
+}
+
+// quarantine copies the malformed object to the quarantine collection before it is replaced by a fresh record,
+// and reports it.  Each quarantine keeps its own copy, keyed by the collection, key and time of the quarantine.
+func (p *UpsertProcessor) quarantine(ctx context.Context, collection, objectKey string, cause error) error {
+	now := p.clock.Now()
+	resp, err := p.strgc.FetchObject(ctx, storagec.FetchObjectRequest{Collection: collection, ObjectKey: objectKey})
+	if err != nil {
+		return fmt.Errorf("failed to fetch malformed record for quarantine: %w", err)
+	}
+	q := quarantinedObject{
+		Collection:    collection,
+		Data:          resp.Data,
+		Error:         cause.Error(),
+		ObjectKey:     objectKey,
+		QuarantinedAt: now.UTC().Format(pkg.ISOTimeFormat),
+		Version:       resp.Version,
+	}
+	data, err := json.Marshal(q)
+	if err != nil {
+		return fmt.Errorf("failed to serialize quarantined record: %s", err)
+	}
+	key := fmt.Sprintf("%s_%s_%d", collection, objectKey, now.UnixNano())
+	if err = p.putObject(ctx, quarantineCollection, key, data, ""); err != nil {
+		return fmt.Errorf("failed to quarantine malformed record: %w", err)
+	}
+
+	p.metrics.Inc("quarantined_records_total", metrics.Labels{"collection": collection})
+	p.logger.WithField("collection", collection).
+		WithField("object_key", objectKey).
+		WithField("quarantine_key", key).
+		WithField("version", resp.Version).
+		WithField("cause", cause.Error()).
+		Warn("quarantined malformed record, replacing it with a fresh record")
+	return nil
+}
+
+// placeholderJobMap returns the record of a draft job holding nothing but its ID, name and owner, which satisfies
+// the schema of the jobs collection.
+func placeholderJobMap(jobID, name string, owner caller, now time.Time) map[string]any {
+	ts := now.UTC().Format(pkg.ISOTimeFormat)
+	return map[string]any{
+		"action":        jobAction{},
+		"created_at":    ts,
+		"draft":         true,
+		"host_count":    0,
+		"id":            jobID,
+		"name":          name,
+		"notifications": []string{},
+		"target":        jobTarget{HostGroups: []string{}, Hosts: []string{}},
+		"updated_at":    ts,
+		"user_id":       owner.ID,
+		"user_name":     owner.Name,
+		"version":       1,
+	}
+}
@@ -0,0 +1,65 @@
+package processor
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// redactedValue replaces the values of masked fields in logged request bodies.
+const redactedValue = "[REDACTED]"
+
+// DefaultRedactedFields are the fields whose values are masked when request bodies are logged, as they can hold
+// file paths, script arguments, command output or credentials.
+var DefaultRedactedFields = []string{
+	"args", "arguments", "command_line", "content", "file_name", "file_path", "filename", "filepath", "password",
+	"script", "script_args", "secret", "stderr", "stdout", "token",
+}
+
+// redactor masks the values of fields of JSON documents, at any depth.  Field names are matched case
+// insensitively.
+type redactor map[string]bool
+
+func newRedactor(fields []string) redactor {
+	r := make(redactor, len(fields))
+	for _, f := range fields {
+		if f = strings.ToLower(strings.TrimSpace(f)); f != "" {
+			r[f] = true
+		}
+	}
+	return r
+}
+
+// redact returns body with the values of the masked fields replaced by redactedValue, for logging.  Bodies which
+// are not JSON are replaced entirely, as their fields cannot be told apart.
+func (r redactor) redact(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return redactedValue
+	}
+	b, err := json.Marshal(r.mask(v))
+	if err != nil {
+		return redactedValue
+	}
+	return string(b)
+}
+
+func (r redactor) mask(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, fv := range t {
+			if r[strings.ToLower(k)] {
+				t[k] = redactedValue
+				continue
+			}
+			t[k] = r.mask(fv)
+		}
+	case []any:
+		for i, e := range t {
+			t[i] = r.mask(e)
+		}
+	}
+	return v
+}
@@ -0,0 +1,145 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/robfig/cron/v3"
+)
+
+// scheduleParser matches the parser used by Func_Jobs when the job is created, so that the next run computed here
+// agrees with the one reported at creation time.
+var scheduleParser = cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// normalizeTimeCycle converts a time cycle into the standard cron expression the schedule workflow runs on.
+func normalizeTimeCycle(timeCycle string) (string, error) {
+	tc := strings.TrimSpace(timeCycle)
+	if _, err := scheduleParser.Parse(tc); err != nil {
+		return "", err
+	}
+
+	if expr, ok := cronDescriptors[strings.ToLower(tc)]; ok {
+		return expr, nil
+	}
+	if strings.HasPrefix(strings.ToLower(tc), "@every ") {
+		return everyAsCron(strings.TrimSpace(tc[len("@every "):]))
+	}
+
+	fields := strings.Fields(tc)
+	if len(fields) == 6 {
+		if fields[0] != "0" {
+			return "", fmt.Errorf("schedules have minute resolution, seconds field must be 0: %s", tc)
+		}
+		fields = fields[1:]
+	}
+	return strings.Join(fields, " "), nil
+}
+
+func everyAsCron(interval string) (string, error) {
+	d, err := time.ParseDuration(interval)
+	if err != nil {
+		return "", fmt.Errorf("invalid @every interval: %v", err)
+	}
+	switch {
+	case d < time.Minute || d%time.Minute != 0:
+		return "", fmt.Errorf("@every interval must be a whole number of minutes: %s", interval)
+	case d < time.Hour && time.Hour%d == 0:
+		return fmt.Sprintf("*/%d * * * *", d/time.Minute), nil
+	case d == 24*time.Hour:
+		return cronDescriptors["@daily"], nil
+	case d < 24*time.Hour && d%time.Hour == 0 && (24*time.Hour)%d == 0:
+		return fmt.Sprintf("0 */%d * * *", d/time.Hour), nil
+	}
+	return "", fmt.Errorf("@every interval must divide an hour or a day evenly: %s", interval)
+}
+
+// parseJobSchedule parses the normalized time cycle of the schedule in its timezone, or UTC if it has none.
+func parseJobSchedule(s *jobSchedule) (cron.Schedule, error) {
+	tz := s.Timezone
+	if tz == "" {
+		tz = time.UTC.String()
+	}
+	if _, err := time.LoadLocation(tz); err != nil {
+		return nil, fmt.Errorf("invalid schedule timezone %q: %s", tz, err)
+	}
+	tc, err := normalizeTimeCycle(s.TimeCycle)
+	if err != nil {
+		return nil, err
+	}
+	return scheduleParser.Parse(fmt.Sprintf("CRON_TZ=%s %s", tz, tc))
+}
+
+// delayedSchedule is a schedule whose runs are those of another delayed by a fixed duration.
+type delayedSchedule struct {
+	cron.Schedule
+	delay time.Duration
+}
+
+// Next returns the first delayed run after t.
+func (s delayedSchedule) Next(t time.Time) time.Time {
+	next := s.Schedule.Next(t.Add(-s.delay))
+	if next.IsZero() {
+		return next
+	}
+	return next.Add(s.delay)
+}
+
+// schedule parses the schedule of the job, whose runs are delayed by its jitter offset, as Func_Jobs shifts the
+// time cycle of its schedule workflow by the offset.
+func (j job) schedule() (cron.Schedule, error) {
+	s, err := parseJobSchedule(j.Schedule)
+	if err != nil || j.JitterOffset == 0 {
+		return s, err
+	}
+	return delayedSchedule{Schedule: s, delay: time.Duration(j.JitterOffset) * time.Minute}, nil
+}
+
+// scheduledRuns returns the runs of the schedule of a job after from and up to to, bounded by the start and end
+// dates of the schedule in the same way as the runs of a schedule preview.  At most limit runs are returned, in
+// which case true is returned too.
+func scheduledRuns(j job, from, to time.Time, limit int) ([]time.Time, bool, error) {
+	js := j.Schedule
+	s, err := j.schedule()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse schedule cron expression: %s", err)
+	}
+	if js.Start != "" {
+		start, err := time.Parse(pkg.ISOTimeFormat, js.Start)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to parse schedule start time: %s", err)
+		}
+		if start.After(from) {
+			from = start
+		}
+	}
+	if js.End != "" {
+		end, err := time.Parse(pkg.ISOTimeFormat, js.End)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to parse schedule end time: %s", err)
+		}
+		if end.Before(to) {
+			to = end
+		}
+	}
+
+	runs := make([]time.Time, 0)
+	for t := s.Next(from); !t.IsZero() && !t.After(to); t = s.Next(t) {
+		if len(runs) == limit {
+			return runs, true, nil
+		}
+		runs = append(runs, t.UTC())
+	}
+	return runs, false, nil
+}
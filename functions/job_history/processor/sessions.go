@@ -0,0 +1,144 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+)
+
+// WithSessionCeiling makes the UpsertProcessor queue new executions whose RTR sessions would raise the sessions
+// estimated to be held by the running executions above ceiling, see estimateSessions.  Queued executions are run
+// as executions finish and free enough sessions, through the workflow client.  Ceilings below 1 are ignored.
+func WithSessionCeiling(ceiling int) func(p *UpsertProcessor) {
+	return func(p *UpsertProcessor) {
+		if ceiling > 0 {
+			p.sessionCeiling = ceiling
+		}
+	}
+}
+
+// estimateSessions returns the number of RTR sessions an execution of the job opens: one per host it targets,
+// i.e. the resolved members of its host groups, or the host count estimated when the job was saved.
+func estimateSessions(execRecord pkg.JobExecution, j job) int {
+	if len(execRecord.ResolvedHosts) > 0 {
+		return len(execRecord.ResolvedHosts)
+	}
+	if j.HostCount > 0 {
+		return j.HostCount
+	}
+	if j.Target != nil {
+		return len(j.Target.Hosts)
+	}
+	return 0
+}
+
+// heldSessions returns the number of RTR sessions held by a running execution.  Executions recorded before
+// their sessions were estimated, or started by the app itself, e.g. reruns, hold one session per host.
+func heldSessions(je pkg.JobExecution) int {
+	if je.EstimatedSessions > 0 {
+		return je.EstimatedSessions
+	}
+	return max(len(je.ResolvedHosts), je.NumHosts, len(je.TargetedHosts))
+}
+
+// runningSessions returns the number of RTR sessions held by the running executions other than the given one.
+func (p *UpsertProcessor) runningSessions(ctx context.Context, execID string) (int, error) {
+	filter, err := pkg.NewFQLQuery([]pkg.Filter{
+		{Field: "status", Op: pkg.EQ, Value: pkg.StatusInProgress},
+		{Field: "execution_id", Op: pkg.NEQ, Value: execID},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error constructing FQL query: %s", err)
+	}
+	n := 0
+	for offset := 0; ; {
+		sr, err := p.strgc.SearchAndFetch(ctx, storagec.SearchObjectsRequest{
+			Collection: jobExecutionCollection,
+			Filter:     filter,
+			Limit:      maxQueryLimit,
+			Offset:     offset,
+		})
+		if err != nil {
+			return 0, fmt.Errorf("failed to search running executions: %w", err)
+		}
+		for _, o := range sr.Objects {
+			var je pkg.JobExecution
+			if err := json.Unmarshal(o.Data, &je); err != nil {
+				p.logger.WithField("object_key", o.Key).Warnf("not counting the sessions of execution: %s", err)
+				continue
+			}
+			n += heldSessions(je)
+		}
+		offset += len(sr.Objects)
+		if len(sr.Objects) == 0 || offset >= sr.Total {
+			break
+		}
+	}
+	return n, nil
+}
+
+// exceedsSessionCeiling reports whether starting the execution would raise the sessions held by the running
+// executions above the session ceiling.  Executions are never queued while nothing else runs, so that one
+// targeting more hosts than the ceiling still runs eventually.
+func (p *UpsertProcessor) exceedsSessionCeiling(ctx context.Context, execRecord pkg.JobExecution) (bool, error) {
+	held, err := p.runningSessions(ctx, execRecord.ExecutionID)
+	if err != nil {
+		return false, err
+	}
+	return held > 0 && held+heldSessions(execRecord) > p.sessionCeiling, nil
+}
+
+// releaseSessionQueued runs the oldest execution queued for the session ceiling once the given execution
+// finishes, if the sessions it frees are enough.  The executions of paused jobs stay queued, holding back those
+// queued after them, until the job is resumed.  Failures are logged rather than failing the upsert, leaving the
+// execution queued for the next execution to finish.
+func (p *UpsertProcessor) releaseSessionQueued(ctx context.Context, er executionRecord) {
+	if p.sessionCeiling == 0 || p.wfc == nil || !pkg.IsFinished(er.record.RunStatus) || er.prevStatus == er.record.RunStatus {
+		return
+	}
+	key, err := p.oldestQueued(ctx, []pkg.Filter{{Field: "queue_reason", Op: pkg.EQ, Value: pkg.QueueReasonSessionQuota}})
+	if err != nil {
+		p.logger.Errorf("failed to look up executions queued for the session ceiling: %s", err)
+		return
+	}
+	if key == "" {
+		return
+	}
+	queuedMap, _, err := p.fetchObject(ctx, jobExecutionCollection, key)
+	if err != nil {
+		p.logger.Errorf("failed to fetch queued execution %s: %s", key, err)
+		return
+	}
+	queued, err := mapToJobExecution(queuedMap)
+	if err != nil {
+		p.logger.Errorf("failed to deserialize queued execution %s: %s", key, err)
+		return
+	}
+	logger := p.logger.WithField("job_id", queued.ID)
+
+	exceeds, err := p.exceedsSessionCeiling(ctx, queued)
+	if err != nil {
+		logger.Errorf("failed to count the sessions of running executions: %s", err)
+		return
+	}
+	if exceeds {
+		return
+	}
+	jobMap, _, err := p.fetchObject(ctx, jobCollection, queued.ID)
+	if err != nil {
+		logger.Errorf("failed to fetch the job of queued execution %s: %s", queued.ExecutionID, err)
+		return
+	}
+	j, err := distillJob(jobMap)
+	if err != nil {
+		logger.Errorf("failed to distill the job of queued execution %s: %s", queued.ExecutionID, err)
+		return
+	}
+	if j.Paused || j.Workflows == nil || j.Workflows.ScheduleWorkflow == "" {
+		return
+	}
+	p.runQueued(ctx, key, j, logger)
+}
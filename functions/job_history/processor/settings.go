@@ -0,0 +1,119 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+)
+
+// settingsValidators contains the validation function of each known settings object, keyed by name.
+var settingsValidators = map[string]func(data json.RawMessage) error{
+	blackoutSettingsName: func(data json.RawMessage) error {
+		var bs blackoutSettings
+		if err := json.Unmarshal(data, &bs); err != nil {
+			return err
+		}
+		for _, b := range bs.Periods {
+			if err := b.validate(); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	callbackSettingsName: func(data json.RawMessage) error {
+		var cs callbackSettings
+		if err := json.Unmarshal(data, &cs); err != nil {
+			return err
+		}
+		if len(cs.SigningSecret) < 16 {
+			return errors.New("signing_secret must be at least 16 characters long")
+		}
+		return nil
+	},
+	rbacSettingsName: func(data json.RawMessage) error {
+		var rs rbacSettings
+		if err := json.Unmarshal(data, &rs); err != nil {
+			return err
+		}
+		for role, perms := range rs.Roles {
+			for _, perm := range perms {
+				if !knownPermissions[perm] {
+					return fmt.Errorf("role %s grants unknown permission %q", role, perm)
+				}
+			}
+		}
+		return nil
+	},
+	retentionSettingsName: func(data json.RawMessage) error {
+		var rs retentionSettings
+		if err := json.Unmarshal(data, &rs); err != nil {
+			return err
+		}
+		if rs.KeepLast < 0 || rs.MaxAgeDays < 0 {
+			return errors.New("keep_last and max_age_days cannot be negative")
+		}
+		return nil
+	},
+	statusMappingSettingsName: func(data json.RawMessage) error {
+		var ss statusMappingSettings
+		if err := json.Unmarshal(data, &ss); err != nil {
+			return err
+		}
+		for from, to := range ss.Statuses {
+			if strings.TrimSpace(from) == "" {
+				return errors.New("mapped statuses cannot be blank")
+			}
+			status := pkg.NormalizeJobStatus(to)
+			if status == "" {
+				return fmt.Errorf("status %q is mapped to unknown status %q", from, to)
+			}
+			// the mapping extends the statuses understood by the app rather than redefining them
+			if b := pkg.NormalizeJobStatus(from); b != "" && b != status {
+				return fmt.Errorf("status %q is already the status %s", from, b)
+			}
+		}
+		return nil
+	},
+	ticketSettingsName: func(data json.RawMessage) error {
+		var ts ticketSettings
+		if err := json.Unmarshal(data, &ts); err != nil {
+			return err
+		}
+		if strings.TrimSpace(ts.AuthHeader) == "" {
+			return errors.New("auth_header cannot be blank")
+		}
+		return nil
+	},
+}
+
+// settingsSecrets lists the fields of each settings object which are never returned by the settings API.
+var settingsSecrets = map[string][]string{
+	callbackSettingsName: {"signing_secret"},
+	ticketSettingsName:   {"auth_header"},
+}
+
+// fetchSettings loads the named settings object into v.  storagec.NotFound is returned if it has not been set.
+func fetchSettings(ctx context.Context, strgc storagec.StorageC, name string, v any) error {
+	m, _, err := fetchObject(ctx, strgc, settingsCollection, name)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("failed to parse %s settings: %s", name, err)
+	}
+	return nil
+}
+
+// putSettings saves the named settings object.
+func putSettings(ctx context.Context, strgc storagec.StorageC, name string, data []byte) error {
+	return putObject(ctx, strgc, settingsCollection, name, data, "")
+}
@@ -0,0 +1,29 @@
+package processor
+
+import (
+	"context"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/notifier"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/siem"
+)
+
+// WithSIEMEmitter makes the UpsertProcessor emit the summary of every execution which finishes through the given
+// emitter, for customers mirroring the job history into a SIEM.
+func WithSIEMEmitter(e siem.Emitter) func(p *UpsertProcessor) {
+	return func(p *UpsertProcessor) {
+		p.emitter = e
+	}
+}
+
+// emit ships the summary of the execution to the SIEM if it just finished.  Failures are logged rather than
+// failing the upsert, as the execution is recorded either way.
+func (p *UpsertProcessor) emit(ctx context.Context, er executionRecord) {
+	if p.emitter == nil || er.record.RunStatus == er.prevStatus || !pkg.IsFinished(er.record.RunStatus) {
+		return
+	}
+	if err := p.emitter.Emit(ctx, notifier.NewSummary(er.record)); err != nil {
+		p.logger.WithField("execution_id", er.record.ExecutionID).Errorf("failed to emit execution event: %s", err)
+		addWarning(ctx, "event of execution %s not emitted to the SIEM: %s", er.record.ExecutionID, err)
+	}
+}
@@ -0,0 +1,42 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+	"github.com/sirupsen/logrus"
+)
+
+// statusMappingSettings maps the statuses reported by customized workflows, e.g. "SUCCEEDED" or "ERRORED", to the
+// statuses of the app, e.g. "completed" or "failed".
+type statusMappingSettings struct {
+	Statuses map[string]string `json:"statuses"`
+}
+
+// fetchStatusMapping loads the status mapping.  An empty mapping, which only normalizes the built-in statuses, is
+// returned if it has not been set.
+func fetchStatusMapping(ctx context.Context, strgc storagec.StorageC) (pkg.StatusMapping, error) {
+	var ss statusMappingSettings
+	err := fetchSettings(ctx, strgc, statusMappingSettingsName, &ss)
+	if errors.Is(err, storagec.NotFound) {
+		return pkg.StatusMapping{}, nil
+	}
+	if err != nil {
+		return pkg.StatusMapping{}, fmt.Errorf("failed to fetch %s settings: %w", statusMappingSettingsName, err)
+	}
+	return pkg.NewStatusMapping(ss.Statuses), nil
+}
+
+// loadStatusMapping is fetchStatusMapping for callers which proceed with the built-in statuses if the mapping
+// cannot be loaded, logging the failure instead.
+func loadStatusMapping(ctx context.Context, strgc storagec.StorageC, logger logrus.FieldLogger) pkg.StatusMapping {
+	m, err := fetchStatusMapping(ctx, strgc)
+	if err != nil {
+		logger.Warnf("not mapping custom statuses: %s", err)
+		addWarning(ctx, "custom statuses not mapped: %s", err)
+	}
+	return m
+}
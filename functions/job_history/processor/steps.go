@@ -0,0 +1,137 @@
+package processor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+)
+
+// upsertStep applies the workflow event of a step of a composite job to the execution record of the job, which is
+// that of the parent execution of the step.  The step is searched for its host results as a job running the action
+// of the step, and rolled up into the record.  The job record is left unchanged, as its run statistics are advanced
+// by the events of the parent execution.  VersionConflict is returned if the record was modified concurrently.
+func (p *UpsertProcessor) upsertStep(ctx context.Context, jobID, jobName string, wfMeta workflowMeta) (pkg.JobExecution, []string, error) {
+	j, _, _, err := p.fetchJob(ctx, jobID, jobName)
+	if err != nil {
+		return pkg.JobExecution{}, nil, err
+	}
+	stepJob, err := j.step(wfMeta.Step)
+	if err != nil {
+		return pkg.JobExecution{}, nil, newError(ErrBadRequest, "%s", err)
+	}
+
+	key, err := p.locateJobExecution(ctx, wfMeta.ParentExecutionID)
+	if err != nil {
+		return pkg.JobExecution{}, nil, fmt.Errorf("failed to locate parent execution record: %w", err)
+	}
+	if key == "" {
+		return pkg.JobExecution{}, nil, newError(ErrNotFound, "parent execution %s of step %d not found", wfMeta.ParentExecutionID, wfMeta.Step)
+	}
+	execMap, version, err := p.fetchObject(ctx, jobExecutionCollection, key)
+	if err != nil {
+		return pkg.JobExecution{}, nil, fmt.Errorf("failed to fetch parent execution record: %w", err)
+	}
+	parent, ignored, err := p.decodeExecRecord(execMap)
+	if err != nil {
+		return pkg.JobExecution{}, nil, fmt.Errorf("failed to deserialize parent execution record: %w", err)
+	}
+	warnings := p.ignoredFieldWarnings("execution record "+key, ignored)
+	if !executionRan(parent) {
+		return parent, warnings, nil
+	}
+
+	pages := p.execLSResults(ctx, wfMeta.ExecutionID, stepJob.actionType(), executionFinished(wfMeta.Status))
+	x, err := extractHosts(pages, stepJob.actionType(), p.logger.WithField("execution_id", wfMeta.ExecutionID))
+	if err != nil {
+		return pkg.JobExecution{}, nil, fmt.Errorf("failed to execute logscale search: %w", err)
+	}
+	se := pkg.JobExecution{
+		RunStatus:     wfMeta.Status,
+		TargetedHosts: p.outputPolicy.apply(ctx, p.strgc, parent.ID, wfMeta.ExecutionID, x.Hosts, p.logger),
+	}
+	se = flagPlatformMismatches(se, stepJob.targetPlatforms())
+	se = verifyFileIntegrity(se, p.expectedFileHash(ctx, stepJob))
+	se = applyHostResults(se)
+
+	step := pkg.ExecutionStep{
+		ActionType:     stepJob.actionType(),
+		ExecutionID:    wfMeta.ExecutionID,
+		FailedHosts:    se.FailedHosts,
+		Name:           j.Steps[wfMeta.Step-1].Name,
+		NumHosts:       len(se.TargetedHosts),
+		RunDate:        wfMeta.ExecutionTimestamp,
+		RunStatus:      se.RunStatus,
+		Step:           wfMeta.Step,
+		SucceededHosts: se.SucceededHosts,
+	}
+	if executionFinished(wfMeta.Status) {
+		step.EndDate = p.now()
+	}
+	prevStatus := parent.RunStatus
+	parent = rollUpStep(parent, step, se.TargetedHosts, p.now())
+	parent.RecordStatus(prevStatus, p.now(), fmt.Sprintf("step %d", step.Step))
+
+	if err = p.putExecutionRecordObject(ctx, jobExecutionCollection, key, parent, version); err != nil {
+		return pkg.JobExecution{}, nil, fmt.Errorf("failed to save execution record: %w", err)
+	}
+	return parent, warnings, nil
+}
+
+// rollUpStep records a step execution on the execution of its composite job, replacing an earlier record of the
+// step, and merges the hosts of the step into those of the execution.  A host reports the result of the last step
+// it reached unless it failed an earlier one, so that a host fails the execution if it failed any step.
+func rollUpStep(je pkg.JobExecution, step pkg.ExecutionStep, hosts []pkg.TargetedHost, at string) pkg.JobExecution {
+	prev := -1
+	for i, s := range je.Steps {
+		if s.Step == step.Step {
+			prev = i
+		}
+	}
+	if prev < 0 {
+		je.Steps = append(je.Steps, step)
+		sort.Slice(je.Steps, func(i, j int) bool {
+			return je.Steps[i].Step < je.Steps[j].Step
+		})
+		je.RecordEvent(pkg.TimelineStepReported, at, fmt.Sprintf("step %d %s", step.Step, step.RunStatus))
+	} else {
+		old := je.Steps[prev]
+		if old.ExecutionID == step.ExecutionID && old.EndDate != "" {
+			step.EndDate = old.EndDate
+		}
+		je.Steps[prev] = step
+		if old.RunStatus != step.RunStatus {
+			je.RecordEvent(pkg.TimelineStepReported, at, fmt.Sprintf("step %d %s", step.Step, step.RunStatus))
+		}
+	}
+
+	idx := make(map[string]int, len(je.TargetedHosts))
+	for i, h := range je.TargetedHosts {
+		for _, k := range hostKeys(h) {
+			idx[k] = i
+		}
+	}
+	for _, h := range hosts {
+		h.Step = step.Step
+		i, ok := -1, false
+		for _, k := range hostKeys(h) {
+			if i, ok = idx[k]; ok {
+				break
+			}
+		}
+		if !ok {
+			for _, k := range hostKeys(h) {
+				idx[k] = len(je.TargetedHosts)
+			}
+			je.TargetedHosts = append(je.TargetedHosts, h)
+			continue
+		}
+		if cur := je.TargetedHosts[i]; cur.Step == step.Step || (cur.Status != pkg.StatusFailed && cur.Step < step.Step) {
+			je.TargetedHosts[i] = h
+		}
+	}
+	je.NumHosts = len(je.TargetedHosts)
+	je.PendingEnrichment = false
+	return applyHostResults(je)
+}
@@ -0,0 +1,74 @@
+package processor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// NDJSONContentType is the content type of newline delimited JSON response bodies.
+const NDJSONContentType = "application/x-ndjson"
+
+// textContentType is the content type of plain text response bodies.
+const textContentType = "text/plain; charset=utf-8"
+
+// recordStream is a response body which encodes records as newline delimited JSON as they are produced, so that
+// only the encoded output, and not every decoded record, is held in memory.
+type recordStream struct {
+	produce func(emit func(v any) error) error
+}
+
+var _ io.WriterTo = (*recordStream)(nil)
+
+// WriteTo writes the records to w, one JSON object per line.
+func (s *recordStream) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+	if err := s.produce(enc.Encode); err != nil {
+		return cw.n, err
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// MarshalJSON returns the newline delimited JSON records, as the function runtime serializes response bodies
+// through json.Marshaler.
+func (s *recordStream) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := s.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// rawStream is a response body written as it is, e.g. the plain text output of a host.
+type rawStream struct {
+	data []byte
+}
+
+var _ io.WriterTo = (*rawStream)(nil)
+
+// WriteTo writes the data to w.
+func (s *rawStream) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(s.data)
+	return int64(n), err
+}
+
+// MarshalJSON returns the data, as the function runtime serializes response bodies through json.Marshaler.
+func (s *rawStream) MarshalJSON() ([]byte, error) {
+	return s.data, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,186 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/connector"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/storagec"
+)
+
+// ConnectorFactory returns the Connector opening the tickets of a job through the given endpoints.
+type ConnectorFactory func(cfg connector.WebhookConfig) connector.Connector
+
+// WithConnectors makes the UpsertProcessor open a ticket through the connector returned by f when an execution of
+// a job configured with ticketing fails.  The ticket is updated by the following failures of the job, and
+// resolved once an execution completes.  No ticket is opened without it.
+func WithConnectors(f ConnectorFactory) func(p *UpsertProcessor) {
+	return func(p *UpsertProcessor) {
+		p.connectors = f
+	}
+}
+
+// jobTicket is the ticket opened for a failing job, stored until an execution of the job completes.
+type jobTicket struct {
+	// ExecutionID is the workflow execution ID of the latest execution the ticket was opened or updated for.
+	ExecutionID string `json:"execution_id"`
+	JobID       string `json:"job_id"`
+	OpenedAt    string `json:"opened_at"`
+	TicketID    string `json:"ticket_id"`
+	TicketURL   string `json:"ticket_url,omitempty"`
+	UpdatedAt   string `json:"updated_at"`
+}
+
+// ticketed reports whether a ticket is opened for executions with the given status.
+func (t jobTicketing) ticketed(status string) bool {
+	statuses := t.Statuses
+	if len(statuses) == 0 {
+		statuses = []string{pkg.StatusCompletedWithErrors, pkg.StatusFailed, pkg.StatusTimedOut}
+	}
+	for _, s := range statuses {
+		if strings.EqualFold(s, status) {
+			return true
+		}
+	}
+	return false
+}
+
+// ticket opens a ticket for the execution if it just failed and the job has no open ticket, updates the open
+// ticket if it has one, and resolves the open ticket if the execution just completed.  Failures are logged rather
+// than failing the upsert, as the execution is recorded either way.
+func (p *UpsertProcessor) ticket(ctx context.Context, jobID string, j job, er executionRecord) {
+	if p.connectors == nil || j.Ticketing == nil || er.record.RunStatus == er.prevStatus {
+		return
+	}
+	failed := j.Ticketing.ticketed(er.record.RunStatus)
+	if !failed && er.record.RunStatus != pkg.StatusCompleted {
+		return
+	}
+	logger := p.logger.WithField("execution_id", er.record.ExecutionID).WithField("job_id", jobID)
+
+	open, version, err := fetchJobTicket(ctx, p.strgc, jobID)
+	if errors.Is(err, storagec.NotFound) {
+		if !failed {
+			return
+		}
+	} else if err != nil {
+		logger.Errorf("failed to fetch the open ticket of the job: %s", err)
+		addWarning(ctx, "ticket of job %s not updated: %s", j.Name, err)
+		return
+	}
+
+	var ts ticketSettings
+	err = fetchSettings(ctx, p.strgc, ticketSettingsName, &ts)
+	if err != nil && !errors.Is(err, storagec.NotFound) {
+		logger.Errorf("failed to fetch ticketing settings - not ticketing: %s", err)
+		return
+	}
+	conn := p.connectors(connector.WebhookConfig{
+		AuthHeader: ts.AuthHeader,
+		CreateURL:  j.Ticketing.URL,
+		UpdateURL:  j.Ticketing.UpdateURL,
+	})
+	t := newTicket(er.record, jobID, j.Name)
+	now := p.clock.Now().Format(pkg.ISOTimeFormat)
+
+	switch {
+	case version == "":
+		ref, err := conn.CreateTicket(ctx, t)
+		if err != nil {
+			logger.Errorf("failed to create ticket: %s", err)
+			addWarning(ctx, "ticket for execution %s not created: %s", er.record.ExecutionID, err)
+			return
+		}
+		open = jobTicket{
+			ExecutionID: er.record.ExecutionID,
+			JobID:       jobID,
+			OpenedAt:    now,
+			TicketID:    ref.ID,
+			TicketURL:   ref.URL,
+			UpdatedAt:   now,
+		}
+	case !failed:
+		t.Resolved = true
+		t.Summary = fmt.Sprintf("Rapid Response job %s completed", t.JobName)
+		t.Description = fmt.Sprintf("Job %s completed on all of its hosts.", t.JobName)
+		if err := conn.UpdateTicket(ctx, connector.TicketRef{ID: open.TicketID, URL: open.TicketURL}, t); err != nil {
+			logger.Errorf("failed to resolve ticket %s: %s", open.TicketID, err)
+			addWarning(ctx, "ticket %s not resolved: %s", open.TicketID, err)
+			return
+		}
+		err := p.strgc.DeleteObject(ctx, storagec.DeleteObjectRequest{Collection: jobTicketCollection, ObjectKey: jobID})
+		if err != nil && !errors.Is(err, storagec.NotFound) {
+			logger.Errorf("failed to delete resolved ticket %s: %s", open.TicketID, err)
+		}
+		return
+	default:
+		if err := conn.UpdateTicket(ctx, connector.TicketRef{ID: open.TicketID, URL: open.TicketURL}, t); err != nil {
+			logger.Errorf("failed to update ticket %s: %s", open.TicketID, err)
+			addWarning(ctx, "ticket %s not updated: %s", open.TicketID, err)
+			return
+		}
+		open.ExecutionID = er.record.ExecutionID
+		open.UpdatedAt = now
+	}
+
+	data, err := json.Marshal(open)
+	if err == nil {
+		err = putObject(ctx, p.strgc, jobTicketCollection, jobID, data, version)
+	}
+	if err != nil {
+		logger.Errorf("failed to save ticket %s: %s", open.TicketID, err)
+	}
+}
+
+// fetchJobTicket returns the open ticket of the job and its version, or storagec.NotFound if it has none.
+func fetchJobTicket(ctx context.Context, strgc storagec.StorageC, jobID string) (jobTicket, string, error) {
+	m, version, err := fetchObject(ctx, strgc, jobTicketCollection, jobID)
+	if err != nil {
+		return jobTicket{}, "", err
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return jobTicket{}, "", err
+	}
+	var t jobTicket
+	if err = json.Unmarshal(b, &t); err != nil {
+		return jobTicket{}, "", fmt.Errorf("failed to deserialize ticket of job %s: %s", jobID, err)
+	}
+	return t, version, nil
+}
+
+// newTicket returns the ticket of a failed execution, carrying the failures of its hosts.
+func newTicket(je pkg.JobExecution, jobID, jobName string) connector.Ticket {
+	if jobName == "" {
+		jobName = je.JobName
+	}
+	t := connector.Ticket{
+		ExecutionID: je.ExecutionID,
+		FailedHosts: make([]connector.FailedHost, 0),
+		JobID:       jobID,
+		JobName:     jobName,
+		Status:      je.RunStatus,
+	}
+	for _, h := range je.TargetedHosts {
+		if h.Status == pkg.StatusFailed {
+			t.FailedHosts = append(t.FailedHosts, connector.FailedHost{DeviceID: h.DeviceID, Error: h.Error, HostName: h.HostName})
+		}
+	}
+	t.Summary = fmt.Sprintf("Rapid Response job %s: %s", jobName, je.RunStatus)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Execution %s of job %s finished with status %s, failing on %d of %d hosts.",
+		je.ExecutionID, jobName, je.RunStatus, len(t.FailedHosts), len(je.TargetedHosts))
+	for _, h := range t.FailedHosts {
+		fmt.Fprintf(&sb, "\n- %s (%s)", h.HostName, h.DeviceID)
+		if h.Error != "" {
+			fmt.Fprintf(&sb, ": %s", h.Error)
+		}
+	}
+	t.Description = sb.String()
+	return t
+}
@@ -0,0 +1,76 @@
+package processor
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/validate"
+)
+
+// Validation rules shared by processors.
+var (
+	// jobStatusRule rejects job statuses which NormalizeJobStatus does not recognize.
+	jobStatusRule = validate.Check(func(v string) bool { return pkg.NormalizeJobStatus(v) != "" }, "unknown status")
+	// isoTimeRule rejects times not in the ISO-8601 format.
+	isoTimeRule = validate.Time(pkg.ISOTimeFormat)
+	// queryCursorRule rejects cursors not returned by a query.
+	queryCursorRule = validate.Check(func(v string) bool {
+		_, err := decodeQueryCursor(v)
+		return err == nil
+	}, "invalid cursor")
+)
+
+// queryParam returns the trimmed value of a query parameter.
+func queryParam(q url.Values, name string) string {
+	return strings.TrimSpace(q.Get(name))
+}
+
+// pagingFields are the fields of the limit and cursor query parameters of cursor paginated queries.
+func pagingFields(q url.Values) []validate.Field {
+	return []validate.Field{
+		{Name: "limit", Value: queryParam(q, "limit"), Rules: []validate.Rule{validate.Int()}},
+		{Name: "cursor", Value: queryParam(q, "cursor"), Rules: []validate.Rule{queryCursorRule}},
+	}
+}
+
+// hostPagingFields are the fields of the hosts_page and hosts_page_size query parameters, which paginate the
+// targeted hosts of each returned execution.
+func hostPagingFields(q url.Values) []validate.Field {
+	return []validate.Field{
+		{Name: "hosts_page", Value: queryParam(q, "hosts_page"), Rules: []validate.Rule{validate.Int(), validate.AtLeast(1)}},
+		{Name: "hosts_page_size", Value: queryParam(q, "hosts_page_size"), Rules: []validate.Rule{validate.Int(), validate.AtLeast(1)}},
+	}
+}
+
+// parseHostPaging returns the page of targeted hosts requested by valid host paging fields, and false if neither
+// is set, in which case every host is returned.  Page sizes are capped to maxHostsPageSize.
+func parseHostPaging(q url.Values) (pkg.HostsPage, bool) {
+	page, size := queryParam(q, "hosts_page"), queryParam(q, "hosts_page_size")
+	if page == "" && size == "" {
+		return pkg.HostsPage{}, false
+	}
+	hp := pkg.HostsPage{Page: 1, PageSize: defaultHostsPageSize}
+	if n, err := strconv.Atoi(page); err == nil {
+		hp.Page = n
+	}
+	if n, err := strconv.Atoi(size); err == nil {
+		hp.PageSize = min(n, maxHostsPageSize)
+	}
+	return hp, true
+}
+
+// parsePaging returns the limit and cursor of a query whose paging fields are valid.  Limits which are not
+// positive are ignored in favour of the default limit, and larger limits are capped to maxLimit.
+func parsePaging(q url.Values, defaultLimit, maxLimit int) (int, queryCursor) {
+	limit := defaultLimit
+	if l, err := strconv.Atoi(queryParam(q, "limit")); err == nil && l > 0 {
+		limit = l
+	}
+	var c queryCursor
+	if s := queryParam(q, "cursor"); s != "" {
+		c, _ = decodeQueryCursor(s)
+	}
+	return min(limit, maxLimit), c
+}
@@ -0,0 +1,85 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+type warningsKey struct{}
+
+// warningSet collects the warnings of a request.  It is safe for concurrent use, as processors fan work out to
+// goroutines.
+type warningSet struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+// WithWarnings returns a copy of ctx collecting the warnings of the request it carries, i.e. the non-fatal
+// anomalies met while processing it, which WarningsBody adds to its response.
+func WithWarnings(ctx context.Context) context.Context {
+	return context.WithValue(ctx, warningsKey{}, &warningSet{})
+}
+
+// addWarning records a non-fatal anomaly met while processing the request of ctx, formatted like fmt.Sprintf.
+// Repeated warnings are recorded once.  It is a no-op for contexts not collecting warnings.
+func addWarning(ctx context.Context, format string, args ...any) {
+	ws, _ := ctx.Value(warningsKey{}).(*warningSet)
+	if ws == nil {
+		return
+	}
+	msg := fmt.Sprintf(format, args...)
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if !slices.Contains(ws.msgs, msg) {
+		ws.msgs = append(ws.msgs, msg)
+	}
+}
+
+// collectedWarnings returns the warnings recorded on ctx.
+func collectedWarnings(ctx context.Context) []string {
+	ws, _ := ctx.Value(warningsKey{}).(*warningSet)
+	if ws == nil {
+		return nil
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	return slices.Clone(ws.msgs)
+}
+
+// WarningsBody returns the body of the response with the warnings of the response and those recorded on ctx in
+// its warnings field, after those the body already reports.  Bodies which are not JSON objects are returned as
+// they are.
+func WarningsBody(ctx context.Context, resp Response) []byte {
+	warnings := append(slices.Clone(resp.Warnings), collectedWarnings(ctx)...)
+	if len(warnings) == 0 || len(resp.Body) == 0 {
+		return resp.Body
+	}
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(resp.Body, &body); err != nil || body == nil {
+		return resp.Body
+	}
+	var merged []string
+	if raw, ok := body["warnings"]; ok {
+		if err := json.Unmarshal(raw, &merged); err != nil {
+			return resp.Body
+		}
+	}
+	for _, w := range warnings {
+		if !slices.Contains(merged, w) {
+			merged = append(merged, w)
+		}
+	}
+	raw, err := json.Marshal(merged)
+	if err != nil {
+		return resp.Body
+	}
+	body["warnings"] = raw
+	b, err := json.Marshal(body)
+	if err != nil {
+		return resp.Body
+	}
+	return b
+}
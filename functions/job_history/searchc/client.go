@@ -2,12 +2,15 @@ package searchc
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
 	"github.com/crowdstrike/gofalcon/falcon/client/saved_searches"
 	"github.com/crowdstrike/gofalcon/falcon/models"
 	"github.com/eapache/go-resiliency/retrier"
@@ -18,56 +21,174 @@ import (
 type SearchC interface {
 	// Search issues a search against Logscale, returning any matching events.
 	Search(ctx context.Context, req SearchRequest) (SearchResponse, error)
+	// Ping checks that the saved search API is reachable, without running a search.
+	Ping(ctx context.Context) error
 }
 
 // Client is the client.
 type Client struct {
-	c      saved_searches.ClientService
-	logger logrus.FieldLogger
+	c       saved_searches.ClientService
+	logger  logrus.FieldLogger
+	timeout time.Duration
 }
 
 var _ SearchC = (*Client)(nil)
 
+// TenantParam is the parameter restricting the saved searches to the events of the tenant carried by the context
+// of a search, see pkg.WithTenant.
+const TenantParam = "cid"
+
+// Incomplete is a dedicated error indicating that the search job did not complete before its results were fetched.
+var Incomplete = errors.New("search job not complete")
+
+// DefaultSearchTimeout is how long a single search job may take to start and return its results, unless the
+// Client is configured otherwise.
+const DefaultSearchTimeout = 2 * time.Minute
+
 // NewClient returns a new search client.
-func NewClient(c saved_searches.ClientService, logger logrus.FieldLogger) *Client {
-	return &Client{
-		c:      c,
-		logger: logger,
+func NewClient(c saved_searches.ClientService, logger logrus.FieldLogger, opts ...func(f *Client)) *Client {
+	f := &Client{
+		c:       c,
+		logger:  logger,
+		timeout: DefaultSearchTimeout,
+	}
+	for _, o := range opts {
+		o(f)
+	}
+	return f
+}
+
+// WithSearchTimeout sets how long a single search job may take, so that a slow search cannot use up the time
+// left to the request.  Each attempt of a polled search is bounded separately.
+func WithSearchTimeout(d time.Duration) func(f *Client) {
+	return func(f *Client) {
+		if d > 0 {
+			f.timeout = d
+		}
 	}
 }
 
 func (f *Client) Search(ctx context.Context, req SearchRequest) (SearchResponse, error) {
+	if req.Cursor != "" {
+		c, err := decodePageCursor(req.Cursor)
+		if err != nil {
+			return SearchResponse{}, fmt.Errorf("invalid cursor: %w", err)
+		}
+		ctx, cancel := context.WithTimeout(ctx, f.timeout)
+		defer cancel()
+		resp, err := f.fetchSearchResults(ctx, req, c.JobID, c.Offset)
+		if err != nil {
+			return SearchResponse{}, fmt.Errorf("failed to fetch search results: %w", err)
+		}
+		return resp, nil
+	}
+	if req.MaxWait <= 0 {
+		return f.search(ctx, req)
+	}
+	return f.poll(ctx, req)
+}
+
+// poll re-runs the search until it returns the expected number of events or the deadline passes.
+// Events may not have been ingested by Logscale when the search is first issued, and the results of a
+// completed search job are fixed, so each attempt starts a new search job.
+func (f *Client) poll(ctx context.Context, req SearchRequest) (SearchResponse, error) {
+	minEvents := 1
+	if req.MinEvents > 0 {
+		minEvents = req.MinEvents
+	}
+	interval := 10 * time.Second
+	if req.PollInterval > 0 {
+		interval = req.PollInterval
+	}
+	deadline := time.Now().Add(req.MaxWait)
+
+	for attempt := 1; ; attempt++ {
+		resp, err := f.search(ctx, req)
+		if err != nil {
+			return resp, err
+		}
+		if len(resp.Events) >= minEvents {
+			return resp, nil
+		}
+		if time.Now().Add(interval).After(deadline) {
+			f.logger.WithField("attempts", attempt).
+				WithField("events", len(resp.Events)).
+				WithField("min_events", minEvents).
+				Warn("gave up waiting for search results")
+			resp.Partial = true
+			return resp, nil
+		}
+
+		f.logger.WithField("attempt", attempt).
+			WithField("events", len(resp.Events)).
+			Info("too few search results, searching again")
+		select {
+		case <-ctx.Done():
+			resp.Partial = true
+			return resp, nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (f *Client) search(ctx context.Context, req SearchRequest) (SearchResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
 	jobID, err := f.startSearchJob(ctx, req)
 	if err != nil {
-		return SearchResponse{}, fmt.Errorf("failed to start search: %s", err)
+		return SearchResponse{}, fmt.Errorf("failed to start search: %w", err)
 	}
 	if jobID == "" {
 		return SearchResponse{}, nil
 	}
 	if req.InitialFetchPause >= 0 {
 		f.logger.Print("pausing to allow job to run")
+		pause := 5 * time.Second
 		if req.InitialFetchPause > 0 {
-			time.Sleep(req.InitialFetchPause)
-		} else {
-			time.Sleep(5 * time.Second)
+			pause = req.InitialFetchPause
+		}
+		select {
+		case <-ctx.Done():
+			return SearchResponse{}, fmt.Errorf("failed to fetch search results: %w", ctx.Err())
+		case <-time.After(pause):
 		}
 		f.logger.Print("waking up to fetch results")
 	}
 
-	resp, err := f.fetchSearchResults(ctx, req, jobID)
+	resp, err := f.fetchSearchResults(ctx, req, jobID, 0)
 	if err != nil {
-		return SearchResponse{}, fmt.Errorf("failed to fetch search results: %s", err)
+		return SearchResponse{}, fmt.Errorf("failed to fetch search results: %w", err)
 	}
 	return resp, nil
 }
 
+// Ping lists at most one saved search, which is enough to check the API is reachable and the token accepted.
+func (f *Client) Ping(ctx context.Context) error {
+	limit := int64(1)
+	params := saved_searches.NewQueryParamsWithContext(ctx)
+	params.Limit = &limit
+	if _, err := f.c.Query(params); err != nil {
+		return fmt.Errorf("failed to list saved searches: %w", err)
+	}
+	return nil
+}
+
 func (f *Client) startSearchJob(ctx context.Context, req SearchRequest) (string, error) {
 	boolFalse := false
 	mode := modeAsync
+	searchParams := req.SearchParams
+	if cid := pkg.TenantFromContext(ctx); cid != "" {
+		// the events of a tenant are those of its CID; saved searches default the parameter to every CID
+		searchParams = make(map[string]string, len(req.SearchParams)+1)
+		for k, v := range req.SearchParams {
+			searchParams[k] = v
+		}
+		searchParams[TenantParam] = cid
+	}
 	params := saved_searches.NewExecuteParams()
 	params.Body = &models.ApidomainSavedSearchExecuteRequestV1{
-		Name:       "Query By WorkflowRootExecutionID",
-		Parameters: req.SearchParams,
+		Name:       req.SearchName,
+		Parameters: searchParams,
 	}
 	params.Context = ctx
 	params.IncludeTestData = &boolFalse
@@ -76,7 +197,7 @@ func (f *Client) startSearchJob(ctx context.Context, req SearchRequest) (string,
 	f.logger.Println("starting search")
 	res, err := f.c.Execute(params)
 	if err != nil {
-		return "", fmt.Errorf("attempting to create search failed: %s", err)
+		return "", fmt.Errorf("attempting to create search failed: %w", err)
 	}
 	payload := res.Payload
 	if payload == nil {
@@ -101,8 +222,8 @@ func (f *Client) startSearchJob(ctx context.Context, req SearchRequest) (string,
 	return *js.JobID, nil
 }
 
-func (f *Client) fetchSearchResults(ctx context.Context, req SearchRequest, jobID string) (SearchResponse, error) {
-	offset := 0
+// fetchSearchResults fetches the events of a search job from the offset, up to the page size of the request.
+func (f *Client) fetchSearchResults(ctx context.Context, req SearchRequest, jobID string, offset int) (SearchResponse, error) {
 	maxPollAttempts := 10
 	if req.MaxPollAttempts > 0 {
 		maxPollAttempts = req.MaxPollAttempts
@@ -114,25 +235,38 @@ func (f *Client) fetchSearchResults(ctx context.Context, req SearchRequest, jobI
 	events := make(map[string]map[string]any)
 	var s SearchResponse
 	var err error
-	// No new events means no more data.
-	// This is a hack to work around an offset bug in the foundrylogging api.
-	// The limit is ignored once the offset >= the total number events matched
-	// by the saved search.
-	pre := -1
-	for pre != offset {
-		s, err = f.fetchSearchResultsPage(ctx, jobID, maxPollAttempts, offset)
+	for {
+		limit := maxFetchLimit
+		if req.PageSize > 0 {
+			limit = min(limit, req.PageSize-len(events))
+		}
+		s, err = f.fetchSearchResultsPage(ctx, jobID, maxPollAttempts, offset, limit)
 		if s.JobStatus != "" {
 			sr.JobStatus = s.JobStatus
 		}
 		if s.JobURL != "" {
 			sr.JobURL = s.JobURL
 		}
+		// This is a hack to work around an offset bug in the foundrylogging api.
+		// The limit is ignored once the offset >= the total number events matched
+		// by the saved search, so a page larger than the limit means there is no more data.
+		if len(s.Events) > limit {
+			break
+		}
 
-		pre = len(events)
+		// No new events means no more data.
+		pre := len(events)
 		for _, e := range s.Events {
 			events[e["@id"].(string)] = e
 		}
-		offset = len(events)
+		offset += len(events) - pre
+		if err != nil || len(events) == pre || len(s.Events) < limit {
+			break
+		}
+		if req.PageSize > 0 && len(events) >= req.PageSize {
+			sr.Next = encodePageCursor(pageCursor{JobID: jobID, Offset: offset})
+			break
+		}
 	}
 
 	sr.Events = make([]map[string]any, len(events))
@@ -145,10 +279,10 @@ func (f *Client) fetchSearchResults(ctx context.Context, req SearchRequest, jobI
 	return sr, err
 }
 
-func (f *Client) fetchSearchResultsPage(ctx context.Context, jobID string, maxPollAttempts int, offset int) (SearchResponse, error) {
+func (f *Client) fetchSearchResultsPage(ctx context.Context, jobID string, maxPollAttempts int, offset, limit int) (SearchResponse, error) {
 	var ssfr savedSearchFetchResource
-	err := retrier.New(retrier.ConstantBackoff(maxPollAttempts-1, 5*time.Second), nil).Run(func() error {
-		fetchRes, err0 := f.fetchSearchResultsCall(ctx, jobID, offset)
+	err := retrier.New(retrier.ConstantBackoff(maxPollAttempts-1, 5*time.Second), nil).RunCtx(ctx, func(ctx context.Context) error {
+		fetchRes, err0 := f.fetchSearchResultsCall(ctx, jobID, offset, limit)
 		if err0 != nil {
 			return err0
 		}
@@ -172,22 +306,22 @@ func (f *Client) fetchSearchResultsPage(ctx context.Context, jobID string, maxPo
 	return sr, err
 }
 
-func (f *Client) fetchSearchResultsCall(ctx context.Context, jobID string, offset int) (savedSearchFetchResource, error) {
-	limit := "1000"
+func (f *Client) fetchSearchResultsCall(ctx context.Context, jobID string, offset, limit int) (savedSearchFetchResource, error) {
+	ls := strconv.Itoa(limit)
 	os := strconv.Itoa(offset)
 	params := saved_searches.NewResultParams()
 	params.Context = ctx
 	params.JobID = jobID
-	params.Limit = &limit
+	params.Limit = &ls
 	params.Offset = &os
 
 	f.logger.WithField("job_id", jobID).
 		WithField("offset", os).
-		WithField("limit", limit).
+		WithField("limit", ls).
 		Info("fetching search results")
 	resp, err := f.c.Result(params)
 	if err != nil {
-		return savedSearchFetchResource{}, fmt.Errorf("failed to issue HTTP request: %s", err)
+		return savedSearchFetchResource{}, fmt.Errorf("failed to issue HTTP request: %w", err)
 	}
 
 	payload := resp.Payload
@@ -208,7 +342,7 @@ func (f *Client) fetchSearchResultsCall(ctx context.Context, jobID string, offse
 		return savedSearchFetchResource{}, errors.New("no job status returned")
 	}
 	if js.Status != "complete" {
-		return savedSearchFetchResource{}, fmt.Errorf("job %s not complete: %s", jobID, js.Status)
+		return savedSearchFetchResource{}, fmt.Errorf("%w: job %s is %s", Incomplete, jobID, js.Status)
 	}
 	events := make([]any, len(resource.Events))
 	for i, e := range resource.Events {
@@ -225,6 +359,26 @@ func (f *Client) fetchSearchResultsCall(ctx context.Context, jobID string, offse
 	}, nil
 }
 
+func encodePageCursor(c pageCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodePageCursor(s string) (pageCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return pageCursor{}, err
+	}
+	var c pageCursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return pageCursor{}, err
+	}
+	if c.JobID == "" || c.Offset < 0 {
+		return pageCursor{}, errors.New("malformed cursor")
+	}
+	return c, nil
+}
+
 func joinMsaAPIErrors(errs []*models.MsaAPIError) error {
 	if len(errs) == 0 {
 		return nil
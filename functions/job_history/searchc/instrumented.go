@@ -0,0 +1,59 @@
+package searchc
+
+import (
+	"context"
+	"time"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/metrics"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/tracing"
+)
+
+// InstrumentedClient is a SearchC which records the latency and outcome of every search it delegates, and
+// traces them as spans.
+type InstrumentedClient struct {
+	c      SearchC
+	r      *metrics.Registry
+	tracer tracing.Tracer
+}
+
+var _ SearchC = (*InstrumentedClient)(nil)
+
+// NewInstrumentedClient wraps c, recording metrics into r.
+func NewInstrumentedClient(c SearchC, r *metrics.Registry, opts ...func(i *InstrumentedClient)) *InstrumentedClient {
+	i := &InstrumentedClient{c: c, r: r, tracer: tracing.Noop}
+	for _, o := range opts {
+		o(i)
+	}
+	return i
+}
+
+// WithTracer traces every search of the InstrumentedClient with t.
+func WithTracer(t tracing.Tracer) func(i *InstrumentedClient) {
+	return func(i *InstrumentedClient) {
+		i.tracer = t
+	}
+}
+
+func (i *InstrumentedClient) Search(ctx context.Context, req SearchRequest) (SearchResponse, error) {
+	ctx, span := i.tracer.Start(ctx, "logscale.search", tracing.Attributes{"search": req.SearchName, "paged": req.Cursor != ""})
+	start := time.Now()
+	resp, err := i.c.Search(ctx, req)
+	span.End(err)
+	labels := metrics.Labels{"search": req.SearchName}
+	i.r.Since("logscale_search_latency_seconds", labels, start)
+	i.r.Inc("logscale_search_requests_total", metrics.Labels{"search": req.SearchName, "outcome": metrics.Outcome(err)})
+	if err == nil {
+		i.r.Add("logscale_search_events_total", labels, int64(len(resp.Events)))
+		if len(resp.Events) == 0 {
+			i.r.Inc("logscale_search_empty_results_total", labels)
+		}
+	}
+	return resp, err
+}
+
+func (i *InstrumentedClient) Ping(ctx context.Context) error {
+	ctx, span := i.tracer.Start(ctx, "logscale.ping", nil)
+	err := i.c.Ping(ctx)
+	span.End(err)
+	return err
+}
@@ -4,6 +4,8 @@ import "time"
 
 const (
 	modeAsync = "async_offload"
+	// maxFetchLimit is the maximum number of events fetched by a single request for search results.
+	maxFetchLimit = 1000
 )
 
 type jobStatus struct {
@@ -14,10 +16,23 @@ type jobStatus struct {
 
 // SearchRequest is a request to fetch data from Logscale.
 type SearchRequest struct {
+	// Cursor resumes fetching the events of an earlier search after the page which returned it.  The search is
+	// not run again, so InitialFetchPause and polling do not apply.
+	Cursor string
 	// InitialFetchPause is the duration of time to wait before polling for results.
 	InitialFetchPause time.Duration
 	// MaxPollAttempts is the maximum number of attempts to fetch search results before giving up.
 	MaxPollAttempts int
+	// MaxWait enables polling: the search is re-run until it returns at least MinEvents events or MaxWait
+	// has elapsed.  Zero disables polling.
+	MaxWait time.Duration
+	// MinEvents is the minimum number of events expected when polling.  Defaults to 1.
+	MinEvents int
+	// PageSize is the maximum number of events returned.  The following events are fetched by searching with
+	// the cursor returned in SearchResponse.Next.  Zero returns every event.
+	PageSize int
+	// PollInterval is the duration of time to wait between searches when polling.  Defaults to 10 seconds.
+	PollInterval time.Duration
 	// SearchName is the name of the saved search.
 	SearchName string
 	// SearchParams are arguments to provide to the search.
@@ -34,6 +49,10 @@ type SearchResponse struct {
 	JobStatus string
 	// JobURL is the URL of the search job.
 	JobURL string
+	// Next is the cursor of the next page of events, or empty if there are no more events.
+	Next string
+	// Partial is true when polling gave up before the expected number of events were returned.
+	Partial bool
 }
 
 type savedSearchFetchResource struct {
@@ -41,3 +60,9 @@ type savedSearchFetchResource struct {
 	Events     []any     `json:"events,omitempty"`
 	Status     jobStatus `json:"job_status,omitempty"`
 }
+
+// pageCursor is the position of a page of events in the results of a search job.
+type pageCursor struct {
+	JobID  string `json:"job_id"`
+	Offset int    `json:"offset"`
+}
@@ -0,0 +1,152 @@
+package searchc
+
+import "context"
+
+// defaultPageSize is the number of events per page when iterating over a search without a page size.
+const defaultPageSize = maxFetchLimit
+
+// Pages iterates over the pages of events matching one or more searches, fetching each page when it is needed.
+// The events of the searches are merged, dropping events already returned by an earlier page:
+//
+//	pages := NewPages(ctx, c, req)
+//	for pages.Next() {
+//		for _, e := range pages.Page().Events {
+//			...
+//		}
+//	}
+//	if err := pages.Err(); err != nil {
+//		...
+//	}
+type Pages struct {
+	c       SearchC
+	ctx     context.Context
+	done    bool
+	err     error
+	i       int
+	page    SearchResponse
+	reqs    []SearchRequest
+	resp    SearchResponse
+	seen    map[string]bool
+	started bool
+	// out is the page returned by Page, and prefetched the pages fetched by Prefetch which Next returns first.
+	out        SearchResponse
+	prefetched []SearchResponse
+}
+
+// NewPages returns an iterator over the pages of events matching the searches, which are run in turn.  Polling
+// applies to the first page of each search only.
+func NewPages(ctx context.Context, c SearchC, reqs ...SearchRequest) *Pages {
+	rs := make([]SearchRequest, len(reqs))
+	for i, req := range reqs {
+		if req.PageSize <= 0 {
+			req.PageSize = defaultPageSize
+		}
+		rs[i] = req
+	}
+	return &Pages{
+		c:    c,
+		ctx:  ctx,
+		done: len(rs) == 0,
+		reqs: rs,
+		seen: make(map[string]bool),
+	}
+}
+
+// Next fetches the next page of events, returning false when there are no more pages or a search failed.
+func (p *Pages) Next() bool {
+	if len(p.prefetched) > 0 {
+		p.out, p.prefetched = p.prefetched[0], p.prefetched[1:]
+		return true
+	}
+	if !p.fetch() {
+		p.out = SearchResponse{}
+		return false
+	}
+	p.out = p.page
+	return true
+}
+
+// fetch fetches the page following the last fetched page into page.
+func (p *Pages) fetch() bool {
+	for !p.done {
+		first := !p.started
+		if !first && p.page.Next == "" {
+			p.advance()
+			continue
+		}
+		req := p.reqs[p.i]
+		if !first {
+			req.Cursor = p.page.Next
+		}
+		p.started = true
+
+		page, err := p.c.Search(p.ctx, req)
+		if err != nil {
+			p.err, p.done = err, true
+			return false
+		}
+
+		// the results API may return events of earlier pages once the offset passes the last event
+		events := make([]map[string]any, 0, len(page.Events))
+		for _, e := range page.Events {
+			id, _ := e["@id"].(string)
+			if id != "" && p.seen[id] {
+				continue
+			}
+			p.seen[id] = true
+			events = append(events, e)
+		}
+		if !first && len(events) == 0 {
+			p.advance()
+			continue
+		}
+		page.Events = events
+
+		p.page = page
+		if p.resp.JobID == "" {
+			p.resp.JobID = page.JobID
+		}
+		if p.resp.JobStatus == "" {
+			p.resp.JobStatus = page.JobStatus
+		}
+		if p.resp.JobURL == "" {
+			p.resp.JobURL = page.JobURL
+		}
+		p.resp.Partial = p.resp.Partial || page.Partial
+		return true
+	}
+	return false
+}
+
+// Prefetch fetches up to n pages now, so that the searches can run while the caller is busy with other calls.
+// Next returns the prefetched pages before fetching the following pages, so that at most n pages are held in
+// memory however many events match.  Err returns the error which stopped the prefetch, if any.
+func (p *Pages) Prefetch(n int) {
+	for len(p.prefetched) < n && p.fetch() {
+		p.prefetched = append(p.prefetched, p.page)
+	}
+}
+
+// advance moves on to the next search.
+func (p *Pages) advance() {
+	p.i++
+	p.page = SearchResponse{}
+	p.started = false
+	p.done = p.i >= len(p.reqs)
+}
+
+// Page returns the page fetched by the last call to Next.
+func (p *Pages) Page() SearchResponse {
+	return p.out
+}
+
+// Err returns the error which stopped the iteration, if any.
+func (p *Pages) Err() error {
+	return p.err
+}
+
+// Response returns the job of the first search and whether polling gave up on any search, as of the pages
+// fetched so far.  Its events are not set.
+func (p *Pages) Response() SearchResponse {
+	return p.resp
+}
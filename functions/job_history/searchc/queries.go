@@ -0,0 +1,73 @@
+package searchc
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// QueryExecutionResults is the logical name of the query returning the events written by the workflow of a job
+// execution.  Its saved searches are passed the execution_id parameter.
+const QueryExecutionResults = "execution_results"
+
+// QueryWorkflowExecutions is the logical name of the query returning an event for each workflow execution which
+// wrote to Logscale between two times.  Its saved searches are passed the start and end parameters, in
+// milliseconds since the epoch.
+const QueryWorkflowExecutions = "workflow_executions"
+
+// SavedSearches maps logical query names to the names of the saved searches run for them.  When a query maps to
+// several saved searches, their events are merged.
+type SavedSearches struct {
+	// Default maps logical query names to the saved searches run for jobs of any type.
+	Default map[string][]string `json:"default,omitempty"`
+	// JobTypes maps job action types to the saved searches run for jobs of that type, in place of Default.
+	JobTypes map[string]map[string][]string `json:"job_types,omitempty"`
+}
+
+// DefaultSavedSearches returns the saved searches shipped with the app.
+func DefaultSavedSearches() SavedSearches {
+	return SavedSearches{
+		Default: map[string][]string{
+			QueryExecutionResults:   {"Query By WorkflowRootExecutionID"},
+			QueryWorkflowExecutions: {"Query Workflow Executions"},
+		},
+	}
+}
+
+// ParseSavedSearches decodes saved searches from JSON.  Queries it does not map by default are mapped to the
+// saved searches shipped with the app.
+func ParseSavedSearches(s string) (SavedSearches, error) {
+	var ss SavedSearches
+	if err := json.Unmarshal([]byte(s), &ss); err != nil {
+		return SavedSearches{}, fmt.Errorf("failed to decode saved searches: %w", err)
+	}
+	if ss.Default == nil {
+		ss.Default = make(map[string][]string)
+	}
+	for q, names := range DefaultSavedSearches().Default {
+		if len(ss.Default[q]) == 0 {
+			ss.Default[q] = names
+		}
+	}
+	return ss, nil
+}
+
+// Resolve returns the names of the saved searches run for the query on behalf of a job of the given action type.
+func (s SavedSearches) Resolve(query, jobType string) []string {
+	if names := s.JobTypes[jobType][query]; len(names) > 0 {
+		return names
+	}
+	return s.Default[query]
+}
+
+// Requests returns a request for each saved search run for the query, passing each the same parameters.
+func (s SavedSearches) Requests(query, jobType string, params map[string]string) []SearchRequest {
+	names := s.Resolve(query, jobType)
+	reqs := make([]SearchRequest, len(names))
+	for i, name := range names {
+		reqs[i] = SearchRequest{
+			SearchName:   name,
+			SearchParams: params,
+		}
+	}
+	return reqs
+}
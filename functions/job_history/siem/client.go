@@ -0,0 +1,190 @@
+package siem
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/notifier"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// appName is the APP-NAME of the syslog messages.
+	appName = "rapid-response"
+	// facility is the syslog facility of the messages, local0.
+	facility = 16
+	// dialTimeout bounds connecting to and writing to syslog collectors.
+	dialTimeout = 5 * time.Second
+)
+
+// Emitter ships the summaries of completed job executions to a SIEM collector.
+type Emitter interface {
+	// Emit ships the summary of an execution.
+	Emit(ctx context.Context, s notifier.Summary) error
+}
+
+// Client is the client.  Events are sent as RFC 5424 syslog messages to udp://, tcp:// and tls:// collectors,
+// octet-counted on streams, and POSTed as plain text to http:// and https:// collectors.
+type Client struct {
+	authHeader string
+	clock      pkg.Clock
+	collector  *url.URL
+	format     string
+	hc         *http.Client
+	hostname   string
+	logger     logrus.FieldLogger
+}
+
+var _ Emitter = (*Client)(nil)
+
+// NewClient returns a new client emitting events in the given format to the collector URL, e.g.
+// tls://siem.example.com:6514 or https://siem.example.com/events.  HTTP collectors are requested with hc.
+func NewClient(collector, format string, hc *http.Client, logger logrus.FieldLogger, opts ...func(c *Client)) (*Client, error) {
+	u, err := url.Parse(collector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid collector URL: %s", err)
+	}
+	switch u.Scheme {
+	case "udp", "tcp", "tls":
+		if u.Port() == "" {
+			return nil, errors.New("syslog collector URL must have a port")
+		}
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("unsupported collector scheme %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, errors.New("collector URL must have a host")
+	}
+	switch format {
+	case FormatCEF, FormatLEEF:
+	default:
+		return nil, fmt.Errorf("unsupported SIEM format %q", format)
+	}
+
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+	c := &Client{
+		clock:     pkg.SystemClock,
+		collector: u,
+		format:    format,
+		hc:        hc,
+		hostname:  hostname,
+		logger:    logger,
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c, nil
+}
+
+// WithAuthHeader sets the Authorization header of the requests to HTTP collectors, e.g. "Splunk <token>".
+func WithAuthHeader(h string) func(c *Client) {
+	return func(c *Client) {
+		c.authHeader = h
+	}
+}
+
+// WithSIEMClock sets the clock of the client.
+func WithSIEMClock(clock pkg.Clock) func(c *Client) {
+	return func(c *Client) {
+		c.clock = clock
+	}
+}
+
+func (c *Client) Emit(ctx context.Context, s notifier.Summary) error {
+	event, err := Format(c.format, s)
+	if err != nil {
+		return err
+	}
+	switch c.collector.Scheme {
+	case "http", "https":
+		err = c.post(ctx, event)
+	default:
+		err = c.send(ctx, c.syslog(s.Status, event))
+	}
+	if err != nil {
+		return err
+	}
+	c.logger.WithField("execution_id", s.ExecutionID).
+		WithField("collector", c.collector.Host).
+		Info("execution event emitted")
+	return nil
+}
+
+// syslog frames the event as an RFC 5424 message.  Failed executions are logged at the warning level.
+func (c *Client) syslog(status, event string) string {
+	sev := 6
+	if status != pkg.StatusCompleted {
+		sev = 4
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s - %s - %s", facility*8+sev, c.clock.Now().UTC().Format(time.RFC3339),
+		c.hostname, appName, strings.ToUpper(c.format), event)
+}
+
+// send writes the message to the syslog collector, octet-counted on streams.
+func (c *Client) send(ctx context.Context, msg string) error {
+	ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+
+	var conn net.Conn
+	var err error
+	switch c.collector.Scheme {
+	case "tls":
+		d := &tls.Dialer{Config: &tls.Config{ServerName: c.collector.Hostname(), MinVersion: tls.VersionTLS12}}
+		conn, err = d.DialContext(ctx, "tcp", c.collector.Host)
+	default:
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, c.collector.Scheme, c.collector.Host)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to syslog collector: %s", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetWriteDeadline(deadline)
+	}
+
+	if c.collector.Scheme != "udp" {
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	}
+	if _, err = io.WriteString(conn, msg); err != nil {
+		return fmt.Errorf("failed to write to syslog collector: %s", err)
+	}
+	return nil
+}
+
+// post POSTs the event to the HTTP collector.
+func (c *Client) post(ctx context.Context, event string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.collector.String(), bytes.NewBufferString(event))
+	if err != nil {
+		return fmt.Errorf("failed to create collector request: %s", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if c.authHeader != "" {
+		req.Header.Set("Authorization", c.authHeader)
+	}
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to issue HTTP request: %s", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("collector responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
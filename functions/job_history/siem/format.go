@@ -0,0 +1,142 @@
+package siem
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/notifier"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+)
+
+// Formats of the events emitted to SIEM collectors.
+const (
+	// FormatCEF is the ArcSight Common Event Format.
+	FormatCEF = "cef"
+	// FormatLEEF is the QRadar Log Event Extended Format, version 2.0, with tab delimited attributes.
+	FormatLEEF = "leef"
+)
+
+const (
+	vendor  = "CrowdStrike"
+	product = "Rapid Response"
+	version = "1.0"
+)
+
+// severity returns the severity of the event of an execution with the given status, from 0 to 10.
+func severity(status string) int {
+	switch status {
+	case pkg.StatusFailed:
+		return 8
+	case pkg.StatusTimedOut:
+		return 7
+	case pkg.StatusCompletedWithErrors:
+		return 5
+	default:
+		return 3
+	}
+}
+
+// attributes returns the attributes of the event of the summary, keyed by their CEF or LEEF name.  CEF has no
+// keys of its own for the job, so its custom string and number keys are used, labelled.
+func attributes(format string, s notifier.Summary) map[string]string {
+	start, end := millis(s.RunDate), millis(s.EndDate)
+	if format == FormatLEEF {
+		attrs := map[string]string{
+			"cat":         "Job Execution",
+			"duration":    s.Duration,
+			"executionId": s.ExecutionID,
+			"failedHosts": fmt.Sprint(s.FailedHosts),
+			"jobId":       s.JobID,
+			"jobName":     s.JobName,
+			"numHosts":    fmt.Sprint(s.NumHosts),
+			"sev":         fmt.Sprint(severity(s.Status)),
+			"status":      s.Status,
+		}
+		if end != "" {
+			attrs["devTime"] = end
+			attrs["devTimeFormat"] = "milliseconds"
+		}
+		return attrs
+	}
+
+	attrs := map[string]string{
+		"cn1":      fmt.Sprint(s.FailedHosts),
+		"cn1Label": "failedHosts",
+		"cn2":      fmt.Sprint(s.NumHosts),
+		"cn2Label": "numHosts",
+		"cs1":      s.JobName,
+		"cs1Label": "jobName",
+		"cs2":      s.ExecutionID,
+		"cs2Label": "executionId",
+		"cs3":      s.JobID,
+		"cs3Label": "jobId",
+		"cs4":      s.Duration,
+		"cs4Label": "duration",
+		"outcome":  s.Status,
+	}
+	if start != "" {
+		attrs["start"] = start
+	}
+	if end != "" {
+		attrs["end"] = end
+	}
+	return attrs
+}
+
+// millis returns the timestamp as milliseconds since the epoch, or a blank string if it cannot be parsed.
+func millis(ts string) string {
+	t, err := time.Parse(pkg.ISOTimeFormat, ts)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprint(t.UnixMilli())
+}
+
+// Format serializes the summary of an execution to a CEF or LEEF event.
+func Format(format string, s notifier.Summary) (string, error) {
+	attrs := attributes(format, s)
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	switch format {
+	case FormatCEF:
+		fmt.Fprintf(&sb, "CEF:0|%s|%s|%s|%s|%s|%d|", cefHeader(vendor), cefHeader(product), cefHeader(version),
+			cefHeader(s.Status), cefHeader("Job execution "+s.Status), severity(s.Status))
+		for i, k := range keys {
+			if i > 0 {
+				sb.WriteByte(' ')
+			}
+			fmt.Fprintf(&sb, "%s=%s", k, cefValue(attrs[k]))
+		}
+	case FormatLEEF:
+		fmt.Fprintf(&sb, "LEEF:2.0|%s|%s|%s|%s|x09|", leefHeader(vendor), leefHeader(product), leefHeader(version),
+			leefHeader(s.Status))
+		for i, k := range keys {
+			if i > 0 {
+				sb.WriteByte('\t')
+			}
+			fmt.Fprintf(&sb, "%s=%s", k, leefValue(attrs[k]))
+		}
+	default:
+		return "", fmt.Errorf("unsupported SIEM format %q", format)
+	}
+	return sb.String(), nil
+}
+
+var (
+	cefHeaderEscaper  = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	cefValueEscaper   = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+	leefHeaderEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	leefValueEscaper  = strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
+)
+
+func cefHeader(s string) string  { return cefHeaderEscaper.Replace(s) }
+func cefValue(s string) string   { return cefValueEscaper.Replace(s) }
+func leefHeader(s string) string { return leefHeaderEscaper.Replace(s) }
+func leefValue(s string) string  { return leefValueEscaper.Replace(s) }
@@ -0,0 +1,153 @@
+package storagec
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+)
+
+// cacheKey identifies a cached object.
+type cacheKey struct {
+	collection string
+	objectKey  string
+}
+
+// cacheEntry is a cached object and the time at which it expires.
+type cacheEntry struct {
+	expires time.Time
+	key     cacheKey
+	resp    FetchObjectResponse
+}
+
+// Cache is an in-memory LRU cache of fetched objects, each of which expires after a short TTL.  It is safe for
+// concurrent use, and is meant to be shared by the CachedClient of every request.
+type Cache struct {
+	clock   pkg.Clock
+	entries map[cacheKey]*list.Element
+	lru     *list.List
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+}
+
+// NewCache returns a cache of up to size objects, each cached for ttl.
+func NewCache(size int, ttl time.Duration, clock pkg.Clock) *Cache {
+	return &Cache{
+		clock:   clock,
+		entries: make(map[cacheKey]*list.Element),
+		lru:     list.New(),
+		size:    size,
+		ttl:     ttl,
+	}
+}
+
+func (c *Cache) get(k cacheKey) (FetchObjectResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[k]
+	if !ok {
+		return FetchObjectResponse{}, false
+	}
+	e := el.Value.(*cacheEntry)
+	if !c.clock.Now().Before(e.expires) {
+		c.lru.Remove(el)
+		delete(c.entries, k)
+		return FetchObjectResponse{}, false
+	}
+	c.lru.MoveToFront(el)
+	return e.resp, true
+}
+
+func (c *Cache) put(k cacheKey, resp FetchObjectResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := &cacheEntry{expires: c.clock.Now().Add(c.ttl), key: k, resp: resp}
+	if el, ok := c.entries[k]; ok {
+		el.Value = e
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[k] = c.lru.PushFront(e)
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *Cache) invalidate(k cacheKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[k]; ok {
+		c.lru.Remove(el)
+		delete(c.entries, k)
+	}
+}
+
+// CachedClient is a StorageC which serves repeated fetches of an object from a Cache, e.g. the record of a job
+// fetched for each of the many execution events of the job arriving within seconds of each other.  Putting or
+// deleting an object through the client invalidates its cached copy, but changes made by other function
+// instances are only seen once the cached copy expires.
+type CachedClient struct {
+	c     StorageC
+	cache *Cache
+}
+
+var _ StorageC = (*CachedClient)(nil)
+
+// NewCachedClient wraps c, caching the objects it fetches into cache.
+func NewCachedClient(c StorageC, cache *Cache) *CachedClient {
+	return &CachedClient{c: c, cache: cache}
+}
+
+func (cc *CachedClient) BulkFetch(ctx context.Context, req BulkFetchObjectsRequest) BulkFetchObjectsResponse {
+	return cc.c.BulkFetch(ctx, req)
+}
+
+func (cc *CachedClient) Count(ctx context.Context, req SearchObjectsRequest) (int, error) {
+	return cc.c.Count(ctx, req)
+}
+
+func (cc *CachedClient) DeleteObject(ctx context.Context, req DeleteObjectRequest) error {
+	defer cc.cache.invalidate(cacheKey{collection: req.Collection, objectKey: req.ObjectKey})
+	return cc.c.DeleteObject(ctx, req)
+}
+
+func (cc *CachedClient) FetchKeys(ctx context.Context, req FetchKeysRequest) (FetchKeysResponse, error) {
+	return cc.c.FetchKeys(ctx, req)
+}
+
+func (cc *CachedClient) FetchObject(ctx context.Context, req FetchObjectRequest) (FetchObjectResponse, error) {
+	k := cacheKey{collection: req.Collection, objectKey: req.ObjectKey}
+	if resp, ok := cc.cache.get(k); ok {
+		return resp, nil
+	}
+	resp, err := cc.c.FetchObject(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+	cc.cache.put(k, resp)
+	return resp, nil
+}
+
+// PutObject puts the object, invalidating its cached copy whether or not the put succeeded, as a failed put may
+// be a version conflict caused by a stale cached copy.
+func (cc *CachedClient) PutObject(ctx context.Context, req PutObjectRequest) (StoredObject, error) {
+	defer cc.cache.invalidate(cacheKey{collection: req.Collection, objectKey: req.ObjectKey})
+	return cc.c.PutObject(ctx, req)
+}
+
+func (cc *CachedClient) Search(ctx context.Context, req SearchObjectsRequest) (SearchObjectsResponse, error) {
+	return cc.c.Search(ctx, req)
+}
+
+func (cc *CachedClient) SearchAll(ctx context.Context, req SearchObjectsRequest) (SearchObjectsResponse, error) {
+	return cc.c.SearchAll(ctx, req)
+}
+
+func (cc *CachedClient) SearchAndFetch(ctx context.Context, req SearchObjectsRequest) (SearchAndFetchResponse, error) {
+	return cc.c.SearchAndFetch(ctx, req)
+}
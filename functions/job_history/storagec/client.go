@@ -3,25 +3,38 @@ package storagec
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/crowdstrike/gofalcon/falcon/client/custom_storage"
 	"github.com/crowdstrike/gofalcon/falcon/models"
+	"github.com/eapache/go-resiliency/breaker"
 	"github.com/sirupsen/logrus"
 )
 
 // NotFound is a dedicated error indicating that the requested object was not found.
 var NotFound = errors.New("not found")
 
+// VersionConflict is a dedicated error indicating that the object was modified since it was fetched.
+var VersionConflict = errors.New("version conflict")
+
 // StorageC is a custom storage client interface.
 type StorageC interface {
 	// BulkFetch returns a multiple objects identified by the given keys in a single call.
 	BulkFetch(ctx context.Context, req BulkFetchObjectsRequest) BulkFetchObjectsResponse
+	// Count returns the number of objects which match the given FQL filter.
+	Count(ctx context.Context, req SearchObjectsRequest) (int, error)
+	// DeleteObject deletes a single object identified by the given key.
+	DeleteObject(ctx context.Context, req DeleteObjectRequest) error
 	// FetchKeys returns a page of object keys in a collection.
 	FetchKeys(ctx context.Context, req FetchKeysRequest) (FetchKeysResponse, error)
 	// FetchObject returns a single object identified by the given keys, or an error.
@@ -30,6 +43,8 @@ type StorageC interface {
 	PutObject(ctx context.Context, req PutObjectRequest) (StoredObject, error)
 	// Search fetches object keys which match the given FQL filter.
 	Search(ctx context.Context, req SearchObjectsRequest) (SearchObjectsResponse, error)
+	// SearchAll fetches the object keys from every page of results which match the given FQL filter.
+	SearchAll(ctx context.Context, req SearchObjectsRequest) (SearchObjectsResponse, error)
 	// SearchAndFetch combines Search and BulkFetch into a single function, returning the records
 	// discovered through Search.
 	SearchAndFetch(ctx context.Context, req SearchObjectsRequest) (SearchAndFetchResponse, error)
@@ -38,21 +53,40 @@ type StorageC interface {
 // Client is the client object.
 type Client struct {
 	accessToken string
+	breaker     *breaker.Breaker
 	c           custom_storage.ClientService
 	hc          *http.Client
 	logger      logrus.FieldLogger
+	retryPolicy RetryPolicy
+	// fetchTimeout and putTimeout are set by WithTimeouts.
+	fetchTimeout time.Duration
+	putTimeout   time.Duration
+	// compressAbove and maxObjectSize are set by WithCompression.
+	compressAbove int
+	maxObjectSize int
+	// shardedFields and shardSize are set by WithSharding.
+	shardedFields map[string]string
+	shardSize     int
 }
 
 var _ StorageC = (*Client)(nil)
 
 // NewClient returns a new and initialized instance of a Client.
-func NewClient(c custom_storage.ClientService, hc *http.Client, accessToken string, logger logrus.FieldLogger) *Client {
-	return &Client{
-		accessToken: accessToken,
-		c:           c,
-		hc:          hc,
-		logger:      logger,
+func NewClient(c custom_storage.ClientService, hc *http.Client, accessToken string, logger logrus.FieldLogger, opts ...func(f *Client)) *Client {
+	f := &Client{
+		accessToken:  accessToken,
+		c:            c,
+		hc:           hc,
+		logger:       logger,
+		retryPolicy:  DefaultRetryPolicy,
+		fetchTimeout: DefaultFetchTimeout,
+		putTimeout:   DefaultPutTimeout,
+	}
+
+	for _, o := range opts {
+		o(f)
 	}
+	return f
 }
 
 func (f *Client) BulkFetch(ctx context.Context, req BulkFetchObjectsRequest) BulkFetchObjectsResponse {
@@ -103,7 +137,108 @@ func (f *Client) BulkFetch(ctx context.Context, req BulkFetchObjectsRequest) Bul
 	return results
 }
 
+func (f *Client) Count(ctx context.Context, req SearchObjectsRequest) (int, error) {
+	req.Limit = 1
+	req.Offset = 0
+	resp, err := f.Search(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+	return resp.Total, nil
+}
+
+func (f *Client) DeleteObject(ctx context.Context, req DeleteObjectRequest) error {
+	var chunkKeys, partKeys []string
+	sharded := f.shardedFields[req.Collection] != ""
+	if f.compressAbove > 0 || sharded {
+		raw, err := f.fetchRawObject(ctx, FetchObjectRequest{Collection: req.Collection, ObjectKey: req.ObjectKey})
+		if err == nil {
+			if chunkKeys, err = f.chainedChunkKeys(ctx, req.Collection, raw); err != nil {
+				return fmt.Errorf("failed to find chunks of object: %w", err)
+			}
+			if sharded {
+				data, err := f.decodeObject(ctx, req.Collection, raw)
+				if err != nil {
+					return fmt.Errorf("failed to find parts of object: %w", err)
+				}
+				partKeys = shardKeys(data)
+			}
+		}
+	}
+	if err := f.deleteRawObject(ctx, req.Collection, req.ObjectKey); err != nil {
+		return err
+	}
+	for _, k := range chunkKeys {
+		if err := f.deleteRawObject(ctx, req.Collection, k); err != nil && !errors.Is(err, NotFound) {
+			return fmt.Errorf("failed to delete chunk %s: %w", k, err)
+		}
+	}
+	for _, k := range partKeys {
+		if err := f.DeleteObject(ctx, DeleteObjectRequest{Collection: req.Collection, ObjectKey: k}); err != nil && !errors.Is(err, NotFound) {
+			return fmt.Errorf("failed to delete part %s: %w", k, err)
+		}
+	}
+	return nil
+}
+
+// deleteRawObject deletes a single stored object, without the chunks chained to it.
+func (f *Client) deleteRawObject(ctx context.Context, collection, objectKey string) error {
+	ctx, cancel := context.WithTimeout(ctx, f.putTimeout)
+	defer cancel()
+	params := custom_storage.DeleteObjectParams{
+		Context:        ctx,
+		CollectionName: collection,
+		ObjectKey:      objectKey,
+	}
+
+	f.logger.WithField("object_key", params.ObjectKey).
+		WithField("collection", params.CollectionName).
+		Printf("deleting")
+	var resp *custom_storage.DeleteObjectOK
+	err := f.call(ctx, func() error {
+		var err0 error
+		resp, err0 = f.c.DeleteObject(&params)
+		return err0
+	})
+	if resp != nil && resp.IsCode(http.StatusNotFound) {
+		return NotFound
+	}
+	// hack to get around limitation of the gofalcon client
+	if err != nil && strings.Contains(strings.ToLower(err.Error()), "status 404") {
+		return NotFound
+	}
+	if err != nil {
+		return err
+	}
+	if payload := resp.Payload; payload != nil && len(payload.Errors) > 0 {
+		return fmt.Errorf("errors returned from request: %s", joinMsaAPIErrors(payload.Errors))
+	}
+	return nil
+}
+
 func (f *Client) FetchObject(ctx context.Context, req FetchObjectRequest) (FetchObjectResponse, error) {
+	data, err := f.fetchRawObject(ctx, req)
+	if err != nil {
+		return FetchObjectResponse{}, err
+	}
+	if len(data) == 0 {
+		return FetchObjectResponse{}, nil
+	}
+	if data, err = f.decodeObject(ctx, req.Collection, data); err != nil {
+		return FetchObjectResponse{}, err
+	}
+	// the manifest of a sharded object holds the versions of its parts, so its version covers the parts
+	version := objectVersion(data)
+	if data, err = Reassemble(ctx, f, req.Collection, data); err != nil {
+		return FetchObjectResponse{}, err
+	}
+	return FetchObjectResponse{Data: data, Version: version}, nil
+}
+
+// fetchRawObject fetches an object as it is stored.
+func (f *Client) fetchRawObject(ctx context.Context, req FetchObjectRequest) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, f.fetchTimeout)
+	defer cancel()
 	params := custom_storage.GetObjectParams{
 		Context:        ctx,
 		CollectionName: req.Collection,
@@ -114,37 +249,116 @@ func (f *Client) FetchObject(ctx context.Context, req FetchObjectRequest) (Fetch
 		WithField("collection", params.CollectionName).
 		Printf("fetching")
 	buf := new(bytes.Buffer)
-	resp, err := f.c.GetObject(&params, buf)
+	var resp *custom_storage.GetObjectOK
+	err := f.call(ctx, func() error {
+		buf.Reset()
+		var err0 error
+		resp, err0 = f.c.GetObject(&params, buf)
+		return err0
+	})
 	if resp != nil && resp.IsCode(http.StatusNotFound) {
-		return FetchObjectResponse{}, NotFound
+		return nil, NotFound
 	}
 	// hack to get around limitation of the gofalcon client
 	if err != nil && strings.Contains(strings.ToLower(err.Error()), "status 404") {
-		return FetchObjectResponse{}, NotFound
+		return nil, NotFound
 	}
 	if err != nil {
-		return FetchObjectResponse{}, err
+		return nil, err
 	}
 
-	data, err := io.ReadAll(buf)
+	return io.ReadAll(buf)
+}
+
+func (f *Client) PutObject(ctx context.Context, req PutObjectRequest) (StoredObject, error) {
+	// prev is the stored revision of the object, as it is stored, if any, for its chunks to be pruned
+	var prev []byte
+	switch {
+	case req.IfVersion != "":
+		var err error
+		if prev, err = f.checkVersion(ctx, req); err != nil {
+			return StoredObject{}, err
+		}
+	case req.IfAbsent:
+		if err := f.checkAbsent(ctx, req); err != nil {
+			return StoredObject{}, err
+		}
+	case f.compressAbove > 0:
+		var err error
+		prev, err = f.fetchRawObject(ctx, FetchObjectRequest{Collection: req.Collection, ObjectKey: req.ObjectKey})
+		if err != nil && !errors.Is(err, NotFound) {
+			return StoredObject{}, fmt.Errorf("failed to fetch the stored revision of object: %s", err)
+		}
+	}
+
+	data, parts, err := f.shardObject(req.Collection, req.ObjectKey, req.Data)
 	if err != nil {
-		return FetchObjectResponse{}, err
+		return StoredObject{}, err
 	}
-	if len(data) == 0 {
-		return FetchObjectResponse{}, nil
+	// parts and chunks are put first so that the object never links to missing ones
+	for _, part := range parts {
+		if _, err := f.PutObject(ctx, part); err != nil {
+			return StoredObject{}, fmt.Errorf("failed to put part %s: %w", part.ObjectKey, err)
+		}
+	}
+	version := objectVersion(data)
+	data, chunks, err := f.encodeObject(req.ObjectKey, data)
+	if err != nil {
+		return StoredObject{}, err
+	}
+	for _, c := range chunks {
+		if _, err := f.putRawObject(ctx, req.Collection, c.key, c.data); err != nil {
+			return StoredObject{}, fmt.Errorf("failed to put chunk %s: %w", c.key, err)
+		}
+	}
+	so, err := f.putRawObject(ctx, req.Collection, req.ObjectKey, data)
+	if err != nil {
+		return StoredObject{}, err
+	}
+	if n := storedChunkCount(prev); n > len(chunks) {
+		f.pruneChunks(ctx, req.Collection, req.ObjectKey, len(chunks)+1, n)
 	}
-	return FetchObjectResponse{Data: data}, nil
+	if len(parts) > 0 {
+		f.pruneShards(ctx, req.Collection, req.ObjectKey, len(parts)+1)
+	}
+	so.Version = version
+	return so, nil
 }
 
-func (f *Client) PutObject(ctx context.Context, req PutObjectRequest) (StoredObject, error) {
-	reader := io.NopCloser(bytes.NewReader(req.Data))
+// pruneChunks deletes the chunks left over from an earlier, larger revision of an object, from the nth to the
+// last.  Failures are only logged, as the leftover chunks are no longer linked to the object.
+func (f *Client) pruneChunks(ctx context.Context, collection, objectKey string, n, last int) {
+	for ; n <= last; n++ {
+		err := f.deleteRawObject(ctx, collection, chunkKey(objectKey, n))
+		if errors.Is(err, NotFound) {
+			return
+		}
+		if err != nil {
+			f.logger.WithField("object_key", objectKey).
+				WithField("collection", collection).
+				Warnf("failed to delete leftover chunk %d: %s", n, err)
+			return
+		}
+	}
+}
+
+// putRawObject puts an object as it is to be stored.
+func (f *Client) putRawObject(ctx context.Context, collection, objectKey string, data []byte) (StoredObject, error) {
+	ctx, cancel := context.WithTimeout(ctx, f.putTimeout)
+	defer cancel()
 	params := custom_storage.PutObjectParams{
 		Context:        ctx,
-		CollectionName: req.Collection,
-		ObjectKey:      req.ObjectKey,
-		Body:           reader,
-	}
-	resp, err := f.c.PutObject(&params)
+		CollectionName: collection,
+		ObjectKey:      objectKey,
+	}
+	var resp *custom_storage.PutObjectOK
+	err := f.call(ctx, func() error {
+		// the body is consumed by every attempt
+		params.Body = io.NopCloser(bytes.NewReader(data))
+		var err0 error
+		resp, err0 = f.c.PutObject(&params)
+		return err0
+	})
 	if err != nil {
 		return StoredObject{}, err
 	}
@@ -170,17 +384,74 @@ func (f *Client) PutObject(ctx context.Context, req PutObjectRequest) (StoredObj
 		Collection:    asString(res[0].CollectionName),
 		ObjectKey:     asString(res[0].ObjectKey),
 		SchemaVersion: asString(res[0].SchemaVersion),
+		Version:       objectVersion(data),
 	}, nil
 }
 
+// checkVersion returns VersionConflict if the stored object no longer matches the expected version, and the
+// object as it is stored otherwise.  The custom storage API does not support conditional writes, so this narrows
+// the window in which concurrent writers can overwrite each other rather than closing it entirely.
+func (f *Client) checkVersion(ctx context.Context, req PutObjectRequest) ([]byte, error) {
+	raw, err := f.fetchRawObject(ctx, FetchObjectRequest{
+		Collection: req.Collection,
+		ObjectKey:  req.ObjectKey,
+	})
+	if errors.Is(err, NotFound) {
+		return nil, VersionConflict
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch current version of object: %s", err)
+	}
+	// the version of a sharded object is that of its manifest, see FetchObject
+	data, err := f.decodeObject(ctx, req.Collection, raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch current version of object: %s", err)
+	}
+	if version := objectVersion(data); version != req.IfVersion {
+		f.logger.WithField("object_key", req.ObjectKey).
+			WithField("collection", req.Collection).
+			WithField("expected_version", req.IfVersion).
+			WithField("current_version", version).
+			Info("object version conflict")
+		return nil, VersionConflict
+	}
+	return raw, nil
+}
+
+// checkAbsent returns VersionConflict if an object is already stored under the key of the object to put, like
+// checkVersion narrowing rather than closing the window in which concurrent writers can overwrite each other.
+func (f *Client) checkAbsent(ctx context.Context, req PutObjectRequest) error {
+	_, err := f.fetchRawObject(ctx, FetchObjectRequest{
+		Collection: req.Collection,
+		ObjectKey:  req.ObjectKey,
+	})
+	if errors.Is(err, NotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check for an existing object: %s", err)
+	}
+	f.logger.WithField("object_key", req.ObjectKey).
+		WithField("collection", req.Collection).
+		Info("object already exists")
+	return VersionConflict
+}
+
 func (f *Client) FetchKeys(ctx context.Context, req FetchKeysRequest) (FetchKeysResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, f.fetchTimeout)
+	defer cancel()
 	params := custom_storage.ListObjectsParams{
 		Context:        ctx,
 		CollectionName: req.Collection,
 		Limit:          int64(req.Limit),
 		Start:          req.StartKey,
 	}
-	resp, err := f.c.ListObjects(&params)
+	var resp *custom_storage.ListObjectsOK
+	err := f.call(ctx, func() error {
+		var err0 error
+		resp, err0 = f.c.ListObjects(&params)
+		return err0
+	})
 	if err != nil {
 		return FetchKeysResponse{}, err
 	}
@@ -205,7 +476,9 @@ func (f *Client) FetchKeys(ctx context.Context, req FetchKeysRequest) (FetchKeys
 }
 
 func (f *Client) Search(ctx context.Context, req SearchObjectsRequest) (SearchObjectsResponse, error) {
-	limit := 100
+	ctx, cancel := context.WithTimeout(ctx, f.fetchTimeout)
+	defer cancel()
+	limit := defaultSearchLimit
 	if req.Limit > 0 {
 		limit = req.Limit
 	}
@@ -213,9 +486,9 @@ func (f *Client) Search(ctx context.Context, req SearchObjectsRequest) (SearchOb
 	if req.Sort != "" {
 		sort = &req.Sort
 	}
-	offset := 0
-	if req.Offset > 0 {
-		offset = req.Offset
+	offset, err := searchOffset(req)
+	if err != nil {
+		return SearchObjectsResponse{}, err
 	}
 	params := custom_storage.SearchObjectsParams{
 		CollectionName: req.Collection,
@@ -225,7 +498,12 @@ func (f *Client) Search(ctx context.Context, req SearchObjectsRequest) (SearchOb
 		Offset:         int64(offset),
 		Sort:           sort,
 	}
-	resp, err := f.c.SearchObjects(&params)
+	var resp *custom_storage.SearchObjectsOK
+	err = f.call(ctx, func() error {
+		var err0 error
+		resp, err0 = f.c.SearchObjects(&params)
+		return err0
+	})
 	if err != nil {
 		return SearchObjectsResponse{}, err
 	}
@@ -255,9 +533,71 @@ func (f *Client) Search(ctx context.Context, req SearchObjectsRequest) (SearchOb
 	for i, r := range res {
 		sor.ObjectKeys[i] = asString(r.ObjectKey)
 	}
+	// the API reports an offset of zero once there are no more pages
+	if sor.Offset > offset && sor.Offset < sor.Total {
+		sor.NextToken = nextToken(sor.Offset)
+	}
 	return sor, nil
 }
 
+func (f *Client) SearchAll(ctx context.Context, req SearchObjectsRequest) (SearchObjectsResponse, error) {
+	all := SearchObjectsResponse{ObjectKeys: make([]string, 0)}
+	start, err := searchOffset(req)
+	if err != nil {
+		return all, err
+	}
+	if req.Limit <= 0 && req.MaxResults > 0 {
+		req.Limit = min(req.MaxResults, defaultSearchLimit)
+	}
+	for {
+		page, err := f.Search(ctx, req)
+		if err != nil {
+			return all, err
+		}
+		all.ObjectKeys = append(all.ObjectKeys, page.ObjectKeys...)
+		all.Total = page.Total
+
+		if req.MaxResults > 0 && len(all.ObjectKeys) >= req.MaxResults {
+			all.ObjectKeys = all.ObjectKeys[:req.MaxResults]
+			if end := start + req.MaxResults; end < all.Total {
+				all.NextToken = nextToken(end)
+			}
+			return all, nil
+		}
+		if len(page.ObjectKeys) == 0 || page.NextToken == "" {
+			return all, nil
+		}
+		req.NextToken = page.NextToken
+	}
+}
+
+// defaultSearchLimit is the size of the pages searched when the request sets no limit.
+const defaultSearchLimit = 100
+
+// nextTokenPrefix prefixes the offset encoded in the tokens of the next pages of searches.
+const nextTokenPrefix = "offset:"
+
+// nextToken returns the token of the page of search results starting at offset.  Tokens are opaque to callers,
+// so that they do not depend on the paging of the custom storage API.
+func nextToken(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(nextTokenPrefix + strconv.Itoa(offset)))
+}
+
+// searchOffset returns the offset of the page of results requested, by its NextToken or Offset.
+func searchOffset(req SearchObjectsRequest) (int, error) {
+	if req.NextToken == "" {
+		return max(req.Offset, 0), nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(req.NextToken)
+	if err == nil && strings.HasPrefix(string(b), nextTokenPrefix) {
+		var offset int
+		if offset, err = strconv.Atoi(strings.TrimPrefix(string(b), nextTokenPrefix)); err == nil && offset >= 0 {
+			return offset, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid next token %q", req.NextToken)
+}
+
 func (f *Client) SearchAndFetch(ctx context.Context, req SearchObjectsRequest) (SearchAndFetchResponse, error) {
 	searchResp, err := f.Search(ctx, req)
 	if err != nil {
@@ -318,6 +658,15 @@ func joinMsaAPIErrors(errs []*models.MsaAPIError) error {
 	return errors.New(sb.String())
 }
 
+// objectVersion computes the version of an object from its content.
+func objectVersion(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
 func asString(s *string) string {
 	if s == nil {
 		return ""
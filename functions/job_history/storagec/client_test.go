@@ -0,0 +1,50 @@
+package storagec
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestNextToken(t *testing.T) {
+	for _, offset := range []int{0, 1, 100, 123456} {
+		got, err := searchOffset(SearchObjectsRequest{NextToken: nextToken(offset), Offset: 7})
+		if err != nil {
+			t.Fatalf("searchOffset(nextToken(%d)) error = %v", offset, err)
+		}
+		if got != offset {
+			t.Errorf("searchOffset(nextToken(%d)) = %d", offset, got)
+		}
+	}
+}
+
+func TestSearchOffset(t *testing.T) {
+	token := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+	tests := []struct {
+		name    string
+		req     SearchObjectsRequest
+		want    int
+		wantErr bool
+	}{
+		{name: "first page"},
+		{name: "offset", req: SearchObjectsRequest{Offset: 50}, want: 50},
+		{name: "negative offset", req: SearchObjectsRequest{Offset: -1}},
+		{name: "next token", req: SearchObjectsRequest{NextToken: token("offset:200")}, want: 200},
+		{name: "not base64", req: SearchObjectsRequest{NextToken: "offset:200"}, wantErr: true},
+		{name: "unknown prefix", req: SearchObjectsRequest{NextToken: token("page:2")}, wantErr: true},
+		{name: "not a number", req: SearchObjectsRequest{NextToken: token("offset:ten")}, wantErr: true},
+		{name: "negative token", req: SearchObjectsRequest{NextToken: token("offset:-5")}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := searchOffset(tt.req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("searchOffset() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("searchOffset() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
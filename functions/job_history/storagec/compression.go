@@ -0,0 +1,241 @@
+package storagec
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+)
+
+// Fields of the envelope of compressed objects and of the chunks chained to them.
+const (
+	// contentEncodingField marks an object whose content is compressed, holding the name of the encoding.
+	contentEncodingField = "_content_encoding"
+	// compressedField holds the base64 encoded compressed content, or its first part if it was chained.
+	compressedField = "_compressed"
+	// nextChunkField holds the key of the next chunk of the compressed content, if any.
+	nextChunkField = "_next"
+	// chunkField holds a part of the compressed content in a chained chunk.
+	chunkField = "_chunk"
+	// chunksField holds the number of chunks chained to a compressed object, if any.
+	chunksField = "_chunks"
+
+	encodingGzip = "gzip"
+	// maxIndexedFieldSize is the size of the largest top level field copied into the envelope of compressed
+	// objects, so that they can still be searched by it.
+	maxIndexedFieldSize = 1024
+	// envelopeOverhead is reserved for the fields of the envelope and of chunks besides the compressed content.
+	envelopeOverhead = 256
+)
+
+// maxChunks bounds the length of chains of chunks, so that a corrupt chain is not followed forever.
+const maxChunks = 1000
+
+// WithCompression makes the client transparently gzip objects larger than threshold bytes when putting them, and
+// decompress them when fetching them.  Compressed content which would still make an object larger than
+// maxObjectSize bytes is split over a chain of chunk objects in the same collection.
+//
+// Compressed objects keep their small top level fields uncompressed, so that they remain searchable.
+func WithCompression(threshold, maxObjectSize int) func(f *Client) {
+	return func(f *Client) {
+		f.compressAbove = threshold
+		f.maxObjectSize = maxObjectSize
+	}
+}
+
+// storedChunk is a chunk of compressed content to be put alongside its object.
+type storedChunk struct {
+	key  string
+	data []byte
+}
+
+// chunkKey returns the key of the nth chunk chained to an object.
+func chunkKey(objectKey string, n int) string {
+	return fmt.Sprintf("%s_chunk_%d", objectKey, n)
+}
+
+// encodeObject returns the data to store for an object and the chunks chained to it.  Objects which are not
+// larger than the compression threshold, or are not JSON objects, are stored as they are.
+func (f *Client) encodeObject(objectKey string, data []byte) ([]byte, []storedChunk, error) {
+	if f.compressAbove <= 0 || len(data) <= f.compressAbove {
+		return data, nil, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return data, nil, nil
+	}
+
+	envelope := make(map[string]any, len(fields)+3)
+	for k, v := range fields {
+		if len(v) <= maxIndexedFieldSize {
+			envelope[k] = v
+		}
+	}
+	envelope[contentEncodingField] = encodingGzip
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, nil, fmt.Errorf("failed to compress object: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, nil, fmt.Errorf("failed to compress object: %s", err)
+	}
+	content := base64.StdEncoding.EncodeToString(buf.Bytes())
+
+	head, err := json.Marshal(envelope)
+	if err != nil {
+		return nil, nil, err
+	}
+	var parts []string
+	if f.maxObjectSize > 0 {
+		first := f.maxObjectSize - len(head) - envelopeOverhead
+		size := f.maxObjectSize - envelopeOverhead
+		if first <= 0 {
+			return nil, nil, errors.New("object fields exceed the maximum object size")
+		}
+		if len(content) > first {
+			rest := content[first:]
+			content = content[:first]
+			for len(rest) > 0 {
+				n := min(size, len(rest))
+				parts, rest = append(parts, rest[:n]), rest[n:]
+			}
+		}
+	}
+	if len(parts) > maxChunks {
+		return nil, nil, fmt.Errorf("object needs %d chunks, more than the maximum of %d", len(parts), maxChunks)
+	}
+
+	envelope[compressedField] = content
+	if len(parts) > 0 {
+		envelope[nextChunkField] = chunkKey(objectKey, 1)
+		envelope[chunksField] = len(parts)
+	}
+	chunks := make([]storedChunk, len(parts))
+	for i, part := range parts {
+		c := map[string]string{chunkField: part}
+		if i+1 < len(parts) {
+			c[nextChunkField] = chunkKey(objectKey, i+2)
+		}
+		b, err := json.Marshal(c)
+		if err != nil {
+			return nil, nil, err
+		}
+		chunks[i] = storedChunk{key: chunkKey(objectKey, i+1), data: b}
+	}
+
+	b, err := json.Marshal(envelope)
+	if err != nil {
+		return nil, nil, err
+	}
+	return b, chunks, nil
+}
+
+// storedEnvelope holds the top level fields of the envelope of a compressed object, or of a chunk chained to it.
+type storedEnvelope struct {
+	Chunk           string `json:"_chunk"`
+	Chunks          int    `json:"_chunks"`
+	Compressed      string `json:"_compressed"`
+	ContentEncoding string `json:"_content_encoding"`
+	Next            string `json:"_next"`
+}
+
+// readEnvelope returns stored data decoded from the base64 encoding storage may return it in, and the envelope
+// fields at its top level.  ok is false if the data is not a JSON object, in which case it is returned as it is.
+func readEnvelope(data []byte) ([]byte, storedEnvelope, bool) {
+	decoded, err := pkg.DecodeBase64JSON(data)
+	if err != nil {
+		return data, storedEnvelope{}, false
+	}
+	var e storedEnvelope
+	if err := json.Unmarshal(decoded, &e); err != nil {
+		return data, storedEnvelope{}, false
+	}
+	return decoded, e, true
+}
+
+// storedChunkCount returns the number of chunks chained to an object as it is stored.  Objects compressed before
+// the count was recorded in their envelope may have up to maxChunks.
+func storedChunkCount(data []byte) int {
+	_, e, ok := readEnvelope(data)
+	switch {
+	case !ok || e.ContentEncoding == "" || e.Next == "":
+		return 0
+	case e.Chunks > 0:
+		return e.Chunks
+	default:
+		return maxChunks
+	}
+}
+
+// decodeObject returns the content of a stored object, fetching the chunks chained to it.  The data of objects
+// which are not compressed is returned decoded from the base64 encoding storage may return it in.
+func (f *Client) decodeObject(ctx context.Context, collection string, data []byte) ([]byte, error) {
+	data, envelope, ok := readEnvelope(data)
+	if !ok || envelope.ContentEncoding == "" {
+		return data, nil
+	}
+	if envelope.ContentEncoding != encodingGzip {
+		return nil, fmt.Errorf("unsupported content encoding: %q", envelope.ContentEncoding)
+	}
+
+	var content bytes.Buffer
+	content.WriteString(envelope.Compressed)
+	next := envelope.Next
+	for n := 0; next != ""; n++ {
+		if n >= maxChunks {
+			return nil, fmt.Errorf("object has more than %d chunks", maxChunks)
+		}
+		raw, err := f.fetchRawObject(ctx, FetchObjectRequest{Collection: collection, ObjectKey: next})
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch chunk %s: %w", next, err)
+		}
+		_, chunk, ok := readEnvelope(raw)
+		if !ok {
+			return nil, fmt.Errorf("failed to decode chunk %s", next)
+		}
+		content.WriteString(chunk.Chunk)
+		next = chunk.Next
+	}
+
+	zr, err := gzip.NewReader(base64.NewDecoder(base64.StdEncoding, &content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress object: %s", err)
+	}
+	defer zr.Close()
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress object: %s", err)
+	}
+	return b, nil
+}
+
+// chainedChunkKeys returns the keys of the chunks chained to a stored object.
+func (f *Client) chainedChunkKeys(ctx context.Context, collection string, data []byte) ([]string, error) {
+	keys := make([]string, 0)
+	_, links, ok := readEnvelope(data)
+	if !ok || links.ContentEncoding == "" {
+		return keys, nil
+	}
+	for len(keys) < maxChunks && links.Next != "" {
+		keys = append(keys, links.Next)
+		raw, err := f.fetchRawObject(ctx, FetchObjectRequest{Collection: collection, ObjectKey: links.Next})
+		if errors.Is(err, NotFound) {
+			return keys, nil
+		}
+		if err != nil {
+			return keys, err
+		}
+		if _, links, ok = readEnvelope(raw); !ok {
+			return keys, nil
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,202 @@
+package storagec
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// testObject returns a JSON object with a small id field and an output field of n characters, which compress
+// poorly unless repeated is true.
+func testObject(t *testing.T, n int, repeated bool) []byte {
+	t.Helper()
+	output := strings.Repeat("x", n)
+	if !repeated {
+		b := make([]byte, n/2)
+		rand.New(rand.NewSource(1)).Read(b)
+		output = hex.EncodeToString(b)
+	}
+	data, err := json.Marshal(map[string]string{"id": "1", "output": output})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// unchain returns the envelope of a compressed object with the content of its chunks joined back into it, checking
+// that the chunks are chained in order.
+func unchain(t *testing.T, data []byte, chunks []storedChunk) []byte {
+	t.Helper()
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatalf("failed to decode envelope: %v", err)
+	}
+	content, _ := fields[compressedField].(string)
+	next, _ := fields[nextChunkField].(string)
+	for i, c := range chunks {
+		if c.key != next || c.key != chunkKey("obj", i+1) {
+			t.Fatalf("chunk %d has key %s, want %s linked from the previous chunk %s", i+1, c.key, chunkKey("obj", i+1), next)
+		}
+		_, e, ok := readEnvelope(c.data)
+		if !ok {
+			t.Fatalf("failed to decode chunk %s", c.key)
+		}
+		content += e.Chunk
+		next = e.Next
+	}
+	if next != "" {
+		t.Fatalf("last chunk links to %s", next)
+	}
+	fields[compressedField] = content
+	delete(fields, nextChunkField)
+	delete(fields, chunksField)
+	b, err := json.Marshal(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestCompressionRoundTrip(t *testing.T) {
+	tests := []struct {
+		name          string
+		c             *Client
+		data          []byte
+		stored64      bool
+		wantEncoded   bool
+		wantChunked   bool
+		wantEncodeErr bool
+	}{
+		{
+			name: "compression disabled",
+			c:    &Client{},
+			data: testObject(t, 4000, true),
+		},
+		{
+			name: "below threshold",
+			c:    &Client{compressAbove: 8192},
+			data: testObject(t, 4000, true),
+		},
+		{
+			name: "not an object",
+			c:    &Client{compressAbove: 64},
+			data: []byte(`["` + strings.Repeat("x", 4000) + `"]`),
+		},
+		{
+			name:        "compressed",
+			c:           &Client{compressAbove: 64, maxObjectSize: 4096},
+			data:        testObject(t, 4000, true),
+			wantEncoded: true,
+		},
+		{
+			name:        "stored base64 encoded",
+			c:           &Client{compressAbove: 64},
+			data:        testObject(t, 4000, true),
+			stored64:    true,
+			wantEncoded: true,
+		},
+		{
+			name:        "chunked",
+			c:           &Client{compressAbove: 64, maxObjectSize: 2048},
+			data:        testObject(t, 12000, false),
+			wantEncoded: true,
+			wantChunked: true,
+		},
+		{
+			name:          "fields larger than an object",
+			c:             &Client{compressAbove: 64, maxObjectSize: 200},
+			data:          testObject(t, 4000, true),
+			wantEncodeErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored, chunks, err := tt.c.encodeObject("obj", tt.data)
+			if (err != nil) != tt.wantEncodeErr {
+				t.Fatalf("encodeObject() error = %v, wantErr %v", err, tt.wantEncodeErr)
+			}
+			if err != nil {
+				return
+			}
+
+			_, e, _ := readEnvelope(stored)
+			if encoded := e.ContentEncoding == encodingGzip; encoded != tt.wantEncoded {
+				t.Fatalf("encodeObject() encoded = %t, want %t", encoded, tt.wantEncoded)
+			}
+			if !tt.wantEncoded && !bytes.Equal(stored, tt.data) {
+				t.Errorf("encodeObject() = %s, want the object unchanged", stored)
+			}
+			if tt.wantEncoded {
+				var fields map[string]json.RawMessage
+				if err := json.Unmarshal(stored, &fields); err != nil {
+					t.Fatal(err)
+				}
+				if _, ok := fields["id"]; !ok {
+					t.Error("encodeObject() did not keep the small id field indexable")
+				}
+				if _, ok := fields["output"]; ok {
+					t.Error("encodeObject() kept the large output field uncompressed")
+				}
+			}
+			if chunked := len(chunks) > 0; chunked != tt.wantChunked {
+				t.Fatalf("encodeObject() returned %d chunks, want chunked %t", len(chunks), tt.wantChunked)
+			}
+			if n := storedChunkCount(stored); n != len(chunks) || e.Chunks != len(chunks) {
+				t.Errorf("stored chunk count = %d, envelope count = %d, want %d", n, e.Chunks, len(chunks))
+			}
+			if limit := tt.c.maxObjectSize; limit > 0 {
+				for _, d := range append([]storedChunk{{key: "obj", data: stored}}, chunks...) {
+					if len(d.data) > limit {
+						t.Errorf("%s is %d bytes, larger than the maximum of %d", d.key, len(d.data), limit)
+					}
+				}
+			}
+
+			if len(chunks) > 0 {
+				stored = unchain(t, stored, chunks)
+			}
+			if tt.stored64 {
+				stored = []byte(base64.StdEncoding.EncodeToString(stored))
+			}
+			got, err := tt.c.decodeObject(context.Background(), "c", stored)
+			if err != nil {
+				t.Fatalf("decodeObject() error = %v", err)
+			}
+			if !bytes.Equal(got, tt.data) {
+				t.Errorf("decodeObject() = %.80s, want %.80s", got, tt.data)
+			}
+		})
+	}
+}
+
+func TestStoredChunkCount(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want int
+	}{
+		{name: "not stored"},
+		{name: "not an object", data: `["a"]`},
+		{name: "not compressed", data: `{"id":"1","_next":"obj_chunk_1"}`},
+		{name: "not chunked", data: `{"_content_encoding":"gzip","_compressed":"H4sI"}`},
+		{name: "chunked", data: `{"_content_encoding":"gzip","_next":"obj_chunk_1","_chunks":3}`, want: 3},
+		{name: "chunked before counting", data: `{"_content_encoding":"gzip","_next":"obj_chunk_1"}`, want: maxChunks},
+		{
+			name: "base64 encoded",
+			data: base64.StdEncoding.EncodeToString([]byte(`{"_content_encoding":"gzip","_next":"obj_chunk_1","_chunks":2}`)),
+			want: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := storedChunkCount([]byte(tt.data)); got != tt.want {
+				t.Errorf("storedChunkCount() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package storagec
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/metrics"
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/tracing"
+)
+
+// InstrumentedClient is a StorageC which records the latency and outcome of every call it delegates, and traces
+// them as spans named after the operation.
+type InstrumentedClient struct {
+	c      StorageC
+	r      *metrics.Registry
+	tracer tracing.Tracer
+}
+
+var _ StorageC = (*InstrumentedClient)(nil)
+
+// NewInstrumentedClient wraps c, recording metrics into r.
+func NewInstrumentedClient(c StorageC, r *metrics.Registry, opts ...func(i *InstrumentedClient)) *InstrumentedClient {
+	i := &InstrumentedClient{c: c, r: r, tracer: tracing.Noop}
+	for _, o := range opts {
+		o(i)
+	}
+	return i
+}
+
+// WithTracer traces every call of the InstrumentedClient with t.
+func WithTracer(t tracing.Tracer) func(i *InstrumentedClient) {
+	return func(i *InstrumentedClient) {
+		i.tracer = t
+	}
+}
+
+func (i *InstrumentedClient) BulkFetch(ctx context.Context, req BulkFetchObjectsRequest) BulkFetchObjectsResponse {
+	ctx, span := i.tracer.Start(ctx, "storage.bulk_fetch", tracing.Attributes{"collection": req.Collection, "objects": len(req.ObjectKeys)})
+	start := time.Now()
+	resp := i.c.BulkFetch(ctx, req)
+	var err error
+	if len(resp.Errs) > 0 {
+		err = errors.New("bulk fetch errors")
+	}
+	i.observe("bulk_fetch", start, err)
+	span.End(err)
+	return resp
+}
+
+func (i *InstrumentedClient) Count(ctx context.Context, req SearchObjectsRequest) (int, error) {
+	ctx, span := i.tracer.Start(ctx, "storage.count", tracing.Attributes{"collection": req.Collection})
+	start := time.Now()
+	n, err := i.c.Count(ctx, req)
+	i.observe("count", start, err)
+	span.End(err)
+	return n, err
+}
+
+func (i *InstrumentedClient) DeleteObject(ctx context.Context, req DeleteObjectRequest) error {
+	ctx, span := i.tracer.Start(ctx, "storage.delete_object", tracing.Attributes{"collection": req.Collection, "object_key": req.ObjectKey})
+	start := time.Now()
+	err := i.c.DeleteObject(ctx, req)
+	i.observe("delete_object", start, err)
+	span.End(err)
+	return err
+}
+
+func (i *InstrumentedClient) FetchKeys(ctx context.Context, req FetchKeysRequest) (FetchKeysResponse, error) {
+	ctx, span := i.tracer.Start(ctx, "storage.fetch_keys", tracing.Attributes{"collection": req.Collection})
+	start := time.Now()
+	resp, err := i.c.FetchKeys(ctx, req)
+	i.observe("fetch_keys", start, err)
+	span.End(err)
+	return resp, err
+}
+
+func (i *InstrumentedClient) FetchObject(ctx context.Context, req FetchObjectRequest) (FetchObjectResponse, error) {
+	ctx, span := i.tracer.Start(ctx, "storage.fetch_object", tracing.Attributes{"collection": req.Collection, "object_key": req.ObjectKey})
+	start := time.Now()
+	resp, err := i.c.FetchObject(ctx, req)
+	i.observe("fetch_object", start, err)
+	span.End(err)
+	return resp, err
+}
+
+func (i *InstrumentedClient) PutObject(ctx context.Context, req PutObjectRequest) (StoredObject, error) {
+	ctx, span := i.tracer.Start(ctx, "storage.put_object", tracing.Attributes{"collection": req.Collection, "object_key": req.ObjectKey})
+	start := time.Now()
+	resp, err := i.c.PutObject(ctx, req)
+	i.observe("put_object", start, err)
+	span.End(err)
+	return resp, err
+}
+
+func (i *InstrumentedClient) Search(ctx context.Context, req SearchObjectsRequest) (SearchObjectsResponse, error) {
+	ctx, span := i.tracer.Start(ctx, "storage.search", tracing.Attributes{"collection": req.Collection})
+	start := time.Now()
+	resp, err := i.c.Search(ctx, req)
+	i.observe("search", start, err)
+	span.End(err)
+	return resp, err
+}
+
+func (i *InstrumentedClient) SearchAll(ctx context.Context, req SearchObjectsRequest) (SearchObjectsResponse, error) {
+	ctx, span := i.tracer.Start(ctx, "storage.search_all", tracing.Attributes{"collection": req.Collection})
+	start := time.Now()
+	resp, err := i.c.SearchAll(ctx, req)
+	i.observe("search_all", start, err)
+	span.End(err)
+	return resp, err
+}
+
+func (i *InstrumentedClient) SearchAndFetch(ctx context.Context, req SearchObjectsRequest) (SearchAndFetchResponse, error) {
+	ctx, span := i.tracer.Start(ctx, "storage.search_and_fetch", tracing.Attributes{"collection": req.Collection})
+	start := time.Now()
+	resp, err := i.c.SearchAndFetch(ctx, req)
+	i.observe("search_and_fetch", start, err)
+	span.End(err)
+	return resp, err
+}
+
+func (i *InstrumentedClient) observe(op string, start time.Time, err error) {
+	outcome := metrics.Outcome(err)
+	switch {
+	case errors.Is(err, NotFound):
+		outcome = "not_found"
+	case errors.Is(err, VersionConflict):
+		outcome = "version_conflict"
+	case errors.Is(err, Unavailable):
+		outcome = "unavailable"
+	}
+	i.r.Since("storage_latency_seconds", metrics.Labels{"op": op}, start)
+	i.r.Inc("storage_requests_total", metrics.Labels{"op": op, "outcome": outcome})
+}
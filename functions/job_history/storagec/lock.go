@@ -0,0 +1,133 @@
+package storagec
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+)
+
+// Locked is a dedicated error indicating that a lock is held by another owner.
+var Locked = errors.New("locked")
+
+// Lease is a held lock.  It expires at ExpiresAt even if it is not unlocked, so that a lock held by an invocation
+// which died is eventually taken by another.
+type Lease struct {
+	// ExpiresAt is the time the lease expires.
+	ExpiresAt string `json:"expires_at"`
+	// Name is the name of the lock.
+	Name string `json:"name"`
+	// Owner identifies the holder of the lock.
+	Owner string `json:"owner"`
+}
+
+// Locker takes named locks stored as the objects of a custom storage collection, so that only one of the
+// invocations of the function running concurrently performs a task.  Locks are taken with conditional puts.
+type Locker struct {
+	clock      pkg.Clock
+	collection string
+	strgc      StorageC
+}
+
+// NewLocker returns a Locker storing its locks in the given collection.
+func NewLocker(strgc StorageC, collection string, opts ...func(l *Locker)) *Locker {
+	l := &Locker{
+		clock:      pkg.SystemClock,
+		collection: collection,
+		strgc:      strgc,
+	}
+	for _, o := range opts {
+		o(l)
+	}
+	return l
+}
+
+// WithLockClock sets the clock of the Locker.
+func WithLockClock(c pkg.Clock) func(l *Locker) {
+	return func(l *Locker) {
+		l.clock = c
+	}
+}
+
+// Lock takes the named lock for owner until the lease expires after ttl, returning Locked if another owner holds
+// an unexpired lease of the lock.  Owners may take a lock they hold again, extending their lease.
+func (l *Locker) Lock(ctx context.Context, name, owner string, ttl time.Duration) (Lease, error) {
+	now := l.clock.Now()
+	req := PutObjectRequest{Collection: l.collection, ObjectKey: name}
+	cur, err := l.strgc.FetchObject(ctx, FetchObjectRequest{Collection: l.collection, ObjectKey: name})
+	switch {
+	case errors.Is(err, NotFound):
+		req.IfAbsent = true
+	case err != nil:
+		return Lease{}, fmt.Errorf("failed to fetch lock %s: %w", name, err)
+	default:
+		var held Lease
+		data, err := pkg.DecodeBase64JSON(cur.Data)
+		if err == nil {
+			err = json.Unmarshal(data, &held)
+		}
+		if err != nil {
+			return Lease{}, fmt.Errorf("failed to deserialize lock %s: %s", name, err)
+		}
+		if held.Owner != owner && held.ExpiresAt > now.Format(pkg.ISOTimeFormat) {
+			return Lease{}, Locked
+		}
+		req.IfVersion = cur.Version
+	}
+
+	lease := Lease{ExpiresAt: now.Add(ttl).Format(pkg.ISOTimeFormat), Name: name, Owner: owner}
+	if req.Data, err = json.Marshal(lease); err != nil {
+		return Lease{}, fmt.Errorf("failed to serialize lock %s: %s", name, err)
+	}
+	_, err = l.strgc.PutObject(ctx, req)
+	if errors.Is(err, VersionConflict) {
+		return Lease{}, Locked
+	}
+	if err != nil {
+		return Lease{}, fmt.Errorf("failed to put lock %s: %w", name, err)
+	}
+	return lease, nil
+}
+
+// Unlock releases a lease before it expires.  Leases which expired and were taken by another owner are left in
+// place.
+func (l *Locker) Unlock(ctx context.Context, lease Lease) error {
+	cur, err := l.strgc.FetchObject(ctx, FetchObjectRequest{Collection: l.collection, ObjectKey: lease.Name})
+	if errors.Is(err, NotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch lock %s: %w", lease.Name, err)
+	}
+	var held Lease
+	data, err := pkg.DecodeBase64JSON(cur.Data)
+	if err == nil {
+		err = json.Unmarshal(data, &held)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to deserialize lock %s: %s", lease.Name, err)
+	}
+	if held.Owner != lease.Owner {
+		return nil
+	}
+
+	// the lock object is kept, expired, so that the next owner takes it with a conditional put
+	held.ExpiresAt = l.clock.Now().Format(pkg.ISOTimeFormat)
+	data, err = json.Marshal(held)
+	if err != nil {
+		return fmt.Errorf("failed to serialize lock %s: %s", lease.Name, err)
+	}
+	_, err = l.strgc.PutObject(ctx, PutObjectRequest{
+		Collection: l.collection,
+		Data:       data,
+		IfVersion:  cur.Version,
+		ObjectKey:  lease.Name,
+	})
+	if err != nil && !errors.Is(err, VersionConflict) {
+		return fmt.Errorf("failed to release lock %s: %w", lease.Name, err)
+	}
+	return nil
+}
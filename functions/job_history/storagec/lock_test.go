@@ -0,0 +1,116 @@
+package storagec
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+)
+
+func TestLockerLock(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		held       *Lease
+		owner      string
+		wantErr    error
+		wantExpiry string
+	}{
+		{name: "free", owner: "a", wantExpiry: "2024-01-01T12:05:00Z"},
+		{
+			name:    "held by another owner",
+			held:    &Lease{ExpiresAt: "2024-01-01T12:01:00Z", Name: "task", Owner: "b"},
+			owner:   "a",
+			wantErr: Locked,
+		},
+		{
+			name:       "expired lease of another owner",
+			held:       &Lease{ExpiresAt: "2024-01-01T11:59:00Z", Name: "task", Owner: "b"},
+			owner:      "a",
+			wantExpiry: "2024-01-01T12:05:00Z",
+		},
+		{
+			name:       "held by the owner",
+			held:       &Lease{ExpiresAt: "2024-01-01T12:01:00Z", Name: "task", Owner: "a"},
+			owner:      "a",
+			wantExpiry: "2024-01-01T12:05:00Z",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := newMemStorage()
+			if tt.held != nil {
+				data, err := json.Marshal(tt.held)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := s.PutObject(ctx, PutObjectRequest{Collection: "locks", ObjectKey: "task", Data: data}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			l := NewLocker(s, "locks", WithLockClock(pkg.ClockFunc(func() time.Time { return now })))
+
+			lease, err := l.Lock(ctx, "task", tt.owner, 5*time.Minute)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Lock() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			want := Lease{ExpiresAt: tt.wantExpiry, Name: "task", Owner: tt.owner}
+			if lease != want {
+				t.Errorf("Lock() = %+v, want %+v", lease, want)
+			}
+			var stored Lease
+			if err := json.Unmarshal(s.objects["locks"]["task"], &stored); err != nil {
+				t.Fatal(err)
+			}
+			if stored != want {
+				t.Errorf("stored lease = %+v, want %+v", stored, want)
+			}
+		})
+	}
+}
+
+func TestLockerUnlock(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		unlockOwner  string
+		wantReleased bool
+	}{
+		{name: "owner", unlockOwner: "a", wantReleased: true},
+		{name: "another owner", unlockOwner: "b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := newMemStorage()
+			l := NewLocker(s, "locks", WithLockClock(pkg.ClockFunc(func() time.Time { return now })))
+			lease, err := l.Lock(ctx, "task", "a", 5*time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			lease.Owner = tt.unlockOwner
+			if err := l.Unlock(ctx, lease); err != nil {
+				t.Fatalf("Unlock() error = %v", err)
+			}
+			_, err = l.Lock(ctx, "task", "c", 5*time.Minute)
+			if released := err == nil; released != tt.wantReleased {
+				t.Errorf("Lock() by another owner after Unlock() error = %v, want released %t", err, tt.wantReleased)
+			}
+		})
+	}
+}
+
+func TestLockerUnlockMissing(t *testing.T) {
+	l := NewLocker(newMemStorage(), "locks")
+	if err := l.Unlock(context.Background(), Lease{Name: "task", Owner: "a"}); err != nil {
+		t.Errorf("Unlock() of a missing lock error = %v", err)
+	}
+}
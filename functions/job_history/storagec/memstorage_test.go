@@ -0,0 +1,101 @@
+package storagec
+
+import (
+	"context"
+	"sort"
+)
+
+// memStorage is an in-memory StorageC which versions its objects like Client and records the searches it gets.
+// Searches match every object of the collection, whatever their filter.
+type memStorage struct {
+	objects  map[string]map[string][]byte
+	searches []SearchObjectsRequest
+}
+
+var _ StorageC = (*memStorage)(nil)
+
+func newMemStorage() *memStorage {
+	return &memStorage{objects: make(map[string]map[string][]byte)}
+}
+
+func (m *memStorage) BulkFetch(ctx context.Context, req BulkFetchObjectsRequest) BulkFetchObjectsResponse {
+	resp := BulkFetchObjectsResponse{Errs: make(map[string]error), Objects: make(map[string][]byte)}
+	for _, k := range req.ObjectKeys {
+		o, err := m.FetchObject(ctx, FetchObjectRequest{Collection: req.Collection, ObjectKey: k})
+		if err != nil {
+			resp.Errs[k] = err
+			continue
+		}
+		resp.Objects[k] = o.Data
+	}
+	return resp
+}
+
+func (m *memStorage) Count(ctx context.Context, req SearchObjectsRequest) (int, error) {
+	resp, err := m.Search(ctx, req)
+	return resp.Total, err
+}
+
+func (m *memStorage) DeleteObject(_ context.Context, req DeleteObjectRequest) error {
+	if _, ok := m.objects[req.Collection][req.ObjectKey]; !ok {
+		return NotFound
+	}
+	delete(m.objects[req.Collection], req.ObjectKey)
+	return nil
+}
+
+func (m *memStorage) FetchKeys(_ context.Context, req FetchKeysRequest) (FetchKeysResponse, error) {
+	return FetchKeysResponse{ObjectKeys: m.keys(req.Collection)}, nil
+}
+
+func (m *memStorage) FetchObject(_ context.Context, req FetchObjectRequest) (FetchObjectResponse, error) {
+	data, ok := m.objects[req.Collection][req.ObjectKey]
+	if !ok {
+		return FetchObjectResponse{}, NotFound
+	}
+	return FetchObjectResponse{Data: data, Version: objectVersion(data)}, nil
+}
+
+func (m *memStorage) PutObject(_ context.Context, req PutObjectRequest) (StoredObject, error) {
+	cur, ok := m.objects[req.Collection][req.ObjectKey]
+	if (req.IfAbsent && ok) || (req.IfVersion != "" && (!ok || objectVersion(cur) != req.IfVersion)) {
+		return StoredObject{}, VersionConflict
+	}
+	if m.objects[req.Collection] == nil {
+		m.objects[req.Collection] = make(map[string][]byte)
+	}
+	m.objects[req.Collection][req.ObjectKey] = req.Data
+	return StoredObject{Collection: req.Collection, ObjectKey: req.ObjectKey, Version: objectVersion(req.Data)}, nil
+}
+
+func (m *memStorage) Search(_ context.Context, req SearchObjectsRequest) (SearchObjectsResponse, error) {
+	m.searches = append(m.searches, req)
+	keys := m.keys(req.Collection)
+	return SearchObjectsResponse{ObjectKeys: keys, Total: len(keys)}, nil
+}
+
+func (m *memStorage) SearchAll(ctx context.Context, req SearchObjectsRequest) (SearchObjectsResponse, error) {
+	return m.Search(ctx, req)
+}
+
+func (m *memStorage) SearchAndFetch(ctx context.Context, req SearchObjectsRequest) (SearchAndFetchResponse, error) {
+	sr, err := m.Search(ctx, req)
+	if err != nil {
+		return SearchAndFetchResponse{}, err
+	}
+	resp := SearchAndFetchResponse{Total: sr.Total}
+	for _, k := range sr.ObjectKeys {
+		resp.Objects = append(resp.Objects, SearchAndFetchRecord{Key: k, Data: m.objects[req.Collection][k]})
+	}
+	return resp, nil
+}
+
+// keys returns the keys of the objects of a collection, in order.
+func (m *memStorage) keys(collection string) []string {
+	keys := make([]string, 0, len(m.objects[collection]))
+	for k := range m.objects[collection] {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
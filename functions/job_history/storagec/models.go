@@ -24,6 +24,14 @@ type BulkFetchObjectsResponse struct {
 	Errs map[string]error
 }
 
+// DeleteObjectRequest is a request to delete an object.
+type DeleteObjectRequest struct {
+	// Collection is the name of the collection.
+	Collection string
+	// ObjectKey is the object key.
+	ObjectKey string
+}
+
 // FetchObjectRequest is a request to fetch an object.
 type FetchObjectRequest struct {
 	// Collection is the name of the collection.
@@ -36,6 +44,8 @@ type FetchObjectRequest struct {
 type FetchObjectResponse struct {
 	// Data is the successfully returned object.
 	Data []byte
+	// Version identifies the revision of the object which was returned.
+	Version string
 }
 
 // FetchKeysRequest is a request to fetch a collection of object keys.
@@ -66,6 +76,12 @@ type PutObjectRequest struct {
 	Collection string
 	// Data is the object to upload.
 	Data []byte
+	// IfAbsent only allows the object to be written if no object is stored under its key.  VersionConflict is
+	// returned otherwise.
+	IfAbsent bool
+	// IfVersion, when not blank, only allows the object to be written if the stored object is still at this version.
+	// VersionConflict is returned otherwise.
+	IfVersion string
 	// ObjectKey is the key.
 	ObjectKey string
 }
@@ -94,8 +110,13 @@ type SearchObjectsRequest struct {
 	Collection string
 	// Filter is the FQL filter.
 	Filter string
-	// Limit is the maximum number of records to be returned.
+	// Limit is the maximum number of records to be returned.  It is the size of each page searched by SearchAll.
 	Limit int
+	// MaxResults bounds the number of object keys returned by SearchAll, which returns every key if it is zero.
+	MaxResults int
+	// NextToken is the NextToken of the response of the previous page, to search the next page from.  It takes
+	// precedence over Offset.
+	NextToken string
 	// Offset is the records offset.
 	Offset int
 	// Sort is the FQL sort string.
@@ -106,7 +127,11 @@ type SearchObjectsRequest struct {
 type SearchObjectsResponse struct {
 	// ObjectKeys contains the keys of objects which match the search response.
 	ObjectKeys []string
+	// NextToken is presented in the request of the next page of results.  It is blank when there are no more
+	// pages, and in the response of SearchAll unless its results were bounded by MaxResults.
+	NextToken string
 	// Offset is the next value to present to the API get back the next page of results.
+	// It is zero when there are no more pages.  It is always zero in the response of SearchAll.
 	Offset int
 	// Total is the total number of records which match the filter.
 	Total int
@@ -120,4 +145,6 @@ type StoredObject struct {
 	ObjectKey string
 	// SchemaVersion is the schema version.
 	SchemaVersion string
+	// Version identifies the revision of the object which was written.
+	Version string
 }
@@ -0,0 +1,323 @@
+package storagec
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+)
+
+// Statuses of work items.
+const (
+	// WorkPending is the status of work items waiting to be claimed.
+	WorkPending = "pending"
+	// WorkClaimed is the status of work items leased to an invocation.  Items whose lease expires are claimable
+	// again, so that the work of an invocation which died mid-run is picked up by another.
+	WorkClaimed = "claimed"
+	// WorkFailed is the status of work items which failed their maximum number of attempts.  They are not claimed
+	// again.
+	WorkFailed = "failed"
+)
+
+const (
+	// DefaultMaxAttempts is the number of times a work item may fail before it is given up on.
+	DefaultMaxAttempts = 5
+	// DefaultRetryBackoff is how long a work item waits after its first failure before it is claimable again.  The
+	// wait doubles with each failure.
+	DefaultRetryBackoff = time.Minute
+)
+
+// WorkItem is a unit of background work stored in a work queue collection.
+type WorkItem struct {
+	// Attempts is the number of times the work item failed.
+	Attempts int `json:"attempts"`
+	// AvailableAt is the time from which the work item can be claimed: its due time while pending, and the end of
+	// its lease while claimed.
+	AvailableAt string `json:"available_at"`
+	// CreatedAt is the time the work item was enqueued.
+	CreatedAt string `json:"created_at"`
+	// Key identifies the work item among those of its kind.  Enqueuing a work item with the key of a pending one
+	// leaves the pending one in place.
+	Key string `json:"key"`
+	// Kind is the kind of work, which the invocations processing it claim.
+	Kind string `json:"kind"`
+	// LastError is the error of the last failed attempt.
+	LastError string `json:"last_error,omitempty"`
+	// Owner identifies the invocation holding the lease of a claimed work item.
+	Owner string `json:"owner,omitempty"`
+	// Payload is the input of the work, specific to its kind.
+	Payload json.RawMessage `json:"payload,omitempty"`
+	// Requeued is true when the work item was enqueued again while it was claimed, so that it is run again rather
+	// than removed when the claim completes.
+	Requeued bool `json:"requeued,omitempty"`
+	// Status is one of the Work statuses.
+	Status string `json:"status"`
+
+	// objectKey and version identify the revision of the stored work item which was claimed.
+	objectKey string
+	version   string
+}
+
+// WorkQueue is a queue of work items persisted in a custom storage collection, so that background work survives
+// the cold starts of the function and can be processed by any invocation.  Invocations claim due work items,
+// holding them for a lease, and complete or fail them.  Claims are made with conditional puts, so a work item is
+// only held by one invocation at a time.
+type WorkQueue struct {
+	backoff     time.Duration
+	clock       pkg.Clock
+	collection  string
+	maxAttempts int
+	strgc       StorageC
+}
+
+// NewWorkQueue returns a WorkQueue storing its work items in the given collection.
+func NewWorkQueue(strgc StorageC, collection string, opts ...func(q *WorkQueue)) *WorkQueue {
+	q := &WorkQueue{
+		backoff:     DefaultRetryBackoff,
+		clock:       pkg.SystemClock,
+		collection:  collection,
+		maxAttempts: DefaultMaxAttempts,
+		strgc:       strgc,
+	}
+	for _, o := range opts {
+		o(q)
+	}
+	return q
+}
+
+// WithQueueClock sets the clock of the WorkQueue.
+func WithQueueClock(c pkg.Clock) func(q *WorkQueue) {
+	return func(q *WorkQueue) {
+		q.clock = c
+	}
+}
+
+// WithQueueRetryPolicy sets the number of times a work item may fail before it is given up on, and how long it
+// waits after its first failure.  Non-positive values are ignored.
+func WithQueueRetryPolicy(maxAttempts int, backoff time.Duration) func(q *WorkQueue) {
+	return func(q *WorkQueue) {
+		if maxAttempts > 0 {
+			q.maxAttempts = maxAttempts
+		}
+		if backoff > 0 {
+			q.backoff = backoff
+		}
+	}
+}
+
+// workObjectKey returns the object key of the work item of the given kind and key.
+func workObjectKey(kind, key string) string {
+	return fmt.Sprintf("%s_%s", kind, key)
+}
+
+// Enqueue adds a work item of the given kind and key, claimable from notBefore.  A pending work item with the
+// same kind and key is kept, due at the earlier of the two times, and a claimed one is marked to run again once
+// its claim completes, so that enqueuing is idempotent.  Failed work items are replaced.
+func (q *WorkQueue) Enqueue(ctx context.Context, kind, key string, payload json.RawMessage, notBefore time.Time) error {
+	now := q.clock.Now()
+	if notBefore.Before(now) {
+		notBefore = now
+	}
+	objectKey := workObjectKey(kind, key)
+	item, err := q.fetch(ctx, objectKey)
+	switch {
+	case errors.Is(err, NotFound):
+		item = WorkItem{CreatedAt: now.Format(pkg.ISOTimeFormat), Key: key, Kind: kind}
+	case err != nil:
+		return err
+	case item.Status == WorkPending && item.AvailableAt <= notBefore.Format(pkg.ISOTimeFormat):
+		return nil
+	case item.Status == WorkClaimed:
+		if item.Requeued {
+			return nil
+		}
+		item.Requeued = true
+		return q.putErr(ctx, item)
+	}
+	item.Attempts = 0
+	item.AvailableAt = notBefore.Format(pkg.ISOTimeFormat)
+	item.LastError = ""
+	item.Owner = ""
+	item.Payload = payload
+	item.Status = WorkPending
+	return q.putErr(ctx, item)
+}
+
+// Claim leases at most limit due work items of the given kind to owner for the duration of the lease, oldest due
+// first.  Work items claimed concurrently by another invocation are skipped.
+func (q *WorkQueue) Claim(ctx context.Context, kind, owner string, lease time.Duration, limit int) ([]WorkItem, error) {
+	now := q.clock.Now()
+	filter, err := pkg.NewFQLQuery([]pkg.Filter{
+		{Field: "kind", Op: pkg.EQ, Value: kind},
+		{Field: "status", Op: pkg.NEQ, Value: WorkFailed},
+		{Field: "available_at", Op: pkg.LTE, Value: now.Format(pkg.ISOTimeFormat)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error constructing FQL query: %s", err)
+	}
+	sort, err := pkg.NewFQLSort("available_at", pkg.Asc)
+	if err != nil {
+		return nil, fmt.Errorf("error constructing FQL sort: %s", err)
+	}
+	sr, err := q.strgc.Search(ctx, SearchObjectsRequest{
+		Collection: q.collection,
+		Filter:     filter,
+		Limit:      limit,
+		Sort:       sort,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search work items: %w", err)
+	}
+
+	claimed := make([]WorkItem, 0, len(sr.ObjectKeys))
+	for _, objectKey := range sr.ObjectKeys {
+		item, err := q.fetch(ctx, objectKey)
+		if errors.Is(err, NotFound) {
+			continue
+		}
+		if err != nil {
+			return claimed, err
+		}
+		// the search index may lag behind the work items
+		if item.Status == WorkFailed || item.AvailableAt > now.Format(pkg.ISOTimeFormat) {
+			continue
+		}
+		item.AvailableAt = now.Add(lease).Format(pkg.ISOTimeFormat)
+		item.Owner = owner
+		item.Requeued = false
+		item.Status = WorkClaimed
+		item, err = q.put(ctx, item)
+		if errors.Is(err, VersionConflict) {
+			continue
+		}
+		if err != nil {
+			return claimed, err
+		}
+		claimed = append(claimed, item)
+	}
+	return claimed, nil
+}
+
+// Complete removes a claimed work item once its work is done.  Work items enqueued again while claimed are made
+// pending instead, so that their work runs again.
+func (q *WorkQueue) Complete(ctx context.Context, item WorkItem) error {
+	stored, err := q.held(ctx, item)
+	if errors.Is(err, NotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if stored.Requeued {
+		return q.release(ctx, stored, 0)
+	}
+	return q.strgc.DeleteObject(ctx, DeleteObjectRequest{Collection: q.collection, ObjectKey: item.objectKey})
+}
+
+// Release returns a claimed work item to the queue without counting an attempt, claimable again after the given
+// delay, e.g. when its work cannot be done yet.
+func (q *WorkQueue) Release(ctx context.Context, item WorkItem, after time.Duration) error {
+	stored, err := q.held(ctx, item)
+	if err != nil {
+		return err
+	}
+	if stored.Requeued {
+		after = 0
+	}
+	return q.release(ctx, stored, after)
+}
+
+// Fail returns a claimed work item to the queue after a failed attempt, claimable again after a backoff doubling
+// with each failure.  Work items which failed their maximum number of attempts are marked as failed instead,
+// unless they were enqueued again while claimed.
+func (q *WorkQueue) Fail(ctx context.Context, item WorkItem, cause error) error {
+	stored, err := q.held(ctx, item)
+	if err != nil {
+		return err
+	}
+	stored.Attempts++
+	stored.LastError = cause.Error()
+	if stored.Requeued {
+		return q.release(ctx, stored, 0)
+	}
+	if stored.Attempts >= q.maxAttempts {
+		stored.Owner = ""
+		stored.Status = WorkFailed
+		return q.putErr(ctx, stored)
+	}
+	return q.release(ctx, stored, q.backoff<<min(stored.Attempts-1, 16))
+}
+
+// held returns the stored revision of a claimed work item, or VersionConflict if its lease was lost to another
+// invocation.
+func (q *WorkQueue) held(ctx context.Context, item WorkItem) (WorkItem, error) {
+	stored, err := q.fetch(ctx, item.objectKey)
+	if err != nil {
+		return stored, err
+	}
+	if stored.Status != WorkClaimed || stored.Owner != item.Owner {
+		return stored, VersionConflict
+	}
+	return stored, nil
+}
+
+// release makes the work item pending, claimable after the given delay.
+func (q *WorkQueue) release(ctx context.Context, item WorkItem, after time.Duration) error {
+	item.AvailableAt = q.clock.Now().Add(after).Format(pkg.ISOTimeFormat)
+	item.Owner = ""
+	item.Requeued = false
+	item.Status = WorkPending
+	return q.putErr(ctx, item)
+}
+
+// fetch returns the stored work item with the given object key.
+func (q *WorkQueue) fetch(ctx context.Context, objectKey string) (WorkItem, error) {
+	resp, err := q.strgc.FetchObject(ctx, FetchObjectRequest{Collection: q.collection, ObjectKey: objectKey})
+	if err != nil {
+		return WorkItem{}, err
+	}
+	var item WorkItem
+	data, err := pkg.DecodeBase64JSON(resp.Data)
+	if err == nil {
+		err = json.Unmarshal(data, &item)
+	}
+	if err != nil {
+		return WorkItem{}, fmt.Errorf("failed to deserialize work item %s: %s", objectKey, err)
+	}
+	item.objectKey = objectKey
+	item.version = resp.Version
+	return item, nil
+}
+
+// put stores the work item if it was not modified since it was fetched, or created if it was not fetched,
+// returning VersionConflict otherwise, and returns it at its stored revision.
+func (q *WorkQueue) put(ctx context.Context, item WorkItem) (WorkItem, error) {
+	if item.objectKey == "" {
+		item.objectKey = workObjectKey(item.Kind, item.Key)
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return item, fmt.Errorf("failed to serialize work item: %s", err)
+	}
+	so, err := q.strgc.PutObject(ctx, PutObjectRequest{
+		Collection: q.collection,
+		Data:       data,
+		IfAbsent:   item.version == "",
+		IfVersion:  item.version,
+		ObjectKey:  item.objectKey,
+	})
+	if err != nil {
+		return item, err
+	}
+	item.version = so.Version
+	return item, nil
+}
+
+// putErr stores the work item like put, only returning the error.
+func (q *WorkQueue) putErr(ctx context.Context, item WorkItem) error {
+	_, err := q.put(ctx, item)
+	return err
+}
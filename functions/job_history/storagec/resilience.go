@@ -0,0 +1,194 @@
+package storagec
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/eapache/go-resiliency/breaker"
+)
+
+// Unavailable is a dedicated error indicating that the circuit breaker is open and the call was not attempted.
+var Unavailable = errors.New("custom storage temporarily unavailable")
+
+// DefaultRetryPolicy is the RetryPolicy used by a Client unless configured otherwise.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   200 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+	Jitter:      0.25,
+}
+
+// RetryPolicy configures how calls which fail with a transient error (429, 5xx or a network timeout) are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first.  Values below 2 disable retries.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry.  It doubles with every subsequent retry.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between attempts, including delays requested by the API through Retry-After.
+	MaxDelay time.Duration
+	// Jitter is the fraction, between 0 and 1, by which each delay is randomly varied.
+	Jitter float64
+}
+
+// WithRetryPolicy sets the retry policy of a Client.
+func WithRetryPolicy(rp RetryPolicy) func(f *Client) {
+	return func(f *Client) {
+		f.retryPolicy = rp
+	}
+}
+
+// Default timeouts of the calls of a Client, see WithTimeouts.
+const (
+	// DefaultFetchTimeout bounds each call reading custom storage, including its retries.
+	DefaultFetchTimeout = 20 * time.Second
+	// DefaultPutTimeout bounds each call writing or deleting a stored object, including its retries.
+	DefaultPutTimeout = 30 * time.Second
+)
+
+// WithTimeouts sets how long each call reading custom storage, and each call writing to it, may take including
+// its retries, so that a slow call cannot use up the time left to the request.  Objects stored over several
+// chunks or parts take a call per chunk and part.  Durations which are not positive keep the default.
+func WithTimeouts(fetch, put time.Duration) func(f *Client) {
+	return func(f *Client) {
+		if fetch > 0 {
+			f.fetchTimeout = fetch
+		}
+		if put > 0 {
+			f.putTimeout = put
+		}
+	}
+}
+
+// WithCircuitBreaker sets the circuit breaker of a Client.  The breaker is opened by transient errors only,
+// and should be shared between clients so that it outlives a single request.
+func WithCircuitBreaker(b *breaker.Breaker) func(f *Client) {
+	return func(f *Client) {
+		f.breaker = b
+	}
+}
+
+// call invokes fn, retrying transient errors according to the retry policy, through the circuit breaker.
+func (f *Client) call(ctx context.Context, fn func() error) error {
+	if f.breaker == nil {
+		return f.retry(ctx, fn)
+	}
+
+	// only transient errors count towards opening the breaker, so permanent errors are passed around it
+	var permanent error
+	err := f.breaker.Run(func() error {
+		err := f.retry(ctx, fn)
+		if err != nil && !isTransient(err) {
+			permanent = err
+			return nil
+		}
+		return err
+	})
+	if errors.Is(err, breaker.ErrBreakerOpen) {
+		return Unavailable
+	}
+	if permanent != nil {
+		return permanent
+	}
+	return err
+}
+
+func (f *Client) retry(ctx context.Context, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !isTransient(err) || attempt >= f.retryPolicy.MaxAttempts {
+			return err
+		}
+
+		wait := f.retryPolicy.delay(attempt, retryAfter(err))
+		f.logger.WithField("attempt", attempt).
+			WithField("wait", wait.String()).
+			Infof("retrying custom storage call after transient error: %s", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// delay returns the jittered exponential delay before the given retry, or the delay requested by the API
+// if it is longer.  The result never exceeds MaxDelay.
+func (rp RetryPolicy) delay(attempt int, requested time.Duration) time.Duration {
+	d := rp.BaseDelay << (attempt - 1)
+	if d <= 0 || (rp.MaxDelay > 0 && d > rp.MaxDelay) {
+		d = rp.MaxDelay
+	}
+	if rp.Jitter > 0 {
+		d += time.Duration((rand.Float64()*2 - 1) * rp.Jitter * float64(d))
+	}
+	if requested > d {
+		d = requested
+	}
+	if rp.MaxDelay > 0 && d > rp.MaxDelay {
+		d = rp.MaxDelay
+	}
+	return d
+}
+
+// statusPattern matches the status code in the error messages produced by the gofalcon client, either
+// "[GET /path][429] ..." for declared responses or "... (status 503): ..." for undeclared ones.
+var statusPattern = regexp.MustCompile(`\]\[(\d{3})\]|\(status (\d{3})\)`)
+
+// isTransient reports whether err is worth retrying.
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	code := statusCode(err)
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+func statusCode(err error) int {
+	var c interface{ Code() int }
+	if errors.As(err, &c) {
+		return c.Code()
+	}
+	// hack to get around limitation of the gofalcon client
+	m := statusPattern.FindStringSubmatch(err.Error())
+	if m == nil {
+		return 0
+	}
+	s := m[1]
+	if s == "" {
+		s = m[2]
+	}
+	code, _ := strconv.Atoi(s)
+	return code
+}
+
+// retryAfter returns how long the API asked the caller to wait before retrying, or zero.  The gofalcon
+// client exposes the X-RateLimit-RetryAfter header, an epoch timestamp in seconds, as a field on each
+// rate-limited response type rather than through a common interface.
+func retryAfter(err error) time.Duration {
+	v := reflect.ValueOf(err)
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return 0
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return 0
+	}
+	f := v.FieldByName("XRateLimitRetryAfter")
+	if !f.IsValid() || !f.CanInt() || f.Int() <= 0 {
+		return 0
+	}
+	return time.Until(time.Unix(f.Int(), 0))
+}
@@ -0,0 +1,118 @@
+package storagec
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+)
+
+// SequenceField is the field of the objects of sequenced collections recording the change sequence number of
+// their last put.
+const SequenceField = "change_seq"
+
+// maxSequenceAttempts is the number of times the counter of a collection is incremented before a put is failed,
+// each attempt after the first following a concurrent increment.
+const maxSequenceAttempts = 5
+
+// counter is the stored change counter of a collection.
+type counter struct {
+	// Name is the name of the counted collection.
+	Name string `json:"name"`
+	// Value is the sequence number of the latest change.
+	Value int64 `json:"value"`
+}
+
+// SequencedClient records a monotonically increasing change sequence number in the SequenceField of every object
+// put into the given collections, so that clients can list the objects changed since a sequence number they saw.
+// The counter of each collection is an object of the counters collection, incremented with conditional puts.
+type SequencedClient struct {
+	StorageC
+	collections map[string]struct{}
+	counters    string
+}
+
+var _ StorageC = (*SequencedClient)(nil)
+
+// NewSequencedClient wraps c, sequencing the puts of the given collections with counters stored in the counters
+// collection.
+func NewSequencedClient(c StorageC, counters string, collections []string) *SequencedClient {
+	cs := make(map[string]struct{}, len(collections))
+	for _, c := range collections {
+		cs[c] = struct{}{}
+	}
+	return &SequencedClient{StorageC: c, collections: cs, counters: counters}
+}
+
+// PutObject puts the object with the next change sequence number of its collection, if it is sequenced.
+func (s *SequencedClient) PutObject(ctx context.Context, req PutObjectRequest) (StoredObject, error) {
+	if _, ok := s.collections[req.Collection]; !ok {
+		return s.StorageC.PutObject(ctx, req)
+	}
+	seq, err := s.next(ctx, req.Collection)
+	if err != nil {
+		return StoredObject{}, err
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(req.Data, &obj); err != nil {
+		return StoredObject{}, fmt.Errorf("failed to record change sequence of object: %s", err)
+	}
+	if obj[SequenceField], err = json.Marshal(seq); err != nil {
+		return StoredObject{}, err
+	}
+	if req.Data, err = json.Marshal(obj); err != nil {
+		return StoredObject{}, fmt.Errorf("failed to record change sequence of object: %s", err)
+	}
+	return s.StorageC.PutObject(ctx, req)
+}
+
+// next increments the counter of the collection, returning its new value.  Sequence numbers are unique and
+// increasing, but may skip values left by failed puts.
+func (s *SequencedClient) next(ctx context.Context, collection string) (int64, error) {
+	for attempt := 0; attempt < maxSequenceAttempts; attempt++ {
+		c, version, err := s.fetchCounter(ctx, collection)
+		if err != nil && !errors.Is(err, NotFound) {
+			return 0, err
+		}
+		c.Name = collection
+		c.Value++
+		data, err := json.Marshal(c)
+		if err != nil {
+			return 0, fmt.Errorf("failed to serialize change counter: %s", err)
+		}
+		_, err = s.StorageC.PutObject(ctx, PutObjectRequest{
+			Collection: s.counters,
+			Data:       data,
+			IfAbsent:   version == "",
+			IfVersion:  version,
+			ObjectKey:  collection,
+		})
+		if errors.Is(err, VersionConflict) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to increment change counter of %s: %w", collection, err)
+		}
+		return c.Value, nil
+	}
+	return 0, fmt.Errorf("failed to increment change counter of %s: %w", collection, VersionConflict)
+}
+
+// fetchCounter returns the counter of the collection and its version.
+func (s *SequencedClient) fetchCounter(ctx context.Context, collection string) (counter, string, error) {
+	resp, err := s.StorageC.FetchObject(ctx, FetchObjectRequest{Collection: s.counters, ObjectKey: collection})
+	if err != nil {
+		return counter{}, "", err
+	}
+	var c counter
+	data, err := pkg.DecodeBase64JSON(resp.Data)
+	if err == nil {
+		err = json.Unmarshal(data, &c)
+	}
+	if err != nil {
+		return counter{}, "", fmt.Errorf("failed to deserialize change counter of %s: %s", collection, err)
+	}
+	return c, resp.Version, nil
+}
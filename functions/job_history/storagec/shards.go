@@ -0,0 +1,197 @@
+package storagec
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+)
+
+// shardsField holds the ShardManifest of a sharded object.
+const shardsField = "_shards"
+
+// maxShards bounds the number of parts of a sharded object.
+const maxShards = 1000
+
+// ShardManifest lists the parts holding the elements of the sharded array field of an object.
+type ShardManifest struct {
+	// Field is the name of the sharded array field, which is empty in the stored object.
+	Field string `json:"field"`
+	// Parts are the parts holding the elements of the field, in order.
+	Parts []ShardPart `json:"parts"`
+	// Total is the number of elements of the field.
+	Total int `json:"total"`
+}
+
+// ShardPart is an object holding some of the elements of a sharded array field.
+type ShardPart struct {
+	// Key is the key of the part, see ShardKey.
+	Key string `json:"key"`
+	// Version is the version of the part, which changes the version of the sharded object whenever the part does.
+	Version string `json:"version"`
+}
+
+// shardPart is the content of a part.
+type shardPart struct {
+	Items []json.RawMessage `json:"items"`
+}
+
+// WithSharding makes the client store the elements of large array fields in parts, so that a single object does
+// not exceed the payload limits of custom storage.  fields maps the names of collections to the name of their
+// sharded field.  Objects whose field has more than perPart elements are split over parts of perPart elements,
+// stored alongside the object in the same collection under the keys returned by ShardKey.
+//
+// Fetching a sharded object reassembles it, see Reassemble.
+func WithSharding(fields map[string]string, perPart int) func(f *Client) {
+	return func(f *Client) {
+		f.shardedFields = fields
+		f.shardSize = perPart
+	}
+}
+
+// ShardKey returns the key of the nth part of a sharded object, counting from 1.
+func ShardKey(objectKey string, n int) string {
+	return fmt.Sprintf("%s_part_%d", objectKey, n)
+}
+
+// IsSharded returns true if the data of an object is that of a sharded object, whose parts still need to be
+// reassembled.
+func IsSharded(data []byte) bool {
+	_, m := shardManifest(data)
+	return m != nil
+}
+
+// shardManifest returns stored data decoded from the base64 encoding storage may return it in, and the manifest
+// at its top level, or nil if it is not that of a sharded object.
+func shardManifest(data []byte) ([]byte, *ShardManifest) {
+	decoded, err := pkg.DecodeBase64JSON(data)
+	if err != nil {
+		return data, nil
+	}
+	var o struct {
+		Shards *ShardManifest `json:"_shards"`
+	}
+	if err := json.Unmarshal(decoded, &o); err != nil {
+		return data, nil
+	}
+	return decoded, o.Shards
+}
+
+// Reassemble returns the data of a sharded object with the elements of its parts, fetched using s, restored
+// into its sharded field.  The data of other objects is returned as it is.
+func Reassemble(ctx context.Context, s StorageC, collection string, data []byte) ([]byte, error) {
+	data, m := shardManifest(data)
+	if m == nil {
+		return data, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("failed to decode sharded object: %s", err)
+	}
+
+	items := make([]json.RawMessage, 0, m.Total)
+	for _, part := range m.Parts {
+		resp, err := s.FetchObject(ctx, FetchObjectRequest{Collection: collection, ObjectKey: part.Key})
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch part %s: %w", part.Key, err)
+		}
+		if resp.Version != part.Version {
+			return nil, fmt.Errorf("%w: part %s changed while the object was read", VersionConflict, part.Key)
+		}
+		var sp shardPart
+		partData, err := pkg.DecodeBase64JSON(resp.Data)
+		if err == nil {
+			err = json.Unmarshal(partData, &sp)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode part %s: %s", part.Key, err)
+		}
+		items = append(items, sp.Items...)
+	}
+
+	b, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	fields[m.Field] = b
+	delete(fields, shardsField)
+	return json.Marshal(fields)
+}
+
+// shardObject splits the elements of the sharded field of an object over parts, returning the data of the
+// object to store with its manifest, and the data of its parts.  Objects which do not need sharding are returned
+// as they are.
+func (f *Client) shardObject(collection, objectKey string, data []byte) ([]byte, []PutObjectRequest, error) {
+	field := f.shardedFields[collection]
+	if field == "" || f.shardSize <= 0 {
+		return data, nil, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return data, nil, nil
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(fields[field], &items); err != nil || len(items) <= f.shardSize {
+		return data, nil, nil
+	}
+	n := (len(items) + f.shardSize - 1) / f.shardSize
+	if n > maxShards {
+		return nil, nil, fmt.Errorf("%s has %d elements, more than the maximum of %d", field, len(items), maxShards*f.shardSize)
+	}
+
+	m := ShardManifest{Field: field, Parts: make([]ShardPart, n), Total: len(items)}
+	parts := make([]PutObjectRequest, n)
+	for i := range parts {
+		end := min((i+1)*f.shardSize, len(items))
+		b, err := json.Marshal(shardPart{Items: items[i*f.shardSize : end]})
+		if err != nil {
+			return nil, nil, err
+		}
+		parts[i] = PutObjectRequest{Collection: collection, Data: b, ObjectKey: ShardKey(objectKey, i+1)}
+		m.Parts[i] = ShardPart{Key: parts[i].ObjectKey, Version: objectVersion(b)}
+	}
+
+	manifest, err := json.Marshal(m)
+	if err != nil {
+		return nil, nil, err
+	}
+	fields[field] = json.RawMessage("[]")
+	fields[shardsField] = manifest
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return nil, nil, err
+	}
+	return b, parts, nil
+}
+
+// shardKeys returns the keys of the parts of a stored object.
+func shardKeys(data []byte) []string {
+	_, m := shardManifest(data)
+	if m == nil {
+		return nil
+	}
+	keys := make([]string, len(m.Parts))
+	for i, p := range m.Parts {
+		keys[i] = p.Key
+	}
+	return keys
+}
+
+// pruneShards deletes the parts left over from an earlier, larger revision of an object, starting with the nth.
+// Failures are only logged, as the leftover parts are no longer listed by the object.
+func (f *Client) pruneShards(ctx context.Context, collection, objectKey string, n int) {
+	for ; n <= maxShards; n++ {
+		err := f.DeleteObject(ctx, DeleteObjectRequest{Collection: collection, ObjectKey: ShardKey(objectKey, n)})
+		if errors.Is(err, NotFound) {
+			return
+		}
+		if err != nil {
+			f.logger.WithField("object_key", objectKey).
+				WithField("collection", collection).
+				Warnf("failed to delete leftover part %d: %s", n, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package storagec
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestShardingRoundTrip(t *testing.T) {
+	hosts := `[{"aid":"1"},{"aid":"2"},{"aid":"3"},{"aid":"4"},{"aid":"5"}]`
+	tests := []struct {
+		name       string
+		collection string
+		data       string
+		perPart    int
+		wantParts  int
+	}{
+		{name: "not sharded collection", collection: "jobs", data: `{"id":"1","targeted_hosts":` + hosts + `}`, perPart: 2},
+		{name: "few elements", collection: "executions", data: `{"id":"1","targeted_hosts":` + hosts + `}`, perPart: 5},
+		{name: "no sharded field", collection: "executions", data: `{"id":"1"}`, perPart: 2},
+		{name: "not an object", collection: "executions", data: hosts, perPart: 2},
+		{name: "sharded", collection: "executions", data: `{"id":"1","targeted_hosts":` + hosts + `}`, perPart: 2, wantParts: 3},
+		{name: "full parts", collection: "executions", data: `{"id":"1","targeted_hosts":` + hosts + `}`, perPart: 1, wantParts: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			c := &Client{shardedFields: map[string]string{"executions": "targeted_hosts"}, shardSize: tt.perPart}
+			s := newMemStorage()
+			stored, parts, err := c.shardObject(tt.collection, "obj", []byte(tt.data))
+			if err != nil {
+				t.Fatalf("shardObject() error = %v", err)
+			}
+			if len(parts) != tt.wantParts {
+				t.Fatalf("shardObject() returned %d parts, want %d", len(parts), tt.wantParts)
+			}
+			if IsSharded(stored) != (tt.wantParts > 0) {
+				t.Errorf("IsSharded() = %t, want %t", IsSharded(stored), tt.wantParts > 0)
+			}
+			keys := shardKeys(stored)
+			for i, part := range parts {
+				if part.ObjectKey != ShardKey("obj", i+1) || keys[i] != part.ObjectKey {
+					t.Errorf("part %d has key %s, listed as %s, want %s", i+1, part.ObjectKey, keys[i], ShardKey("obj", i+1))
+				}
+				if _, err := s.PutObject(ctx, part); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := Reassemble(ctx, s, tt.collection, stored)
+			if err != nil {
+				t.Fatalf("Reassemble() error = %v", err)
+			}
+			var gotV, wantV any
+			if err := json.Unmarshal(got, &gotV); err != nil {
+				t.Fatalf("Reassemble() returned invalid JSON %s: %v", got, err)
+			}
+			if err := json.Unmarshal([]byte(tt.data), &wantV); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(gotV, wantV) {
+				t.Errorf("Reassemble() = %s, want %s", got, tt.data)
+			}
+		})
+	}
+}
+
+func TestReassembleChangedPart(t *testing.T) {
+	ctx := context.Background()
+	c := &Client{shardedFields: map[string]string{"executions": "targeted_hosts"}, shardSize: 1}
+	s := newMemStorage()
+	stored, parts, err := c.shardObject("executions", "obj", []byte(`{"targeted_hosts":[{"aid":"1"},{"aid":"2"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, part := range parts {
+		if _, err := s.PutObject(ctx, part); err != nil {
+			t.Fatal(err)
+		}
+	}
+	parts[1].Data = []byte(`{"items":[{"aid":"3"}]}`)
+	if _, err := s.PutObject(ctx, parts[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Reassemble(ctx, s, "executions", stored); !errors.Is(err, VersionConflict) {
+		t.Errorf("Reassemble() error = %v, want %v", err, VersionConflict)
+	}
+}
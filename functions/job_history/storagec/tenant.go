@@ -0,0 +1,184 @@
+package storagec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+)
+
+// TenantField is the field in which TenantClient records the tenant of every object, so that searches can be
+// restricted to the objects of a tenant.  It must be indexable in every collection.
+const TenantField = "cid"
+
+// TenantClient is a StorageC which isolates the objects of the tenant carried by the context of each call, see
+// pkg.WithTenant.  Object keys are prefixed with the CID of the tenant, the CID is recorded in the TenantField of
+// objects, and searches only match the objects of the tenant.  Calls without a tenant are delegated unchanged.
+type TenantClient struct {
+	c StorageC
+}
+
+var _ StorageC = (*TenantClient)(nil)
+
+// NewTenantClient wraps c.
+func NewTenantClient(c StorageC) *TenantClient {
+	return &TenantClient{c: c}
+}
+
+func (t *TenantClient) BulkFetch(ctx context.Context, req BulkFetchObjectsRequest) BulkFetchObjectsResponse {
+	cid := pkg.TenantFromContext(ctx)
+	if cid == "" {
+		return t.c.BulkFetch(ctx, req)
+	}
+	keys := make([]string, len(req.ObjectKeys))
+	for i, k := range req.ObjectKeys {
+		keys[i] = tenantKey(cid, k)
+	}
+	req.ObjectKeys = keys
+	resp := t.c.BulkFetch(ctx, req)
+
+	objects := make(map[string][]byte, len(resp.Objects))
+	for k, v := range resp.Objects {
+		objects[untenantKey(cid, k)] = v
+	}
+	errs := make(map[string]error, len(resp.Errs))
+	for k, v := range resp.Errs {
+		errs[untenantKey(cid, k)] = v
+	}
+	return BulkFetchObjectsResponse{Objects: objects, Errs: errs}
+}
+
+func (t *TenantClient) Count(ctx context.Context, req SearchObjectsRequest) (int, error) {
+	if cid := pkg.TenantFromContext(ctx); cid != "" {
+		req.Filter = tenantFilter(cid, req.Filter)
+	}
+	return t.c.Count(ctx, req)
+}
+
+func (t *TenantClient) DeleteObject(ctx context.Context, req DeleteObjectRequest) error {
+	if cid := pkg.TenantFromContext(ctx); cid != "" {
+		req.ObjectKey = tenantKey(cid, req.ObjectKey)
+	}
+	return t.c.DeleteObject(ctx, req)
+}
+
+// FetchKeys returns a page of the object keys of the tenant.  Pages can be shorter than req.Limit, as the keys of
+// other tenants are skipped.
+func (t *TenantClient) FetchKeys(ctx context.Context, req FetchKeysRequest) (FetchKeysResponse, error) {
+	cid := pkg.TenantFromContext(ctx)
+	if cid == "" {
+		return t.c.FetchKeys(ctx, req)
+	}
+	if req.StartKey != "" {
+		req.StartKey = tenantKey(cid, req.StartKey)
+	}
+	resp, err := t.c.FetchKeys(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+	keys := make([]string, 0, len(resp.ObjectKeys))
+	for _, k := range resp.ObjectKeys {
+		if strings.HasPrefix(k, cid+"_") {
+			keys = append(keys, untenantKey(cid, k))
+		}
+	}
+	return FetchKeysResponse{ObjectKeys: keys}, nil
+}
+
+func (t *TenantClient) FetchObject(ctx context.Context, req FetchObjectRequest) (FetchObjectResponse, error) {
+	if cid := pkg.TenantFromContext(ctx); cid != "" {
+		req.ObjectKey = tenantKey(cid, req.ObjectKey)
+	}
+	return t.c.FetchObject(ctx, req)
+}
+
+func (t *TenantClient) PutObject(ctx context.Context, req PutObjectRequest) (StoredObject, error) {
+	cid := pkg.TenantFromContext(ctx)
+	if cid == "" {
+		return t.c.PutObject(ctx, req)
+	}
+	data, err := withTenantField(cid, req.Data)
+	if err != nil {
+		return StoredObject{}, err
+	}
+	req.Data = data
+	req.ObjectKey = tenantKey(cid, req.ObjectKey)
+	resp, err := t.c.PutObject(ctx, req)
+	resp.ObjectKey = untenantKey(cid, resp.ObjectKey)
+	return resp, err
+}
+
+func (t *TenantClient) Search(ctx context.Context, req SearchObjectsRequest) (SearchObjectsResponse, error) {
+	cid := pkg.TenantFromContext(ctx)
+	if cid == "" {
+		return t.c.Search(ctx, req)
+	}
+	req.Filter = tenantFilter(cid, req.Filter)
+	resp, err := t.c.Search(ctx, req)
+	resp.ObjectKeys = untenantKeys(cid, resp.ObjectKeys)
+	return resp, err
+}
+
+func (t *TenantClient) SearchAll(ctx context.Context, req SearchObjectsRequest) (SearchObjectsResponse, error) {
+	cid := pkg.TenantFromContext(ctx)
+	if cid == "" {
+		return t.c.SearchAll(ctx, req)
+	}
+	req.Filter = tenantFilter(cid, req.Filter)
+	resp, err := t.c.SearchAll(ctx, req)
+	resp.ObjectKeys = untenantKeys(cid, resp.ObjectKeys)
+	return resp, err
+}
+
+func (t *TenantClient) SearchAndFetch(ctx context.Context, req SearchObjectsRequest) (SearchAndFetchResponse, error) {
+	cid := pkg.TenantFromContext(ctx)
+	if cid == "" {
+		return t.c.SearchAndFetch(ctx, req)
+	}
+	req.Filter = tenantFilter(cid, req.Filter)
+	resp, err := t.c.SearchAndFetch(ctx, req)
+	for i := range resp.Objects {
+		resp.Objects[i].Key = untenantKey(cid, resp.Objects[i].Key)
+	}
+	return resp, err
+}
+
+func tenantKey(cid, key string) string {
+	return cid + "_" + key
+}
+
+func untenantKey(cid, key string) string {
+	return strings.TrimPrefix(key, cid+"_")
+}
+
+func untenantKeys(cid string, keys []string) []string {
+	for i, k := range keys {
+		keys[i] = untenantKey(cid, k)
+	}
+	return keys
+}
+
+// tenantFilter restricts an FQL filter to the objects of the tenant.
+func tenantFilter(cid, filter string) string {
+	tf := fmt.Sprintf("%s:'%s'", TenantField, pkg.EscapeFQLValue(cid))
+	if filter == "" {
+		return tf
+	}
+	return filter + "+" + tf
+}
+
+// withTenantField records the tenant in the TenantField of a JSON object.
+func withTenantField(cid string, data []byte) ([]byte, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, fmt.Errorf("failed to record tenant of object: %s", err)
+	}
+	v, err := json.Marshal(cid)
+	if err != nil {
+		return nil, err
+	}
+	obj[TenantField] = v
+	return json.Marshal(obj)
+}
@@ -0,0 +1,125 @@
+package storagec
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+)
+
+func TestTenantFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		cid    string
+		filter string
+		want   string
+	}{
+		{name: "no filter", cid: "abc", want: "cid:'abc'"},
+		{name: "filter", cid: "abc", filter: "id:'1'+status:'failed'", want: "id:'1'+status:'failed'+cid:'abc'"},
+		{name: "escaped cid", cid: `a'b\c`, filter: "id:'1'", want: `id:'1'+cid:'a\'b\\c'`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tenantFilter(tt.cid, tt.filter); got != tt.want {
+				t.Errorf("tenantFilter() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTenantClient(t *testing.T) {
+	tests := []struct {
+		name       string
+		cid        string
+		wantKey    string
+		wantTenant string
+		wantFilter string
+	}{
+		{name: "no tenant", wantKey: "obj", wantFilter: "id:'1'"},
+		{name: "tenant", cid: "abc", wantKey: "abc_obj", wantTenant: "abc", wantFilter: "id:'1'+cid:'abc'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.cid != "" {
+				ctx = pkg.WithTenant(ctx, tt.cid)
+			}
+			s := newMemStorage()
+			tc := NewTenantClient(s)
+
+			so, err := tc.PutObject(ctx, PutObjectRequest{Collection: "c", ObjectKey: "obj", Data: []byte(`{"id":"1"}`)})
+			if err != nil {
+				t.Fatalf("PutObject() error = %v", err)
+			}
+			if so.ObjectKey != "obj" {
+				t.Errorf("PutObject() key = %s, want obj", so.ObjectKey)
+			}
+			if got := s.keys("c"); !reflect.DeepEqual(got, []string{tt.wantKey}) {
+				t.Fatalf("stored keys = %v, want %s", got, tt.wantKey)
+			}
+			var stored map[string]string
+			if err := json.Unmarshal(s.objects["c"][tt.wantKey], &stored); err != nil {
+				t.Fatal(err)
+			}
+			if stored[TenantField] != tt.wantTenant {
+				t.Errorf("stored tenant = %q, want %q", stored[TenantField], tt.wantTenant)
+			}
+
+			if _, err := tc.FetchObject(ctx, FetchObjectRequest{Collection: "c", ObjectKey: "obj"}); err != nil {
+				t.Errorf("FetchObject() error = %v", err)
+			}
+			bf := tc.BulkFetch(ctx, BulkFetchObjectsRequest{Collection: "c", ObjectKeys: []string{"obj", "other"}})
+			if _, ok := bf.Objects["obj"]; !ok || !errors.Is(bf.Errs["other"], NotFound) {
+				t.Errorf("BulkFetch() = %v, %v, want obj fetched and other not found", bf.Objects, bf.Errs)
+			}
+			sr, err := tc.Search(ctx, SearchObjectsRequest{Collection: "c", Filter: "id:'1'"})
+			if err != nil {
+				t.Fatalf("Search() error = %v", err)
+			}
+			if !reflect.DeepEqual(sr.ObjectKeys, []string{"obj"}) {
+				t.Errorf("Search() keys = %v, want [obj]", sr.ObjectKeys)
+			}
+			if got := s.searches[len(s.searches)-1].Filter; got != tt.wantFilter {
+				t.Errorf("Search() filter = %q, want %q", got, tt.wantFilter)
+			}
+			if err := tc.DeleteObject(ctx, DeleteObjectRequest{Collection: "c", ObjectKey: "obj"}); err != nil {
+				t.Errorf("DeleteObject() error = %v", err)
+			}
+			if got := s.keys("c"); len(got) != 0 {
+				t.Errorf("keys after DeleteObject() = %v, want none", got)
+			}
+		})
+	}
+}
+
+func TestTenantClientIsolation(t *testing.T) {
+	s := newMemStorage()
+	tc := NewTenantClient(s)
+	abc := pkg.WithTenant(context.Background(), "abc")
+	def := pkg.WithTenant(context.Background(), "def")
+	for _, ctx := range []context.Context{abc, def} {
+		if _, err := tc.PutObject(ctx, PutObjectRequest{Collection: "c", ObjectKey: "obj", Data: []byte(`{}`)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := tc.PutObject(abc, PutObjectRequest{Collection: "c", ObjectKey: "only_abc", Data: []byte(`{}`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := tc.FetchKeys(def, FetchKeysRequest{Collection: "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys.ObjectKeys, []string{"obj"}) {
+		t.Errorf("FetchKeys() = %v, want [obj]", keys.ObjectKeys)
+	}
+	if _, err := tc.FetchObject(def, FetchObjectRequest{Collection: "c", ObjectKey: "only_abc"}); !errors.Is(err, NotFound) {
+		t.Errorf("FetchObject() of another tenant error = %v, want %v", err, NotFound)
+	}
+	if _, err := tc.PutObject(abc, PutObjectRequest{Collection: "c", ObjectKey: "obj", Data: []byte(`["not an object"]`)}); err == nil {
+		t.Error("PutObject() of a JSON array did not fail")
+	}
+}
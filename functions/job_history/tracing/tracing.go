@@ -0,0 +1,111 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/sirupsen/logrus"
+)
+
+// Attributes qualify a span, such as the collection or saved search a call targets.
+type Attributes map[string]any
+
+// Tracer starts the spans timing the calls made by the clients.  Implementations must be safe for concurrent use.
+type Tracer interface {
+	// Start starts a span named name, returning a copy of ctx which makes it the parent of the spans started from
+	// it.
+	Start(ctx context.Context, name string, attrs Attributes) (context.Context, Span)
+}
+
+// Span is a timed operation.
+type Span interface {
+	// End ends the span, recording err as its outcome.
+	End(err error)
+}
+
+// Noop is a Tracer which records nothing.
+var Noop Tracer = noopTracer{}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, _ string, _ Attributes) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) End(error) {}
+
+type spanIDKey struct{}
+
+// LogTracer is a Tracer which exports every span as a structured log line.  The logs of the function are ingested
+// into Logscale, where the spans of a request can be queried by their trace_id.
+type LogTracer struct {
+	logger logrus.FieldLogger
+}
+
+var _ Tracer = (*LogTracer)(nil)
+
+// NewLogTracer returns a LogTracer exporting spans through logger.
+func NewLogTracer(logger logrus.FieldLogger) *LogTracer {
+	return &LogTracer{logger: logger}
+}
+
+func (t *LogTracer) Start(ctx context.Context, name string, attrs Attributes) (context.Context, Span) {
+	s := &logSpan{
+		attrs:   attrs,
+		id:      newSpanID(),
+		logger:  t.logger,
+		name:    name,
+		start:   time.Now(),
+		traceID: pkg.TraceIDFromContext(ctx),
+	}
+	s.parentID, _ = ctx.Value(spanIDKey{}).(string)
+	return context.WithValue(ctx, spanIDKey{}, s.id), s
+}
+
+type logSpan struct {
+	attrs    Attributes
+	id       string
+	logger   logrus.FieldLogger
+	name     string
+	parentID string
+	start    time.Time
+	traceID  string
+}
+
+func (s *logSpan) End(err error) {
+	fields := logrus.Fields{
+		"event":       "span",
+		"span_name":   s.name,
+		"span_id":     s.id,
+		"start_time":  s.start.UTC().Format(time.RFC3339Nano),
+		"duration_ms": time.Since(s.start).Milliseconds(),
+		"status":      "ok",
+	}
+	if s.traceID != "" {
+		fields["trace_id"] = s.traceID
+	}
+	if s.parentID != "" {
+		fields["parent_span_id"] = s.parentID
+	}
+	for k, v := range s.attrs {
+		fields["span."+k] = v
+	}
+	if err != nil {
+		fields["status"] = "error"
+		fields["error"] = err.Error()
+	}
+	s.logger.WithFields(fields).Info("span ended")
+}
+
+func newSpanID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,176 @@
+// Package validate validates the fields of requests against declarative rules, reporting every invalid field at
+// once rather than only the first.
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rule checks the value of a field, returning a description of the problem or an empty string if it is valid.
+type Rule func(value string) string
+
+// Field is a field of a request and the rules its value must satisfy.  The rules are applied in order and the
+// first problem found is reported.  Rules other than Required accept blank values.
+type Field struct {
+	Name  string
+	Value string
+	Rules []Rule
+}
+
+// FieldError is the problem with a field of a request.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// Errors are the problems with the fields of a request.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Fields applies the rules of each field, returning Errors holding the problems of every invalid field, or nil.
+func Fields(fields ...Field) error {
+	var errs Errors
+	for _, f := range fields {
+		for _, r := range f.Rules {
+			if msg := r(f.Value); msg != "" {
+				errs = append(errs, FieldError{Field: f.Name, Message: msg})
+				break
+			}
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Nest prefixes the names of the fields of Errors with the path of the object holding them, e.g. [2] for the
+// third element of an array.  Other errors are returned unchanged.
+func Nest(path string, err error) error {
+	var errs Errors
+	if !errors.As(err, &errs) {
+		return err
+	}
+	nested := make(Errors, len(errs))
+	for i, fe := range errs {
+		nested[i] = FieldError{Field: path + "." + fe.Field, Message: fe.Message}
+		if strings.HasPrefix(fe.Field, "[") {
+			nested[i].Field = path + fe.Field
+		}
+	}
+	return nested
+}
+
+// Join combines the Errors of several validations into one, returning nil if there are none.  Other errors are
+// returned as they are, taking precedence.
+func Join(errs ...error) error {
+	var all Errors
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		var fes Errors
+		if !errors.As(err, &fes) {
+			return err
+		}
+		all = append(all, fes...)
+	}
+	if len(all) == 0 {
+		return nil
+	}
+	return all
+}
+
+// Required rejects blank values.
+func Required() Rule {
+	return func(v string) string {
+		if strings.TrimSpace(v) == "" {
+			return "is required"
+		}
+		return ""
+	}
+}
+
+// Format rejects values not matching the regular expression, described by what it matches.
+func Format(re *regexp.Regexp, what string) Rule {
+	return func(v string) string {
+		if v == "" || re.MatchString(v) {
+			return ""
+		}
+		return fmt.Sprintf("must be %s: %q", what, v)
+	}
+}
+
+// Enum rejects values other than the given ones.
+func Enum(values ...string) Rule {
+	return func(v string) string {
+		if v == "" {
+			return ""
+		}
+		for _, e := range values {
+			if v == e {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of %s: %q", strings.Join(values, ", "), v)
+	}
+}
+
+// Int rejects values which are not integers.
+func Int() Rule {
+	return func(v string) string {
+		if _, err := strconv.Atoi(v); v != "" && err != nil {
+			return fmt.Sprintf("must be an integer: %q", v)
+		}
+		return ""
+	}
+}
+
+// AtLeast rejects integer values smaller than min.  It is combined with Int to reject other values.
+func AtLeast(min int) Rule {
+	return func(v string) string {
+		if i, err := strconv.Atoi(v); err == nil && i < min {
+			return fmt.Sprintf("must be at least %d: %d", min, i)
+		}
+		return ""
+	}
+}
+
+// Time rejects values which are not times in the layout.
+func Time(layout string) Rule {
+	return func(v string) string {
+		if v == "" {
+			return ""
+		}
+		if _, err := time.Parse(layout, v); err != nil {
+			return fmt.Sprintf("must be in the format %s: %q", layout, v)
+		}
+		return ""
+	}
+}
+
+// Check rejects values for which ok returns false, with the message.
+func Check(ok func(v string) bool, msg string) Rule {
+	return func(v string) string {
+		if v == "" || ok(v) {
+			return ""
+		}
+		return fmt.Sprintf("%s: %q", msg, v)
+	}
+}
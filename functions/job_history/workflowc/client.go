@@ -0,0 +1,311 @@
+package workflowc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Crowdstrike/foundry-sample-rapid-response/functions/job_history/pkg"
+	"github.com/crowdstrike/gofalcon/falcon/client/workflows"
+	"github.com/crowdstrike/gofalcon/falcon/models"
+	"github.com/sirupsen/logrus"
+)
+
+// WorkflowC is a Falcon Fusion workflow client interface.
+type WorkflowC interface {
+	// Execute triggers an execution of a workflow definition.
+	Execute(ctx context.Context, req ExecuteRequest) (ExecuteResponse, error)
+	// Disable disables a workflow definition, so that it is no longer triggered.
+	Disable(ctx context.Context, definitionID string) error
+	// Enable enables a disabled workflow definition.
+	Enable(ctx context.Context, definitionID string) error
+	// Provision creates a workflow definition from a system definition template, returning its ID.
+	Provision(ctx context.Context, req ProvisionRequest) (string, error)
+	// Update replaces a workflow definition with one provisioned from the request, returning the ID of the
+	// replacement.  Provisioned definitions cannot be modified in place, so the replacement has a new ID.
+	Update(ctx context.Context, definitionID string, req ProvisionRequest) (string, error)
+	// Deprovision deletes a workflow definition provisioned from a system definition template.
+	Deprovision(ctx context.Context, definitionID string) error
+	// Definition returns a workflow definition, or an error wrapping NotFound if there is none with the ID.
+	Definition(ctx context.Context, definitionID string) (Definition, error)
+	// Definitions returns every workflow definition whose name starts with namePrefix.
+	Definitions(ctx context.Context, namePrefix string) ([]Definition, error)
+}
+
+// definitionsPageSize is the number of workflow definitions requested per page of a definitions query.
+const definitionsPageSize = 500
+
+// NotFound is wrapped by the errors of requests for workflow definitions which do not exist.
+var NotFound = errors.New("workflow definition not found")
+
+// Client is the client.
+type Client struct {
+	accessToken string
+	apiHost     string
+	c           workflows.ClientService
+	hc          *http.Client
+	logger      logrus.FieldLogger
+}
+
+var _ WorkflowC = (*Client)(nil)
+
+// NewClient returns a new workflow client.
+func NewClient(c workflows.ClientService, logger logrus.FieldLogger, opts ...func(f *Client)) *Client {
+	f := &Client{
+		c:      c,
+		logger: logger,
+	}
+	for _, o := range opts {
+		o(f)
+	}
+	return f
+}
+
+// WithDefinitionActions enables the actions on workflow definitions which the Falcon API client does not
+// support: Disable, Enable, Update, Deprovision, Definition and Definitions.  They are requested from the API at
+// apiHost, e.g. api.crowdstrike.com, using hc and the access token.
+func WithDefinitionActions(hc *http.Client, apiHost, accessToken string) func(f *Client) {
+	return func(f *Client) {
+		f.accessToken = accessToken
+		f.apiHost = apiHost
+		f.hc = hc
+	}
+}
+
+func (f *Client) Execute(ctx context.Context, req ExecuteRequest) (ExecuteResponse, error) {
+	if req.DefinitionID == "" {
+		return ExecuteResponse{}, errors.New("missing workflow definition ID")
+	}
+	params := workflows.NewWorkflowsExecuteParamsWithContext(ctx)
+	params.DefinitionID = []string{req.DefinitionID}
+	params.Body = req.Payload
+
+	f.logger.WithField("definition_id", req.DefinitionID).Info("executing workflow")
+	resp, err := f.c.WorkflowsExecute(params)
+	if err != nil {
+		return ExecuteResponse{}, fmt.Errorf("failed to execute workflow: %s", err)
+	}
+	payload := resp.GetPayload()
+	if payload == nil {
+		return ExecuteResponse{}, errors.New("missing payload")
+	}
+	if len(payload.Errors) > 0 {
+		return ExecuteResponse{}, fmt.Errorf("errors returned from request: %s", joinMsaAPIErrors(payload.Errors))
+	}
+	if len(payload.Resources) == 0 {
+		return ExecuteResponse{}, errors.New("blank resources returned")
+	}
+	return ExecuteResponse{ExecutionID: payload.Resources[0]}, nil
+}
+
+func (f *Client) Disable(ctx context.Context, definitionID string) error {
+	return f.definitionAction(ctx, "disable", definitionID)
+}
+
+func (f *Client) Enable(ctx context.Context, definitionID string) error {
+	return f.definitionAction(ctx, "enable", definitionID)
+}
+
+func (f *Client) Provision(ctx context.Context, req ProvisionRequest) (string, error) {
+	if req.TemplateName == "" {
+		return "", errors.New("missing workflow template name")
+	}
+	params := workflows.NewProvisionSystemDefinitionParams()
+	params.SetBody(&models.ClientSystemDefinitionProvisionRequest{
+		Name:         &req.Name,
+		Parameters:   req.Parameters,
+		TemplateName: &req.TemplateName,
+	})
+	params.SetContext(ctx)
+
+	f.logger.WithField("template_name", req.TemplateName).
+		WithField("name", req.Name).
+		Info("provisioning workflow definition")
+	resp, err := f.c.ProvisionSystemDefinition(params)
+	if err != nil {
+		return "", fmt.Errorf("failed to provision workflow definition: %s", err)
+	}
+	payload := resp.GetPayload()
+	if payload == nil {
+		return "", errors.New("missing payload")
+	}
+	if len(payload.Errors) > 0 {
+		return "", fmt.Errorf("errors returned from request: %s", joinMsaAPIErrors(payload.Errors))
+	}
+	if len(payload.Resources) == 0 {
+		return "", errors.New("blank resources returned")
+	}
+	return payload.Resources[0], nil
+}
+
+// Update provisions the replacement before deprovisioning the definition, so that a failed update leaves the
+// definition in place.  The replacement is returned along with the error if only the deprovisioning failed.
+func (f *Client) Update(ctx context.Context, definitionID string, req ProvisionRequest) (string, error) {
+	if definitionID == "" {
+		return "", errors.New("missing workflow definition ID")
+	}
+	id, err := f.Provision(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	if err = f.Deprovision(ctx, definitionID); err != nil && !errors.Is(err, NotFound) {
+		return id, fmt.Errorf("failed to deprovision replaced workflow definition %s: %w", definitionID, err)
+	}
+	return id, nil
+}
+
+func (f *Client) Deprovision(ctx context.Context, definitionID string) error {
+	if definitionID == "" {
+		return errors.New("missing workflow definition ID")
+	}
+	f.logger.WithField("definition_id", definitionID).Info("deprovisioning workflow definition")
+	body := deprovisionRequest{DefinitionID: definitionID}
+	if err := f.do(ctx, http.MethodPost, "/workflows/system-definitions/deprovision/v1", nil, body, nil); err != nil {
+		return fmt.Errorf("failed to deprovision workflow definition: %w", err)
+	}
+	return nil
+}
+
+func (f *Client) Definition(ctx context.Context, definitionID string) (Definition, error) {
+	if definitionID == "" {
+		return Definition{}, errors.New("missing workflow definition ID")
+	}
+	q := url.Values{"filter": {fmt.Sprintf("id:'%s'", pkg.EscapeFQLValue(definitionID))}}
+	var payload definitionsResponse
+	if err := f.do(ctx, http.MethodGet, "/workflows/combined/definitions/v1", q, nil, &payload); err != nil {
+		return Definition{}, fmt.Errorf("failed to get workflow definition: %w", err)
+	}
+	for _, d := range payload.Resources {
+		if d.ID == definitionID {
+			return d, nil
+		}
+	}
+	return Definition{}, fmt.Errorf("workflow definition %s: %w", definitionID, NotFound)
+}
+
+func (f *Client) Definitions(ctx context.Context, namePrefix string) ([]Definition, error) {
+	if namePrefix == "" {
+		return nil, errors.New("missing workflow definition name prefix")
+	}
+	defs := make([]Definition, 0)
+	for offset := 0; ; {
+		q := url.Values{
+			"filter": {fmt.Sprintf("name:'%s*'", strings.ReplaceAll(namePrefix, "'", `\'`))},
+			"limit":  {strconv.Itoa(definitionsPageSize)},
+			"offset": {strconv.Itoa(offset)},
+		}
+		var payload definitionsResponse
+		err := f.do(ctx, http.MethodGet, "/workflows/combined/definitions/v1", q, nil, &payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query workflow definitions: %w", err)
+		}
+		for _, d := range payload.Resources {
+			// the filter is a wildcard match, so the prefix is checked again
+			if strings.HasPrefix(d.Name, namePrefix) {
+				defs = append(defs, d)
+			}
+		}
+		offset += len(payload.Resources)
+		if len(payload.Resources) == 0 || offset >= payload.Meta.Pagination.Total {
+			break
+		}
+	}
+	return defs, nil
+}
+
+// definitionAction performs an action, such as enable or disable, on a workflow definition.
+func (f *Client) definitionAction(ctx context.Context, action, definitionID string) error {
+	if definitionID == "" {
+		return errors.New("missing workflow definition ID")
+	}
+	f.logger.WithField("definition_id", definitionID).
+		WithField("action", action).
+		Info("performing workflow definition action")
+	q := url.Values{"action_name": {action}}
+	body := definitionActionRequest{IDs: []string{definitionID}}
+	if err := f.do(ctx, http.MethodPost, "/workflows/entities/definitions/actions/v1", q, body, nil); err != nil {
+		return fmt.Errorf("failed to %s workflow definition: %w", action, err)
+	}
+	return nil
+}
+
+// do requests a workflow API which the Falcon API client does not support, decoding the response into out
+// unless it is nil.  A 404 response is returned as NotFound.
+func (f *Client) do(ctx context.Context, method, path string, q url.Values, in, out any) error {
+	if f.hc == nil || f.apiHost == "" {
+		return errors.New("workflow definition actions are not enabled")
+	}
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to serialize request: %s", err)
+		}
+		body = bytes.NewReader(b)
+	}
+	u := url.URL{
+		Scheme:   "https",
+		Host:     f.apiHost,
+		Path:     path,
+		RawQuery: q.Encode(),
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+f.accessToken)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := f.hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return NotFound
+	}
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		var payload definitionActionResponse
+		if err := json.NewDecoder(resp.Body).Decode(&payload); err == nil && len(payload.Errors) > 0 {
+			return joinMsaAPIErrors(payload.Errors)
+		}
+		return fmt.Errorf("status code %d", resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	if err = json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %s", err)
+	}
+	return nil
+}
+
+func joinMsaAPIErrors(errs []*models.MsaAPIError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	var sb strings.Builder
+	for i, err := range errs {
+		if i == 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(fmt.Sprintf("[%d] %s", err.Code, asString(err.Message)))
+	}
+	return errors.New(sb.String())
+}
+
+func asString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,66 @@
+package workflowc
+
+import (
+	"encoding/json"
+
+	"github.com/crowdstrike/gofalcon/falcon/models"
+)
+
+// ExecuteRequest is a request to execute a workflow definition.
+type ExecuteRequest struct {
+	// DefinitionID is the ID of the workflow definition to execute.
+	DefinitionID string
+	// Payload is the JSON input of the workflow trigger.
+	Payload json.RawMessage
+}
+
+// ExecuteResponse is the result of a successful workflow execution request.
+type ExecuteResponse struct {
+	// ExecutionID is the ID of the workflow execution which was started.
+	ExecutionID string
+}
+
+// ProvisionRequest is a request to provision a workflow definition from a system definition template.
+type ProvisionRequest struct {
+	// Name is the name of the workflow definition.
+	Name string
+	// Parameters configure the trigger, conditions and activities of the template.
+	Parameters *models.ParameterTemplateProvisionParameters
+	// TemplateName is the name of the system definition template.
+	TemplateName string
+}
+
+// Definition is a workflow definition.
+type Definition struct {
+	// Enabled is true if the definition is triggered.
+	Enabled bool `json:"enabled"`
+	// ID is the ID of the definition.
+	ID string `json:"id"`
+	// Name is the name of the definition.
+	Name string `json:"name"`
+}
+
+// definitionsResponse is the body of the response to a workflow definitions query.
+type definitionsResponse struct {
+	Meta struct {
+		Pagination struct {
+			Total int `json:"total"`
+		} `json:"pagination"`
+	} `json:"meta"`
+	Resources []Definition `json:"resources"`
+}
+
+// deprovisionRequest is the body of a request to deprovision a workflow definition.
+type deprovisionRequest struct {
+	DefinitionID string `json:"definition_id"`
+}
+
+// definitionActionRequest is the body of a request for an action on workflow definitions.
+type definitionActionRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// definitionActionResponse is the body of the response to an action on workflow definitions.
+type definitionActionResponse struct {
+	Errors []*models.MsaAPIError `json:"errors"`
+}
@@ -0,0 +1,36 @@
+#script run custom PowerShell script
+# param(
+#         [parameter(Mandatory)]
+#         [string]$scriptContent,
+#         [string]$scriptArgs
+# )
+$params = $args[0] | ConvertFrom-Json
+$scriptContent = $params.scriptContent
+$scriptArgs = $params.scriptArgs
+
+#grab deviceID from registry
+$deviceID = "$(Get-ItemProperty HKLM:\SYSTEM\CurrentControlSet\Services\CSAgent\Sim | % AG | %{ "{0:x2}" -f $_ })" -replace " ",""
+
+# write the script to a temporary file and run it in a child process to capture its exit code and output
+$scriptPath = Join-Path $env:TEMP ("rapid_response_" + [guid]::NewGuid().ToString() + ".ps1")
+$stdoutPath = "$scriptPath.stdout"
+$stderrPath = "$scriptPath.stderr"
+Set-Content -Path $scriptPath -Value $scriptContent
+
+$process = Start-Process -FilePath "powershell.exe" `
+  -ArgumentList "-NoProfile -NonInteractive -ExecutionPolicy Bypass -File `"$scriptPath`" $scriptArgs" `
+  -RedirectStandardOutput $stdoutPath -RedirectStandardError $stderrPath -NoNewWindow -Wait -PassThru
+
+$stdout = Get-Content -Path $stdoutPath -Raw -ErrorAction SilentlyContinue
+$stderr = Get-Content -Path $stderrPath -Raw -ErrorAction SilentlyContinue
+Remove-Item $scriptPath, $stdoutPath, $stderrPath -ErrorAction SilentlyContinue
+
+#create JSON Object
+$jsonResponse = @{
+  deviceID= "$deviceID"
+  exit_code= "$($process.ExitCode)"
+  stdout= "$stdout"
+  stderr= "$stderr"
+} | ConvertTo-Json
+
+Write-Output $jsonResponse